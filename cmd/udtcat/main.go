@@ -0,0 +1,251 @@
+/*
+Command udtcat reads and writes data across UDT connections, in the spirit of netcat.
+
+To connect to a server and exchange data with it over stdin and stdout:
+
+	udtcat host port
+
+To accept a single connection and do the same:
+
+	udtcat -l [host] port
+
+By default the connection is a stream.  With -m it is a datagram connection instead, where each line read from stdin
+is sent as a separate message and each message received is written to stdout on its own line.  Transfer statistics
+are printed to stderr when the connection ends if -stats is given.
+
+The connection is closed once stdin reaches end-of-file (after any data still queued has been delivered) or when the
+peer closes it.  Use -d to only receive, for instance when running udtcat in the background:
+
+	udtcat -l -d 9000 > received.bin &
+	udtcat localhost 9000 < file.bin
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+var (
+	listen      = flag.Bool("l", false, "listen for an incoming connection rather than dialing out")
+	messageMode = flag.Bool("m", false, "message mode: use a datagram connection, with one message per line")
+	sourceAddr  = flag.String("s", "", "local address to dial from (host:port)")
+	maxPacket   = flag.Uint("mss", 0, "upper limit on the packet size (0 = discover from the interface)")
+	maxBW       = flag.Uint64("bw", 0, "maximum bandwidth to use, in bytes/sec (0 = unlimited)")
+	flowWindow  = flag.Uint("flowwin", 0, "maximum number of unacknowledged packets (0 = default)")
+	linger      = flag.Duration("linger", 0, "time to wait for undelivered data when closing (0 = default)")
+	fecBlock    = flag.Uint("fec", 0, "protect every N data packets with an FEC parity packet (0 = disabled)")
+	compress    = flag.Bool("z", false, "compress data packets with LZ4 (the peer must also use -z)")
+	noStdin     = flag.Bool("d", false, "do not read from stdin; only write what is received to stdout")
+	showStats   = flag.Bool("stats", false, "print transfer statistics to stderr on exit")
+	verbose     = flag.Bool("v", false, "show the package's connection logging")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [options] host port\n       %s -l [options] [host] port\n\n", os.Args[0], os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	var host, port string
+	switch flag.NArg() {
+	case 1:
+		if !*listen {
+			usage()
+			os.Exit(2)
+		}
+		port = flag.Arg(0)
+	case 2:
+		host, port = flag.Arg(0), flag.Arg(1)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	config := udt.DefaultConfig()
+	config.MaxPacketSize = *maxPacket
+	config.MaxBandwidth = *maxBW
+	config.FECBlockSize = *fecBlock
+	if *flowWindow > 0 {
+		config.MaxFlowWinSize = *flowWindow
+	}
+	if *linger > 0 {
+		config.LingerTime = *linger
+	}
+	if *compress {
+		config.Compression = udt.CompressionLZ4
+	}
+
+	var conn net.Conn
+	var err error
+	if *listen {
+		conn, err = acceptOne(config, addr)
+	} else {
+		conn, err = dial(config, addr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "udtcat: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	sent, recvd := pipe(conn)
+	if *showStats {
+		printStats(conn, sent, recvd, time.Since(start))
+	}
+}
+
+func acceptOne(config *udt.Config, addr string) (net.Conn, error) {
+	l, err := config.Listen(context.Background(), "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	return l.Accept()
+}
+
+func dial(config *udt.Config, addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return config.Dial(context.Background(), "udp", *sourceAddr, raddr, !*messageMode)
+}
+
+// pipe copies stdin to the connection and the connection to stdout until either side is finished, returning the
+// number of bytes sent and received
+func pipe(conn net.Conn) (sent uint64, recvd uint64) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var err error
+		if *messageMode {
+			err = readMessages(conn, os.Stdout, &recvd)
+		} else {
+			err = readStream(conn, os.Stdout, &recvd)
+		}
+		if err != nil && *verbose {
+			fmt.Fprintf(os.Stderr, "udtcat: connection closed: %s\n", err.Error())
+		}
+	}()
+
+	if *noStdin {
+		<-done
+		conn.Close()
+		return 0, atomic.LoadUint64(&recvd)
+	}
+
+	go func() {
+		var err error
+		if *messageMode {
+			err = writeMessages(conn, os.Stdin, &sent)
+		} else {
+			err = writeStream(conn, os.Stdin, &sent)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "udtcat: %s\n", err.Error())
+		}
+
+		// closing lingers until our peer has received everything we've sent
+		conn.Close()
+	}()
+
+	<-done
+	conn.Close()
+	return atomic.LoadUint64(&sent), atomic.LoadUint64(&recvd)
+}
+
+func writeStream(conn net.Conn, in io.Reader, count *uint64) error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			// the connection may hold on to what we write, so don't reuse the buffer
+			out := make([]byte, n)
+			copy(out, buf[:n])
+			if _, werr := conn.Write(out); werr != nil {
+				return werr
+			}
+			atomic.AddUint64(count, uint64(n))
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func readStream(conn net.Conn, out io.Writer, count *uint64) error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			atomic.AddUint64(count, uint64(n))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeMessages(conn net.Conn, in io.Reader, count *uint64) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for scanner.Scan() {
+		// the connection may hold on to what we write, so don't reuse the scanner's buffer
+		msg := append([]byte(nil), scanner.Bytes()...)
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+		atomic.AddUint64(count, uint64(len(msg)))
+	}
+	return scanner.Err()
+}
+
+func readMessages(conn net.Conn, out io.Writer, count *uint64) error {
+	for {
+		msg, info, err := conn.(udt.Conn).ReadMessage()
+		if err != nil {
+			return err
+		}
+		if info.Truncated && *verbose {
+			fmt.Fprintf(os.Stderr, "udtcat: message %d was truncated\n", info.MsgNum)
+		}
+		if _, err = out.Write(append(msg, '\n')); err != nil {
+			return err
+		}
+		atomic.AddUint64(count, uint64(len(msg)))
+	}
+}
+
+func printStats(conn net.Conn, sent uint64, recvd uint64, elapsed time.Duration) {
+	fmt.Fprintf(os.Stderr, "%s <-> %s: sent %d bytes, received %d bytes in %v\n", conn.LocalAddr().String(),
+		conn.RemoteAddr().String(), sent, recvd, elapsed.Round(time.Millisecond))
+	if uc, ok := conn.(udt.Conn); ok {
+		stats := uc.Stats()
+		fmt.Fprintf(os.Stderr, "packets sent %d, retransmitted %d, reported lost %d, recovered by FEC %d\n",
+			stats.PktSent, stats.PktRetrans, stats.PktSndLoss, stats.PktRcvFEC)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+func runClient() error {
+	raddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(*clientAddr, fmt.Sprint(*port)))
+	if err != nil {
+		return err
+	}
+	laddr := ""
+	if *bindAddr != "" {
+		laddr = net.JoinHostPort(*bindAddr, "0")
+	}
+
+	conn, err := udt.DialUDT("udp", laddr, raddr, !*datagram)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Printf("Connected to %s from %s\n", conn.RemoteAddr().String(), conn.LocalAddr().String())
+
+	mode := byte(modeThroughput)
+	if *roundtrip {
+		mode = modeRoundtrip
+	}
+	if _, err := conn.Write(encodeHeader(mode, *datagram, *writeSize)); err != nil {
+		return err
+	}
+
+	if *roundtrip {
+		return measureRoundtrip(conn)
+	}
+	return measureThroughput(conn)
+}
+
+func measureThroughput(conn net.Conn) error {
+	buf := make([]byte, *writeSize)
+	r := newReporter(conn.LocalAddr().String()+" send", *interval)
+	stop := time.Now().Add(*duration)
+	for time.Now().Before(stop) {
+		n, err := conn.Write(buf)
+		r.add(n)
+		if err != nil {
+			r.finish()
+			return err
+		}
+	}
+
+	// writes are queued rather than sent immediately, so include the time taken to deliver everything
+	err := conn.Close()
+	r.finish()
+	printStats(conn)
+	return err
+}
+
+func measureRoundtrip(conn net.Conn) error {
+	buf := make([]byte, *writeSize)
+	var samples []time.Duration
+	var total time.Duration
+	nextReport := time.Now().Add(*interval)
+	stop := time.Now().Add(*duration)
+	for time.Now().Before(stop) {
+		start := time.Now()
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+		if err := readMessage(conn, *datagram, buf); err != nil {
+			return err
+		}
+		sample := time.Since(start)
+		samples = append(samples, sample)
+		total += sample
+
+		if *interval > 0 && time.Now().After(nextReport) {
+			fmt.Printf("%6d messages  last %v  avg %v\n", len(samples), sample, total/time.Duration(len(samples)))
+			nextReport = nextReport.Add(*interval)
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	fmt.Printf("%d messages of %d bytes: min %v  avg %v  median %v  p99 %v  max %v\n", len(samples), *writeSize,
+		samples[0], total/time.Duration(len(samples)), samples[len(samples)/2], samples[len(samples)*99/100],
+		samples[len(samples)-1])
+	return nil
+}
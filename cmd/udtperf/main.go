@@ -0,0 +1,114 @@
+/*
+Command udtperf measures the throughput and latency of a UDT connection, in the spirit of iperf.
+
+Start a server on one host:
+
+	udtperf -s
+
+and then run a test against it from another:
+
+	udtperf -c server.example.com -t 30s
+
+By default the client sends as much data as it can for the test duration, reporting the throughput seen at each
+interval.  With -rtt the client instead sends small messages one at a time and waits for the server to echo each
+one back, reporting the roundtrip latency.  With -dgram the test uses a datagram (message) connection instead of
+a stream.
+*/
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// The first thing the client sends is a test header: the test mode, whether this is a datagram connection, and the
+// size of each write
+const (
+	headerSize     = 8
+	modeThroughput = 'T'
+	modeRoundtrip  = 'R'
+	maxMessageSize = 4 << 20 // largest write we'll accept from a client
+)
+
+var (
+	serverMode = flag.Bool("s", false, "run as a server")
+	clientAddr = flag.String("c", "", "run as a client, connecting to the specified server")
+	port       = flag.Int("p", 9000, "port the server listens on")
+	bindAddr   = flag.String("B", "", "local address to bind to")
+	duration   = flag.Duration("t", 10*time.Second, "how long to run the test for")
+	interval   = flag.Duration("i", time.Second, "time between periodic reports (0 to disable)")
+	writeSize  = flag.Int("l", 128<<10, "size of each write (with -rtt: size of each message, default 64)")
+	roundtrip  = flag.Bool("rtt", false, "measure message roundtrip time rather than throughput")
+	datagram   = flag.Bool("dgram", false, "use a datagram connection rather than a stream")
+	verbose    = flag.Bool("v", false, "show the package's connection logging")
+)
+
+func main() {
+	flag.Parse()
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	if *roundtrip && !flagSet("l") {
+		*writeSize = 64
+	}
+	if *writeSize <= 0 || *writeSize > maxMessageSize {
+		fmt.Fprintf(os.Stderr, "udtperf: -l must be between 1 and %d\n", maxMessageSize)
+		os.Exit(2)
+	}
+
+	var err error
+	switch {
+	case *serverMode && *clientAddr == "":
+		err = runServer()
+	case !*serverMode && *clientAddr != "":
+		err = runClient()
+	default:
+		fmt.Fprintln(os.Stderr, "udtperf: exactly one of -s or -c must be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "udtperf: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func flagSet(name string) (found bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return
+}
+
+func encodeHeader(mode byte, isDatagram bool, size int) []byte {
+	hdr := make([]byte, headerSize)
+	hdr[0] = mode
+	if isDatagram {
+		hdr[1] = 1
+	}
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(size))
+	return hdr
+}
+
+func decodeHeader(hdr []byte) (mode byte, isDatagram bool, size int) {
+	return hdr[0], hdr[1] != 0, int(binary.BigEndian.Uint32(hdr[4:8]))
+}
+
+// readMessage reads a complete message of the specified size (a datagram connection returns one per Read)
+func readMessage(conn net.Conn, isDatagram bool, msg []byte) error {
+	if isDatagram {
+		_, err := conn.Read(msg)
+		return err
+	}
+	_, err := io.ReadFull(conn, msg)
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+// reporter tracks the number of bytes transferred, periodically printing the throughput
+type reporter struct {
+	name       string
+	start      time.Time
+	mut        sync.Mutex
+	total      uint64 // bytes transferred since the start of the test
+	sinceLast  uint64 // bytes transferred since the last report
+	lastReport time.Time
+	done       chan struct{}
+}
+
+func newReporter(name string, interval time.Duration) *reporter {
+	now := time.Now()
+	r := &reporter{
+		name:       name,
+		start:      now,
+		lastReport: now,
+		done:       make(chan struct{}),
+	}
+	if interval > 0 {
+		go r.goReport(interval)
+	}
+	return r
+}
+
+func (r *reporter) goReport(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			r.mut.Lock()
+			r.print(now, r.lastReport, r.sinceLast)
+			r.sinceLast = 0
+			r.lastReport = now
+			r.mut.Unlock()
+		}
+	}
+}
+
+func (r *reporter) add(n int) {
+	if n <= 0 {
+		return
+	}
+	r.mut.Lock()
+	r.total += uint64(n)
+	r.sinceLast += uint64(n)
+	r.mut.Unlock()
+}
+
+// finish stops periodic reporting and prints the results for the whole test
+func (r *reporter) finish() {
+	close(r.done)
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.print(time.Now(), r.start, r.total)
+}
+
+func (r *reporter) print(now time.Time, from time.Time, bytes uint64) {
+	elapsed := now.Sub(from)
+	if elapsed <= 0 {
+		return
+	}
+	fmt.Printf("%s  %6.2f-%6.2f sec  %s  %s\n", r.name, from.Sub(r.start).Seconds(), now.Sub(r.start).Seconds(),
+		formatBytes(float64(bytes)), formatBits(float64(bytes)*8/elapsed.Seconds()))
+}
+
+func formatBytes(n float64) string {
+	units := []string{"Bytes", "KBytes", "MBytes", "GBytes", "TBytes"}
+	idx := 0
+	for n >= 1024 && idx < len(units)-1 {
+		n /= 1024
+		idx++
+	}
+	return fmt.Sprintf("%7.2f %s", n, units[idx])
+}
+
+func formatBits(n float64) string {
+	units := []string{"bits/sec", "Kbits/sec", "Mbits/sec", "Gbits/sec", "Tbits/sec"}
+	idx := 0
+	for n >= 1000 && idx < len(units)-1 {
+		n /= 1000
+		idx++
+	}
+	return fmt.Sprintf("%7.2f %s", n, units[idx])
+}
+
+// printStats prints the connection's performance metrics, if it exposes them
+func printStats(conn net.Conn) {
+	if uc, ok := conn.(udt.Conn); ok {
+		stats := uc.Stats()
+		fmt.Printf("packets sent %d, retransmitted %d, reported lost %d, recovered by FEC %d\n",
+			stats.PktSent, stats.PktRetrans, stats.PktSndLoss, stats.PktRcvFEC)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+func runServer() error {
+	laddr := net.JoinHostPort(*bindAddr, fmt.Sprint(*port))
+	l, err := udt.ListenUDT("udp", laddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Printf("Server listening on %s\n", l.Addr().String())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serve(conn)
+	}
+}
+
+func serve(conn net.Conn) {
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+	fmt.Printf("Accepted connection from %s\n", peer)
+
+	hdr := make([]byte, headerSize)
+	if err := readMessage(conn, false, hdr); err != nil {
+		fmt.Printf("%s: unable to read test header: %s\n", peer, err.Error())
+		return
+	}
+	mode, isDatagram, size := decodeHeader(hdr)
+	if size <= 0 || size > maxMessageSize {
+		fmt.Printf("%s: invalid message size %d\n", peer, size)
+		return
+	}
+
+	buf := make([]byte, size)
+	switch mode {
+	case modeThroughput:
+		r := newReporter(peer+" recv", *interval)
+		for {
+			n, err := conn.Read(buf)
+			r.add(n)
+			if err != nil {
+				break
+			}
+		}
+		r.finish()
+		printStats(conn)
+
+	case modeRoundtrip:
+		// echo back each message as we receive it
+		for {
+			if err := readMessage(conn, isDatagram, buf); err != nil {
+				break
+			}
+			if _, err := conn.Write(buf); err != nil {
+				break
+			}
+		}
+
+	default:
+		fmt.Printf("%s: unknown test mode %q\n", peer, mode)
+	}
+}
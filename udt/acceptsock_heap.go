@@ -45,36 +45,30 @@ func (h *acceptSockHeap) Pop() interface{} {
 }
 
 func (h acceptSockHeap) compare(sockID uint32, initSeqNo packet.PacketID, idx int) int {
-	if sockID < h[idx].sockID {
+	if h[idx].sockID < sockID {
 		return -1
 	}
-	if sockID > h[idx].sockID {
+	if h[idx].sockID > sockID {
 		return +1
 	}
-	if initSeqNo.Seq < h[idx].initSeqNo.Seq {
+	if h[idx].initSeqNo.Seq < initSeqNo.Seq {
 		return -1
 	}
-	if initSeqNo.Seq > h[idx].initSeqNo.Seq {
+	if h[idx].initSeqNo.Seq > initSeqNo.Seq {
 		return +1
 	}
 	return 0
 }
 
-// Find does a binary search of the heap for the specified packetID which is returned
+// Find does a search of the heap for the specified packetID which is returned
 func (h acceptSockHeap) Find(sockID uint32, initSeqNo packet.PacketID) (*udtSocket, int) {
-	len := len(h)
-	idx := 0
-	for idx < len {
-		cmp := h.compare(sockID, initSeqNo, idx)
-		if cmp == 0 {
-			return h[idx].sock, idx
-		} else if cmp > 0 {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	idx := heapFind(len(h), 0, func(idx int) int {
+		return h.compare(sockID, initSeqNo, idx)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return h[idx].sock, idx
 }
 
 // Prune removes any entries that have a lastTouched before the specified time
@@ -0,0 +1,63 @@
+package udt
+
+import (
+	"errors"
+	"net"
+)
+
+/*
+The local and remote addresses of a connection are reported as a UDTAddr, so they can be told apart from plain UDP
+addresses in logs (and by anything choosing how to handle a connection based on its network).  As many UDT connections
+may share a single UDP address, each also carries the socket ID identifying the connection at that address.
+
+Anywhere a network name is passed in, "udt", "udt4" and "udt6" are accepted as equivalents of "udp", "udp4" and "udp6".
+Listeners report their address as a UDTAddr too (with no socket ID), and the remote address passed to the Dial and
+Rendezvous functions may be a *UDTAddr, a *net.UDPAddr, or any other net.Addr whose String is a "host:port" to resolve.
+*/
+
+// UDTAddr represents the address of one end of a UDT connection
+type UDTAddr struct {
+	net.UDPAddr
+	SocketID uint32 // the socket ID of this end of the connection (zero if not yet known)
+}
+
+// Network returns the address's network name, "udt"
+func (a *UDTAddr) Network() string {
+	return "udt"
+}
+
+// String returns the UDP address (such as "192.0.2.1:9000"), in a form that can be passed to Dial or Listen
+func (a *UDTAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	return a.UDPAddr.String()
+}
+
+// udpNetwork returns the UDP network name corresponding to a network passed by the caller
+func udpNetwork(network string) string {
+	switch network {
+	case "udt":
+		return "udp"
+	case "udt4":
+		return "udp4"
+	case "udt6":
+		return "udp6"
+	default:
+		return network
+	}
+}
+
+// udpAddrOf returns the UDP address of a remote address passed by the caller
+func udpAddrOf(network string, addr net.Addr) (*net.UDPAddr, error) {
+	switch a := addr.(type) {
+	case nil:
+		return nil, errors.New("No remote address")
+	case *net.UDPAddr:
+		return a, nil
+	case *UDTAddr:
+		return &a.UDPAddr, nil
+	default:
+		return net.ResolveUDPAddr(udpNetwork(network), a.String())
+	}
+}
@@ -0,0 +1,68 @@
+package udt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestUDTAddr(t *testing.T) {
+	serv, err := ListenUDT("udt", fmt.Sprintf("127.0.0.1:%d", serverPort+62))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := serv.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	// the listener's address is a UDTAddr, which can be dialed as it is
+	if addr, ok := serv.Addr().(*UDTAddr); !ok || addr.SocketID != 0 {
+		t.Fatalf("expected the listener to report a *UDTAddr with no socket ID, got %#v", serv.Addr())
+	}
+	client, err := DialUDT("udt4", fmt.Sprintf("127.0.0.1:%d", clientPort+62), serv.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	local, ok := client.LocalAddr().(*UDTAddr)
+	if !ok {
+		t.Fatalf("expected LocalAddr to return a *UDTAddr, got %T", client.LocalAddr())
+	}
+	remote := client.RemoteAddr().(*UDTAddr)
+	if local.Network() != "udt" || remote.Network() != "udt" {
+		t.Errorf("addresses report networks %q and %q", local.Network(), remote.Network())
+	}
+	if remote.String() != serv.Addr().String() {
+		t.Errorf("remote address %s doesn't match the listener at %s", remote, serv.Addr())
+	}
+
+	// each end's view of the socket IDs agrees with the other's
+	if local.SocketID == 0 || local.SocketID != server.RemoteAddr().(*UDTAddr).SocketID {
+		t.Errorf("client socket ID %d, server sees %d", local.SocketID, server.RemoteAddr().(*UDTAddr).SocketID)
+	}
+	if remote.SocketID == 0 || remote.SocketID != server.LocalAddr().(*UDTAddr).SocketID {
+		t.Errorf("server socket ID %d, client sees %d", server.LocalAddr().(*UDTAddr).SocketID, remote.SocketID)
+	}
+}
+
+func TestDialAddrTypes(t *testing.T) {
+	want := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000}
+	for _, addr := range []net.Addr{want, &UDTAddr{UDPAddr: *want, SocketID: 5}, &net.TCPAddr{IP: want.IP, Port: 9000}} {
+		got, err := udpAddrOf("udt4", addr)
+		if err != nil {
+			t.Errorf("error converting %T: %s", addr, err.Error())
+		} else if !got.IP.Equal(want.IP) || got.Port != want.Port {
+			t.Errorf("converted %T %s to %s", addr, addr, got)
+		}
+	}
+	if _, err := DialUDT("udp", "127.0.0.1:0", nil, true); err == nil {
+		t.Error("expected an error dialing without a remote address")
+	}
+}
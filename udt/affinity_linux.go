@@ -0,0 +1,23 @@
+package udt
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const maxAffinityCPU = 1024 // size of the CPU set we pass the kernel, as glibc's cpu_set_t
+
+// setThreadAffinity pins the calling OS thread to the specified CPU
+func setThreadAffinity(cpu int) error {
+	if cpu < 0 || cpu >= maxAffinityCPU {
+		return fmt.Errorf("CPU %d out of range", cpu)
+	}
+	var mask [maxAffinityCPU / 64]uint64
+	mask[cpu/64] = 1 << uint(cpu%64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package udt
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSetThreadAffinity(t *testing.T) {
+	done := make(chan error, 2)
+	go func() {
+		runtime.LockOSThread() // never unlocked, so this thread exits with us rather than keeping its affinity
+		done <- setThreadAffinity(0)
+		done <- setThreadAffinity(maxAffinityCPU)
+	}()
+	if err := <-done; err != nil {
+		t.Errorf("unable to pin thread to CPU 0: %s", err.Error())
+	}
+	if err := <-done; err == nil {
+		t.Error("expected pinning to a CPU beyond the kernel's set to fail")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import "errors"
+
+// setThreadAffinity pins the calling OS thread to the specified CPU
+func setThreadAffinity(cpu int) error {
+	return errors.New("CPU affinity is not supported on this platform")
+}
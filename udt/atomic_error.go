@@ -0,0 +1,26 @@
+package udt
+
+import (
+	"sync/atomic"
+)
+
+// atomicError holds an error that may be read and changed from any goroutine
+type atomicError struct {
+	val atomic.Value // holds an errorRef
+}
+
+// errorRef holds an error, as atomic.Value requires its values to all be of the same type
+type errorRef struct {
+	err error
+}
+
+func (s *atomicError) get() error {
+	if ref, ok := s.val.Load().(errorRef); ok {
+		return ref.err
+	}
+	return nil
+}
+
+func (s *atomicError) set(err error) {
+	s.val.Store(errorRef{err: err})
+}
@@ -15,3 +15,21 @@ func (s *atomicUint32) get() uint32 {
 func (s *atomicUint32) set(v uint32) {
 	atomic.StoreUint32(&s.val, v)
 }
+
+func (s *atomicUint32) compareAndSwap(old, new uint32) bool {
+	return atomic.CompareAndSwapUint32(&s.val, old, new)
+}
+
+func (s *atomicUint32) add(v uint32) uint32 {
+	return atomic.AddUint32(&s.val, v)
+}
+
+// raise sets the value to v if v is larger
+func (s *atomicUint32) raise(v uint32) {
+	for {
+		old := s.get()
+		if v <= old || s.compareAndSwap(old, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package udt
+
+import (
+	"sync/atomic"
+)
+
+type atomicUint64 struct {
+	val uint64
+}
+
+func (s *atomicUint64) get() uint64 {
+	return atomic.LoadUint64(&s.val)
+}
+
+func (s *atomicUint64) set(v uint64) {
+	atomic.StoreUint64(&s.val, v)
+}
+
+func (s *atomicUint64) add(v uint64) uint64 {
+	return atomic.AddUint64(&s.val, v)
+}
+
+func (s *atomicUint64) compareAndSwap(old, new uint64) bool {
+	return atomic.CompareAndSwapUint64(&s.val, old, new)
+}
+
+// raise sets the value to v if v is larger
+func (s *atomicUint64) raise(v uint64) {
+	for {
+		old := s.get()
+		if v <= old || s.compareAndSwap(old, v) {
+			return
+		}
+	}
+}
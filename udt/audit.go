@@ -0,0 +1,90 @@
+package udt
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.OnAudit is passed an AuditEvent whenever a listener accepts or refuses a connection, and whenever an established
+connection closes, giving operators of relays and other servers an audit trail comparable to a TCP access log.  It's
+called from the listener's or connection's own goroutines, so it should return promptly (such as by writing the event
+to a log, or passing it along a buffered channel).
+*/
+
+// AuditEventType identifies what an AuditEvent is reporting
+type AuditEventType int
+
+const (
+	// AuditAccepted is reported when a listener creates a connection for a dialing peer
+	AuditAccepted AuditEventType = iota + 1
+	// AuditRefused is reported when a listener refuses a dialing peer (see AuditEvent.Reject)
+	AuditRefused
+	// AuditClosed is reported when an established connection closes (see AuditEvent.Err)
+	AuditClosed
+)
+
+func (t AuditEventType) String() string {
+	switch t {
+	case AuditAccepted:
+		return "accepted"
+	case AuditRefused:
+		return "refused"
+	case AuditClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("event(%d)", int(t))
+	}
+}
+
+// AuditEvent describes a connection being accepted, refused or closed, see Config.OnAudit
+type AuditEvent struct {
+	Type       AuditEventType
+	Time       time.Time
+	LocalAddr  *UDTAddr      // our end of the connection (with a zero SocketID if it was refused)
+	RemoteAddr *UDTAddr      // the peer's end of the connection
+	Reject     *RejectError  // AuditRefused: what the peer was told
+	Err        error         // AuditClosed: why the connection closed (nil if it was closed normally)
+	ByteSent   uint64        // AuditClosed: payload bytes written to the connection
+	ByteRecv   uint64        // AuditClosed: payload bytes received on the connection
+	Duration   time.Duration // AuditClosed: how long the connection was open
+}
+
+// audit passes an event about this connection to Config.OnAudit
+func (s *udtSocket) audit(eventType AuditEventType, err error) {
+	onAudit := s.Config.OnAudit
+	if onAudit == nil {
+		return
+	}
+	now := s.clock.Now()
+	event := AuditEvent{
+		Type:       eventType,
+		Time:       now,
+		LocalAddr:  s.LocalAddr().(*UDTAddr),
+		RemoteAddr: s.RemoteAddr().(*UDTAddr),
+	}
+	if eventType == AuditClosed {
+		event.Err = err
+		event.ByteSent = s.byteSent.get()
+		event.ByteRecv = s.byteRecv.get()
+		event.Duration = now.Sub(s.created)
+	}
+	onAudit(event)
+}
+
+// refuse rejects a dialing peer's handshake, reporting it to Config.OnAudit
+func (l *listener) refuse(m *multiplexer, hsPacket *packet.HandshakePacket, from *net.UDPAddr, rej *RejectError) {
+	m.rejectHandshake(hsPacket, from, rej)
+	if onAudit := l.config.OnAudit; onAudit != nil {
+		onAudit(AuditEvent{
+			Type:       AuditRefused,
+			Time:       l.clock.Now(),
+			LocalAddr:  &UDTAddr{UDPAddr: *m.laddr},
+			RemoteAddr: &UDTAddr{UDPAddr: *from, SocketID: hsPacket.SockID},
+			Reject:     rej,
+		})
+	}
+}
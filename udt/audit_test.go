@@ -0,0 +1,86 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// nextAudit waits for the next event passed to Config.OnAudit
+func nextAudit(t *testing.T, events <-chan AuditEvent) AuditEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an audit event")
+		return AuditEvent{}
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	refusedAddr := fmt.Sprintf("127.0.0.1:%d", clientPort+93)
+	events := make(chan AuditEvent, 10)
+	servConfig := DefaultConfig()
+	servConfig.OnAudit = func(event AuditEvent) { events <- event }
+	servConfig.CanAccept = func(hsPacket *packet.HandshakePacket, from *net.UDPAddr) error {
+		if from.String() == refusedAddr {
+			return Reject(RejectUser, "go away")
+		}
+		return nil
+	}
+	l, err := servConfig.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+92))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+92), l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	event := nextAudit(t, events)
+	if event.Type != AuditAccepted || event.RemoteAddr.SocketID != client.LocalAddr().(*UDTAddr).SocketID {
+		t.Errorf("expected the connection to be reported as accepted, got %+v", event)
+	}
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if _, err := server.Read(buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if _, err := server.Write([]byte("hi")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	server.Close()
+	event = nextAudit(t, events)
+	if event.Type != AuditClosed || event.ByteRecv != 5 || event.ByteSent != 2 {
+		t.Errorf("expected the connection to be reported closed after receiving 5 bytes and sending 2, got %+v", event)
+	}
+
+	_, err = DialUDT("udp", refusedAddr, l.Addr(), true)
+	var rej *RejectError
+	if !errors.As(err, &rej) {
+		t.Fatalf("expected to be refused, got %v", err)
+	}
+	event = nextAudit(t, events)
+	if event.Type != AuditRefused || event.Reject == nil || event.Reject.Reason != RejectUser ||
+		event.RemoteAddr.String() != refusedAddr {
+		t.Errorf("expected the refusal to be reported, got %+v", event)
+	}
+}
@@ -0,0 +1,118 @@
+package udt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"log"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+When Config.PreSharedKey is set, both ends of a connection prove to each other that they hold the same key before it's
+established, so that a service exposed to the network can't be connected to by anyone who can merely reach its port.
+
+The dialing side answers the listener's syn cookie (which serves as the listener's challenge) with a handshake carrying
+the HsExtAuth extension: a random nonce of its own, followed by an HMAC-SHA256 over the handshake's fields, the cookie
+and the nonce (and any early data, see earlydata.go).  A listener expecting a key refuses handshakes without a valid
+proof with RejectAuth.  The listener's response carries its own HMAC over the same fields, the nonce and its socket ID,
+which the dialer checks before considering itself connected (failing with ErrAuthFailed if it doesn't match).
+
+The key itself is never sent.  Rendezvous connections have no challenge to answer, so can't be authenticated this way.
+*/
+
+const authNonceSize = 16 // bytes of random nonce the dialing side adds to its proof
+
+// ErrAuthFailed is returned when dialing a peer that couldn't prove it holds our Config.PreSharedKey
+var ErrAuthFailed = errors.New("Peer failed to authenticate with the pre-shared key")
+
+// authFields is the part of a dialing side's handshake that its proof (and the listener's reply) covers
+type authFields struct {
+	sockType   packet.SocketType
+	initPktSeq packet.PacketID
+	sockID     uint32 // the dialing side's socket ID
+	synCookie  uint32
+	nonce      []byte
+	earlyData  []byte // the dialing side's early data, if any (see earlydata.go)
+}
+
+// fieldsFrom returns the fields a dialing side's proof covers from one of its handshakes
+func fieldsFrom(p *packet.HandshakePacket, nonce []byte) authFields {
+	earlyData, _ := p.Extension(packet.HsExtEarlyData)
+	return authFields{sockType: p.SockType, initPktSeq: p.InitPktSeq, sockID: p.SockID, synCookie: p.SynCookie, nonce: nonce,
+		earlyData: earlyData}
+}
+
+// proof returns the HMAC proving knowledge of key over these fields, from the dialing side if servSockID is zero and
+// otherwise from the listening side (whose socket ID it is)
+func (f authFields) proof(key []byte, servSockID uint32) []byte {
+	mac := hmac.New(sha256.New, key)
+	if servSockID == 0 {
+		mac.Write([]byte("udt-auth dialer"))
+	} else {
+		mac.Write([]byte("udt-auth listener"))
+	}
+	var buf [20]byte
+	endianness.PutUint32(buf[0:], uint32(f.sockType))
+	endianness.PutUint32(buf[4:], f.initPktSeq.Seq)
+	endianness.PutUint32(buf[8:], f.sockID)
+	endianness.PutUint32(buf[12:], f.synCookie)
+	endianness.PutUint32(buf[16:], servSockID)
+	mac.Write(buf[:])
+	mac.Write(f.nonce)
+	mac.Write(f.earlyData)
+	return mac.Sum(nil)
+}
+
+// newAuthNonce returns the random nonce a dialing side includes in its proof
+func newAuthNonce() []byte {
+	nonce := make([]byte, authNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Fatalf("Unable to generate authentication nonce: %s", err)
+	}
+	return nonce
+}
+
+// checkDialerAuth returns true if a dialing side's handshake proves it holds key
+func checkDialerAuth(key []byte, p *packet.HandshakePacket) bool {
+	ext, ok := p.Extension(packet.HsExtAuth)
+	if !ok || len(ext) != authNonceSize+sha256.Size {
+		return false
+	}
+	nonce := ext[:authNonceSize]
+	return hmac.Equal(ext[authNonceSize:], fieldsFrom(p, nonce).proof(key, 0))
+}
+
+// authExtension returns the proof to add to a handshake we're sending, if we're using a pre-shared key
+func (s *udtSocket) authExtension(synCookie uint32, reqType packet.HandshakeReqType) (packet.HandshakeExtension, bool) {
+	key := s.Config.PreSharedKey
+	if len(key) == 0 || s.authNonce == nil || reqType != packet.HsResponse {
+		return packet.HandshakeExtension{}, false
+	}
+	sockType := s.sockType()
+	if s.isServer {
+		f := authFields{sockType: sockType, initPktSeq: s.initPktSeq, sockID: s.farSockID.get(), synCookie: synCookie, nonce: s.authNonce}
+		return packet.HandshakeExtension{Type: packet.HsExtAuth, Data: f.proof(key, s.sockID)}, true
+	}
+	f := authFields{sockType: sockType, initPktSeq: s.initPktSeq, sockID: s.sockID, synCookie: synCookie, nonce: s.authNonce,
+		earlyData: s.earlyData}
+	data := append(append([]byte{}, s.authNonce...), f.proof(key, 0)...)
+	return packet.HandshakeExtension{Type: packet.HsExtAuth, Data: data}, true
+}
+
+// checkListenerAuth verifies the proof in a listener's response to our handshake, if we're using a pre-shared key
+func (s *udtSocket) checkListenerAuth(p *packet.HandshakePacket) bool {
+	key := s.Config.PreSharedKey
+	if len(key) == 0 {
+		return true
+	}
+	ext, ok := p.Extension(packet.HsExtAuth)
+	if !ok {
+		return false
+	}
+	sockType := s.sockType()
+	f := authFields{sockType: sockType, initPktSeq: s.initPktSeq, sockID: s.sockID, synCookie: p.SynCookie, nonce: s.authNonce}
+	return hmac.Equal(ext, f.proof(key, p.SockID))
+}
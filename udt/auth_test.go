@@ -0,0 +1,67 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestPreSharedKey(t *testing.T) {
+	servConfig := DefaultConfig()
+	servConfig.PreSharedKey = []byte("open sesame")
+	l, err := servConfig.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+88))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	clientAddr := fmt.Sprintf("127.0.0.1:%d", clientPort+88)
+
+	// a dialer holding the same key is let in
+	config := DefaultConfig()
+	config.PreSharedKey = []byte("open sesame")
+	client, err := config.Dial(context.Background(), "udp", clientAddr, l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing with the right key: %s", err.Error())
+	}
+	server := <-accepted
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+	client.Close()
+	server.Close()
+
+	// anyone else is refused
+	for _, key := range []string{"", "guess"} {
+		config := DefaultConfig()
+		config.PreSharedKey = []byte(key)
+		_, err := config.Dial(context.Background(), "udp", clientAddr, l.Addr(), true)
+		var rej *RejectError
+		if !errors.As(err, &rej) || rej.Reason != RejectAuth {
+			t.Errorf("expected dialing with key %q to be refused for failing to authenticate, got %v", key, err)
+		}
+	}
+
+	// and a listener that can't prove it holds the key isn't trusted
+	open, err := DefaultConfig().Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+90))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer open.Close()
+	_, err = config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+90),
+		open.Addr(), true)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected a listener without the key to fail authentication, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// saturate writes data to from as fast as it can while reading it back from to, counting what it has read in progress
+func saturate(from, to net.Conn, data []byte, progress *int64, done chan<- error) {
+	go from.Write(data)
+	got := make([]byte, len(data))
+	var err error
+	for off := 0; off < len(got) && err == nil; {
+		var n int
+		n, err = to.Read(got[off:])
+		off += n
+		atomic.StoreInt64(progress, int64(off))
+	}
+	if err == nil && !bytes.Equal(got, data) {
+		err = io.ErrUnexpectedEOF
+	}
+	done <- err
+}
+
+func TestBidirectionalSaturation(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024*1024)
+	var progress [2]int64
+	done := make(chan error, 2)
+	go saturate(a, b, data, &progress[0], done)
+	go saturate(b, a, data, &progress[1], done)
+
+	// whichever direction finishes first, the other one mustn't have been starved of its share while it did
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("error transferring: %s", err.Error())
+		}
+	case <-time.After(60 * time.Second):
+		t.Fatal("timed out saturating the connection")
+	}
+	slowest := atomic.LoadInt64(&progress[0])
+	if other := atomic.LoadInt64(&progress[1]); other < slowest {
+		slowest = other
+	}
+	if slowest < int64(len(data)/4) {
+		t.Errorf("one direction was starved: it had received only %d of %d bytes when the other finished", slowest, len(data))
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("error transferring: %s", err.Error())
+		}
+	case <-time.After(60 * time.Second):
+		t.Fatal("timed out saturating the connection")
+	}
+}
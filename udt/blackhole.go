@@ -0,0 +1,90 @@
+package udt
+
+import (
+	"log"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Many networks (often tunnels or PPPoE links whose routers don't send ICMP "fragmentation needed" messages) silently
+drop packets larger than some size smaller than the one negotiated, so the kernel never refuses them (see mtu.go) and
+they simply vanish, while our peer's control packets and any smaller data packets get through.
+
+The sender watches for this: once a packet within one step of our packet size has been retransmitted
+blackholeRexmits times without any packet of that size being acknowledged since it was first retransmitted, the path
+is taken to be a blackhole for packets that large.  The packet size is then stepped down through blackholeSteps
+(1500, 1400 and finally 1280, which every IPv6 path must carry), the event logged, and Config.OnMTUChange called.  As
+after a refused packet, data not yet split into packets is split at the new size, while packets already sent at the
+old size are retransmitted permitting fragmentation.  Ordinary congestion loss doesn't trigger this, as other packets
+of the same size keep being acknowledged around the ones that are lost.
+*/
+
+// blackholeSteps are the packet sizes we step down through when large packets are being silently dropped
+var blackholeSteps = []uint{1500, 1400, 1280}
+
+// blackholeRexmits is how many times a large packet must be retransmitted without any packet of its size being
+// acknowledged before we decide the path is dropping them
+const blackholeRexmits = 3
+
+// blackholeMTU returns the packet size to step down to when packets of mtu bytes are being silently dropped, or zero
+// if we've gone as low as we will
+func blackholeMTU(mtu uint) uint {
+	for _, step := range blackholeSteps {
+		if step < mtu {
+			return step
+		}
+	}
+	return 0
+}
+
+// packetSize returns the size of a data packet we've sent, including the IP and UDP headers
+func (s *udtSocketSend) packetSize(p *packet.DataPacket) uint {
+	if s.socket.raddr.IP.To4() != nil {
+		return uint(len(p.Data) + udtHeaderSize + udp4HeaderSize)
+	}
+	return uint(len(p.Data) + udtHeaderSize + udp6HeaderSize)
+}
+
+// isLarge returns true if a data packet is too large to be sent after stepping down from our current packet size, and
+// so would be lost if the path is a blackhole for packets of our size
+func (s *udtSocketSend) isLarge(p *packet.DataPacket) bool {
+	mtu := uint(s.socket.mtu.get())
+	next := blackholeMTU(mtu)
+	if next == 0 {
+		return false
+	}
+	size := s.packetSize(p)
+	return size > next && size <= mtu
+}
+
+// noteLargeAcked is called when a data packet is acknowledged, noting whether one too large to survive a blackhole
+// got through
+func (s *udtSocketSend) noteLargeAcked(p *packet.DataPacket) {
+	if s.isLarge(p) {
+		s.largeAcked++
+	}
+}
+
+// checkBlackhole is called each time a packet is retransmitted, stepping our packet size down if large packets are
+// no longer getting through
+func (s *udtSocketSend) checkBlackhole(dp *sendPacketEntry) {
+	if !s.isLarge(dp.pkt) {
+		return
+	}
+	if dp.rexmits == 1 {
+		dp.largeAcked = s.largeAcked
+		return
+	}
+	if dp.rexmits < blackholeRexmits || dp.largeAcked != s.largeAcked {
+		return
+	}
+	mtu := s.socket.mtu.get()
+	next := blackholeMTU(uint(mtu))
+	if !s.socket.mtu.compareAndSwap(mtu, uint32(next)) {
+		return
+	}
+	log.Printf("%s lowering packet size to %d, as %d byte packets to %s aren't getting through", s.socket.String(),
+		next, s.packetSize(dp.pkt), s.socket.raddr.String())
+	s.socket.mtuLowered()
+}
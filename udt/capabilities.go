@@ -0,0 +1,161 @@
+package udt
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+The optional features of the protocol are each advertised with a handshake extension, and are only used once both
+ends have advertised them.  Each connection records which of them its peer advertised and which are in use, returned
+by Conn.Capabilities and listed with Listener.Connections and Inspect, to tell why a feature isn't having the effect
+one might expect.
+
+A connection configured with FEC (Config.FECBlockSize) or compression (Config.Compression) whose peer doesn't support it
+is refused rather than silently carrying on without, as it would be surprising to find (say) a connection that was meant
+to be resilient to loss retransmitting everything instead.  A listener refuses such a connection with RejectUnsupported,
+and a dialer with a CapabilityError (closing the listener's end with CloseUnsupported).  Config.AllowDegraded has the
+connection carry on without them instead.  Authentication (Config.PreSharedKey) is never optional once configured, and a
+listener that doesn't resume sessions or accept early data already has the dialer fall back to a full handshake, so
+neither is affected.
+*/
+
+// Capability is a set of optional protocol features, as advertised by a peer or in use on a connection
+type Capability uint32
+
+const (
+	// CapFEC is forward error correction (see Config.FECBlockSize)
+	CapFEC Capability = 1 << iota
+	// CapCompression is data packet payload compression (see Config.Compression).  A peer advertising compression
+	// with algorithms other than ours doesn't support it as far as we're concerned
+	CapCompression
+	// CapAuth is proving both ends hold the same Config.PreSharedKey
+	CapAuth
+	// CapResume is resuming connections with a token the listener issued (see Conn.Session)
+	CapResume
+	// CapEarlyData is carrying the first data of a resumed connection in its handshake (see Config.ResumeWithData)
+	CapEarlyData
+)
+
+var capabilityNames = []string{"fec", "compression", "auth", "resume", "early-data"}
+
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+	var names []string
+	for idx, name := range capabilityNames {
+		if c&(1<<uint(idx)) != 0 {
+			names = append(names, name)
+			c &^= 1 << uint(idx)
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(c)))
+	}
+	return strings.Join(names, "|")
+}
+
+// MarshalText returns the names of these capabilities
+func (c Capability) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// CapabilityError is returned when dialing a peer that doesn't support an optional feature our Config asks for (unless
+// Config.AllowDegraded is set)
+type CapabilityError struct {
+	Missing Capability // the features we asked for that the peer doesn't support
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("Peer doesn't support %s", e.Missing.String())
+}
+
+// peerCapabilities returns the optional features a peer advertised in its handshake, as far as we understand them
+func peerCapabilities(config *Config, p *packet.HandshakePacket) Capability {
+	var caps Capability
+	if _, ok := p.Extension(packet.HsExtFEC); ok {
+		caps |= CapFEC
+	}
+	if negotiateCompression(&Config{Compression: config.Compression}, p) != CompressionNone {
+		caps |= CapCompression
+	}
+	if _, ok := p.Extension(packet.HsExtAuth); ok {
+		caps |= CapAuth
+	}
+	if _, ok := p.Extension(packet.HsExtResume); ok {
+		caps |= CapResume
+	}
+	if _, ok := p.Extension(packet.HsExtEarlyData); ok {
+		caps |= CapEarlyData
+	}
+	return caps
+}
+
+// requiredCapabilities returns the optional features a connection with this configuration mustn't do without
+func requiredCapabilities(config *Config) Capability {
+	if config.AllowDegraded {
+		return 0
+	}
+	var caps Capability
+	if config.FECBlockSize > 0 {
+		caps |= CapFEC
+	}
+	if config.Compression != CompressionNone {
+		caps |= CapCompression
+	}
+	return caps
+}
+
+// missingCapabilities returns the optional features we require that a peer didn't advertise in its handshake
+func missingCapabilities(config *Config, p *packet.HandshakePacket) Capability {
+	return requiredCapabilities(config) &^ peerCapabilities(config, p)
+}
+
+// noteCapabilities records which optional features our peer advertised in its handshake and which are in use, once
+// its handshake has been accepted
+func (s *udtSocket) noteCapabilities(p *packet.HandshakePacket) {
+	peer := peerCapabilities(s.Config, p)
+	var active Capability
+	if s.Config.FECBlockSize > 0 {
+		active |= peer & CapFEC
+	}
+	if s.Config.Compression != CompressionNone {
+		active |= peer & CapCompression
+	}
+	if len(s.Config.PreSharedKey) > 0 {
+		active |= peer & CapAuth
+	}
+	if s.resumeToken != nil {
+		active |= CapResume // the listener issued a token for this connection (or, if we're the listener, we did)
+	}
+	if s.earlyAccepted {
+		active |= CapEarlyData
+	}
+	s.peerCaps.set(uint32(peer))
+	s.caps.set(uint32(active))
+}
+
+// Capabilities returns the optional features in use on this connection, and those its peer advertised (which are
+// zero until it's connected)
+func (s *udtSocket) Capabilities() (active Capability, peer Capability) {
+	return Capability(s.caps.get()), Capability(s.peerCaps.get())
+}
+
+// refuseDegraded closes a connection we're dialing, telling the listener why, if it doesn't support an optional
+// feature we require.  Returns true if it did
+func (s *udtSocket) refuseDegraded(p *packet.HandshakePacket) bool {
+	missing := missingCapabilities(s.Config, p)
+	if missing == 0 {
+		return false
+	}
+	err := &CapabilityError{Missing: missing}
+	log.Printf("%s (id=%d) refusing %s, %s", s.m.laddr.String(), s.sockID, s.raddr.String(), err.Error())
+	s.m.sendPacket(s, s.raddr, p.SockID, s.timestamp(), &packet.ShutdownPacket{Code: uint32(CloseUnsupported),
+		Reason: "unsupported " + missing.String()})
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateRefused, permitLinger: false, err: err})
+	return true
+}
@@ -0,0 +1,116 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestCapabilityString(t *testing.T) {
+	tests := []struct {
+		caps   Capability
+		expect string
+	}{
+		{0, "none"},
+		{CapFEC, "fec"},
+		{CapCompression | CapResume, "compression|resume"},
+		{CapEarlyData | 1<<10, "early-data|0x400"},
+	}
+	for _, test := range tests {
+		if str := test.caps.String(); str != test.expect {
+			t.Errorf("expected %q, got %q", test.expect, str)
+		}
+	}
+}
+
+func TestDegradedRefused(t *testing.T) {
+	servConfig := DefaultConfig()
+	servConfig.Compression = CompressionDeflate
+	l, err := servConfig.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+117))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	clientAddr := fmt.Sprintf("127.0.0.1:%d", clientPort+117)
+
+	// a dialer supporting what the listener requires is told what's in use
+	config := DefaultConfig()
+	config.Compression = CompressionDeflate
+	client, err := config.Dial(context.Background(), "udp", clientAddr, l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	if active, peer := client.(Conn).Capabilities(); active != CapCompression || peer != CapCompression {
+		t.Errorf("expected compression to be in use, got %s (peer advertised %s)", active, peer)
+	}
+	conns := l.(*listener).Connections()
+	if len(conns) != 1 || conns[0].Capabilities != CapCompression {
+		t.Errorf("expected the listener to list its connection using compression, got %+v", conns)
+	}
+	client.Close()
+	server.Close()
+
+	// a listener refuses a dialer that doesn't support it
+	_, err = DefaultConfig().Dial(context.Background(), "udp", clientAddr, l.Addr(), true)
+	var rej *RejectError
+	if !errors.As(err, &rej) || rej.Reason != RejectUnsupported {
+		t.Errorf("expected dialing without compression to be refused, got %v", err)
+	}
+
+	// and a dialer refuses a listener that doesn't support it
+	plain, err := DefaultConfig().Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+119))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer plain.Close()
+	config = DefaultConfig()
+	config.FECBlockSize = 8
+	_, err = config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+119),
+		plain.Addr(), true)
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) || capErr.Missing != CapFEC {
+		t.Errorf("expected dialing a listener without FEC to fail, got %v", err)
+	}
+}
+
+func TestDegradedAllowed(t *testing.T) {
+	config := DefaultConfig()
+	config.FECBlockSize = 8
+	config.AllowDegraded = true
+	l, err := DefaultConfig().Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+121))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	client, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+121),
+		l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+	if active, peer := client.(Conn).Capabilities(); active != 0 || peer != 0 {
+		t.Errorf("expected nothing to be in use, got %s (peer advertised %s)", active, peer)
+	}
+}
@@ -0,0 +1,85 @@
+package udt
+
+import (
+	"time"
+)
+
+// Clock is the source of time for UDT sockets, including all of their timers.  Config.Clock can supply an alternate
+// implementation, to control how time passes in tests.  The times returned by Now must carry a monotonic clock
+// reading (as those from time.Now do), so that intervals measured between them are unaffected by changes to the wall
+// clock
+type Clock interface {
+	Now() time.Time                            // returns the current time
+	After(d time.Duration) <-chan time.Time    // sends the current time on the returned channel after d
+	AfterFunc(d time.Duration, f func()) Timer // calls f in its own goroutine after d
+	NewTimer(d time.Duration) Timer            // sends the current time on the Timer's channel after d
+	NewTicker(d time.Duration) Ticker          // sends the current time on the Ticker's channel every d
+}
+
+// Timer is a single event created by a Clock (see time.Timer)
+type Timer interface {
+	C() <-chan time.Time        // channel the time is sent on when the timer fires (nil for timers from AfterFunc)
+	Stop() bool                 // prevents the timer from firing, returning false if it already has
+	Reset(d time.Duration) bool // changes the timer to fire after d, returning false if it had already fired
+}
+
+// Ticker is a recurring event created by a Clock (see time.Ticker)
+type Ticker interface {
+	C() <-chan time.Time // channel the time is sent on with each tick
+	Stop()               // stops any further ticks
+}
+
+// systemClock is the Clock backed by the system's own clocks
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// defaultClock is the Clock used when the Config doesn't specify one
+var defaultClock Clock = systemClock{}
+
+// configClock returns the Clock to use for sockets with the specified Config
+func configClock(config *Config) Clock {
+	if config != nil && config.Clock != nil {
+		return config.Clock
+	}
+	return defaultClock
+}
+
+// elapsed returns the time since this socket was created
+func (s *udtSocket) elapsed() time.Duration {
+	return s.clock.Now().Sub(s.created)
+}
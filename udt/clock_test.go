@@ -0,0 +1,220 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock that only moves forward when advance is called
+type manualClock struct {
+	prot   sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock  *manualClock
+	when   time.Time
+	period time.Duration // if set, this is a ticker
+	c      chan time.Time
+	f      func()
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Now()}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.schedule(&manualTimer{clock: c, f: f}, d)
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	return c.schedule(&manualTimer{clock: c, c: make(chan time.Time, 1)}, d)
+}
+
+func (c *manualClock) NewTicker(d time.Duration) Ticker {
+	return manualTicker{c.schedule(&manualTimer{clock: c, c: make(chan time.Time, 1), period: d}, d)}
+}
+
+func (c *manualClock) schedule(t *manualTimer, d time.Duration) *manualTimer {
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// unschedule removes a timer, returning whether it was waiting to fire.  c.prot must be held
+func (c *manualClock) unschedule(t *manualTimer) bool {
+	for idx, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:idx], c.timers[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves the clock forward, firing any timers that come due (in order)
+func (c *manualClock) advance(d time.Duration) {
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.now = t.when
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+		if t.f != nil {
+			go t.f()
+		} else {
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+	c.now = end
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.prot.Lock()
+	defer t.clock.prot.Unlock()
+	return t.clock.unschedule(t)
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.prot.Lock()
+	wasActive := t.clock.unschedule(t)
+	t.clock.prot.Unlock()
+	t.clock.schedule(t, d)
+	return wasActive
+}
+
+type manualTicker struct {
+	*manualTimer
+}
+
+func (t manualTicker) Stop() {
+	t.manualTimer.Stop()
+}
+
+// connectWithClock connects a client using the specified clock to a listener using the system clock
+func connectWithClock(t *testing.T, port uint16, clock Clock, config *Config) (serv *listener, client, server *udtSocket) {
+	config.Clock = clock
+	l, err := DefaultConfig().Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+port))
+	if err != nil {
+		t.Fatalf("error calling Listen: %s", err.Error())
+	}
+	serv = l.(*listener)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		newSock, err := serv.Accept()
+		if err != nil {
+			t.Errorf("error calling Accept: %s", err.Error())
+		}
+		accepted <- newSock
+	}()
+	conn, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+port), serv.Addr(), true)
+	if err != nil {
+		serv.Close()
+		t.Fatalf("error calling Dial: %s", err.Error())
+	}
+	newSock := <-accepted
+	if newSock == nil {
+		serv.Close()
+		t.FailNow()
+	}
+	return serv, conn.(*udtSocket), newSock.(*udtSocket)
+}
+
+func TestClockLinger(t *testing.T) {
+	clock := newManualClock()
+	config := DefaultConfig()
+	config.LingerTime = 10 * time.Second
+	serv, client, server := connectWithClock(t, 14, clock, config)
+	defer serv.Close()
+	defer server.Close()
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("error calling Close: %s", err.Error())
+	}
+
+	// the socket hangs around to answer any retransmission requests until the linger time has passed
+	clock.advance(9 * time.Second)
+	select {
+	case <-client.sockClosed:
+		t.Fatal("socket closed before its linger time passed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.advance(time.Second)
+	select {
+	case <-client.sockClosed:
+	case <-time.After(time.Second):
+		t.Fatal("socket didn't close once its linger time passed")
+	}
+}
+
+func TestClockEXPTimeout(t *testing.T) {
+	clock := newManualClock()
+	config := DefaultConfig()
+	config.EXPTimeout = 20 * time.Second
+	serv, client, server := connectWithClock(t, 16, clock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 1024))
+		readErr <- err
+	}()
+
+	// our peer vanishes without a word
+	serv.m.conn.Close()
+
+	start := clock.Now()
+	for i := 0; i < 300; i++ {
+		clock.advance(time.Second)
+		select {
+		case err := <-readErr:
+			if err == nil {
+				t.Fatal("expected Read to fail once the peer was lost")
+			}
+			if waited := clock.Now().Sub(start); waited < config.EXPTimeout {
+				t.Errorf("connection was dropped after %v, before the EXP timeout of %v", waited, config.EXPTimeout)
+			}
+			return
+		case <-time.After(2 * time.Millisecond):
+		}
+	}
+	t.Fatal("connection never timed out")
+}
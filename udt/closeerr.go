@@ -0,0 +1,115 @@
+package udt
+
+import (
+	"fmt"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// CloseCode identifies why a connection was closed with CloseWithError.  It is carried to the peer in the shutdown
+// packet
+type CloseCode uint32
+
+const (
+	// CloseNormal is reported when the connection was closed without giving a reason
+	CloseNormal CloseCode = 0
+	// CloseGoingAway means the peer is going away, such as a server shutting down
+	CloseGoingAway CloseCode = 1
+	// CloseProtocolError means the peer closed the connection after receiving something it didn't understand
+	CloseProtocolError CloseCode = 2
+	// CloseIdleTimeout means the peer closed the connection for being idle longer than its Config.IdleTimeout
+	CloseIdleTimeout CloseCode = 3
+	// CloseQuotaExceeded means the peer closed the connection for exceeding its Config.MaxBytesPerConn or
+	// Config.MaxDurationPerConn
+	CloseQuotaExceeded CloseCode = 4
+	// CloseStuck means the peer gave up on a packet it had retransmitted Config.StuckRexmitLimit times
+	CloseStuck CloseCode = 5
+	// CloseKicked means the peer's operator forcibly closed the connection (see Listener.Kick)
+	CloseKicked CloseCode = 6
+	// CloseUnsupported means the peer closed the connection as soon as it was established, as we don't support an
+	// optional feature it requires (see Config.AllowDegraded)
+	CloseUnsupported CloseCode = 7
+	// CloseInternalError means the peer closed the connection after it stopped working inside the peer (such as when
+	// stopped by its Config.WatchdogTimeout)
+	CloseInternalError CloseCode = 8
+	// CloseUser is the first of the codes reserved for applications to define
+	CloseUser CloseCode = 1000
+)
+
+// maxCloseMessage is the longest description we'll send along with a shutdown
+const maxCloseMessage = 256
+
+func (c CloseCode) String() string {
+	switch c {
+	case CloseNormal:
+		return "normal"
+	case CloseGoingAway:
+		return "going away"
+	case CloseProtocolError:
+		return "protocol error"
+	case CloseIdleTimeout:
+		return "idle timeout"
+	case CloseQuotaExceeded:
+		return "quota exceeded"
+	case CloseStuck:
+		return "transfer stuck"
+	case CloseKicked:
+		return "kicked"
+	case CloseUnsupported:
+		return "unsupported feature"
+	case CloseInternalError:
+		return "internal error"
+	}
+	if c >= CloseUser {
+		return fmt.Sprintf("user(%d)", uint32(c-CloseUser))
+	}
+	return fmt.Sprintf("code(%d)", uint32(c))
+}
+
+// CloseError describes a connection closed with CloseWithError, and is returned from any further Read or Write on
+// the connection (on both sides)
+type CloseError struct {
+	Code    CloseCode // why the connection was closed
+	Message string    // optional description of why the connection was closed
+	Remote  bool      // set if it was our peer that closed the connection
+}
+
+func (e *CloseError) Error() string {
+	by := "locally"
+	if e.Remote {
+		by = "by peer"
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("Connection closed %s (%s): %s", by, e.Code.String(), e.Message)
+	}
+	return fmt.Sprintf("Connection closed %s (%s)", by, e.Code.String())
+}
+
+// readCloseReason decodes the reason our peer gave for closing the connection, or nil if it didn't give one
+func readCloseReason(p *packet.ShutdownPacket) error {
+	if p.Code == 0 && p.Reason == "" {
+		return nil
+	}
+	return &CloseError{Code: CloseCode(p.Code), Message: p.Reason, Remote: true}
+}
+
+// CloseWithError closes the connection immediately, passing the specified code and description to our peer.  Unlike
+// Close, anything not yet delivered is abandoned
+func (s *udtSocket) CloseWithError(code CloseCode, message string) error {
+	if !s.isOpen() {
+		return nil // already closed
+	}
+	if len(message) > maxCloseMessage {
+		message = message[:maxCloseMessage]
+	}
+
+	closeErr := &CloseError{Code: code, Message: message}
+	select {
+	case s.sendPacket <- &packet.ShutdownPacket{Code: uint32(code), Reason: message}:
+	case _, _ = <-s.sockClosed:
+		return nil
+	}
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: closeErr})
+	<-s.sockClosed
+	return nil
+}
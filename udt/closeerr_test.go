@@ -0,0 +1,39 @@
+package udt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseWithError(t *testing.T) {
+	serv, client, server := connectWithClock(t, 46, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer server.Close()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 100))
+		readErr <- err
+	}()
+
+	if err := client.CloseWithError(CloseGoingAway, "maintenance"); err != nil {
+		t.Fatalf("error calling CloseWithError: %s", err.Error())
+	}
+	var closeErr *CloseError
+	if _, err := client.Write([]byte("hello")); !errors.As(err, &closeErr) || closeErr.Remote {
+		t.Errorf("expected Write to report the local close, got %v", err)
+	}
+
+	select {
+	case err := <-readErr:
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("expected a CloseError from Read, got %v", err)
+		}
+		if !closeErr.Remote || closeErr.Code != CloseGoingAway || closeErr.Message != "maintenance" {
+			t.Errorf("unexpected close reason: %s", closeErr.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer never noticed the connection closing")
+	}
+}
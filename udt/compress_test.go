@@ -0,0 +1,83 @@
+package udt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPayloadCompression(t *testing.T) {
+	for _, algo := range []CompressionType{CompressionDeflate, CompressionLZ4} {
+		c := newPayloadCompressor(algo)
+		d := newPayloadDecompressor(algo)
+
+		cases := [][]byte{
+			bytes.Repeat([]byte("compressible text "), 50),
+			bytes.Repeat([]byte{0x55}, 1000), // a match overlapping what it copies
+			{0x9e, 0x13, 0x77, 0x01},         // too short to benefit from compression
+			{},
+		}
+		for _, data := range cases {
+			payload := c.compress(data)
+			if len(payload) > len(data)+1 {
+				t.Errorf("algo %d: payload of %d bytes grew to %d", algo, len(data), len(payload))
+			}
+			result, err := d.decompress(payload, 1500)
+			if err != nil {
+				t.Errorf("algo %d: unable to decompress payload of %d bytes: %s", algo, len(data), err.Error())
+				continue
+			}
+			if !bytes.Equal(result, data) {
+				t.Errorf("algo %d: decompressed payload does not match original of %d bytes", algo, len(data))
+			}
+		}
+
+		if _, err := d.decompress(c.compress(make([]byte, 4000)), 1500); err == nil {
+			t.Errorf("algo %d: decompressed a payload beyond the maximum size", algo)
+		}
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	d := newPayloadDecompressor(CompressionLZ4)
+	cases := [][]byte{
+		{payloadCompressed, 0x50, 'a', 'b'},                    // literals cut short
+		{payloadCompressed, 0x11, 'a', 0x01},                   // offset cut short
+		{payloadCompressed, 0x10, 'a', 0x02, 0x00, 0x00},       // offset before the start
+		{payloadCompressed, 0x10, 'a', 0x00, 0x00, 0x00},       // zero offset
+		{payloadCompressed, 0xF0, 0xFF, 0xFF, 0xFF, 0xFF, 'a'}, // literal length never ends
+	}
+	for i, payload := range cases {
+		if _, err := d.decompress(payload, 1500); err == nil {
+			t.Errorf("case %d: decompressed a corrupt payload", i)
+		}
+	}
+}
+
+func benchmarkCompression(b *testing.B, algo CompressionType) {
+	data, err := ioutil.ReadFile("compress.go") // a packet's worth of source code as a sample of text
+	if err != nil {
+		b.Fatal(err)
+	}
+	data = data[:1400]
+	c := newPayloadCompressor(algo)
+	d := newPayloadDecompressor(algo)
+	payload := c.compress(data)
+	b.Run("compress", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			c.compress(data)
+		}
+	})
+	b.Run("decompress", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := d.decompress(payload, len(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCompressionDeflate(b *testing.B) { benchmarkCompression(b, CompressionDeflate) }
+func BenchmarkCompressionLZ4(b *testing.B)     { benchmarkCompression(b, CompressionLZ4) }
@@ -10,16 +10,75 @@ import (
 
 // Config controls behavior of sockets created with it
 type Config struct {
-	CanAcceptDgram     bool          // can this listener accept datagrams?
-	CanAcceptStream    bool          // can this listener accept streams?
-	ListenReplayWindow time.Duration // length of time to wait for repeated incoming connections
-	MaxPacketSize      uint          // Upper limit on maximum packet size (0 = unlimited)
-	MaxBandwidth       uint64        // Maximum bandwidth to take with this connection (in bytes/sec, 0 = unlimited)
-	LingerTime         time.Duration // time to wait for retransmit requests after connection shutdown
-	MaxFlowWinSize     uint          // maximum number of unacknowledged packets to permit (minimum 32)
+	CanAcceptDgram       bool               // can this listener accept datagrams?
+	CanAcceptStream      bool               // can this listener accept streams?
+	ListenReplayWindow   time.Duration      // length of time to wait for repeated incoming connections
+	MaxPacketSize        uint               // Upper limit on maximum packet size, including the IP and UDP headers (0 = unlimited, otherwise at least 576), see mtu.go
+	MaxBandwidth         uint64             // Maximum bandwidth to take with this connection, including retransmissions and control packets (in bytes/sec, 0 = unlimited)
+	LingerTime           time.Duration      // time to wait for retransmit requests after connection shutdown
+	MaxFlowWinSize       uint               // maximum number of unacknowledged packets to permit (minimum 32)
+	FlowWindowAutoTune   bool               // start with a small flow window and grow it to suit the delivery rate and roundtrip time, up to MaxFlowWinSize, see flowwindow.go
+	ACKPeriod            time.Duration      // maximum time between periodic ACKs (0 = SYN, 10ms).  Congestion control may request them more often
+	NAKPeriod            time.Duration      // time between repeated loss reports (0 = calculated from the roundtrip time, 4 * RTT + RTTVar + SYN)
+	MinEXPPeriod         time.Duration      // minimum time to wait without hearing from the peer before retransmitting (doubles with each consecutive timeout)
+	MaxEXPPeriod         time.Duration      // upper limit on the EXP timer backoff
+	EXPCountLimit        uint               // number of consecutive EXP timeouts before the peer may be considered lost
+	EXPTimeout           time.Duration      // minimum time without hearing from the peer before it may be considered lost
+	IdleTimeout          time.Duration      // close the connection if no data is sent or received for this long (0 = never)
+	MaxMessageSize       uint               // largest datagram message that may be sent or reassembled, in bytes (0 = unlimited)
+	ReassemblyTimeout    time.Duration      // partially-received datagram messages are dropped if not completed within this time
+	MaxRexmitAttempts    uint               // datagram packets are retransmitted at most this many times before their message is dropped (0 = unlimited)
+	FECBlockSize         uint               // (experimental) number of data packets protected by each FEC parity packet (0 = disabled, both peers must enable)
+	Compression          CompressionType    // compress data packet payloads with this algorithm (both peers must enable), LZ4 is cheap enough for bulk transfers while DEFLATE costs ~7x the CPU per packet
+	AllowDegraded        bool               // carry on without FEC or compression if the peer doesn't support them, rather than refusing the connection, see Conn.Capabilities
+	MultipathScheduler   MultipathScheduler // (experimental) how packets are spread across the paths of a multipath connection
+	MultipathProbePeriod time.Duration      // (experimental) time between roundtrip time probes on each path of a multipath connection
+	AcceptPending        bool               // hold incoming connections for Listener.AcceptContext to inspect before completing their handshake
+	ServiceName          string             // the service a listener accepts connections for, or a dialer connects to, when several listeners share a local address (default "")
+	ACKHistorySize       uint               // number of sent ACKs remembered while waiting for their ACK2 (0 = 1024)
+	ArrivalWindowSize    uint               // number of packet arrival intervals used to estimate the receive rate (0 = 16)
+	PacketPairWindowSize uint               // number of probe pair intervals used to estimate the link capacity (0 = 16)
+	Clock                Clock              // source of time for sockets and their timers (nil = the system clock)
+	NewSocketID          func() uint32      // returns a candidate ID for each new socket (nil = counting down from a random start), asked again if it's zero or already in use
+	NewInitialSeq        func() uint32      // returns the initial packet sequence number for each new socket, of which the low 31 bits are used (nil = crypto/rand)
+	StrictDecoding       bool               // reject packets with unexpected trailing data (applies to everything sharing the local address)
+	Priority             int                // packets from sockets with a higher priority are sent first when sharing a local address with others (default 0)
+	LocalMaxBandwidth    uint64             // maximum bandwidth to take with everything sharing the local address (in bytes/sec, 0 = unlimited)
+	MemoryLimit          uint64             // most memory the send, reorder and loss buffers of everything sharing the local address may take together, shared equally between connections (in bytes, 0 = unlimited)
+	KernelTimestamps     bool               // (Linux only) time packet arrivals with kernel receive timestamps (applies to everything sharing the local address)
+	DSCP                 uint8              // DiffServ code point to mark packets with for QoS, such as 34 for AF41 (0 = unmarked, applies to everything sharing the local address)
+	ECN                  bool               // (Linux only) mark packets as ECN-capable and slow down when the network marks them as congested (applies to everything sharing the local address, both peers must enable)
+	GSO                  bool               // (Linux only) hand the kernel batches of packets to the same peer as single super-packets, and accept packets it has coalesced, cutting per-packet overhead of bulk transfers (applies to everything sharing the local address)
+	ReusePortSockets     uint               // (Linux only) number of UDP sockets to open on the local address with SO_REUSEPORT, each read by its own goroutine, to spread receiving across cores (0 or 1 = a single socket, applies when the local address is first used)
+	PacketIO             PacketIO           // (experimental) packet I/O backend that opens the connections packets are sent and received on (nil = UDP sockets, applies when the local address is first used)
+	EventLoop            bool               // run the receive side of idle sockets without a goroutine of their own, with their timers on a wheel shared by the local address
+	PreSharedKey         []byte             // if set, both ends must prove they hold this same key before a connection is established (not supported for rendezvous)
+	MaxBytesPerConn      uint64             // close a connection once it has sent and received this many payload bytes in total (0 = unlimited)
+	MaxDurationPerConn   time.Duration      // close a connection once it has been open this long (0 = unlimited)
+	StuckRexmitLimit     uint               // consider a transfer stuck once a packet has been retransmitted this many times without being acknowledged, see OnStuck (0 = never)
+	LockThreads          bool               // (best-effort) lock the read and write goroutines of the local address each to an OS thread of its own, see "Threading model" in threads.go (applies to everything sharing the local address)
+	ThreadCPUs           []int              // (Linux only, best-effort) with LockThreads, pin those threads to these CPUs, taking them in turn (applies to everything sharing the local address)
+	CCInitialWindow      uint               // (native congestion control) congestion window a connection starts with, in packets (0 = 16)
+	CCSlowStartCap       uint               // (native congestion control) leave slow start once the congestion window grows past this many packets (0 = the maximum flow window)
+	CCIncreaseFactor     float64            // (native congestion control) scales how quickly the sending rate climbs towards the link capacity, Beta in the UDT spec (0 = 0.0000015)
+	CCDecreaseFactor     float64            // (native congestion control) the packet interval is multiplied by this when the sending rate is lowered for loss, more than 1 (0 = 1.125)
+	CCDecreaseRange      uint               // (native congestion control) most loss reports to let pass between rate decreases in a congestion period, otherwise chosen at random up to the average per period (0 = no limit)
+	ResumptionLifetime   time.Duration      // listeners issue tokens letting clients resume a connection with Config.Resume within this long, skipping the syn cookie exchange (0 = disabled), see Conn.Session
+	Tracer               PacketTracer       // passed every packet sent or received on the local address, for tracing connections at the wire level (nil = none), see TextTracer and PcapTracer
+	CorkInterval         time.Duration      // stream connections hold a partly filled packet back for up to this long, for later writes to fill it (0 = send immediately), see Conn.SetNoDelay
+	WatchdogTimeout      time.Duration      // close a connection whose sending or receiving side handles none of the packets waiting for it for this long (0 = never), see watchdog.go
+	SendStallRTTs        uint               // sending is stalled once data has waited this many roundtrip times without anything being acknowledged, see OnSendStall (0 = 4)
 
 	CanAccept           func(hsPacket *packet.HandshakePacket, from *net.UDPAddr) error // can this listener accept this connection?
-	CongestionForSocket func(sock *udtSocket) CongestionControl                         // create or otherwise return the CongestionControl for this socket
+	CongestionForSocket func(ctx CongestionContext) CongestionControl                   // create or otherwise return the CongestionControl for a socket with the specified measurements
+	OnControl           func(conn Conn, msgType uint16, data []byte)                    // called with each message the peer sends with SendControl (from the congestion control goroutine, so it should return promptly)
+	OnRTTUpdate         func(conn Conn, rtt, rttVar time.Duration)                      // called whenever the roundtrip time estimate is updated
+	OnLoss              func(conn Conn, lost uint)                                      // called whenever the peer reports packets we've sent as lost
+	OnRateChange        func(conn Conn, sendPeriod time.Duration, congWindow uint)      // called whenever congestion control changes how fast we send
+	OnMTUChange         func(conn Conn, mtu uint)                                       // called whenever the packet size is lowered after the path refuses (or silently drops) packets as large as negotiated
+	OnAudit             func(event AuditEvent)                                          // called whenever a listener accepts or refuses a connection, and whenever an established connection closes
+	OnStuck             func(conn Conn, err *StuckError)                                // called when a transfer is stuck (see StuckRexmitLimit), instead of closing the connection with err (on a goroutine of its own, so it may close the connection)
+	OnSendStall         func(conn Conn, stalled bool)                                   // called when sending stalls (see SendStallRTTs), and again when the peer next acknowledges something (from the sending goroutine, so it should return promptly)
 }
 
 // Listen listens for incoming UDT connections addressed to the local address laddr.
@@ -29,24 +88,35 @@ func (c *Config) Listen(ctx context.Context, network string, addr string) (net.L
 }
 
 // Dial establishes an outbound UDT connection using the supplied net, laddr and raddr.  See function net.DialUDP for a description of net, laddr and raddr.
-func (c *Config) Dial(ctx context.Context, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func (c *Config) Dial(ctx context.Context, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return dialUDT(ctx, c, network, laddr, raddr, isStream)
 }
 
 // Rendezvous establishes an outbound UDT connection using the supplied net, laddr and raddr.  See function net.DialUDP for a description of net, laddr and raddr.
-func (c *Config) Rendezvous(ctx context.Context, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func (c *Config) Rendezvous(ctx context.Context, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return rendezvousUDT(ctx, c, network, laddr, raddr, isStream)
 }
 
 // DefaultConfig constructs a Config with default values
 func DefaultConfig() *Config {
 	return &Config{
-		CanAcceptDgram:     true,
-		CanAcceptStream:    true,
-		ListenReplayWindow: 5 * time.Minute,
-		LingerTime:         180 * time.Second,
-		MaxFlowWinSize:     64,
-		CongestionForSocket: func(sock *udtSocket) CongestionControl {
+		CanAcceptDgram:       true,
+		CanAcceptStream:      true,
+		ListenReplayWindow:   5 * time.Minute,
+		LingerTime:           180 * time.Second,
+		MaxFlowWinSize:       64,
+		ACKPeriod:            synTime,
+		MinEXPPeriod:         300 * time.Millisecond,
+		MaxEXPPeriod:         10 * time.Second,
+		EXPCountLimit:        16,
+		EXPTimeout:           3 * time.Minute,
+		MaxMessageSize:       64 << 20,
+		ReassemblyTimeout:    30 * time.Second,
+		MultipathProbePeriod: time.Second,
+		ACKHistorySize:       1024,
+		ArrivalWindowSize:    16,
+		PacketPairWindowSize: 16,
+		CongestionForSocket: func(ctx CongestionContext) CongestionControl {
 			return &NativeCongestionControl{}
 		},
 	}
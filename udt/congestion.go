@@ -6,8 +6,35 @@ import (
 	"github.com/odysseus654/go-udt/udt/packet"
 )
 
+// CongestionContext is a read-only view of the measurements taken by a connection, for use by a CongestionControl
+// implementation.  Its methods may be called from any goroutine
+type CongestionContext interface {
+	// RTT is the smoothed roundtrip time between peers
+	RTT() time.Duration
+
+	// RTTVar is the variance in the roundtrip time between peers
+	RTTVar() time.Duration
+
+	// Bandwidth is the link capacity estimated by the peer (in packets/sec)
+	Bandwidth() uint
+
+	// DeliveryRate is the rate the peer is receiving our packets (in packets/sec)
+	DeliveryRate() uint
+
+	// FlightSize is the number of data packets we've sent that haven't yet been acknowledged
+	FlightSize() uint
+
+	// MTU is the largest packet we can currently send, including UDP/IP headers (in bytes)
+	MTU() uint
+
+	// FlowWindow is the number of unacknowledged packets the peer is currently willing to accept
+	FlowWindow() uint
+}
+
 // CongestionControlParms permits a CongestionControl implementation to interface with the UDT socket
 type CongestionControlParms interface {
+	CongestionContext
+
 	// GetSndCurrSeqNo is the most recently sent packet ID
 	GetSndCurrSeqNo() packet.PacketID
 
@@ -27,12 +54,18 @@ type CongestionControlParms interface {
 	GetMaxFlowWindow() uint
 
 	// GetReceiveRates is the current calculated receive rate and bandwidth (in packets/sec)
+	//
+	// Deprecated: use DeliveryRate and Bandwidth
 	GetReceiveRates() (recvSpeed, bandwidth uint)
 
 	// GetRTT is the current calculated roundtrip time between peers
+	//
+	// Deprecated: use RTT
 	GetRTT() time.Duration
 
 	// GetMSS is the largest packet size we can currently send (in bytes)
+	//
+	// Deprecated: use MTU
 	GetMSS() uint
 
 	// SetACKPerid sets the time between ACKs sent to the peer
@@ -65,7 +98,7 @@ type CongestionControl interface {
 	// OnPktSent to be called when data is sent
 	OnPktSent(CongestionControlParms, packet.Packet)
 
-	// OnPktRecv to be called when data is received
+	// OnPktRecv to be called when data is received (the packet's payload is not included)
 	OnPktRecv(CongestionControlParms, packet.DataPacket)
 
 	// OnCustomMsg to process a user-defined packet
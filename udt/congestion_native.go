@@ -7,7 +7,20 @@ import (
 	"github.com/odysseus654/go-udt/udt/packet"
 )
 
-// NativeCongestionControl implements the default congestion control logic for UDP
+const (
+	nativeInitialWindow  = 16        // congestion window (in packets) a connection starts with
+	nativeIncreaseFactor = 0.0000015 // Beta in the rate increase calculation
+	nativeDecreaseFactor = 1.125     // the packet interval is multiplied by this when the rate is lowered for loss
+)
+
+// nativeTuning is implemented by the CongestionControlParms we pass to congestion control, so that
+// NativeCongestionControl can pick up the Config settings tuning it (the CC fields)
+type nativeTuning interface {
+	config() *Config
+}
+
+// NativeCongestionControl implements the default congestion control logic for UDP.  Its behaviour may be tuned with
+// the CC fields of Config
 type NativeCongestionControl struct {
 	rcInterval    time.Duration   // UDT Rate control interval
 	lastRCTime    time.Time       // last rate increase time
@@ -20,10 +33,53 @@ type NativeCongestionControl struct {
 	decRandom     int             // random threshold on decrease by number of loss events
 	avgNAKNum     int             // average number of NAKs in a congestion period
 	decCount      int             // number of decreases in a congestion epoch
+
+	initWindow   uint    // congestion window to start with (see Config.CCInitialWindow)
+	slowStartCap uint    // leave slow start once the congestion window passes this (see Config.CCSlowStartCap)
+	incFactor    float64 // Beta in the rate increase calculation (see Config.CCIncreaseFactor)
+	decFactor    float64 // multiplies the packet interval when the rate is lowered (see Config.CCDecreaseFactor)
+	decRange     int     // upper limit on decRandom, if nonzero (see Config.CCDecreaseRange)
+}
+
+// tune picks up the settings in the connection's Config, where they've been set
+func (ncc *NativeCongestionControl) tune(parms CongestionControlParms) {
+	ncc.initWindow, ncc.slowStartCap, ncc.incFactor, ncc.decFactor, ncc.decRange =
+		nativeInitialWindow, 0, nativeIncreaseFactor, nativeDecreaseFactor, 0
+	t, ok := parms.(nativeTuning)
+	if !ok || t.config() == nil {
+		return
+	}
+	config := t.config()
+	if config.CCInitialWindow > 0 {
+		ncc.initWindow = config.CCInitialWindow
+	}
+	ncc.slowStartCap = config.CCSlowStartCap
+	if config.CCIncreaseFactor > 0 {
+		ncc.incFactor = config.CCIncreaseFactor
+	}
+	if config.CCDecreaseFactor > 1 {
+		ncc.decFactor = config.CCDecreaseFactor
+	}
+	ncc.decRange = int(config.CCDecreaseRange)
+}
+
+// slowStartLimit returns the congestion window past which we leave slow start
+func (ncc *NativeCongestionControl) slowStartLimit(parms CongestionControlParms) uint {
+	limit := parms.GetMaxFlowWindow()
+	if ncc.slowStartCap > 0 && ncc.slowStartCap < limit {
+		limit = ncc.slowStartCap
+	}
+	return limit
+}
+
+// decrease lowers the sending rate for loss, returning the new packet interval
+func (ncc *NativeCongestionControl) decrease(pktSendPeriod time.Duration) time.Duration {
+	return time.Duration(float64(pktSendPeriod) * ncc.decFactor)
 }
 
 // Init to be called (only) at the start of a UDT connection.
-func (ncc NativeCongestionControl) Init(parms CongestionControlParms) {
+func (ncc *NativeCongestionControl) Init(parms CongestionControlParms) {
+	ncc.tune(parms)
 	ncc.rcInterval = synTime
 	ncc.lastRCTime = time.Now()
 	parms.SetACKPeriod(ncc.rcInterval)
@@ -37,17 +93,17 @@ func (ncc NativeCongestionControl) Init(parms CongestionControlParms) {
 	ncc.nakCount = 0
 	ncc.decRandom = 1
 
-	parms.SetCongestionWindowSize(16)
+	parms.SetCongestionWindowSize(ncc.initWindow)
 	parms.SetPacketSendPeriod(1 * time.Microsecond)
 }
 
 // Close to be called when a UDT connection is closed.
-func (ncc NativeCongestionControl) Close(parms CongestionControlParms) {
+func (ncc *NativeCongestionControl) Close(parms CongestionControlParms) {
 	// nothing done for this event
 }
 
 // OnACK to be called when an ACK packet is received
-func (ncc NativeCongestionControl) OnACK(parms CongestionControlParms, ack packet.PacketID) {
+func (ncc *NativeCongestionControl) OnACK(parms CongestionControlParms, ack packet.PacketID) {
 	currTime := time.Now()
 	if currTime.Sub(ncc.lastRCTime) < ncc.rcInterval {
 		return
@@ -55,16 +111,16 @@ func (ncc NativeCongestionControl) OnACK(parms CongestionControlParms, ack packe
 	ncc.lastRCTime = currTime
 	cWndSize := parms.GetCongestionWindowSize()
 	pktSendPeriod := parms.GetPacketSendPeriod()
-	recvRate, bandwidth := parms.GetReceiveRates()
-	rtt := parms.GetRTT()
+	recvRate, bandwidth := parms.DeliveryRate(), parms.Bandwidth()
+	rtt := parms.RTT()
 
 	// If the current status is in the slow start phase, set the congestion window
 	// size to the product of packet arrival rate and (RTT + SYN). Slow Start ends. Stop.
 	if ncc.slowStart {
-		cWndSize = uint(int(cWndSize) + int(ack.BlindDiff(ncc.lastAck)))
+		cWndSize = uint(int(cWndSize) + int(ack.Diff(ncc.lastAck)))
 		ncc.lastAck = ack
 
-		if cWndSize > parms.GetMaxFlowWindow() {
+		if cWndSize > ncc.slowStartLimit(parms) {
 			ncc.slowStart = false
 			if recvRate > 0 {
 				parms.SetPacketSendPeriod(time.Second / time.Duration(recvRate))
@@ -105,7 +161,10 @@ func (ncc NativeCongestionControl) OnACK(parms CongestionControlParms, ack packe
 	var inc float64
 	const minInc float64 = 0.01
 
-	B := time.Duration(bandwidth) - time.Second/time.Duration(pktSendPeriod)
+	B := time.Duration(bandwidth)
+	if pktSendPeriod > 0 {
+		B -= time.Second / time.Duration(pktSendPeriod)
+	}
 	bandwidth9 := time.Duration(bandwidth / 9)
 	if (pktSendPeriod > ncc.lastDecPeriod) && (bandwidth9 < B) {
 		B = bandwidth9
@@ -114,10 +173,10 @@ func (ncc NativeCongestionControl) OnACK(parms CongestionControlParms, ack packe
 		inc = minInc
 	} else {
 		// inc = max(10 ^ ceil(log10( B * MSS * 8 ) * Beta / MSS, 1/MSS)
-		// Beta = 1.5 * 10^(-6)
+		// Beta = 1.5 * 10^(-6) unless tuned
 
-		mss := parms.GetMSS()
-		inc = math.Pow10(int(math.Ceil(math.Log10(float64(B)*float64(mss)*8.0)))) * 0.0000015 / float64(mss)
+		mss := parms.MTU()
+		inc = math.Pow10(int(math.Ceil(math.Log10(float64(B)*float64(mss)*8.0)))) * ncc.incFactor / float64(mss)
 
 		if inc < minInc {
 			inc = minInc
@@ -129,11 +188,11 @@ func (ncc NativeCongestionControl) OnACK(parms CongestionControlParms, ack packe
 }
 
 // OnNAK to be called when a loss report is received
-func (ncc NativeCongestionControl) OnNAK(parms CongestionControlParms, losslist []packet.PacketID) {
+func (ncc *NativeCongestionControl) OnNAK(parms CongestionControlParms, losslist []packet.PacketID) {
 	// If it is in slow start phase, set inter-packet interval to 1/recvrate. Slow start ends. Stop.
 	if ncc.slowStart {
 		ncc.slowStart = false
-		recvRate, _ := parms.GetReceiveRates()
+		recvRate := parms.DeliveryRate()
 		if recvRate > 0 {
 			// Set the sending rate to the receiving rate.
 			parms.SetPacketSendPeriod(time.Second / time.Duration(recvRate))
@@ -142,7 +201,7 @@ func (ncc NativeCongestionControl) OnNAK(parms CongestionControlParms, losslist
 		// If no receiving rate is observed, we have to compute the sending
 		// rate according to the current window size, and decrease it
 		// using the method below.
-		parms.SetPacketSendPeriod(time.Duration(float64(time.Microsecond) * float64(parms.GetCongestionWindowSize()) / float64(parms.GetRTT()+ncc.rcInterval)))
+		parms.SetPacketSendPeriod(time.Duration(float64(time.Microsecond) * float64(parms.GetCongestionWindowSize()) / float64(parms.RTT()+ncc.rcInterval)))
 	}
 
 	ncc.loss = true
@@ -158,10 +217,13 @@ func (ncc NativeCongestionControl) OnNAK(parms CongestionControlParms, losslist
 			b. Increase DecCount by 1;
 			c. Record the current largest sent sequence number (LastDecSeq).
 	*/
+	if len(losslist) == 0 {
+		return
+	}
 	pktSendPeriod := parms.GetPacketSendPeriod()
-	if ncc.lastDecSeq.BlindDiff(losslist[0]) > 0 {
+	if losslist[0].Cmp(ncc.lastDecSeq) > 0 {
 		ncc.lastDecPeriod = pktSendPeriod
-		parms.SetPacketSendPeriod(pktSendPeriod * 1125 / 1000)
+		parms.SetPacketSendPeriod(ncc.decrease(pktSendPeriod))
 
 		ncc.avgNAKNum = int(math.Ceil(float64(ncc.avgNAKNum)*0.875 + float64(ncc.nakCount)*0.125))
 		ncc.nakCount = 1
@@ -172,34 +234,37 @@ func (ncc NativeCongestionControl) OnNAK(parms CongestionControlParms, losslist
 		// remove global synchronization using randomization
 		rand := float64(randUint32()) / math.MaxUint32
 		ncc.decRandom = int(math.Ceil(float64(ncc.avgNAKNum) * rand))
+		if ncc.decRange > 0 && ncc.decRandom > ncc.decRange {
+			ncc.decRandom = ncc.decRange
+		}
 		if ncc.decRandom < 1 {
 			ncc.decRandom = 1
 		}
 	} else {
-		if ncc.decCount < 5 {
-			ncc.nakCount++
-			if ncc.nakCount%ncc.decRandom != 0 {
-				ncc.decCount++
-				return
-			}
-		}
+		// 0.875^5 = 0.51, rate should not be decreased by more than half within a congestion period
 		ncc.decCount++
+		if ncc.decCount > 5 {
+			return
+		}
+		ncc.nakCount++
+		if ncc.nakCount%ncc.decRandom != 0 {
+			return
+		}
 
-		// 0.875^5 = 0.51, rate should not be decreased by more than half within a congestion period
-		parms.SetPacketSendPeriod(pktSendPeriod * 1125 / 1000)
+		parms.SetPacketSendPeriod(ncc.decrease(pktSendPeriod))
 		ncc.lastDecSeq = parms.GetSndCurrSeqNo()
 	}
 }
 
 // OnTimeout to be called when a timeout event occurs
-func (ncc NativeCongestionControl) OnTimeout(parms CongestionControlParms) {
+func (ncc *NativeCongestionControl) OnTimeout(parms CongestionControlParms) {
 	if ncc.slowStart {
 		ncc.slowStart = false
-		recvRate, _ := parms.GetReceiveRates()
+		recvRate := parms.DeliveryRate()
 		if recvRate > 0 {
 			parms.SetPacketSendPeriod(time.Second / time.Duration(recvRate))
 		} else {
-			parms.SetPacketSendPeriod(time.Duration(float64(time.Microsecond) * float64(parms.GetCongestionWindowSize()) / float64(parms.GetRTT()+ncc.rcInterval)))
+			parms.SetPacketSendPeriod(time.Duration(float64(time.Microsecond) * float64(parms.GetCongestionWindowSize()) / float64(parms.RTT()+ncc.rcInterval)))
 		}
 	} else {
 		/*
@@ -212,16 +277,16 @@ func (ncc NativeCongestionControl) OnTimeout(parms CongestionControlParms) {
 }
 
 // OnPktSent to be called when data is sent
-func (ncc NativeCongestionControl) OnPktSent(parms CongestionControlParms, pkt packet.Packet) {
+func (ncc *NativeCongestionControl) OnPktSent(parms CongestionControlParms, pkt packet.Packet) {
 	// nothing done for this event
 }
 
 // OnPktRecv to be called when a data is received
-func (ncc NativeCongestionControl) OnPktRecv(parms CongestionControlParms, pkt packet.DataPacket) {
+func (ncc *NativeCongestionControl) OnPktRecv(parms CongestionControlParms, pkt packet.DataPacket) {
 	// nothing done for this event
 }
 
 // OnCustomMsg to process a user-defined packet
-func (ncc NativeCongestionControl) OnCustomMsg(parms CongestionControlParms, pkt packet.UserDefControlPacket) {
+func (ncc *NativeCongestionControl) OnCustomMsg(parms CongestionControlParms, pkt packet.UserDefControlPacket) {
 	// nothing done for this event
 }
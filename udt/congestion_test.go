@@ -0,0 +1,201 @@
+package udt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// watchingCongestion is the native congestion control, also recording the view of the connection it was given
+type watchingCongestion struct {
+	NativeCongestionControl
+	ctx   CongestionContext
+	prot  sync.Mutex
+	acked bool // whether an ACK has been received
+}
+
+func (c *watchingCongestion) OnACK(parms CongestionControlParms, ack packet.PacketID) {
+	c.NativeCongestionControl.OnACK(parms, ack)
+	c.prot.Lock()
+	c.acked = true
+	c.prot.Unlock()
+}
+
+func TestCongestionContext(t *testing.T) {
+	cc := &watchingCongestion{}
+	config := DefaultConfig()
+	config.CongestionForSocket = func(ctx CongestionContext) CongestionControl {
+		cc.ctx = ctx
+		return cc
+	}
+	serv, client, server := connectWithClock(t, 22, defaultClock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	// the view may be read from any goroutine while the connection is busy
+	buf := make([]byte, 1000)
+	for i := 0; i < 200; i++ {
+		if _, err := client.Write(buf); err != nil {
+			t.Fatalf("error calling Write: %s", err.Error())
+		}
+		if flight := cc.ctx.FlightSize(); flight > server.maxFlowWinSize {
+			t.Errorf("%d packets in flight exceeds the flow window of %d", flight, server.maxFlowWinSize)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		cc.prot.Lock()
+		acked := cc.acked
+		cc.prot.Unlock()
+		if acked {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cc.ctx.RTT() <= 0 || cc.ctx.RTTVar() < 0 {
+		t.Errorf("unexpected roundtrip time %v (variance %v)", cc.ctx.RTT(), cc.ctx.RTTVar())
+	}
+	if cc.ctx.MTU() != uint(client.mtu.get()) {
+		t.Errorf("expected an MTU of %d, got %d", client.mtu.get(), cc.ctx.MTU())
+	}
+	if cc.ctx.FlowWindow() == 0 {
+		t.Error("expected a nonzero flow window")
+	}
+}
+
+// tunedParms is just enough of a connection for NativeCongestionControl to run against, with the specified Config
+type tunedParms struct {
+	CongestionControlParms
+	conf       *Config
+	congWindow uint
+	sndPeriod  time.Duration
+}
+
+func (p *tunedParms) config() *Config                       { return p.conf }
+func (p *tunedParms) GetSndCurrSeqNo() packet.PacketID      { return packet.PacketID{Seq: 100} }
+func (p *tunedParms) SetCongestionWindowSize(pkt uint)      { p.congWindow = pkt }
+func (p *tunedParms) GetCongestionWindowSize() uint         { return p.congWindow }
+func (p *tunedParms) GetPacketSendPeriod() time.Duration    { return p.sndPeriod }
+func (p *tunedParms) SetPacketSendPeriod(snd time.Duration) { p.sndPeriod = snd }
+func (p *tunedParms) GetMaxFlowWindow() uint                { return 8192 }
+func (p *tunedParms) SetACKPeriod(ack time.Duration)        {}
+func (p *tunedParms) DeliveryRate() uint                    { return 1000 }
+func (p *tunedParms) Bandwidth() uint                       { return 10000 }
+func (p *tunedParms) RTT() time.Duration                    { return 50 * time.Millisecond }
+func (p *tunedParms) MTU() uint                             { return 1500 }
+
+func TestNativeCongestionTuning(t *testing.T) {
+	config := DefaultConfig()
+	config.CCInitialWindow = 4
+	config.CCSlowStartCap = 64
+	config.CCDecreaseFactor = 1.5
+	parms := &tunedParms{conf: config}
+	var ncc NativeCongestionControl
+	ncc.Init(parms)
+	if parms.congWindow != 4 {
+		t.Errorf("expected to start with a window of 4 packets, got %d", parms.congWindow)
+	}
+
+	// slow start ends once the window passes the cap, well short of the flow window
+	ncc.lastRCTime = ncc.lastRCTime.Add(-time.Second)
+	ncc.OnACK(parms, packet.PacketID{Seq: 100 + 60})
+	if !ncc.slowStart || parms.congWindow != 64 {
+		t.Fatalf("expected to still be in slow start with a window of 64 packets, got %d", parms.congWindow)
+	}
+	ncc.lastRCTime = ncc.lastRCTime.Add(-time.Second)
+	ncc.OnACK(parms, packet.PacketID{Seq: 100 + 61})
+	if ncc.slowStart {
+		t.Fatal("expected slow start to end past the cap")
+	}
+	// and loss slows us down by the configured factor
+	parms.sndPeriod = time.Millisecond
+	ncc.OnNAK(parms, []packet.PacketID{{Seq: 200}})
+	if parms.sndPeriod != 1500*time.Microsecond {
+		t.Errorf("expected the packet interval to grow to 1.5ms, got %s", parms.sndPeriod)
+	}
+}
+
+func TestNativeCongestionState(t *testing.T) {
+	// driven through the interface as a connection drives it, so its state has to survive from one event to the next
+	ncc := &NativeCongestionControl{}
+	var cc CongestionControl = ncc
+	parms := &tunedParms{conf: DefaultConfig()}
+	cc.Init(parms)
+	if !ncc.slowStart {
+		t.Fatal("expected Init to start in slow start")
+	}
+
+	// an empty loss report ends slow start without lowering the rate any further
+	cc.OnNAK(parms, nil)
+	if ncc.slowStart || parms.sndPeriod != time.Second/1000 {
+		t.Fatalf("expected slow start to end at the delivery rate, got a packet interval of %s", parms.sndPeriod)
+	}
+
+	// a connection that hasn't yet picked a packet interval can still have its rate increased
+	parms.sndPeriod = 0
+	ncc.loss = false
+	ncc.lastRCTime = ncc.lastRCTime.Add(-time.Second)
+	cc.OnACK(parms, packet.PacketID{Seq: 300})
+	if parms.sndPeriod != 0 {
+		t.Errorf("expected an unset packet interval to stay unset, got %s", parms.sndPeriod)
+	}
+}
+
+func TestNativeCongestionDecreaseCap(t *testing.T) {
+	ncc := &NativeCongestionControl{}
+	parms := &tunedParms{conf: DefaultConfig()}
+	ncc.Init(parms)
+	ncc.OnNAK(parms, nil) // ends slow start
+
+	// with no history of losses every report lowers the rate, but no more than five times in a congestion period
+	parms.sndPeriod = time.Millisecond
+	ncc.OnNAK(parms, []packet.PacketID{{Seq: 200}}) // beyond anything sent when the rate was last lowered
+	for i := 0; i < 10; i++ {
+		ncc.OnNAK(parms, []packet.PacketID{{Seq: 50}})
+	}
+	expect := time.Millisecond
+	for i := 0; i < 5; i++ {
+		expect = time.Duration(float64(expect) * nativeDecreaseFactor)
+	}
+	if parms.sndPeriod != expect {
+		t.Errorf("expected the packet interval to grow to %s, got %s", expect, parms.sndPeriod)
+	}
+}
+
+func TestNativeCongestionWrap(t *testing.T) {
+	ncc := &NativeCongestionControl{}
+	parms := &tunedParms{conf: DefaultConfig()}
+	ncc.Init(parms)
+
+	// slow start grows the window by the packets acknowledged, across the wrap
+	ncc.lastAck = packet.PacketID{Seq: 0x7FFFFFF0}
+	window := parms.congWindow
+	ncc.lastRCTime = ncc.lastRCTime.Add(-time.Second)
+	ncc.OnACK(parms, packet.PacketID{Seq: 0x10})
+	if parms.congWindow != window+0x20 {
+		t.Fatalf("expected the window to grow by 32 packets to %d, got %d", window+0x20, parms.congWindow)
+	}
+
+	// and a loss just past the wrap is beyond anything sent when the rate was last lowered
+	ncc.OnNAK(parms, nil) // ends slow start
+	parms.sndPeriod = time.Millisecond
+	ncc.lastDecSeq = packet.PacketID{Seq: 0x7FFFFFF0}
+	ncc.decCount = 5 // (a report within the same congestion period couldn't lower the rate any more)
+	ncc.OnNAK(parms, []packet.PacketID{{Seq: 5}})
+	if expect := time.Duration(float64(time.Millisecond) * nativeDecreaseFactor); parms.sndPeriod != expect ||
+		ncc.decCount != 1 {
+		t.Errorf("expected a new congestion period with the packet interval at %s, got %s", expect, parms.sndPeriod)
+	}
+}
@@ -0,0 +1,135 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+Listener.Connections lists the connections a listener has accepted that haven't yet closed, so the operator of a
+server can see who is connected and how each connection is doing, and Listener.Kick forcibly closes one of them
+(telling the peer why with CloseKicked).  The ConnInfo describing each connection is a snapshot taken when
+Connections was called, and holding onto one doesn't keep its connection open.
+
+Connections that have closed are forgotten the next time the listener rotates its syn cookies.
+*/
+
+// ErrNoSuchConn is returned from Listener.Kick when the listener has no connection with that socket ID
+var ErrNoSuchConn = errors.New("No such connection")
+
+// ConnState describes how far along a connection is, see ConnInfo
+type ConnState int
+
+const (
+	// ConnConnecting is a connection still completing its handshake
+	ConnConnecting ConnState = iota + 1
+	// ConnConnected is an established connection
+	ConnConnected
+	// ConnClosing is a connection that has shut down, but hasn't finished closing (such as while lingering to resend
+	// anything our peer missed)
+	ConnClosing
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case ConnConnecting:
+		return "connecting"
+	case ConnConnected:
+		return "connected"
+	case ConnClosing:
+		return "closing"
+	default:
+		return fmt.Sprintf("state(%d)", int(c))
+	}
+}
+
+// MarshalText returns the name of this state
+func (c ConnState) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// ConnInfo is a snapshot of one of a listener's connections, see Listener.Connections
+type ConnInfo struct {
+	SockID     uint32    // our socket ID for the connection, which identifies it to Kick
+	RemoteAddr *UDTAddr  // the peer's end of the connection
+	State      ConnState // how far along the connection is
+	Opened     time.Time // when the connection was accepted
+	Stats      Stats     // the connection's metrics
+
+	Capabilities     Capability // the optional features in use on the connection
+	PeerCapabilities Capability // the optional features the peer advertised in its handshake
+}
+
+// connState returns how far along this connection is, for ConnInfo
+func (s *udtSocket) connState() ConnState {
+	switch state := s.sockState.get(); {
+	case state == sockStateConnected:
+		return ConnConnected
+	case isOpenState(state):
+		return ConnConnecting
+	default:
+		return ConnClosing
+	}
+}
+
+// track adds a connection we've accepted to those returned by Connections
+func (l *listener) track(s *udtSocket) {
+	l.connsProt.Lock()
+	if l.conns == nil {
+		l.conns = make(map[uint32]*udtSocket)
+	}
+	l.conns[s.sockID] = s
+	l.connsProt.Unlock()
+}
+
+// pruneConns forgets connections that have finished closing
+func (l *listener) pruneConns() {
+	l.connsProt.Lock()
+	defer l.connsProt.Unlock()
+	for sockID, s := range l.conns {
+		select {
+		case <-s.sockClosed:
+			delete(l.conns, sockID)
+		default:
+		}
+	}
+}
+
+// Connections returns a snapshot of each connection this listener has accepted that hasn't yet finished closing
+func (l *listener) Connections() []ConnInfo {
+	l.pruneConns()
+	l.connsProt.Lock()
+	socks := make([]*udtSocket, 0, len(l.conns))
+	for _, s := range l.conns {
+		socks = append(socks, s)
+	}
+	l.connsProt.Unlock()
+
+	result := make([]ConnInfo, 0, len(socks))
+	for _, s := range socks {
+		caps, peerCaps := s.Capabilities()
+		result = append(result, ConnInfo{
+			SockID:           s.sockID,
+			RemoteAddr:       s.RemoteAddr().(*UDTAddr),
+			State:            s.connState(),
+			Opened:           s.created,
+			Stats:            s.Stats(),
+			Capabilities:     caps,
+			PeerCapabilities: peerCaps,
+		})
+	}
+	return result
+}
+
+// Kick forcibly closes one of this listener's connections (identified by our socket ID for it), abandoning anything
+// not yet delivered and telling the peer it was closed with CloseKicked
+func (l *listener) Kick(sockID uint32) error {
+	l.connsProt.Lock()
+	s := l.conns[sockID]
+	l.connsProt.Unlock()
+	if s == nil {
+		return ErrNoSuchConn
+	}
+	return s.CloseWithError(CloseKicked, "")
+}
@@ -0,0 +1,63 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerConnections(t *testing.T) {
+	l, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+101))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+102), l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if _, err := server.Read(buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+
+	conns := l.(Listener).Connections()
+	if len(conns) != 1 {
+		t.Fatalf("expected one connection, got %+v", conns)
+	}
+	info := conns[0]
+	if info.SockID != server.LocalAddr().(*UDTAddr).SocketID || info.State != ConnConnected ||
+		info.RemoteAddr.SocketID != client.LocalAddr().(*UDTAddr).SocketID || info.Stats.ByteRecv != 5 {
+		t.Errorf("connection doesn't match what was accepted: %+v", info)
+	}
+
+	if err := l.(Listener).Kick(info.SockID + 1); !errors.Is(err, ErrNoSuchConn) {
+		t.Errorf("expected kicking an unknown connection to fail, got %v", err)
+	}
+	if err := l.(Listener).Kick(info.SockID); err != nil {
+		t.Fatalf("error kicking: %s", err.Error())
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.Read(buf)
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseKicked {
+		t.Errorf("expected the client to learn it was kicked, got %v", err)
+	}
+	if conns := l.(Listener).Connections(); len(conns) != 0 {
+		t.Errorf("expected the kicked connection to be forgotten, got %+v", conns)
+	}
+}
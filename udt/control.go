@@ -0,0 +1,66 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Applications may exchange their own messages with a connected peer using UDT's user-defined control packets.  These
+travel alongside the data stream but outside of it: they are not acknowledged or retransmitted, may arrive out of
+order with respect to data and each other, and must fit in a single packet.  Message types used internally (by FEC and
+multipath) are reserved.
+*/
+
+// isReservedMsgType returns whether a user-defined control packet message type is used internally by this package
+func isReservedMsgType(msgType uint16) bool {
+	switch msgType {
+	case fecMsgType, unreliableMsgType, ecnMsgType, mpJoinMsgType, mpJoinAckMsgType, mpProbeMsgType, mpProbeReplyMsgType:
+		return true
+	default:
+		return false
+	}
+}
+
+// maxControlSize returns the largest payload we can place in a single user-defined control packet
+func (s *udtSocket) maxControlSize() int {
+	if s.raddr.IP.To4() != nil {
+		return int(s.mtu.get()) - udtHeaderSize - udp4HeaderSize
+	}
+	return int(s.mtu.get()) - udtHeaderSize - udp6HeaderSize
+}
+
+// SendControl sends an application-defined message to our peer in a user-defined control packet, where it is
+// passed to the Config.OnControl callback.  Delivery is not guaranteed
+func (s *udtSocket) SendControl(msgType uint16, data []byte) error {
+	if err := s.connectionError(); err != nil {
+		return err
+	}
+	if s.sockState.get() != sockStateConnected {
+		return errors.New("Connection not established")
+	}
+	if isReservedMsgType(msgType) {
+		return fmt.Errorf("Control message type %X is reserved", msgType)
+	}
+	if maxSize := s.maxControlSize(); len(data) > maxSize {
+		return fmt.Errorf("Control message of %d bytes exceeds the maximum of %d", len(data), maxSize)
+	}
+
+	p := &packet.UserDefControlPacket{MsgType: msgType, Data: make([]byte, len(data))}
+	copy(p.Data, data)
+	select {
+	case s.sendPacket <- p:
+		return nil
+	case _, _ = <-s.sockClosed:
+		return s.connectionError()
+	}
+}
+
+// deliverControl passes a user-defined control packet received from our peer to the application
+func (s *udtSocket) deliverControl(p packet.UserDefControlPacket) {
+	if onControl := s.Config.OnControl; onControl != nil {
+		onControl(s, p.MsgType, p.Data)
+	}
+}
@@ -0,0 +1,46 @@
+package udt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type controlMsg struct {
+	msgType uint16
+	data    []byte
+}
+
+func TestSendControl(t *testing.T) {
+	received := make(chan controlMsg, 10)
+	config := DefaultConfig()
+	config.OnControl = func(conn Conn, msgType uint16, data []byte) {
+		received <- controlMsg{msgType, data}
+	}
+	serv, client, server := connectWithClock(t, 20, defaultClock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	if err := server.SendControl(fecMsgType, nil); err == nil {
+		t.Error("expected a reserved message type to be refused")
+	}
+	if err := server.SendControl(0x1234, make([]byte, server.maxControlSize()+1)); err == nil {
+		t.Error("expected an oversized message to be refused")
+	}
+
+	msg := []byte("hello")
+	if err := server.SendControl(0x1234, msg); err != nil {
+		t.Fatalf("error calling SendControl: %s", err.Error())
+	}
+	msg[0] = 'j' // the message is sent as it was when SendControl was called
+
+	select {
+	case got := <-received:
+		if got.msgType != 0x1234 || !bytes.Equal(got.data, []byte("hello")) {
+			t.Errorf("expected message type 1234 carrying %q, got %X carrying %q", "hello", got.msgType, got.data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("control message was never delivered")
+	}
+}
@@ -0,0 +1,94 @@
+package udt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+A listener doesn't keep any state for a connection until the peer has echoed back the syn cookie it was sent in
+response to its first handshake, so a flood of handshakes (such as from spoofed addresses) can't use up its memory.
+
+The cookie is an HMAC of the peer's address and port, keyed with a secret that is replaced every synCookiePeriod.  A
+cookie made with the current or the previous secret is accepted, so each is valid for between one and two periods.
+Only someone receiving packets at an address can learn its cookie, and a captured cookie can't be replayed from
+another address, or after its secret has been retired.
+*/
+
+const (
+	synCookiePeriod    = 64 * time.Second // how often the secret used to make syn cookies is replaced
+	synCookieEpochBits = 5                // the low bits of the epoch a cookie was made in are carried in its high bits
+	synCookieHashMask  = 1<<(32-synCookieEpochBits) - 1
+)
+
+// synCookies generates and checks the syn cookies given out by a listener
+type synCookies struct {
+	prot   sync.Mutex // lock must be held before referencing any other members
+	epoch  uint32     // incremented each time the secret is replaced
+	secret []byte     // the key for cookies made in this epoch
+	prev   []byte     // the key for cookies made in the previous epoch
+}
+
+func newSynCookies() *synCookies {
+	return &synCookies{
+		epoch:  randUint32(),
+		secret: newSynSecret(),
+		prev:   newSynSecret(),
+	}
+}
+
+// newSynSecret returns a random key for generating syn cookies
+func newSynSecret() []byte {
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Unable to generate syn cookie secret: %s", err)
+	}
+	return secret
+}
+
+// rotate replaces the secret cookies are made with, retiring the previous one
+func (c *synCookies) rotate() {
+	secret := newSynSecret()
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	c.prev = c.secret
+	c.secret = secret
+	c.epoch++
+}
+
+// generate returns the cookie a peer at the specified address should echo back to us
+func (c *synCookies) generate(from *net.UDPAddr) uint32 {
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	return c.epoch<<(32-synCookieEpochBits) | synCookieHash(c.secret, c.epoch, from)
+}
+
+// check returns true if a cookie was one we recently gave to a peer at the specified address
+func (c *synCookies) check(cookie uint32, from *net.UDPAddr) bool {
+	c.prot.Lock()
+	defer c.prot.Unlock()
+	epoch, secret := c.epoch, c.secret
+	if cookie>>(32-synCookieEpochBits) != epoch&(1<<synCookieEpochBits-1) {
+		epoch, secret = c.epoch-1, c.prev
+		if cookie>>(32-synCookieEpochBits) != epoch&(1<<synCookieEpochBits-1) {
+			return false
+		}
+	}
+	return cookie&synCookieHashMask == synCookieHash(secret, epoch, from)
+}
+
+// synCookieHash returns the part of a cookie binding it to the peer's address and the secret it was made with
+func synCookieHash(secret []byte, epoch uint32, from *net.UDPAddr) uint32 {
+	var buf [4 + net.IPv6len + 2]byte
+	endianness.PutUint32(buf[0:], epoch)
+	copy(buf[4:], from.IP.To16())
+	endianness.PutUint16(buf[4+net.IPv6len:], uint16(from.Port))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(buf[:])
+	return endianness.Uint32(mac.Sum(nil)) & synCookieHashMask
+}
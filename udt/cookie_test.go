@@ -0,0 +1,46 @@
+package udt
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSynCookies(t *testing.T) {
+	c := newSynCookies()
+	from := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9000}
+	cookie := c.generate(from)
+	if !c.check(cookie, from) {
+		t.Fatal("cookie rejected from the address it was made for")
+	}
+
+	// cookies are bound to the address and port they were given to
+	for _, other := range []*net.UDPAddr{
+		{IP: net.IPv4(192, 0, 2, 2), Port: 9000},
+		{IP: net.IPv4(192, 0, 2, 1), Port: 9001},
+	} {
+		if c.check(cookie, other) {
+			t.Errorf("cookie for %s accepted from %s", from, other)
+		}
+	}
+	if c.check(cookie^1, from) || c.check(cookie^(1<<31), from) {
+		t.Error("altered cookie accepted")
+	}
+
+	// a cookie outlives the secret it was made with by one period, then is retired
+	c.rotate()
+	if !c.check(cookie, from) {
+		t.Error("cookie rejected after one rotation")
+	}
+	if c.generate(from) == cookie {
+		t.Error("cookie unchanged after the secret was rotated")
+	}
+	c.rotate()
+	if c.check(cookie, from) {
+		t.Error("cookie accepted after its secret was retired")
+	}
+
+	// another listener's secret produces different cookies
+	if newSynCookies().check(c.generate(from), from) {
+		t.Error("cookie accepted by a listener that didn't make it")
+	}
+}
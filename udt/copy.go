@@ -0,0 +1,93 @@
+package udt
+
+import (
+	"context"
+	"io"
+)
+
+/*
+ReadFrom and WriteTo let io.Copy move bulk data through a streaming connection without the extra buffer it would
+otherwise copy through.  ReadFrom reads the source directly into packet-sized buffers that are handed to the send
+path as-is (so each one becomes a single data packet), and WriteTo passes each received payload directly to the sink.
+Datagram connections use the usual io.Copy behavior, since each Read or Write there is a message of its own.
+*/
+
+// writerOnly hides the ReadFrom method of a socket, so io.Copy doesn't call back into it
+type writerOnly struct {
+	io.Writer
+}
+
+// readerOnly hides the WriteTo method of a socket, so io.Copy doesn't call back into it
+type readerOnly struct {
+	io.Reader
+}
+
+// ReadFrom sends everything read from r until EOF, returning the number of bytes sent.
+// (implements io.ReaderFrom, which io.Copy uses when copying to this connection)
+func (s *udtSocket) ReadFrom(r io.Reader) (n int64, err error) {
+	if s.isDatagram {
+		return io.Copy(writerOnly{s}, r)
+	}
+	if err = s.connectionError(); err != nil {
+		return
+	}
+
+	for {
+		// each buffer is handed off to the send path, so we need a fresh one every time
+		buf := make([]byte, s.send.maxPayloadSize())
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			nw, werr := s.writeMessage(context.Background(), sendMessage{content: buf[:nr], tim: s.clock.Now()})
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// WriteTo writes everything received to w until the connection is closed, returning the number of bytes written.
+// A connection closed normally ends the copy without an error.
+// (implements io.WriterTo, which io.Copy uses when copying from this connection)
+func (s *udtSocket) WriteTo(w io.Writer) (n int64, err error) {
+	if s.isDatagram {
+		return io.Copy(w, readerOnly{s})
+	}
+
+	for {
+		data := s.currPartialRead
+		s.currPartialRead = nil
+		if data == nil {
+			msg, rerr := s.fetchReadPacket(context.Background(), s.connectionError() == nil)
+			if rerr != nil {
+				return n, rerr
+			}
+			if msg.none {
+				if s.sockState.get() == sockStateClosed && s.closeErr.get() == nil {
+					return n, nil
+				}
+				return n, s.connectionError()
+			}
+			data = msg.content
+		}
+
+		nw, werr := w.Write(data)
+		n += int64(nw)
+		if werr != nil {
+			if nw < len(data) {
+				s.currPartialRead = data[nw:] // leave what wasn't written for the next Read
+			}
+			return n, werr
+		}
+		if nw < len(data) {
+			s.currPartialRead = data[nw:]
+			return n, io.ErrShortWrite
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// onlyReader hides any WriteTo method of the source, so io.Copy has to use our ReadFrom
+type onlyReader struct {
+	io.Reader
+}
+
+func TestCopy(t *testing.T) {
+	serv, client, server := connectWithClock(t, 38, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer server.Close()
+
+	data := make([]byte, 200000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	type copyResult struct {
+		n   int64
+		err error
+		buf bytes.Buffer
+	}
+	received := make(chan *copyResult, 1)
+	go func() {
+		result := &copyResult{}
+		result.n, result.err = io.Copy(&result.buf, server)
+		received <- result
+	}()
+
+	n, err := io.Copy(client, onlyReader{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("error copying to the connection: %s", err.Error())
+	}
+	if n != int64(len(data)) {
+		t.Errorf("copied %d bytes to the connection, expected %d", n, len(data))
+	}
+	client.Close()
+
+	// the copy from the connection finishes once our peer closes it
+	select {
+	case result := <-received:
+		if result.err != nil {
+			t.Fatalf("error copying from the connection: %s", result.err.Error())
+		}
+		if result.n != int64(len(data)) || !bytes.Equal(result.buf.Bytes(), data) {
+			t.Errorf("received %d bytes that don't match the %d we sent", result.n, len(data))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("copy from the connection never finished")
+	}
+}
@@ -0,0 +1,74 @@
+package udt
+
+import (
+	"context"
+)
+
+/*
+A stream connection normally sends whatever has been written as soon as congestion control lets it, so a run of small
+writes made while it's idle each go out in a packet of their own.  With Config.CorkInterval set, a packet that isn't
+full is held back for up to that long after the oldest data in it was written, in case later writes fill it (much as
+Nagle's algorithm does for TCP).  Anything written while the connection is busy sending is already merged into full
+packets, so this only delays data written in small pieces to an otherwise idle connection, and closing the connection
+sends anything held back straight away.
+
+Conn.SetNoDelay turns this off (or back on) for a single connection, and Conn.Flush sends anything held back without
+waiting for the rest of the interval.  With no delay, each write is put into packets as soon as the connection has
+taken it, and so goes out as soon as congestion control next lets the connection send.  Datagram connections send each
+message as it's written, regardless.
+*/
+
+// defaultCorkInterval is how long a connection with SetNoDelay(false) holds back a partly filled packet, if it wasn't
+// given a Config.CorkInterval
+const defaultCorkInterval = synTime
+
+// SetNoDelay controls whether this stream connection sends each write as soon as it can (true), or holds back a
+// partly filled packet for later writes to fill (false) for Config.CorkInterval (or 10ms if that isn't set).  Turning
+// delays off sends anything currently held back, as Flush does
+func (s *udtSocket) SetNoDelay(noDelay bool) error {
+	switch {
+	case noDelay:
+		s.cork.set(0)
+		return s.Flush()
+	case s.Config.CorkInterval > 0:
+		s.cork.set(s.Config.CorkInterval)
+	default:
+		s.cork.set(defaultCorkInterval)
+	}
+	return nil
+}
+
+// Flush sends anything this stream connection is holding back for later writes to fill (see Config.CorkInterval) as
+// soon as it can, rather than waiting for the rest of the interval.  It has no effect on a datagram connection
+func (s *udtSocket) Flush() error {
+	if s.isDatagram {
+		return nil
+	}
+	// this follows anything written before it to the sending side, so it applies to all of that
+	_, err := s.writeMessage(context.Background(), sendMessage{tim: s.clock.Now(), flush: true})
+	return err
+}
+
+// holdPartial returns true if the partly filled packet in msgPartialSend should be held back for more data, arranging
+// for corkEvent to fire once it's due.  Nothing is held back once inChan has been closed (nil), as nothing more will
+// arrive on it
+func (s *udtSocketSend) holdPartial(inChan <-chan sendMessage) bool {
+	if s.flushNow {
+		s.flushNow = false
+		return false
+	}
+	cork := s.socket.cork.get()
+	if cork <= 0 || inChan == nil || s.socket.isDatagram {
+		return false
+	}
+	now := s.socket.clock.Now()
+	wait := s.msgPartialSend.tim.Add(cork).Sub(now)
+	if wait <= 0 {
+		return false
+	}
+	if s.corkEvent == nil {
+		s.corkEvent = s.socket.clock.After(wait)
+	}
+	s.corked = true
+	return true
+}
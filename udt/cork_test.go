@@ -0,0 +1,101 @@
+package udt
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCorkInterval(t *testing.T) {
+	config := DefaultConfig()
+	config.CorkInterval = 200 * time.Millisecond
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	// small writes made in quick succession go out together, once the interval has passed
+	start := time.Now()
+	for _, msg := range []string{"one ", "two ", "three"} {
+		if _, err := a.Write([]byte(msg)); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+	buf := make([]byte, len("one two three"))
+	if _, err := io.ReadFull(b, buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if string(buf) != "one two three" {
+		t.Errorf("read %q", buf)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected the writes to be held back, arrived after %s", elapsed)
+	}
+	if sent := a.(Conn).Stats().PktSent; sent != 1 {
+		t.Errorf("expected the writes to be sent in a single packet, sent %d", sent)
+	}
+
+	// with SetNoDelay they're sent right away
+	a.(Conn).SetNoDelay(true)
+	start = time.Now()
+	echoOnce(t, a, b, "now")
+	if elapsed := time.Since(start); elapsed >= 150*time.Millisecond {
+		t.Errorf("expected the write to be sent right away, arrived after %s", elapsed)
+	}
+}
+
+func TestCorkFlushedOnClose(t *testing.T) {
+	config := DefaultConfig()
+	config.CorkInterval = time.Hour
+	a, b := config.Pipe()
+	defer b.Close()
+
+	if _, err := a.Write([]byte("held")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	a.Close()
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "held" {
+		t.Errorf("expected data held back to be sent on close, read %q (%v)", buf, err)
+	}
+}
+
+func TestCorkFlush(t *testing.T) {
+	config := DefaultConfig()
+	config.CorkInterval = time.Hour
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	// Flush sends what's held back without waiting out the interval
+	if _, err := a.Write([]byte("flushed")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	if err := a.(Conn).Flush(); err != nil {
+		t.Fatalf("error flushing: %s", err.Error())
+	}
+	buf := make([]byte, len("flushed"))
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "flushed" {
+		t.Fatalf("expected flushed data to be sent, read %q (%v)", buf, err)
+	}
+
+	// as does turning delays off
+	if _, err := a.Write([]byte("undelayed")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	if err := a.(Conn).SetNoDelay(true); err != nil {
+		t.Fatalf("error turning delays off: %s", err.Error())
+	}
+	buf = make([]byte, len("undelayed"))
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "undelayed" {
+		t.Fatalf("expected held data to be sent once delays were turned off, read %q (%v)", buf, err)
+	}
+
+	// with no delay, each write is sent without needing to be flushed
+	for i := 0; i < 3; i++ {
+		echoOnce(t, a, b, "small")
+	}
+	if sent := a.(Conn).Stats().PktSent; sent != 5 {
+		t.Errorf("expected each write to be sent once delays were turned off, sent %d packets", sent)
+	}
+}
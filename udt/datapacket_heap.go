@@ -14,7 +14,7 @@ func (h dataPacketHeap) Len() int {
 }
 
 func (h dataPacketHeap) Less(i, j int) bool {
-	return h[i].Seq.Seq < h[j].Seq.Seq
+	return h[i].Seq.Cmp(h[j].Seq) < 0
 }
 
 func (h dataPacketHeap) Swap(i, j int) {
@@ -33,72 +33,33 @@ func (h *dataPacketHeap) Pop() interface{} {
 	return x
 }
 
-// Find does a binary search of the heap for the specified packetID which is returned
+// Find does a search of the heap for the specified packetID which is returned
 func (h dataPacketHeap) Find(packetID packet.PacketID) (*packet.DataPacket, int) {
-	len := len(h)
-	idx := 0
-	for idx < len {
-		pid := h[idx].Seq
-		if pid == packetID {
-			return h[idx], idx
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	idx := heapFind(len(h), 0, func(idx int) int {
+		return h[idx].Seq.Cmp(packetID)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return h[idx], idx
 }
 
-// Min does a binary search of the heap for the entry with the lowest packetID greater than or equal to the specified value
+// Min does a search of the heap for the entry with the lowest packetID greater than or equal to the specified value
 func (h dataPacketHeap) Min(greaterEqual packet.PacketID, lessEqual packet.PacketID) (*packet.DataPacket, int) {
-	len := len(h)
-	idx := 0
-	wrapped := greaterEqual.Seq > lessEqual.Seq
-	for idx < len {
-		pid := h[idx].Seq
-		var next int
-		if pid.Seq == greaterEqual.Seq {
-			return h[idx], idx
-		} else if pid.Seq >= greaterEqual.Seq {
-			next = idx * 2
-		} else {
-			next = idx*2 + 1
-		}
-		if next >= len && h[idx].Seq.Seq > greaterEqual.Seq && (wrapped || h[idx].Seq.Seq <= lessEqual.Seq) {
-			return h[idx], idx
-		}
-		idx = next
+	idx := heapMinRange(h, 0, func(idx int) int {
+		return seqInRange(h[idx].Seq, greaterEqual, lessEqual)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-
-	// can't find any packets with greater value, wrap around
-	if wrapped {
-		idx = 0
-		for {
-			next := idx * 2
-			if next >= len && h[idx].Seq.Seq <= lessEqual.Seq {
-				return h[idx], idx
-			}
-			idx = next
-		}
-	}
-	return nil, -1
+	return h[idx], idx
 }
 
-// Remove does a binary search of the heap for the specified packetID, which is removed
+// Remove does a search of the heap for the specified packetID, which is removed
 func (h *dataPacketHeap) Remove(packetID packet.PacketID) bool {
-	len := len(*h)
-	idx := 0
-	for idx < len {
-		pid := (*h)[idx].Seq
-		if pid.Seq == packetID.Seq {
-			heap.Remove(h, idx)
-			return true
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	if _, idx := h.Find(packetID); idx >= 0 {
+		heap.Remove(h, idx)
+		return true
 	}
 	return false
 }
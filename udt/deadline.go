@@ -0,0 +1,65 @@
+package udt
+
+import (
+	"sync"
+	"time"
+)
+
+// deadline tracks the Read or Write deadline of a socket.  The caller's deadline is converted into a time on our
+// monotonic clock when it's set, so later steps of the wall clock won't move it
+type deadline struct {
+	prot   sync.Mutex    // lock must be held before referencing any other members
+	timer  Timer         // fires when the deadline passes
+	gen    uint          // incremented each time the deadline is moved, so a stale timer can't expire a new deadline
+	passed chan struct{} // closed once the deadline has passed
+}
+
+func newDeadline() *deadline {
+	return &deadline{passed: make(chan struct{})}
+}
+
+// set moves the deadline to t, a zero value meaning there is no deadline
+func (d *deadline) set(clock Clock, t time.Time) {
+	var wait time.Duration
+	if !t.IsZero() {
+		// if the caller didn't get t from time.Now (so it carries no monotonic reading) this is where it's compared
+		// against the wall clock, after which only the monotonic clock is used
+		wait = t.Sub(clock.Now())
+	}
+
+	d.prot.Lock()
+	defer d.prot.Unlock()
+	d.gen++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	select {
+	case <-d.passed:
+		d.passed = make(chan struct{})
+	default:
+	}
+
+	switch {
+	case t.IsZero():
+	case wait <= 0:
+		close(d.passed)
+	default:
+		gen := d.gen
+		d.timer = clock.AfterFunc(wait, func() {
+			d.prot.Lock()
+			if d.gen == gen {
+				close(d.passed)
+			}
+			d.prot.Unlock()
+		})
+	}
+}
+
+// wait returns a channel that is closed once the current deadline has passed
+func (d *deadline) wait() <-chan struct{} {
+	d.prot.Lock()
+	passed := d.passed
+	d.prot.Unlock()
+	return passed
+}
@@ -0,0 +1,92 @@
+package udt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func deadlinePassed(d *deadline) bool {
+	select {
+	case <-d.wait():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	d := newDeadline()
+	if deadlinePassed(d) {
+		t.Fatal("expected no deadline to begin with")
+	}
+
+	d.set(defaultClock, time.Now().Add(-time.Second))
+	if !deadlinePassed(d) {
+		t.Error("expected a deadline in the past to have passed")
+	}
+
+	// moving the deadline (repeatedly, before it fires) resets it
+	for i := 0; i < 3; i++ {
+		d.set(defaultClock, time.Now().Add(time.Hour))
+	}
+	if deadlinePassed(d) {
+		t.Error("expected a deadline in the future to be pending")
+	}
+
+	d.set(defaultClock, time.Now().Add(20*time.Millisecond))
+	select {
+	case <-d.wait():
+	case <-time.After(time.Second):
+		t.Fatal("deadline never passed")
+	}
+
+	d.set(defaultClock, time.Time{})
+	if deadlinePassed(d) {
+		t.Error("expected clearing the deadline to reset it")
+	}
+}
+
+func TestDeadlineWallClock(t *testing.T) {
+	// a deadline without a monotonic reading (e.g. one built from a calendar time) is measured on the wall clock when
+	// it's set, and on the monotonic clock after that
+	d := newDeadline()
+	start := time.Now()
+	d.set(defaultClock, start.Add(50*time.Millisecond).Round(0))
+	select {
+	case <-d.wait():
+		if waited := time.Since(start); waited < 40*time.Millisecond {
+			t.Errorf("deadline passed early, after %v", waited)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deadline never passed")
+	}
+}
+
+func TestReadWriteContext(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	ac, bc := a.(Conn), b.(Conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	buf := make([]byte, 16)
+	if _, err := ac.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("expected the read to give up with the context, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bc.WriteContext(cancelled, []byte("dropped")); err != context.Canceled {
+		t.Errorf("expected a write with a cancelled context to fail, got %v", err)
+	}
+
+	// the connection carries on as usual afterwards
+	if _, err := bc.WriteContext(context.Background(), []byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	if n, err := ac.ReadContext(context.Background(), buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,139 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// SeqRange is an inclusive range of packet sequence numbers
+type SeqRange struct {
+	First uint32
+	Last  uint32
+}
+
+func (r SeqRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%d", r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// DebugInfo is a snapshot of the packets a connection is tracking, for diagnosing transfers that have stalled.  The
+// sequence numbers of each list are collapsed into ranges, in sequence order
+type DebugInfo struct {
+	// sender side
+	NextSendSeq    uint32     // sequence number of the next new data packet we'll send
+	LastAckSeq     uint32     // sequence number our peer has acknowledged receiving everything before
+	FlightSize     uint       // number of packets sent but not yet acknowledged
+	FlowWindow     uint       // number of unacknowledged packets our peer will accept
+	CongWindow     uint       // number of unacknowledged packets congestion control permits
+	Unacknowledged []SeqRange // packets sent but not yet acknowledged
+	SendLoss       []SeqRange // packets our peer has reported lost, waiting to be retransmitted
+
+	// receiver side
+	NextRecvSeq  uint32     // sequence number of the next new data packet we're expecting
+	RecvLoss     []SeqRange // packets we've found to be missing, waiting for our peer to retransmit them
+	Reorder      []SeqRange // packets received but held until they can be delivered in order (or with their message)
+	ReorderBytes uint64     // payload bytes held in the reorder buffer
+}
+
+// debugRequest asks one of a socket's event loops to fill in its side of a DebugInfo, closing done once it has
+type debugRequest struct {
+	info *DebugInfo
+	done chan struct{}
+}
+
+// Debug returns a snapshot of the packets this connection is tracking, for diagnosing transfers that have stalled
+func (s *udtSocket) Debug() (DebugInfo, error) {
+	var info DebugInfo
+	if s.send == nil || s.recv == nil {
+		return info, errors.New("Connection not established")
+	}
+	if !s.requestDebug(s.sendDebug, &info, nil) || !s.requestDebug(s.recvDebug, &info, s.recvLoop) {
+		return info, errors.New("Connection closed")
+	}
+	return info, nil
+}
+
+// requestDebug asks the event loop reading from the specified channel for its side of a DebugInfo, returning false if
+// it has shut down
+func (s *udtSocket) requestDebug(ch chan<- debugRequest, info *DebugInfo, loop *eventLoop) bool {
+	req := debugRequest{info: info, done: make(chan struct{})}
+	select {
+	case ch <- req:
+	case <-s.sockShutdown:
+		return false
+	case <-s.sockClosed:
+		return false
+	}
+	loop.wake()
+	select {
+	case <-req.done:
+		return true
+	case <-s.sockShutdown:
+		return false
+	case <-s.sockClosed:
+		return false
+	}
+}
+
+// debug fills in the sender's side of a DebugInfo
+func (s *udtSocketSend) debug(info *DebugInfo) {
+	info.NextSendSeq = s.sendPktSeq.Seq
+	info.LastAckSeq = s.recvAckSeq.Seq
+	info.FlightSize = uint(len(s.sendPktPend))
+	info.FlowWindow = s.flowWindowSize
+	info.CongWindow = uint(s.congestWindow.get())
+
+	ids := make([]packet.PacketID, 0, len(s.sendPktPend))
+	for _, p := range s.sendPktPend {
+		ids = append(ids, p.pkt.Seq)
+	}
+	info.Unacknowledged = seqRanges(ids)
+	info.SendLoss = seqRanges(append([]packet.PacketID(nil), s.sendLossList...))
+}
+
+// debug fills in the receiver's side of a DebugInfo
+func (s *udtSocketRecv) debug(info *DebugInfo) {
+	info.NextRecvSeq = s.farNextPktSeq.Seq
+
+	ids := make([]packet.PacketID, 0, len(s.recvLossList))
+	for _, entry := range s.recvLossList {
+		ids = append(ids, entry.packetID)
+	}
+	info.RecvLoss = seqRanges(ids)
+
+	ids = make([]packet.PacketID, 0, len(s.recvPktPend))
+	for _, p := range s.recvPktPend {
+		ids = append(ids, p.Seq)
+	}
+	info.Reorder = seqRanges(ids)
+	info.ReorderBytes = s.recvPendBytes.get()
+}
+
+// seqRanges sorts a list of sequence numbers and collapses them into ranges
+func seqRanges(ids []packet.PacketID) []SeqRange {
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Cmp(ids[j]) < 0
+	})
+	var result []SeqRange
+	curr := SeqRange{First: ids[0].Seq, Last: ids[0].Seq}
+	for _, id := range ids[1:] {
+		if id.Seq == curr.Last {
+			continue // duplicate
+		}
+		if id == (packet.PacketID{Seq: curr.Last}).Add(1) {
+			curr.Last = id.Seq
+			continue
+		}
+		result = append(result, curr)
+		curr = SeqRange{First: id.Seq, Last: id.Seq}
+	}
+	return append(result, curr)
+}
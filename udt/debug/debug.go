@@ -0,0 +1,97 @@
+/*
+Package debug serves a description of the UDT connections in a running process over HTTP, for diagnosing them in
+production.  It lists each local address in use along with its metrics and listeners, and each connection sharing it
+with its state, metrics and the current state of its congestion control (see udt.Inspect).
+
+Nothing is served until the host application mounts the handler wherever it keeps its debugging endpoints, such as
+alongside net/http/pprof:
+
+	http.Handle("/debug/udt/", debug.Handler())
+
+The listing is plain text, or JSON if requested with "?format=json" or an Accept header asking for application/json.
+As it exposes the addresses of every peer, it shouldn't be served anywhere the public can reach.
+*/
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+// Handler returns an http.Handler listing the UDT connections in this process
+func Handler() http.Handler {
+	return http.HandlerFunc(Index)
+}
+
+// Index responds with a listing of the UDT connections in this process
+func Index(w http.ResponseWriter, r *http.Request) {
+	muxes := udt.Inspect()
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(muxes)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	WriteText(w, muxes)
+}
+
+// wantsJSON returns true if a request asked for the listing as JSON
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// WriteText writes a human-readable listing of the specified addresses and their connections
+func WriteText(w io.Writer, muxes []udt.MuxInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if len(muxes) == 0 {
+		fmt.Fprintln(tw, "no UDT addresses in use")
+	}
+	for idx, mux := range muxes {
+		if idx > 0 {
+			fmt.Fprintln(tw)
+		}
+		st := mux.Stats
+		fmt.Fprintf(tw, "%s %s\tmtu=%d\tsockets=%d\tlisteners=%s\n", mux.Network, mux.LocalAddr, mux.MTU,
+			st.ActiveSockets, listenerNames(mux.Listeners))
+		fmt.Fprintf(tw, "  packets in=%d out=%d decodeErr=%d trailing=%d panic=%d unknownSock=%d wrongPeer=%d\n",
+			st.PktIn, st.PktOut, st.PktDecodeErr, st.PktTrailingErr, st.PktPanic, st.PktUnknownSock, st.PktWrongPeer)
+		fmt.Fprintf(tw, "  handshakes accepted=%d refused=%d dropped=%d resumed=%d rendezvous=%d memUsed=%d\n",
+			st.HandshakeAccepted, st.HandshakeRefused, st.HandshakeDrop, st.HandshakeResumed, st.RendezvousAttempts,
+			st.ByteMemUsed)
+		for _, sock := range mux.Sockets {
+			ss := sock.Stats
+			fmt.Fprintf(tw, "  %s\n", sock.Description)
+			fmt.Fprintf(tw, "    cc=%s\tperiod=%s\tcwnd=%d\trtt=%s\trttVar=%s\trecvRate=%d\tbandwidth=%d\n", sock.Congestion,
+				sock.SendPeriod, sock.CongWindow, ss.RTT, ss.RTTVar, ss.PktRecvRate, ss.EstBandwidth)
+			fmt.Fprintf(tw, "    sent=%d\tretrans=%d\tsndLoss=%d\trcvLoss=%d\tbytesSent=%d\tbytesRecv=%d\trecvWindow=%d\n",
+				ss.PktSent, ss.PktRetrans, ss.PktSndLoss, ss.PktRcvLoss, ss.ByteSent, ss.ByteRecv, ss.RecvWindow)
+			fmt.Fprintf(tw, "    caps=%s\tpeerCaps=%s\n", sock.Capabilities, sock.PeerCapabilities)
+		}
+	}
+	return tw.Flush()
+}
+
+// listenerNames describes the service names of an address's listeners
+func listenerNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(names))
+	for idx, name := range names {
+		quoted[idx] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,72 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+func TestHandler(t *testing.T) {
+	l, err := udt.ListenUDT("udp", "127.0.0.1:9114")
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 16))
+		}
+	}()
+	client, err := udt.DefaultConfig().Dial(context.Background(), "udp", "127.0.0.1:9115", l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("error fetching listing: %s", err.Error())
+	}
+	var text strings.Builder
+	_, err = io.Copy(&text, resp.Body)
+	resp.Body.Close()
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected text listing (%v): %s", err, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(text.String(), "udp 127.0.0.1:9114") || !strings.Contains(text.String(), "cc=*udt.NativeCongestionControl") {
+		t.Errorf("expected the listener's address and its connection in the listing:\n%s", text.String())
+	}
+
+	resp, err = http.Get(srv.URL + "?format=json")
+	if err != nil {
+		t.Fatalf("error fetching listing: %s", err.Error())
+	}
+	var muxes []struct {
+		LocalAddr string
+		Sockets   []struct{ State, RemoteAddr string }
+	}
+	err = json.NewDecoder(resp.Body).Decode(&muxes)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("error decoding listing: %s", err.Error())
+	}
+	var found bool
+	for _, mux := range muxes {
+		if mux.LocalAddr == l.Addr().String() {
+			found = len(mux.Sockets) == 1 && mux.Sockets[0].RemoteAddr == client.LocalAddr().String()
+		}
+	}
+	if !found {
+		t.Errorf("expected the listener's address and its connection in the listing: %+v", muxes)
+	}
+}
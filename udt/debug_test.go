@@ -0,0 +1,84 @@
+package udt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestSeqRanges(t *testing.T) {
+	ids := func(seqs ...uint32) []packet.PacketID {
+		result := make([]packet.PacketID, 0, len(seqs))
+		for _, seq := range seqs {
+			result = append(result, packet.PacketID{Seq: seq})
+		}
+		return result
+	}
+	tests := []struct {
+		ids    []packet.PacketID
+		expect []SeqRange
+	}{
+		{nil, nil},
+		{ids(5), []SeqRange{{5, 5}}},
+		{ids(7, 5, 6, 9, 6), []SeqRange{{5, 7}, {9, 9}}},
+		{ids(1, 0x7FFFFFFE, 0, 0x7FFFFFFF), []SeqRange{{0x7FFFFFFE, 1}}}, // across the wraparound
+	}
+	for _, test := range tests {
+		if ranges := seqRanges(test.ids); !reflect.DeepEqual(ranges, test.expect) {
+			t.Errorf("expected %v, got %v", test.expect, ranges)
+		}
+	}
+}
+
+func TestDebugSender(t *testing.T) {
+	ss, _ := newTestSender(DefaultConfig())
+	for i := uint32(1); i <= 4; i++ {
+		sendTestMessage(ss, i, 0)
+	}
+	reportLost(ss, packet.PacketID{Seq: 2})
+
+	var info DebugInfo
+	ss.debug(&info)
+	if info.FlightSize != 4 || info.NextSendSeq != 4 {
+		t.Errorf("expected 4 packets in flight and packet 4 to be sent next, got %d and %d", info.FlightSize,
+			info.NextSendSeq)
+	}
+	if !reflect.DeepEqual(info.Unacknowledged, []SeqRange{{0, 3}}) {
+		t.Errorf("expected packets 0-3 to be unacknowledged, got %v", info.Unacknowledged)
+	}
+	if !reflect.DeepEqual(info.SendLoss, []SeqRange{{2, 2}}) {
+		t.Errorf("expected packet 2 to be waiting for retransmission, got %v", info.SendLoss)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	config := DefaultConfig()
+	config.EventLoop = true // so the receiving side has to be woken to answer
+	serv, client, server := connectWithClock(t, 78, defaultClock, config)
+	defer serv.Close()
+	defer server.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	buf := make([]byte, 5)
+	if _, err := server.Read(buf); err != nil {
+		t.Fatalf("error calling Read: %s", err.Error())
+	}
+	info, err := client.Debug()
+	if err != nil {
+		t.Fatalf("error calling Debug: %s", err.Error())
+	}
+	if info.FlowWindow == 0 || info.CongWindow == 0 {
+		t.Errorf("expected the windows to be reported, got %+v", info)
+	}
+	if len(info.RecvLoss) != 0 || len(info.Reorder) != 0 {
+		t.Errorf("expected nothing to be held by the receiver, got %+v", info)
+	}
+
+	client.Close()
+	if _, err := client.Debug(); err == nil {
+		t.Error("expected an error from a closed connection")
+	}
+}
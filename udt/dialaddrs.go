@@ -0,0 +1,117 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+/*
+DialAddrs connects to whichever of several candidate addresses for the same peer answers first, in the style of
+"happy eyeballs" (RFC 8305).  Attempts are started in the order given, each one dialAttemptDelay after the one before
+(or as soon as the one before fails), and all of them share a single local address.  The first to complete its
+handshake is returned, and the rest are abandoned.
+*/
+
+const dialAttemptDelay = 250 * time.Millisecond // time to give a connection attempt before starting the next one
+
+// errDialAbandoned is the reason given to connection attempts abandoned by DialAddrs
+var errDialAbandoned = errors.New("Connection attempt abandoned")
+
+// DialAddrs establishes an outbound UDT connection to the first of the candidate remote addresses raddrs to answer,
+// using the supplied net and laddr.  See function net.DialUDP for a description of net and laddr.
+func DialAddrs(ctx context.Context, network string, laddr string, raddrs []string, isStream bool) (net.Conn, error) {
+	return dialAddrs(ctx, DefaultConfig(), network, laddr, raddrs, isStream)
+}
+
+// DialAddrs establishes an outbound UDT connection to the first of the candidate remote addresses raddrs to answer,
+// using the supplied net and laddr.  See function net.DialUDP for a description of net and laddr.
+func (c *Config) DialAddrs(ctx context.Context, network string, laddr string, raddrs []string, isStream bool) (net.Conn, error) {
+	return dialAddrs(ctx, c, network, laddr, raddrs, isStream)
+}
+
+type dialResult struct {
+	s   *udtSocket
+	err error
+}
+
+func dialAddrs(ctx context.Context, config *Config, network string, laddr string, raddrs []string, isStream bool) (net.Conn, error) {
+	if len(raddrs) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("No addresses to dial")}
+	}
+	m, err := multiplexerFor(ctx, config, network, laddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	defer m.release()
+
+	clock := configClock(config)
+	results := make(chan dialResult, len(raddrs))
+	var attempts []*udtSocket
+	var firstErr error
+	next := 0
+	pending := 0
+	var nextAttempt <-chan time.Time
+	for {
+		// start the next attempt if it's time (or the previous ones have all failed)
+		if next < len(raddrs) && nextAttempt == nil {
+			raddr, err := net.ResolveUDPAddr(network, raddrs[next])
+			next++
+			if err == nil {
+				var s *udtSocket
+				if s, err = m.newSocket(config, raddr, 0, false, !isStream); err == nil {
+					attempts = append(attempts, s)
+					pending++
+					go func() {
+						results <- dialResult{s: s, err: s.startConnect()}
+					}()
+					nextAttempt = clock.After(dialAttemptDelay)
+					continue
+				}
+			}
+			if firstErr == nil {
+				firstErr = &net.OpError{Op: "dial", Net: network, Err: err}
+			}
+			continue
+		}
+		if pending == 0 {
+			return nil, firstErr
+		}
+
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				abandonDials(attempts, result.s, results, pending)
+				return result.s, nil
+			}
+			if firstErr == nil {
+				firstErr = &net.OpError{Op: "dial", Net: network, Addr: result.s.raddr, Err: result.err}
+			}
+			nextAttempt = nil // move on to the next candidate
+		case <-nextAttempt:
+			nextAttempt = nil
+		case <-ctx.Done():
+			abandonDials(attempts, nil, results, pending)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	}
+}
+
+// abandonDials stops the connection attempts other than the winning one, closing any that complete anyway
+func abandonDials(attempts []*udtSocket, winner *udtSocket, results <-chan dialResult, pending int) {
+	for _, s := range attempts {
+		if s == winner {
+			continue
+		}
+		s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: errDialAbandoned})
+	}
+	go func() {
+		for ; pending > 0; pending-- {
+			if result := <-results; result.err == nil {
+				result.s.Close()
+			}
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDialAddrs(t *testing.T) {
+	l, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+50))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 10))
+		}
+	}()
+
+	// the first candidate doesn't resolve and the second never answers, so we connect to the third
+	start := time.Now()
+	conn, err := DialAddrs(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+50), []string{
+		"no such address",
+		fmt.Sprintf("127.0.0.1:%d", serverPort+52),
+		fmt.Sprintf("127.0.0.1:%d", serverPort+50),
+	}, true)
+	if err != nil {
+		t.Fatalf("error calling DialAddrs: %s", err.Error())
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != l.Addr().String() {
+		t.Errorf("connected to %s instead of %s", conn.RemoteAddr(), l.Addr())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v to connect, we should have given up waiting on the unanswered address", elapsed)
+	}
+
+	// the abandoned attempt is cleaned up
+	m := conn.(*udtSocket).m
+	for deadline := time.Now().Add(time.Second); len(m.sockets.all()) > 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("abandoned connection attempt was never closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := DialAddrs(ctx, "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+52), []string{
+		fmt.Sprintf("127.0.0.1:%d", serverPort+52),
+	}, true); err == nil {
+		t.Error("expected the dial to be cancelled")
+	}
+}
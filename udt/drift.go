@@ -0,0 +1,107 @@
+package udt
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	driftSampleSpan = 1000                 // number of measurements averaged into each drift estimate (as SRT does)
+	driftMaxValue   = 5 * time.Millisecond // average drift beyond this is folded into the time base
+	timestampWrap   = int64(1) << 32       // peer timestamps are 32-bit microsecond counters, wrapping every ~71 minutes
+)
+
+// driftTracer follows the relationship between the timestamps our peer places in its packets and our own clock.  The
+// offset between the two is fixed by the first measurement, after which any change (the clocks running at slightly
+// different rates) is averaged over driftSampleSpan measurements.  When the average drift grows beyond driftMaxValue
+// it is folded into the time base, so peer timestamps can continue to be mapped onto our clock
+type driftTracer struct {
+	prot    sync.RWMutex  // lock must be held before referencing any other members
+	sampled bool          // whether we've taken any measurements
+	initial time.Duration // time base established by the first measurement
+	base    time.Duration // our elapsed time minus the peer's, used to map peer timestamps onto our clock
+	drift   time.Duration // average drift from base, as of the last complete span
+	sum     time.Duration // drift accumulated over the current span
+	count   int           // number of measurements in the current span
+	lastTs  uint32        // most recent peer timestamp measured
+	wraps   int64         // number of times the peer's timestamp has wrapped as of lastTs
+}
+
+func newDriftTracer() *driftTracer {
+	return &driftTracer{}
+}
+
+// unwrap converts a peer timestamp into the time since the peer created its socket, choosing the wrap closest to the
+// most recent timestamp measured.  d.prot must be held
+func (d *driftTracer) unwrap(ts uint32) int64 {
+	last := d.wraps*timestampWrap + int64(d.lastTs)
+	val := d.wraps*timestampWrap + int64(ts)
+	if val-last > timestampWrap/2 {
+		val -= timestampWrap
+	} else if last-val > timestampWrap/2 {
+		val += timestampWrap
+	}
+	return val
+}
+
+// sample takes a measurement from a packet our peer sent at timestamp ts, which arrived at local (time since our
+// socket was created).  rtt is the roundtrip time measured at that point, half of which is assumed to be transit time
+func (d *driftTracer) sample(ts uint32, local time.Duration, rtt time.Duration) {
+	d.prot.Lock()
+	defer d.prot.Unlock()
+
+	peer := d.unwrap(ts)
+	if !d.sampled || peer > d.wraps*timestampWrap+int64(d.lastTs) {
+		d.wraps = peer / timestampWrap
+		d.lastTs = uint32(peer % timestampWrap)
+	}
+	offset := local - time.Duration(peer)*time.Microsecond - rtt/2
+
+	if !d.sampled {
+		d.sampled = true
+		d.initial = offset
+		d.base = offset
+		return
+	}
+
+	d.sum += offset - d.base
+	d.count++
+	if d.count < driftSampleSpan {
+		return
+	}
+	d.drift = d.sum / time.Duration(d.count)
+	d.sum = 0
+	d.count = 0
+	if d.drift > driftMaxValue || d.drift < -driftMaxValue {
+		d.base += d.drift
+		d.drift = 0
+	}
+}
+
+// toLocal maps a peer timestamp onto our clock (as time since our socket was created), returning false if we haven't
+// taken any measurements to base this on
+func (d *driftTracer) toLocal(ts uint32) (time.Duration, bool) {
+	d.prot.RLock()
+	defer d.prot.RUnlock()
+	if !d.sampled {
+		return 0, false
+	}
+	return time.Duration(d.unwrap(ts))*time.Microsecond + d.base + d.drift, true
+}
+
+// get returns the total drift between the peer's clock and ours since the first measurement
+func (d *driftTracer) get() time.Duration {
+	d.prot.RLock()
+	defer d.prot.RUnlock()
+	return d.base - d.initial + d.drift
+}
+
+// peerTime converts a timestamp from one of our peer's packets into when (on our clock) it was sent, returning false if
+// there haven't yet been enough ACK/ACK2 exchanges to relate the two clocks
+func (s *udtSocket) peerTime(ts uint32) (time.Time, bool) {
+	local, ok := s.drift.toLocal(ts)
+	if !ok {
+		return time.Time{}, false
+	}
+	return s.created.Add(local), true
+}
@@ -0,0 +1,73 @@
+package udt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDriftTracking(t *testing.T) {
+	d := newDriftTracer()
+	if _, ok := d.toLocal(0); ok {
+		t.Error("expected no mapping before any measurements")
+	}
+
+	// the peer created its socket 2s before we did, and its clock runs 100ppm slow
+	const rtt = 20 * time.Millisecond
+	peerStart := 2 * time.Second
+	var local time.Duration
+	for i := 0; i <= 3*driftSampleSpan; i++ {
+		local = time.Duration(i) * 10 * time.Millisecond
+		sent := local - rtt/2
+		peer := peerStart + sent - sent/10000
+		d.sample(uint32(peer/time.Microsecond), local, rtt)
+	}
+
+	// 30s at 100ppm is 3ms of drift, which should be reflected (within the span we're averaging over)
+	drift := d.get()
+	if drift < 2*time.Millisecond || drift > 3*time.Millisecond {
+		t.Errorf("expected about 2-3ms of drift, got %v", drift)
+	}
+
+	// timestamps map back onto our clock
+	sent := local - rtt/2
+	mapped, ok := d.toLocal(uint32((peerStart + sent - sent/10000) / time.Microsecond))
+	if !ok {
+		t.Fatal("expected a mapping after measurements")
+	}
+	if diff := mapped - sent; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Errorf("expected a peer timestamp to map to %v, got %v", sent, mapped)
+	}
+}
+
+func TestDriftCorrection(t *testing.T) {
+	d := newDriftTracer()
+	d.sample(1000000, time.Second, 0)
+
+	// the peer's clock jumps back by 10ms, more than we'll carry as drift
+	for i := 1; i <= driftSampleSpan; i++ {
+		d.sample(uint32(1000000+i*1000-10000), time.Second+time.Duration(i)*time.Millisecond, 0)
+	}
+	if d.drift != 0 {
+		t.Errorf("expected the excess drift to be folded into the time base, %v remains", d.drift)
+	}
+	if drift := d.get(); drift != 10*time.Millisecond {
+		t.Errorf("expected a total drift of 10ms, got %v", drift)
+	}
+}
+
+func TestDriftTimestampWrap(t *testing.T) {
+	d := newDriftTracer()
+	nearWrap := uint32(timestampWrap - 1000)
+	d.sample(nearWrap, time.Hour, 0)
+	d.sample(500, time.Hour+1500*time.Microsecond, 0)
+	if d.wraps != 1 {
+		t.Errorf("expected the timestamp to have wrapped once, got %d", d.wraps)
+	}
+
+	// a straggler from before the wrap still maps to the right time
+	before, _ := d.toLocal(nearWrap)
+	after, _ := d.toLocal(500)
+	if after-before != 1500*time.Microsecond {
+		t.Errorf("expected timestamps across the wrap to be 1.5ms apart, got %v", after-before)
+	}
+}
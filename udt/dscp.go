@@ -0,0 +1,44 @@
+package udt
+
+import (
+	"log"
+	"net"
+)
+
+/*
+With Config.DSCP the packets sent from a local address are marked with a DiffServ code point, so networks that
+prioritize traffic by class (QoS) can tell them apart, such as AF41 (34) for interactive video.  The code point is
+carried in the upper six bits of the IPv4 TOS or IPv6 traffic class byte, alongside the ECN bits (see Config.ECN), and
+is set on the underlying UDP socket, so it applies to every connection sharing the local address.
+*/
+
+const maxDSCP = 63 // DiffServ code points are six bits wide
+
+// setDSCP marks the packets sent by this multiplexer with the specified DiffServ code point
+func (m *multiplexer) setDSCP(dscp uint8) {
+	if dscp > maxDSCP {
+		log.Printf("%s unable to set DSCP %d: code points are at most %d", m.laddr.String(), dscp, maxDSCP)
+		return
+	}
+	if m.dscp.get() == uint32(dscp) {
+		return
+	}
+	m.dscp.set(uint32(dscp))
+	m.applyTrafficClass()
+}
+
+// applyTrafficClass sets the IP TOS / traffic class byte of the packets sent by this multiplexer, from its DSCP and
+// whether ECN is enabled
+func (m *multiplexer) applyTrafficClass() {
+	uc, ok := m.conn.(*net.UDPConn)
+	if !ok {
+		return
+	}
+	tclass := byte(m.dscp.get()) << 2
+	if m.ecn.get() != 0 {
+		tclass |= ecnECT0
+	}
+	if err := setKernelTrafficClass(uc, m.laddr.IP.To4() == nil, tclass); err != nil {
+		log.Printf("%s unable to set the traffic class: %s", m.laddr.String(), err.Error())
+	}
+}
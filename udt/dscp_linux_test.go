@@ -0,0 +1,45 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestDSCP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error calling ListenUDP: %s", err.Error())
+	}
+	defer conn.Close()
+	m := &multiplexer{conn: conn, laddr: conn.LocalAddr().(*net.UDPAddr)}
+
+	tos := func() int {
+		var val int
+		rc, _ := conn.SyscallConn()
+		rc.Control(func(fd uintptr) {
+			val, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+		})
+		if err != nil {
+			t.Fatalf("error reading TOS: %s", err.Error())
+		}
+		return val
+	}
+
+	m.setDSCP(34) // AF41
+	if val := tos(); val != 34<<2 {
+		t.Errorf("expected a TOS of %#x, got %#x", 34<<2, val)
+	}
+
+	// enabling ECN keeps the code point
+	m.enableECN()
+	if val := tos(); val != 34<<2|int(ecnECT0) {
+		t.Errorf("expected a TOS of %#x, got %#x", 34<<2|int(ecnECT0), val)
+	}
+
+	// code points are only six bits
+	m.setDSCP(64)
+	if val := tos(); val>>2 != 34 {
+		t.Errorf("invalid code point changed the TOS to %#x", val)
+	}
+}
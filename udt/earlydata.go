@@ -0,0 +1,115 @@
+package udt
+
+import (
+	"context"
+	"net"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.ResumeWithData sends the first data of a resumed connection in the HsExtEarlyData extension of its handshakes, so
+that a listener skipping the syn cookie exchange (see resume.go) has the client's request in hand as soon as it accepts
+the connection, and a request/response exchange takes a single roundtrip.
+
+A listener only accepts early data from a handshake presenting one of its resumption tokens, or one proving it holds
+Config.PreSharedKey (in which case the proof covers the data too).  Anything else could come from anyone able to spoof
+the client's address, and as each token skips the cookie exchange only once, a captured handshake can't have its data
+delivered again: a repeat of the handshake that used a token is only ever answered by the connection it created, and
+ignored once that connection has been forgotten (see Config.ListenReplayWindow).  The accepted data is the first thing
+read from the accepted connection, and the listener's response handshake echoes an empty HsExtEarlyData to tell the
+client so.  If the listener didn't accept it (or it was too large to fit alongside the handshake), the client writes it
+to the connection once it's established instead, so it's delivered either way.
+*/
+
+// earlyDataReserve is the room left in a handshake for its fields and any other extensions when adding early data
+const earlyDataReserve = udtHeaderSize + 48 + 256
+
+// ResumeWithData resumes a connection as Resume does, sending data as the first thing the listener reads from it.  If
+// the listener accepts the session's token, the data is carried in the handshake rather than waiting for it to finish
+func (c *Config) ResumeWithData(ctx context.Context, network string, laddr string, session *Session, data []byte) (net.Conn, error) {
+	m, err := multiplexerFor(ctx, c, network, laddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: session.Addr, Err: err}
+	}
+	defer m.release()
+	s, err := m.newSocket(c, session.Addr, 0, false, !session.IsStream)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: session.Addr, Err: err}
+	}
+	s.resume = session
+	if validPacketSize(session.MTU) && session.MTU < uint(s.mtu.get()) {
+		s.mtu.set(uint32(session.MTU))
+	}
+	s.seedSession(session.RTT, session.RTTVar, session.DeliveryRate, session.Bandwidth)
+	if len(data) <= s.earlyDataLimit() {
+		s.earlyData = data
+	}
+
+	stop := s.abortOnDone(ctx)
+	err = s.startConnect()
+	stop()
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: session.Addr, Err: err}
+	}
+	if len(data) > 0 && !s.earlyAccepted {
+		if _, err = s.WriteContext(ctx, data); err != nil {
+			s.Close()
+			return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: session.Addr, Err: err}
+		}
+	}
+	return s, nil
+}
+
+// earlyDataLimit returns the most early data we'll carry in a handshake
+func (s *udtSocket) earlyDataLimit() int {
+	limit := int(s.mtu.get()) - udp6HeaderSize - earlyDataReserve
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// earlyDataExtension returns the early data extension to add to a handshake we're sending, if any
+func (s *udtSocket) earlyDataExtension(reqType packet.HandshakeReqType) (packet.HandshakeExtension, bool) {
+	if s.isServer {
+		if !s.earlyAccepted || reqType != packet.HsResponse {
+			return packet.HandshakeExtension{}, false
+		}
+		return packet.HandshakeExtension{Type: packet.HsExtEarlyData}, true
+	}
+	if len(s.earlyData) == 0 || (reqType != packet.HsRequest && reqType != packet.HsResponse) {
+		return packet.HandshakeExtension{}, false
+	}
+	return packet.HandshakeExtension{Type: packet.HsExtEarlyData, Data: s.earlyData}, true
+}
+
+// acceptEarlyData takes the early data from the handshake of a connection we're accepting, which will be delivered
+// ahead of anything else once the connection is established
+func (s *udtSocket) acceptEarlyData(p *packet.HandshakePacket) {
+	if data, ok := p.Extension(packet.HsExtEarlyData); ok && len(data) > 0 {
+		s.earlyData = append([]byte{}, data...)
+		s.earlyAccepted = true
+	}
+}
+
+// deliverEarlyData queues the early data we accepted to be read, before our receiving side has started
+func (s *udtSocket) deliverEarlyData() {
+	if !s.isServer || !s.earlyAccepted {
+		return
+	}
+	s.messageIn <- recvMessage{content: s.earlyData}
+	s.byteRecv.add(uint64(len(s.earlyData)))
+	s.earlyData = nil
+}
+
+// readEarlyDataAck notes whether the listener accepted the early data we sent, from its response handshake
+func (s *udtSocket) readEarlyDataAck(p *packet.HandshakePacket) {
+	if len(s.earlyData) == 0 {
+		return
+	}
+	if _, ok := p.Extension(packet.HsExtEarlyData); ok {
+		s.earlyAccepted = true
+		s.byteSent.add(uint64(len(s.earlyData)))
+	}
+}
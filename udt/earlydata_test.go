@@ -0,0 +1,142 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestResumeWithData(t *testing.T) {
+	config := DefaultConfig()
+	config.ResumptionLifetime = time.Hour
+	l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+107))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+
+	accepted := acceptOne(l)
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+108), l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	session, err := client.(Conn).Session()
+	if err != nil {
+		t.Fatalf("error getting session: %s", err.Error())
+	}
+	client.Close()
+	server.Close()
+
+	// the request arrives with the handshake, and is the first thing read from the accepted connection
+	accepted = acceptOne(l)
+	client, err = DefaultConfig().ResumeWithData(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+109),
+		session, []byte("request"))
+	if err != nil {
+		t.Fatalf("error resuming: %s", err.Error())
+	}
+	defer client.Close()
+	server = <-accepted
+	defer server.Close()
+	if !client.(*udtSocket).earlyAccepted {
+		t.Error("expected the listener to accept the early data")
+	}
+	buf := make([]byte, 16)
+	n, err := server.Read(buf)
+	if err != nil || string(buf[:n]) != "request" {
+		t.Fatalf("expected to read the early data, got %q (%v)", buf[:n], err)
+	}
+	echoOnce(t, client, server, "more")
+	echoOnce(t, server, client, "response")
+}
+
+func TestResumeWithDataRefused(t *testing.T) {
+	// a listener not issuing tokens ignores the early data, so it's written once the connection is established
+	l, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+110))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	session := &Session{Addr: &l.Addr().(*UDTAddr).UDPAddr, IsStream: true, Token: make([]byte, resumeTokenSize)}
+
+	accepted := acceptOne(l)
+	client, err := DefaultConfig().ResumeWithData(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+111),
+		session, []byte("request"))
+	if err != nil {
+		t.Fatalf("error resuming: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+	if client.(*udtSocket).earlyAccepted {
+		t.Error("expected the listener not to accept the early data")
+	}
+	if _, err := client.Write([]byte(" more")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, len("request more"))
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "request more" {
+		t.Fatalf("expected to read the request followed by what was written after it, got %q (%v)", buf, err)
+	}
+}
+
+func TestEarlyDataReplay(t *testing.T) {
+	clock := newManualClock()
+	config := DefaultConfig()
+	config.Clock = clock
+	config.ResumptionLifetime = time.Hour
+	a, _ := newPipeConns()
+	mx, err := NewMultiplexerWithConn(a, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer mx.Close()
+	nl, err := mx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer nl.Close()
+	l := nl.(*listener)
+
+	// a resumed handshake carrying early data, as an attacker might capture it
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4000}
+	token := l.resumption.issue(packet.TypeSTREAM, clock.Now())
+	hs := &packet.HandshakePacket{UdtVer: 4, SockType: packet.TypeSTREAM, InitPktSeq: packet.PacketID{Seq: 100},
+		MaxPktSize: 1500, MaxFlowWinSize: 8192, ReqType: packet.HsRequest, SockID: 1234, SockAddr: from.IP,
+		Extensions: []packet.HandshakeExtension{
+			{Type: packet.HsExtResume, Data: append(token, make([]byte, resumeHintSize)...)},
+			{Type: packet.HsExtEarlyData, Data: []byte("request")},
+		}}
+	if !l.readHandshake(l.m, hs, from) {
+		t.Fatal("expected the resumed handshake to be accepted")
+	}
+	server := <-l.accept
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "request" {
+		t.Fatalf("expected to read the early data, got %q (%v)", buf[:n], err)
+	}
+
+	// a repeat is answered by the connection it created
+	if !l.readHandshake(l.m, hs, from) {
+		t.Error("expected a repeated handshake to be answered")
+	}
+	if len(l.accept) != 0 {
+		t.Fatal("a repeated handshake created another connection")
+	}
+
+	// and once that connection has closed and the listener has forgotten it, the token is still live but the handshake
+	// is ignored
+	server.CloseWithError(CloseNormal, "")
+	clock.advance(config.ListenReplayWindow + time.Minute)
+	if l.readHandshake(l.m, hs, from) {
+		t.Error("expected a replayed handshake to be ignored")
+	}
+	if len(l.accept) != 0 {
+		t.Error("a replayed handshake created another connection, delivering its early data again")
+	}
+}
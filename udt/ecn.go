@@ -0,0 +1,76 @@
+package udt
+
+import (
+	"log"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+With Config.ECN the packets we send are marked as ECN-capable (ECT(0)), asking routers with active queue management to
+mark them as having experienced congestion (CE) rather than dropping them.  The receiver reads the marks the network
+left on arriving data packets and reports them back to the sender in an ECN echo control packet, at most once per ACK
+period, carrying the ID of the latest marked packet.  The sender passes this to its congestion control as though that
+packet had been reported lost (through OnNAK), but doesn't retransmit anything, as nothing was actually lost.
+
+This requires both ends to have ECN enabled, and is only supported on Linux.
+*/
+
+const (
+	ecnMsgType uint16 = 0x4345 // user-defined control packet message type of an ECN echo ("CE")
+
+	ecnNotECT byte = 0x00 // not ECN-capable
+	ecnECT0   byte = 0x02 // ECN-capable transport, codepoint 0
+	ecnCE     byte = 0x03 // congestion experienced
+	ecnMask   byte = 0x03 // the ECN bits of the IP TOS / traffic class byte
+)
+
+// enableECN marks the packets sent by this multiplexer as ECN-capable and starts reading the marks on those we
+// receive, if it hasn't been done already
+func (m *multiplexer) enableECN() {
+	if m.ecn.get() != 0 {
+		return
+	}
+	conns := m.udpReaders()
+	if len(conns) == 0 {
+		return
+	}
+	for _, uc := range conns {
+		if err := enableKernelECN(uc, m.laddr.IP.To4() == nil); err != nil {
+			log.Printf("%s unable to enable ECN: %s", m.laddr.String(), err.Error())
+			return
+		}
+	}
+	m.ecn.set(1)
+	m.applyTrafficClass()
+}
+
+// noteCongestionMark is called by the multiplexer read loop when a data packet arrives with a congestion mark,
+// reporting it to our peer unless we've already done so within the last ACK period
+func (s *udtSocket) noteCongestionMark(p *packet.DataPacket) {
+	s.ecnMarks.add(1)
+	if s.recv == nil {
+		return // not connected yet
+	}
+	now := s.clock.Now().Sub(s.created)
+	if last := s.ecnEcho.get(); last != 0 && now-last < s.recv.ackTimerPeriod() {
+		return
+	}
+	s.ecnEcho.set(now)
+
+	data := make([]byte, 4)
+	endianness.PutUint32(data, p.Seq.Seq)
+	select {
+	case s.sendFeedback <- &packet.UserDefControlPacket{MsgType: ecnMsgType, Data: data}:
+	default:
+		// the echo is only advisory, we'll send another on the next mark
+	}
+}
+
+// readECNEcho passes a congestion mark reported by our peer on to congestion control, as if the packet had been lost
+func (s *udtSocket) readECNEcho(data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	s.cong.onNAK([]packet.PacketID{{Seq: endianness.Uint32(data)}})
+}
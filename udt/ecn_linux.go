@@ -0,0 +1,49 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const ecnOOBSize = 32 // room for a single IP_TOS or IPV6_TCLASS control message
+
+// enableKernelECN asks the kernel to report the ECN bits of each datagram received on conn
+func enableKernelECN(conn *net.UDPConn, isIPv6 bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		if isIPv6 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVTCLASS, 1)
+			// a dual-stack socket may also be carrying IPv4 traffic, which has an option of its own
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// parseECN extracts the ECN bits of a received datagram from the control messages accompanying it
+func parseECN(oob []byte) (byte, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return ecnNotECT, false
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1:
+			return msg.Data[0] & ecnMask, true
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4:
+			// the traffic class is passed as an int, in host byte order
+			return byte(*(*int32)(unsafe.Pointer(&msg.Data[0]))) & ecnMask, true
+		}
+	}
+	return ecnNotECT, false
+}
@@ -0,0 +1,49 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestKernelECN(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error calling ListenUDP: %s", err.Error())
+	}
+	defer conn.Close()
+	m := &multiplexer{conn: conn, laddr: conn.LocalAddr().(*net.UDPAddr)}
+	if m.enableECN(); m.ecn.get() == 0 {
+		t.Fatal("unable to enable ECN")
+	}
+
+	// our own packets are marked as ECN-capable
+	buf := make([]byte, 16)
+	oob := make([]byte, ecnOOBSize)
+	if _, err = conn.WriteTo([]byte{1, 2, 3}, conn.LocalAddr()); err != nil {
+		t.Fatalf("error calling WriteTo: %s", err.Error())
+	}
+	if _, _, _, ecn, _, err := m.readFrom(m.conn, buf, oob); err != nil || ecn != ecnECT0 {
+		t.Errorf("expected an ECN-capable datagram, got ECN bits %d (%v)", ecn, err)
+	}
+
+	// and we see the marks left by the network (here faked by the sender)
+	marker, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("error calling DialUDP: %s", err.Error())
+	}
+	defer marker.Close()
+	rc, _ := marker.SyscallConn()
+	rc.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, int(ecnCE))
+	})
+	if err != nil {
+		t.Fatalf("unable to set TOS: %s", err.Error())
+	}
+	if _, err = marker.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	if _, _, _, ecn, _, err := m.readFrom(m.conn, buf, oob); err != nil || ecn != ecnCE {
+		t.Errorf("expected a congestion-marked datagram, got ECN bits %d (%v)", ecn, err)
+	}
+}
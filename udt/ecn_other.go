@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import (
+	"errors"
+	"net"
+)
+
+const ecnOOBSize = 0
+
+// enableKernelECN asks the kernel to report the ECN bits of each datagram received on conn
+func enableKernelECN(conn *net.UDPConn, isIPv6 bool) error {
+	return errors.New("ECN is not supported on this platform")
+}
+
+// parseECN extracts the ECN bits of a received datagram from the control messages accompanying it
+func parseECN(oob []byte) (byte, bool) {
+	return ecnNotECT, false
+}
@@ -0,0 +1,56 @@
+package udt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// nakRecordingCongestion is the native congestion control, also passing on every loss report it's given
+type nakRecordingCongestion struct {
+	NativeCongestionControl
+	naks chan []packet.PacketID
+}
+
+func (c *nakRecordingCongestion) OnNAK(parms CongestionControlParms, loss []packet.PacketID) {
+	c.NativeCongestionControl.OnNAK(parms, loss)
+	select {
+	case c.naks <- loss:
+	default:
+	}
+}
+
+func TestECNEcho(t *testing.T) {
+	naks := make(chan []packet.PacketID, 10)
+	config := DefaultConfig()
+	config.ECN = true
+	config.CongestionForSocket = func(ctx CongestionContext) CongestionControl {
+		return &nakRecordingCongestion{naks: naks}
+	}
+	serv, client, server := connectWithClock(t, 70, defaultClock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	// the network marks two of the client's packets in quick succession, the first of which is passed back to the
+	// client's congestion control (as if it were lost)
+	server.noteCongestionMark(&packet.DataPacket{Seq: packet.PacketID{Seq: 1234}})
+	server.noteCongestionMark(&packet.DataPacket{Seq: packet.PacketID{Seq: 1235}})
+	select {
+	case loss := <-naks:
+		if len(loss) != 1 || loss[0].Seq != 1234 {
+			t.Errorf("expected congestion control to see packet 1234 marked, got %v", loss)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("congestion mark was never reported to the sender")
+	}
+	select {
+	case loss := <-naks:
+		t.Errorf("expected marks within an ACK period to be reported once, also got %v", loss)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if marks := server.Stats().PktRecvCE; marks != 2 {
+		t.Errorf("expected 2 congestion marks counted, got %d", marks)
+	}
+}
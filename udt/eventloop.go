@@ -0,0 +1,92 @@
+package udt
+
+import (
+	"time"
+)
+
+const (
+	loopRunning = iota // the loop has a goroutine running it
+	loopWoken          // the loop has a goroutine running it, and has been given something new to do
+	loopParked         // the loop has nothing to do, and no goroutine
+)
+
+// alwaysReady is a channel that can always be received from
+var alwaysReady = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+/*
+An eventLoop tracks one of a socket's event loops in event-loop mode (see Config.EventLoop).  Rather than waiting for
+something to do, a loop in this mode parks itself as soon as it runs out of events to process, releasing its goroutine.
+Anything giving the loop something new to do (including its timers, which are kept in a timerWheel on the multiplexer)
+wakes it afterwards, starting a new goroutine to run it if it had parked.
+
+A nil *eventLoop is a loop that always has a goroutine of its own, with timers from the socket's Clock.
+*/
+type eventLoop struct {
+	state atomicUint32 // loopRunning, loopWoken or loopParked
+	wheel *timerWheel  // where this loop's timers are kept
+	run   func()       // runs the loop until it parks (or exits). Set before the loop is first started
+
+	routines *routineGroup // where goroutines restarting the loop are started
+}
+
+func newEventLoop(wheel *timerWheel, routines *routineGroup) *eventLoop {
+	return &eventLoop{state: atomicUint32{val: loopRunning}, wheel: wheel, routines: routines}
+}
+
+// idle returns a channel the loop should include in its select, which (in event-loop mode) is ready whenever the loop
+// may have nothing else to do
+func (l *eventLoop) idle() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return alwaysReady
+}
+
+// park is called by a loop that has found nothing to do.  It returns true if the loop should return (having released
+// its goroutine), or false if it's been woken since and needs to look again
+func (l *eventLoop) park() bool {
+	if l.state.compareAndSwap(loopRunning, loopParked) {
+		return true
+	}
+	l.state.set(loopRunning)
+	return false
+}
+
+// wake is called after giving the loop something to do, restarting it if it had parked
+func (l *eventLoop) wake() {
+	if l == nil {
+		return
+	}
+	for {
+		switch l.state.get() {
+		case loopParked:
+			if l.state.compareAndSwap(loopParked, loopRunning) {
+				l.routines.goRun(l.run) // (once the socket is closed, there's no need)
+				return
+			}
+		case loopRunning:
+			if l.state.compareAndSwap(loopRunning, loopWoken) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// after returns a channel that receives the time after d, waking the loop when it does
+func (l *eventLoop) after(clock Clock, d time.Duration) <-chan time.Time {
+	if l == nil {
+		return clock.After(d)
+	}
+	c := make(chan time.Time, 1)
+	l.wheel.afterFunc(d, func(now time.Time) {
+		c <- now
+		l.wake()
+	})
+	return c
+}
@@ -0,0 +1,53 @@
+package udt
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEventLoop(t *testing.T) {
+	config := DefaultConfig()
+	config.EventLoop = true
+	serv, client, server := connectWithClock(t, 24, defaultClock, config)
+	defer serv.Close()
+	defer server.Close()
+
+	// once there's nothing to do, the receive side of the socket shouldn't need a goroutine of its own
+	parked := func() bool {
+		for i := 0; i < 100; i++ {
+			if client.recvLoop.state.get() == loopParked && client.congLoop.state.get() == loopParked {
+				return true
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+	if !parked() {
+		t.Error("event loops never parked")
+	}
+
+	msg := []byte("woken by the peer")
+	if _, err := server.Write(msg); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatalf("error calling Read: %s", err.Error())
+	}
+	if string(buf) != string(msg) {
+		t.Errorf("received %q, expected %q", buf, msg)
+	}
+	if !parked() {
+		t.Error("event loops never parked after receiving data")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("error calling Close: %s", err.Error())
+	}
+	select {
+	case <-server.sockShutdown:
+	case <-time.After(time.Second):
+		t.Error("peer never saw the connection close")
+	}
+}
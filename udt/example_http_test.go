@@ -0,0 +1,34 @@
+package udt_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+func ExampleNewHTTPTransport() {
+	// serve HTTP over UDT
+	l, err := udt.ListenUDT("udp", "127.0.0.1:9058")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer l.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+
+	// and make requests over UDT
+	client := &http.Client{Transport: udt.NewHTTPTransport(nil)}
+	resp, err := client.Get("http://127.0.0.1:9058/udt")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	fmt.Println(string(body))
+	// Output: hello from /udt
+}
@@ -0,0 +1,149 @@
+package udt
+
+import (
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Forward error correction (experimental, not part of the UDT specification)
+
+When both peers enable it, the sender groups consecutive new data packets into blocks and follows each block
+with a parity packet (sent as a UserDefControlPacket) containing the XOR of every packet in the block.  If the
+receiver is missing exactly one packet in a block, it can rebuild that packet from the parity without waiting
+for a NAK and retransmission.  Support is advertised with the HsExtFEC handshake extension.
+*/
+
+const (
+	fecMsgType    uint16 = 0x4643 // UserDefControlPacket message type used for FEC parity packets
+	fecHeaderSize        = 8      // packet count (2), length parity (2), message field parity (4)
+)
+
+// fecMsgField returns the raw message field of a data packet
+func fecMsgField(dp *packet.DataPacket) uint32 {
+	boundary, inOrder, msgID := dp.GetMessageData()
+	field := uint32(boundary)<<30 | msgID
+	if inOrder {
+		field |= 0x20000000
+	}
+	return field
+}
+
+// fecEncoder builds parity packets for the data packets we send
+type fecEncoder struct {
+	blockSize uint            // number of data packets covered by each parity packet
+	firstSeq  packet.PacketID // first packet in the current block
+	count     uint            // number of packets in the current block
+	lenParity uint16          // XOR of the payload lengths
+	msgParity uint32          // XOR of the message fields
+	data      []byte          // XOR of the payloads
+}
+
+func newFecEncoder(blockSize uint) *fecEncoder {
+	return &fecEncoder{blockSize: blockSize}
+}
+
+// add includes a newly-sent data packet in the current block, returning a parity packet if the block is complete
+func (e *fecEncoder) add(dp *packet.DataPacket) *packet.UserDefControlPacket {
+	if e.count == 0 {
+		e.firstSeq = dp.Seq
+		e.lenParity = 0
+		e.msgParity = 0
+		e.data = e.data[:0]
+	}
+	e.count++
+	e.lenParity ^= uint16(len(dp.Data))
+	e.msgParity ^= fecMsgField(dp)
+	for len(e.data) < len(dp.Data) {
+		e.data = append(e.data, 0)
+	}
+	for idx, b := range dp.Data {
+		e.data[idx] ^= b
+	}
+
+	if e.count < e.blockSize {
+		return nil
+	}
+
+	parity := make([]byte, fecHeaderSize+len(e.data))
+	endianness.PutUint16(parity[0:2], uint16(e.count))
+	endianness.PutUint16(parity[2:4], e.lenParity)
+	endianness.PutUint32(parity[4:8], e.msgParity)
+	copy(parity[fecHeaderSize:], e.data)
+	e.count = 0
+
+	return &packet.UserDefControlPacket{
+		MsgType:   fecMsgType,
+		AddtlInfo: e.firstSeq.Seq,
+		Data:      parity,
+	}
+}
+
+// fecDecoder remembers recently received data packets so that it can rebuild a lost one from a parity packet
+type fecDecoder struct {
+	history []*packet.DataPacket // recently received packets, indexed by sequence number modulo its length
+}
+
+func newFecDecoder(blockSize uint) *fecDecoder {
+	return &fecDecoder{history: make([]*packet.DataPacket, 2*blockSize)}
+}
+
+// add remembers a received data packet
+func (d *fecDecoder) add(dp *packet.DataPacket) {
+	d.history[dp.Seq.Seq%uint32(len(d.history))] = dp
+}
+
+func (d *fecDecoder) find(seq packet.PacketID) *packet.DataPacket {
+	dp := d.history[seq.Seq%uint32(len(d.history))]
+	if dp == nil || dp.Seq != seq {
+		return nil
+	}
+	return dp
+}
+
+// recover attempts to rebuild the one packet in this parity packet's block that we haven't received.  isMissing
+// is used to confirm that a packet we don't have is actually lost
+func (d *fecDecoder) recover(p *packet.UserDefControlPacket, isMissing func(packet.PacketID) bool) *packet.DataPacket {
+	if len(p.Data) < fecHeaderSize {
+		return nil
+	}
+	count := int(endianness.Uint16(p.Data[0:2]))
+	if count == 0 || count > len(d.history) {
+		return nil
+	}
+	pktLen := endianness.Uint16(p.Data[2:4])
+	msgField := endianness.Uint32(p.Data[4:8])
+	data := make([]byte, len(p.Data)-fecHeaderSize)
+	copy(data, p.Data[fecHeaderSize:])
+
+	var missing *packet.PacketID
+	seq := packet.PacketID{Seq: p.AddtlInfo}
+	for idx := 0; idx < count; idx++ {
+		if dp := d.find(seq); dp != nil {
+			if len(dp.Data) > len(data) {
+				return nil // parity doesn't cover this packet, something is wrong
+			}
+			pktLen ^= uint16(len(dp.Data))
+			msgField ^= fecMsgField(dp)
+			for i, b := range dp.Data {
+				data[i] ^= b
+			}
+		} else if missing != nil {
+			return nil // more than one packet lost, we can't help
+		} else {
+			thisSeq := seq
+			missing = &thisSeq
+		}
+		seq.Incr()
+	}
+	if missing == nil || !isMissing(*missing) || int(pktLen) > len(data) {
+		return nil
+	}
+
+	dp := &packet.DataPacket{
+		Seq:  *missing,
+		Data: data[:pktLen],
+	}
+	dp.SetMessageData(packet.MessageBoundary(msgField>>30), msgField&0x20000000 != 0, msgField&0x1FFFFFFF)
+	dp.SetHeader(p.DstSockID, p.SendTime())
+	return dp
+}
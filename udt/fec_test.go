@@ -0,0 +1,62 @@
+package udt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestFECRecover(t *testing.T) {
+	enc := newFecEncoder(4)
+	dec := newFecDecoder(4)
+
+	var sent []*packet.DataPacket
+	var parity *packet.UserDefControlPacket
+	for idx := 0; idx < 4; idx++ {
+		dp := &packet.DataPacket{
+			Seq:  packet.PacketID{Seq: 0x7FFFFFFE}.Add(int32(idx)),
+			Data: bytes.Repeat([]byte{byte(idx + 1)}, 10+idx*7),
+		}
+		dp.SetMessageData(packet.MbOnly, idx%2 == 0, uint32(100+idx))
+		sent = append(sent, dp)
+		if p := enc.add(dp); p != nil {
+			if idx != 3 {
+				t.Fatalf("parity packet generated after %d packets", idx+1)
+			}
+			parity = p
+		}
+	}
+	if parity == nil {
+		t.Fatal("no parity packet generated")
+	}
+
+	// lose the second packet
+	for idx, dp := range sent {
+		if idx != 1 {
+			dec.add(dp)
+		}
+	}
+	recovered := dec.recover(parity, func(packet.PacketID) bool { return true })
+	if recovered == nil {
+		t.Fatal("unable to recover lost packet")
+	}
+	if recovered.Seq != sent[1].Seq {
+		t.Errorf("recovered packet %d, expected %d", recovered.Seq.Seq, sent[1].Seq.Seq)
+	}
+	if !bytes.Equal(recovered.Data, sent[1].Data) {
+		t.Errorf("recovered data does not match: %v", recovered.Data)
+	}
+	boundary, inOrder, msgID := recovered.GetMessageData()
+	if boundary != packet.MbOnly || inOrder || msgID != 101 {
+		t.Errorf("recovered message data does not match: %d %t %d", boundary, inOrder, msgID)
+	}
+
+	// with two packets missing there's nothing we can do
+	dec = newFecDecoder(4)
+	dec.add(sent[0])
+	dec.add(sent[3])
+	if dec.recover(parity, func(packet.PacketID) bool { return true }) != nil {
+		t.Error("recovered a packet with two packets missing")
+	}
+}
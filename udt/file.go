@@ -0,0 +1,75 @@
+package udt
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+/*
+A server can be restarted (such as to upgrade its binary) without closing its UDP socket: the old process passes the
+socket returned by Listener.File to the new one (such as through exec.Cmd.ExtraFiles), which listens on it with
+ListenUDTFile.  Clients connecting while this happens don't notice, as handshakes that go unanswered are retried from
+the beginning, and any syn cookie the old process gave out is simply replaced by one from the new process.
+
+Connections that were already established stay with the old process, which can let them finish before exiting.  As
+both processes read from the same socket until then, each will occasionally receive (and discard) a packet meant for
+the other; these are recovered like any other lost packet.
+*/
+
+// ListenUDTFile listens for incoming UDT connections on an existing UDP socket, such as one inherited from a parent
+// process.  The socket is duplicated, so f may be closed once this returns
+func ListenUDTFile(f *os.File) (net.Listener, error) {
+	return listenUDTFile(DefaultConfig(), f)
+}
+
+// ListenFile listens for incoming UDT connections on an existing UDP socket, such as one inherited from a parent
+// process.  The socket is duplicated, so f may be closed once this returns
+func (c *Config) ListenFile(f *os.File) (net.Listener, error) {
+	return listenUDTFile(c, f)
+}
+
+func listenUDTFile(config *Config, f *os.File) (net.Listener, error) {
+	m, err := multiplexerForFile(f)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udp", Source: nil, Addr: nil, Err: err}
+	}
+	defer m.release()
+	return listenOn(m, config, "udp")
+}
+
+// multiplexerForFile creates a multiplexer for an existing UDP socket, failing if we already have one for its address.
+// The multiplexer is returned with a reference held for the caller, which must call release once it's done with it
+func multiplexerForFile(f *os.File) (*multiplexer, error) {
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		return nil, errors.New("Not a UDP socket")
+	}
+
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	m := newMultiplexer("udp", addr, conn)
+	multiplexersProt.Lock()
+	_, loaded := multiplexers.LoadOrStore(m.key(), m)
+	multiplexersProt.Unlock()
+	if loaded {
+		m.teardown()
+		return nil, errors.New("Address already in use by this process")
+	}
+	return m, nil
+}
+
+// File returns a copy of the UDP socket this listener is using, to be passed to another process (which listens on it
+// with ListenUDTFile).  Closing the returned file doesn't affect this listener, nor does closing this listener
+// affect the returned file
+func (l *listener) File() (*os.File, error) {
+	conn, ok := l.m.conn.(*net.UDPConn)
+	if !ok {
+		return nil, errors.New("Listener is not using a UDP socket")
+	}
+	return conn.File()
+}
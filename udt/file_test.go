@@ -0,0 +1,71 @@
+package udt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+// checkListening connects to a listener and exchanges a message, to show it's working
+func checkListening(t *testing.T, l net.Listener, clientAddr string) {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	client, err := DialUDT("udp", clientAddr, l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing to connection: %s", err.Error())
+	}
+	buf := make([]byte, 10)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("expected to read \"hello\", got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestListenFile(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: serverPort + 66})
+	if err != nil {
+		t.Fatalf("error calling ListenUDP: %s", err.Error())
+	}
+	f, err := conn.File()
+	conn.Close()
+	if err != nil {
+		t.Fatalf("error getting socket file: %s", err.Error())
+	}
+
+	l, err := ListenUDTFile(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("error calling ListenUDTFile: %s", err.Error())
+	}
+	checkListening(t, l, fmt.Sprintf("127.0.0.1:%d", clientPort+66))
+
+	// the socket can be handed over to another process, but not to a second listener in this one
+	handoff, err := l.(Listener).File()
+	if err != nil {
+		t.Fatalf("error getting listener file: %s", err.Error())
+	}
+	defer handoff.Close()
+	if l2, err := ListenUDTFile(handoff); err == nil {
+		l2.Close()
+		t.Error("expected an error listening on an address already in use by this process")
+	}
+	pc, err := net.FilePacketConn(handoff)
+	if err != nil {
+		t.Fatalf("error using listener file: %s", err.Error())
+	}
+	defer pc.Close()
+	if pc.LocalAddr().String() != l.Addr().String() {
+		t.Errorf("listener file is bound to %s, expected %s", pc.LocalAddr(), l.Addr())
+	}
+	l.Close()
+}
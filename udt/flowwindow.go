@@ -0,0 +1,43 @@
+package udt
+
+/*
+The flow window is the number of unacknowledged packets a receiver lets its peer have in flight, which limits a
+connection's throughput to the window's worth of packets each roundtrip.  Reaching full speed over a long, fast path
+calls for a window of at least the bandwidth-delay product, which Config.MaxFlowWinSize otherwise has to be set to by
+hand (and which holds that much buffer space on the path whether the connection needs it or not).
+
+With Config.FlowWindowAutoTune set, Config.MaxFlowWinSize is instead an upper limit.  The receiver starts by
+advertising a window of autoTuneInitialWindow packets, and each time it measures the rate packets are arriving (once
+per SYN, with the ACKs carrying link measurements) grows the window to twice the packets arriving per roundtrip, as TCP
+stacks autotune their receive buffers.  A connection limited by its window sees packets arrive at a window's worth per
+roundtrip, so its window doubles each time until something else (congestion or the sender) limits it first.  The
+window never shrinks, so a brief lull doesn't starve a connection that picks up again.
+*/
+
+const autoTuneInitialWindow = 32 // packets advertised before the window is first tuned (see Config.FlowWindowAutoTune)
+
+// initialRecvWindow returns the flow window we start advertising to our peer
+func initialRecvWindow(config *Config, maxFlowWinSize uint) uint {
+	if config.FlowWindowAutoTune && maxFlowWinSize > autoTuneInitialWindow {
+		return autoTuneInitialWindow
+	}
+	return maxFlowWinSize
+}
+
+// autoTuneWindow grows the flow window we advertise to what packets arriving at recvSpeed (in packets/sec) call for,
+// see Config.FlowWindowAutoTune
+func (s *udtSocketRecv) autoTuneWindow(recvSpeed uint) {
+	if !s.socket.Config.FlowWindowAutoTune || recvSpeed == 0 {
+		return
+	}
+	rtt, rttVar := s.socket.getRTT()
+	target := 2 * uint64(recvSpeed) * uint64(rtt+rttVar) / 1000000
+	window := uint64(s.socket.recvWindow.get())
+	if target <= window {
+		return
+	}
+	if max := uint64(s.socket.maxFlowWinSize); target > max {
+		target = max
+	}
+	s.socket.recvWindow.set(uint32(target))
+}
@@ -0,0 +1,38 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFlowWindowAutoTune(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxFlowWinSize = 4096
+	config.FlowWindowAutoTune = true
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if window := b.(Conn).Stats().RecvWindow; window != autoTuneInitialWindow {
+		t.Errorf("expected to start by advertising %d packets, got %d", autoTuneInitialWindow, window)
+	}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 512*1024)
+	go a.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(b, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+
+	// a window-limited transfer should have grown the window, but never past the limit
+	if window := b.(Conn).Stats().RecvWindow; window <= autoTuneInitialWindow || window > config.MaxFlowWinSize {
+		t.Errorf("expected the window to have grown from %d up to at most %d packets, got %d", autoTuneInitialWindow,
+			config.MaxFlowWinSize, window)
+	}
+	if window := a.(Conn).Stats().RecvWindow; window != autoTuneInitialWindow {
+		t.Errorf("expected the sending side's window to stay at %d packets, got %d", autoTuneInitialWindow, window)
+	}
+}
@@ -0,0 +1,62 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+/*
+gRPC can run over UDT without any changes to either side: a client passes Config.ContextDialer to grpc.WithContextDialer
+(along with the target's "host:port" as usual), and a server passes a listener from ListenUDT to grpc.Server.Serve.
+Everything gRPC needs from the connection (deadlines, Close unblocking pending calls, cancellation of a dial through its
+context) is part of the usual net.Conn and net.Listener behavior here.
+
+Transport credentials wrapping the connection (such as TLS) work as they would over TCP.  To run over UDT without
+any further security while still being able to see the UDT details of a connection from within a call (through
+peer.FromContext), a TransportCredentials implementation can call NewAuthInfo from both of its handshake methods:
+
+	func (udtCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+		info, err := udt.NewAuthInfo(conn)
+		return conn, info, err
+	}
+*/
+
+// AuthInfo describes the UDT connection underneath a gRPC transport.  It satisfies the AuthInfo interface of gRPC's
+// credentials package, so it can be returned from the handshake methods of a TransportCredentials implementation
+type AuthInfo struct {
+	LocalAddr    net.Addr // our end of the connection
+	RemoteAddr   net.Addr // our peer's end of the connection
+	SocketID     uint32   // our socket ID for this connection
+	PeerSocketID uint32   // our peer's socket ID for this connection
+}
+
+// AuthType identifies the kind of connection described, for logging and for telling it apart from other credentials
+func (AuthInfo) AuthType() string {
+	return "udt"
+}
+
+// NewAuthInfo returns the details of a connection made by this package.  gRPC requires a streaming connection, so
+// anything else (including a datagram connection) is refused
+func NewAuthInfo(conn net.Conn) (AuthInfo, error) {
+	s, ok := conn.(*udtSocket)
+	if !ok {
+		return AuthInfo{}, errors.New("Not a UDT connection")
+	}
+	if s.isDatagram {
+		return AuthInfo{}, errors.New("gRPC requires a UDT stream connection, not a datagram connection")
+	}
+	return AuthInfo{
+		LocalAddr:    s.LocalAddr(),
+		RemoteAddr:   s.RemoteAddr(),
+		SocketID:     s.sockID,
+		PeerSocketID: s.farSockID.get(),
+	}, nil
+}
+
+// ContextDialer establishes an outbound UDT stream connection to addr (a "host:port" string), from any local address.
+// This matches the signature expected by grpc.WithContextDialer; the dial is abandoned if ctx is cancelled or its
+// deadline passes before the connection is established
+func (c *Config) ContextDialer(ctx context.Context, addr string) (net.Conn, error) {
+	return c.DialContext(ctx, "udp", addr)
+}
@@ -0,0 +1,72 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGRPCShims(t *testing.T) {
+	l, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+60))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 10))
+			_, err = l.Accept() // blocks until the listener is closed
+		}
+		accepted <- err
+	}()
+
+	conn, err := DefaultConfig().ContextDialer(context.Background(), l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Fatalf("error calling ContextDialer: %s", err.Error())
+	}
+	info, err := NewAuthInfo(conn)
+	if err != nil {
+		t.Fatalf("error calling NewAuthInfo: %s", err.Error())
+	}
+	if info.AuthType() != "udt" || info.RemoteAddr.String() != l.Addr().String() || info.PeerSocketID == 0 {
+		t.Errorf("unexpected connection details %+v", info)
+	}
+	conn.Close()
+
+	// closing the listener unblocks Accept, and may be repeated
+	time.Sleep(50 * time.Millisecond)
+	if err := l.Close(); err != nil {
+		t.Errorf("error closing listener: %s", err.Error())
+	}
+	select {
+	case err := <-accepted:
+		if err == nil {
+			t.Error("expected Accept to fail once the listener was closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept is still blocked after the listener was closed")
+	}
+	if err := l.Close(); err == nil {
+		t.Error("expected an error closing the listener a second time")
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Error("expected Accept to fail on a closed listener")
+	}
+
+	// a dial to an address that never answers gives up at the deadline of its context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = DefaultConfig().ContextDialer(ctx, fmt.Sprintf("127.0.0.1:%d", serverPort+61))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the dial to exceed its deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v to give up on the dial", elapsed)
+	}
+}
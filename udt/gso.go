@@ -0,0 +1,161 @@
+package udt
+
+import (
+	"errors"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+With Config.GSO (on Linux) the send goroutine gathers the packets queued for the same peer into a single super-packet
+of equally-sized segments (only the last may be shorter), which the kernel (or the network card) splits back into
+individual datagrams with UDP_SEGMENT.  The receive side asks the kernel to coalesce packets arriving from the same
+peer with UDP_GRO, and splits them apart again before decoding.  Nothing changes on the wire, so the peer doesn't need
+to enable it.
+
+Packets are only gathered while they're waiting to be sent anyway, so this doesn't change pacing or rate limits; the
+savings come during bulk transfers, when the send queue is rarely empty.  If the kernel refuses a super-packet (such as
+when the network card can't checksum it), its packets are sent individually and segmentation is turned off.
+*/
+
+// enableGSO turns on UDP segmentation offload for this multiplexer, if it hasn't been done already
+func (m *multiplexer) enableGSO() {
+	if m.gso.get() != 0 {
+		return
+	}
+	conns := m.udpReaders()
+	if len(conns) == 0 {
+		return
+	}
+	for _, uc := range conns {
+		if err := enableKernelGSO(uc); err != nil {
+			log.Printf("%s unable to enable UDP segmentation offload: %s", m.laddr.String(), err.Error())
+			return
+		}
+	}
+	m.gso.set(1)
+}
+
+// gsoBatch gathers packets to the same destination into a single super-packet
+type gsoBatch struct {
+	buf     []byte          // the serialized packets, back to back
+	dest    *net.UDPAddr    // where the packets are going
+	segSize int             // the size of each packet (other than the last, which may be shorter)
+	pkts    []packetWrapper // the packets in this batch
+	lens    []int           // the size of each packet in this batch
+}
+
+func newGSOBatch(mtu uint) *gsoBatch {
+	return &gsoBatch{
+		buf:  make([]byte, maxGSOSize+int(mtu)),
+		pkts: make([]packetWrapper, 0, maxGSOSegments),
+		lens: make([]int, 0, maxGSOSegments),
+	}
+}
+
+// full returns true if no more packets can be added to this batch
+func (b *gsoBatch) full(mtu uint) bool {
+	n := len(b.pkts)
+	if n == 0 {
+		return false
+	}
+	return n >= maxGSOSegments || b.lens[n-1] < b.segSize || b.size()+int(mtu) > maxGSOSize
+}
+
+// size returns the number of bytes in this batch
+func (b *gsoBatch) size() int {
+	return len(b.pkts) * b.segSize
+}
+
+// addToBatch serializes a packet into a batch, first writing out what's already there if the packet can't join it.
+// Only errors from the connection itself are returned (the packet is added regardless)
+func (m *multiplexer) addToBatch(b *gsoBatch, pw packetWrapper) (err error) {
+	if len(b.pkts) > 0 && (b.full(m.mtu) || !pw.dest.IP.Equal(b.dest.IP) || pw.dest.Port != b.dest.Port) {
+		err = m.flushBatch(b)
+	}
+
+	off := 0
+	if len(b.pkts) > 0 {
+		off = b.size()
+	}
+	plen, perr := pw.pkt.WriteTo(b.buf[off : off+int(m.mtu)])
+	if perr != nil {
+		log.Printf("Unable to buffer out %s packet: %s", packet.PacketTypeName(pw.pkt.PacketType()), perr.Error())
+		if pw.sent != nil {
+			close(pw.sent)
+		}
+		return err
+	}
+	if len(b.pkts) > 0 && int(plen) > b.segSize {
+		// too big to be a segment of this batch, so it starts the next one
+		if ferr := m.flushBatch(b); ferr != nil {
+			err = ferr
+		}
+		copy(b.buf, b.buf[off:off+int(plen)])
+	}
+	if len(b.pkts) == 0 {
+		b.dest = pw.dest
+		b.segSize = int(plen)
+	}
+	b.pkts = append(b.pkts, pw)
+	b.lens = append(b.lens, int(plen))
+	return err
+}
+
+// flushBatch writes out the packets gathered in a batch and empties it.  Only errors from the connection itself are
+// returned
+func (m *multiplexer) flushBatch(b *gsoBatch) (err error) {
+	n := len(b.pkts)
+	if n == 0 {
+		return nil
+	}
+	total := (n-1)*b.segSize + b.lens[n-1]
+	uc, ok := m.conn.(*net.UDPConn)
+	switch {
+	case n == 1 || !ok || m.gso.get() == 0:
+		err = m.writeSegments(b)
+	default:
+		_, _, err = uc.WriteMsgUDP(b.buf[:total], gsoControl(b.segSize), b.dest)
+		if err == nil {
+			m.pktOut.add(uint64(n)) // the kernel splits this back into a datagram per packet
+			off := 0
+			for i, pw := range b.pkts {
+				m.trace(true, 0, pw.dest, b.buf[off:off+b.lens[i]], pw.pkt)
+				off += b.lens[i]
+			}
+		} else if errors.Is(err, syscall.EMSGSIZE) {
+			// the packets are too large for the path, which we'll deal with one packet at a time
+			err = m.writeSegments(b)
+		} else if !isTransientConnError(err) && !m.isClosed() {
+			log.Printf("%s unable to send a segmented packet, disabling UDP segmentation offload: %s", m.laddr.String(),
+				err.Error())
+			m.gso.set(0)
+			err = m.writeSegments(b)
+		}
+	}
+
+	for i, pw := range b.pkts {
+		m.charge(pw, b.lens[i])
+		if pw.sent != nil {
+			close(pw.sent)
+		}
+	}
+	b.pkts = b.pkts[:0]
+	b.lens = b.lens[:0]
+	return err
+}
+
+// writeSegments writes out the packets gathered in a batch individually
+func (m *multiplexer) writeSegments(b *gsoBatch) error {
+	off := 0
+	for i, plen := range b.lens {
+		if err := m.writeTo(b.buf[off:off+plen], b.pkts[i]); err != nil {
+			return err
+		}
+		off += plen
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// socket options and control messages for UDP segmentation offload, which the syscall package doesn't define
+const (
+	solUDP     = 17  // SOL_UDP
+	udpSegment = 103 // UDP_SEGMENT
+	udpGRO     = 104 // UDP_GRO
+)
+
+const (
+	groOOBSize     = 24    // room for a single UDP_GRO control message
+	maxGROSize     = 65535 // the largest datagram the kernel may coalesce received packets into
+	maxGSOSize     = 65000 // the largest super-packet we hand to the kernel, below the IP limit after headers
+	maxGSOSegments = 64    // the most packets the kernel accepts in a single super-packet
+)
+
+// enableKernelGSO checks that the kernel can split super-packets sent on conn, and asks it to coalesce those received
+func enableKernelGSO(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		// a segment size of zero leaves segmentation to each send, but fails if the kernel doesn't know the option
+		if sockErr = syscall.SetsockoptInt(int(fd), solUDP, udpSegment, 0); sockErr != nil {
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), solUDP, udpGRO, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// gsoControl returns the control message asking the kernel to split a super-packet into segments of segSize bytes
+func gsoControl(segSize int) []byte {
+	oob := make([]byte, syscall.CmsgSpace(2))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = solUDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(2))
+	*(*uint16)(unsafe.Pointer(&oob[syscall.CmsgLen(0)])) = uint16(segSize)
+	return oob
+}
+
+// parseGROSize extracts the size of the packets the kernel coalesced into a received datagram from the control
+// messages accompanying it
+func parseGROSize(oob []byte) (int, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == solUDP && msg.Header.Type == udpGRO && len(msg.Data) >= 4 {
+			// the segment size is passed as an int, in host byte order
+			return int(*(*int32)(unsafe.Pointer(&msg.Data[0]))), true
+		}
+	}
+	return 0, false
+}
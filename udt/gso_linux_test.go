@@ -0,0 +1,109 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestKernelGSO(t *testing.T) {
+	newConn := func() (*net.UDPConn, *multiplexer) {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("error calling ListenUDP: %s", err.Error())
+		}
+		return conn, &multiplexer{conn: conn, laddr: conn.LocalAddr().(*net.UDPAddr), mtu: 1500, sched: newSendScheduler()}
+	}
+	sendConn, sender := newConn()
+	defer sendConn.Close()
+	recvConn, _ := newConn()
+	defer recvConn.Close()
+	if sender.enableGSO(); sender.gso.get() == 0 {
+		t.Fatal("unable to enable UDP segmentation offload")
+	}
+
+	// a super-packet arrives as individual datagrams at a receiver that isn't coalescing them
+	super := bytes.Repeat([]byte{1, 2, 3, 4, 5}, 50)
+	if _, _, err := sendConn.WriteMsgUDP(super, gsoControl(100), recvConn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatalf("error sending a segmented packet: %s", err.Error())
+	}
+	buf := make([]byte, len(super))
+	for i, expect := range []int{100, 100, 50} {
+		n, _, err := recvConn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("error calling ReadFrom: %s", err.Error())
+		}
+		if n != expect || !bytes.Equal(buf[:n], super[i*100:i*100+n]) {
+			t.Errorf("segment %d: expected %d bytes, got %d", i, expect, n)
+		}
+	}
+
+	// packets to the same peer are gathered into a batch until one is shorter than the rest, or goes somewhere else
+	otherConn, _ := newConn()
+	defer otherConn.Close()
+	batch := newGSOBatch(sender.mtu)
+	dest := recvConn.LocalAddr().(*net.UDPAddr)
+	payloads := []string{"first", "again", "short", "tiny", "elsewhere"}
+	for i, payload := range payloads {
+		pw := packetWrapper{pkt: &packet.DataPacket{Seq: packet.PacketID{Seq: uint32(i)}, Data: []byte(payload)}, dest: dest}
+		if i == len(payloads)-1 {
+			pw.dest = otherConn.LocalAddr().(*net.UDPAddr)
+		}
+		if err := sender.addToBatch(batch, pw); err != nil {
+			t.Fatalf("error adding to batch: %s", err.Error())
+		}
+		if i == 2 && len(batch.pkts) != 3 {
+			t.Errorf("expected equally-sized packets to be gathered, batch has %d", len(batch.pkts))
+		}
+	}
+	if err := sender.flushBatch(batch); err != nil {
+		t.Fatalf("error flushing batch: %s", err.Error())
+	}
+	read := func(conn *net.UDPConn, expect string) {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("error calling ReadFrom: %s", err.Error())
+		}
+		p, err := packet.ReadPacketFrom(buf[:n])
+		if err != nil {
+			t.Fatalf("error decoding packet: %s", err.Error())
+		}
+		if dp, ok := p.(*packet.DataPacket); !ok || string(dp.Data) != expect {
+			t.Errorf("expected a data packet carrying %q, got %v", expect, p)
+		}
+	}
+	for _, payload := range payloads[:len(payloads)-1] {
+		read(recvConn, payload)
+	}
+	read(otherConn, payloads[len(payloads)-1])
+}
+
+func TestGSOTransfer(t *testing.T) {
+	config := DefaultConfig()
+	config.GSO = true
+	serv, client, server := connectWithClock(t, 74, defaultClock, config)
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+	if client.m.gso.get() == 0 {
+		t.Fatal("UDP segmentation offload wasn't enabled")
+	}
+
+	// enough data that the send queue fills up, so packets are gathered into super-packets
+	msg := bytes.Repeat([]byte("segmentation offload "), 50000)
+	go func() {
+		if _, err := client.Write(msg); err != nil {
+			t.Errorf("error calling Write: %s", err.Error())
+		}
+	}()
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error calling Read: %s", err.Error())
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Error("received data doesn't match what was sent")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import (
+	"errors"
+	"net"
+)
+
+const (
+	groOOBSize     = 0
+	maxGROSize     = 0
+	maxGSOSize     = 0
+	maxGSOSegments = 1
+)
+
+// enableKernelGSO checks that the kernel can split super-packets sent on conn, and asks it to coalesce those received
+func enableKernelGSO(conn *net.UDPConn) error {
+	return errors.New("UDP segmentation offload is not supported on this platform")
+}
+
+// gsoControl returns the control message asking the kernel to split a super-packet into segments of segSize bytes
+func gsoControl(segSize int) []byte {
+	return nil
+}
+
+// parseGROSize extracts the size of the packets the kernel coalesced into a received datagram from the control
+// messages accompanying it
+func parseGROSize(oob []byte) (int, bool) {
+	return 0, false
+}
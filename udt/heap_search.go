@@ -0,0 +1,61 @@
+package udt
+
+import (
+	"sort"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// heapFind searches a min-heap for an entry.  cmp(idx) returns the ordering of the entry at idx relative to
+// the entry being searched for (-1 if it sorts before, +1 if it sorts after, 0 if it matches).  As every child
+// in a heap sorts after its parent, we can skip any subtree whose root sorts after the entry we're looking for.
+func heapFind(n int, idx int, cmp func(idx int) int) int {
+	if idx >= n {
+		return -1
+	}
+	switch cmp(idx) {
+	case 0:
+		return idx
+	case 1:
+		return -1
+	}
+	if found := heapFind(n, 2*idx+1, cmp); found >= 0 {
+		return found
+	}
+	return heapFind(n, 2*idx+2, cmp)
+}
+
+// heapMinRange searches a min-heap for the smallest entry within a range.  inRange(idx) returns -1 if the entry
+// at idx sorts before the range, +1 if it sorts after the range, or 0 if it falls within the range
+func heapMinRange(h sort.Interface, idx int, inRange func(idx int) int) int {
+	if idx >= h.Len() {
+		return -1
+	}
+	switch inRange(idx) {
+	case 0:
+		return idx // nothing in this subtree can be smaller
+	case 1:
+		return -1 // nothing in this subtree can be within range
+	}
+	left := heapMinRange(h, 2*idx+1, inRange)
+	right := heapMinRange(h, 2*idx+2, inRange)
+	if left < 0 {
+		return right
+	}
+	if right < 0 || h.Less(left, right) {
+		return left
+	}
+	return right
+}
+
+// seqInRange returns -1 if pktID comes before greaterEqual, +1 if it comes after lessEqual, or 0 if it falls
+// between them (inclusive)
+func seqInRange(pktID packet.PacketID, greaterEqual packet.PacketID, lessEqual packet.PacketID) int {
+	if pktID.Cmp(greaterEqual) < 0 {
+		return -1
+	}
+	if pktID.Cmp(lessEqual) > 0 {
+		return +1
+	}
+	return 0
+}
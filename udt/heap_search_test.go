@@ -0,0 +1,154 @@
+package udt
+
+import (
+	"container/heap"
+	"math/rand"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// newWrappedHeap returns a heap of the packet IDs from first to last (inclusive, crossing the wrap if need be), less
+// any listed in skip, pushed in a random order
+func newWrappedHeap(first, last uint32, skip ...uint32) packetIDHeap {
+	var ids []packet.PacketID
+	for seq := (packet.PacketID{Seq: first}); ; seq.Incr() {
+		skipped := false
+		for _, s := range skip {
+			skipped = skipped || s == seq.Seq
+		}
+		if !skipped {
+			ids = append(ids, seq)
+		}
+		if seq.Seq == last {
+			break
+		}
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	h := packetIDHeap{}
+	for _, id := range ids {
+		heap.Push(&h, id)
+	}
+	return h
+}
+
+func TestSeqInRange(t *testing.T) {
+	tests := []struct {
+		seq, greaterEqual, lessEqual uint32
+		expect                       int
+	}{
+		{5, 5, 10, 0},
+		{10, 5, 10, 0},
+		{4, 5, 10, -1},
+		{11, 5, 10, +1},
+		{0x7FFFFFFF, 0x7FFFFFFE, 3, 0}, // the range straddles the wrap
+		{0, 0x7FFFFFFE, 3, 0},
+		{3, 0x7FFFFFFE, 3, 0},
+		{0x7FFFFFFD, 0x7FFFFFFE, 3, -1},
+		{4, 0x7FFFFFFE, 3, +1},
+		{0x7FFFFFFF, 0, 3, -1}, // just before a range starting at zero
+		{0, 0x7FFFFFF0, 0x7FFFFFFF, +1},
+	}
+	for _, test := range tests {
+		got := seqInRange(packet.PacketID{Seq: test.seq}, packet.PacketID{Seq: test.greaterEqual},
+			packet.PacketID{Seq: test.lessEqual})
+		if got != test.expect {
+			t.Errorf("expected %#x against [%#x, %#x] to be %d, got %d", test.seq, test.greaterEqual, test.lessEqual,
+				test.expect, got)
+		}
+	}
+}
+
+func TestHeapFindWrapped(t *testing.T) {
+	for trial := 0; trial < 20; trial++ {
+		h := newWrappedHeap(0x7FFFFFF0, 15, 0x7FFFFFF8, 7)
+		if h[0].Seq != 0x7FFFFFF0 {
+			t.Fatalf("expected the earliest packet across the wrap at the top of the heap, got %#x", h[0].Seq)
+		}
+		find := func(seq uint32) int {
+			return heapFind(len(h), 0, func(idx int) int {
+				return h[idx].Cmp(packet.PacketID{Seq: seq})
+			})
+		}
+
+		// every packet on either side of the wrap is found where it is
+		for _, id := range h {
+			if idx := find(id.Seq); idx < 0 || h[idx] != id {
+				t.Fatalf("expected to find packet %#x, got index %d", id.Seq, idx)
+			}
+		}
+
+		// and those that aren't there, inside or outside the heap's span, aren't
+		for _, seq := range []uint32{0x7FFFFFF8, 7, 0x7FFFFFEF, 16, 0x40000000} {
+			if idx := find(seq); idx >= 0 {
+				t.Fatalf("expected not to find packet %#x, got %#x at index %d", seq, h[idx].Seq, idx)
+			}
+		}
+	}
+}
+
+func TestHeapMinRangeWrapped(t *testing.T) {
+	tests := []struct {
+		greaterEqual, lessEqual uint32
+		expect                  uint32 // zero if nothing is expected, as zero is skipped from the heap
+	}{
+		{0x7FFFFFF0, 15, 0x7FFFFFF0},
+		{0x7FFFFFF8, 15, 0x7FFFFFF9}, // (0x7FFFFFF8 skipped)
+		{0x7FFFFFFF, 15, 0x7FFFFFFF},
+		{0x7FFFFFFF, 0x7FFFFFFF, 0x7FFFFFFF},
+		{0x7FFFFFFE, 2, 0x7FFFFFFE},
+		{0, 15, 1}, // the range starts on the far side of the wrap
+		{6, 15, 6},
+		{7, 7, 0},
+		{7, 8, 8},
+		{16, 0x7FFFFFEF, 0},         // the gap between the heap's ends
+		{0x7FFFFFE0, 0x7FFFFFEF, 0}, // entirely before the heap
+		{0x7FFFFFE0, 0x7FFFFFF0, 0x7FFFFFF0},
+	}
+	for trial := 0; trial < 20; trial++ {
+		h := newWrappedHeap(0x7FFFFFF0, 15, 0x7FFFFFF8, 0, 7)
+		for _, test := range tests {
+			greaterEqual, lessEqual := packet.PacketID{Seq: test.greaterEqual}, packet.PacketID{Seq: test.lessEqual}
+			idx := heapMinRange(h, 0, func(idx int) int {
+				return seqInRange(h[idx], greaterEqual, lessEqual)
+			})
+			switch {
+			case test.expect == 0 && idx >= 0:
+				t.Fatalf("expected nothing in [%#x, %#x], got %#x", test.greaterEqual, test.lessEqual, h[idx].Seq)
+			case test.expect != 0 && (idx < 0 || h[idx].Seq != test.expect):
+				t.Fatalf("expected %#x to be the lowest in [%#x, %#x], got index %d", test.expect, test.greaterEqual,
+					test.lessEqual, idx)
+			}
+			if min, minIdx := h.Min(greaterEqual, lessEqual); minIdx != idx || (idx >= 0 && min != h[idx]) {
+				t.Fatalf("expected Min over [%#x, %#x] to agree with heapMinRange, got %#x at index %d",
+					test.greaterEqual, test.lessEqual, min.Seq, minIdx)
+			}
+		}
+	}
+}
+
+func TestAcceptHistFind(t *testing.T) {
+	for trial := 0; trial < 20; trial++ {
+		var h acceptSockHeap
+		var entries []acceptSockInfo
+		for i := 0; i < 50; i++ {
+			// several connection attempts from each peer socket, told apart by their initial sequence numbers
+			info := acceptSockInfo{sockID: uint32(rand.Intn(10)), initSeqNo: packet.PacketID{Seq: rand.Uint32() & 0x7FFFFFFF},
+				sock: &udtSocket{sockID: uint32(i)}}
+			entries = append(entries, info)
+			heap.Push(&h, info)
+		}
+
+		for _, info := range entries {
+			if s, idx := h.Find(info.sockID, info.initSeqNo); s != info.sock || h[idx].sock != s {
+				t.Fatalf("expected to find the socket for %d/%#x, got index %d", info.sockID, info.initSeqNo.Seq, idx)
+			}
+		}
+		if s, idx := h.Find(10, entries[0].initSeqNo); s != nil || idx >= 0 {
+			t.Fatalf("expected not to find a socket for a peer we haven't heard from, got index %d", idx)
+		}
+		if s, idx := h.Find(entries[0].sockID, entries[0].initSeqNo.Add(1)); s != nil || idx >= 0 {
+			t.Fatalf("expected not to find a socket for a new attempt from a known peer, got index %d", idx)
+		}
+	}
+}
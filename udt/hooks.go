@@ -0,0 +1,40 @@
+package udt
+
+import (
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.OnRTTUpdate, Config.OnLoss and Config.OnRateChange let an application adapt to the health of a connection as it
+changes (such as a video encoder lowering its bitrate when loss is reported) rather than polling Stats.  They are
+called from the connection's own goroutines, so they should return promptly.
+*/
+
+// notifyRTT passes our latest roundtrip time estimate to Config.OnRTTUpdate
+func (s *udtSocket) notifyRTT() {
+	if onRTTUpdate := s.Config.OnRTTUpdate; onRTTUpdate != nil {
+		rtt, rttVar := s.getRTT()
+		onRTTUpdate(s, time.Duration(rtt)*time.Microsecond, time.Duration(rttVar)*time.Microsecond)
+	}
+}
+
+// notifyLoss passes packets our peer has reported lost to Config.OnLoss
+func (s *udtSocket) notifyLoss(lost []packet.PacketID) {
+	if onLoss := s.Config.OnLoss; onLoss != nil && len(lost) > 0 {
+		onLoss(s, uint(len(lost)))
+	}
+}
+
+// notifyRate passes the sending rate set by congestion control to Config.OnRateChange, if it has changed since the
+// last time it was called
+func (s *udtSocketCc) notifyRate() {
+	onRateChange := s.socket.Config.OnRateChange
+	if onRateChange == nil || (s.sndPeriod == s.notifiedPeriod && s.congWindow == s.notifiedWindow) {
+		return
+	}
+	s.notifiedPeriod = s.sndPeriod
+	s.notifiedWindow = s.congWindow
+	onRateChange(s.socket, s.sndPeriod, s.congWindow)
+}
@@ -0,0 +1,69 @@
+package udt
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestHealthHooks(t *testing.T) {
+	rttUpdates := make(chan time.Duration, 100)
+	losses := make(chan uint, 100)
+	rateChanges := make(chan time.Duration, 100)
+	config := DefaultConfig()
+	config.OnRTTUpdate = func(conn Conn, rtt, rttVar time.Duration) {
+		select {
+		case rttUpdates <- rtt:
+		default:
+		}
+	}
+	config.OnLoss = func(conn Conn, lost uint) {
+		losses <- lost
+	}
+	config.OnRateChange = func(conn Conn, sendPeriod time.Duration, congWindow uint) {
+		select {
+		case rateChanges <- sendPeriod:
+		default:
+		}
+	}
+	serv, client, server := connectWithClock(t, 36, defaultClock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	// we measure the roundtrip time when acknowledging what our peer sends us, and tell congestion control about what
+	// we send it
+	msg := []byte("how are we doing?")
+	for _, pair := range [][2]Conn{{client, server}, {server, client}} {
+		if _, err := pair[0].Write(msg); err != nil {
+			t.Fatalf("error calling Write: %s", err.Error())
+		}
+		if _, err := io.ReadFull(pair[1], make([]byte, len(msg))); err != nil {
+			t.Fatalf("error calling Read: %s", err.Error())
+		}
+	}
+
+	select {
+	case <-rttUpdates:
+	case <-time.After(time.Second):
+		t.Error("never heard about the roundtrip time")
+	}
+	select {
+	case <-rateChanges:
+	case <-time.After(time.Second):
+		t.Error("never heard about the sending rate")
+	}
+
+	// our peer claims the packet we sent was lost
+	server.sendPacket <- packet.NewNakPacket(client.sockID, 0, []uint32{client.initPktSeq.Seq})
+	select {
+	case lost := <-losses:
+		if lost != 1 {
+			t.Errorf("expected one lost packet, got %d", lost)
+		}
+	case <-time.After(time.Second):
+		t.Error("never heard about the lost packet")
+	}
+}
@@ -0,0 +1,35 @@
+package udt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DialContext establishes an outbound UDT stream connection to addr (a "host:port" string), from any local address.
+// The network is ignored, as UDT always runs over UDP.  This matches the signature expected by http.Transport and
+// similar dialer hooks
+func (c *Config) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "udp", Err: err}
+	}
+	return c.Dial(ctx, "udp", "", raddr, true)
+}
+
+// NewHTTPTransport returns an http.Transport that makes its connections over UDT stream connections using the
+// specified Config (nil for the defaults), to servers accepting them with a UDT listener (such as by passing a
+// listener from ListenUDT to http.Serve).  Only HTTP/1.1 is supported
+func NewHTTPTransport(config *Config) *http.Transport {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &http.Transport{
+		Proxy:                 nil, // a proxy wouldn't be speaking UDT
+		DialContext:           config.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
@@ -0,0 +1,47 @@
+package udt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.IdleTimeout closes connections that haven't sent or received any data for that long.  Keep-alives and other
+control packets don't count, so a connection the application has forgotten about is eventually closed even though
+both peers are still there.  The peer is told why in the shutdown packet, and the connection's own Read and Write
+calls return ErrIdleTimeout.
+*/
+
+// ErrIdleTimeout is returned from Read and Write on a connection closed for being idle longer than Config.IdleTimeout
+var ErrIdleTimeout = errors.New("Connection closed after being idle")
+
+// markActive records that data has been sent or received at the specified time
+func (s *udtSocket) markActive(now time.Time) {
+	s.lastData.set(now.Sub(s.created))
+}
+
+// idleTimer returns a channel that fires once the connection may have been idle for longer than Config.IdleTimeout,
+// or nil if there's no idle timeout
+func (s *udtSocket) idleTimer() <-chan time.Time {
+	timeout := s.Config.IdleTimeout
+	if timeout <= 0 {
+		return nil
+	}
+	return s.clock.After(timeout - (s.elapsed() - s.lastData.get()))
+}
+
+// checkIdle is called by goManageConnection when the idle timer fires, closing the connection if nothing has been
+// sent or received since the idle timeout began
+func (s *udtSocket) checkIdle() <-chan time.Time {
+	if !s.isOpen() {
+		return nil
+	}
+	if s.sockState.get() != sockStateConnected || s.elapsed()-s.lastData.get() < s.Config.IdleTimeout {
+		return s.idleTimer() // still connecting, or something has happened since we last checked
+	}
+	s.writePacket(&packet.ShutdownPacket{Code: uint32(CloseIdleTimeout)})
+	s.shutdown(sockStateClosed, false, ErrIdleTimeout)
+	return nil
+}
@@ -0,0 +1,63 @@
+package udt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	clock := newManualClock()
+	config := DefaultConfig()
+	config.IdleTimeout = 30 * time.Second
+	serv, client, server := connectWithClock(t, 48, clock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 100))
+		readErr <- err
+	}()
+
+	// sending data keeps the connection open
+	clock.advance(20 * time.Second)
+	if _, err := client.Write([]byte("still here")); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	if err := <-readErr; err != nil {
+		t.Fatalf("error calling Read: %s", err.Error())
+	}
+	go func() {
+		_, err := server.Read(make([]byte, 100))
+		readErr <- err
+	}()
+	clock.advance(20 * time.Second)
+	select {
+	case <-client.sockClosed:
+		t.Fatal("connection closed while still in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// until it's gone unused for long enough
+	clock.advance(15 * time.Second)
+	select {
+	case <-client.sockClosed:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection was never closed")
+	}
+	if _, err := client.Write([]byte("too late")); err != ErrIdleTimeout {
+		t.Errorf("expected ErrIdleTimeout from Write, got %v", err)
+	}
+
+	select {
+	case err := <-readErr:
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseIdleTimeout {
+			t.Errorf("expected the peer to hear about the idle timeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer never noticed the connection closing")
+	}
+}
@@ -0,0 +1,112 @@
+package udt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Inspect returns a snapshot of every local address this process is using for UDT and the connections sharing each, for
+looking inside a running process (the udt/debug package serves it over HTTP).  Each is read without holding up the
+connection it describes, so the fields of a busy connection may not all be from quite the same moment.  Multiplexers
+created by NewMultiplexerWithConn aren't registered anywhere and so aren't included.
+*/
+
+// MuxInfo describes a local address in use by UDT, along with everything sharing it
+type MuxInfo struct {
+	Network   string       // the network the address is on ("udp", "udp4" or "udp6")
+	LocalAddr string       // the local address
+	MTU       uint         // the Maximum Transmission Unit of packets sent from this address
+	Listeners []string     // the Config.ServiceName of each listener accepting connections here ("" if it has none)
+	Stats     MuxStats     // metrics for everything sharing this address
+	Sockets   []SocketInfo // the connections using this address, by socket ID
+}
+
+// SocketInfo describes a connection, along with snapshots of its metrics and its congestion control
+type SocketInfo struct {
+	Description string            // as returned by the connection's String
+	State       string            // the connection's state
+	Type        packet.SocketType // whether this is a stream or datagram connection
+	LocalAddr   string
+	RemoteAddr  string
+	SockID      uint32
+	PeerSockID  uint32
+	Created     time.Time
+	Congestion  string        // the type of the congestion control in use
+	SendPeriod  time.Duration // delay between packets that congestion control is pacing us to (0 until connected)
+	CongWindow  uint          // unacknowledged packets congestion control permits (0 until connected)
+	Stats       Stats         // performance metrics (zero until connected)
+
+	Capabilities     Capability // the optional features in use (zero until connected)
+	PeerCapabilities Capability // the optional features the peer advertised (zero until connected)
+}
+
+// Inspect returns a snapshot of every local address in use by UDT, ordered by address
+func Inspect() []MuxInfo {
+	var muxes []*multiplexer
+	multiplexers.Range(func(key, value interface{}) bool {
+		muxes = append(muxes, value.(*multiplexer))
+		return true
+	})
+	result := make([]MuxInfo, 0, len(muxes))
+	for _, m := range muxes {
+		result = append(result, m.info())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Network != result[j].Network {
+			return result[i].Network < result[j].Network
+		}
+		return result[i].LocalAddr < result[j].LocalAddr
+	})
+	return result
+}
+
+// info describes this multiplexer and the connections using it
+func (m *multiplexer) info() MuxInfo {
+	result := MuxInfo{
+		Network:   m.network,
+		LocalAddr: m.laddr.String(),
+		MTU:       m.mtu,
+		Stats:     m.stats(),
+	}
+	m.servSockMutex.Lock()
+	for name := range m.listeners {
+		result.Listeners = append(result.Listeners, name)
+	}
+	m.servSockMutex.Unlock()
+	sort.Strings(result.Listeners)
+
+	sockets := m.sockets.all()
+	sort.Slice(sockets, func(i, j int) bool { return sockets[i].sockID < sockets[j].sockID })
+	for _, s := range sockets {
+		result.Sockets = append(result.Sockets, s.info())
+	}
+	return result
+}
+
+// info describes this connection.  Its sending side is only read once it's been connected, as it's created by the
+// goroutine managing the connection
+func (s *udtSocket) info() SocketInfo {
+	state := s.sockState.get()
+	result := SocketInfo{
+		Description: s.String(),
+		State:       state.String(),
+		Type:        s.sockType(),
+		LocalAddr:   s.LocalAddr().String(),
+		RemoteAddr:  s.RemoteAddr().String(),
+		SockID:      s.sockID,
+		PeerSockID:  s.farSockID.get(),
+		Created:     s.created,
+		Congestion:  fmt.Sprintf("%T", s.cong.congestion),
+	}
+	result.Capabilities, result.PeerCapabilities = s.Capabilities()
+	if state >= sockStateConnected && s.send != nil {
+		result.SendPeriod = s.send.sndPeriod.get()
+		result.CongWindow = uint(s.send.congestWindow.get())
+		result.Stats = s.Stats()
+	}
+	return result
+}
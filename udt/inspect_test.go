@@ -0,0 +1,47 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	config := DefaultConfig()
+	config.ServiceName = "inspect"
+	l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+112))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+	client, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+113), l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+	echoOnce(t, client, server, "hello")
+
+	var found bool
+	for _, mux := range Inspect() {
+		if mux.LocalAddr != l.Addr().String() {
+			continue
+		}
+		found = true
+		if len(mux.Listeners) != 1 || mux.Listeners[0] != "inspect" || mux.Stats.ActiveSockets != 1 || len(mux.Sockets) != 1 {
+			t.Fatalf("unexpected description of the listener's address: %+v", mux)
+		}
+		sock := mux.Sockets[0]
+		if sock.State != "connected" || sock.SockID != server.(*udtSocket).sockID || sock.RemoteAddr != client.LocalAddr().String() {
+			t.Errorf("unexpected description of the accepted connection: %+v", sock)
+		}
+		if sock.Congestion != "*udt.NativeCongestionControl" || sock.SendPeriod <= 0 || sock.CongWindow == 0 || sock.Stats.ByteRecv != 5 {
+			t.Errorf("unexpected congestion control or metrics for the accepted connection: %+v", sock)
+		}
+	}
+	if !found {
+		t.Errorf("listener's address %s wasn't included", l.Addr())
+	}
+}
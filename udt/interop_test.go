@@ -0,0 +1,408 @@
+//go:build interop
+// +build interop
+
+package udt
+
+// Interoperability tests against the reference C++ implementation (UDT4), only built with the "interop" tag.
+//
+// These spawn the sample applications from the UDT 4.11 SDK, so set UDT4_BIN to a directory holding appserver,
+// appclient, sendfile and recvfile (from the SDK's app directory) along with msgecho, built from
+// testdata/interop/msgecho.cpp.  Something like:
+//
+//	make -C $UDT4 && g++ -I$UDT4/src -o $UDT4/app/msgecho testdata/interop/msgecho.cpp -L$UDT4/src -ludt -lpthread
+//	UDT4_BIN=$UDT4/app LD_LIBRARY_PATH=$UDT4/src go test -tags interop -run Interop ./udt
+//
+// Any test whose binary can't be found is skipped.  The sendfile/recvfile protocol sends its lengths in host byte
+// order, these tests assume a little-endian host.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	interopPort     = serverPort + 20
+	interopTimeout  = 60 * time.Second
+	interopBulkSize = 8 << 20
+	interopMsgCount = 500
+)
+
+// refProcess is a running reference application
+type refProcess struct {
+	cmd  *exec.Cmd
+	out  refOutput
+	done chan struct{}
+	err  error // exit status, valid once done is closed
+}
+
+// refOutput collects what a reference application prints
+type refOutput struct {
+	buf  bytes.Buffer
+	prot sync.Mutex
+}
+
+func (o *refOutput) Write(p []byte) (int, error) {
+	o.prot.Lock()
+	defer o.prot.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *refOutput) String() string {
+	o.prot.Lock()
+	defer o.prot.Unlock()
+	return o.buf.String()
+}
+
+// interopBinary returns the path to the named reference application, skipping the test if it isn't available
+func interopBinary(t *testing.T, name string) string {
+	dir := os.Getenv("UDT4_BIN")
+	if dir == "" {
+		t.Skip("UDT4_BIN is not set")
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("reference application not available: %s", err.Error())
+	}
+	return path
+}
+
+func startReference(t *testing.T, dir string, path string, args ...string) *refProcess {
+	p := &refProcess{
+		cmd:  exec.Command(path, args...),
+		done: make(chan struct{}),
+	}
+	p.cmd.Dir = dir
+	p.cmd.Stdout = &p.out
+	p.cmd.Stderr = &p.out
+	if err := p.cmd.Start(); err != nil {
+		t.Fatalf("unable to start %s: %s", filepath.Base(path), err.Error())
+	}
+	go func() {
+		p.err = p.cmd.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+// waitOutput waits for the reference application to print the specified text
+func (p *refProcess) waitOutput(t *testing.T, text string) {
+	timeout := time.After(interopTimeout)
+	for !strings.Contains(p.out.String(), text) {
+		select {
+		case <-p.done:
+			if strings.Contains(p.out.String(), text) {
+				return
+			}
+			t.Fatalf("%s exited without printing %q: %v\n%s", filepath.Base(p.cmd.Path), text, p.err, p.out.String())
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s to print %q\n%s", filepath.Base(p.cmd.Path), text, p.out.String())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// wait waits for the reference application to exit, returning its exit status
+func (p *refProcess) wait(t *testing.T) error {
+	select {
+	case <-p.done:
+		return p.err
+	case <-time.After(interopTimeout):
+		p.kill()
+		t.Fatalf("timed out waiting for %s to exit\n%s", filepath.Base(p.cmd.Path), p.out.String())
+		return nil
+	}
+}
+
+func (p *refProcess) kill() {
+	select {
+	case <-p.done:
+	default:
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+func interopDial(t *testing.T, port int, isStream bool) net.Conn {
+	remoteAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("error calling ResolveUDPAddr: %s", err.Error())
+	}
+	conn, err := DialUDT("udp", "127.0.0.1:0", remoteAddr, isStream)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(interopTimeout))
+	return conn
+}
+
+func interopAccept(t *testing.T, serv net.Listener) net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := serv.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		conn.SetDeadline(time.Now().Add(interopTimeout))
+		return conn
+	case <-time.After(interopTimeout):
+		t.Fatal("timed out waiting for the reference application to connect")
+		return nil
+	}
+}
+
+// interopMessage returns the message msgecho expects for the specified index
+func interopMessage(i int) []byte {
+	msg := make([]byte, (i*7919)%20000+1)
+	for j := range msg {
+		msg[j] = byte(i + j)
+	}
+	return msg
+}
+
+func interopData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+// writeChunks writes data in fresh buffers (Write may hold on to what it's given until it has been sent)
+func writeChunks(conn net.Conn, data []byte, chunk int) error {
+	for off := 0; off < len(data); off += chunk {
+		end := off + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		buf := make([]byte, end-off)
+		copy(buf, data[off:end])
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream data to appserver, which discards it and reports when the connection is broken
+func TestInteropDialAppServer(t *testing.T) {
+	port := interopPort
+	ref := startReference(t, "", interopBinary(t, "appserver"), fmt.Sprint(port))
+	defer ref.kill()
+	ref.waitOutput(t, "server is ready")
+
+	conn := interopDial(t, port, true)
+	if err := writeChunks(conn, interopData(interopBulkSize), 100000); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	ref.waitOutput(t, "new connection")
+	conn.Close()
+
+	// appserver only notices the shutdown through the error from its recv call
+	ref.waitOutput(t, "recv:")
+}
+
+// Accept a connection from appclient, which streams data until we close the connection
+func TestInteropAcceptAppClient(t *testing.T) {
+	appclient := interopBinary(t, "appclient")
+	port := interopPort + 1
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+
+	ref := startReference(t, "", appclient, "127.0.0.1", fmt.Sprint(port))
+	defer ref.kill()
+
+	conn := interopAccept(t, serv)
+	if n, err := io.CopyN(ioutil.Discard, conn, interopBulkSize); err != nil {
+		t.Fatalf("error reading from appclient after %d bytes: %s", n, err.Error())
+	}
+	conn.Close()
+
+	ref.wait(t)
+	if !strings.Contains(ref.out.String(), "send:") {
+		t.Errorf("appclient didn't report the connection closing\n%s", ref.out.String())
+	}
+}
+
+// Fetch a file from sendfile using the SDK's file transfer protocol
+func TestInteropFetchFromSendfile(t *testing.T) {
+	sendfile := interopBinary(t, "sendfile")
+	dir, err := ioutil.TempDir("", "udt-interop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := interopData(interopBulkSize + 12345)
+	if err = ioutil.WriteFile(filepath.Join(dir, "source.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	port := interopPort + 2
+	ref := startReference(t, dir, sendfile, fmt.Sprint(port))
+	defer ref.kill()
+	ref.waitOutput(t, "server is ready")
+
+	conn := interopDial(t, port, true)
+	defer conn.Close()
+
+	name := "source.bin"
+	req := make([]byte, 4+len(name))
+	binary.LittleEndian.PutUint32(req, uint32(len(name)))
+	copy(req[4:], name)
+	if _, err = conn.Write(req); err != nil {
+		t.Fatalf("error sending file request: %s", err.Error())
+	}
+
+	var hdr [8]byte
+	if _, err = io.ReadFull(conn, hdr[:]); err != nil {
+		t.Fatalf("error reading file size: %s", err.Error())
+	}
+	if size := int64(binary.LittleEndian.Uint64(hdr[:])); size != int64(len(data)) {
+		t.Fatalf("sendfile reported a size of %d, expected %d", size, len(data))
+	}
+
+	recvd := make([]byte, len(data))
+	if n, err := io.ReadFull(conn, recvd); err != nil {
+		t.Fatalf("error receiving file after %d bytes: %s", n, err.Error())
+	}
+	if !bytes.Equal(recvd, data) {
+		t.Fatal("received file does not match what was sent")
+	}
+
+	// sendfile closes the connection once the transfer is complete
+	if n, err := conn.Read(hdr[:]); err == nil {
+		t.Errorf("read %d unexpected bytes after the file", n)
+	}
+}
+
+// Serve a file to recvfile using the SDK's file transfer protocol
+func TestInteropServeRecvfile(t *testing.T) {
+	recvfile := interopBinary(t, "recvfile")
+	dir, err := ioutil.TempDir("", "udt-interop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := interopData(interopBulkSize + 54321)
+
+	port := interopPort + 3
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+
+	ref := startReference(t, dir, recvfile, "127.0.0.1", fmt.Sprint(port), "source.bin", "dest.bin")
+	defer ref.kill()
+
+	conn := interopAccept(t, serv)
+	var lenBuf [4]byte
+	if _, err = io.ReadFull(conn, lenBuf[:]); err != nil {
+		t.Fatalf("error reading file request: %s", err.Error())
+	}
+	name := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+	if _, err = io.ReadFull(conn, name); err != nil {
+		t.Fatalf("error reading file request: %s", err.Error())
+	}
+	if string(name) != "source.bin" {
+		t.Fatalf("recvfile requested %q", string(name))
+	}
+
+	hdr := make([]byte, 8)
+	binary.LittleEndian.PutUint64(hdr, uint64(len(data)))
+	if _, err = conn.Write(hdr); err != nil {
+		t.Fatalf("error sending file size: %s", err.Error())
+	}
+	if err = writeChunks(conn, data, 1<<20); err != nil {
+		t.Fatalf("error sending file: %s", err.Error())
+	}
+	conn.Close()
+
+	if err = ref.wait(t); err != nil {
+		t.Fatalf("recvfile failed: %s\n%s", err.Error(), ref.out.String())
+	}
+	recvd, err := ioutil.ReadFile(filepath.Join(dir, "dest.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recvd, data) {
+		t.Fatalf("recvfile saved %d bytes that do not match the %d sent", len(recvd), len(data))
+	}
+}
+
+// Send messages to msgecho and check they come back intact
+func TestInteropDialMsgEcho(t *testing.T) {
+	port := interopPort + 4
+	ref := startReference(t, "", interopBinary(t, "msgecho"), "server", fmt.Sprint(port))
+	defer ref.kill()
+	ref.waitOutput(t, "server is ready")
+
+	conn := interopDial(t, port, false)
+	for i := 0; i < interopMsgCount; i++ {
+		msg := interopMessage(i)
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatalf("error sending message %d: %s", i, err.Error())
+		}
+		echo, _, err := conn.(Conn).ReadMessage()
+		if err != nil {
+			t.Fatalf("error receiving message %d: %s", i, err.Error())
+		}
+		if !bytes.Equal(echo, interopMessage(i)) {
+			t.Fatalf("message %d was not echoed intact (%d bytes received, %d sent)", i, len(echo), len(msg))
+		}
+	}
+	conn.Close()
+
+	if err := ref.wait(t); err != nil {
+		t.Fatalf("msgecho failed: %s\n%s", err.Error(), ref.out.String())
+	}
+	if expected := fmt.Sprintf("echoed %d messages", interopMsgCount); !strings.Contains(ref.out.String(), expected) {
+		t.Errorf("msgecho didn't report %q\n%s", expected, ref.out.String())
+	}
+}
+
+// Echo messages sent by msgecho, which checks they come back intact
+func TestInteropAcceptMsgEcho(t *testing.T) {
+	msgecho := interopBinary(t, "msgecho")
+	port := interopPort + 5
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+
+	ref := startReference(t, "", msgecho, "client", "127.0.0.1", fmt.Sprint(port), fmt.Sprint(interopMsgCount))
+	defer ref.kill()
+
+	conn := interopAccept(t, serv)
+	defer conn.Close()
+	go func() {
+		for {
+			msg, _, err := conn.(Conn).ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err = conn.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err = ref.wait(t); err != nil {
+		t.Fatalf("msgecho failed: %s\n%s", err.Error(), ref.out.String())
+	}
+}
@@ -0,0 +1,472 @@
+//go:build linux && iouring
+// +build linux,iouring
+
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/*
+IOUringPacketIO is an (experimental) packet I/O backend that sends and receives UDP packets through io_uring rings
+rather than a system call per packet, built only with the "iouring" build tag.  Select it with Config.PacketIO:
+
+	config.PacketIO = udt.IOUringPacketIO{}
+
+Each connection it opens has a ring for receiving, which always has a number of receives waiting on the socket so
+that packets arriving together are picked up together, with the buffers we've finished with handed back in the same
+system call that waits for the next.  It has another ring for sending, where each packet is handed to the kernel
+without waiting for the kernel to finish with it, and finished sends are collected when we run short of buffers.
+
+An error sending a packet is only learned of later, so it's returned by a later WriteTo (which doesn't send its own
+packet), much as an ICMP error is on a UDP socket.  The connections aren't *net.UDPConns, so Config.KernelTimestamps,
+ECN, DSCP and GSO aren't available with this backend, and nor are deadlines.
+*/
+
+const (
+	sysIOUringSetup = 425 // the same on every architecture, being added after the syscall tables were unified
+	sysIOUringEnter = 426
+
+	iouringOffSQRing = 0
+	iouringOffCQRing = 0x8000000
+	iouringOffSQEs   = 0x10000000
+
+	iouringOpSendmsg = 9
+	iouringOpRecvmsg = 10
+
+	iouringEnterGetEvents = 1
+
+	iouringDefaultEntries = 64    // packets each ring has in flight, if IOUringPacketIO.Entries isn't set
+	iouringRecvBufSize    = 65536 // large enough for any UDP datagram
+)
+
+var errIOUringClosed = errors.New("Connection closed")
+
+// these mirror the structures of <linux/io_uring.h>
+
+type iouringSQRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type iouringCQRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type iouringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  iouringSQRingOffsets
+	cqOff                                                                  iouringCQRingOffsets
+}
+
+type iouringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type iouringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// iouring is a single io_uring instance, used by one goroutine at a time
+type iouring struct {
+	fd      int
+	sqRing  []byte // the submission ring's head, tail and index array
+	cqRing  []byte // the completion ring's head, tail and entries
+	sqes    []byte // the submission queue entries
+	params  iouringParams
+	pending uint32 // number of entries queued that haven't yet been submitted
+}
+
+func newIOUring(entries uint32) (*iouring, error) {
+	r := &iouring{}
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uintptr(entries), uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r.fd = int(fd)
+	p := &r.params
+	var err error
+	prot, flags := syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE
+	if r.sqRing, err = syscall.Mmap(r.fd, iouringOffSQRing, int(p.sqOff.array+p.sqEntries*4), prot, flags); err != nil {
+		r.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(iouringCQE{})))
+	if r.cqRing, err = syscall.Mmap(r.fd, iouringOffCQRing, cqSize, prot, flags); err != nil {
+		r.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	sqeSize := int(p.sqEntries * uint32(unsafe.Sizeof(iouringSQE{})))
+	if r.sqes, err = syscall.Mmap(r.fd, iouringOffSQEs, sqeSize, prot, flags); err != nil {
+		r.close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	return r, nil
+}
+
+func (r *iouring) close() {
+	for _, mem := range [][]byte{r.sqes, r.cqRing, r.sqRing} {
+		if mem != nil {
+			syscall.Munmap(mem)
+		}
+	}
+	syscall.Close(r.fd)
+}
+
+func (r *iouring) field(mem []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mem[off]))
+}
+
+// queue adds an entry to the submission ring (to be submitted by the next enter), returning false if it's full
+func (r *iouring) queue(sqe *iouringSQE) bool {
+	p := &r.params
+	tail := *r.field(r.sqRing, p.sqOff.tail) // only we write the tail
+	if tail-atomic.LoadUint32(r.field(r.sqRing, p.sqOff.head)) >= p.sqEntries {
+		return false
+	}
+	idx := tail & *r.field(r.sqRing, p.sqOff.ringMask)
+	*(*iouringSQE)(unsafe.Pointer(&r.sqes[uintptr(idx)*unsafe.Sizeof(*sqe)])) = *sqe
+	*r.field(r.sqRing, p.sqOff.array+idx*4) = idx
+	atomic.StoreUint32(r.field(r.sqRing, p.sqOff.tail), tail+1)
+	r.pending++
+	return true
+}
+
+// enter submits everything queued, waiting for at least minComplete entries to complete
+func (r *iouring) enter(minComplete uint32) error {
+	var flags uintptr
+	if minComplete > 0 {
+		flags = iouringEnterGetEvents
+	}
+	for {
+		n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(r.pending), uintptr(minComplete), flags,
+			0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return os.NewSyscallError("io_uring_enter", errno)
+		}
+		r.pending -= uint32(n)
+		return nil
+	}
+}
+
+// completed takes the next entry from the completion ring, returning false if there isn't one
+func (r *iouring) completed() (iouringCQE, bool) {
+	p := &r.params
+	head := *r.field(r.cqRing, p.cqOff.head) // only we write the head
+	if head == atomic.LoadUint32(r.field(r.cqRing, p.cqOff.tail)) {
+		return iouringCQE{}, false
+	}
+	idx := head & *r.field(r.cqRing, p.cqOff.ringMask)
+	cqe := *(*iouringCQE)(unsafe.Pointer(&r.cqRing[uintptr(p.cqOff.cqes)+uintptr(idx)*unsafe.Sizeof(iouringCQE{})]))
+	atomic.StoreUint32(r.field(r.cqRing, p.cqOff.head), head+1)
+	return cqe, true
+}
+
+// IOUringPacketIO is an (experimental) packet I/O backend sending and receiving UDP packets through io_uring
+type IOUringPacketIO struct {
+	Entries   uint // number of packets each connection has in flight in each direction (0 = 64)
+	ReusePort bool // open sockets with SO_REUSEPORT, as Config.ReusePortSockets needs
+}
+
+func (io IOUringPacketIO) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	pc, err := udpPacketIO{reusePort: io.ReusePort}.ListenPacket(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	uc := pc.(*net.UDPConn)
+	laddr := uc.LocalAddr().(*net.UDPAddr)
+	file, err := uc.File()
+	uc.Close() // file has a socket of its own
+	if err != nil {
+		return nil, err
+	}
+	entries := uint32(io.Entries)
+	if entries == 0 {
+		entries = iouringDefaultEntries
+	}
+	c, err := newIOUringConn(file, laddr, entries)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// iouringSlot is a buffer and message header for one packet in flight
+type iouringSlot struct {
+	buf  []byte
+	name syscall.RawSockaddrAny
+	iov  syscall.Iovec
+	msg  syscall.Msghdr
+	dest *net.UDPAddr // the address a packet being sent is going to
+}
+
+// prepare fills in the message header for a packet in buf from or to name
+func (slot *iouringSlot) prepare(nameLen uint32) {
+	slot.iov.Base = &slot.buf[0]
+	slot.iov.SetLen(len(slot.buf))
+	slot.msg = syscall.Msghdr{Name: (*byte)(unsafe.Pointer(&slot.name)), Namelen: nameLen, Iov: &slot.iov}
+	slot.msg.Iovlen = 1
+}
+
+// iouringConn is a UDP socket whose packets are sent and received through io_uring
+type iouringConn struct {
+	file      *os.File
+	fd        int
+	laddr     *net.UDPAddr
+	isIPv6    bool         // whether the socket is AF_INET6 (and so sends to IPv4 addresses as IPv4-mapped ones)
+	closed    atomicUint32 // nonzero once we've been closed
+	closeOnce sync.Once
+
+	recvProt  sync.Mutex // must be held to use recv or recvSlots
+	recv      *iouring
+	recvSlots []iouringSlot
+
+	sendProt  sync.Mutex // must be held to use send, sendSlots, sendFree or sendErr
+	send      *iouring
+	sendSlots []iouringSlot
+	sendFree  []int // sendSlots not in flight
+	sendErr   error // an error from an earlier send, to be returned by the next WriteTo
+}
+
+func newIOUringConn(file *os.File, laddr *net.UDPAddr, entries uint32) (*iouringConn, error) {
+	c := &iouringConn{file: file, fd: int(file.Fd()), laddr: laddr}
+	sa, err := syscall.Getsockname(c.fd)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockname", err)
+	}
+	_, c.isIPv6 = sa.(*syscall.SockaddrInet6)
+
+	if c.recv, err = newIOUring(entries); err != nil {
+		return nil, err
+	}
+	if c.send, err = newIOUring(entries); err != nil {
+		c.recv.close()
+		return nil, err
+	}
+	c.recvSlots = make([]iouringSlot, c.recv.params.sqEntries)
+	for idx := range c.recvSlots {
+		c.recvSlots[idx].buf = make([]byte, iouringRecvBufSize)
+		c.postRecv(idx)
+	}
+	c.sendSlots = make([]iouringSlot, c.send.params.sqEntries)
+	for idx := range c.sendSlots {
+		c.sendFree = append(c.sendFree, idx)
+	}
+	return c, nil
+}
+
+// postRecv queues a receive into one of our buffers, to be submitted with the next enter
+func (c *iouringConn) postRecv(idx int) {
+	slot := &c.recvSlots[idx]
+	slot.prepare(syscall.SizeofSockaddrAny)
+	c.recv.queue(&iouringSQE{opcode: iouringOpRecvmsg, fd: int32(c.fd), addr: uint64(uintptr(unsafe.Pointer(&slot.msg))),
+		len: 1, userData: uint64(idx)})
+}
+
+func (c *iouringConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.recvProt.Lock()
+	defer c.recvProt.Unlock()
+	for {
+		if c.closed.get() != 0 {
+			return 0, nil, c.opError("read", nil, errIOUringClosed)
+		}
+		cqe, ok := c.recv.completed()
+		if !ok {
+			// hand back the buffers we're done with, and wait for more to be filled
+			if err := c.recv.enter(1); err != nil {
+				return 0, nil, c.opError("read", nil, err)
+			}
+			continue
+		}
+		idx := int(cqe.userData)
+		slot := &c.recvSlots[idx]
+		if cqe.res < 0 {
+			c.postRecv(idx)
+			return 0, nil, c.opError("read", nil, os.NewSyscallError("recvmsg", syscall.Errno(-cqe.res)))
+		}
+		n := copy(p, slot.buf[:cqe.res])
+		from := sockaddrToUDP(&slot.name)
+		c.postRecv(idx)
+		if from == nil {
+			continue // not something we can reply to
+		}
+		return n, from, nil
+	}
+}
+
+func (c *iouringConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	dest, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, c.opError("write", addr, syscall.EINVAL)
+	}
+	c.sendProt.Lock()
+	defer c.sendProt.Unlock()
+	if c.closed.get() != 0 {
+		return 0, c.opError("write", addr, errIOUringClosed)
+	}
+
+	c.reapSends()
+	for len(c.sendFree) == 0 {
+		if err := c.send.enter(1); err != nil {
+			return 0, c.opError("write", addr, err)
+		}
+		c.reapSends()
+	}
+	if err := c.sendErr; err != nil {
+		c.sendErr = nil
+		return 0, err
+	}
+
+	idx := c.sendFree[len(c.sendFree)-1]
+	slot := &c.sendSlots[idx]
+	slot.buf = append(slot.buf[:0], p...)
+	slot.dest = dest
+	nameLen, ok := c.udpToSockaddr(dest, &slot.name)
+	if !ok {
+		return 0, c.opError("write", addr, syscall.EAFNOSUPPORT)
+	}
+	slot.prepare(nameLen)
+	c.sendFree = c.sendFree[:len(c.sendFree)-1]
+	c.send.queue(&iouringSQE{opcode: iouringOpSendmsg, fd: int32(c.fd), addr: uint64(uintptr(unsafe.Pointer(&slot.msg))),
+		len: 1, userData: uint64(idx)})
+	if err := c.send.enter(0); err != nil {
+		return 0, c.opError("write", addr, err)
+	}
+	return len(p), nil
+}
+
+// reapSends frees the buffers of sends the kernel has finished with, noting the first that failed.  c.sendProt
+// must be held
+func (c *iouringConn) reapSends() {
+	for {
+		cqe, ok := c.send.completed()
+		if !ok {
+			return
+		}
+		idx := int(cqe.userData)
+		if cqe.res < 0 && c.sendErr == nil {
+			c.sendErr = c.opError("write", c.sendSlots[idx].dest, os.NewSyscallError("sendmsg", syscall.Errno(-cqe.res)))
+		}
+		c.sendSlots[idx].dest = nil
+		c.sendFree = append(c.sendFree, idx)
+	}
+}
+
+func (c *iouringConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closed.set(1)
+		// wake a waiting ReadFrom (this "fails" on an unconnected socket, but still wakes its readers)
+		syscall.Shutdown(c.fd, syscall.SHUT_RDWR)
+		c.recvProt.Lock()
+		c.recv.close()
+		c.recvProt.Unlock()
+		c.sendProt.Lock()
+		c.send.close()
+		c.sendProt.Unlock()
+		c.file.Close()
+	})
+	return nil
+}
+
+func (c *iouringConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *iouringConn) SetDeadline(t time.Time) error {
+	return errors.New("Deadlines are not supported by the io_uring backend")
+}
+
+func (c *iouringConn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *iouringConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *iouringConn) opError(op string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Source: c.laddr, Addr: addr, Err: err}
+}
+
+// udpToSockaddr fills in name with the address to send to, returning its length
+func (c *iouringConn) udpToSockaddr(addr *net.UDPAddr, name *syscall.RawSockaddrAny) (uint32, bool) {
+	if !c.isIPv6 {
+		ip4 := addr.IP.To4()
+		if ip4 == nil {
+			return 0, false
+		}
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(name))
+		*sa = syscall.RawSockaddrInet4{Family: syscall.AF_INET}
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+		copy(sa.Addr[:], ip4)
+		return syscall.SizeofSockaddrInet4, true
+	}
+	ip16 := addr.IP.To16()
+	if ip16 == nil {
+		return 0, false
+	}
+	sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(name))
+	*sa = syscall.RawSockaddrInet6{Family: syscall.AF_INET6}
+	port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+	port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+	copy(sa.Addr[:], ip16)
+	if addr.Zone != "" {
+		if ifi, err := net.InterfaceByName(addr.Zone); err == nil {
+			sa.Scope_id = uint32(ifi.Index)
+		}
+	}
+	return syscall.SizeofSockaddrInet6, true
+}
+
+// sockaddrToUDP returns the address a packet was received from
+func sockaddrToUDP(name *syscall.RawSockaddrAny) *net.UDPAddr {
+	switch name.Addr.Family {
+	case syscall.AF_INET:
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(name))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		return &net.UDPAddr{IP: net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]), Port: int(port[0])<<8 | int(port[1])}
+	case syscall.AF_INET6:
+		sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(name))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		addr := &net.UDPAddr{IP: make(net.IP, net.IPv6len), Port: int(port[0])<<8 | int(port[1])}
+		copy(addr.IP, sa.Addr[:])
+		if sa.Scope_id != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.Scope_id)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+//go:build linux && iouring
+// +build linux,iouring
+
+package udt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// listenIOUring opens a connection with the io_uring backend, skipping the test if this kernel (or sandbox) doesn't
+// permit io_uring
+func listenIOUring(tb testing.TB) net.PacketConn {
+	conn, err := IOUringPacketIO{}.ListenPacket(context.Background(), "udp", "127.0.0.1:0")
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EPERM) || os.IsPermission(err) {
+		tb.Skipf("io_uring unavailable: %s", err.Error())
+	}
+	if err != nil {
+		tb.Fatalf("error opening connection: %s", err.Error())
+	}
+	return conn
+}
+
+func TestIOUringPacketIO(t *testing.T) {
+	a := listenIOUring(t)
+	defer a.Close()
+	b := listenIOUring(t)
+	defer b.Close()
+
+	// more packets than the rings hold at once, so buffers are reused in both directions
+	buf := make([]byte, 1500)
+	for i := 0; i < 3*iouringDefaultEntries; i++ {
+		msg := []byte{byte(i), byte(i >> 8), 'x'}
+		if _, err := a.WriteTo(msg, b.LocalAddr()); err != nil {
+			t.Fatalf("error writing packet %d: %s", i, err.Error())
+		}
+		n, from, err := b.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("error reading packet %d: %s", i, err.Error())
+		}
+		if !bytes.Equal(buf[:n], msg) || from.String() != a.LocalAddr().String() {
+			t.Fatalf("read %v from %s, expected %v from %s", buf[:n], from, msg, a.LocalAddr())
+		}
+	}
+
+	// a read waiting for a packet is woken by Close
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := b.ReadFrom(buf)
+		done <- err
+	}()
+	b.Close()
+	if err := <-done; err == nil {
+		t.Error("expected a read on a closed connection to fail")
+	}
+}
+
+func TestIOUringConnection(t *testing.T) {
+	listenIOUring(t).Close()
+	config := DefaultConfig()
+	config.PacketIO = IOUringPacketIO{}
+	serv, server, client := packetIOConnect(t, config, serverPort+95)
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	go client.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+}
+
+func BenchmarkPacketIOThroughput(b *testing.B) {
+	b.Run("udp", func(b *testing.B) {
+		benchmarkPacketIO(b, nil, serverPort+97)
+	})
+	b.Run("io_uring", func(b *testing.B) {
+		listenIOUring(b).Close()
+		benchmarkPacketIO(b, IOUringPacketIO{}, serverPort+99)
+	})
+}
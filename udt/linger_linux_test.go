@@ -0,0 +1,32 @@
+package udt
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cpuTime returns how much CPU time this process has used
+func cpuTime(t *testing.T) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Fatalf("error calling getrusage: %s", err.Error())
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func TestLingerIdle(t *testing.T) {
+	s := &udtSocket{Config: DefaultConfig(), sockShutdown: make(chan struct{}), sockClosed: make(chan struct{}),
+		shutdownEvent: newShutdownLatch(), lingerTimer: time.After(time.Minute)}
+	close(s.sockShutdown)
+	go s.goManageConnection()
+	defer close(s.sockClosed)
+
+	// a lingering connection waits for its linger timer, rather than busily checking whether it has fired
+	const wait = 500 * time.Millisecond
+	start := cpuTime(t)
+	time.Sleep(wait)
+	if used := cpuTime(t) - start; used > wait/2 {
+		t.Errorf("expected a lingering connection to be idle, used %s of CPU in %s", used, wait)
+	}
+}
@@ -3,10 +3,9 @@ package udt
 import (
 	"container/heap"
 	"context"
-	"crypto/sha1"
 	"encoding/binary"
 	"errors"
-	"hash"
+	"fmt"
 	"log"
 	"net"
 	"sync"
@@ -19,6 +18,15 @@ var (
 	endianness = binary.BigEndian
 )
 
+const listenQueueSize = 256 // handshakes that may be waiting for a listener to process them before more are discarded
+
+// listenHandshake is a handshake waiting for a listener to process it
+type listenHandshake struct {
+	m    *multiplexer
+	p    *packet.HandshakePacket
+	from *net.UDPAddr
+}
+
 /*
 Listener implements the io.Listener interface for UDT.
 */
@@ -26,12 +34,20 @@ type listener struct {
 	m              *multiplexer
 	accept         chan *udtSocket
 	closed         chan struct{}
-	synEpoch       uint32
-	synCookie      uint32
-	synHash        hash.Hash
+	synCookies     *synCookies
 	acceptHist     acceptSockHeap
 	acceptHistProt sync.Mutex
 	config         *Config
+	clock          Clock                       // source of time for the listener and the sockets it accepts
+	closeErr       atomicError                 // if set, the reason this listener was shut down
+	closeOnce      sync.Once                   // guards closing the closed channel
+	pending        chan *PendingConn           // connections waiting for AcceptContext (with Config.AcceptPending)
+	pendingHist    map[pendingKey]*PendingConn // connections waiting for a decision, by peer socket and initial sequence
+	pendingProt    sync.Mutex                  // lock must be held before referencing pendingHist (or completing a pending connection)
+	handshakes     chan listenHandshake        // handshakes waiting for goReadHandshakes. Sender is the multiplexer read loop
+	resumption     *resumeTokens               // issues and checks resumption tokens (nil without Config.ResumptionLifetime)
+	conns          map[uint32]*udtSocket       // connections we've accepted (until pruneConns sees they've closed), by socket ID
+	connsProt      sync.Mutex                  // lock must be held before referencing conns
 }
 
 // resolveAddr resolves addr, which may be a literal IP
@@ -44,6 +60,7 @@ func resolveAddr(ctx context.Context, network, addr string) (*net.UDPAddr, error
 		host, port string
 		portnum    int
 	)
+	network = udpNetwork(network)
 	switch network {
 	case "udp", "udp4", "udp6":
 		if addr != "" {
@@ -104,109 +121,194 @@ func resolveAddr(ctx context.Context, network, addr string) (*net.UDPAddr, error
 }
 
 func listenUDT(ctx context.Context, config *Config, network string, addr string) (net.Listener, error) {
-	m, err := multiplexerFor(ctx, network, addr)
+	m, err := multiplexerFor(ctx, config, network, addr)
 	if err != nil {
 		return nil, &net.OpError{Op: "listen", Net: network, Source: nil, Addr: nil, Err: err}
 	}
+	defer m.release()
+	return listenOn(m, config, network)
+}
+
+// listenOn starts a listener on an existing multiplexer
+func listenOn(m *multiplexer, config *Config, network string) (net.Listener, error) {
+	m.configure(config)
 
 	l := &listener{
-		m:         m,
-		synCookie: randUint32(),
-		synEpoch:  randUint32(),
-		accept:    make(chan *udtSocket, 100),
-		closed:    make(chan struct{}, 1),
-		synHash:   sha1.New(), // it's weak but fast, hopefully we don't need *that* much security here
-		config:    config,
+		m:          m,
+		synCookies: newSynCookies(),
+		resumption: newResumeTokens(config.ResumptionLifetime),
+		accept:     make(chan *udtSocket, 100),
+		pending:    make(chan *PendingConn, 100),
+		handshakes: make(chan listenHandshake, listenQueueSize),
+		closed:     make(chan struct{}, 1),
+		config:     config,
+		clock:      configClock(config),
 	}
 
-	if ok := m.listenUDT(l); !ok {
-		return nil, &net.OpError{Op: "listen", Net: network, Source: nil, Addr: m.laddr, Err: errors.New("Port in use")}
+	if err := m.listenUDT(l); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Source: nil, Addr: m.laddr, Err: err}
 	}
-	go l.goBumpSynEpoch()
+	go l.goRotateSynCookies()
+	go l.goReadHandshakes()
 
 	return l, nil
 }
 
-func (l *listener) goBumpSynEpoch() {
+// goRotateSynCookies periodically replaces the secret our syn cookies are made with (and forgets connections that have
+// closed and resumption tokens that have expired), until the listener is closed
+func (l *listener) goRotateSynCookies() {
+	closed := l.closed
+	ticker := l.clock.NewTicker(synCookiePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case _, _ = <-closed:
+			return
+		case <-ticker.C():
+			l.synCookies.rotate()
+			l.resumption.prune(l.clock.Now())
+			l.pruneConns()
+		}
+	}
+}
+
+// goReadHandshakes processes the handshakes queued for this listener, so that anything slow in accepting a connection
+// (such as Config.CanAccept) doesn't hold up the multiplexer's read loop
+func (l *listener) goReadHandshakes() {
 	closed := l.closed
 	for {
 		select {
 		case _, _ = <-closed:
+			l.discardAccepted()
 			return
-		case <-time.After(64 * time.Second):
-			l.synEpoch++
+		case hs := <-l.handshakes:
+			l.readHandshake(hs.m, hs.p, hs.from)
 		}
 	}
 }
 
+// queueHandshake passes a handshake on to goReadHandshakes without blocking, returning false if too many are already
+// waiting and this one has been discarded
+func (l *listener) queueHandshake(m *multiplexer, p *packet.HandshakePacket, from *net.UDPAddr) bool {
+	select {
+	case l.handshakes <- listenHandshake{m: m, p: p, from: from}:
+		return true
+	default:
+		return false
+	}
+}
+
 func (l *listener) Accept() (net.Conn, error) {
-	socket, ok := <-l.accept
-	if ok {
+	if l.config.AcceptPending {
+		for {
+			pc, err := l.AcceptContext(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			if conn, err := pc.Accept(nil); err == nil {
+				return conn, nil
+			}
+		}
+	}
+
+	select {
+	case socket := <-l.accept:
 		return socket, nil
+	case _, _ = <-l.closed:
+		return nil, l.closedError()
+	}
+}
+
+func (l *listener) closedError() error {
+	if err := l.closeErr.get(); err != nil {
+		return err
 	}
-	return nil, errors.New("Listener closed")
+	return errors.New("Listener closed")
 }
 
+// Close stops listening for new connections.  Any blocked Accept calls will return an error, as will any made after
+// this.  This may be called from any goroutine (more than once, although only the first call succeeds)
 func (l *listener) Close() (err error) {
-	a := l.accept
-	c := l.closed
-	l.accept = nil
-	l.closed = nil
-	if a == nil || c == nil {
-		return errors.New("Listener closed")
+	err = errors.New("Listener closed")
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.m.unlistenUDT(l)
+		err = nil
+	})
+	return
+}
+
+// discardAccepted closes any connections that completed their handshake but were never picked up by Accept.  This is
+// called by goReadHandshakes once the listener has been closed, as it's the only thing that adds to l.accept
+func (l *listener) discardAccepted() {
+	for {
+		select {
+		case s := <-l.accept:
+			go s.Close()
+		default:
+			return
+		}
 	}
-	close(a)
-	close(c)
+}
 
-	l.m.unlistenUDT(l)
-	return nil
+// connFailed is called by the multiplexer when the underlying connection has failed
+func (l *listener) connFailed(err error) {
+	l.closeErr.set(err)
+	l.Close()
 }
 
+// Addr returns the local address the listener is accepting connections on, as a *UDTAddr (with no socket ID)
 func (l *listener) Addr() net.Addr {
-	return l.m.laddr
+	return &UDTAddr{UDPAddr: *l.m.laddr}
 }
 
+// genSynCookie returns the syn cookie a peer at the specified address must echo back before we'll accept it
 func (l *listener) genSynCookie(from *net.UDPAddr) uint32 {
-	bCookie := make([]byte, 4)
-	endianness.PutUint32(bCookie, l.synCookie)
-	bPort := make([]byte, 2)
-	endianness.PutUint16(bPort, uint16(from.Port))
-	val := append(bCookie, append([]byte(from.IP), bPort...)...)
-	hash := endianness.Uint32(l.synHash.Sum(val))
-	return ((l.synEpoch & 0x1f) << 11) | (hash & 0x07ff)
-}
-
-func (l *listener) checkSynCookie(cookie uint32, from *net.UDPAddr) (bool, uint32) {
-	newCookie := l.genSynCookie(from)
-	if (newCookie & 0x07ff) != (cookie & 0x07ff) {
-		return false, newCookie
-	}
-	epoch := (cookie & 0xf100) >> 11
-	return (epoch == (l.synEpoch & 0x1f)) || (epoch == ((l.synEpoch - 1) & 0x1f)), newCookie
+	return l.synCookies.generate(from)
 }
 
-// checkValidHandshake checks to see if we want to accept a new connection with this handshake.
-func (l *listener) checkValidHandshake(m *multiplexer, p *packet.HandshakePacket, from *net.UDPAddr) bool {
-	return true
+// checkSynCookie returns true if a handshake's syn cookie is one we recently gave to a peer at its address
+func (l *listener) checkSynCookie(cookie uint32, from *net.UDPAddr) bool {
+	return l.synCookies.check(cookie, from)
 }
 
-func (l *listener) rejectHandshake(m *multiplexer, hsPacket *packet.HandshakePacket, from *net.UDPAddr) {
-	log.Printf("%s (listener) sending handshake(reject) to %s (id=%d)", l.m.laddr.String(), from.String(), hsPacket.SockID)
-	m.sendPacket(from, hsPacket.SockID, 0, &packet.HandshakePacket{
-		UdtVer:   hsPacket.UdtVer,
-		SockType: hsPacket.SockType,
-		ReqType:  packet.HsRefused,
-		SockAddr: from.IP,
-	})
+// checkValidHandshake checks to see if we want to accept a new connection with this handshake,
+// returning the reason to give the peer if we don't
+func (l *listener) checkValidHandshake(m *multiplexer, p *packet.HandshakePacket, from *net.UDPAddr) *RejectError {
+	if p.UdtVer != 4 {
+		return &RejectError{Reason: RejectVersion}
+	}
+	if !validPacketSize(uint(p.MaxPktSize)) {
+		log.Printf("%s (listener) refusing %s, advertised a packet size of %d", l.m.laddr.String(), from.String(),
+			p.MaxPktSize)
+		return &RejectError{Reason: RejectPacketSize,
+			Message: fmt.Sprintf("packet size must be between %d and %d", minMTU4, absMaxDatagramSize)}
+	}
+	if key := l.config.PreSharedKey; len(key) > 0 {
+		if !checkDialerAuth(key, p) {
+			log.Printf("%s (listener) refusing %s, failed to authenticate", l.m.laddr.String(), from.String())
+			return &RejectError{Reason: RejectAuth}
+		}
+	}
+	if missing := missingCapabilities(l.config, p); missing != 0 {
+		log.Printf("%s (listener) refusing %s, doesn't support %s", l.m.laddr.String(), from.String(), missing.String())
+		return &RejectError{Reason: RejectUnsupported, Message: "required " + missing.String()}
+	}
+	return nil
 }
 
 func (l *listener) readHandshake(m *multiplexer, hsPacket *packet.HandshakePacket, from *net.UDPAddr) bool {
+	now := l.clock.Now()
+	resumed, repeat := false, false
+	if hsPacket.ReqType == packet.HsRequest && len(l.config.PreSharedKey) == 0 {
+		resumed, repeat = l.resumption.admit(hsPacket, now)
+	}
 
-	if hsPacket.ReqType == packet.HsRequest {
+	if hsPacket.ReqType == packet.HsRequest && !resumed {
 		newCookie := l.genSynCookie(from)
 		log.Printf("%s (listener) sending handshake(request) to %s (id=%d)", l.m.laddr.String(), from.String(), hsPacket.SockID)
 
-		m.sendPacket(from, hsPacket.SockID, 0, &packet.HandshakePacket{
+		m.sendPacket(nil, from, hsPacket.SockID, 0, &packet.HandshakePacket{
 			UdtVer:     hsPacket.UdtVer,
 			SockType:   hsPacket.SockType,
 			InitPktSeq: hsPacket.InitPktSeq,
@@ -220,53 +322,128 @@ func (l *listener) readHandshake(m *multiplexer, hsPacket *packet.HandshakePacke
 		return true
 	}
 
-	isSYN, _ := l.checkSynCookie(hsPacket.SynCookie, from)
-	if !isSYN {
+	if !resumed && !l.checkSynCookie(hsPacket.SynCookie, from) {
 		return false // ignore packets with failed SYN checks
 	}
 
-	if !l.checkValidHandshake(m, hsPacket, from) {
-		l.rejectHandshake(m, hsPacket, from)
+	if rej := l.checkValidHandshake(m, hsPacket, from); rej != nil {
+		l.refuse(m, hsPacket, from, rej)
 		return false
 	}
 
-	now := time.Now()
-	l.acceptHistProt.Lock()
-	if l.acceptHist != nil {
-		replayWindow := l.config.ListenReplayWindow
-		if replayWindow <= 0 {
-			replayWindow = DefaultConfig().ListenReplayWindow
-		}
-		l.acceptHist.Prune(time.Now().Add(-replayWindow))
-		s, idx := l.acceptHist.Find(hsPacket.SockID, hsPacket.InitPktSeq)
-		if s != nil {
-			l.acceptHist[idx].lastTouch = now
-			l.acceptHistProt.Unlock()
-			return s.readHandshake(m, hsPacket, from)
-		}
+	l.pendingProt.Lock()
+	if pc, ok := l.pendingHist[pendingKey{sockID: hsPacket.SockID, initSeqNo: hsPacket.InitPktSeq}]; ok {
+		// still waiting for a decision on this one
+		pc.lastTouch = now
+		l.pendingProt.Unlock()
+		return true
+	}
+	s := l.findAccepted(hsPacket, now)
+	if s != nil {
+		l.pendingProt.Unlock()
+		return s.readHandshake(m, hsPacket, from)
+	}
+	if repeat {
+		// the connection this handshake created has been forgotten, so this can only be a replay of it
+		l.pendingProt.Unlock()
+		log.Printf("%s (listener) ignoring repeated resumption handshake from %s (id=%d)", l.m.laddr.String(),
+			from.String(), hsPacket.SockID)
+		return false
+	}
+	if m.sockets.connectedTo(from, hsPacket.SockID) != nil {
+		// a new connection from a socket we're already connected to would be indistinguishable from the existing one
+		l.pendingProt.Unlock()
+		log.Printf("Refusing new socket creation from listener, already connected to socket %d at %s", hsPacket.SockID,
+			from.String())
+		l.refuse(m, hsPacket, from, &RejectError{Reason: RejectUnknown, Message: "already connected to that socket"})
+		return false
 	}
-	l.acceptHistProt.Unlock()
 
 	if !l.config.CanAcceptDgram && hsPacket.SockType == packet.TypeDGRAM {
+		l.pendingProt.Unlock()
 		log.Printf("Refusing new socket creation from listener requesting DGRAM")
-		l.rejectHandshake(m, hsPacket, from)
+		l.refuse(m, hsPacket, from, &RejectError{Reason: RejectSockType})
 		return false
 	}
 	if !l.config.CanAcceptStream && hsPacket.SockType == packet.TypeSTREAM {
+		l.pendingProt.Unlock()
 		log.Printf("Refusing new socket creation from listener requesting STREAM")
-		l.rejectHandshake(m, hsPacket, from)
+		l.refuse(m, hsPacket, from, &RejectError{Reason: RejectSockType})
+		return false
+	}
+	if len(l.accept) >= cap(l.accept) || len(l.pending) >= cap(l.pending) {
+		l.pendingProt.Unlock()
+		log.Printf("Refusing new socket creation from listener, too many connections waiting to be accepted")
+		l.refuse(m, hsPacket, from, &RejectError{Reason: RejectBacklog})
 		return false
 	}
 	if l.config.CanAccept != nil {
 		err := l.config.CanAccept(hsPacket, from)
 		if err != nil {
+			l.pendingProt.Unlock()
 			log.Printf("New socket creation from listener rejected by config: %s", err.Error())
-			l.rejectHandshake(m, hsPacket, from)
+			l.refuse(m, hsPacket, from, rejectionFor(err))
 			return false
 		}
 	}
 
-	s := l.m.newSocket(l.config, from, true, hsPacket.SockType == packet.TypeDGRAM)
+	if l.config.AcceptPending {
+		l.holdPending(m, hsPacket, from, now)
+		l.pendingProt.Unlock()
+		return true
+	}
+
+	s, rej := l.completeHandshake(m, l.config, hsPacket, from, now)
+	l.pendingProt.Unlock()
+	if rej != nil {
+		l.refuse(m, hsPacket, from, rej)
+		return false
+	}
+
+	l.accept <- s
+	return true
+}
+
+// findAccepted looks for a socket we've already created in response to this handshake
+func (l *listener) findAccepted(hsPacket *packet.HandshakePacket, now time.Time) *udtSocket {
+	l.acceptHistProt.Lock()
+	defer l.acceptHistProt.Unlock()
+	if l.acceptHist == nil {
+		return nil
+	}
+	replayWindow := l.config.ListenReplayWindow
+	if replayWindow <= 0 {
+		replayWindow = DefaultConfig().ListenReplayWindow
+	}
+	l.acceptHist.Prune(now.Add(-replayWindow))
+	s, idx := l.acceptHist.Find(hsPacket.SockID, hsPacket.InitPktSeq)
+	if s == nil {
+		return nil
+	}
+	l.acceptHist[idx].lastTouch = now
+	return s
+}
+
+// completeHandshake creates the socket for a new connection and responds to its handshake, only remembering the socket
+// once it has accepted the handshake.  l.pendingProt must be held
+func (l *listener) completeHandshake(m *multiplexer, config *Config, hsPacket *packet.HandshakePacket, from *net.UDPAddr,
+	now time.Time) (*udtSocket, *RejectError) {
+	s, err := l.m.newSocket(config, from, hsPacket.SockID, true, hsPacket.SockType == packet.TypeDGRAM)
+	if err != nil {
+		return nil, &RejectError{Reason: RejectUnknown, Message: err.Error()}
+	}
+	if !s.checkValidHandshake(m, hsPacket, from) {
+		s.discard()
+		return nil, &RejectError{Reason: RejectUnknown}
+	}
+	if l.resumption.restore(s, hsPacket, now) || len(l.config.PreSharedKey) > 0 {
+		s.acceptEarlyData(hsPacket)
+	}
+	if !s.readHandshake(m, hsPacket, from) {
+		s.discard()
+		return nil, &RejectError{Reason: RejectUnknown}
+	}
+	l.track(s)
 	l.acceptHistProt.Lock()
 	if l.acceptHist == nil {
 		l.acceptHist = []acceptSockInfo{acceptSockInfo{
@@ -285,15 +462,10 @@ func (l *listener) readHandshake(m *multiplexer, hsPacket *packet.HandshakePacke
 		})
 	}
 	l.acceptHistProt.Unlock()
-	if !s.checkValidHandshake(m, hsPacket, from) {
-		l.rejectHandshake(m, hsPacket, from)
-		return false
-	}
-	if !s.readHandshake(m, hsPacket, from) {
-		l.rejectHandshake(m, hsPacket, from)
-		return false
+	m.hsAccepted.add(1)
+	if hsPacket.ReqType == packet.HsRequest {
+		m.hsResumed.add(1) // only a resumed connection is created straight from its first handshake
 	}
-
-	l.accept <- s
-	return true
+	s.audit(AuditAccepted, nil)
+	return s, nil
 }
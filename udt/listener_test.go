@@ -0,0 +1,136 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestSlowAccept(t *testing.T) {
+	release := make(chan struct{})
+	config := DefaultConfig()
+	config.CanAccept = func(hsPacket *packet.HandshakePacket, from *net.UDPAddr) error {
+		if hsPacket.SockType == packet.TypeDGRAM {
+			<-release // take our time deciding about this one
+		}
+		return nil
+	}
+	serv, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+28))
+	if err != nil {
+		t.Fatalf("error calling Listen: %s", err.Error())
+	}
+	defer serv.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			newSock, err := serv.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- newSock
+		}
+	}()
+
+	client, err := DialUDT("udp", "127.0.0.1:0", serv.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	// while the listener is stuck deciding on a second connection, the first can still hear from its peer
+	slowDial := make(chan error, 1)
+	go func() {
+		slow, err := DialUDT("udp", "127.0.0.1:0", serv.Addr(), false)
+		if err == nil {
+			slow.Close()
+		}
+		slowDial <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	msg := []byte("still listening")
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error calling Read while the listener was busy: %s", err.Error())
+	}
+
+	close(release)
+	if err := <-slowDial; err != nil {
+		t.Errorf("error completing the slow connection: %s", err.Error())
+	}
+	select {
+	case newSock := <-accepted:
+		newSock.Close()
+	case <-time.After(time.Second):
+		t.Error("slow connection was never accepted")
+	}
+}
+
+func TestInvalidHandshake(t *testing.T) {
+	a, b := newPipeConns()
+	defer b.Close()
+	mx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer mx.Close()
+	nl, err := mx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer nl.Close()
+	l := nl.(*listener)
+	multiplexersProt.Lock()
+	refs := l.m.refs
+	multiplexersProt.Unlock()
+
+	// a handshake the new socket finds invalid leaves nothing behind
+	from := b.LocalAddr().(*net.UDPAddr)
+	hs := &packet.HandshakePacket{UdtVer: 4, SockType: packet.TypeSTREAM, ReqType: packet.HsResponse,
+		InitPktSeq: packet.PacketID{Seq: 100}, MaxPktSize: 10, MaxFlowWinSize: 8192, SockID: 1234,
+		SynCookie: l.genSynCookie(from), SockAddr: from.IP}
+	l.pendingProt.Lock()
+	s, rej := l.completeHandshake(l.m, l.config, hs, from, l.clock.Now())
+	l.pendingProt.Unlock()
+	if s != nil || rej == nil {
+		t.Fatal("expected a handshake advertising a 10-byte packet size to be refused")
+	}
+	if socks := l.m.sockets.all(); len(socks) != 0 {
+		t.Errorf("expected the refused socket to be unregistered, found %d sockets", len(socks))
+	}
+	if conns := l.Connections(); len(conns) != 0 {
+		t.Errorf("expected the refused socket not to be tracked, found %d connections", len(conns))
+	}
+	if s := l.findAccepted(hs, l.clock.Now()); s != nil {
+		t.Error("expected the refused socket not to be remembered as accepted")
+	}
+	multiplexersProt.Lock()
+	if l.m.refs != refs {
+		t.Errorf("expected the refused socket to release the multiplexer, %d references became %d", refs, l.m.refs)
+	}
+	multiplexersProt.Unlock()
+
+	// so a corrected handshake from the same socket gets a connection of its own
+	hs.MaxPktSize = 1500
+	if !l.readHandshake(l.m, hs, from) {
+		t.Fatal("expected a valid handshake to be accepted")
+	}
+	select {
+	case s := <-l.accept:
+		defer s.Close()
+	default:
+		t.Fatal("expected the valid handshake to be waiting to be accepted")
+	}
+}
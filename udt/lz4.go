@@ -0,0 +1,151 @@
+package udt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+/*
+An LZ4 block (https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md) is a series of sequences, each a run of
+literal bytes followed by a match copying earlier output.  A token byte holds both lengths (the match length less the
+minimum of 4), each followed by more length bytes if it doesn't fit in its four bits, then come the literals and the
+two byte little-endian offset back to the match.  The last sequence is only literals.
+
+Matches are found through a hash table of the last position each four byte prefix was seen at, without any search for
+a longer match, as the reference compressor does at its fastest setting.
+*/
+
+const (
+	lz4MinMatch      = 4      // shortest match that can be encoded
+	lz4HashLog       = 10     // bits in the index of the match table
+	lz4MatchLimit    = 12     // matches can't start in this many bytes at the end of the block
+	lz4LastLiterals  = 5      // the block must end with at least this many literal bytes
+	lz4MaxOffset     = 0xFFFF // furthest back a match can be
+	lz4ExtendedLen   = 15     // a length of this in the token is continued in the following bytes
+	lz4PrimeMultiple = 2654435761
+)
+
+// lz4Table is the positions (plus one, with zero unused) that four byte prefixes were last seen at
+type lz4Table [1 << lz4HashLog]int32
+
+// lz4Compress appends the LZ4 block for src to dst
+func lz4Compress(dst []byte, src []byte, table *lz4Table) []byte {
+	*table = lz4Table{}
+	anchor := 0
+	for pos := 0; pos < len(src)-lz4MatchLimit; {
+		seq := binary.LittleEndian.Uint32(src[pos:])
+		hash := (seq * lz4PrimeMultiple) >> (32 - lz4HashLog)
+		ref := int(table[hash]) - 1
+		table[hash] = int32(pos + 1)
+		if ref < 0 || pos-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			pos++
+			continue
+		}
+
+		end := pos + lz4MinMatch
+		for end < len(src)-lz4LastLiterals && src[end] == src[ref+end-pos] {
+			end++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:pos], pos-ref, end-pos)
+		pos, anchor = end, end
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence appends a sequence of literals followed by a match (or none, for the last sequence of a block)
+func lz4AppendSequence(dst []byte, literals []byte, offset int, matchLen int) []byte {
+	litToken := len(literals)
+	if litToken > lz4ExtendedLen {
+		litToken = lz4ExtendedLen
+	}
+	matchToken := 0
+	if matchLen > 0 {
+		matchToken = matchLen - lz4MinMatch
+		if matchToken > lz4ExtendedLen {
+			matchToken = lz4ExtendedLen
+		}
+	}
+	dst = append(dst, byte(litToken<<4|matchToken))
+	dst = lz4AppendLength(dst, len(literals))
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	return lz4AppendLength(dst, matchLen-lz4MinMatch)
+}
+
+// lz4AppendLength appends the bytes continuing a length that doesn't fit in its token
+func lz4AppendLength(dst []byte, n int) []byte {
+	if n < lz4ExtendedLen {
+		return dst
+	}
+	for n -= lz4ExtendedLen; n >= 0xFF; n -= 0xFF {
+		dst = append(dst, 0xFF)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress returns the contents of an LZ4 block, refusing to expand it beyond maxLen
+func lz4Decompress(src []byte, maxLen int) ([]byte, error) {
+	errCorrupt := errors.New("Corrupt LZ4 payload")
+	errTooLarge := errors.New("Compressed payload expands beyond the maximum packet size")
+	dst := make([]byte, 0, maxLen)
+	pos := 0
+	readLength := func(n int) (int, bool) {
+		if n < lz4ExtendedLen {
+			return n, true
+		}
+		for pos < len(src) && n <= maxLen {
+			b := src[pos]
+			pos++
+			n += int(b)
+			if b != 0xFF {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	for pos < len(src) {
+		token := src[pos]
+		pos++
+		litLen, ok := readLength(int(token >> 4))
+		if !ok || litLen > len(src)-pos {
+			return nil, errCorrupt
+		}
+		if len(dst)+litLen > maxLen {
+			return nil, errTooLarge
+		}
+		dst = append(dst, src[pos:pos+litLen]...)
+		pos += litLen
+		if pos == len(src) {
+			return dst, nil // the last sequence, with no match
+		}
+
+		if len(src)-pos < 2 {
+			return nil, errCorrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[pos:]))
+		pos += 2
+		matchLen, ok := readLength(int(token & 0xF))
+		if !ok || offset == 0 || offset > len(dst) {
+			return nil, errCorrupt
+		}
+		matchLen += lz4MinMatch
+		if len(dst)+matchLen > maxLen {
+			return nil, errTooLarge
+		}
+		from := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[from:from+matchLen]...)
+			continue
+		}
+		// byte by byte, as the match overlaps what it's copying
+		for ; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[from])
+			from++
+		}
+	}
+	return nil, errCorrupt // blocks end with literals
+}
@@ -0,0 +1,114 @@
+package udt
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.MemoryLimit bounds the memory held by all the connections sharing a local address: the packets each has sent
+but not yet had acknowledged (kept for retransmission), the packets each has received but can't yet deliver (waiting
+for a missing packet or the rest of a message), and the loss lists of both.  Packets are counted at the full packet
+size, as that's what their buffers take up whatever they carry.
+
+The budget is shared equally between the connections, so one busy connection can't starve the others.  A connection
+that has used its share stops sending new data until some of it is acknowledged (so Write blocks, as it would with a
+full flow window), and discards data packets that it would otherwise have to hold on to (which the peer retransmits
+once it learns they were lost).  A connection holding nothing is always allowed a single packet, so every connection
+can make progress however many share the budget.
+*/
+
+const (
+	sendLossEntrySize = uint64(unsafe.Sizeof(packet.PacketID{}))
+	recvLossEntrySize = uint64(unsafe.Sizeof(recvLossEntry{}))
+)
+
+// socketMemory is the memory counted against the budget for a single socket
+type socketMemory struct {
+	send uint64 // held by the sending side
+	recv uint64 // held by the receiving side
+}
+
+// memoryBudget tracks the memory held by the sockets sharing a multiplexer, see Config.MemoryLimit
+type memoryBudget struct {
+	limit atomicUint64 // the most memory the sockets may hold together (0 = unlimited)
+	prot  sync.Mutex   // lock must be held before referencing used or sockets
+	used  uint64
+	socks map[uint32]*socketMemory // by socket ID
+}
+
+// join starts counting memory held by the specified socket
+func (b *memoryBudget) join(sockID uint32) {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	if b.socks == nil {
+		b.socks = make(map[uint32]*socketMemory)
+	}
+	b.socks[sockID] = &socketMemory{}
+}
+
+// leave stops counting memory held by the specified socket, releasing anything it was holding
+func (b *memoryBudget) leave(sockID uint32) {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	if mem, ok := b.socks[sockID]; ok {
+		b.used -= mem.send + mem.recv
+		delete(b.socks, sockID)
+	}
+}
+
+// update records how much memory one side of a socket is now holding
+func (b *memoryBudget) update(sockID uint32, isSend bool, size uint64) {
+	if b.limit.get() == 0 {
+		return
+	}
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	mem, ok := b.socks[sockID]
+	if !ok {
+		return // already closed
+	}
+	held := &mem.recv
+	if isSend {
+		held = &mem.send
+	}
+	b.used += size - *held
+	*held = size
+}
+
+// allows returns true if a socket may take on another size bytes
+func (b *memoryBudget) allows(sockID uint32, size uint64) bool {
+	limit := b.limit.get()
+	if limit == 0 {
+		return true
+	}
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	mem, ok := b.socks[sockID]
+	if !ok || mem.send+mem.recv == 0 {
+		return true
+	}
+	share := limit / uint64(len(b.socks))
+	return mem.send+mem.recv+size <= share && b.used+size <= limit
+}
+
+// getUsed returns the memory currently held by the sockets sharing this budget
+func (b *memoryBudget) getUsed() uint64 {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	return b.used
+}
+
+// updateMemory records the memory the sending side is holding against the multiplexer's budget
+func (s *udtSocketSend) updateMemory() {
+	size := uint64(len(s.sendPktPend))*uint64(s.socket.mtu.get()) + uint64(len(s.sendLossList))*sendLossEntrySize
+	s.socket.m.mem.update(s.socket.sockID, true, size)
+}
+
+// updateMemory records the memory the receiving side is holding against the multiplexer's budget
+func (s *udtSocketRecv) updateMemory() {
+	size := uint64(len(s.recvPktPend))*uint64(s.socket.mtu.get()) + uint64(len(s.recvLossList))*recvLossEntrySize
+	s.socket.m.mem.update(s.socket.sockID, false, size)
+}
@@ -0,0 +1,80 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	var b memoryBudget
+	b.join(1)
+	b.join(2)
+	if !b.allows(1, 1<<30) {
+		t.Error("expected no limit to allow anything")
+	}
+	b.update(1, true, 300) // ignored without a limit
+	if used := b.getUsed(); used != 0 {
+		t.Errorf("expected nothing to be counted without a limit, got %d", used)
+	}
+
+	b.limit.set(1000)
+	b.update(1, true, 300)
+	b.update(1, false, 100)
+	if !b.allows(1, 100) {
+		t.Error("expected a socket to be allowed up to its share")
+	}
+	if b.allows(1, 101) {
+		t.Error("expected a socket to be refused beyond its share")
+	}
+	if !b.allows(2, 1000) {
+		t.Error("expected a socket holding nothing to be allowed a packet")
+	}
+
+	// the share grows as sockets leave, and what they held is released
+	b.update(2, false, 200)
+	b.join(3)
+	if b.allows(1, 0) {
+		t.Error("expected a socket over its share to be refused")
+	}
+	b.leave(3)
+	b.leave(2)
+	if used := b.getUsed(); used != 400 {
+		t.Errorf("expected 400 bytes held after sockets left, got %d", used)
+	}
+	if !b.allows(1, 600) || b.allows(1, 601) {
+		t.Error("expected the only socket left to have the whole budget")
+	}
+	b.update(2, false, 500) // already left
+	if used := b.getUsed(); used != 400 {
+		t.Errorf("expected updates from sockets that have left to be ignored, got %d held", used)
+	}
+}
+
+func TestMemoryLimitTransfer(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxPacketSize = 1500
+	config.MemoryLimit = 32 * 1500 // room for a few dozen packets between both ends
+	serv, client, server := connectWithClock(t, 76, defaultClock, config)
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+
+	// the sender has to wait for acknowledgements to make room, rather than filling its flow window
+	msg := bytes.Repeat([]byte("memory budget "), 20000)
+	go func() {
+		if _, err := client.Write(msg); err != nil {
+			t.Errorf("error calling Write: %s", err.Error())
+		}
+	}()
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error calling Read: %s", err.Error())
+	}
+	if !bytes.Equal(buf, msg) {
+		t.Error("received data doesn't match what was sent")
+	}
+	if used := client.Stats().ByteMemUsed; used > config.MemoryLimit {
+		t.Errorf("%d bytes held, over the limit of %d", used, config.MemoryLimit)
+	}
+}
@@ -0,0 +1,25 @@
+package udt
+
+import (
+	"fmt"
+	"time"
+)
+
+// MessageInfo describes how a message was received on a datagram connection
+type MessageInfo struct {
+	MsgNum    uint32        // message number assigned by the sender
+	InOrder   bool          // the sender required this message to be delivered after all prior messages
+	SendTime  time.Duration // when the message was sent, relative to when the sender created its connection
+	Truncated bool          // parts of this message could not be recovered, and only what was received is returned
+}
+
+// ErrMessageTruncated is returned from Read on a datagram connection when the message didn't fit in the buffer
+// passed to it.  As much of the message as fit is returned and the rest is discarded; PeekMessageSize can be used to
+// size the buffer beforehand
+type ErrMessageTruncated struct {
+	Size int // length of the whole message
+}
+
+func (e *ErrMessageTruncated) Error() string {
+	return fmt.Sprintf("Message truncated (message is %d bytes)", e.Size)
+}
@@ -0,0 +1,133 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// datagramPipe connects a pair of datagram connections in memory
+func datagramPipe(t *testing.T) (Conn, Conn) {
+	a, b := newPipeConns()
+	amx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer amx.Close()
+	bmx, err := NewMultiplexerWithConn(b, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer bmx.Close()
+
+	l, err := amx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	client, err := bmx.Dial(context.Background(), amx.Addr(), false)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	return (<-accepted).(Conn), client.(Conn)
+}
+
+func TestMessageTruncated(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	for _, msg := range []string{"hello world", "goodbye"} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+
+	buf := make([]byte, 5)
+	n, err := server.Read(buf)
+	var trunc *ErrMessageTruncated
+	if !errors.As(err, &trunc) || trunc.Size != 11 {
+		t.Fatalf("expected ErrMessageTruncated{Size: 11}, got %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("truncated read returned %q", buf[:n])
+	}
+
+	// peeking leaves the message to be read
+	size, err := server.PeekMessageSize()
+	if err != nil || size != 7 {
+		t.Fatalf("PeekMessageSize returned %d, %v", size, err)
+	}
+	buf = make([]byte, size)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "goodbye" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+}
+
+func TestEmptyMessage(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	for _, msg := range []string{"", "after", ""} {
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+	buf := make([]byte, 16)
+	for _, expected := range []string{"", "after", ""} {
+		n, err := server.Read(buf)
+		if err != nil || string(buf[:n]) != expected {
+			t.Errorf("expected %q, read %q, %v", expected, buf[:n], err)
+		}
+	}
+	server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if size, err := server.PeekMessageSize(); err == nil {
+		t.Errorf("expected no more messages, PeekMessageSize returned %d", size)
+	}
+}
+
+func TestCloseWithFullQueue(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer client.Close()
+
+	// fill the server's queue of messages waiting to be read
+	s := server.(*udtSocket)
+	for i := 0; i < cap(s.messageIn)+16; i++ {
+		if _, err := client.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.messageIn) < cap(s.messageIn) {
+		if time.Now().After(deadline) {
+			t.Fatal("messages weren't queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// closing doesn't have to wait for room in the queue, and readers get what was queued before an error
+	s.CloseWithError(CloseNormal, "")
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16)
+	for i := 0; ; i++ {
+		if _, err := server.Read(buf); err != nil {
+			if i == 0 {
+				t.Errorf("no messages read before error %v", err)
+			}
+			if errors.Is(err, syscall.ETIMEDOUT) {
+				t.Error("read timed out instead of reporting the connection closed")
+			}
+			break
+		}
+	}
+}
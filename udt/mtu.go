@@ -0,0 +1,138 @@
+package udt
+
+import (
+	"errors"
+	"log"
+	"net"
+	"syscall"
+)
+
+/*
+Packets are sent without permitting fragmentation, so if the path to our peer can't carry packets as large as the size
+negotiated in the handshake (such as after a route change onto a tunnel), the kernel refuses to send them with EMSGSIZE,
+either because they're larger than the local interface or because an ICMP "fragmentation needed" message from a router
+has lowered its idea of the path MTU.
+
+When that happens the connection steps its packet size down to the next common MTU below the refused packet and calls
+Config.OnMTUChange.  Data not yet split into packets is split at the new size.  Packets already sent at the old size
+(which may have to be retransmitted) can't be split without renumbering them, so they are sent permitting
+fragmentation instead, where the platform allows it.
+
+Jumbo frames (or larger datagrams still, such as over loopback) are used by setting Config.MaxPacketSize to suit on both
+ends, as each end advertises the largest packet it will send or receive and the smaller of the two is used.  The
+multiplexer's buffers are sized for the largest packet IP can carry, so any size that's negotiated fits them.  A peer
+advertising a size smaller than every IPv4 path must carry, or larger than IP can carry, is refused (with
+RejectPacketSize) rather than letting it shrink our packets to nothing.
+*/
+
+// mtuSteps are the packet sizes we step down through when the path MTU turns out to be smaller than we expected
+var mtuSteps = []uint{9000, 1500, 1492, 1480, 1400, 1280, 1200, 576}
+
+const (
+	minMTU4 = 576  // the smallest packet size every IPv4 path must carry
+	minMTU6 = 1280 // the smallest packet size every IPv6 path must carry
+)
+
+// validPacketSize returns true if a maximum packet size (including the IP and UDP headers) is one we can use: at least
+// as large as every IPv4 path must carry, and no larger than IP can carry
+func validPacketSize(size uint) bool {
+	return size >= minMTU4 && size <= absMaxDatagramSize
+}
+
+// smallerMTU returns the packet size to step down to after a packet of size bytes was refused, or zero if there's
+// nothing smaller we can use
+func smallerMTU(size uint, isIPv6 bool) uint {
+	min := uint(minMTU4)
+	if isIPv6 {
+		min = minMTU6
+	}
+	for _, step := range mtuSteps {
+		if step < size && step >= min {
+			return step
+		}
+	}
+	return 0
+}
+
+// pathMTUExceeded is called by the multiplexer when a packet of size bytes (including the IP and UDP headers) was
+// too large to send, lowering our packet size if we haven't already
+func (s *udtSocket) pathMTUExceeded(size uint) {
+	for {
+		mtu := s.mtu.get()
+		if uint(mtu) < size {
+			return // this is an older packet, we've already lowered our packet size since it was sent
+		}
+		next := smallerMTU(size, s.raddr.IP.To4() == nil)
+		if next == 0 {
+			return
+		}
+		if s.mtu.compareAndSwap(mtu, uint32(next)) {
+			log.Printf("%s lowering packet size to %d after a %d byte packet couldn't be sent", s.m.laddr.String(),
+				next, size)
+			break
+		}
+	}
+	s.mtuLowered()
+}
+
+// mtuLowered tells our sender that our packet size has been lowered
+func (s *udtSocket) mtuLowered() {
+	select {
+	case s.mtuEvent <- struct{}{}:
+	default: // the sender hasn't yet noticed a previous change, it'll see this one too
+	}
+}
+
+// notifyMTU passes our current packet size to Config.OnMTUChange
+func (s *udtSocket) notifyMTU() {
+	if onMTUChange := s.Config.OnMTUChange; onMTUChange != nil {
+		onMTUChange(s, uint(s.mtu.get()))
+	}
+}
+
+// writeTo writes a serialized packet to the underlying connection.  If it's too large to send unfragmented, the
+// sending socket is told to use smaller packets, and the packet is sent again permitting fragmentation.  A packet
+// larger than the sending socket has since stepped down to is sent permitting fragmentation to begin with
+func (m *multiplexer) writeTo(buf []byte, pw packetWrapper) error {
+	if pw.from != nil && m.exceedsMTU(len(buf), pw) {
+		if uc, ok := m.conn.(*net.UDPConn); ok && sendFragmented(uc, buf, pw.dest) == nil {
+			m.pktOut.add(1)
+			m.trace(true, 0, pw.dest, buf, pw.pkt)
+			return nil
+		}
+	}
+	_, err := m.conn.WriteTo(buf, pw.dest)
+	if err == nil {
+		m.pktOut.add(1)
+		m.trace(true, 0, pw.dest, buf, pw.pkt)
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) {
+		return err
+	}
+	if pw.from != nil {
+		if pw.dest.IP.To4() != nil {
+			pw.from.pathMTUExceeded(uint(len(buf) + udp4HeaderSize))
+		} else {
+			pw.from.pathMTUExceeded(uint(len(buf) + udp6HeaderSize))
+		}
+	}
+	if uc, ok := m.conn.(*net.UDPConn); ok {
+		if ferr := sendFragmented(uc, buf, pw.dest); ferr == nil {
+			m.pktOut.add(1)
+			m.trace(true, 0, pw.dest, buf, pw.pkt)
+			return nil
+		}
+	}
+	return err
+}
+
+// exceedsMTU returns true if a serialized packet is larger than the packet size its socket is now using
+func (m *multiplexer) exceedsMTU(size int, pw packetWrapper) bool {
+	if pw.dest.IP.To4() != nil {
+		size += udp4HeaderSize
+	} else {
+		size += udp6HeaderSize
+	}
+	return uint(size) > uint(pw.from.mtu.get())
+}
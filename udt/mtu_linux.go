@@ -0,0 +1,42 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+)
+
+// sendFragmented sends a datagram on conn, permitting it to be fragmented
+func sendFragmented(conn *net.UDPConn, b []byte, dest *net.UDPAddr) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	level, opt := syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER
+	if dest.IP.To4() == nil {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER
+	}
+	var mode int
+	var sockErr error
+	if err = rc.Control(func(fd uintptr) {
+		if mode, sockErr = syscall.GetsockoptInt(int(fd), level, opt); sockErr == nil {
+			sockErr = syscall.SetsockoptInt(int(fd), level, opt, syscall.IP_PMTUDISC_DONT)
+		}
+	}); err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return sockErr
+	}
+
+	// only the multiplexer's write goroutine sends on conn, so nothing else is sent while fragmentation is permitted
+	_, err = conn.WriteTo(b, dest)
+	if rerr := rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), level, opt, mode)
+	}); rerr != nil {
+		sockErr = rerr
+	}
+	if err == nil {
+		err = sockErr
+	}
+	return err
+}
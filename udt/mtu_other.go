@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import (
+	"errors"
+	"net"
+)
+
+// sendFragmented sends a datagram on conn, permitting it to be fragmented
+func sendFragmented(conn *net.UDPConn, b []byte, dest *net.UDPAddr) error {
+	return errors.New("Sending fragmented packets is not supported on this platform")
+}
@@ -0,0 +1,268 @@
+package udt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// tooBigConn is a PacketConn that refuses to send anything larger than a given size, as the kernel does once it has
+// learned of a smaller path MTU
+type tooBigConn struct {
+	net.PacketConn
+	limit int
+	sent  [][]byte
+}
+
+func (c *tooBigConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > c.limit {
+		return 0, &net.OpError{Op: "write", Net: "udp", Addr: addr, Err: syscall.EMSGSIZE}
+	}
+	c.sent = append(c.sent, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestSmallerMTU(t *testing.T) {
+	tests := []struct {
+		size   uint
+		isIPv6 bool
+		expect uint
+	}{
+		{65535, false, 9000},
+		{1500, false, 1492},
+		{1400, false, 1280},
+		{1280, true, 0},
+		{1280, false, 1200},
+		{576, false, 0},
+	}
+	for _, test := range tests {
+		if mtu := smallerMTU(test.size, test.isIPv6); mtu != test.expect {
+			t.Errorf("after a %d byte packet (IPv6 %v) expected to step down to %d, got %d", test.size, test.isIPv6,
+				test.expect, mtu)
+		}
+	}
+}
+
+func TestPathMTUExceeded(t *testing.T) {
+	var notified uint
+	config := DefaultConfig()
+	config.OnMTUChange = func(conn Conn, mtu uint) {
+		notified = mtu
+	}
+	conn := &tooBigConn{limit: 1400}
+	m := &multiplexer{conn: conn, laddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, mtu: 1500}
+	s := &udtSocket{m: m, Config: config, raddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 9000},
+		mtu: atomicUint32{val: 1500}, mtuEvent: make(chan struct{}, 1)}
+
+	// a full-sized packet is refused, so the socket steps down to the next size
+	pw := packetWrapper{pkt: &packet.DataPacket{}, dest: s.raddr, from: s}
+	if err := m.writeTo(make([]byte, 1500-udp4HeaderSize), pw); err == nil {
+		t.Error("expected an error sending a packet that's too large")
+	}
+	if mtu := s.mtu.get(); mtu != 1492 {
+		t.Errorf("expected the packet size to be lowered to 1492, got %d", mtu)
+	}
+
+	// another packet of the old size (such as a retransmission) doesn't lower it again
+	m.writeTo(make([]byte, 1500-udp4HeaderSize), pw)
+	if mtu := s.mtu.get(); mtu != 1492 {
+		t.Errorf("expected an older packet not to lower the packet size further, got %d", mtu)
+	}
+	select {
+	case <-s.mtuEvent:
+		s.notifyMTU()
+	default:
+		t.Fatal("the sender wasn't told about the change")
+	}
+	if notified != 1492 {
+		t.Errorf("expected OnMTUChange to be called with 1492, got %d", notified)
+	}
+
+	// while packets of the new size still don't fit, we keep stepping down
+	m.writeTo(make([]byte, 1492-udp4HeaderSize), pw)
+	if mtu := s.mtu.get(); mtu != 1480 {
+		t.Errorf("expected the packet size to be lowered to 1480, got %d", mtu)
+	}
+	if err := m.writeTo(make([]byte, 1400-udp4HeaderSize), pw); err != nil || len(conn.sent) != 1 {
+		t.Errorf("expected a packet that fits to be sent, got %v", err)
+	}
+}
+
+func TestJumboPackets(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxPacketSize = 9000
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if mtu := a.(*udtSocket).mtu.get(); mtu != 9000 {
+		t.Fatalf("expected a packet size of 9000, negotiated %d", mtu)
+	}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	go a.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(b, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+	perPacket := 9000 - udtHeaderSize - udp4HeaderSize
+	if sent := a.(Conn).Stats().PktSent; sent > uint64(len(data)/perPacket+1) {
+		t.Errorf("expected %d byte payloads, sent %d packets for %d bytes", perPacket, sent, len(data))
+	}
+}
+
+func TestPacketSizeValidation(t *testing.T) {
+	l, err := DefaultConfig().Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+116))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	serv := l.(*listener)
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: clientPort + 116}
+	for size, valid := range map[uint32]bool{0: false, 100: false, 576: true, 1500: true, 9000: true, 65535: true, 1 << 20: false} {
+		hs := &packet.HandshakePacket{UdtVer: 4, SockType: packet.TypeSTREAM, ReqType: packet.HsResponse, MaxPktSize: size}
+		rej := serv.checkValidHandshake(serv.m, hs, from)
+		if valid && rej != nil {
+			t.Errorf("expected a packet size of %d to be accepted, refused with %v", size, rej)
+		} else if !valid && (rej == nil || rej.Reason != RejectPacketSize) {
+			t.Errorf("expected a packet size of %d to be refused, got %v", size, rej)
+		}
+	}
+
+	// our own packet size can't be configured any smaller than the minimum either
+	config := DefaultConfig()
+	config.MaxPacketSize = 100
+	s, err := serv.m.newSocket(config, from, 1, false, false)
+	if err != nil {
+		t.Fatalf("error creating socket: %s", err.Error())
+	}
+	defer serv.m.closeSocket(s.sockID)
+	if mtu := s.mtu.get(); mtu != minMTU4 {
+		t.Errorf("expected a packet size of %d, got %d", minMTU4, mtu)
+	}
+}
+
+// blackholeConn is a PacketConn that silently drops anything larger than a given size, as some paths do, until lifted
+// is set (standing in for the oversized packets being fragmented once the sender has stepped down)
+type blackholeConn struct {
+	net.PacketConn
+	limit   int
+	lifted  int32
+	dropped int32
+}
+
+func (c *blackholeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > c.limit && atomic.LoadInt32(&c.lifted) == 0 {
+		atomic.AddInt32(&c.dropped, 1)
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestBlackholeMTU(t *testing.T) {
+	tests := []struct{ mtu, expect uint }{{65535, 1500}, {9000, 1500}, {1500, 1400}, {1492, 1400}, {1400, 1280}, {1280, 0}}
+	for _, test := range tests {
+		if mtu := blackholeMTU(test.mtu); mtu != test.expect {
+			t.Errorf("expected packets of %d bytes to step down to %d, got %d", test.mtu, test.expect, mtu)
+		}
+	}
+}
+
+func TestMTUBlackhole(t *testing.T) {
+	a, b := newPipeConns()
+	conn := &blackholeConn{PacketConn: b, limit: 1400 - udp4HeaderSize}
+	notified := make(chan uint, 4)
+	config := DefaultConfig()
+	config.MaxPacketSize = 1500
+	config.OnMTUChange = func(c Conn, mtu uint) {
+		atomic.StoreInt32(&conn.lifted, 1)
+		notified <- mtu
+	}
+	servMx, err := NewMultiplexerWithConn(a, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(conn, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := clientMx.Dial(ctx, servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 8*1024)
+	go client.Write(data)
+	got := make([]byte, len(data))
+	server.SetReadDeadline(time.Now().Add(20 * time.Second))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+	select {
+	case mtu := <-notified:
+		if mtu != 1400 {
+			t.Errorf("expected to step down to 1400, stepped down to %d", mtu)
+		}
+	default:
+		t.Error("expected OnMTUChange to be called")
+	}
+	if atomic.LoadInt32(&conn.dropped) == 0 {
+		t.Error("expected large packets to be dropped")
+	}
+	if mtu := client.(*udtSocket).mtu.get(); mtu != 1400 {
+		t.Errorf("expected a packet size of 1400, got %d", mtu)
+	}
+}
+
+func TestDatagramSizeLimit(t *testing.T) {
+	// an interface can claim a larger MTU than a datagram can carry
+	ifaces := []net.Interface{{MTU: 1500, Flags: net.FlagUp}, {MTU: 70000, Flags: net.FlagUp}}
+	if mtu := interfaceMTU(ifaces); mtu != 65535 {
+		t.Errorf("expected a packet size of 65535, got %d", mtu)
+	}
+
+	// and the packet size includes the IP and UDP headers, so a full data packet must still fit in a datagram
+	ss := &udtSocketSend{socket: &udtSocket{}}
+	ss.socket.mtu.set(65535)
+	for _, tc := range []struct {
+		ip      net.IP
+		headers int // IP and UDP
+	}{{net.IPv4(127, 0, 0, 1), 28}, {net.IPv6loopback, 48}} {
+		ss.socket.raddr = &net.UDPAddr{IP: tc.ip, Port: 1}
+		if size := ss.maxPayloadSize() + udtHeaderSize + tc.headers; size > 65535 {
+			t.Errorf("expected a full data packet to %s to fit in a datagram, got %d bytes", tc.ip, size)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Multipath connections (experimental, not part of the UDT specification)
+
+A connection normally runs over the single UDP 4-tuple it was established with.  AddPath allows additional
+local/remote address pairs to be attached to an established connection, after which packets are scheduled across
+all of the connection's paths.  A new path is joined by sending a join request over it to the peer, which
+identifies the connection by its socket ID and initial packet sequence (both sides must be communicating with each
+other through the same multiplexers that opened the paths).  Each path is probed periodically to track its
+roundtrip time and probe loss, which the scheduler may use to pick a path.
+*/
+
+// MultipathScheduler selects how packets are spread across the paths of a multipath connection
+type MultipathScheduler int
+
+const (
+	// MultipathRoundRobin sends each packet on the next path in turn
+	MultipathRoundRobin MultipathScheduler = iota
+	// MultipathLowestRTT sends each packet on the path with the lowest measured roundtrip time
+	MultipathLowestRTT
+	// MultipathRedundant sends every data packet on every path (control packets take the lowest-RTT path)
+	MultipathRedundant
+)
+
+// UserDefControlPacket message types used to manage multipath connections
+const (
+	mpJoinMsgType       uint16 = 0x4D4A // request to add the path this packet arrived on
+	mpJoinAckMsgType    uint16 = 0x4D41 // the path this packet arrived on has been added
+	mpProbeMsgType      uint16 = 0x4D50 // roundtrip time probe, to be echoed back on the same path
+	mpProbeReplyMsgType uint16 = 0x4D52 // reply to a roundtrip time probe
+)
+
+// PathStats contains measurements for a single path of a (possibly multipath) connection
+type PathStats struct {
+	LocalAddr  net.Addr      // local address of this path
+	RemoteAddr net.Addr      // remote address of this path
+	PktSent    uint64        // number of packets sent on this path
+	RTT        time.Duration // smoothed roundtrip time measured by probes on this path (0 = not yet measured)
+	ProbesSent uint64        // number of probes sent on this path
+	ProbesLost uint64        // number of probes that were not answered before the next probe was sent
+}
+
+// udtPath is a single local/remote address pair used by a connection
+type udtPath struct {
+	m          *multiplexer   // the multiplexer sending and receiving on this path
+	raddr      *net.UDPAddr   // the remote address of this path
+	joined     chan struct{}  // closed once our peer has agreed to use this path
+	joinOnce   sync.Once      // guards the closing of joined
+	pktSent    atomicUint64   // number of packets sent on this path
+	rtt        atomicDuration // smoothed roundtrip time measured by probes on this path
+	probesSent atomicUint64   // number of probes sent on this path
+	probesLost atomicUint64   // number of probes that were not answered in time
+	probeSeq   atomicUint32   // sequence number of the outstanding probe (0 if it has been answered)
+	probeTime  atomicDuration // when the outstanding probe was sent (relative to the socket's creation)
+}
+
+func (p *udtPath) matches(m *multiplexer, addr *net.UDPAddr) bool {
+	return p.m == m && p.raddr.IP.Equal(addr.IP) && p.raddr.Port == addr.Port
+}
+
+func (p *udtPath) markJoined() {
+	p.joinOnce.Do(func() {
+		close(p.joined)
+	})
+}
+
+func (p *udtPath) isJoined() bool {
+	select {
+	case <-p.joined:
+		return true
+	default:
+		return false
+	}
+}
+
+// AddPath attaches another local/remote address pair to an established connection, returning once the peer
+// has agreed to use it.  See function net.DialUDP for a description of net, laddr and raddr.
+func (s *udtSocket) AddPath(ctx context.Context, network string, laddr string, raddr *net.UDPAddr) error {
+	if s.sockState.get() != sockStateConnected {
+		return errors.New("Paths can only be added to a connected socket")
+	}
+
+	m, err := multiplexerFor(ctx, s.Config, network, laddr)
+	if err != nil {
+		return err
+	}
+	if m.sockets.load(s.sockID) == s {
+		m.release() // another of our paths is already holding a reference for us
+	} else if m.sockets.loadOrStore(s) != s {
+		m.release()
+		return errors.New("Socket ID is already in use on that local address")
+	} // otherwise our reference is released by closeSocket once we're done with this local address
+
+	path := &udtPath{m: m, raddr: raddr, joined: make(chan struct{})}
+	s.pathsProt.Lock()
+	if len(s.paths) == 0 {
+		s.paths = []*udtPath{s.primaryPath()}
+	}
+	for _, p := range s.paths {
+		if p.matches(m, raddr) {
+			s.pathsProt.Unlock()
+			return errors.New("Path is already part of this connection")
+		}
+	}
+	s.paths = append(s.paths, path)
+	s.pathsProt.Unlock()
+
+	joinSeq := make([]byte, 4)
+	endianness.PutUint32(joinSeq, s.initPktSeq.Seq)
+	for {
+		m.sendPacket(s, raddr, s.farSockID.get(), s.timestamp(), &packet.UserDefControlPacket{
+			MsgType:   mpJoinMsgType,
+			AddtlInfo: s.sockID,
+			Data:      joinSeq,
+		})
+
+		select {
+		case <-path.joined:
+			log.Printf("%s (id=%d) added path %s -> %s", s.m.laddr.String(), s.sockID, m.laddr.String(), raddr.String())
+			s.startPathProbes()
+			return nil
+		case <-s.clock.After(250 * time.Millisecond):
+			// resend the join request
+		case <-s.sockClosed:
+			s.removePath(path)
+			return s.connectionError()
+		case <-ctx.Done():
+			s.removePath(path)
+			return ctx.Err()
+		}
+	}
+}
+
+// Paths returns measurements for each of the paths used by this connection
+func (s *udtSocket) Paths() []PathStats {
+	s.pathsProt.RLock()
+	defer s.pathsProt.RUnlock()
+
+	if len(s.paths) == 0 {
+		return []PathStats{{LocalAddr: s.m.laddr, RemoteAddr: s.raddr}}
+	}
+	result := make([]PathStats, 0, len(s.paths))
+	for _, p := range s.paths {
+		if !p.isJoined() {
+			continue
+		}
+		result = append(result, PathStats{
+			LocalAddr:  p.m.laddr,
+			RemoteAddr: p.raddr,
+			PktSent:    p.pktSent.get(),
+			RTT:        p.rtt.get(),
+			ProbesSent: p.probesSent.get(),
+			ProbesLost: p.probesLost.get(),
+		})
+	}
+	return result
+}
+
+// primaryPath returns the path this connection was established on
+func (s *udtSocket) primaryPath() *udtPath {
+	path := &udtPath{m: s.m, raddr: s.raddr, joined: make(chan struct{})}
+	path.markJoined()
+	return path
+}
+
+func (s *udtSocket) removePath(path *udtPath) {
+	s.pathsProt.Lock()
+	for idx, p := range s.paths {
+		if p == path {
+			s.paths = append(s.paths[:idx:idx], s.paths[idx+1:]...)
+			break
+		}
+	}
+	stillUsed := path.m == s.m
+	for _, p := range s.paths {
+		stillUsed = stillUsed || p.m == path.m
+	}
+	s.pathsProt.Unlock()
+	if !stillUsed {
+		path.m.closeSocket(s.sockID)
+	}
+}
+
+// closePaths releases any additional multiplexers that were carrying paths for this connection
+func (s *udtSocket) closePaths() {
+	s.pathsProt.Lock()
+	paths := s.paths
+	s.paths = nil
+	s.pathsProt.Unlock()
+	for _, p := range paths {
+		if p.m != s.m {
+			p.m.closeSocket(s.sockID)
+		}
+	}
+}
+
+// findPath returns the path associated with a received packet, or nil if this packet did not arrive on one of our paths
+func (s *udtSocket) findPath(m *multiplexer, from *net.UDPAddr) *udtPath {
+	s.pathsProt.RLock()
+	defer s.pathsProt.RUnlock()
+	for _, p := range s.paths {
+		if p.matches(m, from) {
+			return p
+		}
+	}
+	return nil
+}
+
+// readPathPacket is called for a multipath control packet, returning true if it has been processed
+func (s *udtSocket) readPathPacket(m *multiplexer, p *packet.UserDefControlPacket, from *net.UDPAddr) bool {
+	switch p.MsgType {
+	case mpJoinMsgType:
+		if p.AddtlInfo != s.farSockID.get() || len(p.Data) < 4 || endianness.Uint32(p.Data) != s.initPktSeq.Seq {
+			log.Printf("Socket connected to %s received an invalid path join request from %s? Discarded", s.raddr.String(), from.String())
+			return true
+		}
+		if s.findPath(m, from) == nil {
+			s.pathsProt.Lock()
+			if len(s.paths) == 0 {
+				s.paths = []*udtPath{s.primaryPath()}
+			}
+			path := &udtPath{m: m, raddr: from, joined: make(chan struct{})}
+			path.markJoined()
+			s.paths = append(s.paths, path)
+			s.pathsProt.Unlock()
+			log.Printf("%s (id=%d) peer added path %s -> %s", s.m.laddr.String(), s.sockID, m.laddr.String(), from.String())
+			s.startPathProbes()
+		}
+		m.sendPacket(s, from, s.farSockID.get(), s.timestamp(), &packet.UserDefControlPacket{MsgType: mpJoinAckMsgType})
+		return true
+
+	case mpJoinAckMsgType:
+		if path := s.findPath(m, from); path != nil {
+			path.markJoined()
+		}
+		return true
+
+	case mpProbeMsgType:
+		m.sendPacket(s, from, s.farSockID.get(), s.timestamp(), &packet.UserDefControlPacket{
+			MsgType:   mpProbeReplyMsgType,
+			AddtlInfo: p.AddtlInfo,
+		})
+		return true
+
+	case mpProbeReplyMsgType:
+		if path := s.findPath(m, from); path != nil && p.AddtlInfo != 0 && path.probeSeq.get() == p.AddtlInfo {
+			path.probeSeq.set(0)
+			sample := s.elapsed() - path.probeTime.get()
+			if rtt := path.rtt.get(); rtt == 0 {
+				path.rtt.set(sample)
+			} else {
+				path.rtt.set((rtt*7 + sample) / 8)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// startPathProbes ensures that goManageConnection is probing our paths
+func (s *udtSocket) startPathProbes() {
+	select {
+	case s.pathProbeStart <- struct{}{}:
+	default:
+	}
+}
+
+// probePaths sends a roundtrip time probe on each of our paths
+func (s *udtSocket) probePaths() {
+	s.pathsProt.RLock()
+	paths := s.paths
+	s.pathsProt.RUnlock()
+	for _, p := range paths {
+		if !p.isJoined() {
+			continue
+		}
+		if p.probeSeq.get() != 0 {
+			p.probesLost.add(1)
+		}
+		s.probeSeq++
+		if s.probeSeq == 0 {
+			s.probeSeq++
+		}
+		p.probeSeq.set(s.probeSeq)
+		p.probeTime.set(s.elapsed())
+		p.probesSent.add(1)
+		p.m.sendPacket(s, p.raddr, s.farSockID.get(), s.timestamp(), &packet.UserDefControlPacket{
+			MsgType:   mpProbeMsgType,
+			AddtlInfo: s.probeSeq,
+		})
+	}
+}
+
+// pathProbePeriod returns the time between roundtrip time probes on each path
+func (s *udtSocket) pathProbePeriod() time.Duration {
+	period := s.Config.MultipathProbePeriod
+	if period <= 0 {
+		period = DefaultConfig().MultipathProbePeriod
+	}
+	return period
+}
+
+// schedulePaths returns the paths a packet should be sent on
+func (s *udtSocket) schedulePaths(p packet.Packet) []*udtPath {
+	s.pathsProt.RLock()
+	paths := s.paths
+	s.pathsProt.RUnlock()
+	if len(paths) <= 1 {
+		return nil
+	}
+
+	joined := make([]*udtPath, 0, len(paths))
+	for _, path := range paths {
+		if path.isJoined() {
+			joined = append(joined, path)
+		}
+	}
+
+	switch s.Config.MultipathScheduler {
+	case MultipathRoundRobin:
+		s.nextPath++
+		return joined[s.nextPath%uint(len(joined)):][:1]
+	case MultipathRedundant:
+		if _, isData := p.(*packet.DataPacket); isData {
+			return joined
+		}
+	}
+
+	// lowest RTT, preferring the primary path until we've measured the others
+	best := joined[0]
+	for _, path := range joined[1:] {
+		if rtt := path.rtt.get(); rtt > 0 && (best.rtt.get() == 0 || rtt < best.rtt.get()) {
+			best = path
+		}
+	}
+	return []*udtPath{best}
+}
@@ -2,13 +2,16 @@ package udt
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/odysseus654/go-udt/udt/packet"
 )
@@ -18,8 +21,17 @@ import (
 type packetWrapper struct {
 	pkt  packet.Packet
 	dest *net.UDPAddr
+	from *udtSocket    // the socket that sent this packet (nil for the multiplexer itself)
+	sent chan struct{} // if not nil, closed once the packet has been handed to the underlying connection
 }
 
+// errMultiplexerClosed is returned when trying to use a multiplexer that everything else has finished with
+var errMultiplexerClosed = errors.New("Multiplexer closed")
+
+// multiplexersProt must be held while adding or releasing a reference to a multiplexer, or (de)registering one in
+// multiplexers
+var multiplexersProt sync.Mutex
+
 /*
 A multiplexer multiplexes multiple UDT sockets over a single PacketConn.
 */
@@ -27,77 +39,124 @@ type multiplexer struct {
 	network       string
 	laddr         *net.UDPAddr   // the local address handled by this multiplexer
 	conn          net.PacketConn // the UDPConn from which we read/write
-	sockets       sync.Map       // the udtSockets handled by this multiplexer, by sockId
-	rvSockets     sync.Map       // the list of any sockets currently in rendezvous mode
-	listenSock    *listener      // the server socket listening to incoming connections, if there is one
+	sockets       socketTable    // the udtSockets handled by this multiplexer, by sockId
+	listeners     listenerTable  // the listeners accepting incoming connections, by Config.ServiceName
 	servSockMutex sync.Mutex
-	mtu           uint               // the Maximum Transmission Unit of packets sent from this address
-	nextSid       uint32             // the SockID for the next socket created
-	pktOut        chan packetWrapper // packets queued for immediate sending
+	mtu           uint           // the Maximum Transmission Unit of packets sent from this address
+	nextSid       uint32         // the SockID for the next socket created
+	sched         *sendScheduler // packets queued for immediate sending
+	mem           memoryBudget   // memory held by the sockets sharing this multiplexer (see Config.MemoryLimit)
+	closed        chan struct{}  // closed when the underlying connection has been shut down
+	closeOnce     sync.Once      // guards the teardown of the underlying connection
+	connErr       error          // if the underlying connection failed, the reason why
+	connErrProt   sync.Mutex     // lock must be held before referencing connErr
+	strict        atomicUint32   // if nonzero, packets with trailing data are rejected (see Config.StrictDecoding)
+	pktDecodeErr  atomicUint64   // number of received datagrams that couldn't be decoded
+	pktTrailing   atomicUint64   // number of received datagrams rejected for trailing data
+	pktPanic      atomicUint64   // number of received datagrams dropped after handling them panicked
+	pktWrongPeer  atomicUint64   // number of received packets discarded for coming from someone other than the socket's peer
+	hsDropped     atomicUint64   // number of received handshakes discarded because the listener had too many waiting
+	hsAccepted    atomicUint64   // number of handshakes a listener created a new connection for
+	hsRefused     atomicUint64   // number of handshakes refused (see rejectHandshake)
+	hsResumed     atomicUint64   // number of handshakes a listener skipped the syn cookie exchange for (see resume.go)
+	rvAttempts    atomicUint64   // number of rendezvous connections attempted
+	pktIn         atomicUint64   // number of datagrams received (counting each segment of a coalesced one)
+	pktOut        atomicUint64   // number of datagrams sent
+	pktNoSocket   atomicUint64   // number of received packets discarded for being addressed to a socket we don't have
+	timestamps    atomicUint32   // if nonzero, the kernel is attaching receive timestamps (see Config.KernelTimestamps)
+	ecn           atomicUint32   // if nonzero, we're marking packets as ECN-capable and reading their marks (see Config.ECN)
+	dscp          atomicUint32   // the DiffServ code point packets are marked with (see Config.DSCP)
+	gso           atomicUint32   // if nonzero, packets are sent and received with UDP segmentation offload (see Config.GSO)
+	unlisted      atomicUint32   // if nonzero, we were created by NewMultiplexerWithConn and aren't in multiplexers
+	tracer        atomic.Value   // holds a tracerRef with the PacketTracer passed every packet (see Config.Tracer)
+	refs          int            // number of sockets, listeners and callers using us (multiplexersProt must be held)
+	closing       chan struct{}  // closed once refs drops to zero, for goWrite to send what's left and tear us down
+	lockedThreads atomicUint32   // if nonzero, our read and write goroutines lock themselves to OS threads (see Config.LockThreads)
+	threadCPUs    []int          // CPUs to pin those threads to (see Config.ThreadCPUs), set before lockedThreads
+	lockOnce      sync.Once      // guards setting lockedThreads and threadCPUs
+	wheel         *timerWheel    // timers for sockets in event-loop mode (see Config.EventLoop), once wheelOnce has run
+	wheelOnce     sync.Once
+
+	// additional UDPConns sharing our address with SO_REUSEPORT (see Config.ReusePortSockets), which we only read from
+	readers []net.PacketConn
 }
 
 /*
 multiplexerFor gets or creates a multiplexer for the given local address.  If a
 new multiplexer is created, the given init function is run to obtain an
-io.ReadWriter.
+io.ReadWriter.  The multiplexer is returned with a reference held for the caller,
+which must call release once it's done with it.
 */
-func multiplexerFor(ctx context.Context, network string, laddr string) (*multiplexer, error) {
+func multiplexerFor(ctx context.Context, config *Config, network string, laddr string) (*multiplexer, error) {
+	network = udpNetwork(network)
 	key := fmt.Sprintf("%s:%s", network, laddr)
+	multiplexersProt.Lock()
 	if ifM, ok := multiplexers.Load(key); ok {
 		m := ifM.(*multiplexer)
-		if m.isLive() { // checking this in case we have a race condition with multiplexer destruction
-			return m, nil
-		}
+		m.refs++ // anything still registered hasn't been released by everything using it
+		multiplexersProt.Unlock()
+		return m, nil
 	}
+	multiplexersProt.Unlock()
 
 	// No multiplexer, need to create connection
 
-	// try to avoid fragmentation (and hopefully be notified if we exceed path MTU)
-	config := net.ListenConfig{}
-	config.Control = func(network, address string, c syscall.RawConn) error {
-		return c.Control(func(fd uintptr) {
-			var err error
-			os := runtime.GOOS
-			switch os {
-			case "windows":
-				//err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 14 /* IP_DONTFRAGMENT for winsock2 */, 1)
-				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 71 /* IP_MTU_DISCOVER for winsock2 */, 2 /* IP_PMTUDISC_DO */)
-			case "linux", "android":
-				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 10 /* IP_MTU_DISCOVER */, 2 /* IP_PMTUDISC_DO */)
-			default:
-				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 67 /* IP_DONTFRAG */, 1)
-			}
-			if err != nil {
-				log.Printf("error on setSockOpt: %s", err.Error())
-			}
-		})
+	readSockets := config.ReusePortSockets
+	packetIO := config.PacketIO
+	if packetIO == nil {
+		packetIO = udpPacketIO{reusePort: readSockets > 1}
 	}
-
-	//conn, err := net.ListenUDP(network, laddr)
-	conn, err := config.ListenPacket(ctx, network, laddr)
+	conn, err := packetIO.ListenPacket(ctx, network, laddr)
 	if err != nil {
 		return nil, err
 	}
 
-	addr := conn.LocalAddr().(*net.UDPAddr)
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("PacketIO returned a connection with a %T address, must be a *net.UDPAddr", conn.LocalAddr())
+	}
 
-	m := newMultiplexer(network, addr, conn)
+	// any additional sockets are bound to the address we ended up with, in case laddr didn't specify a port
+	var readers []net.PacketConn
+	for len(readers)+1 < int(readSockets) {
+		reader, err := packetIO.ListenPacket(ctx, network, addr.String())
+		if err != nil {
+			conn.Close()
+			for _, reader := range readers {
+				reader.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, reader)
+	}
+
+	m := newMultiplexer(network, addr, conn, readers...)
+	multiplexersProt.Lock()
 	multiplexers.Store(key, m)
+	multiplexersProt.Unlock()
 	return m, nil
 }
 
-func newMultiplexer(network string, laddr *net.UDPAddr, conn net.PacketConn) (m *multiplexer) {
+func newMultiplexer(network string, laddr *net.UDPAddr, conn net.PacketConn, readers ...net.PacketConn) (m *multiplexer) {
 	mtu, _ := discoverMTU(laddr.IP)
 	m = &multiplexer{
 		network: network,
 		laddr:   laddr,
 		conn:    conn,
+		readers: readers,
 		mtu:     mtu,
-		nextSid: randUint32(),                  // Socket ID MUST start from a random value
-		pktOut:  make(chan packetWrapper, 100), // todo: figure out how to size this
+		nextSid: randUint32(), // Socket ID MUST start from a random value
+		sched:   newSendScheduler(),
+		closed:  make(chan struct{}),
+		closing: make(chan struct{}),
+		refs:    1, // held by whoever is creating us
 	}
 
-	go m.goRead()
+	go m.goRead(conn, 1)
+	for idx, reader := range readers {
+		go m.goRead(reader, idx+2)
+	}
 	go m.goWrite()
 
 	return
@@ -107,30 +166,42 @@ func (m *multiplexer) key() string {
 	return fmt.Sprintf("%s:%s", m.network, m.laddr.String())
 }
 
-func (m *multiplexer) listenUDT(l *listener) bool {
+// listenUDT adds a listener accepting connections for its Config.ServiceName, failing if we already have one
+func (m *multiplexer) listenUDT(l *listener) error {
 	m.servSockMutex.Lock()
 	defer m.servSockMutex.Unlock()
-	if m.listenSock != nil {
-		return false
+	service := l.config.ServiceName
+	if _, ok := m.listeners[service]; ok {
+		if service == "" {
+			return errors.New("Already listening on this address (each listener sharing an address needs its own Config.ServiceName)")
+		}
+		return fmt.Errorf("Already listening for service %q on this address", service)
 	}
-	m.listenSock = l
-	return true
+	if !m.acquire() {
+		return errMultiplexerClosed
+	}
+	if m.listeners == nil {
+		m.listeners = make(listenerTable)
+	}
+	m.listeners[service] = l
+	return nil
 }
 
 func (m *multiplexer) unlistenUDT(l *listener) bool {
 	m.servSockMutex.Lock()
-	if m.listenSock != l {
+	service := l.config.ServiceName
+	if m.listeners[service] != l {
 		m.servSockMutex.Unlock()
 		return false
 	}
-	m.listenSock = nil
+	delete(m.listeners, service)
 	m.servSockMutex.Unlock()
-	m.checkLive()
+	m.release()
 	return true
 }
 
 // Adapted from https://github.com/hlandau/degoutils/blob/master/net/mtu.go
-const absMaxDatagramSize = 2147483646 // 2**31-2
+const absMaxDatagramSize = 65535 // largest packet IP can carry without jumbograms
 func discoverMTU(ourIP net.IP) (uint, error) {
 
 	ifaces, err := net.Interfaces()
@@ -167,8 +238,13 @@ func discoverMTU(ourIP net.IP) (uint, error) {
 		filtered = ifaces
 	}
 
+	return interfaceMTU(filtered), nil
+}
+
+// interfaceMTU returns the packet size to use across the given interfaces, which can't be larger than a datagram can be
+func interfaceMTU(ifaces []net.Interface) uint {
 	var mtu int = 65535
-	for _, iface := range filtered {
+	for _, iface := range ifaces {
 		if iface.Flags&(net.FlagUp|net.FlagLoopback) == net.FlagUp && iface.MTU > mtu {
 			mtu = iface.MTU
 		}
@@ -176,108 +252,239 @@ func discoverMTU(ourIP net.IP) (uint, error) {
 	if mtu > absMaxDatagramSize {
 		mtu = absMaxDatagramSize
 	}
-	return uint(mtu), nil
+	return uint(mtu)
 }
 
-func (m *multiplexer) newSocket(config *Config, peer *net.UDPAddr, isServer bool, isDatagram bool) (s *udtSocket) {
-	sid := atomic.AddUint32(&m.nextSid, ^uint32(0))
-
-	s = newSocket(m, config, sid, isServer, isDatagram, peer)
-
-	m.sockets.Store(sid, s)
-	return s
+// newSocket creates a socket with an unused ID.  If our peer's socket ID is known (peerSockID is nonzero) we also
+// avoid using that one, so that a connection to another socket sharing our local address can't be confused with it
+func (m *multiplexer) newSocket(config *Config, peer *net.UDPAddr, peerSockID uint32, isServer bool, isDatagram bool) (*udtSocket, error) {
+	if !m.acquire() {
+		return nil, errMultiplexerClosed
+	}
+	m.configure(config)
+	for attempt := 0; attempt < maxSockIDAttempts; attempt++ {
+		sid := m.nextSockID(config)
+		if sid == 0 || sid == peerSockID || m.sockets.load(sid) != nil {
+			continue // zero is reserved for handshakes, and every socket here needs its own ID
+		}
+		s := newSocket(m, config, sid, isServer, isDatagram, peer)
+		if m.sockets.loadOrStore(s) == s {
+			m.mem.join(sid)
+			return s, nil
+		}
+		close(s.sockClosed) // someone else took this ID while we were creating our socket
+		s.routines.close()
+	}
+	m.release()
+	return nil, errNoSockID
 }
 
+// closeSocket removes a socket from us, releasing the reference it was holding
 func (m *multiplexer) closeSocket(sockID uint32) bool {
-	if _, ok := m.sockets.Load(sockID); !ok {
+	if !m.sockets.remove(sockID) {
 		return false
 	}
-	m.sockets.Delete(sockID)
-	m.checkLive()
+	m.mem.leave(sockID)
+	m.release()
 	return true
 }
 
-func (m *multiplexer) checkLive() bool {
-	if m.conn == nil { // have we already been destructed ?
+// acquire adds a reference to us for a new socket or listener, returning false if everything using us has already
+// released us (and we're being torn down)
+func (m *multiplexer) acquire() bool {
+	multiplexersProt.Lock()
+	defer multiplexersProt.Unlock()
+	if m.refs == 0 {
 		return false
 	}
-	if m.isLive() { // are we currently in use?
-		return true
-	}
+	m.refs++
+	return true
+}
 
-	// deregister this multiplexer
-	key := m.key()
-	multiplexers.Delete(key)
-	if m.isLive() { // checking this in case we have a race condition with multiplexer destruction
-		multiplexers.Store(key, m)
-		return true
+// release drops a reference to us.  Once the last one is gone we stop accepting new users and goWrite tears us down,
+// so that nothing can find us in multiplexers (or be handed packets by us) while we're half-destroyed
+func (m *multiplexer) release() {
+	multiplexersProt.Lock()
+	m.refs--
+	last := m.refs == 0
+	if last {
+		m.deregister()
+	}
+	multiplexersProt.Unlock()
+	if last {
+		close(m.closing)
 	}
-
-	// tear everything down
-	m.conn.Close()
-	close(m.pktOut)
-	return false
 }
 
-func (m *multiplexer) isLive() bool {
-	if m.conn == nil {
-		return false
+// deregister removes us from multiplexers, so that later users of our address get a new multiplexer.
+// multiplexersProt must be held
+func (m *multiplexer) deregister() {
+	if m.unlisted.get() != 0 {
+		return
 	}
-	m.servSockMutex.Lock()
-	if m.listenSock != nil {
-		m.servSockMutex.Unlock()
-		return true
+	key := m.key()
+	if cur, ok := multiplexers.Load(key); ok && cur == m {
+		multiplexers.Delete(key)
 	}
-	m.servSockMutex.Unlock()
+}
 
-	isEmpty := true
-	m.rvSockets.Range(func(key, val interface{}) bool {
-		isEmpty = false
-		return false
+// teardown closes the underlying connection and stops our read/write loops
+func (m *multiplexer) teardown() {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		m.conn.Close()
+		for _, reader := range m.readers {
+			reader.Close()
+		}
 	})
-	if !isEmpty {
-		return true
-	}
+}
 
-	m.sockets.Range(func(key, val interface{}) bool {
-		isEmpty = false
+func (m *multiplexer) isClosed() bool {
+	select {
+	case <-m.closed:
+		return true
+	default:
 		return false
-	})
-	return !isEmpty
+	}
 }
 
-func (m *multiplexer) startRendezvous(s *udtSocket) {
-	peer := s.raddr.String()
-	m.rvSockets.Store(peer, s)
+// startRendezvous routes handshakes from a socket's peer to it until endRendezvous is called, returning false if
+// another socket is already attempting to rendezvous with the same peer
+func (m *multiplexer) startRendezvous(s *udtSocket) bool {
+	if !m.sockets.startRendezvous(s) {
+		return false
+	}
+	m.rvAttempts.add(1)
+	return true
 }
 
 func (m *multiplexer) endRendezvous(s *udtSocket) {
-	peer := s.raddr.String()
-	sock, ok := m.rvSockets.Load(peer)
-	if ok && sock.(*udtSocket) == s {
-		m.rvSockets.Delete(peer)
-	}
+	m.sockets.endRendezvous(s)
 }
 
 /*
-read runs in a goroutine and reads packets from conn using a buffer from the
-readBufferPool, or a new buffer.
+read runs in a goroutine and reads packets from conn (either our connection or one of our readers, the idx'th of our
+goroutines) using a buffer from the readBufferPool, or a new buffer.
 */
-func (m *multiplexer) goRead() {
+func (m *multiplexer) goRead(conn net.PacketConn, idx int) {
 	buf := make([]byte, m.mtu)
+	oob := make([]byte, kernelTimestampOOBSize+ecnOOBSize+groOOBSize)
+	locked := false
 	for {
-		numBytes, from, err := m.conn.ReadFrom(buf)
+		if !locked && m.lockedThreads.get() != 0 {
+			locked = true
+			m.lockThread(idx)
+		}
+		if len(buf) < maxGROSize && m.gso.get() != 0 {
+			buf = make([]byte, maxGROSize) // the kernel may now coalesce several packets into each datagram
+		}
+		numBytes, from, rxAge, ecn, segSize, err := m.readFrom(conn, buf, oob)
 		if err != nil {
+			if m.isClosed() {
+				return // we closed the connection ourselves
+			}
+			if isTransientConnError(err) {
+				continue
+			}
+			m.connFailed(err)
 			return
 		}
-		m.readPacket(buf, numBytes, from)
+		if segSize > 0 && segSize < numBytes {
+			// several packets coalesced by the kernel (see Config.GSO)
+			for off := 0; off < numBytes; off += segSize {
+				plen := segSize
+				if off+plen > numBytes {
+					plen = numBytes - off
+				}
+				m.readPacketSafely(buf[off:], plen, from, rxAge, ecn)
+			}
+			continue
+		}
+		m.readPacketSafely(buf, numBytes, from, rxAge, ecn)
+	}
+}
+
+// maxPanicDump is the most of a packet that's logged when handling it panics
+const maxPanicDump = 128
+
+// readPacketSafely is readPacket, except that a panic while decoding or routing the datagram (or in the receiving
+// socket, for the part of its handling done here) loses only that datagram, which is logged along with the stack it
+// panicked on, rather than stopping the read loop and with it everything sharing this address
+func (m *multiplexer) readPacketSafely(buf []byte, numBytes int, from net.Addr, rxAge time.Duration, ecn byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.pktPanic.add(1)
+			dump := buf[:numBytes]
+			if len(dump) > maxPanicDump {
+				dump = dump[:maxPanicDump]
+			}
+			log.Printf("%s dropping a %d byte packet from %s after panicking: %v\n%s%s", m.laddr.String(), numBytes,
+				from.String(), r, hex.Dump(dump), debug.Stack())
+		}
+	}()
+	m.readPacket(buf, numBytes, from, rxAge, ecn)
+}
+
+// configure applies the settings from a Config that affect everything sharing this multiplexer
+func (m *multiplexer) configure(config *Config) {
+	if config.StrictDecoding {
+		m.strict.set(1)
+	}
+	if config.LocalMaxBandwidth > 0 {
+		m.sched.setLimit(configClock(config), config.LocalMaxBandwidth)
+	}
+	if config.MemoryLimit > 0 {
+		m.mem.limit.set(config.MemoryLimit)
+	}
+	if config.KernelTimestamps {
+		m.enableTimestamps()
+	}
+	if config.ECN {
+		m.enableECN()
+	}
+	if config.DSCP != 0 {
+		m.setDSCP(config.DSCP)
+	}
+	if config.GSO {
+		m.enableGSO()
+	}
+	if config.LockThreads {
+		m.lockThreads(config.ThreadCPUs)
+	}
+	if config.Tracer != nil {
+		m.setTracer(config.Tracer)
 	}
 }
 
-func (m *multiplexer) readPacket(buf []byte, numBytes int, from net.Addr) {
-	p, err := packet.ReadPacketFrom(buf[0:numBytes])
+// timers returns the timerWheel shared by sockets in event-loop mode, starting it (driven by the specified clock) if this
+// is the first such socket
+func (m *multiplexer) timers(clock Clock) *timerWheel {
+	m.wheelOnce.Do(func() {
+		m.wheel = newTimerWheel(clock)
+		go m.wheel.goRun(m.closed)
+	})
+	return m.wheel
+}
+
+// readPacket decodes and routes a datagram that arrived rxAge ago (zero if we don't know any better than now), carrying
+// the specified ECN bits
+func (m *multiplexer) readPacket(buf []byte, numBytes int, from net.Addr, rxAge time.Duration, ecn byte) {
+	m.pktIn.add(1)
+	var p packet.Packet
+	var err error
+	if m.strict.get() != 0 {
+		p, err = packet.ReadPacketFromStrict(buf[0:numBytes])
+	} else {
+		p, err = packet.ReadPacketFrom(buf[0:numBytes])
+	}
+	m.trace(false, rxAge, from.(*net.UDPAddr), buf[0:numBytes], p)
 	if err != nil {
-		log.Printf("Unable to read packet: %s", err)
+		if errors.Is(err, packet.ErrTrailingData) {
+			m.pktTrailing.add(1)
+		} else {
+			m.pktDecodeErr.add(1)
+		}
+		log.Printf("Unable to read packet from %s: %s", from.String(), err)
 		return
 	}
 
@@ -288,28 +495,52 @@ func (m *multiplexer) readPacket(buf []byte, numBytes int, from net.Addr) {
 		var ok bool
 		if hsPacket, ok = p.(*packet.HandshakePacket); !ok {
 			log.Printf("Received non-handshake packet with destination socket = 0")
+			releasePacket(p)
 			return
 		}
 
-		foundMatch := false
-		m.rvSockets.Range(func(key, val interface{}) bool {
-			if val.(*udtSocket).readHandshake(m, hsPacket, from.(*net.UDPAddr)) {
-				foundMatch = true
-				return false
+		if s := m.sockets.rendezvousWith(from.(*net.UDPAddr)); s != nil && s.readHandshake(m, hsPacket, from.(*net.UDPAddr)) {
+			return
+		}
+		l, listening := m.listenerFor(hsPacket)
+		if l == nil {
+			if listening {
+				// someone's listening here, just not for the service this connection wants
+				m.rejectHandshake(hsPacket, from.(*net.UDPAddr), &RejectError{Reason: RejectService,
+					Message: fmt.Sprintf("not listening for service %q", serviceName(hsPacket))})
 			}
-			return true
-		})
-		if foundMatch {
 			return
 		}
-		m.servSockMutex.Lock()
-		if m.listenSock != nil {
-			m.listenSock.readHandshake(m, hsPacket, from.(*net.UDPAddr))
+		if !l.queueHandshake(m, hsPacket, from.(*net.UDPAddr)) {
+			m.hsDropped.add(1)
 		}
-		m.servSockMutex.Unlock()
+		return
 	}
-	if ifDestSock, ok := m.sockets.Load(sockID); ok {
-		ifDestSock.(*udtSocket).readPacket(m, p, from.(*net.UDPAddr))
+	// packets are routed by both socket ID and source address, so a stray packet carrying the ID of one of our sockets
+	// (such as from a previous connection that happened to use it) doesn't reach a socket connected to someone else
+	destSock := m.sockets.load(sockID)
+	if destSock == nil {
+		m.pktNoSocket.add(1)
+		releasePacket(p)
+		return
+	}
+	if !destSock.acceptsFrom(m, p, from.(*net.UDPAddr)) {
+		m.pktWrongPeer.add(1)
+		releasePacket(p)
+		return
+	}
+	if ecn == ecnCE {
+		if dp, ok := p.(*packet.DataPacket); ok {
+			destSock.noteCongestionMark(dp)
+		}
+	}
+	destSock.readPacket(m, p, from.(*net.UDPAddr), rxAge)
+}
+
+// releasePacket returns a received packet that is no longer referenced to its pool (if it came from one)
+func releasePacket(p packet.Packet) {
+	if dp, ok := p.(*packet.DataPacket); ok {
+		dp.Release()
 	}
 }
 
@@ -319,34 +550,166 @@ writeBufferPool, or a new buffer.
 */
 func (m *multiplexer) goWrite() {
 	buf := make([]byte, m.mtu)
-	pktOut := m.pktOut
+	wake := m.sched.wake
+	closed := m.closed
+	closing := m.closing
+	var retry <-chan time.Time // if set, fires when packets held back by a rate limit can be sent
+	var batch *gsoBatch        // if set, packets are gathered into super-packets (see Config.GSO)
+	locked := false
 	for {
+		finishing := false
 		select {
-		case pw, ok := <-pktOut:
+		case _, _ = <-closed:
+			return
+		case <-closing: // nothing is using us any more, send anything still queued (such as shutdowns) and stop
+			finishing = true
+		case <-wake:
+		case <-retry:
+		}
+		if !locked && m.lockedThreads.get() != 0 {
+			locked = true
+			m.lockThread(0)
+		}
+		if batch == nil && m.gso.get() != 0 {
+			batch = newGSOBatch(m.mtu)
+		}
+		for {
+			var pw packetWrapper
+			var ok bool
+			pw, retry, ok = m.sched.pop()
 			if !ok {
-				return
+				break
 			}
-			plen, err := pw.pkt.WriteTo(buf)
-			if err != nil {
-				// TODO: handle write error
-				log.Fatalf("Unable to buffer out: %s", err.Error())
-				continue
+			var err error
+			if batch != nil {
+				err = m.addToBatch(batch, pw)
+			} else {
+				err = m.writePacket(buf, pw)
+				if pw.sent != nil {
+					close(pw.sent)
+				}
 			}
-
-			if _, err = m.conn.WriteTo(buf[0:plen], pw.dest); err != nil {
-				// TODO: handle write error
-				log.Fatalf("Unable to write out: %s", err.Error())
+			if err != nil && m.writeFailed(err, pw.dest) {
+				return
 			}
 		}
+		if batch != nil {
+			dest := batch.dest
+			if err := m.flushBatch(batch); err != nil && m.writeFailed(err, dest) {
+				return
+			}
+		}
+		if finishing {
+			m.teardown()
+			return
+		}
 	}
 }
 
-func (m *multiplexer) sendPacket(destAddr *net.UDPAddr, destSockID uint32, ts uint32, p packet.Packet) {
+// writeFailed handles an error writing to dest on the underlying connection, returning true if the connection can no
+// longer be used
+func (m *multiplexer) writeFailed(err error, dest *net.UDPAddr) bool {
+	if m.isClosed() {
+		return true
+	}
+	if isTransientConnError(err) {
+		log.Printf("Unable to write out to %s: %s", dest.String(), err.Error())
+		return false
+	}
+	m.connFailed(err)
+	return true
+}
+
+// writePacket serializes a packet and writes it to the underlying connection.  Only errors from the connection itself
+// are returned
+func (m *multiplexer) writePacket(buf []byte, pw packetWrapper) error {
+	plen, err := pw.pkt.WriteTo(buf)
+	if err != nil {
+		log.Printf("Unable to buffer out %s packet: %s", packet.PacketTypeName(pw.pkt.PacketType()), err.Error())
+		return nil
+	}
+	err = m.writeTo(buf[0:plen], pw)
+	m.charge(pw, int(plen))
+	return err
+}
+
+// charge counts a packet of plen bytes that has been written out against any rate limits
+func (m *multiplexer) charge(pw packetWrapper, plen int) {
+	// rate limits count the IP and UDP headers, as the negotiated packet size does
+	if pw.dest.IP.To4() != nil {
+		m.sched.charge(pw, plen+udp4HeaderSize)
+	} else {
+		m.sched.charge(pw, plen+udp6HeaderSize)
+	}
+}
+
+// isTransientConnError returns true if the specified error returned from the underlying connection
+// is not expected to prevent further use of the connection (such as an ICMP error about a single peer)
+func isTransientConnError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EMSGSIZE) {
+		return true
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	return false
+}
+
+// connFailed is called when the underlying connection has failed.  Every socket and listener owned by
+// this multiplexer is shut down with the specified error, and the multiplexer is torn down
+func (m *multiplexer) connFailed(err error) {
+	m.connErrProt.Lock()
+	if m.connErr != nil {
+		m.connErrProt.Unlock()
+		return
+	}
+	m.connErr = err
+	m.connErrProt.Unlock()
+
+	log.Printf("%s multiplexer failed: %s", m.laddr.String(), err.Error())
+	multiplexersProt.Lock()
+	m.deregister()
+	multiplexersProt.Unlock()
+	m.teardown()
+
+	sockErr := fmt.Errorf("Underlying connection failed: %s", err.Error())
+	for _, s := range m.sockets.all() {
+		s.connFailed(sockErr)
+	}
+
+	m.servSockMutex.Lock()
+	listeners := make([]*listener, 0, len(m.listeners))
+	for _, l := range m.listeners {
+		listeners = append(listeners, l)
+	}
+	m.servSockMutex.Unlock()
+	for _, l := range listeners {
+		l.connFailed(sockErr)
+	}
+}
+
+// sendPacket queues a packet to be written out, on behalf of the specified socket (or nil for the multiplexer itself)
+func (m *multiplexer) sendPacket(from *udtSocket, destAddr *net.UDPAddr, destSockID uint32, ts uint32, p packet.Packet) {
 	p.SetHeader(destSockID, ts)
 	if destSockID == 0 {
 		if _, ok := p.(*packet.HandshakePacket); !ok {
 			log.Fatalf("Sending non-handshake packet with destination socket = 0")
 		}
 	}
-	m.pktOut <- packetWrapper{pkt: p, dest: destAddr}
+	// if the connection is gone there's nothing we can do with this packet
+	m.sched.push(from, packetWrapper{pkt: p, dest: destAddr}, m.closed)
+}
+
+// sendPacketWait is sendPacket, but doesn't return until the packet has actually been written out
+// (used for packets that must not be lost if the process exits right after the socket is closed)
+func (m *multiplexer) sendPacketWait(from *udtSocket, destAddr *net.UDPAddr, destSockID uint32, ts uint32, p packet.Packet) {
+	p.SetHeader(destSockID, ts)
+	sent := make(chan struct{})
+	if !m.sched.push(from, packetWrapper{pkt: p, dest: destAddr, sent: sent}, m.closed) {
+		return
+	}
+	select {
+	case <-sent:
+	case _, _ = <-m.closed:
+	}
 }
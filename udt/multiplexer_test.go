@@ -0,0 +1,272 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// waitTornDown fails the test if a multiplexer isn't torn down shortly
+func waitTornDown(t *testing.T, m *multiplexer) {
+	t.Helper()
+	select {
+	case <-m.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("multiplexer wasn't torn down after its last reference was released")
+	}
+}
+
+func TestMultiplexerRefs(t *testing.T) {
+	config := DefaultConfig()
+	addr := fmt.Sprintf("127.0.0.1:%d", serverPort+86)
+	m, err := multiplexerFor(context.Background(), config, "udp", addr)
+	if err != nil {
+		t.Fatalf("error creating multiplexer: %s", err.Error())
+	}
+	l, err := listenOn(m, config, "udp")
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	m.release()
+
+	// the listener keeps it open (and findable) after the caller is done with it
+	if m.isClosed() {
+		t.Fatal("multiplexer torn down while a listener was using it")
+	}
+	m2, err := multiplexerFor(context.Background(), config, "udp", addr)
+	if err != nil || m2 != m {
+		t.Fatalf("expected to get the existing multiplexer back, got %p (%v)", m2, err)
+	}
+	m2.release()
+
+	l.Close()
+	waitTornDown(t, m)
+	if _, ok := multiplexers.Load(m.key()); ok {
+		t.Error("multiplexer still registered after being torn down")
+	}
+	if m.acquire() {
+		t.Error("expected a released multiplexer to refuse new users")
+	}
+	if _, err := m.newSocket(config, nil, 0, false, false); err == nil {
+		t.Error("expected an error creating a socket on a released multiplexer")
+	}
+}
+
+func TestMultiplexerRefsConcurrent(t *testing.T) {
+	config := DefaultConfig()
+	addr := fmt.Sprintf("127.0.0.1:%d", serverPort+87)
+
+	// users coming and going at the same time never get a multiplexer that's being torn down
+	var wg sync.WaitGroup
+	seen := make(chan *multiplexer, 8*50)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m, err := multiplexerFor(context.Background(), config, "udp", addr)
+				if err != nil {
+					continue // the address may briefly still be held by a multiplexer that was just released
+				}
+				if !m.acquire() {
+					t.Error("multiplexer refused a new user while we were holding it")
+				} else {
+					m.release()
+				}
+				if m.isClosed() {
+					t.Error("multiplexer torn down while we were holding it")
+				}
+				seen <- m
+				m.release()
+			}
+		}()
+	}
+	wg.Wait()
+	close(seen)
+
+	for m := range seen {
+		waitTornDown(t, m)
+	}
+	if _, ok := multiplexers.Load(fmt.Sprintf("udp:%s", addr)); ok {
+		t.Error("multiplexer still registered after every user released it")
+	}
+}
+
+// heldConn is a PacketConn whose writes don't complete until it is released
+type heldConn struct {
+	net.PacketConn
+	release chan struct{}
+}
+
+func (c *heldConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	<-c.release
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestSendPacketWait(t *testing.T) {
+	a, b := newPipeConns()
+	defer b.Close()
+	conn := &heldConn{PacketConn: a, release: make(chan struct{})}
+	mx, err := NewMultiplexerWithConn(conn, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer mx.Close()
+
+	// a packet that must not be lost isn't considered sent until it has been written out
+	sent := make(chan struct{})
+	go func() {
+		mx.m.sendPacketWait(nil, b.LocalAddr().(*net.UDPAddr), 1, 0, &packet.ShutdownPacket{})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("expected sendPacketWait to wait for the packet to be written")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(conn.release)
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected sendPacketWait to return once the packet was written")
+	}
+}
+
+func TestConnFailedBroadcast(t *testing.T) {
+	a, b := newPipeConns()
+	servMx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(b, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepting := acceptOne(l)
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepting
+
+	// everyone waiting on the multiplexer hears why it failed, while it's failing
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+	read := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 100))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go servMx.m.connFailed(errors.New("network gone"))
+
+	for name, result := range map[string]chan error{"Accept": accepted, "Read": read} {
+		select {
+		case err := <-result:
+			if err == nil || !strings.Contains(err.Error(), "network gone") {
+				t.Errorf("expected %s to return the failure, got %v", name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s to return once the multiplexer failed", name)
+		}
+	}
+	if _, err := server.Write([]byte("late")); err == nil || !strings.Contains(err.Error(), "network gone") {
+		t.Errorf("expected Write to return the failure, got %v", err)
+	}
+}
+
+func TestConnFailedClosedListener(t *testing.T) {
+	a, b := newPipeConns()
+	defer b.Close()
+	mx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer mx.Close()
+	l, err := mx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+
+	// the multiplexer may fail a listener the application is closing, while Accept asks why it closed
+	lst := l.(*listener)
+	l.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if _, err := l.Accept(); err == nil {
+				t.Error("expected Accept on a closed listener to fail")
+				return
+			}
+		}
+	}()
+	lst.connFailed(errors.New("network gone"))
+	<-done
+}
+
+func TestShutdownSocketFlood(t *testing.T) {
+	a, b := newPipeConns()
+	config := DefaultConfig()
+	config.LingerTime = time.Minute
+	servMx, err := NewMultiplexerWithConn(a, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(b, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+
+	// two connections sharing the same multiplexer
+	var clients, servers [2]net.Conn
+	for i := range clients {
+		accepting := acceptOne(l)
+		if clients[i], err = clientMx.Dial(context.Background(), servMx.Addr(), true); err != nil {
+			t.Fatalf("error dialing: %s", err.Error())
+		}
+		defer clients[i].Close()
+		if servers[i] = <-accepting; servers[i] == nil {
+			t.Fatal("connection wasn't accepted")
+		}
+		defer servers[i].Close()
+	}
+
+	// the first times out, lingering with its receive loop stopped, while its peer keeps sending to it
+	timedOut := servers[0].(*udtSocket)
+	timedOut.shutdownEvent.signal(shutdownMessage{sockState: sockStateTimeout, permitLinger: true})
+	<-timedOut.sockShutdown
+	for i := uint32(0); i < 1000; i++ {
+		dp := &packet.DataPacket{Seq: packet.PacketID{Seq: i}, Data: []byte("flood")}
+		clientMx.m.sendPacket(nil, servMx.m.laddr, timedOut.sockID, 0, dp)
+	}
+
+	// which mustn't hold up the second
+	servers[1].SetReadDeadline(time.Now().Add(5 * time.Second))
+	echoOnce(t, clients[1], servers[1], "still here")
+}
@@ -0,0 +1,55 @@
+package udt
+
+// MuxStats contains metrics for everything sharing a local address (such as a relay server's listener and all of the
+// connections it has accepted), for capacity planning
+type MuxStats struct {
+	ActiveSockets      uint   // number of connections currently open on this address (including those still connecting)
+	RendezvousAttempts uint64 // number of rendezvous connections attempted
+	HandshakeAccepted  uint64 // number of handshakes a listener created a new connection for
+	HandshakeRefused   uint64 // number of handshakes refused with a reason sent to the peer (see RejectError)
+	HandshakeDrop      uint64 // number of handshakes a listener discarded for having too many waiting to be processed
+	HandshakeResumed   uint64 // number of handshakes a listener skipped the syn cookie exchange for by resuming a session
+	PktIn              uint64 // number of datagrams received
+	PktOut             uint64 // number of datagrams sent
+	PktDecodeErr       uint64 // number of datagrams that couldn't be decoded
+	PktTrailingErr     uint64 // number of datagrams rejected for trailing data (see Config.StrictDecoding)
+	PktPanic           uint64 // number of datagrams dropped because handling them panicked (each is logged with its stack)
+	PktUnknownSock     uint64 // number of packets discarded for being addressed to a socket ID that isn't open here
+	PktWrongPeer       uint64 // number of packets discarded for coming from an address other than the connection's peer
+	ByteMemUsed        uint64 // bytes of memory held by all connections, as counted against Config.MemoryLimit (0 if there's no limit)
+}
+
+// stats returns a snapshot of the metrics for this multiplexer
+func (m *multiplexer) stats() MuxStats {
+	return MuxStats{
+		ActiveSockets:      uint(m.sockets.count()),
+		RendezvousAttempts: m.rvAttempts.get(),
+		HandshakeAccepted:  m.hsAccepted.get(),
+		HandshakeRefused:   m.hsRefused.get(),
+		HandshakeDrop:      m.hsDropped.get(),
+		HandshakeResumed:   m.hsResumed.get(),
+		PktIn:              m.pktIn.get(),
+		PktOut:             m.pktOut.get(),
+		PktDecodeErr:       m.pktDecodeErr.get(),
+		PktTrailingErr:     m.pktTrailing.get(),
+		PktPanic:           m.pktPanic.get(),
+		PktUnknownSock:     m.pktNoSocket.get(),
+		PktWrongPeer:       m.pktWrongPeer.get(),
+		ByteMemUsed:        m.mem.getUsed(),
+	}
+}
+
+// MuxStats returns a snapshot of the metrics for everything sharing this connection's local address
+func (s *udtSocket) MuxStats() MuxStats {
+	return s.m.stats()
+}
+
+// MuxStats returns a snapshot of the metrics for everything sharing this listener's local address
+func (l *listener) MuxStats() MuxStats {
+	return l.m.stats()
+}
+
+// MuxStats returns a snapshot of the metrics for everything using this transport
+func (mx *Multiplexer) MuxStats() MuxStats {
+	return mx.m.stats()
+}
@@ -0,0 +1,75 @@
+package udt
+
+import (
+	"net"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestMuxStats(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if _, err := server.Read(buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+
+	stats := server.MuxStats()
+	if stats.ActiveSockets != 1 || stats.HandshakeAccepted != 1 || stats.HandshakeRefused != 0 {
+		t.Errorf("expected one accepted connection, got %+v", stats)
+	}
+	if stats.PktIn == 0 || stats.PktOut == 0 {
+		t.Errorf("expected datagrams to be counted in both directions, got %+v", stats)
+	}
+	if client.MuxStats().HandshakeAccepted != 0 {
+		t.Error("dialing side counted a handshake as accepted")
+	}
+
+	// packets for sockets we don't have, or that can't be decoded, are counted as they're discarded
+	m := server.(*udtSocket).m
+	pkt := make([]byte, 64)
+	n, _ := packet.NewKeepAlivePacket(server.LocalAddr().(*UDTAddr).SocketID+1, 0).WriteTo(pkt)
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	m.readPacket(pkt, int(n), from, 0, 0)
+	m.readPacket(pkt, 3, from, 0, 0)
+	after := server.MuxStats()
+	if after.PktUnknownSock != stats.PktUnknownSock+1 || after.PktDecodeErr != stats.PktDecodeErr+1 {
+		t.Errorf("expected one unknown-socket and one undecodable packet, got %+v then %+v", stats, after)
+	}
+}
+
+func TestPacketPanicRecovered(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	// a handler that panics stands in for a bug in decoding
+	packet.RegisterUserPacketHandler(0x7e57, func(p *packet.UserDefControlPacket) (string, error) {
+		panic("malformed")
+	})
+	defer packet.RegisterUserPacketHandler(0x7e57, nil)
+
+	m := server.(*udtSocket).m
+	pkt := make([]byte, 64)
+	n, _ := packet.NewUserDefControlPacket(server.LocalAddr().(*UDTAddr).SocketID, 0, 0x7e57, 0, nil).WriteTo(pkt)
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	m.readPacketSafely(pkt, int(n), from, 0, 0)
+	if stats := server.MuxStats(); stats.PktPanic != 1 {
+		t.Errorf("expected the packet to be counted as panicking, got %+v", stats)
+	}
+
+	// and the connection carries on
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,129 @@
+package udt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// newTestReceiver creates the receiving side of a socket that isn't connected to anything, with the packets it sends
+// placed on the returned channel
+func newTestReceiver(config *Config) (*udtSocketRecv, chan packet.Packet) {
+	sendPacket := make(chan packet.Packet, 16)
+	s := &udtSocket{Config: config, clock: newManualClock(), rtt: newRTTEstimator(), m: &multiplexer{}}
+	sr := &udtSocketRecv{socket: s, sendFeedback: sendPacket}
+	return sr, sendPacket
+}
+
+// reportLoss places packets in the receiver's loss list as though they'd just been reported to our peer
+func reportLoss(sr *udtSocketRecv, now time.Time, seqs ...uint32) {
+	for _, seq := range seqs {
+		sr.recvLossList = append(sr.recvLossList, recvLossEntry{packetID: packet.PacketID{Seq: seq}, lastFeedback: now, numNAK: 1})
+	}
+}
+
+func TestNAKSuppression(t *testing.T) {
+	sr, sent := newTestReceiver(DefaultConfig())
+	start := sr.socket.clock.Now()
+	sr.farRecdPktSeq = packet.PacketID{Seq: 9}
+	sr.farNextPktSeq = packet.PacketID{Seq: 21}
+	reportLoss(sr, start, 10, 11, 12, 13, 14, 20)
+
+	// losses reported recently aren't reported again
+	sr.nakEvent(start.Add(100 * time.Millisecond))
+	if len(sent) != 0 {
+		t.Fatalf("loss resent too soon: %v", <-sent)
+	}
+	if n := sr.nakSuppressed.get(); n != 6 {
+		t.Errorf("expected 6 suppressed loss reports, counted %d", n)
+	}
+
+	// until they've gone unanswered for twice the (initial 100ms +4*50ms variance) interval
+	sr.nakEvent(start.Add(700 * time.Millisecond))
+	select {
+	case p := <-sent:
+		nak, ok := p.(*packet.NakPacket)
+		want := []uint32{10 | 0x80000000, 14, 20}
+		if !ok || len(nak.CmpLossInfo) != len(want) {
+			t.Fatalf("expected a NAK reporting %v, got %v", want, p)
+		}
+		for i := range want {
+			if nak.CmpLossInfo[i] != want[i] {
+				t.Errorf("expected a NAK reporting %v, got %v", want, nak.CmpLossInfo)
+			}
+		}
+	default:
+		t.Fatal("loss wasn't resent")
+	}
+
+	// after which the interval grows with each report
+	sr.nakEvent(start.Add(1500 * time.Millisecond))
+	if len(sent) != 0 {
+		t.Fatalf("loss resent too soon: %v", <-sent)
+	}
+
+	// and no empty NAKs are sent once nothing's lost
+	sr.recvLossList = sr.recvLossList[:0]
+	sr.sendNAK(sr.recvLossList)
+	if len(sent) != 0 {
+		t.Errorf("sent an empty NAK: %v", <-sent)
+	}
+}
+
+func TestNAKIntervalScalesWithLoss(t *testing.T) {
+	sr, sent := newTestReceiver(DefaultConfig())
+	start := sr.socket.clock.Now()
+	sr.farRecdPktSeq = packet.PacketID{Seq: 9}
+	sr.farNextPktSeq = packet.PacketID{Seq: 110}
+	for seq := uint32(10); seq < 110; seq++ {
+		reportLoss(sr, start, seq)
+	}
+
+	// at 100 packets/sec our peer needs a second to resend the 100 packets we've reported lost, so we wait at least
+	// that long between reports rather than just the roundtrip time
+	sr.recvRate.set(100)
+	if interval := sr.nakInterval(); interval != time.Second {
+		t.Errorf("expected a 1s NAK interval, got %s", interval)
+	}
+	sr.nakEvent(start.Add(time.Second))
+	if len(sent) != 0 {
+		t.Fatalf("loss resent too soon: %v", <-sent)
+	}
+	sr.nakEvent(start.Add(2*time.Second + time.Millisecond))
+	if len(sent) != 1 {
+		t.Error("loss wasn't resent")
+	}
+}
+
+func TestNAKResendTiming(t *testing.T) {
+	sr, sent := newTestReceiver(DefaultConfig())
+	clock := sr.socket.clock.(*manualClock)
+	sr.farRecdPktSeq = packet.PacketID{Seq: 9}
+	sr.farNextPktSeq = packet.PacketID{Seq: 11}
+	reportLoss(sr, clock.Now(), 10)
+	sr.armTimers()
+
+	// the NAK timer fires every 4 * 100ms roundtrip time +50ms variance +10ms, and a loss is reported again once
+	// it has gone unanswered for k * (100ms + 4 * 50ms), with k counting up from 2
+	for idx, resent := range []bool{false, true, false, true, false, false, true} {
+		now := expectTimer(t, clock, sr.nakTimerEvent, 460*time.Millisecond)
+		sr.nakEvent(now)
+		if (len(sent) != 0) != resent {
+			t.Fatalf("NAK timer %d: expected resent=%t", idx+1, resent)
+		}
+		for len(sent) > 0 {
+			<-sent
+		}
+	}
+	if n := sr.recvLossList[0].numNAK; n != 4 {
+		t.Errorf("expected the loss to have been reported 4 times, got %d", n)
+	}
+
+	// once nothing is lost the timer stops
+	sr.recvLossList = nil
+	sr.nakEvent(expectTimer(t, clock, sr.nakTimerEvent, 460*time.Millisecond))
+	if sr.nakTimerEvent != nil || len(sent) != 0 {
+		t.Error("expected the NAK timer to stop once nothing is lost")
+	}
+}
@@ -0,0 +1,118 @@
+package udt
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+A few of the settings a connection takes from its Config can be changed while it's running with SetOption, such as to
+tune a long-running transfer without restarting it.  The Config itself isn't changed (it may be shared with other
+connections), only the connection SetOption is called on (or for LocalMaxBandwidth, everything sharing its local
+address).
+
+Values may be passed with their natural type (such as a time.Duration, or any integer type for a bandwidth) or as a
+string, such as one typed in by an operator ("10ms", "1000000").
+*/
+
+// Option names a setting that can be changed on a live connection with SetOption
+type Option string
+
+const (
+	// OptMaxBandwidth is the connection's bandwidth limit in bytes/sec (0 = unlimited), see Config.MaxBandwidth
+	OptMaxBandwidth Option = "MaxBandwidth"
+	// OptLocalMaxBandwidth is the bandwidth limit in bytes/sec of everything sharing the connection's local address
+	// (0 = unlimited), see Config.LocalMaxBandwidth
+	OptLocalMaxBandwidth Option = "LocalMaxBandwidth"
+	// OptACKPeriod is the maximum time between periodic ACKs (0 = SYN, 10ms), see Config.ACKPeriod
+	OptACKPeriod Option = "ACKPeriod"
+	// OptNAKPeriod is the time between repeated loss reports (0 = calculated from the roundtrip time), see
+	// Config.NAKPeriod
+	OptNAKPeriod Option = "NAKPeriod"
+)
+
+// SetOption changes a setting on this connection while it's running.  An error is returned (and nothing is changed) if
+// the option isn't one that can be changed, or the value isn't suitable for it
+func (s *udtSocket) SetOption(name Option, value interface{}) error {
+	switch name {
+	case OptMaxBandwidth:
+		rate, err := optionBandwidth(name, value)
+		if err != nil {
+			return err
+		}
+		s.sendLimit.setRate(rate)
+	case OptLocalMaxBandwidth:
+		rate, err := optionBandwidth(name, value)
+		if err != nil {
+			return err
+		}
+		s.m.sched.setLimit(s.clock, rate)
+	case OptACKPeriod:
+		period, err := optionDuration(name, value)
+		if err != nil {
+			return err
+		}
+		s.ackPeriod.set(period)
+	case OptNAKPeriod:
+		period, err := optionDuration(name, value)
+		if err != nil {
+			return err
+		}
+		s.nakPeriod.set(period)
+	default:
+		return fmt.Errorf("Unknown option %q", string(name))
+	}
+	return nil
+}
+
+// optionBandwidth interprets the value of a bandwidth option, in bytes/sec
+func optionBandwidth(name Option, value interface{}) (uint64, error) {
+	var rate int64
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case uint:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case int:
+		rate = int64(v)
+	case int64:
+		rate = v
+	case int32:
+		rate = int64(v)
+	case string:
+		r, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid value %q for option %s: %s", v, string(name), err.Error())
+		}
+		return r, nil
+	default:
+		return 0, fmt.Errorf("Invalid type %T for option %s, expected an integer", value, string(name))
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("Invalid value %d for option %s, cannot be negative", rate, string(name))
+	}
+	return uint64(rate), nil
+}
+
+// optionDuration interprets the value of a time period option
+func optionDuration(name Option, value interface{}) (time.Duration, error) {
+	var period time.Duration
+	switch v := value.(type) {
+	case time.Duration:
+		period = v
+	case string:
+		var err error
+		if period, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("Invalid value %q for option %s: %s", v, string(name), err.Error())
+		}
+	default:
+		return 0, fmt.Errorf("Invalid type %T for option %s, expected a time.Duration", value, string(name))
+	}
+	if period < 0 {
+		return 0, fmt.Errorf("Invalid value %v for option %s, cannot be negative", period, string(name))
+	}
+	return period, nil
+}
@@ -0,0 +1,65 @@
+package udt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetOption(t *testing.T) {
+	serv, client, server := connectWithClock(t, 68, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+
+	for _, tc := range []struct {
+		name  Option
+		value interface{}
+	}{
+		{OptMaxBandwidth, 1 << 20},
+		{OptLocalMaxBandwidth, "4000000"},
+		{OptACKPeriod, 5 * time.Millisecond},
+		{OptNAKPeriod, "50ms"},
+	} {
+		if err := client.SetOption(tc.name, tc.value); err != nil {
+			t.Errorf("error setting %s to %v: %s", tc.name, tc.value, err.Error())
+		}
+	}
+	if rate := client.sendLimit.getRate(); rate != 1<<20 {
+		t.Errorf("bandwidth limit is %d, expected %d", rate, 1<<20)
+	}
+	if limit := client.m.sched.limit; limit == nil || limit.getRate() != 4000000 {
+		t.Error("local bandwidth limit wasn't applied to the multiplexer")
+	}
+	if period := client.recv.ackTimerPeriod(); period != 5*time.Millisecond {
+		t.Errorf("ACK period is %v, expected 5ms", period)
+	}
+	if period := client.recv.nakTimerPeriod(); period != 50*time.Millisecond {
+		t.Errorf("NAK period is %v, expected 50ms", period)
+	}
+
+	// removing the limits
+	client.SetOption(OptMaxBandwidth, uint64(0))
+	client.SetOption(OptLocalMaxBandwidth, 0)
+	if client.sendLimit.ready() != 0 || client.m.sched.limit != nil {
+		t.Error("bandwidth limits weren't removed")
+	}
+
+	// bad values are refused, leaving the setting alone
+	for _, tc := range []struct {
+		name  Option
+		value interface{}
+	}{
+		{"NoSuchOption", 1},
+		{OptMaxBandwidth, -1},
+		{OptMaxBandwidth, "fast"},
+		{OptACKPeriod, 10},
+		{OptACKPeriod, "-1s"},
+	} {
+		if err := client.SetOption(tc.name, tc.value); err == nil {
+			t.Errorf("expected an error setting %s to %v", tc.name, tc.value)
+		}
+	}
+	if period := client.recv.ackTimerPeriod(); period != 5*time.Millisecond {
+		t.Errorf("ACK period changed to %v by a refused value", period)
+	}
+}
@@ -0,0 +1,40 @@
+package udt
+
+import "time"
+
+/*
+Congestion control paces data packets by asking for a period (SND) between them, which at high rates is far shorter
+than a Go timer can reliably wait: a timer asked to wait 10µs may well fire after a millisecond.  Waiting for SND after
+each packet would then send at a fraction of the intended rate, in uneven bursts that the congestion control reads as
+a slow link.
+
+Instead the pacer keeps a schedule of when each packet is due, advancing it by SND for each packet sent.  When a timer
+fires late, the packets that fell due in the meantime are sent straight away to catch up, so the average rate is the
+one congestion control asked for whatever the timer resolution.  How far we'll fall behind (and so the largest burst
+that catching up can cause) is limited, and after an idle period the schedule starts over rather than sending
+everything that "would have" gone out.
+*/
+
+const (
+	maxPacingBurst = 16                     // the number of packet periods we'll catch up on after a late timer...
+	minPacingLag   = 500 * time.Microsecond // ...or this long, whichever is more (roughly how late a timer may fire)
+)
+
+// pacer schedules data packets at the intervals set by congestion control
+type pacer struct {
+	next time.Time // when the next packet is due
+}
+
+// delay returns how long to wait before sending another packet, following one sent at now with the specified period
+// between packets
+func (p *pacer) delay(now time.Time, snd time.Duration) time.Duration {
+	maxLag := time.Duration(maxPacingBurst) * snd
+	if maxLag < minPacingLag {
+		maxLag = minPacingLag
+	}
+	if p.next.IsZero() || now.Sub(p.next) > maxLag {
+		p.next = now // idle, or too far behind to catch up without a burst
+	}
+	p.next = p.next.Add(snd)
+	return p.next.Sub(now)
+}
@@ -0,0 +1,40 @@
+package udt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	var p pacer
+	start := time.Now()
+	snd := 10 * time.Microsecond
+	if wait := p.delay(start, snd); wait != snd {
+		t.Errorf("expected to wait %v after the first packet, got %v", snd, wait)
+	}
+
+	// the timer fires 100µs late: the packets that fell due meanwhile go out immediately, then pacing resumes
+	now := start.Add(100 * time.Microsecond)
+	immediate := 0
+	for p.delay(now, snd) <= 0 {
+		immediate++
+	}
+	if immediate != 9 {
+		t.Errorf("expected to catch up on 9 packets after a late timer, sent %d", immediate)
+	}
+
+	// falling further behind than we're willing to catch up on starts the schedule over
+	now = now.Add(time.Second)
+	if wait := p.delay(now, snd); wait != snd {
+		t.Errorf("expected to wait %v after being idle, got %v", snd, wait)
+	}
+	snd = time.Millisecond
+	now = now.Add(20 * time.Millisecond) // more than 16 periods late
+	if wait := p.delay(now, snd); wait != snd {
+		t.Errorf("expected to wait %v after falling far behind, got %v", snd, wait)
+	}
+	now = now.Add(3 * time.Millisecond) // only a few periods late
+	if wait := p.delay(now, snd); wait > 0 {
+		t.Errorf("expected to catch up after falling slightly behind, waiting %v", wait)
+	}
+}
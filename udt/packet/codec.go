@@ -0,0 +1,174 @@
+package packet
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTruncated is reported when a packet ends before all of its fields have been read
+	ErrTruncated = errors.New("packet truncated")
+	// ErrTrailingData is reported by ReadPacketFromStrict when a packet continues past its last field
+	ErrTrailingData = errors.New("unexpected data after end of packet")
+	// ErrBufferTooSmall is reported when a packet doesn't fit in the buffer it's being written to
+	ErrBufferTooSmall = errors.New("buffer too small")
+	// ErrFieldTooLarge is reported when a field holds more than the packet format can represent
+	ErrFieldTooLarge = errors.New("field too large")
+)
+
+// PacketError describes a packet that couldn't be read or written
+type PacketError struct {
+	Op     string     // "read" or "write"
+	Type   PacketType // type of the packet
+	Field  string     // the field that couldn't be read or written
+	Offset int        // byte offset of Field within the packet
+	Size   int        // size of the packet being read, or of the buffer being written to
+	Err    error      // the problem encountered, such as ErrTruncated
+}
+
+func (e *PacketError) Error() string {
+	return fmt.Sprintf("%s %s packet: %s at offset %d of %d: %s", e.Op, PacketTypeName(e.Type), e.Field, e.Offset, e.Size,
+		e.Err.Error())
+}
+
+// Unwrap returns the underlying problem, for use with errors.Is
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// reader decodes the fields of a packet in order.  Once a field can't be read every subsequent read does nothing,
+// and err describes the first failure
+type reader struct {
+	pt   PacketType
+	data []byte
+	off  int   // offset of the next field
+	pad  int   // number of unused bytes that may follow the last field, even in strict mode
+	err  error // the first field that couldn't be read
+}
+
+func newReader(pt PacketType, data []byte) *reader {
+	return &reader{pt: pt, data: data}
+}
+
+func (r *reader) fail(field string, err error) {
+	if r.err == nil {
+		r.err = &PacketError{Op: "read", Type: r.pt, Field: field, Offset: r.off, Size: len(r.data), Err: err}
+	}
+}
+
+// take returns the next n bytes of the packet (without copying them), or nil if they aren't there
+func (r *reader) take(field string, n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.data) {
+		r.fail(field, ErrTruncated)
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *reader) uint16(field string) uint16 {
+	if b := r.take(field, 2); b != nil {
+		return endianness.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32(field string) uint32 {
+	if b := r.take(field, 4); b != nil {
+		return endianness.Uint32(b)
+	}
+	return 0
+}
+
+// bytes returns a copy of the next n bytes of the packet
+func (r *reader) bytes(field string, n int) []byte {
+	b := r.take(field, n)
+	if b == nil {
+		return nil
+	}
+	result := make([]byte, n)
+	copy(result, b)
+	return result
+}
+
+// remaining returns the number of bytes that haven't been read yet
+func (r *reader) remaining() int {
+	return len(r.data) - r.off
+}
+
+// allowPad permits up to n unused bytes after the last field, which the reference implementation sends after the
+// header of some control packets
+func (r *reader) allowPad(n int) {
+	r.pad = n
+}
+
+// finish checks that the packet has been decoded, and (if strict) that nothing unexpected follows it
+func (r *reader) finish(strict bool) error {
+	if r.err == nil && strict && r.remaining() > r.pad {
+		r.fail("end of packet", ErrTrailingData)
+	}
+	return r.err
+}
+
+// writer encodes the fields of a packet in order.  Once a field doesn't fit every subsequent write does nothing,
+// and err describes the first failure
+type writer struct {
+	pt  PacketType
+	buf []byte
+	off int   // offset of the next field
+	err error // the first field that couldn't be written
+}
+
+func newWriter(pt PacketType, buf []byte) *writer {
+	return &writer{pt: pt, buf: buf}
+}
+
+func (w *writer) fail(field string, err error) {
+	if w.err == nil {
+		w.err = &PacketError{Op: "write", Type: w.pt, Field: field, Offset: w.off, Size: len(w.buf), Err: err}
+	}
+}
+
+// space returns the next n bytes of the buffer to be written into, or nil if they aren't there
+func (w *writer) space(field string, n int) []byte {
+	if w.err != nil {
+		return nil
+	}
+	if w.off+n > len(w.buf) {
+		w.fail(field, ErrBufferTooSmall)
+		return nil
+	}
+	b := w.buf[w.off : w.off+n]
+	w.off += n
+	return b
+}
+
+func (w *writer) uint16(field string, v uint16) {
+	if b := w.space(field, 2); b != nil {
+		endianness.PutUint16(b, v)
+	}
+}
+
+func (w *writer) uint32(field string, v uint32) {
+	if b := w.space(field, 4); b != nil {
+		endianness.PutUint32(b, v)
+	}
+}
+
+func (w *writer) bytes(field string, v []byte) {
+	if b := w.space(field, len(v)); b != nil {
+		copy(b, v)
+	}
+}
+
+// finish returns the length of the packet written, or why it couldn't be
+func (w *writer) finish() (uint, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return uint(w.off), nil
+}
@@ -0,0 +1,36 @@
+/*
+Package packet encodes and decodes the packets exchanged by UDT peers, and can be used on its own by tools (such as
+analyzers or proxies) that need to inspect or generate UDT traffic.
+
+# Decoding
+
+ReadPacketFrom decodes the contents of a single UDP datagram, returning one of the packet types defined here (which
+can be told apart with a type switch, or by PacketType).  Anything following the last field of the packet is ignored;
+ReadPacketFromStrict rejects such packets instead.  A packet that can't be decoded is described by a *PacketError,
+which wraps one of the sentinel errors (such as ErrTruncated) for use with errors.Is.
+
+Data packets returned by ReadPacketFrom are taken from a pool, and may be handed back with DataPacket.Release once
+neither the packet nor its Data is referenced anywhere.  Data is copied out of the datagram for every packet type, so
+the caller's buffer may be reused as soon as ReadPacketFrom returns.
+
+# Encoding
+
+Each packet type has a constructor (such as NewAckPacket or NewMessagePacket) that fills in its header and principal
+fields, after which any remaining exported fields can be set directly.  WriteTo encodes the packet into the caller's
+buffer, returning the length of the datagram written or a *PacketError if it doesn't fit.
+
+Every packet type implements fmt.Stringer, describing the packet and its decoded fields.
+
+# User-defined packets
+
+UDT reserves a control packet type for application use, which carries its own 16-bit message type.
+RegisterUserPacketHandler installs a handler for a particular message type, which ReadPacketFrom uses to validate
+incoming packets and String uses to describe them.
+
+# Conformance
+
+Vectors returns a known encoding of every packet type, laid out as the UDT4 reference implementation sends them
+(including the padding it places after some control packets), and Vector.Check verifies one against this package.  A
+fork of the package can run CheckVectors from its own tests to be sure its changes haven't altered the wire format.
+*/
+package packet
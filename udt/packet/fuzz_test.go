@@ -0,0 +1,112 @@
+//go:build go1.18
+// +build go1.18
+
+package packet
+
+import (
+	"net"
+	"testing"
+)
+
+// fuzzSeeds returns an encoded example of each packet type
+func fuzzSeeds() [][]byte {
+	hs := &HandshakePacket{
+		UdtVer:         4,
+		SockType:       TypeDGRAM,
+		InitPktSeq:     PacketID{Seq: 50},
+		MaxPktSize:     1500,
+		MaxFlowWinSize: 8192,
+		ReqType:        HsRequest,
+		SockID:         59,
+		SockAddr:       net.ParseIP("127.0.0.1"),
+		Extensions:     []HandshakeExtension{{Type: HsExtFEC, Data: []byte{0, 0, 0, 8}}},
+	}
+	dp := &DataPacket{Seq: PacketID{Seq: 50}, Data: []byte("payload")}
+	dp.SetMessageData(MbOnly, true, 11)
+	pkts := []Packet{
+		hs,
+		&KeepAlivePacket{},
+		&AckPacket{AckSeqNo: 1, PktSeqHi: PacketID{Seq: 50}, Rtt: 1000, RttVar: 500, BuffAvail: 100},
+		&AckPacket{AckSeqNo: 1, PktSeqHi: PacketID{Seq: 50}, IncludeLink: true, PktRecvRate: 10, EstLinkCap: 20},
+		&LightAckPacket{PktSeqHi: PacketID{Seq: 50}},
+		&NakPacket{CmpLossInfo: []uint32{0x80000010, 0x20, 0x30}},
+		&CongestionPacket{},
+		&ShutdownPacket{},
+		&Ack2Packet{AckSeqNo: 1},
+		&MsgDropReqPacket{MsgID: 11, FirstSeq: PacketID{Seq: 50}, LastSeq: PacketID{Seq: 52}},
+		&ErrPacket{Errno: 1},
+		&UserDefControlPacket{MsgType: 1, AddtlInfo: 2, Data: []byte("user data")},
+		dp,
+	}
+
+	var seeds [][]byte
+	for _, p := range pkts {
+		p.SetHeader(59, 100)
+		buf := make([]byte, 1500)
+		n, err := p.WriteTo(buf)
+		if err != nil {
+			panic(err)
+		}
+		seeds = append(seeds, buf[:n])
+	}
+	return seeds
+}
+
+// reencode writes a decoded packet back out, which must not fail
+func reencode(t *testing.T, p ControlPacket, size int) {
+	buf := make([]byte, size+64)
+	if _, err := p.WriteTo(buf); err != nil {
+		t.Errorf("unable to re-encode %s packet: %s", PacketTypeName(p.PacketType()), err.Error())
+	}
+}
+
+func FuzzReadPacketFrom(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		strict, strictErr := ReadPacketFromStrict(data)
+		p, err := ReadPacketFrom(data)
+		if err != nil {
+			if strictErr == nil {
+				t.Errorf("packet accepted in strict mode but not otherwise: %s", err.Error())
+			}
+			return
+		}
+		reencode(t, p, len(data))
+		if strictErr == nil {
+			reencode(t, strict, len(data))
+		}
+	})
+}
+
+// FuzzControlReadFrom feeds each control packet's decoder directly, bypassing the type dispatch in ReadPacketFrom
+func FuzzControlReadFrom(f *testing.F) {
+	decoders := []func() ControlPacket{
+		func() ControlPacket { return &HandshakePacket{} },
+		func() ControlPacket { return &KeepAlivePacket{} },
+		func() ControlPacket { return &AckPacket{} },
+		func() ControlPacket { return &LightAckPacket{} },
+		func() ControlPacket { return &NakPacket{} },
+		func() ControlPacket { return &CongestionPacket{} },
+		func() ControlPacket { return &ShutdownPacket{} },
+		func() ControlPacket { return &Ack2Packet{} },
+		func() ControlPacket { return &MsgDropReqPacket{} },
+		func() ControlPacket { return &ErrPacket{} },
+		func() ControlPacket { return &UserDefControlPacket{} },
+	}
+	for idx := range decoders {
+		for _, seed := range fuzzSeeds() {
+			f.Add(uint8(idx), seed)
+		}
+	}
+	f.Fuzz(func(t *testing.T, which uint8, data []byte) {
+		p := decoders[int(which)%len(decoders)]()
+		r := newReader(p.PacketType(), data)
+		p.readFrom(r)
+		if r.finish(false) != nil {
+			return
+		}
+		reencode(t, p, len(data))
+	})
+}
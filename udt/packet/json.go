@@ -0,0 +1,53 @@
+package packet
+
+// JSON encoding of packets, for dumping them in logs or diagnostics
+
+import "encoding/json"
+
+// Packets marshal to JSON as their exported fields, with the enumerations among them written by name (as their String
+// methods describe them) and packet IDs as plain sequence numbers.  Data packets leave out their payload, giving its
+// length instead
+
+// MarshalText returns the name of this packet type
+func (pt PacketType) MarshalText() ([]byte, error) {
+	return []byte(pt.String()), nil
+}
+
+// MarshalText returns the name of this socket type
+func (t SocketType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// MarshalText returns the name of this handshake type
+func (t HandshakeReqType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// MarshalText returns the name of this handshake extension
+func (t HandshakeExtType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// MarshalText returns the name of this message boundary
+func (mb MessageBoundary) MarshalText() ([]byte, error) {
+	return []byte(mb.String()), nil
+}
+
+// MarshalJSON returns this packet ID as its sequence number
+func (p PacketID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Seq)
+}
+
+// MarshalJSON returns the header of this data packet and the length of its payload
+func (dp *DataPacket) MarshalJSON() ([]byte, error) {
+	boundary, order, msg := dp.GetMessageData()
+	return json.Marshal(struct {
+		Seq       PacketID
+		MsgID     uint32
+		Boundary  MessageBoundary
+		InOrder   bool
+		TS        uint32
+		DstSockID uint32
+		Len       int
+	}{dp.Seq, msg, boundary, order, dp.ts, dp.DstSockID, len(dp.Data)})
+}
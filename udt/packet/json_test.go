@@ -0,0 +1,29 @@
+package packet
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	hs := &HandshakePacket{UdtVer: 4, SockType: TypeDGRAM, InitPktSeq: PacketID{Seq: 50}, ReqType: HsResponse,
+		SockID: 7, SockAddr: net.IPv4(127, 0, 0, 1), Extensions: []HandshakeExtension{{Type: HsExtService, Data: []byte("x")}}}
+	data := NewMessagePacket(3, 100, PacketID{Seq: 51}, MbOnly, true, 9, []byte("hello"))
+
+	for _, tc := range []struct {
+		p    Packet
+		want string
+	}{
+		{hs, `{"DstSockID":0,"UdtVer":4,"SockType":"dgram","InitPktSeq":50,"MaxPktSize":0,"MaxFlowWinSize":0,` +
+			`"ReqType":"response","SockID":7,"SynCookie":0,"SockAddr":"127.0.0.1","Extensions":[{"Type":"service","Data":"eA=="}]}`},
+		{data, `{"Seq":51,"MsgID":9,"Boundary":"only","InOrder":true,"TS":100,"DstSockID":3,"Len":5}`},
+	} {
+		got, err := json.Marshal(tc.p)
+		if err != nil {
+			t.Errorf("error marshalling %s: %s", tc.p, err.Error())
+		} else if string(got) != tc.want {
+			t.Errorf("marshalled %s as %s, expected %s", tc.p, got, tc.want)
+		}
+	}
+}
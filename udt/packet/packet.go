@@ -4,7 +4,6 @@ package packet
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 )
 
@@ -29,49 +28,66 @@ type PacketType uint16
 
 const (
 	// Control packet types
-	ptHandshake  PacketType = 0x0
-	ptKeepalive  PacketType = 0x1
-	ptAck        PacketType = 0x2
-	ptNak        PacketType = 0x3
-	ptCongestion PacketType = 0x4 // unused in ver4
-	ptShutdown   PacketType = 0x5
-	ptAck2       PacketType = 0x6
-	ptMsgDropReq PacketType = 0x7
-	ptSpecialErr PacketType = 0x8 // undocumented but reference implementation seems to use it
-	ptUserDefPkt PacketType = 0x7FFF
-	ptData       PacketType = 0x8000 // not found in any control packet, but used to identify data packets
+	PtHandshake  PacketType = 0x0
+	PtKeepalive  PacketType = 0x1
+	PtAck        PacketType = 0x2
+	PtNak        PacketType = 0x3
+	PtCongestion PacketType = 0x4 // unused in ver4
+	PtShutdown   PacketType = 0x5
+	PtAck2       PacketType = 0x6
+	PtMsgDropReq PacketType = 0x7
+	PtSpecialErr PacketType = 0x8 // undocumented but reference implementation seems to use it
+	PtUserDefPkt PacketType = 0x7FFF
+	PtData       PacketType = 0x8000 // not found in any control packet, but used to identify data packets
 )
 
 // PacketTypeName returns a name describing the specified packet type
 func PacketTypeName(pt PacketType) string {
 	switch pt {
-	case ptHandshake:
+	case PtHandshake:
 		return "handshake"
-	case ptKeepalive:
+	case PtKeepalive:
 		return "keep-alive"
-	case ptAck:
+	case PtAck:
 		return "ack"
-	case ptNak:
+	case PtNak:
 		return "nak"
-	case ptCongestion:
+	case PtCongestion:
 		return "congestion"
-	case ptShutdown:
+	case PtShutdown:
 		return "shutdown"
-	case ptAck2:
+	case PtAck2:
 		return "ack2"
-	case ptMsgDropReq:
+	case PtMsgDropReq:
 		return "msg-drop"
-	case ptSpecialErr:
+	case PtSpecialErr:
 		return "error"
-	case ptUserDefPkt:
+	case PtUserDefPkt:
 		return "user-defined"
-	case ptData:
+	case PtData:
 		return "data"
 	default:
 		return fmt.Sprintf("packet-type-%d", int(pt))
 	}
 }
 
+// String returns the name of this packet type
+func (pt PacketType) String() string {
+	return PacketTypeName(pt)
+}
+
+// String returns the name of this socket type
+func (t SocketType) String() string {
+	switch t {
+	case TypeSTREAM:
+		return "stream"
+	case TypeDGRAM:
+		return "dgram"
+	default:
+		return fmt.Sprintf("socket-type-%d", int(t))
+	}
+}
+
 var (
 	endianness = binary.BigEndian
 )
@@ -87,12 +103,15 @@ type Packet interface {
 	// WriteTo writes this packet to the provided buffer, returning the length of the packet
 	WriteTo(buf []byte) (uint, error)
 
-	// readFrom reads the packet from a Reader
-	readFrom(data []byte) (err error)
+	// readFrom decodes the packet
+	readFrom(r *reader) (err error)
 
 	SetHeader(destSockID uint32, ts uint32)
 
 	PacketType() PacketType
+
+	// String describes the packet and its decoded fields
+	String() string
 }
 
 // ControlPacket represents a UDT control packet.
@@ -105,12 +124,15 @@ type ControlPacket interface {
 
 	WriteTo(buf []byte) (uint, error)
 
-	// readFrom reads the packet from a Reader
-	readFrom(data []byte) (err error)
+	// readFrom decodes the packet
+	readFrom(r *reader) (err error)
 
 	SetHeader(destSockID uint32, ts uint32)
 
 	PacketType() PacketType
+
+	// String describes the packet and its decoded fields
+	String() string
 }
 
 type ctrlHeader struct {
@@ -131,36 +153,47 @@ func (h *ctrlHeader) SetHeader(destSockID uint32, ts uint32) {
 	h.ts = ts
 }
 
-func (h *ctrlHeader) writeHdrTo(buf []byte, msgType PacketType, info uint32) (uint, error) {
-	l := len(buf)
-	if l < 16 {
-		return 0, errors.New("packet too small")
+// describe formats a control packet (with any fields following its header) for its String method
+func (h *ctrlHeader) describe(pt PacketType, fields string) string {
+	if fields != "" {
+		fields = " " + fields
 	}
+	return fmt.Sprintf("%s(dst=%d ts=%d%s)", PacketTypeName(pt), h.DstSockID, h.ts, fields)
+}
 
+func (h *ctrlHeader) writeHdrTo(w *writer, msgType PacketType, infoField string, info uint32) {
 	// Sets the flag bit to indicate this is a control packet
-	endianness.PutUint16(buf[0:2], uint16(msgType)|flagBit16)
-	endianness.PutUint16(buf[2:4], uint16(0)) // Write 16 bit reserved data
-
-	endianness.PutUint32(buf[4:8], info)
-	endianness.PutUint32(buf[8:12], h.ts)
-	endianness.PutUint32(buf[12:16], h.DstSockID)
-
-	return 16, nil
+	w.uint16("type", uint16(msgType)|flagBit16)
+	w.uint16("reserved", 0) // Write 16 bit reserved data
+	w.uint32(infoField, info)
+	w.uint32("timestamp", h.ts)
+	w.uint32("destination socket", h.DstSockID)
 }
 
-func (h *ctrlHeader) readHdrFrom(data []byte) (addtlInfo uint32, err error) {
-	l := len(data)
-	if l < 16 {
-		return 0, errors.New("packet too small")
-	}
-	addtlInfo = endianness.Uint32(data[4:8])
-	h.ts = endianness.Uint32(data[8:12])
-	h.DstSockID = endianness.Uint32(data[12:16])
+func (h *ctrlHeader) readHdrFrom(r *reader, infoField string) (addtlInfo uint32) {
+	r.uint32("type")
+	addtlInfo = r.uint32(infoField)
+	h.ts = r.uint32("timestamp")
+	h.DstSockID = r.uint32("destination socket")
 	return
 }
 
-// ReadPacketFrom takes the contents of a UDP packet and decodes it into a UDT packet
+// ReadPacketFrom takes the contents of a UDP packet and decodes it into a UDT packet.  Anything following the
+// packet's last field is ignored
 func ReadPacketFrom(data []byte) (p Packet, err error) {
+	return readPacketFrom(data, false)
+}
+
+// ReadPacketFromStrict decodes a UDP packet as ReadPacketFrom does, but rejects packets with unexpected data following
+// their last field (other than the padding the reference implementation places after some control packets)
+func ReadPacketFromStrict(data []byte) (p Packet, err error) {
+	return readPacketFrom(data, true)
+}
+
+func readPacketFrom(data []byte, strict bool) (p Packet, err error) {
+	if len(data) < 4 {
+		return nil, &PacketError{Op: "read", Field: "type", Size: len(data), Err: ErrTruncated}
+	}
 	h := endianness.Uint32(data[0:4])
 	if h&flagBit32 == flagBit32 {
 		// this is a control packet
@@ -170,41 +203,54 @@ func ReadPacketFrom(data []byte) (p Packet, err error) {
 		msgType := PacketType(h >> 16)
 
 		switch msgType {
-		case ptHandshake:
+		case PtHandshake:
 			p = &HandshakePacket{}
-		case ptKeepalive:
+		case PtKeepalive:
 			p = &KeepAlivePacket{}
-		case ptAck:
+		case PtAck:
 			if len(data) == 20 {
 				p = &LightAckPacket{}
 			} else {
 				p = &AckPacket{}
 			}
-		case ptNak:
+		case PtNak:
 			p = &NakPacket{}
-		case ptCongestion:
+		case PtCongestion:
 			p = &CongestionPacket{}
-		case ptShutdown:
+		case PtShutdown:
 			p = &ShutdownPacket{}
-		case ptAck2:
+		case PtAck2:
 			p = &Ack2Packet{}
-		case ptMsgDropReq:
+		case PtMsgDropReq:
 			p = &MsgDropReqPacket{}
-		case ptSpecialErr:
+		case PtSpecialErr:
 			p = &ErrPacket{}
-		case ptUserDefPkt:
-			p = &UserDefControlPacket{msgType: uint16(h & 0xffff)}
+		case PtUserDefPkt:
+			p = &UserDefControlPacket{MsgType: uint16(h & 0xffff)}
 		default:
-			return nil, fmt.Errorf("Unknown control packet type: %X", msgType)
+			return nil, fmt.Errorf("Unknown control packet type: %X", uint16(msgType))
+		}
+		r := newReader(msgType, data)
+		p.readFrom(r)
+		if err = r.finish(strict); err != nil {
+			return nil, err
 		}
-		err = p.readFrom(data)
-		return
+		if up, ok := p.(*UserDefControlPacket); ok {
+			if err = up.check(); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
 	}
 
 	// this is a data packet
-	p = &DataPacket{
-		Seq: PacketID{h},
+	dp := NewDataPacket()
+	dp.Seq = PacketID{h}
+	r := newReader(PtData, data)
+	dp.readFrom(r)
+	if err = r.finish(strict); err != nil {
+		dp.Release()
+		return nil, err
 	}
-	err = p.readFrom(data)
-	return
+	return dp, nil
 }
@@ -3,7 +3,7 @@ package packet
 // Structure of packets and functions for writing/reading them
 
 import (
-	"errors"
+	"fmt"
 )
 
 // AckPacket is a UDT packet acknowledging previously-received data packets and describing the state of the link
@@ -21,57 +21,54 @@ type AckPacket struct {
 	EstLinkCap  uint32 // Estimated link capacity (in number of packets per second)
 }
 
+// NewAckPacket returns an ACK acknowledging every packet before pktSeqHi.  The measurements describing the link are
+// filled in by the caller
+func NewAckPacket(dstSockID uint32, ts uint32, ackSeqNo uint32, pktSeqHi PacketID) *AckPacket {
+	return &AckPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, AckSeqNo: ackSeqNo, PktSeqHi: pktSeqHi}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *AckPacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	if l < 32 {
-		return 0, errors.New("packet too small")
-	}
-
-	if _, err := p.writeHdrTo(buf, ptAck, p.AckSeqNo); err != nil {
-		return 0, err
-	}
-
-	endianness.PutUint32(buf[16:20], p.PktSeqHi.Seq)
-	endianness.PutUint32(buf[20:24], p.Rtt)
-	endianness.PutUint32(buf[24:28], p.RttVar)
-	endianness.PutUint32(buf[28:32], p.BuffAvail)
+	w := newWriter(PtAck, buf)
+	p.writeHdrTo(w, PtAck, "ack number", p.AckSeqNo)
+	w.uint32("last packet", p.PktSeqHi.Seq)
+	w.uint32("rtt", p.Rtt)
+	w.uint32("rtt variance", p.RttVar)
+	w.uint32("buffer available", p.BuffAvail)
 	if p.IncludeLink {
-		if l < 40 {
-			return 0, errors.New("packet too small")
-		}
-		endianness.PutUint32(buf[32:36], p.PktRecvRate)
-		endianness.PutUint32(buf[36:40], p.EstLinkCap)
-		return 40, nil
+		w.uint32("receive rate", p.PktRecvRate)
+		w.uint32("link capacity", p.EstLinkCap)
 	}
-
-	return 32, nil
+	return w.finish()
 }
 
-func (p *AckPacket) readFrom(data []byte) (err error) {
-	l := len(data)
-	if l < 32 {
-		return errors.New("packet too small")
-	}
-	if p.AckSeqNo, err = p.readHdrFrom(data); err != nil {
-		return err
-	}
-	p.PktSeqHi = PacketID{endianness.Uint32(data[16:20])}
-	p.Rtt = endianness.Uint32(data[20:24])
-	p.RttVar = endianness.Uint32(data[24:28])
-	p.BuffAvail = endianness.Uint32(data[28:32])
-	if l >= 36 {
+func (p *AckPacket) readFrom(r *reader) (err error) {
+	p.AckSeqNo = p.readHdrFrom(r, "ack number")
+	p.PktSeqHi = PacketID{r.uint32("last packet")}
+	p.Rtt = r.uint32("rtt")
+	p.RttVar = r.uint32("rtt variance")
+	p.BuffAvail = r.uint32("buffer available")
+	if r.err == nil && r.remaining() >= 4 {
 		p.IncludeLink = true
-		p.PktRecvRate = endianness.Uint32(data[32:36])
-		if l >= 40 {
-			p.EstLinkCap = endianness.Uint32(data[36:40])
+		p.PktRecvRate = r.uint32("receive rate")
+		if r.remaining() >= 4 {
+			p.EstLinkCap = r.uint32("link capacity")
 		}
 	}
-
-	return nil
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *AckPacket) PacketType() PacketType {
-	return ptAck
+	return PtAck
+}
+
+// String returns a description of this packet and its fields
+func (p *AckPacket) String() string {
+	fields := fmt.Sprintf("ack=%d last=%d rtt=%d rttvar=%d avail=%d", p.AckSeqNo, p.PktSeqHi.Seq, p.Rtt, p.RttVar,
+		p.BuffAvail)
+	if p.IncludeLink {
+		fields += fmt.Sprintf(" rate=%d cap=%d", p.PktRecvRate, p.EstLinkCap)
+	}
+	return p.describe(PtAck, fields)
 }
@@ -2,23 +2,40 @@ package packet
 
 // Structure of packets and functions for writing/reading them
 
+import (
+	"fmt"
+)
+
 // Ack2Packet is a UDT packet acknowledging receipt of an ACK packet
 type Ack2Packet struct {
 	ctrlHeader
 	AckSeqNo uint32 // ACK sequence number
 }
 
+// NewAck2Packet returns a packet acknowledging the specified ACK
+func NewAck2Packet(dstSockID uint32, ts uint32, ackSeqNo uint32) *Ack2Packet {
+	return &Ack2Packet{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, AckSeqNo: ackSeqNo}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *Ack2Packet) WriteTo(buf []byte) (uint, error) {
-	return p.writeHdrTo(buf, ptAck2, p.AckSeqNo)
+	w := newWriter(PtAck2, buf)
+	p.writeHdrTo(w, PtAck2, "ack number", p.AckSeqNo)
+	return w.finish()
 }
 
-func (p *Ack2Packet) readFrom(data []byte) (err error) {
-	p.AckSeqNo, err = p.readHdrFrom(data)
-	return
+func (p *Ack2Packet) readFrom(r *reader) (err error) {
+	p.AckSeqNo = p.readHdrFrom(r, "ack number")
+	r.allowPad(4) // the reference implementation sends 4 bytes of padding after the header
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *Ack2Packet) PacketType() PacketType {
-	return ptAck2
+	return PtAck2
+}
+
+// String returns a description of this packet and its fields
+func (p *Ack2Packet) String() string {
+	return p.describe(PtAck2, fmt.Sprintf("ack=%d", p.AckSeqNo))
 }
@@ -7,17 +7,30 @@ type CongestionPacket struct {
 	ctrlHeader
 }
 
+// NewCongestionPacket returns a congestion warning addressed to the specified socket
+func NewCongestionPacket(dstSockID uint32, ts uint32) *CongestionPacket {
+	return &CongestionPacket{ctrlHeader{ts: ts, DstSockID: dstSockID}}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *CongestionPacket) WriteTo(buf []byte) (uint, error) {
-	return p.writeHdrTo(buf, ptCongestion, 0)
+	w := newWriter(PtCongestion, buf)
+	p.writeHdrTo(w, PtCongestion, "reserved", 0)
+	return w.finish()
 }
 
-func (p *CongestionPacket) readFrom(data []byte) (err error) {
-	_, err = p.readHdrFrom(data)
-	return
+func (p *CongestionPacket) readFrom(r *reader) (err error) {
+	p.readHdrFrom(r, "reserved")
+	r.allowPad(4) // the reference implementation sends 4 bytes of padding after the header
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *CongestionPacket) PacketType() PacketType {
-	return ptCongestion
+	return PtCongestion
+}
+
+// String returns a description of this packet and its fields
+func (p *CongestionPacket) String() string {
+	return p.describe(PtCongestion, "")
 }
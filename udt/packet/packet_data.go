@@ -1,6 +1,9 @@
 package packet
 
-import "errors"
+import (
+	"fmt"
+	"sync"
+)
 
 // MessageBoundary flags for where this packet falls within a message
 type MessageBoundary uint8
@@ -16,6 +19,22 @@ const (
 	MbMiddle MessageBoundary = 0
 )
 
+// String returns the name of this message boundary
+func (mb MessageBoundary) String() string {
+	switch mb {
+	case MbFirst:
+		return "first"
+	case MbLast:
+		return "last"
+	case MbOnly:
+		return "only"
+	case MbMiddle:
+		return "middle"
+	default:
+		return fmt.Sprintf("boundary-%d", int(mb))
+	}
+}
+
 // DataPacket is a UDT packet containing message data
 type DataPacket struct {
 	Seq       PacketID // packet sequence number (top bit = 0)
@@ -25,9 +44,43 @@ type DataPacket struct {
 	Data      []byte   // payload
 }
 
+// Received data packets are by far the most frequently allocated objects in a busy connection, so ReadPacketFrom
+// takes them (and their payload buffers) from a pool.  A data packet returned from ReadPacketFrom belongs to the
+// caller, who may hand it back with Release once neither the packet nor its Data is referenced anywhere else.
+// Packets that are never released are simply garbage collected.
+var dataPacketPool = sync.Pool{
+	New: func() interface{} {
+		return &DataPacket{}
+	},
+}
+
+// NewDataPacket returns an empty data packet, reusing a previously released packet if one is available
+func NewDataPacket() *DataPacket {
+	return dataPacketPool.Get().(*DataPacket)
+}
+
+// NewMessagePacket returns a data packet carrying the specified payload (which is not copied) to socket dstSockID.
+// The packet is taken from the same pool as NewDataPacket
+func NewMessagePacket(dstSockID uint32, ts uint32, seq PacketID, boundary MessageBoundary, order bool, msg uint32,
+	data []byte) *DataPacket {
+	dp := NewDataPacket()
+	dp.Seq = seq
+	dp.SetHeader(dstSockID, ts)
+	dp.SetMessageData(boundary, order, msg)
+	dp.Data = data
+	return dp
+}
+
+// Release returns this packet to the pool used by ReadPacketFrom.  Neither the packet nor its Data may be used
+// (by anyone) after it has been released.
+func (dp *DataPacket) Release() {
+	*dp = DataPacket{Data: dp.Data[:0]}
+	dataPacketPool.Put(dp)
+}
+
 // PacketType returns the packetType associated with this packet
 func (dp *DataPacket) PacketType() PacketType {
-	return ptData
+	return PtData
 }
 
 // SetHeader sets the fields common to UDT data packets
@@ -62,33 +115,31 @@ func (dp *DataPacket) GetMessageData() (MessageBoundary, bool, uint32) {
 
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (dp *DataPacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	ol := 16 + len(dp.Data)
-	if l < ol {
-		return 0, errors.New("packet too small")
-	}
-	endianness.PutUint32(buf[0:4], dp.Seq.Seq&0x7FFFFFFF)
-	endianness.PutUint32(buf[4:8], dp.msg)
-	endianness.PutUint32(buf[8:12], dp.ts)
-	endianness.PutUint32(buf[12:16], dp.DstSockID)
-	copy(buf[16:], dp.Data)
-
-	return uint(ol), nil
+	w := newWriter(PtData, buf)
+	w.uint32("sequence number", dp.Seq.Seq&0x7FFFFFFF)
+	w.uint32("message number", dp.msg)
+	w.uint32("timestamp", dp.ts)
+	w.uint32("destination socket", dp.DstSockID)
+	w.bytes("data", dp.Data)
+	return w.finish()
 }
 
-func (dp *DataPacket) readFrom(data []byte) (err error) {
-	l := len(data)
-	if l < 16 {
-		return errors.New("packet too small")
-	}
-	//dp.seq = endianness.Uint32(data[0:4])
-	dp.msg = endianness.Uint32(data[4:8])
-	dp.ts = endianness.Uint32(data[8:12])
-	dp.DstSockID = endianness.Uint32(data[12:16])
+func (dp *DataPacket) readFrom(r *reader) (err error) {
+	r.uint32("sequence number") // already decoded by ReadPacketFrom
+	dp.msg = r.uint32("message number")
+	dp.ts = r.uint32("timestamp")
+	dp.DstSockID = r.uint32("destination socket")
 
-	// The data is whatever is what comes after the 16 bytes of header
-	dp.Data = make([]byte, l-16)
-	copy(dp.Data, data[16:])
+	// The data is whatever is what comes after the 16 bytes of header (reusing any buffer left from a released packet)
+	if data := r.take("data", r.remaining()); r.err == nil {
+		dp.Data = append(dp.Data[:0], data...)
+	}
+	return r.err
+}
 
-	return
+// String returns a description of this packet and its fields
+func (dp *DataPacket) String() string {
+	boundary, order, msg := dp.GetMessageData()
+	return fmt.Sprintf("%s(dst=%d ts=%d seq=%d msg=%d %s order=%t len=%d)", PacketTypeName(PtData), dp.DstSockID, dp.ts,
+		dp.Seq.Seq, msg, boundary, order, len(dp.Data))
 }
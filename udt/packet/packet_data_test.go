@@ -13,3 +13,31 @@ func TestDataPacket(t *testing.T) {
 			Data:      []byte("Hello UDT World!"),
 		}, t)
 }
+
+func benchmarkReadDataPacket(b *testing.B, release bool) {
+	buf := make([]byte, 1500)
+	n, err := (&DataPacket{Seq: PacketID{Seq: 50}, DstSockID: 90, Data: make([]byte, 1450)}).WriteTo(buf)
+	if err != nil {
+		b.Fatalf("Unable to write packet: %s", err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(n))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p, err := ReadPacketFrom(buf[0:n])
+		if err != nil {
+			b.Fatalf("Unable to read packet: %s", err)
+		}
+		if release {
+			p.(*DataPacket).Release()
+		}
+	}
+}
+
+func BenchmarkReadDataPacket(b *testing.B) {
+	benchmarkReadDataPacket(b, false)
+}
+
+func BenchmarkReadDataPacketReleased(b *testing.B) {
+	benchmarkReadDataPacket(b, true)
+}
@@ -2,23 +2,40 @@ package packet
 
 // Structure of packets and functions for writing/reading them
 
+import (
+	"fmt"
+)
+
 // ErrPacket is a (undocumented) UDT packet describing an out-of-band error code
 type ErrPacket struct {
 	ctrlHeader
 	Errno uint32 // error code
 }
 
+// NewErrPacket returns a packet reporting the specified error code
+func NewErrPacket(dstSockID uint32, ts uint32, errno uint32) *ErrPacket {
+	return &ErrPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, Errno: errno}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *ErrPacket) WriteTo(buf []byte) (uint, error) {
-	return p.writeHdrTo(buf, ptSpecialErr, p.Errno)
+	w := newWriter(PtSpecialErr, buf)
+	p.writeHdrTo(w, PtSpecialErr, "error code", p.Errno)
+	return w.finish()
 }
 
-func (p *ErrPacket) readFrom(data []byte) (err error) {
-	p.Errno, err = p.readHdrFrom(data)
-	return
+func (p *ErrPacket) readFrom(r *reader) (err error) {
+	p.Errno = p.readHdrFrom(r, "error code")
+	r.allowPad(4) // the reference implementation sends 4 bytes of padding after the header
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *ErrPacket) PacketType() PacketType {
-	return ptSpecialErr
+	return PtSpecialErr
+}
+
+// String returns a description of this packet and its fields
+func (p *ErrPacket) String() string {
+	return p.describe(PtSpecialErr, fmt.Sprintf("errno=%d", p.Errno))
 }
@@ -3,8 +3,9 @@ package packet
 // Structure of packets and functions for writing/reading them
 
 import (
-	"errors"
+	"fmt"
 	"net"
+	"strings"
 )
 
 // HandshakeReqType describes the type of handshake packet
@@ -23,71 +24,176 @@ const (
 	HsRefused HandshakeReqType = 1002
 )
 
+// String returns the name of this handshake type
+func (t HandshakeReqType) String() string {
+	switch t {
+	case HsRequest:
+		return "request"
+	case HsRendezvous:
+		return "rendezvous"
+	case HsResponse:
+		return "response"
+	case HsResponse2:
+		return "response2"
+	case HsRefused:
+		return "refused"
+	default:
+		return fmt.Sprintf("request-type-%d", int(t))
+	}
+}
+
+// HandshakeExtType identifies an optional extension appended to a handshake packet
+type HandshakeExtType uint16
+
+const (
+	// HsExtFEC advertises support for forward error correction, carrying the number of data packets
+	// covered by each parity packet we send
+	HsExtFEC HandshakeExtType = 1
+	// HsExtCompression advertises the data packet payload compression algorithms we support, one per byte
+	HsExtCompression HandshakeExtType = 2
+	// HsExtReject accompanies a HsRefused handshake with the reason for the refusal: a 32-bit reason code
+	// followed by an optional text description
+	HsExtReject HandshakeExtType = 3
+	// HsExtService names the service a connection is for, allowing several listeners to share a single port
+	HsExtService HandshakeExtType = 4
+	// HsExtAuth proves the sender holds a key shared with its peer: a nonce and HMAC from the dialing side, or an HMAC
+	// from the listening side
+	HsExtAuth HandshakeExtType = 5
+	// HsExtResume carries a session resumption token: from the listening side, a newly issued token and how many
+	// seconds it's valid for, and from the dialing side, a token it was issued followed by its measurements of the path
+	HsExtResume HandshakeExtType = 6
+	// HsExtEarlyData carries the first data of a connection from the dialing side, or (empty) from the listening side
+	// acknowledges that it was accepted
+	HsExtEarlyData HandshakeExtType = 7
+)
+
+// String returns the name of this handshake extension
+func (t HandshakeExtType) String() string {
+	switch t {
+	case HsExtFEC:
+		return "fec"
+	case HsExtCompression:
+		return "compression"
+	case HsExtReject:
+		return "reject"
+	case HsExtService:
+		return "service"
+	case HsExtAuth:
+		return "auth"
+	case HsExtResume:
+		return "resume"
+	case HsExtEarlyData:
+		return "early-data"
+	default:
+		return fmt.Sprintf("ext-%d", int(t))
+	}
+}
+
+// HandshakeExtension is an optional block of data appended to the end of a handshake packet.  These are not part
+// of the UDT specification (peers that don't recognize them will ignore them) and are used to negotiate optional features
+type HandshakeExtension struct {
+	Type HandshakeExtType
+	Data []byte
+}
+
 // HandshakePacket is a UDT packet used to negotiate a new connection
 type HandshakePacket struct {
 	ctrlHeader
-	UdtVer         uint32           // UDT version
-	SockType       SocketType       // Socket Type (1 = STREAM or 2 = DGRAM)
-	InitPktSeq     PacketID         // initial packet sequence number
-	MaxPktSize     uint32           // maximum packet size (including UDP/IP headers)
-	MaxFlowWinSize uint32           // maximum flow window size
-	ReqType        HandshakeReqType // connection type (regular(1), rendezvous(0), -1/-2 response)
-	SockID         uint32           // socket ID
-	SynCookie      uint32           // SYN cookie
-	SockAddr       net.IP           // the IP address of the UDP socket to which this packet is being sent
+	UdtVer         uint32               // UDT version
+	SockType       SocketType           // Socket Type (1 = STREAM or 2 = DGRAM)
+	InitPktSeq     PacketID             // initial packet sequence number
+	MaxPktSize     uint32               // maximum packet size (including UDP/IP headers)
+	MaxFlowWinSize uint32               // maximum flow window size
+	ReqType        HandshakeReqType     // connection type (regular(1), rendezvous(0), -1/-2 response)
+	SockID         uint32               // socket ID
+	SynCookie      uint32               // SYN cookie
+	SockAddr       net.IP               // the IP address of the UDP socket to which this packet is being sent
+	Extensions     []HandshakeExtension // optional extensions following the handshake
 }
 
-// WriteTo writes this packet to the provided buffer, returning the length of the packet
-func (p *HandshakePacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	if l < 64 {
-		return 0, errors.New("packet too small")
-	}
+// NewHandshakePacket returns a handshake of the specified type from socket sockID.  The connection parameters being
+// negotiated are filled in by the caller
+func NewHandshakePacket(dstSockID uint32, ts uint32, reqType HandshakeReqType, sockID uint32) *HandshakePacket {
+	return &HandshakePacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, ReqType: reqType, SockID: sockID}
+}
 
-	if _, err := p.writeHdrTo(buf, ptHandshake, 0); err != nil {
-		return 0, err
+// Extension returns the data associated with the specified extension, if it has been included in this handshake
+func (p *HandshakePacket) Extension(extType HandshakeExtType) ([]byte, bool) {
+	for _, ext := range p.Extensions {
+		if ext.Type == extType {
+			return ext.Data, true
+		}
 	}
+	return nil, false
+}
 
-	endianness.PutUint32(buf[16:20], p.UdtVer)
-	endianness.PutUint32(buf[20:24], uint32(p.SockType))
-	endianness.PutUint32(buf[24:28], p.InitPktSeq.Seq)
-	endianness.PutUint32(buf[28:32], p.MaxPktSize)
-	endianness.PutUint32(buf[32:36], p.MaxFlowWinSize)
-	endianness.PutUint32(buf[36:40], uint32(p.ReqType))
-	endianness.PutUint32(buf[40:44], p.SockID)
-	endianness.PutUint32(buf[44:48], p.SynCookie)
+// WriteTo writes this packet to the provided buffer, returning the length of the packet
+func (p *HandshakePacket) WriteTo(buf []byte) (uint, error) {
+	w := newWriter(PtHandshake, buf)
+	p.writeHdrTo(w, PtHandshake, "reserved", 0)
+	w.uint32("version", p.UdtVer)
+	w.uint32("socket type", uint32(p.SockType))
+	w.uint32("initial sequence", p.InitPktSeq.Seq)
+	w.uint32("max packet size", p.MaxPktSize)
+	w.uint32("max flow window", p.MaxFlowWinSize)
+	w.uint32("request type", uint32(p.ReqType))
+	w.uint32("socket id", p.SockID)
+	w.uint32("syn cookie", p.SynCookie)
 
 	sockAddr := make([]byte, 16)
 	copy(sockAddr, p.SockAddr)
-	copy(buf[48:64], sockAddr)
+	w.bytes("peer address", sockAddr)
 
-	return 64, nil
+	for _, ext := range p.Extensions {
+		if len(ext.Data) > 0xFFFF {
+			w.fail("extension length", ErrFieldTooLarge)
+		}
+		w.uint16("extension type", uint16(ext.Type))
+		w.uint16("extension length", uint16(len(ext.Data)))
+		w.bytes("extension data", ext.Data)
+	}
+	return w.finish()
 }
 
-func (p *HandshakePacket) readFrom(data []byte) error {
-	l := len(data)
-	if l < 64 {
-		return errors.New("packet too small")
-	}
-	if _, err := p.readHdrFrom(data); err != nil {
-		return err
+func (p *HandshakePacket) readFrom(r *reader) error {
+	p.readHdrFrom(r, "reserved")
+	p.UdtVer = r.uint32("version")
+	p.SockType = SocketType(r.uint32("socket type"))
+	p.InitPktSeq = PacketID{r.uint32("initial sequence")}
+	p.MaxPktSize = r.uint32("max packet size")
+	p.MaxFlowWinSize = r.uint32("max flow window")
+	p.ReqType = HandshakeReqType(r.uint32("request type"))
+	p.SockID = r.uint32("socket id")
+	p.SynCookie = r.uint32("syn cookie")
+	p.SockAddr = net.IP(r.bytes("peer address", 16))
+
+	p.Extensions = nil
+	for r.err == nil && r.remaining() >= 4 {
+		extType := HandshakeExtType(r.uint16("extension type"))
+		extLen := int(r.uint16("extension length"))
+		extData := r.bytes("extension data", extLen)
+		if r.err == nil {
+			p.Extensions = append(p.Extensions, HandshakeExtension{Type: extType, Data: extData})
+		}
 	}
-	p.UdtVer = endianness.Uint32(data[16:20])
-	p.SockType = SocketType(endianness.Uint32(data[20:24]))
-	p.InitPktSeq = PacketID{endianness.Uint32(data[24:28])}
-	p.MaxPktSize = endianness.Uint32(data[28:32])
-	p.MaxFlowWinSize = endianness.Uint32(data[32:36])
-	p.ReqType = HandshakeReqType(endianness.Uint32(data[36:40]))
-	p.SockID = endianness.Uint32(data[40:44])
-	p.SynCookie = endianness.Uint32(data[44:48])
-
-	p.SockAddr = make(net.IP, 16)
-	copy(p.SockAddr, data[48:64])
-
-	return nil
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *HandshakePacket) PacketType() PacketType {
-	return ptHandshake
+	return PtHandshake
+}
+
+// String returns a description of this packet and its fields
+func (p *HandshakePacket) String() string {
+	fields := fmt.Sprintf("%s ver=%d type=%s sock=%d seq=%d mss=%d flow=%d cookie=%d addr=%s", p.ReqType, p.UdtVer,
+		p.SockType, p.SockID, p.InitPktSeq.Seq, p.MaxPktSize, p.MaxFlowWinSize, p.SynCookie, p.SockAddr)
+	if len(p.Extensions) > 0 {
+		exts := make([]string, len(p.Extensions))
+		for idx, ext := range p.Extensions {
+			exts[idx] = fmt.Sprintf("%s:%d", ext.Type, len(ext.Data))
+		}
+		fields += " ext=" + strings.Join(exts, ",")
+	}
+	return p.describe(PtHandshake, fields)
 }
@@ -22,3 +22,30 @@ func TestHandshakePacket(t *testing.T) {
 
 	t.Log((read.(*HandshakePacket)).SockAddr)
 }
+
+func TestHandshakeExtensions(t *testing.T) {
+	pkt1 := &HandshakePacket{
+		UdtVer:         4,
+		SockType:       TypeSTREAM,
+		InitPktSeq:     PacketID{Seq: 50},
+		MaxPktSize:     1000,
+		MaxFlowWinSize: 500,
+		ReqType:        1,
+		SockID:         59,
+		SynCookie:      978,
+		SockAddr:       net.ParseIP("127.0.0.1"),
+		Extensions: []HandshakeExtension{
+			{Type: HsExtFEC, Data: []byte{0, 0, 0, 16}},
+			{Type: 0x7777, Data: []byte{}},
+		},
+	}
+	pkt1.SetHeader(59, 100)
+	read := testPacket(pkt1, t)
+
+	if data, ok := read.(*HandshakePacket).Extension(HsExtFEC); !ok || len(data) != 4 || data[3] != 16 {
+		t.Errorf("FEC extension not read back correctly: %v", data)
+	}
+	if _, ok := read.(*HandshakePacket).Extension(HandshakeExtType(2)); ok {
+		t.Errorf("found an extension that wasn't written")
+	}
+}
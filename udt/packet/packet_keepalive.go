@@ -7,17 +7,30 @@ type KeepAlivePacket struct {
 	ctrlHeader
 }
 
+// NewKeepAlivePacket returns a keep-alive packet addressed to the specified socket
+func NewKeepAlivePacket(dstSockID uint32, ts uint32) *KeepAlivePacket {
+	return &KeepAlivePacket{ctrlHeader{ts: ts, DstSockID: dstSockID}}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *KeepAlivePacket) WriteTo(buf []byte) (uint, error) {
-	return p.writeHdrTo(buf, ptKeepalive, 0)
+	w := newWriter(PtKeepalive, buf)
+	p.writeHdrTo(w, PtKeepalive, "reserved", 0)
+	return w.finish()
 }
 
-func (p *KeepAlivePacket) readFrom(data []byte) (err error) {
-	_, err = p.readHdrFrom(data)
-	return
+func (p *KeepAlivePacket) readFrom(r *reader) (err error) {
+	p.readHdrFrom(r, "reserved")
+	r.allowPad(4) // the reference implementation sends 4 bytes of padding after the header
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *KeepAlivePacket) PacketType() PacketType {
-	return ptKeepalive
+	return PtKeepalive
+}
+
+// String returns a description of this packet and its fields
+func (p *KeepAlivePacket) String() string {
+	return p.describe(PtKeepalive, "")
 }
@@ -3,7 +3,7 @@ package packet
 // Structure of packets and functions for writing/reading them
 
 import (
-	"errors"
+	"fmt"
 )
 
 // LightAckPacket is a UDT variant of the ACK packet for acknowledging received data with minimal information
@@ -12,36 +12,31 @@ type LightAckPacket struct {
 	PktSeqHi PacketID // The packet sequence number to which all the previous packets have been received (excluding)
 }
 
+// NewLightAckPacket returns a light ACK acknowledging every packet before pktSeqHi
+func NewLightAckPacket(dstSockID uint32, ts uint32, pktSeqHi PacketID) *LightAckPacket {
+	return &LightAckPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, PktSeqHi: pktSeqHi}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *LightAckPacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	if l < 20 {
-		return 0, errors.New("packet too small")
-	}
-
-	if _, err := p.writeHdrTo(buf, ptAck, 0); err != nil {
-		return 0, err
-	}
-
-	endianness.PutUint32(buf[16:20], p.PktSeqHi.Seq)
-
-	return 20, nil
+	w := newWriter(PtAck, buf)
+	p.writeHdrTo(w, PtAck, "ack number", 0)
+	w.uint32("last packet", p.PktSeqHi.Seq)
+	return w.finish()
 }
 
-func (p *LightAckPacket) readFrom(data []byte) (err error) {
-	l := len(data)
-	if l < 20 {
-		return errors.New("packet too small")
-	}
-	if _, err = p.readHdrFrom(data); err != nil {
-		return err
-	}
-	p.PktSeqHi = PacketID{endianness.Uint32(data[16:20])}
-
-	return nil
+func (p *LightAckPacket) readFrom(r *reader) (err error) {
+	p.readHdrFrom(r, "ack number")
+	p.PktSeqHi = PacketID{r.uint32("last packet")}
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *LightAckPacket) PacketType() PacketType {
-	return ptAck
+	return PtAck
+}
+
+// String returns a description of this packet and its fields
+func (p *LightAckPacket) String() string {
+	return p.describe(PtAck, fmt.Sprintf("light last=%d", p.PktSeqHi.Seq))
 }
@@ -3,7 +3,7 @@ package packet
 // Structure of packets and functions for writing/reading them
 
 import (
-	"errors"
+	"fmt"
 )
 
 // MsgDropReqPacket is a UDT packet notifying the peer of expired packets not worth trying to send
@@ -14,37 +14,34 @@ type MsgDropReqPacket struct {
 	LastSeq  PacketID // Last sequence number in the message
 }
 
+// NewMsgDropReqPacket returns a packet asking the peer to stop waiting for the specified message
+func NewMsgDropReqPacket(dstSockID uint32, ts uint32, msgID uint32, firstSeq PacketID, lastSeq PacketID) *MsgDropReqPacket {
+	return &MsgDropReqPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, MsgID: msgID, FirstSeq: firstSeq,
+		LastSeq: lastSeq}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *MsgDropReqPacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	if l < 24 {
-		return 0, errors.New("packet too small")
-	}
-
-	if _, err := p.writeHdrTo(buf, ptMsgDropReq, p.MsgID); err != nil {
-		return 0, err
-	}
-
-	endianness.PutUint32(buf[16:20], p.FirstSeq.Seq)
-	endianness.PutUint32(buf[20:24], p.LastSeq.Seq)
-
-	return 24, nil
+	w := newWriter(PtMsgDropReq, buf)
+	p.writeHdrTo(w, PtMsgDropReq, "message id", p.MsgID)
+	w.uint32("first packet", p.FirstSeq.Seq)
+	w.uint32("last packet", p.LastSeq.Seq)
+	return w.finish()
 }
 
-func (p *MsgDropReqPacket) readFrom(data []byte) (err error) {
-	l := len(data)
-	if l < 24 {
-		return errors.New("packet too small")
-	}
-	if p.MsgID, err = p.readHdrFrom(data); err != nil {
-		return
-	}
-	p.FirstSeq = PacketID{endianness.Uint32(data[16:20])}
-	p.LastSeq = PacketID{endianness.Uint32(data[20:24])}
-	return
+func (p *MsgDropReqPacket) readFrom(r *reader) (err error) {
+	p.MsgID = p.readHdrFrom(r, "message id")
+	p.FirstSeq = PacketID{r.uint32("first packet")}
+	p.LastSeq = PacketID{r.uint32("last packet")}
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *MsgDropReqPacket) PacketType() PacketType {
-	return ptMsgDropReq
+	return PtMsgDropReq
+}
+
+// String returns a description of this packet and its fields
+func (p *MsgDropReqPacket) String() string {
+	return p.describe(PtMsgDropReq, fmt.Sprintf("msg=%d first=%d last=%d", p.MsgID, p.FirstSeq.Seq, p.LastSeq.Seq))
 }
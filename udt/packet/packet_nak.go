@@ -3,7 +3,8 @@ package packet
 // Structure of packets and functions for writing/reading them
 
 import (
-	"errors"
+	"fmt"
+	"strings"
 )
 
 // NakPacket is a UDT packet notifying the peer of lost packets
@@ -12,42 +13,51 @@ type NakPacket struct {
 	CmpLossInfo []uint32 // integer array of compressed loss information
 }
 
+// NewNakPacket returns a packet reporting the specified (compressed) losses
+func NewNakPacket(dstSockID uint32, ts uint32, cmpLossInfo []uint32) *NakPacket {
+	return &NakPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, CmpLossInfo: cmpLossInfo}
+}
+
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *NakPacket) WriteTo(buf []byte) (uint, error) {
-
-	off, err := p.writeHdrTo(buf, ptNak, 0)
-	if err != nil {
-		return 0, err
-	}
-
-	l := uint(len(buf))
-	if l < off+uint(4*len(p.CmpLossInfo)) {
-		return 0, errors.New("packet too small")
-	}
-
+	w := newWriter(PtNak, buf)
+	p.writeHdrTo(w, PtNak, "reserved", 0)
 	for _, elm := range p.CmpLossInfo {
-		endianness.PutUint32(buf[off:off+4], elm)
-		off = off + 4
+		w.uint32("loss information", elm)
 	}
-
-	return off, nil
+	return w.finish()
 }
 
-func (p *NakPacket) readFrom(data []byte) error {
-	if _, err := p.readHdrFrom(data); err != nil {
-		return err
+func (p *NakPacket) readFrom(r *reader) error {
+	p.readHdrFrom(r, "reserved")
+	if r.err != nil {
+		return r.err
 	}
-	l := len(data)
-	numEntry := (l - 16) / 4
-	p.CmpLossInfo = make([]uint32, numEntry)
+	p.CmpLossInfo = make([]uint32, r.remaining()/4)
 	for idx := range p.CmpLossInfo {
-		st := 16 + 4*idx
-		p.CmpLossInfo[idx] = endianness.Uint32(data[st : st+4])
+		p.CmpLossInfo[idx] = r.uint32("loss information")
 	}
-	return nil
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *NakPacket) PacketType() PacketType {
-	return ptNak
+	return PtNak
+}
+
+// String returns a description of this packet and its fields
+func (p *NakPacket) String() string {
+	// a loss entry with its top bit set starts a range, which ends with the following entry
+	var losses strings.Builder
+	for idx, elm := range p.CmpLossInfo {
+		switch {
+		case idx == 0:
+		case p.CmpLossInfo[idx-1]&0x80000000 != 0:
+			losses.WriteByte('-')
+		default:
+			losses.WriteByte(',')
+		}
+		fmt.Fprintf(&losses, "%d", elm&0x7FFFFFFF)
+	}
+	return p.describe(PtNak, "loss="+losses.String())
 }
@@ -2,22 +2,51 @@ package packet
 
 // Structure of packets and functions for writing/reading them
 
-// ShutdownPacket is a UDT packet notifying the peer of connection shutdown
+import "fmt"
+
+// ShutdownPacket is a UDT packet notifying the peer of connection shutdown.  It may carry the reason for the shutdown
+// after the header, as a code followed by a description.  The reference implementation sends four bytes of zeroes
+// here, which is read as code zero with no description
 type ShutdownPacket struct {
 	ctrlHeader
+	Code   uint32 // why the connection was closed (zero if no reason was given)
+	Reason string // description of why the connection was closed
+}
+
+// NewShutdownPacket returns a shutdown packet addressed to the specified socket
+func NewShutdownPacket(dstSockID uint32, ts uint32) *ShutdownPacket {
+	return &ShutdownPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}}
 }
 
 // WriteTo writes this packet to the provided buffer, returning the length of the packet
 func (p *ShutdownPacket) WriteTo(buf []byte) (uint, error) {
-	return p.writeHdrTo(buf, ptShutdown, 0)
+	w := newWriter(PtShutdown, buf)
+	p.writeHdrTo(w, PtShutdown, "reserved", 0)
+	if p.Code != 0 || p.Reason != "" {
+		w.uint32("code", p.Code)
+		w.bytes("reason", []byte(p.Reason))
+	}
+	return w.finish()
 }
 
-func (p *ShutdownPacket) readFrom(data []byte) (err error) {
-	_, err = p.readHdrFrom(data)
-	return
+func (p *ShutdownPacket) readFrom(r *reader) (err error) {
+	p.readHdrFrom(r, "reserved")
+	if r.remaining() >= 4 {
+		p.Code = r.uint32("code")
+		p.Reason = string(r.take("reason", r.remaining()))
+	}
+	return r.err
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *ShutdownPacket) PacketType() PacketType {
-	return ptShutdown
+	return PtShutdown
+}
+
+// String returns a description of this packet and its fields
+func (p *ShutdownPacket) String() string {
+	if p.Code == 0 && p.Reason == "" {
+		return p.describe(PtShutdown, "")
+	}
+	return p.describe(PtShutdown, fmt.Sprintf("code=%d reason=%q", p.Code, p.Reason))
 }
@@ -9,3 +9,20 @@ func TestShutdownPacket(t *testing.T) {
 	pkt1.SetHeader(59, 100)
 	testPacket(pkt1, t)
 }
+
+func TestShutdownPacketReason(t *testing.T) {
+	pkt1 := &ShutdownPacket{Code: 1, Reason: "going away"}
+	pkt1.SetHeader(59, 100)
+	testPacket(pkt1, t)
+
+	// the padding sent by the reference implementation is read as no reason at all
+	buf := make([]byte, 20)
+	n, _ := (&ShutdownPacket{}).WriteTo(buf)
+	p, err := ReadPacketFromStrict(buf[:n+4])
+	if err != nil {
+		t.Fatalf("unable to read padded shutdown packet: %s", err.Error())
+	}
+	if sp := p.(*ShutdownPacket); sp.Code != 0 || sp.Reason != "" {
+		t.Errorf("expected no reason from padding, got code %d: %q", sp.Code, sp.Reason)
+	}
+}
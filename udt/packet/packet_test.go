@@ -1,6 +1,8 @@
 package packet
 
 import (
+	"errors"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -21,3 +23,124 @@ func testPacket(p Packet, t *testing.T) (read Packet) {
 	}
 	return
 }
+
+func TestReadShortPacket(t *testing.T) {
+	// every packet type, truncated at every length short of its header
+	for _, hdr := range [][]byte{{0x00}, {0x80, 0x00}, {0x80, 0x02, 0x00}, {0xff, 0xff, 0x00, 0x00}} {
+		for l := 0; l < 16; l++ {
+			data := make([]byte, l)
+			copy(data, hdr)
+			if _, err := ReadPacketFrom(data); err == nil {
+				t.Errorf("expected a %d byte packet starting %x to be rejected", l, hdr)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	buf := make([]byte, 1500)
+	ack := &AckPacket{AckSeqNo: 1, PktSeqHi: PacketID{Seq: 50}, Rtt: 1000}
+	n, _ := ack.WriteTo(buf)
+
+	// a truncated packet reports the field it ran out in
+	_, err := ReadPacketFrom(buf[:22])
+	var pe *PacketError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected a truncation error, got %v", err)
+	}
+	if pe.Type != PtAck || pe.Field != "rtt" || pe.Offset != 20 || pe.Size != 22 {
+		t.Errorf("unexpected error details: %s", err.Error())
+	}
+
+	// trailing data is only rejected in strict mode
+	drop := &MsgDropReqPacket{MsgID: 11, FirstSeq: PacketID{Seq: 50}, LastSeq: PacketID{Seq: 52}}
+	n, _ = drop.WriteTo(buf)
+	if _, err = ReadPacketFromStrict(buf[:n]); err != nil {
+		t.Errorf("unable to read packet strictly: %s", err)
+	}
+	if _, err = ReadPacketFrom(buf[:n+8]); err != nil {
+		t.Errorf("expected trailing data to be ignored, got %s", err)
+	}
+	if _, err = ReadPacketFromStrict(buf[:n+8]); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("expected trailing data to be rejected in strict mode, got %v", err)
+	}
+
+	// ...other than the padding the reference implementation sends
+	ka := &KeepAlivePacket{}
+	n, _ = ka.WriteTo(buf)
+	if _, err = ReadPacketFromStrict(buf[:n+4]); err != nil {
+		t.Errorf("expected padding to be accepted in strict mode, got %s", err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	hs := &HandshakePacket{Extensions: []HandshakeExtension{{Type: 1, Data: make([]byte, 8)}}}
+	_, err := hs.WriteTo(make([]byte, 70))
+	var pe *PacketError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrBufferTooSmall) {
+		t.Fatalf("expected a buffer size error, got %v", err)
+	}
+	if pe.Op != "write" || pe.Field != "extension data" || pe.Offset != 68 {
+		t.Errorf("unexpected error details: %s", err.Error())
+	}
+
+	hs.Extensions[0].Data = make([]byte, 0x10000)
+	if _, err = hs.WriteTo(make([]byte, 0x20000)); !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("expected an oversized extension to be refused, got %v", err)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	for _, p := range []Packet{
+		NewMessagePacket(59, 100, PacketID{Seq: 50}, MbOnly, true, 7, []byte{1, 2, 3}),
+		NewHandshakePacket(59, 100, HsRequest, 90),
+		NewKeepAlivePacket(59, 100),
+		NewAckPacket(59, 100, 8, PacketID{Seq: 50}),
+		NewLightAckPacket(59, 100, PacketID{Seq: 50}),
+		NewNakPacket(59, 100, []uint32{0x80000032, 0x34, 0x40}),
+		NewCongestionPacket(59, 100),
+		NewShutdownPacket(59, 100),
+		NewAck2Packet(59, 100, 8),
+		NewMsgDropReqPacket(59, 100, 7, PacketID{Seq: 50}, PacketID{Seq: 52}),
+		NewErrPacket(59, 100, 1008),
+		NewUserDefControlPacket(59, 100, 0x1234, 90, []byte{1, 2, 3}),
+	} {
+		if p.SocketID() != 59 || p.SendTime() != 100 {
+			t.Errorf("%s: header not set by constructor", PacketTypeName(p.PacketType()))
+		}
+		if hs, ok := p.(*HandshakePacket); ok {
+			hs.SockAddr = net.IPv4(127, 0, 0, 1)
+		}
+		testPacket(p, t)
+	}
+}
+
+func TestPacketStrings(t *testing.T) {
+	hs := NewHandshakePacket(59, 100, HsResponse, 90)
+	hs.UdtVer = 4
+	hs.SockType = TypeDGRAM
+	hs.SockAddr = net.IPv4(127, 0, 0, 1)
+	hs.Extensions = []HandshakeExtension{{Type: HsExtFEC, Data: []byte{8}}}
+
+	for _, tc := range []struct {
+		p    Packet
+		want string
+	}{
+		{NewMessagePacket(59, 100, PacketID{Seq: 50}, MbFirst, false, 7, make([]byte, 10)),
+			"data(dst=59 ts=100 seq=50 msg=7 first order=false len=10)"},
+		{hs, "handshake(dst=59 ts=100 response ver=4 type=dgram sock=90 seq=0 mss=0 flow=0 cookie=0 addr=127.0.0.1 ext=fec:1)"},
+		{NewKeepAlivePacket(59, 100), "keep-alive(dst=59 ts=100)"},
+		{&AckPacket{AckSeqNo: 8, PktSeqHi: PacketID{Seq: 50}, Rtt: 1000, RttVar: 500, BuffAvail: 25, IncludeLink: true,
+			PktRecvRate: 300, EstLinkCap: 400}, "ack(dst=0 ts=0 ack=8 last=50 rtt=1000 rttvar=500 avail=25 rate=300 cap=400)"},
+		{NewLightAckPacket(59, 100, PacketID{Seq: 50}), "ack(dst=59 ts=100 light last=50)"},
+		{NewNakPacket(59, 100, []uint32{0x80000032, 0x34, 0x40}), "nak(dst=59 ts=100 loss=50-52,64)"},
+		{NewAck2Packet(59, 100, 8), "ack2(dst=59 ts=100 ack=8)"},
+		{NewMsgDropReqPacket(59, 100, 7, PacketID{Seq: 50}, PacketID{Seq: 52}), "msg-drop(dst=59 ts=100 msg=7 first=50 last=52)"},
+		{NewErrPacket(59, 100, 1008), "error(dst=59 ts=100 errno=1008)"},
+		{NewUserDefControlPacket(59, 100, 0x1234, 90, []byte{1, 2, 3}), "user-defined(dst=59 ts=100 msgtype=4660 info=90 len=3)"},
+	} {
+		if got := tc.p.String(); got != tc.want {
+			t.Errorf("expected %q, got %q", tc.want, got)
+		}
+	}
+}
@@ -1,48 +1,104 @@
 package packet
 
-import "errors"
-
 // Structure of packets and functions for writing/reading them
 
+import (
+	"fmt"
+	"sync"
+)
+
 // UserDefControlPacket is a UDT user-defined packet
 type UserDefControlPacket struct {
 	ctrlHeader
-	msgType   uint16 // user-defined message type
-	addtlInfo uint32
-	data      []byte
+	MsgType   uint16 // user-defined message type
+	AddtlInfo uint32 // user-defined additional info
+	Data      []byte // user-defined payload
 }
 
-// WriteTo writes this packet to the provided buffer, returning the length of the packet
-func (p *UserDefControlPacket) WriteTo(buf []byte) (uint, error) {
-	l := len(buf)
-	ol := 16 + len(p.data)
-	if l < ol {
-		return 0, errors.New("packet too small")
+// UserPacketHandler interprets user-defined control packets of a particular message type, returning a description
+// of the packet's contents (used by its String method) or an error if the packet is malformed
+type UserPacketHandler func(p *UserDefControlPacket) (desc string, err error)
+
+var (
+	userHandlers     map[uint16]UserPacketHandler
+	userHandlersProt sync.RWMutex
+)
+
+// RegisterUserPacketHandler installs a handler for user-defined control packets of the specified message type
+// (replacing any handler previously registered for it, or removing it if h is nil).  ReadPacketFrom rejects any
+// packet of this type that the handler returns an error for.  Handlers apply to every user of this package in the
+// process, and may be called concurrently
+func RegisterUserPacketHandler(msgType uint16, h UserPacketHandler) {
+	userHandlersProt.Lock()
+	defer userHandlersProt.Unlock()
+	if h == nil {
+		delete(userHandlers, msgType)
+		return
 	}
+	if userHandlers == nil {
+		userHandlers = make(map[uint16]UserPacketHandler)
+	}
+	userHandlers[msgType] = h
+}
 
-	// Sets the flag bit to indicate this is a control packet
-	endianness.PutUint16(buf[0:2], uint16(ptUserDefPkt)|flagBit16)
-	endianness.PutUint16(buf[2:4], p.msgType) // Write 16 bit reserved data
+func userHandler(msgType uint16) UserPacketHandler {
+	userHandlersProt.RLock()
+	defer userHandlersProt.RUnlock()
+	return userHandlers[msgType]
+}
 
-	endianness.PutUint32(buf[4:8], p.addtlInfo)
-	endianness.PutUint32(buf[8:12], p.ts)
-	endianness.PutUint32(buf[12:16], p.DstSockID)
+// NewUserDefControlPacket returns a user-defined packet carrying the specified payload (which is not copied)
+func NewUserDefControlPacket(dstSockID uint32, ts uint32, msgType uint16, addtlInfo uint32, data []byte) *UserDefControlPacket {
+	return &UserDefControlPacket{ctrlHeader: ctrlHeader{ts: ts, DstSockID: dstSockID}, MsgType: msgType,
+		AddtlInfo: addtlInfo, Data: data}
+}
 
-	copy(buf[16:], p.data)
+// WriteTo writes this packet to the provided buffer, returning the length of the packet
+func (p *UserDefControlPacket) WriteTo(buf []byte) (uint, error) {
+	w := newWriter(PtUserDefPkt, buf)
 
-	return uint(ol), nil
+	// Sets the flag bit to indicate this is a control packet
+	w.uint16("type", uint16(PtUserDefPkt)|flagBit16)
+	w.uint16("message type", p.MsgType)
+	w.uint32("additional info", p.AddtlInfo)
+	w.uint32("timestamp", p.ts)
+	w.uint32("destination socket", p.DstSockID)
+	w.bytes("data", p.Data)
+	return w.finish()
 }
 
-func (p *UserDefControlPacket) readFrom(data []byte) (err error) {
-	if p.addtlInfo, err = p.readHdrFrom(data); err != nil {
-		return err
-	}
-	p.data = data[16:]
+func (p *UserDefControlPacket) readFrom(r *reader) (err error) {
+	p.AddtlInfo = p.readHdrFrom(r, "additional info")
+	p.Data = r.bytes("data", r.remaining())
+	return r.err
+}
 
+// check runs a decoded packet past any handler registered for its message type
+func (p *UserDefControlPacket) check() error {
+	h := userHandler(p.MsgType)
+	if h == nil {
+		return nil
+	}
+	if _, err := h(p); err != nil {
+		return &PacketError{Op: "read", Type: PtUserDefPkt, Field: "data", Offset: 16, Size: 16 + len(p.Data), Err: err}
+	}
 	return nil
 }
 
 // PacketType returns the packetType associated with this packet
 func (p *UserDefControlPacket) PacketType() PacketType {
-	return ptUserDefPkt
+	return PtUserDefPkt
+}
+
+// String returns a description of this packet and its fields
+func (p *UserDefControlPacket) String() string {
+	fields := fmt.Sprintf("msgtype=%d info=%d len=%d", p.MsgType, p.AddtlInfo, len(p.Data))
+	if h := userHandler(p.MsgType); h != nil {
+		if desc, err := h(p); err != nil {
+			fields += " invalid: " + err.Error()
+		} else if desc != "" {
+			fields += " " + desc
+		}
+	}
+	return p.describe(PtUserDefPkt, fields)
 }
@@ -0,0 +1,44 @@
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUserDefControlPacket(t *testing.T) {
+	pkt1 := &UserDefControlPacket{
+		MsgType:   0x1234,
+		AddtlInfo: 90,
+		Data:      []byte{1, 2, 3, 4, 5},
+	}
+	pkt1.SetHeader(59, 100)
+	testPacket(pkt1, t)
+}
+
+func TestUserPacketHandler(t *testing.T) {
+	RegisterUserPacketHandler(0x4321, func(p *UserDefControlPacket) (string, error) {
+		if len(p.Data) != 2 {
+			return "", errors.New("expected a 16-bit counter")
+		}
+		return fmt.Sprintf("counter=%d", int(p.Data[0])<<8|int(p.Data[1])), nil
+	})
+	defer RegisterUserPacketHandler(0x4321, nil)
+
+	p := testPacket(NewUserDefControlPacket(59, 100, 0x4321, 0, []byte{1, 2}), t)
+	if want := "user-defined(dst=59 ts=100 msgtype=17185 info=0 len=2 counter=258)"; p.String() != want {
+		t.Errorf("expected %q, got %q", want, p.String())
+	}
+
+	buf := make([]byte, 1500)
+	n, _ := NewUserDefControlPacket(59, 100, 0x4321, 0, []byte{1, 2, 3}).WriteTo(buf)
+	if _, err := ReadPacketFrom(buf[:n]); err == nil {
+		t.Error("expected a packet rejected by its handler to fail decoding")
+	}
+
+	// packets of other types aren't affected
+	n, _ = NewUserDefControlPacket(59, 100, 0x4322, 0, []byte{1, 2, 3}).WriteTo(buf)
+	if _, err := ReadPacketFrom(buf[:n]); err != nil {
+		t.Errorf("unable to read packet: %s", err)
+	}
+}
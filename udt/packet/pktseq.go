@@ -1,5 +1,10 @@
 package packet
 
+const (
+	maxPacketSeq uint32 = 0x7FFFFFFF // packet sequence numbers are 31 bits wide
+	seqThreshold uint32 = 0x40000000 // half the sequence space, used to determine ordering across a wraparound
+)
+
 // PacketID represents a UDT packet ID sequence
 type PacketID struct {
 	Seq uint32
@@ -7,25 +12,51 @@ type PacketID struct {
 
 // Incr increments this packet ID
 func (p *PacketID) Incr() {
-	p.Seq = (p.Seq + 1) & 0x7FFFFFFF
+	p.Seq = (p.Seq + 1) & maxPacketSeq
 }
 
 // Decr decrements this packet ID
 func (p *PacketID) Decr() {
-	p.Seq = (p.Seq - 1) & 0x7FFFFFFF
+	p.Seq = (p.Seq - 1) & maxPacketSeq
 }
 
 // Add returns a packet ID after adding the specified offset
 func (p PacketID) Add(off int32) PacketID {
-	newSeq := (p.Seq + 1) & 0x7FFFFFFF
-	return PacketID{newSeq}
+	return PacketID{(p.Seq + uint32(off)) & maxPacketSeq}
 }
 
-// BlindDiff attempts to return the difference after subtracting the argument from itself
-func (p PacketID) BlindDiff(rhs PacketID) int32 {
-	result := (p.Seq - rhs.Seq) & 0x7FFFFFFF
-	if result&0x40000000 != 0 {
+// Sub returns a packet ID after subtracting the specified offset
+func (p PacketID) Sub(off int32) PacketID {
+	return PacketID{(p.Seq - uint32(off)) & maxPacketSeq}
+}
+
+// Diff returns the (signed) number of packets that would need to be added to the argument to reach this packet ID.
+// Per the UDT spec, sequence numbers are compared modulo 2^31, so the result falls between -2^30 and 2^30
+func (p PacketID) Diff(rhs PacketID) int32 {
+	result := (p.Seq - rhs.Seq) & maxPacketSeq
+	if result&seqThreshold != 0 {
 		result = result | 0x80000000
 	}
 	return int32(result)
 }
+
+// Cmp compares this packet ID against the argument, returning -1 if it comes before it in sequence,
+// +1 if it comes after it, or 0 if they are the same
+func (p PacketID) Cmp(rhs PacketID) int {
+	diff := p.Diff(rhs)
+	switch {
+	case diff < 0:
+		return -1
+	case diff > 0:
+		return +1
+	default:
+		return 0
+	}
+}
+
+// BlindDiff attempts to return the difference after subtracting the argument from itself
+//
+// Deprecated: use Diff
+func (p PacketID) BlindDiff(rhs PacketID) int32 {
+	return p.Diff(rhs)
+}
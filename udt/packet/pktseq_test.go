@@ -0,0 +1,81 @@
+package packet
+
+import (
+	"testing"
+)
+
+func TestPacketIDAdd(t *testing.T) {
+	cases := []struct {
+		start  uint32
+		off    int32
+		expect uint32
+	}{
+		{10, 5, 15},
+		{10, -5, 5},
+		{0x7FFFFFFF, 1, 0},
+		{0x7FFFFFFE, 5, 3},
+		{0, -1, 0x7FFFFFFF},
+		{3, -5, 0x7FFFFFFE},
+	}
+	for _, c := range cases {
+		if got := (PacketID{c.start}).Add(c.off); got.Seq != c.expect {
+			t.Errorf("PacketID{%d}.Add(%d) = %d, expected %d", c.start, c.off, got.Seq, c.expect)
+		}
+		if got := (PacketID{c.start}).Sub(-c.off); got.Seq != c.expect {
+			t.Errorf("PacketID{%d}.Sub(%d) = %d, expected %d", c.start, -c.off, got.Seq, c.expect)
+		}
+	}
+}
+
+func TestPacketIDIncrDecr(t *testing.T) {
+	p := PacketID{0x7FFFFFFF}
+	p.Incr()
+	if p.Seq != 0 {
+		t.Errorf("Incr did not wrap, got %d", p.Seq)
+	}
+	p.Decr()
+	if p.Seq != 0x7FFFFFFF {
+		t.Errorf("Decr did not wrap, got %d", p.Seq)
+	}
+}
+
+func TestPacketIDDiff(t *testing.T) {
+	cases := []struct {
+		lhs    uint32
+		rhs    uint32
+		expect int32
+	}{
+		{15, 10, 5},
+		{10, 15, -5},
+		{0, 0x7FFFFFFF, 1},
+		{0x7FFFFFFF, 0, -1},
+		{2, 0x7FFFFFFE, 4},
+		{0x7FFFFFFE, 2, -4},
+		{0x3FFFFFFF, 0, 0x3FFFFFFF},
+	}
+	for _, c := range cases {
+		if got := (PacketID{c.lhs}).Diff(PacketID{c.rhs}); got != c.expect {
+			t.Errorf("PacketID{%d}.Diff(%d) = %d, expected %d", c.lhs, c.rhs, got, c.expect)
+		}
+	}
+}
+
+func TestPacketIDCmp(t *testing.T) {
+	cases := []struct {
+		lhs    uint32
+		rhs    uint32
+		expect int
+	}{
+		{10, 10, 0},
+		{11, 10, 1},
+		{10, 11, -1},
+		{0, 0x7FFFFFFF, 1},
+		{0x7FFFFFFF, 0, -1},
+		{5, 0x7FFFFF00, 1},
+	}
+	for _, c := range cases {
+		if got := (PacketID{c.lhs}).Cmp(PacketID{c.rhs}); got != c.expect {
+			t.Errorf("PacketID{%d}.Cmp(%d) = %d, expected %d", c.lhs, c.rhs, got, c.expect)
+		}
+	}
+}
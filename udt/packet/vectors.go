@@ -0,0 +1,192 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// Vector is a packet along with its encoding on the wire, for checking that an implementation (such as a fork of this
+// package) still speaks the same protocol
+type Vector struct {
+	Name       string // what the vector covers
+	Packet     Packet // the packet Wire decodes to
+	Wire       []byte // the contents of the UDP datagram carrying the packet
+	DecodeOnly bool   // Wire decodes to Packet, but isn't how Packet is encoded (such as padding other peers send)
+}
+
+// Vectors returns the conformance vectors: at least one for every packet type, covering each of its optional fields.
+// Each call returns new packets, so they may be modified freely
+func Vectors() []Vector {
+	const ts, dst = 0x0001e240, 0x1a2b3c4d
+	header := func(p Packet) Packet {
+		p.SetHeader(dst, ts)
+		return p
+	}
+	dataPacket := func(seq uint32, boundary MessageBoundary, order bool, msg uint32, data string) Packet {
+		dp := &DataPacket{Seq: PacketID{Seq: seq}, Data: []byte(data)}
+		dp.SetMessageData(boundary, order, msg)
+		return header(dp)
+	}
+
+	return []Vector{
+		{
+			Name: "handshake request",
+			Packet: header(&HandshakePacket{UdtVer: 4, SockType: TypeSTREAM, InitPktSeq: PacketID{Seq: 0x2b3c4d5e},
+				MaxPktSize: 1500, MaxFlowWinSize: 8192, ReqType: HsRequest, SockID: 0x0a0b0c0d,
+				SockAddr: net.ParseIP("127.0.0.1")}),
+			Wire: wire("80000000 00000000 0001e240 1a2b3c4d",
+				"00000004 00000001 2b3c4d5e 000005dc 00002000 00000001 0a0b0c0d 00000000",
+				"00000000 00000000 0000ffff 7f000001"),
+		},
+		{
+			Name: "handshake response with extensions",
+			Packet: header(&HandshakePacket{UdtVer: 4, SockType: TypeDGRAM, InitPktSeq: PacketID{Seq: 0x2b3c4d5e},
+				MaxPktSize: 1472, MaxFlowWinSize: 25600, ReqType: HsResponse, SockID: 0x0a0b0c0d,
+				SynCookie: 0x5eed5eed, SockAddr: net.ParseIP("2001:db8::1"),
+				Extensions: []HandshakeExtension{
+					{Type: HsExtFEC, Data: []byte{0, 0, 0, 8}},
+					{Type: HsExtService, Data: []byte("echo")},
+				}}),
+			Wire: wire("80000000 00000000 0001e240 1a2b3c4d",
+				"00000004 00000002 2b3c4d5e 000005c0 00006400 ffffffff 0a0b0c0d 5eed5eed",
+				"20010db8 00000000 00000000 00000001",
+				"0001 0004 00000008", "0004 0004 6563686f"),
+		},
+		{
+			Name:   "keep-alive",
+			Packet: header(&KeepAlivePacket{}),
+			Wire:   wire("80010000 00000000 0001e240 1a2b3c4d"),
+		},
+		{
+			Name:       "keep-alive with padding",
+			Packet:     header(&KeepAlivePacket{}),
+			Wire:       wire("80010000 00000000 0001e240 1a2b3c4d 00000000"),
+			DecodeOnly: true,
+		},
+		{
+			Name: "ack",
+			Packet: header(&AckPacket{AckSeqNo: 5, PktSeqHi: PacketID{Seq: 0x2b3c4d70}, Rtt: 10000, RttVar: 5000,
+				BuffAvail: 256, IncludeLink: true, PktRecvRate: 1000, EstLinkCap: 10000}),
+			Wire: wire("80020000 00000005 0001e240 1a2b3c4d",
+				"2b3c4d70 00002710 00001388 00000100 000003e8 00002710"),
+		},
+		{
+			Name: "ack without link measurements",
+			Packet: header(&AckPacket{AckSeqNo: 5, PktSeqHi: PacketID{Seq: 0x2b3c4d70}, Rtt: 10000, RttVar: 5000,
+				BuffAvail: 256}),
+			Wire: wire("80020000 00000005 0001e240 1a2b3c4d", "2b3c4d70 00002710 00001388 00000100"),
+		},
+		{
+			Name:   "light ack",
+			Packet: header(&LightAckPacket{PktSeqHi: PacketID{Seq: 0x2b3c4d70}}),
+			Wire:   wire("80020000 00000000 0001e240 1a2b3c4d 2b3c4d70"),
+		},
+		{
+			Name:   "nak",
+			Packet: header(&NakPacket{CmpLossInfo: []uint32{0x80000010, 0x20, 0x30}}),
+			Wire:   wire("80030000 00000000 0001e240 1a2b3c4d 80000010 00000020 00000030"),
+		},
+		{
+			Name:   "congestion warning",
+			Packet: header(&CongestionPacket{}),
+			Wire:   wire("80040000 00000000 0001e240 1a2b3c4d"),
+		},
+		{
+			Name:   "shutdown",
+			Packet: header(&ShutdownPacket{}),
+			Wire:   wire("80050000 00000000 0001e240 1a2b3c4d"),
+		},
+		{
+			Name:   "shutdown with reason",
+			Packet: header(&ShutdownPacket{Code: 1, Reason: "bye"}),
+			Wire:   wire("80050000 00000000 0001e240 1a2b3c4d 00000001 627965"),
+		},
+		{
+			Name:   "ack2",
+			Packet: header(&Ack2Packet{AckSeqNo: 5}),
+			Wire:   wire("80060000 00000005 0001e240 1a2b3c4d"),
+		},
+		{
+			Name:       "ack2 with padding",
+			Packet:     header(&Ack2Packet{AckSeqNo: 5}),
+			Wire:       wire("80060000 00000005 0001e240 1a2b3c4d 00000000"),
+			DecodeOnly: true,
+		},
+		{
+			Name:   "message drop request",
+			Packet: header(&MsgDropReqPacket{MsgID: 11, FirstSeq: PacketID{Seq: 50}, LastSeq: PacketID{Seq: 52}}),
+			Wire:   wire("80070000 0000000b 0001e240 1a2b3c4d 00000032 00000034"),
+		},
+		{
+			Name:   "error",
+			Packet: header(&ErrPacket{Errno: 1}),
+			Wire:   wire("80080000 00000001 0001e240 1a2b3c4d"),
+		},
+		{
+			Name:   "user-defined",
+			Packet: header(&UserDefControlPacket{MsgType: 0x0100, AddtlInfo: 2, Data: []byte("user")}),
+			Wire:   wire("ffff0100 00000002 0001e240 1a2b3c4d 75736572"),
+		},
+		{
+			Name:   "data, first of an ordered message",
+			Packet: dataPacket(0x2b3c4d5e, MbFirst, true, 11, "hello"),
+			Wire:   wire("2b3c4d5e a000000b 0001e240 1a2b3c4d 68656c6c6f"),
+		},
+		{
+			Name:   "data, the only packet of an unordered message",
+			Packet: dataPacket(0x7fffffff, MbOnly, false, 0x1fffffff, "x"),
+			Wire:   wire("7fffffff dfffffff 0001e240 1a2b3c4d 78"),
+		},
+	}
+}
+
+// wire decodes the hex encoding of a packet (in which whitespace is ignored)
+func wire(words ...string) []byte {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(strings.Join(words, " ")), ""))
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Check returns an error unless Wire decodes (strictly) to Packet, and Packet encodes to Wire
+func (v Vector) Check() error {
+	p, err := ReadPacketFromStrict(v.Wire)
+	if err != nil {
+		return fmt.Errorf("%s: unable to read packet: %s", v.Name, err.Error())
+	}
+	if dp, ok := p.(*DataPacket); ok {
+		defer dp.Release()
+	}
+	if !reflect.DeepEqual(p, v.Packet) {
+		return fmt.Errorf("%s: read %s, expected %s", v.Name, p, v.Packet)
+	}
+	if v.DecodeOnly {
+		return nil
+	}
+
+	buf := make([]byte, len(v.Wire)+64)
+	n, err := v.Packet.WriteTo(buf)
+	if err != nil {
+		return fmt.Errorf("%s: unable to write packet: %s", v.Name, err.Error())
+	}
+	if !bytes.Equal(buf[:n], v.Wire) {
+		return fmt.Errorf("%s: wrote % x, expected % x", v.Name, buf[:n], v.Wire)
+	}
+	return nil
+}
+
+// CheckVectors checks every conformance vector (see Vector.Check), returning an error for each that fails
+func CheckVectors() []error {
+	var errs []error
+	for _, v := range Vectors() {
+		if err := v.Check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,36 @@
+package packet
+
+import (
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	for _, err := range CheckVectors() {
+		t.Error(err)
+	}
+
+	// every packet type is covered
+	covered := make(map[PacketType]bool)
+	for _, v := range Vectors() {
+		covered[v.Packet.PacketType()] = true
+	}
+	for _, pt := range []PacketType{PtHandshake, PtKeepalive, PtAck, PtNak, PtCongestion, PtShutdown, PtAck2,
+		PtMsgDropReq, PtSpecialErr, PtUserDefPkt, PtData} {
+		if !covered[pt] {
+			t.Errorf("no vector for %s packets", PacketTypeName(pt))
+		}
+	}
+}
+
+func TestVectorMismatch(t *testing.T) {
+	for _, v := range Vectors() {
+		if v.DecodeOnly {
+			continue // these end in padding, whose contents don't matter
+		}
+		// a change to any field is caught, whether it's in how the packet is read or written
+		v.Wire[len(v.Wire)-1] ^= 0x01
+		if err := v.Check(); err == nil {
+			t.Errorf("%s: expected a changed last byte to be caught", v.Name)
+		}
+	}
+}
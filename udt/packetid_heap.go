@@ -10,7 +10,7 @@ func (h packetIDHeap) Len() int {
 }
 
 func (h packetIDHeap) Less(i, j int) bool {
-	return h[i].Seq < h[j].Seq
+	return h[i].Cmp(h[j]) < 0
 }
 
 func (h packetIDHeap) Swap(i, j int) {
@@ -29,64 +29,24 @@ func (h *packetIDHeap) Pop() interface{} {
 	return x
 }
 
-// Min does a binary search of the heap for the entry with the lowest packetID greater than or equal to the specified value
+// Min does a search of the heap for the entry with the lowest packetID greater than or equal to the specified value
 func (h packetIDHeap) Min(greaterEqual packet.PacketID, lessEqual packet.PacketID) (packet.PacketID, int) {
-	len := len(h)
-	idx := 0
-	wrapped := greaterEqual.Seq > lessEqual.Seq
-	for idx < len {
-		pid := h[idx]
-		var next int
-		if pid.Seq == greaterEqual.Seq {
-			return h[idx], idx
-		} else if pid.Seq >= greaterEqual.Seq {
-			next = idx * 2
-		} else {
-			next = idx*2 + 1
-		}
-		if next >= len && h[idx].Seq > greaterEqual.Seq && (wrapped || h[idx].Seq <= lessEqual.Seq) {
-			return h[idx], idx
-		}
-		idx = next
+	idx := heapMinRange(h, 0, func(idx int) int {
+		return seqInRange(h[idx], greaterEqual, lessEqual)
+	})
+	if idx < 0 {
+		return packet.PacketID{Seq: 0}, -1
 	}
-
-	// can't find any packets with greater value, wrap around
-	if wrapped {
-		idx = 0
-		for {
-			next := idx * 2
-			if next >= len && h[idx].Seq <= lessEqual.Seq {
-				return h[idx], idx
-			}
-			idx = next
-		}
-	}
-	return packet.PacketID{Seq: 0}, -1
-}
-
-func (h packetIDHeap) compare(pktID packet.PacketID, idx int) int {
-	if pktID.Seq < h[idx].Seq {
-		return -1
-	}
-	if pktID.Seq > h[idx].Seq {
-		return +1
-	}
-	return 0
+	return h[idx], idx
 }
 
-// Find does a binary search of the heap for the specified packetID which is returned
+// Find does a search of the heap for the specified packetID which is returned
 func (h packetIDHeap) Find(pktID packet.PacketID) (*packet.PacketID, int) {
-	len := len(h)
-	idx := 0
-	for idx < len {
-		cmp := h.compare(pktID, idx)
-		if cmp == 0 {
-			return &h[idx], idx
-		} else if cmp > 0 {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	idx := heapFind(len(h), 0, func(idx int) int {
+		return h[idx].Cmp(pktID)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return &h[idx], idx
 }
@@ -0,0 +1,64 @@
+package udt
+
+import (
+	"context"
+	"log"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+/*
+The packets sent and received on a local address normally go through a UDP socket opened by this package.
+Config.PacketIO can substitute another packet I/O backend, such as one built on AF_XDP or PACKET_MMAP rings, or on an
+existing transport (a tunnel, or an in-memory pipe for tests).  Two experimental backends for Linux are included, each
+only built with its build tag: IOUringPacketIO ("iouring") and PacketMMapPacketIO ("packetmmap").  The backend is asked
+for a net.PacketConn when the local address is first used, and for more if Config.ReusePortSockets is set (each of
+which is read by its own goroutine, such as one per receive queue).  Everything is sent on the first one.
+
+The connections a backend returns must use *net.UDPAddr addresses, as packets are routed by their source address.
+Features that rely on socket options (Config.KernelTimestamps, ECN, DSCP and GSO) are only available on
+*net.UDPConn connections, and are quietly left off otherwise.
+*/
+
+// PacketIO is a packet I/O backend, opening the connections packets are sent and received on for a local address
+type PacketIO interface {
+	// ListenPacket opens a connection on the local address (see net.ListenPacket for a description of network and
+	// address).  Any connections after the first are opened for an address with the port filled in
+	ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error)
+}
+
+// udpPacketIO is the default packet I/O backend, opening UDP sockets
+type udpPacketIO struct {
+	reusePort bool // whether several sockets will be opened on the same address (see Config.ReusePortSockets)
+}
+
+func (u udpPacketIO) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	// try to avoid fragmentation (and hopefully be notified if we exceed path MTU)
+	listenConfig := net.ListenConfig{}
+	listenConfig.Control = func(network, address string, c syscall.RawConn) error {
+		err := c.Control(func(fd uintptr) {
+			var err error
+			os := runtime.GOOS
+			switch os {
+			case "windows":
+				//err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 14 /* IP_DONTFRAGMENT for winsock2 */, 1)
+				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 71 /* IP_MTU_DISCOVER for winsock2 */, 2 /* IP_PMTUDISC_DO */)
+			case "linux", "android":
+				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 10 /* IP_MTU_DISCOVER */, 2 /* IP_PMTUDISC_DO */)
+			default:
+				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, 67 /* IP_DONTFRAG */, 1)
+			}
+			if err != nil {
+				log.Printf("error on setSockOpt: %s", err.Error())
+			}
+		})
+		if err == nil && u.reusePort {
+			err = enableReusePort(c)
+		}
+		return err
+	}
+
+	//conn, err := net.ListenUDP(network, laddr)
+	return listenConfig.ListenPacket(ctx, network, address)
+}
@@ -0,0 +1,106 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// countingPacketIO is a packet I/O backend opening ordinary UDP sockets, counting how many it has opened
+type countingPacketIO struct {
+	opened int
+}
+
+func (c *countingPacketIO) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	c.opened++
+	return net.ListenPacket(network, address)
+}
+
+// unixPacketIO is a packet I/O backend returning connections without UDP addresses
+type unixPacketIO struct{}
+
+func (unixPacketIO) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	return net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "", Net: "unixgram"})
+}
+
+func TestPacketIO(t *testing.T) {
+	packetIO := &countingPacketIO{}
+	config := DefaultConfig()
+	config.PacketIO = packetIO
+	l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+80))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	if packetIO.opened != 1 {
+		t.Errorf("expected the backend to open a single connection, opened %d", packetIO.opened)
+	}
+	checkListening(t, l, fmt.Sprintf("127.0.0.1:%d", clientPort+80))
+
+	config = DefaultConfig()
+	config.PacketIO = unixPacketIO{}
+	if l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+82)); err == nil {
+		l.Close()
+		t.Error("expected an error from a backend without UDP addresses")
+	}
+}
+
+// packetIOConnect makes a connection over loopback with both ends using config, listening on port and dialing from
+// the one after it
+func packetIOConnect(tb testing.TB, config *Config, port int) (serv net.Listener, server net.Conn, client net.Conn) {
+	serv, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		tb.Fatalf("error listening: %s", err.Error())
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := serv.Accept()
+		accepted <- conn
+	}()
+	client, err = config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", port+1), serv.Addr(), true)
+	if err != nil {
+		tb.Fatalf("error dialing: %s", err.Error())
+	}
+	server = <-accepted
+	if server == nil {
+		tb.FailNow()
+	}
+	return
+}
+
+// benchmarkPacketIO measures the throughput of a stream connection using the specified backend
+func benchmarkPacketIO(b *testing.B, packetIO PacketIO, port int) {
+	const writeSize = 16 << 10
+	config := DefaultConfig()
+	config.PacketIO = packetIO
+	serv, server, client := packetIOConnect(b, config, port)
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+	b.SetBytes(writeSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buffer := make([]byte, writeSize)
+		for remain := b.N * writeSize; remain > 0; {
+			recvd, err := server.Read(buffer)
+			if err != nil {
+				b.Errorf("error calling Read: %s", err.Error())
+				return
+			}
+			remain -= recvd
+		}
+	}()
+
+	buffer := make([]byte, writeSize)
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Write(buffer); err != nil {
+			b.Fatalf("error calling Write: %s", err.Error())
+		}
+	}
+	<-done
+}
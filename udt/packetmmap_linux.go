@@ -0,0 +1,420 @@
+//go:build linux && packetmmap
+// +build linux,packetmmap
+
+package udt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/*
+PacketMMapPacketIO is an (experimental) packet I/O backend that receives UDP packets from a PACKET_MMAP ring shared
+with the kernel rather than a system call per packet, built only with the "packetmmap" build tag.  Select it with
+Config.PacketIO:
+
+	config.PacketIO = udt.PacketMMapPacketIO{}
+
+Each connection it opens is a UDP socket (holding the port, and sending packets as usual) alongside an AF_PACKET socket
+whose receive ring the kernel fills with the packets arriving for that port, picked out by a socket filter before they
+reach the ring.  The UDP socket is given a filter dropping everything, so packets aren't queued on it as well.  Reading
+waits for the kernel to fill the next frame of the ring only if it hasn't already, so a burst of packets is read
+without entering the kernel at all.
+
+As packets are taken from the network ahead of the IP stack, this needs CAP_NET_RAW, and firewall rules that would
+drop packets on their way to the UDP socket are bypassed.  Only packets addressed to this host are taken, IP fragments
+and IPv6 extension headers aren't handled (packets are sent without fragmentation, see mtu.go).  Each frame of the ring
+is by default large enough for the largest datagram (as the multiplexer's buffers are), making each ring around 17MB;
+PacketMMapPacketIO.FrameSize can be lowered along with Config.MaxPacketSize, as packets too large for a frame are
+dropped.  With Config.ReusePortSockets, the packets for the port are spread between the rings by their source
+address.  The connections aren't *net.UDPConns, so Config.KernelTimestamps, ECN, DSCP and GSO aren't available with
+this backend, and nor are deadlines.
+*/
+
+const (
+	packetMMapDefaultFrames = 256     // frames in each ring, if PacketMMapPacketIO.Frames isn't set
+	packetMMapFrameOverhead = 80      // bytes of each frame ahead of the packet's IP header
+	packetMMapMinBlockSize  = 1 << 16 // smallest block of the ring, which holds as many frames as fit
+
+	// these mirror <linux/if_packet.h>
+	solPacket           = 263
+	packetRxRing        = 5
+	packetVersion       = 10
+	packetFanout        = 18
+	packetFanoutHash    = 0
+	packetHost          = 0
+	tpacketV2           = 1
+	tpStatusKernel      = 0
+	tpStatusUser        = 1 << 0
+	tpStatusCopy        = 1 << 1
+	tpStatusCsumNotRdy  = 1 << 3
+	tpStatusCsumValid   = 1 << 7
+	sockaddrLLPktTypeAt = 32 + 10 // sll_pkttype, in the sockaddr_ll following the (aligned) tpacket2_hdr
+
+	ethPAll  = 0x0003
+	ethPIPv4 = 0x0800
+	ethPIPv6 = 0x86DD
+
+	skfAdProtocol = 0xFFFFF000 // SKF_AD_OFF + SKF_AD_PROTOCOL, loading the packet's ethertype in a socket filter
+)
+
+var errPacketMMapClosed = errors.New("Connection closed")
+
+// tpacketReq mirrors struct tpacket_req
+type tpacketReq struct {
+	blockSize, blockNr, frameSize, frameNr uint32
+}
+
+// tpacket2Hdr mirrors struct tpacket2_hdr, which starts each frame of the ring
+type tpacket2Hdr struct {
+	status, len, snapLen uint32
+	mac, net             uint16
+	sec, nsec            uint32
+	vlanTCI, vlanTPID    uint16
+	padding              [4]uint8
+}
+
+// packetMMapFilter returns a socket filter accepting (on an AF_PACKET SOCK_DGRAM socket, so offsets are from the IP
+// header) the unfragmented UDP packets addressed to port
+func packetMMapFilter(port int) []syscall.SockFilter {
+	const (
+		ldAbsW = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+		ldAbsH = syscall.BPF_LD | syscall.BPF_H | syscall.BPF_ABS
+		ldAbsB = syscall.BPF_LD | syscall.BPF_B | syscall.BPF_ABS
+		ldIndH = syscall.BPF_LD | syscall.BPF_H | syscall.BPF_IND
+		ldxMsh = syscall.BPF_LDX | syscall.BPF_B | syscall.BPF_MSH
+		jeq    = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jset   = syscall.BPF_JMP | syscall.BPF_JSET | syscall.BPF_K
+		ret    = syscall.BPF_RET | syscall.BPF_K
+	)
+	return []syscall.SockFilter{
+		/* 0 */ {Code: ldAbsW, K: skfAdProtocol},
+		/* 1 */ {Code: jeq, K: ethPIPv4, Jf: 7}, // to 9
+		/* 2 */ {Code: ldAbsB, K: 9}, // IPv4 protocol
+		/* 3 */ {Code: jeq, K: syscall.IPPROTO_UDP, Jf: 11},
+		/* 4 */ {Code: ldAbsH, K: 6}, // IPv4 fragment offset
+		/* 5 */ {Code: jset, K: 0x1FFF, Jt: 9},
+		/* 6 */ {Code: ldxMsh, K: 0}, // X = IPv4 header length
+		/* 7 */ {Code: ldIndH, K: 2}, // UDP destination port
+		/* 8 */ {Code: jeq, K: uint32(port), Jt: 5, Jf: 6},
+		/* 9 */ {Code: jeq, K: ethPIPv6, Jf: 5},
+		/* 10 */ {Code: ldAbsB, K: 6}, // IPv6 next header
+		/* 11 */ {Code: jeq, K: syscall.IPPROTO_UDP, Jf: 3},
+		/* 12 */ {Code: ldAbsH, K: 40 + 2}, // UDP destination port
+		/* 13 */ {Code: jeq, K: uint32(port), Jf: 1},
+		/* 14 */ {Code: ret, K: 0x40000}, // accept
+		/* 15 */ {Code: ret, K: 0}, // drop
+	}
+}
+
+// PacketMMapPacketIO is an (experimental) packet I/O backend receiving UDP packets through PACKET_MMAP rings
+type PacketMMapPacketIO struct {
+	Frames    uint // number of packets each connection's ring holds (0 = 256, rounded up to fill a block)
+	FrameSize uint // bytes in each frame, to hold a packet with its IP headers and 80 more (0 = enough for any datagram)
+	ReusePort bool // open sockets with SO_REUSEPORT, as Config.ReusePortSockets needs
+}
+
+func (io PacketMMapPacketIO) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	pc, err := udpPacketIO{reusePort: io.ReusePort}.ListenPacket(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	uc := pc.(*net.UDPConn)
+	c, err := newPacketMMapConn(uc, io)
+	if err != nil {
+		uc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// packetMMapConn is a UDP socket whose packets are received through a PACKET_MMAP ring
+type packetMMapConn struct {
+	udp       *net.UDPConn // sends our packets, and holds our port
+	laddr     *net.UDPAddr
+	fd        int    // the AF_PACKET socket
+	wake      [2]int // a pipe written to when we're closed, waking a waiting ReadFrom
+	closed    atomicUint32
+	closeOnce sync.Once
+
+	recvProt       sync.Mutex // must be held to use ring or frame
+	ring           []byte
+	blockSize      int
+	frameSize      int
+	framesPerBlock int // frames fill each block from its start, leaving any space left over at its end unused
+	frames         int
+	frame          int // the next frame we expect the kernel to fill
+}
+
+func newPacketMMapConn(uc *net.UDPConn, io PacketMMapPacketIO) (*packetMMapConn, error) {
+	c := &packetMMapConn{udp: uc, laddr: uc.LocalAddr().(*net.UDPAddr), fd: -1, wake: [2]int{-1, -1}}
+	frameSize := int(io.FrameSize)
+	if frameSize == 0 {
+		frameSize = absMaxDatagramSize + packetMMapFrameOverhead
+	}
+	frameSize = (frameSize + 15) &^ 15 // TPACKET_ALIGNMENT
+	pageSize := os.Getpagesize()
+	blockSize := (frameSize + pageSize - 1) / pageSize * pageSize
+	if blockSize < packetMMapMinBlockSize {
+		blockSize = packetMMapMinBlockSize
+	}
+	framesPerBlock := blockSize / frameSize
+	frames := int(io.Frames)
+	if frames == 0 {
+		frames = packetMMapDefaultFrames
+	}
+	blocks := (frames + framesPerBlock - 1) / framesPerBlock
+	c.blockSize, c.frameSize, c.framesPerBlock, c.frames = blockSize, frameSize, framesPerBlock, blocks*framesPerBlock
+
+	// stop the UDP socket queueing the packets we'll be reading from the ring
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var filterErr error
+	if err := rc.Control(func(fd uintptr) {
+		filterErr = syscall.AttachLsf(int(fd), []syscall.SockFilter{{Code: syscall.BPF_RET | syscall.BPF_K, K: 0}})
+	}); err != nil {
+		return nil, err
+	}
+	if filterErr != nil {
+		return nil, os.NewSyscallError("setsockopt", filterErr)
+	}
+
+	if err := c.openRing(io.ReusePort, blockSize, blocks); err != nil {
+		c.closeFDs()
+		return nil, err
+	}
+	return c, nil
+}
+
+// openRing opens the AF_PACKET socket and maps its receive ring
+func (c *packetMMapConn) openRing(fanout bool, blockSize, blocks int) error {
+	var err error
+	// a protocol of zero receives nothing until we bind, so nothing arrives before the filter is attached
+	if c.fd, err = syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0); err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	if err = syscall.AttachLsf(c.fd, packetMMapFilter(c.laddr.Port)); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if err = syscall.SetsockoptInt(c.fd, solPacket, packetVersion, tpacketV2); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	req := tpacketReq{blockSize: uint32(blockSize), blockNr: uint32(blocks), frameSize: uint32(c.frameSize),
+		frameNr: uint32(c.frames)}
+	// (passed as a string, the only way the syscall package will pass a structure it doesn't know)
+	reqBytes := (*[unsafe.Sizeof(req)]byte)(unsafe.Pointer(&req))
+	if err = syscall.SetsockoptString(c.fd, solPacket, packetRxRing, string(reqBytes[:])); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if c.ring, err = syscall.Mmap(c.fd, 0, blocks*blockSize, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_SHARED); err != nil {
+		return os.NewSyscallError("mmap", err)
+	}
+	if err = syscall.Bind(c.fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPAll)}); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	if fanout {
+		// the sockets sharing our port share its packets out between them, rather than each getting them all
+		if err = syscall.SetsockoptInt(c.fd, solPacket, packetFanout, c.laddr.Port|packetFanoutHash<<16); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if err = syscall.Pipe2(c.wake[:], syscall.O_CLOEXEC); err != nil {
+		return os.NewSyscallError("pipe2", err)
+	}
+	return nil
+}
+
+func (c *packetMMapConn) closeFDs() {
+	if c.ring != nil {
+		syscall.Munmap(c.ring)
+		c.ring = nil
+	}
+	for _, fd := range []int{c.fd, c.wake[0], c.wake[1]} {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+	}
+	c.fd, c.wake = -1, [2]int{-1, -1}
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// currentFrame returns the frame we're waiting on, whose header's status the kernel sets once it has filled it
+func (c *packetMMapConn) currentFrame() ([]byte, *tpacket2Hdr) {
+	off := c.frame/c.framesPerBlock*c.blockSize + c.frame%c.framesPerBlock*c.frameSize
+	frame := c.ring[off : off+c.frameSize]
+	return frame, (*tpacket2Hdr)(unsafe.Pointer(&frame[0]))
+}
+
+func (c *packetMMapConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.recvProt.Lock()
+	defer c.recvProt.Unlock()
+	for {
+		if c.closed.get() != 0 {
+			return 0, nil, c.opError("read", nil, errPacketMMapClosed)
+		}
+		frame, hdr := c.currentFrame()
+		flags := atomic.LoadUint32(&hdr.status)
+		if flags&tpStatusUser == 0 {
+			if err := c.wait(); err != nil {
+				return 0, nil, c.opError("read", nil, err)
+			}
+			continue
+		}
+		n, from := c.parse(frame, hdr, flags, p)
+		atomic.StoreUint32(&hdr.status, tpStatusKernel) // hand the frame back
+		c.frame = (c.frame + 1) % c.frames
+		if from != nil {
+			return n, from, nil
+		}
+	}
+}
+
+// wait blocks until the kernel has filled a frame or we're closed
+func (c *packetMMapConn) wait() error {
+	fds := [2]struct {
+		fd              int32
+		events, revents int16
+	}{{fd: int32(c.fd), events: 0x1 /* POLLIN */}, {fd: int32(c.wake[0]), events: 0x1}}
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), 0, 0, 0,
+			0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return os.NewSyscallError("ppoll", errno)
+		}
+		return nil
+	}
+}
+
+// parse copies the UDP payload of the packet in frame to p, returning where it came from (or nil if it isn't one we
+// should read)
+func (c *packetMMapConn) parse(frame []byte, hdr *tpacket2Hdr, flags uint32, p []byte) (int, *net.UDPAddr) {
+	snapLen, netOff := hdr.snapLen, int(hdr.net)
+	if flags&tpStatusCopy != 0 || snapLen < hdr.len || netOff+int(snapLen) > len(frame) ||
+		frame[sockaddrLLPktTypeAt] != packetHost {
+		return 0, nil // truncated, or passing through rather than addressed to us
+	}
+	pkt := frame[netOff : netOff+int(snapLen)]
+
+	var src, dst net.IP
+	var udp []byte
+	var proto uint32
+	switch {
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		ihl := int(pkt[0]&0xF) * 4
+		if ihl < 20 || len(pkt) < ihl+8 {
+			return 0, nil
+		}
+		src, dst, udp = net.IPv4(pkt[12], pkt[13], pkt[14], pkt[15]), net.IP(pkt[16:20]), pkt[ihl:]
+		proto = ethPIPv4
+	case len(pkt) >= 48 && pkt[0]>>4 == 6:
+		src, dst, udp = append(net.IP(nil), pkt[8:24]...), net.IP(pkt[24:40]), pkt[40:]
+		proto = ethPIPv6
+	default:
+		return 0, nil
+	}
+	if int(binary.BigEndian.Uint16(udp[2:])) != c.laddr.Port || !c.acceptsDest(dst, proto) {
+		return 0, nil
+	}
+	udpLen := int(binary.BigEndian.Uint16(udp[4:]))
+	if udpLen < 8 || udpLen > len(udp) {
+		return 0, nil
+	}
+	udp = udp[:udpLen]
+	sum := binary.BigEndian.Uint16(udp[6:])
+	if flags&(tpStatusCsumNotRdy|tpStatusCsumValid) == 0 && (sum != 0 || proto == ethPIPv6) &&
+		udpChecksum(src, dst, udp) != 0xFFFF {
+		return 0, nil // corrupted
+	}
+	return copy(p, udp[8:]), &net.UDPAddr{IP: src, Port: int(binary.BigEndian.Uint16(udp[0:]))}
+}
+
+// acceptsDest returns true if a packet to dst is one our UDP socket would have received
+func (c *packetMMapConn) acceptsDest(dst net.IP, proto uint32) bool {
+	if !c.laddr.IP.IsUnspecified() {
+		return c.laddr.IP.Equal(dst)
+	}
+	return proto == ethPIPv4 || c.laddr.IP.To4() == nil // an IPv4 socket doesn't receive IPv6
+}
+
+// udpChecksum returns the ones' complement sum of a UDP packet and its pseudo-header, which is 0xFFFF if the packet's
+// checksum is correct
+func udpChecksum(src, dst net.IP, udp []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for ; len(b) > 1; b = b[2:] {
+			sum += uint32(b[0])<<8 | uint32(b[1])
+		}
+		if len(b) == 1 {
+			sum += uint32(b[0]) << 8
+		}
+	}
+	if src4 := src.To4(); src4 != nil {
+		add(src4)
+		add(dst.To4())
+	} else {
+		add(src)
+		add(dst)
+	}
+	sum += syscall.IPPROTO_UDP + uint32(len(udp))
+	add(udp)
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return uint16(sum)
+}
+
+func (c *packetMMapConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.closed.get() != 0 {
+		return 0, c.opError("write", addr, errPacketMMapClosed)
+	}
+	return c.udp.WriteTo(p, addr)
+}
+
+func (c *packetMMapConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closed.set(1)
+		syscall.Write(c.wake[1], []byte{0}) // wake a waiting ReadFrom
+		c.recvProt.Lock()
+		c.closeFDs()
+		c.recvProt.Unlock()
+		c.udp.Close()
+	})
+	return nil
+}
+
+func (c *packetMMapConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *packetMMapConn) SetDeadline(t time.Time) error {
+	return errors.New("Deadlines are not supported by the PACKET_MMAP backend")
+}
+
+func (c *packetMMapConn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *packetMMapConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *packetMMapConn) opError(op string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Source: c.laddr, Addr: addr, Err: err}
+}
@@ -0,0 +1,106 @@
+//go:build linux && packetmmap
+// +build linux,packetmmap
+
+package udt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// listenPacketMMap opens a connection with the PACKET_MMAP backend, skipping the test if we aren't permitted raw
+// sockets
+func listenPacketMMap(tb testing.TB) net.PacketConn {
+	conn, err := PacketMMapPacketIO{}.ListenPacket(context.Background(), "udp", "127.0.0.1:0")
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EAFNOSUPPORT) || os.IsPermission(err) {
+		tb.Skipf("PACKET_MMAP unavailable: %s", err.Error())
+	}
+	if err != nil {
+		tb.Fatalf("error opening connection: %s", err.Error())
+	}
+	return conn
+}
+
+func TestPacketMMapPacketIO(t *testing.T) {
+	a := listenPacketMMap(t)
+	defer a.Close()
+	b := listenPacketMMap(t)
+	defer b.Close()
+	other := listenPacketMMap(t)
+	defer other.Close()
+
+	// more packets than the ring holds, so frames are handed back and reused, with packets for another port between
+	buf := make([]byte, 1500)
+	for i := 0; i < 3*packetMMapDefaultFrames; i++ {
+		if _, err := a.WriteTo([]byte("not for b"), other.LocalAddr()); err != nil {
+			t.Fatalf("error writing packet %d: %s", i, err.Error())
+		}
+		msg := []byte{byte(i), byte(i >> 8), 'x'}
+		if _, err := a.WriteTo(msg, b.LocalAddr()); err != nil {
+			t.Fatalf("error writing packet %d: %s", i, err.Error())
+		}
+		n, from, err := b.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("error reading packet %d: %s", i, err.Error())
+		}
+		if !bytes.Equal(buf[:n], msg) || from.String() != a.LocalAddr().String() {
+			t.Fatalf("read %v from %s, expected %v from %s", buf[:n], from, msg, a.LocalAddr())
+		}
+	}
+
+	// a read waiting for a packet is woken by Close
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := b.ReadFrom(buf)
+		done <- err
+	}()
+	b.Close()
+	if err := <-done; err == nil {
+		t.Error("expected a read on a closed connection to fail")
+	}
+}
+
+func TestPacketMMapChecksum(t *testing.T) {
+	udp := []byte{0x30, 0x39, 0x00, 0x35, 0x00, 0x0C, 0, 0, 'h', 'i', '!', '?'}
+	src, dst := net.IPv4(192, 168, 1, 2), net.IPv4(192, 168, 1, 3)
+	sum := ^udpChecksum(src, dst, udp)
+	udp[6], udp[7] = byte(sum>>8), byte(sum)
+	if got := udpChecksum(src, dst, udp); got != 0xFFFF {
+		t.Errorf("expected a packet with its checksum filled in to sum to 0xFFFF, got %#x", got)
+	}
+	udp[9] ^= 1
+	if got := udpChecksum(src, dst, udp); got == 0xFFFF {
+		t.Error("expected a corrupted packet not to sum to 0xFFFF")
+	}
+}
+
+func TestPacketMMapConnection(t *testing.T) {
+	listenPacketMMap(t).Close()
+	config := DefaultConfig()
+	config.PacketIO = PacketMMapPacketIO{}
+	serv, server, client := packetIOConnect(t, config, serverPort+101)
+	defer serv.Close()
+	defer server.Close()
+	defer client.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	go client.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+}
+
+func BenchmarkPacketMMapThroughput(b *testing.B) {
+	listenPacketMMap(b).Close()
+	benchmarkPacketIO(b, PacketMMapPacketIO{}, serverPort+103)
+}
@@ -0,0 +1,142 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// pendingAbandonTime is how long we wait without a repeated handshake before assuming the peer has given up
+// on a pending connection (dialers retry every 250ms)
+const pendingAbandonTime = time.Second
+
+// PendingConn is an incoming connection being held before its handshake is completed, so the application can decide
+// whether (and how) to accept it.  These are returned from Listener.AcceptContext when Config.AcceptPending is set.
+// Either Accept or Reject should be called promptly, the peer will give up on the connection after a few seconds
+type PendingConn struct {
+	RemoteAddr     *net.UDPAddr            // address the connection is coming from
+	IsStream       bool                    // whether the peer requested a stream rather than a datagram connection
+	MaxPacketSize  uint                    // largest packet the peer will send or receive (including UDP/IP headers)
+	MaxFlowWinSize uint                    // largest number of unacknowledged packets the peer will permit
+	Handshake      *packet.HandshakePacket // the peer's handshake, including any extensions
+
+	l         *listener
+	m         *multiplexer
+	key       pendingKey
+	lastTouch time.Time // last time we received a handshake for this connection (guarded by l.pendingProt)
+	decided   bool      // whether Accept or Reject has been called (guarded by l.pendingProt)
+}
+
+// pendingKey identifies a connection attempt, as the peer may repeat its handshake while we're deciding
+type pendingKey struct {
+	sockID    uint32
+	initSeqNo packet.PacketID
+}
+
+func newPendingConn(l *listener, m *multiplexer, hsPacket *packet.HandshakePacket, from *net.UDPAddr, now time.Time) *PendingConn {
+	return &PendingConn{
+		RemoteAddr:     from,
+		IsStream:       hsPacket.SockType == packet.TypeSTREAM,
+		MaxPacketSize:  uint(hsPacket.MaxPktSize),
+		MaxFlowWinSize: uint(hsPacket.MaxFlowWinSize),
+		Handshake:      hsPacket,
+		l:              l,
+		m:              m,
+		key:            pendingKey{sockID: hsPacket.SockID, initSeqNo: hsPacket.InitPktSeq},
+		lastTouch:      now,
+	}
+}
+
+// Accept completes the handshake for this connection, returning the new connection.  If config is nil the
+// listener's Config is used
+func (pc *PendingConn) Accept(config *Config) (net.Conn, error) {
+	if config == nil {
+		config = pc.l.config
+	}
+
+	l := pc.l
+	l.pendingProt.Lock()
+	defer l.pendingProt.Unlock()
+	if err := pc.decide(); err != nil {
+		return nil, err
+	}
+	if pc.l.clock.Now().Sub(pc.lastTouch) > pendingAbandonTime {
+		return nil, errors.New("Connection attempt abandoned by remote host")
+	}
+
+	s, rej := l.completeHandshake(pc.m, config, pc.Handshake, pc.RemoteAddr, l.clock.Now())
+	if rej != nil {
+		l.refuse(pc.m, pc.Handshake, pc.RemoteAddr, rej)
+		return nil, rej
+	}
+	return s, nil
+}
+
+// Reject refuses this connection, passing the specified reason (and optional message) along to the peer
+func (pc *PendingConn) Reject(reason RejectReason, message string) error {
+	l := pc.l
+	l.pendingProt.Lock()
+	defer l.pendingProt.Unlock()
+	if err := pc.decide(); err != nil {
+		return err
+	}
+	l.refuse(pc.m, pc.Handshake, pc.RemoteAddr, &RejectError{Reason: reason, Message: message})
+	return nil
+}
+
+// decide marks this connection as having been decided upon.  l.pendingProt must be held
+func (pc *PendingConn) decide() error {
+	if pc.decided {
+		return errors.New("Pending connection has already been accepted or rejected")
+	}
+	pc.decided = true
+	if pc.l.pendingHist[pc.key] == pc {
+		delete(pc.l.pendingHist, pc.key)
+	}
+	return nil
+}
+
+// AcceptContext waits for the next incoming connection, returning it before its handshake has been completed so the
+// caller can choose whether to accept it and with what configuration.  This requires Config.AcceptPending
+func (l *listener) AcceptContext(ctx context.Context) (*PendingConn, error) {
+	if !l.config.AcceptPending {
+		return nil, errors.New("Listener is not holding pending connections (see Config.AcceptPending)")
+	}
+	for {
+		select {
+		case pc := <-l.pending:
+			l.pendingProt.Lock()
+			abandoned := l.clock.Now().Sub(pc.lastTouch) > pendingAbandonTime
+			if abandoned {
+				pc.decide()
+			}
+			l.pendingProt.Unlock()
+			if !abandoned {
+				return pc, nil
+			}
+		case _, _ = <-l.closed:
+			return nil, l.closedError()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// holdPending records a new connection attempt to be returned from AcceptContext.  l.pendingProt must be held
+func (l *listener) holdPending(m *multiplexer, hsPacket *packet.HandshakePacket, from *net.UDPAddr, now time.Time) {
+	if l.pendingHist == nil {
+		l.pendingHist = make(map[pendingKey]*PendingConn)
+	}
+	for key, pc := range l.pendingHist {
+		if now.Sub(pc.lastTouch) > pendingAbandonTime {
+			delete(l.pendingHist, key)
+		}
+	}
+
+	pc := newPendingConn(l, m, hsPacket, from, now)
+	l.pendingHist[pc.key] = pc
+	l.pending <- pc
+}
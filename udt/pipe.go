@@ -0,0 +1,132 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+Pipe connects two UDT sockets through an in-process datagram channel rather than the network, in the manner of
+net.Pipe, so applications built on UDT can be tested without opening sockets.  Everything else is as over a network:
+the connection has a handshake, congestion control, and so on.  The channel holds a limited number of datagrams,
+discarding any more (as a UDP socket would with a full receive buffer) and leaving UDT to retransmit them.
+*/
+
+const pipeQueueLen = 1024 // datagrams a pipe endpoint holds before discarding more
+
+var errPipeClosed = errors.New("Pipe closed")
+
+// Pipe creates a connected pair of UDT stream connections carried in memory, using DefaultConfig
+func Pipe() (net.Conn, net.Conn) {
+	return DefaultConfig().Pipe()
+}
+
+// Pipe creates a connected pair of UDT stream connections carried in memory
+func (c *Config) Pipe() (net.Conn, net.Conn) {
+	a, b := newPipeConns()
+	amx, err := NewMultiplexerWithConn(a, c)
+	if err != nil {
+		panic(err)
+	}
+	bmx, err := NewMultiplexerWithConn(b, c)
+	if err != nil {
+		panic(err)
+	}
+	defer amx.Close()
+	defer bmx.Close()
+
+	l, err := amx.Listen()
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			conn = nil
+		}
+		accepted <- conn
+	}()
+
+	// nothing is lost over a pipe, so this can only fail if something is badly wrong
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := bmx.Dial(ctx, amx.Addr(), true)
+	if err != nil {
+		panic(err)
+	}
+	server := <-accepted
+	if server == nil {
+		panic(errors.New("Pipe connection not accepted"))
+	}
+	return server, client
+}
+
+// pipeConn is one end of an in-memory datagram channel
+type pipeConn struct {
+	laddr     *net.UDPAddr
+	peer      *pipeConn
+	in        chan []byte   // datagrams sent to us
+	closed    chan struct{} // closed when we are
+	closeOnce sync.Once
+}
+
+// newPipeConns creates the two ends of an in-memory datagram channel
+func newPipeConns() (*pipeConn, *pipeConn) {
+	a := &pipeConn{
+		laddr:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1},
+		in:     make(chan []byte, pipeQueueLen),
+		closed: make(chan struct{}),
+	}
+	b := &pipeConn{
+		laddr:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2},
+		in:     make(chan []byte, pipeQueueLen),
+		closed: make(chan struct{}),
+	}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (c *pipeConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, errPipeClosed
+	case b := <-c.in:
+		return copy(p, b), c.peer.laddr, nil
+	}
+}
+
+func (c *pipeConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errPipeClosed
+	default:
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	select {
+	case c.peer.in <- b:
+	default: // the peer is full (or gone), so this is lost
+	}
+	return len(p), nil
+}
+
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+// deadlines aren't used by the multiplexer
+func (c *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
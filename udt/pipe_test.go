@@ -0,0 +1,32 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	go b.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(a, got); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read doesn't match what was written")
+	}
+
+	// and the other way around
+	if _, err := a.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,53 @@
+package udt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.MaxBytesPerConn and Config.MaxDurationPerConn let a public relay or gateway enforce fair use directly in the
+transport: a connection that has sent and received more payload than permitted, or been open for longer, is closed.
+A Write that would take the connection over its byte quota is refused.  The peer is told why in the shutdown packet
+(CloseQuotaExceeded), the connection's own Read and Write calls return ErrQuotaExceeded, and Config.OnAudit reports
+the connection closed with that error.
+*/
+
+// ErrQuotaExceeded is returned from Read and Write on a connection closed for exceeding Config.MaxBytesPerConn or
+// Config.MaxDurationPerConn
+var ErrQuotaExceeded = errors.New("Connection closed after exceeding its quota")
+
+// overQuota returns true if sending another extra bytes would take this connection over Config.MaxBytesPerConn
+func (s *udtSocket) overQuota(extra uint64) bool {
+	max := s.Config.MaxBytesPerConn
+	return max > 0 && s.byteSent.get()+s.byteRecv.get()+extra > max
+}
+
+// signalQuota asks goManageConnection to close this connection for exceeding its quota
+func (s *udtSocket) signalQuota() {
+	select {
+	case s.quotaHit <- struct{}{}:
+	default: // already asked
+	}
+}
+
+// durationTimer returns a channel that fires once the connection has been open for Config.MaxDurationPerConn, or nil
+// if there's no limit
+func (s *udtSocket) durationTimer() <-chan time.Time {
+	max := s.Config.MaxDurationPerConn
+	if max <= 0 {
+		return nil
+	}
+	return s.clock.After(max - s.elapsed())
+}
+
+// exceedQuota is called by goManageConnection to close the connection for exceeding its quota, telling the peer why
+func (s *udtSocket) exceedQuota() {
+	if !s.isOpen() {
+		return
+	}
+	s.writePacket(&packet.ShutdownPacket{Code: uint32(CloseQuotaExceeded)})
+	s.shutdown(sockStateClosed, false, ErrQuotaExceeded)
+}
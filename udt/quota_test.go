@@ -0,0 +1,49 @@
+package udt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxBytesPerConn(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBytesPerConn = 10
+	server, client := config.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing within the quota: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("read %q, %v", buf[:n], err)
+	}
+
+	// this would take the client over its quota, so it's refused and the connection closed
+	if _, err := client.Write([]byte("world!")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected a write over the quota to fail with ErrQuotaExceeded, got %v", err)
+	}
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var closeErr *CloseError
+	if _, err := server.Read(buf); !errors.As(err, &closeErr) || closeErr.Code != CloseQuotaExceeded {
+		t.Errorf("expected the peer to be told the quota was exceeded, got %v", err)
+	}
+}
+
+func TestMaxDurationPerConn(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxDurationPerConn = 200 * time.Millisecond
+	server, client := config.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// both ends enforce the limit, whichever gets there first tells the other
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var closeErr *CloseError
+	if _, err := client.Read(make([]byte, 16)); !errors.Is(err, ErrQuotaExceeded) &&
+		!(errors.As(err, &closeErr) && closeErr.Code == CloseQuotaExceeded) {
+		t.Errorf("expected the connection to be closed for exceeding its quota, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package udt
+
+import (
+	"sync"
+	"time"
+)
+
+const rateLimitBurst = synTime // a rate limit permits bursts of up to this much sending time
+
+// tokenBucket limits the rate packets are written out at.  Sending is permitted whenever the bucket isn't in debt, with
+// the size of each packet charged afterwards, so a packet of any size can be sent once the previous ones have been
+// paid for.  A rate of zero places no limit
+type tokenBucket struct {
+	prot   sync.Mutex // lock must be held before referencing rate/tokens/last
+	clock  Clock
+	rate   uint64    // bytes/sec
+	tokens float64   // bytes that may be sent (negative if in debt)
+	last   time.Time // when tokens was last brought up to date
+}
+
+func newTokenBucket(clock Clock, rate uint64) *tokenBucket {
+	return &tokenBucket{clock: clock, rate: rate, last: clock.Now()}
+}
+
+// refill brings the bucket up to date, up to a burst of rateLimitBurst worth of sending.  b.prot must be held
+func (b *tokenBucket) refill() {
+	now := b.clock.Now()
+	b.tokens += float64(b.rate) * now.Sub(b.last).Seconds()
+	if burst := float64(b.rate) * rateLimitBurst.Seconds(); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+}
+
+// setRate changes the limit to the specified rate, keeping any debt from packets already sent
+func (b *tokenBucket) setRate(rate uint64) {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	b.refill()
+	b.rate = rate
+}
+
+// getRate returns the current limit (zero if there isn't one)
+func (b *tokenBucket) getRate() uint64 {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	return b.rate
+}
+
+// ready returns zero if we can send now, otherwise how long until we can
+func (b *tokenBucket) ready() time.Duration {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	if b.rate == 0 {
+		return 0
+	}
+	b.refill()
+	if b.tokens >= 0 {
+		return 0
+	}
+	wait := time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Microsecond
+	}
+	return wait
+}
+
+// charge accounts for a packet of the specified size having been sent
+func (b *tokenBucket) charge(size int) {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	if b.rate == 0 {
+		return
+	}
+	b.refill()
+	b.tokens -= float64(size)
+}
@@ -0,0 +1,99 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+Conn.WriteMessageReceipt sends a message as WriteMessage does, returning a Receipt that tells the application once the
+peer has acknowledged the message, so an application protocol needing at-least-once delivery doesn't have to send its
+own acknowledgements.  The receipt's Done channel is closed once the last packet of the message has been acknowledged
+(and so every packet before it), or once the message has been given up on: dropped for outliving its time to live,
+retransmitted Config.MaxRexmitAttempts times, or abandoned by the connection closing.  Err then tells which.
+
+A message is acknowledged once the peer has received it, which isn't necessarily once the application at the other end
+has read it.
+*/
+
+// ErrMessageDropped is returned by Receipt.Err for a message given up on before its peer acknowledged it, for outliving
+// its time to live or being retransmitted too many times
+var ErrMessageDropped = errors.New("Message dropped before it was acknowledged")
+
+// Receipt tells when a message sent with Conn.WriteMessageReceipt has been acknowledged by the peer, or given up on
+type Receipt struct {
+	done chan struct{}
+	err  error
+}
+
+// Done returns a channel that's closed once the message has been acknowledged, or given up on
+func (r *Receipt) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns nil if the message was acknowledged, ErrMessageDropped if it was dropped, or why the connection closed
+// before it was acknowledged.  It returns nil until Done is closed
+func (r *Receipt) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// WriteMessageReceipt sends a single message on a datagram connection as WriteMessage does, returning a Receipt that
+// tells when the peer has acknowledged it
+func (s *udtSocket) WriteMessageReceipt(p []byte, ttl time.Duration, inOrder bool) (*Receipt, error) {
+	if !s.isDatagram {
+		return nil, errors.New("WriteMessageReceipt is only supported on datagram connections")
+	}
+	if maxSize := s.Config.MaxMessageSize; maxSize > 0 && uint(len(p)) > maxSize {
+		return nil, fmt.Errorf("Message of %d bytes exceeds the maximum message size of %d", len(p), maxSize)
+	}
+	r := &Receipt{done: make(chan struct{})}
+	s.receiptProt.Lock()
+	if s.receipts == nil {
+		s.receiptProt.Unlock()
+		return nil, ErrClosed
+	}
+	s.receipts[r] = struct{}{}
+	s.receiptProt.Unlock()
+
+	_, err := s.writeMessage(context.Background(), sendMessage{content: p, tim: s.clock.Now(), ttl: ttl, inOrder: inOrder,
+		receipt: r})
+	if err != nil {
+		s.settleReceipt(r, err)
+		return nil, err
+	}
+	return r, nil
+}
+
+// settleReceipt tells whoever is waiting on a receipt that its message has been acknowledged (nil) or given up on
+func (s *udtSocket) settleReceipt(r *Receipt, err error) {
+	s.receiptProt.Lock()
+	defer s.receiptProt.Unlock()
+	if _, ok := s.receipts[r]; !ok {
+		return // already settled
+	}
+	delete(s.receipts, r)
+	r.err = err
+	close(r.done)
+}
+
+// abandonReceipts settles every receipt not yet settled once the connection has closed
+func (s *udtSocket) abandonReceipts() {
+	err := s.connectionError()
+	if err == nil {
+		err = ErrClosed
+	}
+	s.receiptProt.Lock()
+	defer s.receiptProt.Unlock()
+	for r := range s.receipts {
+		r.err = err
+		close(r.done)
+	}
+	s.receipts = nil
+}
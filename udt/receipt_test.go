@@ -0,0 +1,91 @@
+package udt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReceiptDelivered(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 1024) // spans several packets
+	receipt, err := client.WriteMessageReceipt(msg, 0, true)
+	if err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	select {
+	case <-receipt.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was never acknowledged")
+	}
+	if err := receipt.Err(); err != nil {
+		t.Errorf("expected the message to be delivered, got %s", err.Error())
+	}
+	got, _, err := server.ReadMessage()
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("expected to read the message, got %d bytes, %v", len(got), err)
+	}
+
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, err := b.(Conn).WriteMessageReceipt(msg, 0, true); err == nil {
+		t.Error("expected WriteMessageReceipt to fail on a stream connection")
+	}
+}
+
+func TestReceiptDropped(t *testing.T) {
+	ss, sent := newTestSender(DefaultConfig())
+	ss.socket.receipts = make(map[*Receipt]struct{})
+	receipt := &Receipt{done: make(chan struct{})}
+	ss.socket.receipts[receipt] = struct{}{}
+	sendTestMessage(ss, 1, time.Second)
+	ss.sendPktPend[0].receipt = receipt
+	if receipt.Err() != nil {
+		t.Error("expected no error before the message is settled")
+	}
+
+	ss.socket.clock.(*manualClock).advance(2 * time.Second)
+	if !ss.processSendExpire() {
+		t.Fatal("message didn't expire")
+	}
+	<-sent
+	select {
+	case <-receipt.Done():
+	default:
+		t.Fatal("expected the receipt to be settled once the message was dropped")
+	}
+	if err := receipt.Err(); err != ErrMessageDropped {
+		t.Errorf("expected ErrMessageDropped, got %v", err)
+	}
+}
+
+func TestReceiptClosed(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+
+	// as if a message was still waiting to be acknowledged
+	s := client.(*udtSocket)
+	receipt := &Receipt{done: make(chan struct{})}
+	s.receiptProt.Lock()
+	s.receipts[receipt] = struct{}{}
+	s.receiptProt.Unlock()
+
+	client.CloseWithError(CloseGoingAway, "")
+	select {
+	case <-receipt.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the receipt to be settled once the connection closed")
+	}
+	var closeErr *CloseError
+	if err := receipt.Err(); !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+		t.Errorf("expected the reason the connection closed, got %v", err)
+	}
+	if _, err := client.WriteMessageReceipt([]byte("hello"), 0, true); err == nil {
+		t.Error("expected WriteMessageReceipt to fail once the connection is closed")
+	}
+}
@@ -21,7 +21,7 @@ func (h receiveLossHeap) Len() int {
 }
 
 func (h receiveLossHeap) Less(i, j int) bool {
-	return h[i].packetID.Seq < h[j].packetID.Seq
+	return h[i].packetID.Cmp(h[j].packetID) < 0
 }
 
 func (h receiveLossHeap) Swap(i, j int) {
@@ -40,72 +40,33 @@ func (h *receiveLossHeap) Pop() interface{} {
 	return x
 }
 
-// Min does a binary search of the heap for the entry with the lowest packetID greater than or equal to the specified value
+// Min does a search of the heap for the entry with the lowest packetID greater than or equal to the specified value
 func (h receiveLossHeap) Min(greaterEqual packet.PacketID, lessEqual packet.PacketID) (packet.PacketID, int) {
-	len := len(h)
-	idx := 0
-	wrapped := greaterEqual.Seq > lessEqual.Seq
-	for idx < len {
-		pid := h[idx].packetID
-		var next int
-		if pid.Seq == greaterEqual.Seq {
-			return h[idx].packetID, idx
-		} else if pid.Seq >= greaterEqual.Seq {
-			next = idx * 2
-		} else {
-			next = idx*2 + 1
-		}
-		if next >= len && h[idx].packetID.Seq > greaterEqual.Seq && (wrapped || h[idx].packetID.Seq <= lessEqual.Seq) {
-			return h[idx].packetID, idx
-		}
-		idx = next
+	idx := heapMinRange(h, 0, func(idx int) int {
+		return seqInRange(h[idx].packetID, greaterEqual, lessEqual)
+	})
+	if idx < 0 {
+		return packet.PacketID{Seq: 0}, -1
 	}
-
-	// can't find any packets with greater value, wrap around
-	if wrapped {
-		idx = 0
-		for {
-			next := idx * 2
-			if next >= len && h[idx].packetID.Seq <= lessEqual.Seq {
-				return h[idx].packetID, idx
-			}
-			idx = next
-		}
-	}
-	return packet.PacketID{Seq: 0}, -1
+	return h[idx].packetID, idx
 }
 
-// Find does a binary search of the heap for the specified packetID which is returned
+// Find does a search of the heap for the specified packetID which is returned
 func (h receiveLossHeap) Find(packetID packet.PacketID) (*recvLossEntry, int) {
-	len := len(h)
-	idx := 0
-	for idx < len {
-		pid := h[idx].packetID
-		if pid == packetID {
-			return &h[idx], idx
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	idx := heapFind(len(h), 0, func(idx int) int {
+		return h[idx].packetID.Cmp(packetID)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return &h[idx], idx
 }
 
-// Remove does a binary search of the heap for the specified packetID, which is removed
+// Remove does a search of the heap for the specified packetID, which is removed
 func (h *receiveLossHeap) Remove(packetID packet.PacketID) bool {
-	len := len(*h)
-	idx := 0
-	for idx < len {
-		pid := (*h)[idx].packetID
-		if pid == packetID {
-			heap.Remove(h, idx)
-			return true
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	if _, idx := h.Find(packetID); idx >= 0 {
+		heap.Remove(h, idx)
+		return true
 	}
 	return false
 }
@@ -0,0 +1,119 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// RejectReason identifies why a listener refused a connection.  It is carried to the dialing side in the HsExtReject
+// handshake extension
+type RejectReason uint32
+
+const (
+	// RejectUnknown is reported when the listener gave no reason (including peers that don't send one)
+	RejectUnknown RejectReason = 0
+	// RejectBacklog means the listener has too many connections waiting to be accepted
+	RejectBacklog RejectReason = 1
+	// RejectForbidden means the connection was refused by the listener's CanAccept filter
+	RejectForbidden RejectReason = 2
+	// RejectVersion means the listener doesn't support the requested UDT version
+	RejectVersion RejectReason = 3
+	// RejectSockType means the listener doesn't accept the requested socket type (stream or datagram)
+	RejectSockType RejectReason = 4
+	// RejectService means nothing is listening for the requested service (see Config.ServiceName)
+	RejectService RejectReason = 5
+	// RejectAuth means the dialing side didn't prove it holds the listener's Config.PreSharedKey
+	RejectAuth RejectReason = 6
+	// RejectPacketSize means the dialing side advertised a maximum packet size too small to use or too large for IP
+	RejectPacketSize RejectReason = 7
+	// RejectUnsupported means the dialing side doesn't support an optional feature the listener requires (see
+	// Config.AllowDegraded)
+	RejectUnsupported RejectReason = 8
+	// RejectUser is the first of the reasons reserved for applications to define
+	RejectUser RejectReason = 1000
+)
+
+// maxRejectMessage is the longest description we'll send along with a refusal
+const maxRejectMessage = 256
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectUnknown:
+		return "unknown"
+	case RejectBacklog:
+		return "backlog full"
+	case RejectForbidden:
+		return "forbidden"
+	case RejectVersion:
+		return "unsupported version"
+	case RejectSockType:
+		return "unsupported socket type"
+	case RejectService:
+		return "unknown service"
+	case RejectAuth:
+		return "authentication failed"
+	case RejectPacketSize:
+		return "unsupported packet size"
+	case RejectUnsupported:
+		return "unsupported feature"
+	}
+	if r >= RejectUser {
+		return fmt.Sprintf("user(%d)", uint32(r-RejectUser))
+	}
+	return fmt.Sprintf("reason(%d)", uint32(r))
+}
+
+// RejectError describes a refused connection.  Return one from Config.CanAccept to control what the dialing side is
+// told, which receives it (wrapped in a net.OpError) as the error from Dial
+type RejectError struct {
+	Reason  RejectReason // why the connection was refused
+	Message string       // optional description to pass along with the refusal
+}
+
+// Reject constructs a RejectError, for use by Config.CanAccept
+func Reject(reason RejectReason, message string) error {
+	return &RejectError{Reason: reason, Message: message}
+}
+
+func (e *RejectError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Connection refused by remote host (%s): %s", e.Reason.String(), e.Message)
+	}
+	return fmt.Sprintf("Connection refused by remote host (%s)", e.Reason.String())
+}
+
+// rejectionFor converts an error returned from Config.CanAccept into what we tell the dialing side.  Only the message
+// from an explicit RejectError is passed on, anything else may be revealing more than intended
+func rejectionFor(err error) *RejectError {
+	var rej *RejectError
+	if errors.As(err, &rej) {
+		return rej
+	}
+	return &RejectError{Reason: RejectForbidden}
+}
+
+// extension encodes this refusal into a handshake extension: the reason code followed by the message
+func (e *RejectError) extension() packet.HandshakeExtension {
+	msg := e.Message
+	if len(msg) > maxRejectMessage {
+		msg = msg[:maxRejectMessage]
+	}
+	data := make([]byte, 4+len(msg))
+	endianness.PutUint32(data[0:4], uint32(e.Reason))
+	copy(data[4:], msg)
+	return packet.HandshakeExtension{Type: packet.HsExtReject, Data: data}
+}
+
+// readRejection decodes the reason a peer gave for refusing our connection
+func readRejection(p *packet.HandshakePacket) *RejectError {
+	ext, ok := p.Extension(packet.HsExtReject)
+	if !ok || len(ext) < 4 {
+		return &RejectError{Reason: RejectUnknown}
+	}
+	return &RejectError{
+		Reason:  RejectReason(endianness.Uint32(ext[0:4])),
+		Message: string(ext[4:]),
+	}
+}
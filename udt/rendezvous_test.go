@@ -0,0 +1,69 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRendezvous(t *testing.T) {
+	hub := fmt.Sprintf("127.0.0.1:%d", serverPort+32)
+	spokes := []string{fmt.Sprintf("127.0.0.1:%d", clientPort+32), fmt.Sprintf("127.0.0.1:%d", serverPort+34)}
+	resolve := func(addr string) *net.UDPAddr {
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			t.Fatalf("error calling ResolveUDPAddr: %s", err.Error())
+		}
+		return raddr
+	}
+
+	// the hub races to rendezvous with each of the spokes at once, while they each race to rendezvous with it
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	var wg sync.WaitGroup
+	fromHub := make([]result, len(spokes))
+	toHub := make([]result, len(spokes))
+	for idx, spoke := range spokes {
+		idx, spoke := idx, spoke
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conn, err := DefaultConfig().Rendezvous(context.Background(), "udp", hub, resolve(spoke), true)
+			fromHub[idx] = result{conn, err}
+		}()
+		go func() {
+			defer wg.Done()
+			conn, err := DefaultConfig().Rendezvous(context.Background(), "udp", spoke, resolve(hub), true)
+			toHub[idx] = result{conn, err}
+		}()
+	}
+	wg.Wait()
+	for idx := range spokes {
+		if fromHub[idx].err != nil || toHub[idx].err != nil {
+			t.Fatalf("error calling Rendezvous for %s: %v / %v", spokes[idx], fromHub[idx].err, toHub[idx].err)
+		}
+		defer fromHub[idx].conn.Close()
+		defer toHub[idx].conn.Close()
+	}
+
+	for idx, spoke := range spokes {
+		msg := []byte("hello " + spoke)
+		if _, err := fromHub[idx].conn.Write(msg); err != nil {
+			t.Fatalf("error calling Write: %s", err.Error())
+		}
+		buf := make([]byte, len(msg))
+		toHub[idx].conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(toHub[idx].conn, buf); err != nil {
+			t.Fatalf("error calling Read: %s", err.Error())
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("%s received %q, expected %q", spoke, buf, msg)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package udt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+A listener with Config.ResumptionLifetime set hands each client it accepts an opaque resumption token, in the
+HsExtResume extension of its response handshake.  The client's Conn.Session packages that token along with the client's
+measurements of the path (its packet size, roundtrip time and the rates its peer reported), and Config.Resume later
+dials the listener again with it.  A handshake presenting a token the listener recognises skips the syn cookie exchange,
+going straight to the response that completes the connection, and both ends start from the measurements carried in the
+session rather than from scratch.  This is meant for clients on unreliable links that reconnect often.
+
+The token is issued when the connection is established rather than when it closes, as connections on the links this
+is meant for are more likely to time out than to be closed cleanly, and are given a fresh token each time they're
+resumed.  A resumed connection is otherwise a new one, with its own socket IDs and initial sequence numbers.
+
+Tokens are authenticated with an HMAC keyed by a secret of the listener's own, so only that listener accepts them.  As
+they aren't tied to the client's address (which on a mobile client may well have changed), each token skips the cookie
+exchange only once, after which it's treated as though it weren't there.  A listener requiring Config.PreSharedKey
+always makes the exchange, as the dialer's proof answers the cookie; the measurements are still carried over.
+*/
+
+const (
+	resumeTokenIDSize  = 8  // bytes of random ID identifying a token, so each can only be used once
+	resumeTokenMACSize = 16 // bytes of HMAC authenticating a token
+	resumeTokenSize    = resumeTokenIDSize + 8 + 1 + resumeTokenMACSize
+	resumeHintSize     = 16 // bytes of path measurements that follow a dialing side's token
+)
+
+// ErrNoSession is returned from Conn.Session when the peer didn't issue a resumption token for the connection
+var ErrNoSession = errors.New("Peer issued no resumption token for this connection")
+
+// Session holds what's needed to resume a connection to a listener later with Config.Resume, see Conn.Session.  It
+// may be kept (or stored elsewhere) after the connection has closed
+type Session struct {
+	Addr         *net.UDPAddr  // the listener's address
+	IsStream     bool          // whether this was a stream (rather than datagram) connection
+	Token        []byte        // opaque token the listener issued
+	Expires      time.Time     // after which the listener no longer accepts the token
+	MTU          uint          // packet size in use, including UDP/IP headers
+	RTT          time.Duration // estimated roundtrip time to the listener
+	RTTVar       time.Duration // variance of the roundtrip time
+	DeliveryRate uint          // rate the listener reported receiving packets at (packets/sec)
+	Bandwidth    uint          // link capacity the listener reported (packets/sec)
+}
+
+// Resume establishes an outbound UDT connection to the listener a previous connection's session was with, skipping
+// the listener's syn cookie exchange if it still accepts the session's token (and otherwise connecting as Dial does).
+// See function net.DialUDP for a description of net and laddr
+func (c *Config) Resume(ctx context.Context, network string, laddr string, session *Session) (net.Conn, error) {
+	return c.ResumeWithData(ctx, network, laddr, session, nil)
+}
+
+// Session returns what's needed to resume this connection later with Config.Resume, as of now.  The listener must
+// have Config.ResumptionLifetime set
+func (s *udtSocket) Session() (*Session, error) {
+	if s.resumeToken == nil {
+		return nil, ErrNoSession
+	}
+	rtt, rttVar := s.getRTT()
+	deliveryRate, bandwidth := s.getRcvSpeeds()
+	return &Session{
+		Addr:         s.raddr,
+		IsStream:     !s.isDatagram,
+		Token:        s.resumeToken,
+		Expires:      s.resumeExpires,
+		MTU:          uint(s.mtu.get()),
+		RTT:          time.Duration(rtt) * time.Microsecond,
+		RTTVar:       time.Duration(rttVar) * time.Microsecond,
+		DeliveryRate: deliveryRate,
+		Bandwidth:    bandwidth,
+	}, nil
+}
+
+// seedSession starts this connection from the measurements of an earlier one
+func (s *udtSocket) seedSession(rtt, rttVar time.Duration, deliveryRate, bandwidth uint) {
+	s.rtt.seed(rtt, rttVar)
+	s.receiveRateProt.Lock()
+	if deliveryRate > 0 {
+		s.deliveryRate = deliveryRate
+	}
+	if bandwidth > 0 {
+		s.bandwidth = bandwidth
+	}
+	s.receiveRateProt.Unlock()
+}
+
+// resumeExtension returns the resumption extension to add to a handshake we're sending, if any
+func (s *udtSocket) resumeExtension(reqType packet.HandshakeReqType) (packet.HandshakeExtension, bool) {
+	if s.isServer {
+		if s.resumeToken == nil || reqType != packet.HsResponse {
+			return packet.HandshakeExtension{}, false
+		}
+		data := make([]byte, 4, 4+len(s.resumeToken))
+		endianness.PutUint32(data, uint32(s.resumeExpires.Sub(s.clock.Now())/time.Second))
+		return packet.HandshakeExtension{Type: packet.HsExtResume, Data: append(data, s.resumeToken...)}, true
+	}
+	if s.resume == nil || (reqType != packet.HsRequest && reqType != packet.HsResponse) {
+		return packet.HandshakeExtension{}, false
+	}
+	rtt, rttVar := s.getRTT()
+	deliveryRate, bandwidth := s.getRcvSpeeds()
+	data := make([]byte, len(s.resume.Token)+resumeHintSize)
+	hint := data[copy(data, s.resume.Token):]
+	endianness.PutUint32(hint[0:], uint32(rtt))
+	endianness.PutUint32(hint[4:], uint32(rttVar))
+	endianness.PutUint32(hint[8:], uint32(deliveryRate))
+	endianness.PutUint32(hint[12:], uint32(bandwidth))
+	return packet.HandshakeExtension{Type: packet.HsExtResume, Data: data}, true
+}
+
+// readIssuedToken keeps the resumption token a listener issued us in its response handshake, if it did
+func (s *udtSocket) readIssuedToken(p *packet.HandshakePacket) {
+	ext, ok := p.Extension(packet.HsExtResume)
+	if !ok || len(ext) <= 4 {
+		return
+	}
+	s.resumeExpires = s.clock.Now().Add(time.Duration(endianness.Uint32(ext)) * time.Second)
+	s.resumeToken = append([]byte{}, ext[4:]...)
+}
+
+// resumeUse records which connection a token skipped the syn cookie exchange for
+type resumeUse struct {
+	key     pendingKey // the dialing socket and initial sequence number that used it
+	expires time.Time  // once the token has expired we needn't remember it
+}
+
+// resumeTokens issues and checks a listener's resumption tokens
+type resumeTokens struct {
+	lifetime time.Duration
+	secret   []byte
+	prot     sync.Mutex           // lock must be held before referencing used
+	used     map[uint64]resumeUse // tokens that have skipped the syn cookie exchange, by ID
+}
+
+// newResumeTokens returns the resumption tokens for a listener with the specified Config.ResumptionLifetime, or nil
+// if it doesn't issue any
+func newResumeTokens(lifetime time.Duration) *resumeTokens {
+	if lifetime <= 0 {
+		return nil
+	}
+	return &resumeTokens{lifetime: lifetime, secret: newSynSecret(), used: make(map[uint64]resumeUse)}
+}
+
+// issue returns a new token for a connection of the specified type
+func (r *resumeTokens) issue(sockType packet.SocketType, now time.Time) []byte {
+	if r == nil {
+		return nil
+	}
+	token := make([]byte, resumeTokenSize)
+	if _, err := rand.Read(token[:resumeTokenIDSize]); err != nil {
+		log.Fatalf("Unable to generate resumption token: %s", err)
+	}
+	endianness.PutUint64(token[resumeTokenIDSize:], uint64(now.Add(r.lifetime).UnixNano()))
+	token[resumeTokenIDSize+8] = byte(sockType)
+	copy(token[resumeTokenSize-resumeTokenMACSize:], r.mac(token))
+	return token
+}
+
+// mac returns the HMAC authenticating a token
+func (r *resumeTokens) mac(token []byte) []byte {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte("udt-resume"))
+	mac.Write(token[:resumeTokenSize-resumeTokenMACSize])
+	return mac.Sum(nil)[:resumeTokenMACSize]
+}
+
+// check returns the ID and expiry of the token presented by a dialing side's handshake and the measurements that
+// follow it, if it's one of ours that hasn't expired
+func (r *resumeTokens) check(p *packet.HandshakePacket, now time.Time) (id uint64, expires time.Time, hint []byte, ok bool) {
+	if r == nil {
+		return 0, time.Time{}, nil, false
+	}
+	ext, found := p.Extension(packet.HsExtResume)
+	if !found || len(ext) != resumeTokenSize+resumeHintSize {
+		return 0, time.Time{}, nil, false
+	}
+	token := ext[:resumeTokenSize]
+	expires = time.Unix(0, int64(endianness.Uint64(token[resumeTokenIDSize:])))
+	if !hmac.Equal(token[resumeTokenSize-resumeTokenMACSize:], r.mac(token)) ||
+		packet.SocketType(token[resumeTokenIDSize+8]) != p.SockType || now.After(expires) {
+		return 0, time.Time{}, nil, false
+	}
+	return endianness.Uint64(token), expires, ext[resumeTokenSize:], true
+}
+
+// admit returns true if a dialing side's first handshake may skip the syn cookie exchange: it presents a valid token
+// that hasn't already been used by any other connection.  repeat is set if it's a repeat of the handshake that first
+// used the token, which only the connection that handshake created may answer (as a new connection would deliver any
+// early data it carries again)
+func (r *resumeTokens) admit(p *packet.HandshakePacket, now time.Time) (ok bool, repeat bool) {
+	id, expires, _, ok := r.check(p, now)
+	if !ok {
+		return false, false
+	}
+	key := pendingKey{sockID: p.SockID, initSeqNo: p.InitPktSeq}
+	r.prot.Lock()
+	defer r.prot.Unlock()
+	if use, found := r.used[id]; found {
+		return use.key == key, use.key == key
+	}
+	r.used[id] = resumeUse{key: key, expires: expires}
+	return true, false
+}
+
+// prune forgets used tokens that have since expired
+func (r *resumeTokens) prune(now time.Time) {
+	if r == nil {
+		return
+	}
+	r.prot.Lock()
+	defer r.prot.Unlock()
+	for id, use := range r.used {
+		if now.After(use.expires) {
+			delete(r.used, id)
+		}
+	}
+}
+
+// restore starts a connection we're accepting from the measurements in the session it presented (if any), and gives
+// it a new token to pass back.  Returns true if it presented a valid session
+func (r *resumeTokens) restore(s *udtSocket, p *packet.HandshakePacket, now time.Time) bool {
+	if r == nil {
+		return false
+	}
+	_, _, hint, ok := r.check(p, now)
+	if ok {
+		s.seedSession(time.Duration(endianness.Uint32(hint[0:]))*time.Microsecond,
+			time.Duration(endianness.Uint32(hint[4:]))*time.Microsecond,
+			uint(endianness.Uint32(hint[8:])), uint(endianness.Uint32(hint[12:])))
+	}
+	s.resumeToken = r.issue(p.SockType, now)
+	s.resumeExpires = now.Add(r.lifetime)
+	return ok
+}
@@ -0,0 +1,111 @@
+package udt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// acceptOne accepts a single connection from l in the background
+func acceptOne(l net.Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	return accepted
+}
+
+// echoOnce checks that data written to client arrives at server
+func echoOnce(t *testing.T, client, server net.Conn, msg string) {
+	t.Helper()
+	if _, err := client.Write([]byte(msg)); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	if !bytes.Equal(buf, []byte(msg)) {
+		t.Fatalf("read %q, expected %q", buf, msg)
+	}
+}
+
+func TestSessionResumption(t *testing.T) {
+	config := DefaultConfig()
+	config.ResumptionLifetime = time.Hour
+	l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+103))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+
+	accepted := acceptOne(l)
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+104), l.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	echoOnce(t, client, server, "hello")
+	session, err := client.(Conn).Session()
+	if err != nil {
+		t.Fatalf("error getting session: %s", err.Error())
+	}
+	if !session.IsStream || session.Addr.String() != l.Addr().String() || session.Expires.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("unexpected session %+v", session)
+	}
+	client.Close()
+	server.Close()
+
+	// resuming from another address (as a mobile client might after changing networks) skips the cookie exchange and
+	// starts from the earlier connection's measurements
+	session.RTT = 40 * time.Millisecond
+	session.RTTVar = 10 * time.Millisecond
+	accepted = acceptOne(l)
+	client, err = DefaultConfig().Resume(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+105), session)
+	if err != nil {
+		t.Fatalf("error resuming: %s", err.Error())
+	}
+	defer client.Close()
+	server = <-accepted
+	defer server.Close()
+	if n := l.(Listener).MuxStats().HandshakeResumed; n != 1 {
+		t.Errorf("expected one resumed handshake, counted %d", n)
+	}
+	if rtt, _ := server.(*udtSocket).getRTT(); rtt != 40000 {
+		t.Errorf("expected the accepted connection to start from a 40ms RTT, got %dus", rtt)
+	}
+	echoOnce(t, client, server, "hello again")
+	next, err := client.(Conn).Session()
+	if err != nil || bytes.Equal(next.Token, session.Token) {
+		t.Errorf("expected a new token for the resumed connection, got %v (%v)", next, err)
+	}
+
+	// a token only skips the cookie exchange once, after which it connects as any other dial would
+	accepted = acceptOne(l)
+	again, err := DefaultConfig().Resume(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+106), session)
+	if err != nil {
+		t.Fatalf("error resuming: %s", err.Error())
+	}
+	defer again.Close()
+	server = <-accepted
+	defer server.Close()
+	echoOnce(t, again, server, "and again")
+	if n := l.(Listener).MuxStats().HandshakeResumed; n != 1 {
+		t.Errorf("expected a reused token not to be resumed, counted %d resumed handshakes", n)
+	}
+}
+
+func TestSessionNotIssued(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, err := a.(Conn).Session(); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected no session from a listener not issuing tokens, got %v", err)
+	}
+}
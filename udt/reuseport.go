@@ -0,0 +1,27 @@
+package udt
+
+import "net"
+
+/*
+At high packet rates a single goroutine reading a single UDP socket becomes the bottleneck on a multi-core machine.
+Config.ReusePortSockets opens several sockets on the same local address with SO_REUSEPORT, and the kernel spreads
+the incoming datagrams across them (by hashing each sender's address, so a connection's packets generally stay on the
+same socket).  Each socket has its own read goroutine, and all of them hand their packets to the same multiplexer,
+which routes them by socket ID as usual.  Everything is still sent from the first socket, as sending is already done
+by a single goroutine.
+*/
+
+// udpReaders returns the UDP sockets this multiplexer reads from, if it's using UDP sockets
+func (m *multiplexer) udpReaders() []*net.UDPConn {
+	uc, ok := m.conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	conns := []*net.UDPConn{uc}
+	for _, reader := range m.readers {
+		if uc, ok := reader.(*net.UDPConn); ok {
+			conns = append(conns, uc)
+		}
+	}
+	return conns
+}
@@ -0,0 +1,18 @@
+package udt
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define for Linux
+const soReusePort = 0xf
+
+// enableReusePort lets other sockets bind to the same address as c, with the kernel spreading datagrams between them
+func enableReusePort(c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
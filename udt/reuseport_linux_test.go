@@ -0,0 +1,28 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestReusePortSockets(t *testing.T) {
+	config := DefaultConfig()
+	config.ReusePortSockets = 4
+	l, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+72))
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	if readers := len(l.(*listener).m.readers); readers != 3 {
+		t.Fatalf("expected 3 additional reader sockets, got %d", readers)
+	}
+	if conns := len(l.(*listener).m.udpReaders()); conns != 4 {
+		t.Errorf("expected to be reading from 4 sockets, got %d", conns)
+	}
+
+	// connections from different addresses (likely landing on different sockets) all reach the listener
+	for i := 72; i < 74; i++ {
+		checkListening(t, l, fmt.Sprintf("127.0.0.1:%d", clientPort+i))
+	}
+}
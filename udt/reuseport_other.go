@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import (
+	"errors"
+	"syscall"
+)
+
+// enableReusePort lets other sockets bind to the same address as c, with the kernel spreading datagrams between them
+func enableReusePort(c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT receive scaling is not supported on this platform")
+}
@@ -0,0 +1,350 @@
+package udt
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// newTestSender creates the sending side of a datagram socket that isn't connected to anything, with the packets it
+// sends placed on the returned channel
+func newTestSender(config *Config) (*udtSocketSend, chan packet.Packet) {
+	sendPacket := make(chan packet.Packet, 16)
+	s := &udtSocket{Config: config, clock: newManualClock(), isDatagram: true, m: &multiplexer{}, routines: newRoutineGroup()}
+	ss := &udtSocketSend{
+		socket:         s,
+		sendPacket:     sendPacket,
+		sendFeedback:   sendPacket,
+		congestWindow:  atomicUint32{val: 16},
+		flowWindowSize: 16,
+	}
+	return ss, sendPacket
+}
+
+// sendTestMessage sends a single-packet message, returning its packet
+func sendTestMessage(ss *udtSocketSend, msgNo uint32, ttl time.Duration) *packet.DataPacket {
+	dp := &packet.DataPacket{Seq: ss.sendPktSeq, Data: []byte("hello")}
+	dp.SetMessageData(packet.MbOnly, false, msgNo)
+	ss.sendPktSeq.Incr()
+	entry := sendPacketEntry{pkt: dp, tim: ss.socket.clock.Now(), ttl: ttl}
+	ss.sendPktPend = append(ss.sendPktPend, entry)
+	return dp
+}
+
+// reportLost places a packet in the sender's loss list
+func reportLost(ss *udtSocketSend, pktID packet.PacketID) {
+	ss.sendLossList = append(ss.sendLossList, pktID)
+}
+
+func TestMaxRexmitAttempts(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxRexmitAttempts = 2
+	ss, sent := newTestSender(config)
+	dp := sendTestMessage(ss, 1, 0)
+
+	// the packet is retransmitted as many times as we permit
+	for i := 0; i < 2; i++ {
+		reportLost(ss, dp.Seq)
+		if !ss.processSendLoss() {
+			t.Fatalf("retransmission %d wasn't sent", i+1)
+		}
+		if p, ok := (<-sent).(*packet.DataPacket); !ok || p.Seq != dp.Seq {
+			t.Fatalf("expected retransmission of packet %d, got %v", dp.Seq.Seq, p)
+		}
+	}
+
+	// after which we give up on the message and tell our peer not to wait for it
+	reportLost(ss, dp.Seq)
+	if ss.processSendLoss() {
+		t.Error("packet was retransmitted too many times")
+	}
+	select {
+	case p := <-sent:
+		drop, ok := p.(*packet.MsgDropReqPacket)
+		if !ok || drop.MsgID != 1 || drop.FirstSeq != dp.Seq || drop.LastSeq != dp.Seq {
+			t.Errorf("expected a drop request for message 1, got %v", p)
+		}
+	default:
+		t.Error("no drop request was sent")
+	}
+}
+
+func TestMessageTTL(t *testing.T) {
+	ss, sent := newTestSender(DefaultConfig())
+	dp := sendTestMessage(ss, 1, time.Second)
+
+	// a message still within its time to live is retransmitted
+	ss.socket.clock.(*manualClock).advance(500 * time.Millisecond)
+	if ss.processSendExpire() {
+		t.Error("message expired before its time to live")
+	}
+	reportLost(ss, dp.Seq)
+	if !ss.processSendLoss() {
+		t.Fatal("retransmission wasn't sent")
+	}
+	<-sent
+
+	// and dropped once it's expired
+	ss.socket.clock.(*manualClock).advance(time.Second)
+	if !ss.processSendExpire() {
+		t.Fatal("message didn't expire")
+	}
+	if _, ok := (<-sent).(*packet.MsgDropReqPacket); !ok {
+		t.Error("expected a drop request for the expired message")
+	}
+}
+
+func TestLightAckRelease(t *testing.T) {
+	ss, _ := newTestSender(DefaultConfig())
+	first := sendTestMessage(ss, 1, 0)
+	second := sendTestMessage(ss, 2, 0)
+	reportLost(ss, first.Seq)
+
+	// a light ACK releases what it acknowledges, just as a full one does
+	ss.ingestLightAck(&packet.LightAckPacket{PktSeqHi: second.Seq}, ss.socket.clock.Now())
+	if len(ss.sendPktPend) != 1 || ss.sendPktPend[0].pkt.Seq != second.Seq {
+		t.Fatalf("expected only packet %d to be waiting for an ACK, got %d packets", second.Seq.Seq, len(ss.sendPktPend))
+	}
+	if ss.sendLossList != nil {
+		t.Errorf("expected the acknowledged packet to be removed from the loss list")
+	}
+
+	ss.ingestLightAck(&packet.LightAckPacket{PktSeqHi: second.Seq.Add(1)}, ss.socket.clock.Now())
+	if ss.sendPktPend != nil {
+		t.Errorf("expected nothing to be waiting for an ACK, got %d packets", len(ss.sendPktPend))
+	}
+}
+
+func TestSendDrained(t *testing.T) {
+	ss, _ := newTestSender(DefaultConfig())
+	if !ss.drained() {
+		t.Fatal("expected a sender with nothing to send to be drained")
+	}
+
+	// a closed connection keeps going while anything is unsent or unacknowledged
+	dp := sendTestMessage(ss, 1, 0)
+	ss.msgPartialSend = &sendMessage{content: []byte("rest")}
+	if ss.drained() {
+		t.Fatal("expected a sender with part of a message unsent not to be drained")
+	}
+	ss.msgPartialSend = nil
+	if ss.drained() {
+		t.Fatal("expected a sender with a packet waiting for an ACK not to be drained")
+	}
+	ss.ingestLightAck(&packet.LightAckPacket{PktSeqHi: dp.Seq.Add(1)}, ss.socket.clock.Now())
+	if !ss.drained() {
+		t.Error("expected the sender to be drained once everything was acknowledged")
+	}
+}
+
+func TestRetransmitPacing(t *testing.T) {
+	ss, sent := newTestSender(DefaultConfig())
+	ss.socket.cong = &udtSocketCc{socket: ss.socket, msgs: make(chan congMsg, 256)}
+	clock := ss.socket.clock.(*manualClock)
+	snd := 10 * time.Millisecond
+	ss.sndPeriod.set(snd)
+	ss.sendPktSeq = packet.PacketID{Seq: 1} // (packet 16n is sent back-to-back with the next, see sendDataPacket)
+	sendNew := func() *packet.DataPacket {
+		dp := &packet.DataPacket{Seq: ss.sendPktSeq, Data: []byte("hello")}
+		dp.SetMessageData(packet.MbOnly, false, dp.Seq.Seq)
+		ss.sendPktSeq.Incr()
+		ss.sendDataPacket(sendPacketEntry{pkt: dp, tim: clock.Now()}, false)
+		return dp
+	}
+
+	// a new packet waits out the pacing interval before anything else is sent
+	first := sendNew()
+	<-sent
+	if ss.sendState != sendStateSending {
+		t.Fatalf("expected to wait for the pacing interval after sending, state %d", ss.sendState)
+	}
+	reportLost(ss, first.Seq)
+	expectTimer(t, clock, ss.sndEvent, snd)
+	ss.sndEvent = nil
+	ss.sendState = ss.reevalSendState()
+
+	// as does its retransmission, rather than bursting the loss list
+	second := sendNew()
+	<-sent
+	reportLost(ss, second.Seq)
+	expectTimer(t, clock, ss.sndEvent, snd)
+	ss.sndEvent = nil
+	for _, lost := range []*packet.DataPacket{first, second} {
+		if ss.sendState = ss.reevalSendState(); ss.sendState != sendStateIdle {
+			t.Fatalf("expected to be free to send once the pacing interval passed, state %d", ss.sendState)
+		}
+		if !ss.processSendLoss() {
+			t.Fatalf("expected packet %d to be retransmitted", lost.Seq.Seq)
+		}
+		if p, ok := (<-sent).(*packet.DataPacket); !ok || p.Seq != lost.Seq {
+			t.Fatalf("expected a retransmission of packet %d, got %v", lost.Seq.Seq, p)
+		}
+		if ss.sendState != sendStateSending {
+			t.Fatalf("expected to wait for the pacing interval after a retransmission, state %d", ss.sendState)
+		}
+		expectTimer(t, clock, ss.sndEvent, snd)
+		ss.sndEvent = nil
+	}
+}
+
+// dropOnceConn is a PacketConn that silently drops the first packet it's asked to send larger than a given size
+type dropOnceConn struct {
+	net.PacketConn
+	limit   int
+	dropped int32
+}
+
+func (c *dropOnceConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if len(b) > c.limit && atomic.CompareAndSwapInt32(&c.dropped, 0, 1) {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestRetransmitStats(t *testing.T) {
+	a, b := newPipeConns()
+	conn := &dropOnceConn{PacketConn: b, limit: 100}
+	servMx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(conn, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), false)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := (<-accepted).(Conn)
+	defer server.Close()
+
+	// the first message is lost, the peer reports it when the second arrives, and it's sent again
+	msg := bytes.Repeat([]byte("x"), 1000)
+	for i := 0; i < 2; i++ {
+		if _, err := client.Write(msg); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := server.ReadMessage(); err != nil {
+			t.Fatalf("error reading: %s", err.Error())
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	stats := client.(Conn).Stats()
+	for stats.PktLossList != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		stats = client.(Conn).Stats()
+	}
+	if stats.PktSent != 3 || stats.PktRetrans != 1 || stats.PktSndLoss != 1 || stats.PktLossList != 0 {
+		t.Errorf("expected 3 packets sent, 1 retransmitted, 1 reported lost and none waiting, got %d, %d, %d and %d",
+			stats.PktSent, stats.PktRetrans, stats.PktSndLoss, stats.PktLossList)
+	}
+}
+
+// lostSeqs returns the sequence numbers in the sender's loss list, in order
+func lostSeqs(ss *udtSocketSend) []uint32 {
+	h := append(packetIDHeap{}, ss.sendLossList...)
+	var seqs []uint32
+	for len(h) > 0 {
+		seqs = append(seqs, heap.Pop(&h).(packet.PacketID).Seq)
+	}
+	return seqs
+}
+
+func TestNakRange(t *testing.T) {
+	tests := []struct {
+		first   uint32   // sequence number of the first packet we send
+		lossInf []uint32 // the loss information in the NAK
+		expect  []uint32 // what ends up in the loss list
+	}{
+		{0, []uint32{1 | 0x80000000, 3}, []uint32{1, 2, 3}},
+		{0, []uint32{1 | 0x80000000, 2, 4}, []uint32{1, 2, 4}},
+		{0x7FFFFFFE, []uint32{0x7FFFFFFF | 0x80000000, 0}, []uint32{0x7FFFFFFF, 0}},
+		{0x7FFFFFFE, []uint32{0x7FFFFFFE | 0x80000000, 1}, []uint32{0x7FFFFFFE, 0x7FFFFFFF, 0, 1}},
+	}
+	for _, test := range tests {
+		ss, _ := newTestSender(DefaultConfig())
+		ss.socket.cong = &udtSocketCc{socket: ss.socket, msgs: make(chan congMsg, 256)}
+		ss.sendPktSeq = packet.PacketID{Seq: test.first}
+		ss.recvAckSeq = ss.sendPktSeq
+		for i := uint32(0); i < 5; i++ {
+			sendTestMessage(ss, i, 0)
+		}
+
+		// a range in a NAK includes the packet that ends it
+		ss.ingestNak(&packet.NakPacket{CmpLossInfo: test.lossInf}, ss.socket.clock.Now())
+		if got := lostSeqs(ss); fmt.Sprint(got) != fmt.Sprint(test.expect) {
+			t.Errorf("expected a NAK of %#x to report %#x lost, got %#x", test.lossInf, test.expect, got)
+		}
+	}
+}
+
+func TestEXPLossRange(t *testing.T) {
+	for _, first := range []uint32{100, 0x7FFFFFFE} {
+		ss, _ := newTestSender(DefaultConfig())
+		ss.socket.cong = &udtSocketCc{socket: ss.socket, msgs: make(chan congMsg, 256)}
+		ss.sendPktSeq = packet.PacketID{Seq: first}
+		ss.recvAckSeq = ss.sendPktSeq
+		var expect []uint32
+		for i := uint32(0); i < 3; i++ {
+			expect = append(expect, sendTestMessage(ss, i, 0).Seq.Seq)
+		}
+
+		// a timeout resends everything unacknowledged: from the first packet not yet acknowledged to the last sent
+		ss.expEvent(ss.socket.clock.Now())
+		if got := lostSeqs(ss); fmt.Sprint(got) != fmt.Sprint(expect) {
+			t.Errorf("expected a timeout to report %#x lost, got %#x", expect, got)
+		}
+	}
+}
+
+func TestMessageDropRange(t *testing.T) {
+	ss, sent := newTestSender(DefaultConfig())
+	ss.sendPktSeq = packet.PacketID{Seq: 0x7FFFFFFE}
+	ss.recvAckSeq = ss.sendPktSeq
+	var pieces []packet.PacketID
+	for _, boundary := range []packet.MessageBoundary{packet.MbFirst, packet.MbMiddle, packet.MbLast} {
+		dp := &packet.DataPacket{Seq: ss.sendPktSeq, Data: []byte("hello")}
+		dp.SetMessageData(boundary, false, 7)
+		ss.sendPktSeq.Incr()
+		ss.sendPktPend = append(ss.sendPktPend, sendPacketEntry{pkt: dp, tim: ss.socket.clock.Now(), ttl: time.Second})
+		pieces = append(pieces, dp.Seq)
+	}
+	other := sendTestMessage(ss, 8, 0)
+	heap.Init(&ss.sendPktPend)
+	for _, seq := range append(pieces, other.Seq) {
+		reportLost(ss, seq)
+	}
+	heap.Init(&ss.sendLossList)
+
+	// an expired message is dropped as a whole (across the wrap), and none of it is retransmitted
+	ss.socket.clock.(*manualClock).advance(2 * time.Second)
+	if !ss.processSendExpire() {
+		t.Fatal("expected the message to expire")
+	}
+	drop, ok := (<-sent).(*packet.MsgDropReqPacket)
+	if !ok || drop.MsgID != 7 || drop.FirstSeq != pieces[0] || drop.LastSeq != pieces[2] {
+		t.Fatalf("expected a drop request for message 7 from %#x to %#x, got %v", pieces[0].Seq, pieces[2].Seq, drop)
+	}
+	if got := lostSeqs(ss); len(got) != 1 || got[0] != other.Seq.Seq {
+		t.Errorf("expected only packet %#x to be left to retransmit, got %#x", other.Seq.Seq, got)
+	}
+}
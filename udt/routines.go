@@ -0,0 +1,48 @@
+package udt
+
+import (
+	"sync"
+)
+
+// routineGroup tracks the goroutines belonging to a socket, so we can tell once every one of them has exited after
+// the socket is closed
+type routineGroup struct {
+	prot   sync.Mutex // lock must be held before referencing closed, or adding to wg
+	wg     sync.WaitGroup
+	closed bool
+	done   chan struct{} // closed once we've been closed and every goroutine has exited
+}
+
+func newRoutineGroup() *routineGroup {
+	return &routineGroup{done: make(chan struct{})}
+}
+
+// goRun runs f on a goroutine of its own, unless we've been closed (as nothing should be starting by then), returning
+// whether it was started
+func (g *routineGroup) goRun(f func()) bool {
+	g.prot.Lock()
+	defer g.prot.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f()
+	}()
+	return true
+}
+
+// close stops any more goroutines from being started, closing done once those already running have exited
+func (g *routineGroup) close() {
+	g.prot.Lock()
+	defer g.prot.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	go func() {
+		g.wg.Wait()
+		close(g.done)
+	}()
+}
@@ -0,0 +1,32 @@
+package udt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSocketRoutinesExit(t *testing.T) {
+	for _, eventLoop := range []bool{false, true} {
+		config := DefaultConfig()
+		config.LingerTime = 50 * time.Millisecond
+		config.EventLoop = eventLoop
+		a, b := config.Pipe()
+		if _, err := b.Write([]byte("hello")); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+		buf := make([]byte, 16)
+		if _, err := a.Read(buf); err != nil {
+			t.Fatalf("error reading: %s", err.Error())
+		}
+		a.Close()
+		b.Close()
+
+		for _, conn := range []interface{}{a, b} {
+			select {
+			case <-conn.(*udtSocket).routines.done:
+			case <-time.After(5 * time.Second):
+				t.Errorf("eventLoop=%t: goroutines still running after the connection closed", eventLoop)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package udt
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	initialRTT    = 100 * time.Millisecond // roundtrip time assumed before we've taken any measurements (per the UDT spec)
+	initialRTTVar = initialRTT / 2         // roundtrip variance assumed before we've taken any measurements
+	minRTTSample  = time.Microsecond       // measurements are clamped to this range, anything outside of it is bogus
+	maxRTTSample  = 10 * time.Second
+
+	rttOutlierFactor = 8 // a measurement more than this many times the smoothed RTT (plus SYN) is treated as an outlier
+	rttOutlierLimit  = 3 // ...unless we've seen this many in a row, in which case the path itself has likely changed
+)
+
+// rttEstimator tracks the smoothed roundtrip time to our peer and its variance, in microseconds
+type rttEstimator struct {
+	prot     sync.RWMutex // lock must be held before referencing any other members
+	rtt      uint         // smoothed roundtrip time
+	rttVar   uint         // roundtrip variance
+	sampled  bool         // whether we've received any measurements (until then rtt/rttVar are initial guesses)
+	outliers uint         // number of consecutive measurements rejected as outliers
+}
+
+func newRTTEstimator() *rttEstimator {
+	return &rttEstimator{
+		rtt:    uint(initialRTT / time.Microsecond),
+		rttVar: uint(initialRTTVar / time.Microsecond),
+	}
+}
+
+func clampRTT(rtt time.Duration) uint {
+	if rtt < minRTTSample {
+		rtt = minRTTSample
+	} else if rtt > maxRTTSample {
+		rtt = maxRTTSample
+	}
+	return uint(rtt / time.Microsecond)
+}
+
+// applySample folds a measured roundtrip time (from an ACK/ACK2 exchange) into the estimate, returning false if the
+// measurement was rejected as an outlier
+func (e *rttEstimator) applySample(sample time.Duration) bool {
+	rtt := clampRTT(sample)
+	e.prot.Lock()
+	defer e.prot.Unlock()
+
+	if !e.sampled {
+		// our first measurement replaces the initial guess rather than being blended into it
+		e.sampled = true
+		e.rtt = rtt
+		e.rttVar = rtt / 2
+		return true
+	}
+
+	if rtt > e.rtt*rttOutlierFactor+uint(synTime/time.Microsecond) {
+		e.outliers++
+		if e.outliers < rttOutlierLimit {
+			return false
+		}
+	}
+	e.outliers = 0
+	e.blend(rtt)
+	return true
+}
+
+// seed replaces the initial guesses with an estimate carried over from an earlier connection to the same peer, which
+// (like the initial guesses) our first measurement replaces outright
+func (e *rttEstimator) seed(rtt, rttVar time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	e.prot.Lock()
+	if !e.sampled {
+		e.rtt = clampRTT(rtt)
+		e.rttVar = clampRTT(rttVar)
+	}
+	e.prot.Unlock()
+}
+
+// applyPeer folds in the smoothed roundtrip time reported by our peer in an ACK, returning false if it had none
+func (e *rttEstimator) applyPeer(rtt uint) bool {
+	if rtt == 0 {
+		return false // the peer hasn't got an estimate either
+	}
+	rtt = clampRTT(time.Duration(rtt) * time.Microsecond)
+	e.prot.Lock()
+	e.blend(rtt)
+	e.prot.Unlock()
+	return true
+}
+
+// blend adds a value into our moving averages.  e.prot must be held
+func (e *rttEstimator) blend(rtt uint) {
+	e.rttVar = (e.rttVar*3 + absdiff(e.rtt, rtt)) >> 2
+	e.rtt = (e.rtt*7 + rtt) >> 3
+}
+
+func (e *rttEstimator) get() (rtt, rttVar uint) {
+	e.prot.RLock()
+	rtt = e.rtt
+	rttVar = e.rttVar
+	e.prot.RUnlock()
+	return
+}
@@ -0,0 +1,137 @@
+package udt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRTTConvergence(t *testing.T) {
+	e := newRTTEstimator()
+	if rtt, _ := e.get(); rtt != uint(initialRTT/time.Microsecond) {
+		t.Errorf("expected an initial estimate of %v, got %dus", initialRTT, rtt)
+	}
+
+	// the first measurement replaces the initial guess
+	e.applySample(20 * time.Millisecond)
+	if rtt, rttVar := e.get(); rtt != 20000 || rttVar != 10000 {
+		t.Errorf("expected the first sample to be taken as-is, got %dus (var %dus)", rtt, rttVar)
+	}
+
+	// a change in the path's latency should be followed
+	for i := 0; i < 50; i++ {
+		e.applySample(50 * time.Millisecond)
+	}
+	rtt, rttVar := e.get()
+	if rtt < 49000 || rtt > 51000 {
+		t.Errorf("expected the estimate to converge on 50ms, got %dus", rtt)
+	}
+	if rttVar > 1000 {
+		t.Errorf("expected the variance to settle, got %dus", rttVar)
+	}
+}
+
+func TestRTTClamping(t *testing.T) {
+	e := newRTTEstimator()
+	e.applySample(0)
+	if rtt, _ := e.get(); rtt != uint(minRTTSample/time.Microsecond) {
+		t.Errorf("expected a zero sample to be clamped to %v, got %dus", minRTTSample, rtt)
+	}
+
+	e = newRTTEstimator()
+	e.applySample(time.Hour)
+	if rtt, _ := e.get(); rtt != uint(maxRTTSample/time.Microsecond) {
+		t.Errorf("expected a huge sample to be clamped to %v, got %dus", maxRTTSample, rtt)
+	}
+
+	e = newRTTEstimator()
+	e.applyPeer(0)
+	if rtt, _ := e.get(); rtt != uint(initialRTT/time.Microsecond) {
+		t.Errorf("expected an empty report from the peer to be ignored, got %dus", rtt)
+	}
+}
+
+func TestRTTOutliers(t *testing.T) {
+	e := newRTTEstimator()
+	for i := 0; i < 20; i++ {
+		e.applySample(10 * time.Millisecond)
+	}
+	steady, _ := e.get()
+
+	// an isolated spike is discarded
+	if e.applySample(time.Second) {
+		t.Error("expected an isolated spike to be rejected")
+	}
+	e.applySample(10 * time.Millisecond)
+	if rtt, _ := e.get(); rtt != steady {
+		t.Errorf("expected the estimate to be unaffected by a spike, got %dus (was %dus)", rtt, steady)
+	}
+
+	// but a sustained change is eventually accepted
+	accepted := false
+	for i := 0; i < rttOutlierLimit; i++ {
+		accepted = e.applySample(time.Second)
+	}
+	if !accepted {
+		t.Errorf("expected the estimate to follow %d consecutive high samples", rttOutlierLimit)
+	}
+	if rtt, _ := e.get(); rtt <= steady {
+		t.Errorf("expected the estimate to rise, got %dus", rtt)
+	}
+}
+
+func TestRTTMeasured(t *testing.T) {
+	t.Log("Testing roundtrip measurement through ACK/ACK2.")
+
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+8))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		newSock, err := serv.Accept()
+		if err != nil {
+			t.Errorf("error calling Accept: %s", err.Error())
+		}
+		accepted <- newSock
+	}()
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+9), serv.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// the receiver measures the roundtrip from its ACKs being answered by ACK2s
+	buf := make([]byte, 1024)
+	for i := 0; i < 20; i++ {
+		if _, err = client.Write(make([]byte, len(buf))); err != nil {
+			t.Fatalf("error calling Write: %s", err.Error())
+		}
+		if _, err = server.Read(buf); err != nil {
+			t.Fatalf("error calling Read: %s", err.Error())
+		}
+		time.Sleep(2 * synTime)
+	}
+
+	est := server.(*udtSocket).rtt
+	est.prot.RLock()
+	sampled := est.sampled
+	est.prot.RUnlock()
+	if !sampled {
+		t.Fatal("no roundtrip measurements were taken")
+	}
+	if rtt, _ := est.get(); rtt >= uint(initialRTT/time.Microsecond) {
+		t.Errorf("expected a loopback roundtrip well under %v, got %dus", initialRTT, rtt)
+	}
+	if stats := server.(Conn).Stats(); stats.RTT <= 0 || stats.RTT >= initialRTT {
+		t.Errorf("expected Stats to report the measured roundtrip, got %v", stats.RTT)
+	}
+}
@@ -0,0 +1,239 @@
+package udt
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+const sendQueueSize = 100 // number of packets a single socket may have waiting in a multiplexer before it blocks
+
+/*
+Every socket sharing a multiplexer has its own queue of packets waiting to be written out, so a socket sending as fast
+as it can only ever fills (and blocks on) its own queue.  The multiplexer's write loop takes packets from the queues
+with the highest Config.Priority first, taking turns (one packet at a time) between queues of the same priority.
+Packets sent by the multiplexer itself (such as handshake responses from a listener) have a queue of their own at the
+default priority.
+
+Within a socket's queue, the feedback it sends about what it has received (ACKs, NAKs, ACK2s and keep-alives) is kept
+apart from the data it's sending, and goes first.  Both directions of a connection share this queue, so if feedback
+had to wait in line behind data (or for space behind a full queue of it) a socket saturating one direction would
+starve the other: its peer would stop hearing ACKs and NAKs, shrink its own sending to match, and retransmit packets
+that had in fact arrived.  Feedback is small and infrequent next to the data it describes, so can't starve it in turn.
+(The socket keeps feedback apart on its way here too, see udtSocket.sendFeedback.)
+
+Rate limits (Config.MaxBandwidth for a socket, Config.LocalMaxBandwidth for everything sharing a multiplexer) are
+enforced here as well, regardless of what congestion control would permit.  A socket held back by its own limit is
+passed over in favor of the next queue in line.
+*/
+
+// sendLane holds packets of one kind waiting to be written out for a single socket
+type sendLane struct {
+	pkts  []packetWrapper // packets waiting to be sent, in order
+	space chan struct{}   // signaled whenever a packet is taken from this lane
+}
+
+// sendQueue holds the packets waiting to be written out for a single socket
+type sendQueue struct {
+	sock     *udtSocket // the socket these packets came from (nil for the multiplexer itself)
+	priority int        // copied from the socket's Config.Priority
+	data     sendLane   // data (and everything else that isn't feedback) waiting to be sent
+	feedback sendLane   // feedback packets waiting to be sent (ahead of any data)
+}
+
+// sendLevel is the set of queues with packets waiting at a single priority
+type sendLevel struct {
+	priority int
+	queues   []*sendQueue // queues with packets waiting, in the order they will be served
+}
+
+// sendScheduler decides which of the packets waiting in a multiplexer is written out next
+type sendScheduler struct {
+	prot   sync.Mutex                // lock must be held before referencing any other members
+	queues map[*udtSocket]*sendQueue // every queue with packets waiting (or a sender waiting for space)
+	levels []*sendLevel              // levels with packets waiting, highest priority first
+	limit  *tokenBucket              // if set, limits the rate of everything sent by this multiplexer
+	wake   chan struct{}             // signaled whenever a packet is queued
+}
+
+func newSendScheduler() *sendScheduler {
+	return &sendScheduler{
+		queues: make(map[*udtSocket]*sendQueue),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// queueFor returns the queue for packets from the specified socket, creating it if needed.  sched.prot must be held
+func (sched *sendScheduler) queueFor(s *udtSocket) *sendQueue {
+	q := sched.queues[s]
+	if q == nil {
+		q = &sendQueue{
+			sock:     s,
+			data:     sendLane{space: make(chan struct{}, 1)},
+			feedback: sendLane{space: make(chan struct{}, 1)},
+		}
+		if s != nil {
+			q.priority = s.Config.Priority
+		}
+		sched.queues[s] = q
+	}
+	return q
+}
+
+// isFeedback returns true for the packets a socket sends to acknowledge or report on what it has received (or to keep
+// the connection alive), which are sent ahead of any data it has waiting
+func isFeedback(p packet.Packet) bool {
+	switch p.(type) {
+	case *packet.AckPacket, *packet.LightAckPacket, *packet.NakPacket, *packet.Ack2Packet, *packet.KeepAlivePacket:
+		return true
+	default:
+		return false
+	}
+}
+
+// lane returns which of this queue's lanes a packet waits in
+func (q *sendQueue) lane(p packet.Packet) *sendLane {
+	if isFeedback(p) {
+		return &q.feedback
+	}
+	return &q.data
+}
+
+// empty returns true if nothing is waiting in either of this queue's lanes
+func (q *sendQueue) empty() bool {
+	return len(q.data.pkts) == 0 && len(q.feedback.pkts) == 0
+}
+
+// next takes the next packet to be sent from this queue, feedback first
+func (q *sendQueue) next() packetWrapper {
+	lane := &q.data
+	if len(q.feedback.pkts) > 0 {
+		lane = &q.feedback
+	}
+	pw := lane.pkts[0]
+	lane.pkts[0] = packetWrapper{}
+	lane.pkts = lane.pkts[1:]
+	select {
+	case lane.space <- struct{}{}:
+	default:
+	}
+	return pw
+}
+
+// activate places a queue that now has packets waiting into its level.  sched.prot must be held
+func (sched *sendScheduler) activate(q *sendQueue) {
+	idx := sort.Search(len(sched.levels), func(i int) bool { return sched.levels[i].priority <= q.priority })
+	if idx == len(sched.levels) || sched.levels[idx].priority != q.priority {
+		sched.levels = append(sched.levels, nil)
+		copy(sched.levels[idx+1:], sched.levels[idx:])
+		sched.levels[idx] = &sendLevel{priority: q.priority}
+	}
+	level := sched.levels[idx]
+	level.queues = append(level.queues, q)
+}
+
+// push queues a packet from the specified socket, blocking while that socket's queue (or rather, the lane of it the
+// packet waits in) is full.  Returns false (without queuing the packet) if closed is closed first
+func (sched *sendScheduler) push(s *udtSocket, pw packetWrapper, closed <-chan struct{}) bool {
+	sched.prot.Lock()
+	q := sched.queueFor(s)
+	lane := q.lane(pw.pkt)
+	for len(lane.pkts) >= sendQueueSize {
+		sched.prot.Unlock()
+		select {
+		case <-lane.space:
+		case _, _ = <-closed:
+			return false
+		}
+		sched.prot.Lock()
+		q = sched.queueFor(s) // our queue may have been emptied and discarded while we waited
+		lane = q.lane(pw.pkt)
+	}
+	pw.from = s
+	wasEmpty := q.empty()
+	lane.pkts = append(lane.pkts, pw)
+	if wasEmpty {
+		sched.activate(q)
+	}
+	sched.prot.Unlock()
+
+	select {
+	case sched.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// setLimit limits the rate of everything sent by this multiplexer (in bytes/sec, replacing any previous limit, or
+// removing it if zero)
+func (sched *sendScheduler) setLimit(clock Clock, rate uint64) {
+	sched.prot.Lock()
+	defer sched.prot.Unlock()
+	if rate == 0 {
+		sched.limit = nil
+	} else if sched.limit == nil {
+		sched.limit = newTokenBucket(clock, rate)
+	} else {
+		sched.limit.setRate(rate)
+	}
+}
+
+// pop takes the next packet to be written out.  If nothing is waiting it returns false, along with (if everything
+// waiting is being held back by a rate limit) a channel that fires once it should be tried again
+func (sched *sendScheduler) pop() (packetWrapper, <-chan time.Time, bool) {
+	sched.prot.Lock()
+	defer sched.prot.Unlock()
+	if len(sched.levels) == 0 {
+		return packetWrapper{}, nil, false
+	}
+	if sched.limit != nil {
+		if wait := sched.limit.ready(); wait > 0 {
+			return packetWrapper{}, sched.limit.clock.After(wait), false
+		}
+	}
+
+	// serve the first queue in line at the highest priority that isn't being held back by its own rate limit, then
+	// send it to the back of the line
+	var retry *tokenBucket
+	var retryWait time.Duration
+	for levelIdx, level := range sched.levels {
+		for idx, q := range level.queues {
+			if q.sock != nil && q.sock.sendLimit != nil {
+				if wait := q.sock.sendLimit.ready(); wait > 0 {
+					if retry == nil || wait < retryWait {
+						retry, retryWait = q.sock.sendLimit, wait
+					}
+					continue
+				}
+			}
+
+			pw := q.next()
+			level.queues = append(level.queues[:idx], level.queues[idx+1:]...)
+			if !q.empty() {
+				level.queues = append(level.queues, q)
+			} else {
+				delete(sched.queues, q.sock)
+				if len(level.queues) == 0 {
+					sched.levels = append(sched.levels[:levelIdx], sched.levels[levelIdx+1:]...)
+				}
+			}
+			return pw, nil, true
+		}
+	}
+	return packetWrapper{}, retry.clock.After(retryWait), false
+}
+
+// charge accounts for a packet (of the specified size on the wire) having been written out
+func (sched *sendScheduler) charge(pw packetWrapper, size int) {
+	sched.prot.Lock()
+	limit := sched.limit
+	sched.prot.Unlock()
+	if limit != nil {
+		limit.charge(size)
+	}
+	if pw.from != nil && pw.from.sendLimit != nil {
+		pw.from.sendLimit.charge(size)
+	}
+}
@@ -0,0 +1,150 @@
+package udt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestSendScheduler(t *testing.T) {
+	bulk1 := &udtSocket{Config: &Config{}}
+	bulk2 := &udtSocket{Config: &Config{}}
+	interactive := &udtSocket{Config: &Config{Priority: 1}}
+	closed := make(chan struct{})
+
+	sched := newSendScheduler()
+	push := func(s *udtSocket, id uint32) {
+		if !sched.push(s, packetWrapper{pkt: &packet.Ack2Packet{AckSeqNo: id}}, closed) {
+			t.Fatal("unable to queue packet")
+		}
+	}
+	for i := uint32(0); i < 3; i++ {
+		push(bulk1, 10+i)
+		push(bulk2, 20+i)
+	}
+	push(nil, 30)
+	push(interactive, 1)
+	push(interactive, 2)
+
+	// the interactive socket goes first, then the others take turns
+	var order []uint32
+	for {
+		pw, _, ok := sched.pop()
+		if !ok {
+			break
+		}
+		order = append(order, pw.pkt.(*packet.Ack2Packet).AckSeqNo)
+	}
+	expected := []uint32{1, 2, 10, 20, 30, 11, 21, 12, 22}
+	if len(order) != len(expected) {
+		t.Fatalf("expected packets %v, got %v", expected, order)
+	}
+	for idx := range order {
+		if order[idx] != expected[idx] {
+			t.Fatalf("expected packets %v, got %v", expected, order)
+		}
+	}
+
+	// a full queue only blocks its own socket
+	for i := 0; i < sendQueueSize; i++ {
+		push(bulk1, 0)
+	}
+	push(bulk2, 0)
+	close(closed)
+	if sched.push(bulk1, packetWrapper{pkt: &packet.Ack2Packet{}}, closed) {
+		t.Error("expected a full queue to block until the multiplexer was closed")
+	}
+}
+
+func TestSendSchedulerLimit(t *testing.T) {
+	clock := newManualClock()
+	limited := &udtSocket{Config: &Config{}, sendLimit: newTokenBucket(clock, 100000)}
+	other := &udtSocket{Config: &Config{}}
+	closed := make(chan struct{})
+
+	sched := newSendScheduler()
+	for i := uint32(0); i < 2; i++ {
+		sched.push(limited, packetWrapper{pkt: &packet.Ack2Packet{AckSeqNo: 10 + i}}, closed)
+		sched.push(other, packetWrapper{pkt: &packet.Ack2Packet{AckSeqNo: 20 + i}}, closed)
+	}
+
+	// once the limited socket has used up its allowance (10ms of sending is 1000 bytes), it has to wait its turn
+	pw, _, _ := sched.pop()
+	sched.charge(pw, 2000)
+	var order []uint32
+	order = append(order, pw.pkt.(*packet.Ack2Packet).AckSeqNo)
+	for {
+		pw, retry, ok := sched.pop()
+		if !ok {
+			if retry == nil {
+				break
+			}
+			clock.advance(10 * time.Millisecond)
+			continue
+		}
+		order = append(order, pw.pkt.(*packet.Ack2Packet).AckSeqNo)
+	}
+	expected := []uint32{10, 20, 21, 11}
+	for idx := range expected {
+		if idx >= len(order) || order[idx] != expected[idx] {
+			t.Fatalf("expected packets %v, got %v", expected, order)
+		}
+	}
+
+	// a limit on the multiplexer holds everything back
+	sched.setLimit(clock, 100000)
+	sched.push(other, packetWrapper{pkt: &packet.Ack2Packet{AckSeqNo: 30}}, closed)
+	pw, _, _ = sched.pop()
+	sched.charge(pw, 2000)
+	sched.push(other, packetWrapper{pkt: &packet.Ack2Packet{AckSeqNo: 31}}, closed)
+	if _, retry, ok := sched.pop(); ok || retry == nil {
+		t.Error("expected the multiplexer's limit to hold back further packets")
+	}
+	clock.advance(20 * time.Millisecond)
+	if _, _, ok := sched.pop(); !ok {
+		t.Error("expected a packet to be sent once the multiplexer's limit permitted it")
+	}
+}
+
+func TestSendSchedulerFeedback(t *testing.T) {
+	s := &udtSocket{Config: &Config{}}
+	closed := make(chan struct{})
+
+	sched := newSendScheduler()
+	for i := uint32(0); i < sendQueueSize; i++ {
+		if !sched.push(s, packetWrapper{pkt: &packet.DataPacket{Seq: packet.PacketID{Seq: i}}}, closed) {
+			t.Fatal("unable to queue packet")
+		}
+	}
+
+	// a socket's data filling its queue doesn't hold back its feedback
+	close(closed)
+	for i := uint32(1); i <= 2; i++ {
+		if !sched.push(s, packetWrapper{pkt: &packet.AckPacket{AckSeqNo: i}}, closed) {
+			t.Fatal("feedback blocked behind a full queue of data")
+		}
+	}
+
+	// and goes ahead of the data that was waiting before it
+	var order []string
+	for i := 0; i < 5; i++ {
+		pw, _, ok := sched.pop()
+		if !ok {
+			t.Fatal("expected more packets to be waiting")
+		}
+		switch p := pw.pkt.(type) {
+		case *packet.DataPacket:
+			order = append(order, fmt.Sprintf("data%d", p.Seq.Seq))
+		case *packet.AckPacket:
+			order = append(order, fmt.Sprintf("ack%d", p.AckSeqNo))
+		}
+	}
+	expected := []string{"ack1", "ack2", "data0", "data1", "data2"}
+	for idx := range expected {
+		if order[idx] != expected[idx] {
+			t.Fatalf("expected packets %v, got %v", expected, order)
+		}
+	}
+}
@@ -8,9 +8,17 @@ import (
 )
 
 type sendPacketEntry struct {
-	pkt *packet.DataPacket
-	tim time.Time
-	ttl time.Duration
+	pkt        *packet.DataPacket
+	tim        time.Time
+	ttl        time.Duration
+	rexmits    uint     // number of times this packet has been retransmitted
+	largeAcked uint     // our sender's largeAcked when this packet was first retransmitted (see blackhole.go)
+	receipt    *Receipt // (last packet of a message) settled once this packet is acknowledged, see receipt.go
+}
+
+// expired returns whether the message this packet belongs to has outlived its time to live (if it has one)
+func (e *sendPacketEntry) expired(now time.Time) bool {
+	return e.ttl != 0 && now.After(e.tim.Add(e.ttl))
 }
 
 // receiveLossList defines a list of recvLossEntry records sorted by their packet ID
@@ -21,7 +29,7 @@ func (h sendPacketHeap) Len() int {
 }
 
 func (h sendPacketHeap) Less(i, j int) bool {
-	return h[i].pkt.Seq.Seq < h[j].pkt.Seq.Seq
+	return h[i].pkt.Seq.Cmp(h[j].pkt.Seq) < 0
 }
 
 func (h sendPacketHeap) Swap(i, j int) {
@@ -40,72 +48,33 @@ func (h *sendPacketHeap) Pop() interface{} {
 	return x
 }
 
-// Find does a binary search of the heap for the specified packetID which is returned
+// Find does a search of the heap for the specified packetID which is returned
 func (h sendPacketHeap) Find(packetID packet.PacketID) (*sendPacketEntry, int) {
-	len := len(h)
-	idx := 0
-	for idx < len {
-		pid := h[idx].pkt.Seq
-		if pid == packetID {
-			return &h[idx], idx
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	idx := heapFind(len(h), 0, func(idx int) int {
+		return h[idx].pkt.Seq.Cmp(packetID)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return &h[idx], idx
 }
 
-// Min does a binary search of the heap for the entry with the lowest packetID greater than or equal to the specified value
+// Min does a search of the heap for the entry with the lowest packetID greater than or equal to the specified value
 func (h sendPacketHeap) Min(greaterEqual packet.PacketID, lessEqual packet.PacketID) (*packet.DataPacket, int) {
-	len := len(h)
-	idx := 0
-	wrapped := greaterEqual.Seq > lessEqual.Seq
-	for idx < len {
-		pid := h[idx].pkt.Seq
-		var next int
-		if pid.Seq == greaterEqual.Seq {
-			return h[idx].pkt, idx
-		} else if pid.Seq >= greaterEqual.Seq {
-			next = idx * 2
-		} else {
-			next = idx*2 + 1
-		}
-		if next >= len && h[idx].pkt.Seq.Seq > greaterEqual.Seq && (wrapped || h[idx].pkt.Seq.Seq <= lessEqual.Seq) {
-			return h[idx].pkt, idx
-		}
-		idx = next
-	}
-
-	// can't find any packets with greater value, wrap around
-	if wrapped {
-		idx = 0
-		for {
-			next := idx * 2
-			if next >= len && h[idx].pkt.Seq.Seq <= lessEqual.Seq {
-				return h[idx].pkt, idx
-			}
-			idx = next
-		}
+	idx := heapMinRange(h, 0, func(idx int) int {
+		return seqInRange(h[idx].pkt.Seq, greaterEqual, lessEqual)
+	})
+	if idx < 0 {
+		return nil, -1
 	}
-	return nil, -1
+	return h[idx].pkt, idx
 }
 
-// Remove does a binary search of the heap for the specified packetID, which is removed
+// Remove does a search of the heap for the specified packetID, which is removed
 func (h *sendPacketHeap) Remove(packetID packet.PacketID) bool {
-	len := len(*h)
-	idx := 0
-	for idx < len {
-		pid := (*h)[idx].pkt.Seq
-		if pid.Seq == packetID.Seq {
-			heap.Remove(h, idx)
-			return true
-		} else if pid.Seq > packetID.Seq {
-			idx = idx * 2
-		} else {
-			idx = idx*2 + 1
-		}
+	if _, idx := h.Find(packetID); idx >= 0 {
+		heap.Remove(h, idx)
+		return true
 	}
 	return false
 }
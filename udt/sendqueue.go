@@ -0,0 +1,72 @@
+package udt
+
+/*
+Write returns as soon as the connection has queued what was written, so an application producing data faster than the
+path can carry it only finds out once the queue fills and Write starts blocking.  Conn.SendQueue reports how much is
+queued at each stage, to apply its own admission control before then (such as dropping video frames while the
+connection is backed up):
+
+	- messages written and waiting for the connection to take them up (a channel holding up to 256 writes)
+	- bytes written but not yet put into a data packet (including the messages above)
+	- payload bytes sent and not yet acknowledged by the peer (after compression, if it's in use)
+
+Along with the current depth of each it gives the most it's been since the connection was opened, or since the last
+call to Conn.ResetSendQueueHighWater.
+*/
+
+// SendQueue describes how much this connection is holding that hasn't yet been delivered to its peer, see
+// Conn.SendQueue
+type SendQueue struct {
+	Messages     uint   // number of writes waiting for the connection to take them up
+	MessagesHigh uint   // most writes that have been waiting at once
+	Unsent       uint64 // number of bytes written but not yet sent in a data packet
+	UnsentHigh   uint64 // most bytes that have been waiting to be sent at once
+	Unacked      uint64 // number of payload bytes sent but not yet acknowledged
+	UnackedHigh  uint64 // most payload bytes that have been waiting to be acknowledged at once
+}
+
+// SendQueue returns how much this connection is holding that hasn't yet been delivered to its peer, along with the
+// most it's held (since the connection opened or ResetSendQueueHighWater was called)
+func (s *udtSocket) SendQueue() SendQueue {
+	result := SendQueue{
+		Messages:     uint(len(s.messageOut)),
+		MessagesHigh: uint(s.queueHigh.get()),
+		Unsent:       s.unsent.get(),
+		UnsentHigh:   s.unsentHigh.get(),
+	}
+	if s.send != nil {
+		result.Unacked = s.send.unacked.get()
+		result.UnackedHigh = s.send.unackedHigh.get()
+	}
+	return result
+}
+
+// ResetSendQueueHighWater resets the high-water marks returned by SendQueue to the current depths
+func (s *udtSocket) ResetSendQueueHighWater() {
+	s.queueHigh.set(uint32(len(s.messageOut)))
+	s.unsentHigh.set(s.unsent.get())
+	if s.send != nil {
+		s.send.unackedHigh.set(s.send.unacked.get())
+	}
+}
+
+// noteUnsent records bytes having been written to the connection (positive), or put into a data packet or given up
+// on (negative)
+func (s *udtSocket) noteUnsent(size int) {
+	addQueued(&s.unsent, &s.unsentHigh, size)
+}
+
+// noteUnacked records a data packet with the specified payload size having been sent (positive), or acknowledged
+// (negative)
+func (s *udtSocketSend) noteUnacked(size int) {
+	addQueued(&s.unacked, &s.unackedHigh, size)
+}
+
+// addQueued adds size (which may be negative) to the depth of a queue, raising its high-water mark to match
+func addQueued(depth *atomicUint64, high *atomicUint64, size int) {
+	if size < 0 {
+		depth.add(^uint64(-size - 1)) // subtracts -size
+		return
+	}
+	high.raise(depth.add(uint64(size)))
+}
@@ -0,0 +1,74 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSendQueue(t *testing.T) {
+	server, client := datagramPipe(t)
+	defer server.Close()
+	defer client.Close()
+
+	if q := client.SendQueue(); q != (SendQueue{}) {
+		t.Errorf("expected an empty send queue, got %+v", q)
+	}
+
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	for i := 0; i < 8; i++ {
+		if _, err := client.WriteMessage(msg, 0, true); err != nil {
+			t.Fatalf("error writing: %s", err.Error())
+		}
+	}
+	if q := client.SendQueue(); q.UnsentHigh < uint64(len(msg)) {
+		t.Errorf("expected at least one message to have been waiting to be sent, got %+v", q)
+	}
+	for i := 0; i < 8; i++ {
+		if _, _, err := server.ReadMessage(); err != nil {
+			t.Fatalf("error reading: %s", err.Error())
+		}
+	}
+
+	// once everything is acknowledged, the queue drains
+	deadline := time.Now().Add(5 * time.Second)
+	q := client.SendQueue()
+	for (q.Messages != 0 || q.Unsent != 0 || q.Unacked != 0) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		q = client.SendQueue()
+	}
+	if q.Messages != 0 || q.Unsent != 0 || q.Unacked != 0 {
+		t.Fatalf("expected the send queue to drain, got %+v", q)
+	}
+	if q.UnackedHigh < uint64(len(msg))/8 || q.MessagesHigh == 0 {
+		t.Errorf("expected high-water marks to be kept, got %+v", q)
+	}
+
+	client.ResetSendQueueHighWater()
+	if q := client.SendQueue(); q != (SendQueue{}) {
+		t.Errorf("expected resetting to clear the high-water marks, got %+v", q)
+	}
+}
+
+func TestSendQueueStream(t *testing.T) {
+	a, b := Pipe()
+	server, client := a.(Conn), b.(Conn)
+	defer server.Close()
+	defer client.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	go client.Write(data)
+	if _, err := io.ReadFull(server, make([]byte, len(data))); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	q := client.SendQueue()
+	for q.Unacked != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		q = client.SendQueue()
+	}
+	if q.Unsent != 0 || q.Unacked != 0 || q.UnsentHigh != uint64(len(data)) {
+		t.Errorf("expected the send queue to drain after a %d byte write, got %+v", len(data), q)
+	}
+}
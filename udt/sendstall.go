@@ -0,0 +1,64 @@
+package udt
+
+import (
+	"time"
+)
+
+/*
+Config.OnSendStall tells a streaming application when the connection stops getting data through, so it can lower its
+bitrate or pause its producers rather than filling the send queue.  Sending is considered stalled once data has been
+waiting to be acknowledged for Config.SendStallRTTs roundtrip times (4 if it isn't set), plus the 10ms a peer may wait
+before acknowledging what it's received, without anything being acknowledged.  OnSendStall is then called with stalled
+set, and called again with it clear as soon as the peer acknowledges something (which may be well before the backlog
+has cleared).  A connection with nothing waiting to be acknowledged is never stalled, however long it's idle.
+*/
+
+// defaultSendStallRTTs is how many roundtrip times without an acknowledgement sending is considered stalled after,
+// if Config.SendStallRTTs isn't set
+const defaultSendStallRTTs = 4
+
+// stallThreshold returns how long data can wait without anything being acknowledged before sending is stalled
+func (s *udtSocketSend) stallThreshold() time.Duration {
+	rtts := s.socket.Config.SendStallRTTs
+	if rtts == 0 {
+		rtts = defaultSendStallRTTs
+	}
+	rtt, _ := s.socket.getRTT()
+	return time.Duration(rtts*rtt)*time.Microsecond + synTime
+}
+
+// noteSendProgress is called whenever the peer acknowledges something, or whenever a packet is sent with nothing
+// else waiting to be acknowledged, restarting the wait for the next acknowledgement
+func (s *udtSocketSend) noteSendProgress(now time.Time) {
+	s.lastProgress = now
+	s.stallEvent = nil
+	if s.sendStalled {
+		s.sendStalled = false
+		s.notifyStall(false)
+	}
+}
+
+// armStall starts waiting for sending to stall, if anything is waiting to be acknowledged and we aren't already
+func (s *udtSocketSend) armStall() {
+	if s.socket.Config.OnSendStall == nil || s.sendPktPend == nil || s.sendStalled || s.stallEvent != nil {
+		return
+	}
+	s.stallEvent = s.socket.clock.After(s.stallThreshold() - s.socket.clock.Now().Sub(s.lastProgress))
+}
+
+// stallExpired is called when stallEvent fires, checking whether sending has stalled since it was armed
+func (s *udtSocketSend) stallExpired(now time.Time) {
+	s.stallEvent = nil
+	if s.sendPktPend == nil || now.Sub(s.lastProgress) < s.stallThreshold() {
+		return // armStall will wait for whatever is left
+	}
+	s.sendStalled = true
+	s.notifyStall(true)
+}
+
+// notifyStall passes sending having stalled or resumed to Config.OnSendStall
+func (s *udtSocketSend) notifyStall(stalled bool) {
+	if onSendStall := s.socket.Config.OnSendStall; onSendStall != nil {
+		onSendStall(s.socket, stalled)
+	}
+}
@@ -0,0 +1,97 @@
+package udt
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendStall(t *testing.T) {
+	a, b := newPipeConns()
+	conn := &blackholeConn{PacketConn: b, limit: 100, lifted: 1}
+	notified := make(chan bool, 4)
+	config := DefaultConfig()
+	config.OnSendStall = func(c Conn, stalled bool) {
+		notified <- stalled
+	}
+	servMx, err := NewMultiplexerWithConn(a, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(conn, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), false)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := (<-accepted).(Conn)
+	defer server.Close()
+
+	// a connection getting everything through doesn't stall
+	msg := bytes.Repeat([]byte("x"), 1000)
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	if _, _, err := server.ReadMessage(); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case stalled := <-notified:
+		t.Fatalf("expected no notification while data is getting through, got stalled=%v", stalled)
+	default:
+	}
+
+	// nor does one that is idle
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case stalled := <-notified:
+		t.Fatalf("expected no notification while idle, got stalled=%v", stalled)
+	default:
+	}
+
+	// but one whose data packets are being dropped does, until they get through again
+	atomic.StoreInt32(&conn.lifted, 0)
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	select {
+	case stalled := <-notified:
+		if !stalled {
+			t.Fatal("expected to be told sending had stalled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to be told sending had stalled")
+	}
+	atomic.StoreInt32(&conn.lifted, 1)
+	select {
+	case stalled := <-notified:
+		if stalled {
+			t.Fatal("expected to be told sending had resumed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected to be told sending had resumed")
+	}
+	if _, _, err := server.ReadMessage(); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+}
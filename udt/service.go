@@ -0,0 +1,49 @@
+package udt
+
+import (
+	"log"
+	"net"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Several listeners (each with its own Config) can share a local address by giving each a different Config.ServiceName.
+A dialer names the service it wants in the HsExtService handshake extension, and its handshakes are passed to the
+listener for that service.  Handshakes without the extension (including those from peers that don't support it) go
+to the listener with no service name, if there is one.  A handshake for a service nobody is listening for is refused
+with RejectService.
+*/
+
+// listenerTable holds the listeners sharing a multiplexer, by the service name they accept connections for
+type listenerTable map[string]*listener
+
+// serviceName returns the service a handshake is asking to connect to ("" if it doesn't name one)
+func serviceName(p *packet.HandshakePacket) string {
+	if ext, ok := p.Extension(packet.HsExtService); ok {
+		return string(ext)
+	}
+	return ""
+}
+
+// listenerFor returns the listener that should process a handshake, if there is one, along with whether anything is
+// listening on this multiplexer at all
+func (m *multiplexer) listenerFor(p *packet.HandshakePacket) (*listener, bool) {
+	m.servSockMutex.Lock()
+	defer m.servSockMutex.Unlock()
+	return m.listeners[serviceName(p)], len(m.listeners) > 0
+}
+
+// rejectHandshake refuses a connection, telling the dialing side why
+func (m *multiplexer) rejectHandshake(hsPacket *packet.HandshakePacket, from *net.UDPAddr, rej *RejectError) {
+	m.hsRefused.add(1)
+	log.Printf("%s (listener) sending handshake(reject: %s) to %s (id=%d)", m.laddr.String(), rej.Reason.String(),
+		from.String(), hsPacket.SockID)
+	m.sendPacket(nil, from, hsPacket.SockID, 0, &packet.HandshakePacket{
+		UdtVer:     hsPacket.UdtVer,
+		SockType:   hsPacket.SockType,
+		ReqType:    packet.HsRefused,
+		SockAddr:   from.IP,
+		Extensions: []packet.HandshakeExtension{rej.extension()},
+	})
+}
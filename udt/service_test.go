@@ -0,0 +1,66 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestServiceName(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", serverPort+64)
+	listeners := make(map[string]net.Listener)
+	for _, service := range []string{"alpha", "beta"} {
+		config := DefaultConfig()
+		config.ServiceName = service
+		l, err := config.Listen(context.Background(), "udp", addr)
+		if err != nil {
+			t.Fatalf("error listening for service %s: %s", service, err.Error())
+		}
+		defer l.Close()
+		listeners[service] = l
+	}
+
+	// each service can only have one listener
+	config := DefaultConfig()
+	config.ServiceName = "beta"
+	if l, err := config.Listen(context.Background(), "udp", addr); err == nil {
+		l.Close()
+		t.Error("expected an error listening for the same service twice")
+	}
+
+	raddr := listeners["alpha"].Addr()
+	for _, service := range []string{"alpha", "beta"} {
+		accepted := make(chan net.Conn, 1)
+		go func(l net.Listener) {
+			if conn, err := l.Accept(); err == nil {
+				accepted <- conn
+			}
+		}(listeners[service])
+
+		config := DefaultConfig()
+		config.ServiceName = service
+		client, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+64), raddr, true)
+		if err != nil {
+			t.Fatalf("error dialing service %s: %s", service, err.Error())
+		}
+		server := <-accepted
+		if server.RemoteAddr().(*UDTAddr).SocketID != client.LocalAddr().(*UDTAddr).SocketID {
+			t.Errorf("connection to service %s was accepted by someone else", service)
+		}
+		client.Close()
+		server.Close()
+	}
+
+	// a service nobody is listening for is refused (as is one not naming a service, as there's no default listener)
+	for _, service := range []string{"gamma", ""} {
+		config := DefaultConfig()
+		config.ServiceName = service
+		_, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+65), raddr, true)
+		var rej *RejectError
+		if !errors.As(err, &rej) || rej.Reason != RejectService {
+			t.Errorf("expected service %q to be refused as unknown, got %v", service, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package udt
+
+import (
+	"net"
+	"sync"
+)
+
+const socketTableShards = 16 // number of independently-locked shards in a socketTable
+
+// socketTable holds the sockets handled by a multiplexer, by socket ID.  It's split into shards (each with its own
+// lock) so sockets coming and going don't hold up the routing of packets to the others.  Sockets attempting to
+// rendezvous are also indexed by their peer's address, as their peer doesn't know their socket ID yet.  The zero value
+// is an empty table, ready to use
+type socketTable struct {
+	shards     [socketTableShards]socketShard
+	rvProt     sync.Mutex            // lock must be held before referencing rendezvous
+	rendezvous map[string]*udtSocket // sockets attempting to rendezvous, by peer address
+}
+
+type socketShard struct {
+	prot    sync.RWMutex          // lock must be held before referencing sockets
+	sockets map[uint32]*udtSocket // sockets in this shard, by socket ID
+}
+
+func (t *socketTable) shard(sockID uint32) *socketShard {
+	return &t.shards[sockID%socketTableShards]
+}
+
+// load returns the socket with the specified ID, or nil if there isn't one
+func (t *socketTable) load(sockID uint32) *udtSocket {
+	sh := t.shard(sockID)
+	sh.prot.RLock()
+	defer sh.prot.RUnlock()
+	return sh.sockets[sockID]
+}
+
+// loadOrStore adds a socket to the table unless another is already using its ID, returning the socket now in the table
+func (t *socketTable) loadOrStore(s *udtSocket) *udtSocket {
+	sh := t.shard(s.sockID)
+	sh.prot.Lock()
+	defer sh.prot.Unlock()
+	if other, ok := sh.sockets[s.sockID]; ok {
+		return other
+	}
+	if sh.sockets == nil {
+		sh.sockets = make(map[uint32]*udtSocket)
+	}
+	sh.sockets[s.sockID] = s
+	return s
+}
+
+// remove takes the socket with the specified ID out of the table, returning false if it wasn't there
+func (t *socketTable) remove(sockID uint32) bool {
+	sh := t.shard(sockID)
+	sh.prot.Lock()
+	defer sh.prot.Unlock()
+	if _, ok := sh.sockets[sockID]; !ok {
+		return false
+	}
+	delete(sh.sockets, sockID)
+	return true
+}
+
+// isEmpty returns true if there are no sockets in the table
+func (t *socketTable) isEmpty() bool {
+	for idx := range t.shards {
+		sh := &t.shards[idx]
+		sh.prot.RLock()
+		count := len(sh.sockets)
+		sh.prot.RUnlock()
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of sockets in the table
+func (t *socketTable) count() int {
+	count := 0
+	for idx := range t.shards {
+		sh := &t.shards[idx]
+		sh.prot.RLock()
+		count += len(sh.sockets)
+		sh.prot.RUnlock()
+	}
+	return count
+}
+
+// all returns every socket in the table
+func (t *socketTable) all() []*udtSocket {
+	var result []*udtSocket
+	for idx := range t.shards {
+		sh := &t.shards[idx]
+		sh.prot.RLock()
+		for _, s := range sh.sockets {
+			result = append(result, s)
+		}
+		sh.prot.RUnlock()
+	}
+	return result
+}
+
+// connectedTo returns an open socket connected to the specified peer socket, or nil if there isn't one
+func (t *socketTable) connectedTo(peer *net.UDPAddr, peerSockID uint32) *udtSocket {
+	for idx := range t.shards {
+		sh := &t.shards[idx]
+		sh.prot.RLock()
+		for _, s := range sh.sockets {
+			if s.farSockID.get() == peerSockID && s.raddr.Port == peer.Port && s.raddr.IP.Equal(peer.IP) && s.isOpen() {
+				sh.prot.RUnlock()
+				return s
+			}
+		}
+		sh.prot.RUnlock()
+	}
+	return nil
+}
+
+// startRendezvous marks a socket in the table as attempting to rendezvous with its peer, returning false if another
+// socket is already doing so with the same peer
+func (t *socketTable) startRendezvous(s *udtSocket) bool {
+	peer := s.raddr.String()
+	t.rvProt.Lock()
+	defer t.rvProt.Unlock()
+	if _, ok := t.rendezvous[peer]; ok {
+		return false
+	}
+	if t.rendezvous == nil {
+		t.rendezvous = make(map[string]*udtSocket)
+	}
+	t.rendezvous[peer] = s
+	return true
+}
+
+// endRendezvous marks a socket as no longer attempting to rendezvous
+func (t *socketTable) endRendezvous(s *udtSocket) {
+	peer := s.raddr.String()
+	t.rvProt.Lock()
+	defer t.rvProt.Unlock()
+	if t.rendezvous[peer] == s {
+		delete(t.rendezvous, peer)
+	}
+}
+
+// rendezvousWith returns the socket attempting to rendezvous with the specified peer, or nil if there isn't one
+func (t *socketTable) rendezvousWith(peer *net.UDPAddr) *udtSocket {
+	t.rvProt.Lock()
+	defer t.rvProt.Unlock()
+	return t.rendezvous[peer.String()]
+}
@@ -0,0 +1,117 @@
+package udt
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestSocketTable(t *testing.T) {
+	var table socketTable
+	if !table.isEmpty() {
+		t.Error("new table isn't empty")
+	}
+
+	first := &udtSocket{sockID: 17}
+	second := &udtSocket{sockID: 17 + socketTableShards} // shares a shard with the first
+	if table.loadOrStore(first) != first || table.loadOrStore(second) != second {
+		t.Fatal("unable to store sockets")
+	}
+	if table.loadOrStore(&udtSocket{sockID: 17}) != first {
+		t.Error("a socket replaced another with the same ID")
+	}
+	if table.load(17) != first || table.load(17+socketTableShards) != second || table.load(18) != nil {
+		t.Error("sockets not found by their IDs")
+	}
+	if len(table.all()) != 2 {
+		t.Errorf("expected two sockets in the table, found %d", len(table.all()))
+	}
+
+	if !table.remove(17) || table.remove(17) {
+		t.Error("expected remove to report whether the socket was there")
+	}
+	table.remove(17 + socketTableShards)
+	if !table.isEmpty() {
+		t.Error("table isn't empty after removing everything")
+	}
+
+	// only one socket may attempt to rendezvous with a given peer at a time
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1235}
+	first.raddr, second.raddr = peer, peer
+	if !table.startRendezvous(first) || table.startRendezvous(second) {
+		t.Error("expected a second rendezvous with the same peer to be refused")
+	}
+	if table.rendezvousWith(peer) != first || table.rendezvousWith(other) != nil {
+		t.Error("rendezvous sockets not found by their peer address")
+	}
+	table.endRendezvous(second) // not the one registered, changes nothing
+	table.endRendezvous(first)
+	if table.rendezvousWith(peer) != nil || !table.startRendezvous(second) {
+		t.Error("expected a new rendezvous with the peer once the first ended")
+	}
+}
+
+func TestRouteByPeer(t *testing.T) {
+	serv, client, server := connectWithClock(t, 26, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	// someone other than our peer sends a packet addressed to our socket
+	raw, err := net.DialUDP("udp", nil, &client.LocalAddr().(*UDTAddr).UDPAddr)
+	if err != nil {
+		t.Fatalf("error calling DialUDP: %s", err.Error())
+	}
+	defer raw.Close()
+	buf := make([]byte, 64)
+	n, _ := packet.NewShutdownPacket(client.sockID, 0).WriteTo(buf)
+	raw.Write(buf[:n])
+
+	for i := 0; i < 100 && client.Stats().PktWrongPeer == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := client.Stats().PktWrongPeer; got != 1 {
+		t.Fatalf("expected one packet from the wrong peer, got %d", got)
+	}
+	if !client.isOpen() {
+		t.Error("a stray shutdown packet closed the connection")
+	}
+}
+
+// benchmarkSocketLookup looks up sockets while others are created and destroyed around them
+func benchmarkSocketLookup(b *testing.B, store func(s *udtSocket), load func(sockID uint32), remove func(sockID uint32)) {
+	const live = 1024
+	for id := uint32(0); id < live; id++ {
+		store(&udtSocket{sockID: id})
+	}
+	var nextID uint32 = live
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if i%8 == 0 {
+				id := atomic.AddUint32(&nextID, 1)
+				store(&udtSocket{sockID: id})
+				remove(id)
+			} else {
+				load(uint32(i % live))
+			}
+		}
+	})
+}
+
+func BenchmarkSocketTable(b *testing.B) {
+	var table socketTable
+	benchmarkSocketLookup(b, func(s *udtSocket) { table.loadOrStore(s) }, func(id uint32) { table.load(id) },
+		func(id uint32) { table.remove(id) })
+}
+
+func BenchmarkSocketSyncMap(b *testing.B) {
+	var table sync.Map
+	benchmarkSocketLookup(b, func(s *udtSocket) { table.Store(s.sockID, s) }, func(id uint32) { table.Load(id) },
+		func(id uint32) { table.Delete(id) })
+}
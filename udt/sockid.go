@@ -0,0 +1,41 @@
+package udt
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Each socket is identified to its peer by a socket ID, unique among the sockets sharing its local address, and starts
+numbering its data packets from an initial sequence number.  Both are unpredictable by default: socket IDs count down
+from a random starting point chosen (with crypto/rand) for each local address, and initial sequence numbers are
+chosen with crypto/rand for each connection.  Config.NewSocketID and Config.NewInitialSeq can supply them instead,
+such as for reproducible tests.  Socket IDs are checked against those already in use, and another one requested if
+they collide.
+*/
+
+const maxSockIDAttempts = 64 // number of socket IDs to try before concluding we can't find an unused one
+
+// errNoSockID is returned when we can't find a socket ID that isn't already in use
+var errNoSockID = errors.New("Unable to find an unused socket ID")
+
+// nextSockID returns a candidate ID for a new socket on this multiplexer
+func (m *multiplexer) nextSockID(config *Config) uint32 {
+	if config.NewSocketID != nil {
+		return config.NewSocketID()
+	}
+	return atomic.AddUint32(&m.nextSid, ^uint32(0))
+}
+
+// newInitialSeq returns the initial packet sequence number for a new socket
+func newInitialSeq(config *Config) packet.PacketID {
+	var seq uint32
+	if config.NewInitialSeq != nil {
+		seq = config.NewInitialSeq()
+	} else {
+		seq = randUint32()
+	}
+	return packet.PacketID{Seq: seq & 0x7FFFFFFF}
+}
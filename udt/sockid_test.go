@@ -0,0 +1,104 @@
+package udt
+
+import (
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestSocketIDHooks(t *testing.T) {
+	ids := []uint32{0, 42, 42, 43}
+	config := DefaultConfig()
+	config.NewSocketID = func() uint32 {
+		if len(ids) == 0 {
+			return 42
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	config.NewInitialSeq = func() uint32 {
+		return 0x80000005
+	}
+	serv, client, server := connectWithClock(t, 42, defaultClock, config)
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	if client.sockID != 42 {
+		t.Errorf("expected socket ID 42, got %d", client.sockID)
+	}
+	if client.initPktSeq.Seq != 5 {
+		t.Errorf("expected initial sequence number 5, got %d", client.initPktSeq.Seq)
+	}
+
+	// IDs already in use on the local address are passed over
+	s, err := client.m.newSocket(config, client.raddr, 0, false, false)
+	if err != nil {
+		t.Fatalf("error creating socket: %s", err.Error())
+	}
+	if s.sockID != 43 {
+		t.Errorf("expected socket ID 43, got %d", s.sockID)
+	}
+	client.m.closeSocket(s.sockID)
+	close(s.sockClosed)
+
+	// and we give up if we can't find one that isn't
+	if _, err := client.m.newSocket(config, client.raddr, 0, false, false); err != errNoSockID {
+		t.Errorf("expected to run out of socket IDs, got %v", err)
+	}
+}
+
+func TestSocketIDAlias(t *testing.T) {
+	serv, client, server := connectWithClock(t, 44, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	// we don't take our peer's socket ID, in case it shares our local address
+	ids := []uint32{7, 8}
+	config := DefaultConfig()
+	config.NewSocketID = func() uint32 {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	s, err := server.m.newSocket(config, client.m.laddr, 7, true, false)
+	if err != nil {
+		t.Fatalf("error creating socket: %s", err.Error())
+	}
+	if s.sockID != 8 {
+		t.Errorf("expected socket ID 8, got %d", s.sockID)
+	}
+	server.m.closeSocket(s.sockID)
+	close(s.sockClosed)
+
+	// a new connection claiming to come from the socket we're already connected to is refused
+	from := client.m.laddr
+	hs := &packet.HandshakePacket{
+		UdtVer:     4,
+		SockType:   packet.TypeSTREAM,
+		ReqType:    packet.HsResponse,
+		InitPktSeq: client.initPktSeq.Add(100),
+		SockID:     client.sockID,
+		SynCookie:  serv.genSynCookie(from),
+		SockAddr:   from.IP,
+	}
+	if serv.readHandshake(serv.m, hs, from) {
+		t.Error("expected a handshake aliasing an existing connection to be refused")
+	}
+	select {
+	case <-serv.accept:
+		t.Error("a second socket was created for the same peer socket")
+	default:
+	}
+}
+
+func TestInitialSeqRange(t *testing.T) {
+	// the random initial sequence number we pick fits in the 31 bits a packet carries
+	for i := 0; i < 1000; i++ {
+		if seq := newInitialSeq(DefaultConfig()); seq.Seq > 0x7FFFFFFF {
+			t.Fatalf("expected a 31-bit initial sequence number, got %#x", seq.Seq)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package udt
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Stats contains performance metrics for a UDT connection
+type Stats struct {
+	PktSent     uint64 // number of sent data packets, including retransmissions
+	PktRetrans  uint64 // number of retransmitted packets
+	PktSndLoss  uint64 // number of lost packets reported by the peer (sender side)
+	PktLossList uint   // number of packets currently waiting in the sender's loss list for retransmission
+	ByteRcvPend uint64 // number of received payload bytes being held for message reassembly or ordering
+	PktRcvFEC   uint64 // number of lost packets rebuilt from FEC parity packets (receiver side)
+	PktRcvLoss  uint64 // number of lost packets detected and reported to the peer (receiver side)
+	PktNAKSupp  uint64 // number of loss reports held back for having been sent to the peer too recently (receiver side)
+
+	RTT          time.Duration // smoothed roundtrip time to the peer
+	RTTVar       time.Duration // variance in the roundtrip time
+	PktRecvRate  uint          // rate data packets are arriving, in packets/sec (receiver side, as of the last ACK)
+	EstBandwidth uint          // estimated link capacity from probe packet pairs, in packets/sec (receiver side, as of the last ACK)
+	ClockDrift   time.Duration // how far the peer's clock has drifted from ours since the connection was established (positive if it runs slow)
+	PktUnrelDrop uint64        // number of unreliable datagrams discarded for arriving faster than they were read
+	PktRecvCE    uint64        // number of data packets received with an ECN congestion mark (see Config.ECN)
+	PktMemDrop   uint64        // number of data packets discarded for exceeding this connection's share of memory (see Config.MemoryLimit)
+	ByteSent     uint64        // number of payload bytes written to this connection
+	ByteRecv     uint64        // number of payload bytes received on this connection
+	PktRexmitMax uint          // most times any single packet has been retransmitted (see Config.StuckRexmitLimit)
+	RecvWindow   uint          // flow window we're advertising to the peer, in packets (see Config.FlowWindowAutoTune)
+
+	// these count datagrams arriving at this connection's local address, whichever connection they were meant for
+	PktDecodeErr   uint64 // number of datagrams that couldn't be decoded
+	PktTrailingErr uint64 // number of datagrams rejected for trailing data (see Config.StrictDecoding)
+	PktWrongPeer   uint64 // number of packets discarded for coming from an address other than the connection's peer
+	HandshakeDrop  uint64 // number of handshakes a listener discarded for having too many waiting to be processed
+	ByteMemUsed    uint64 // bytes of memory held by all connections, as counted against Config.MemoryLimit (0 if there's no limit)
+}
+
+// Stats returns a snapshot of the performance metrics for this connection
+func (s *udtSocket) Stats() Stats {
+	var result Stats
+	if s.send != nil {
+		result.PktSent = s.send.pktSent.get()
+		result.PktRetrans = s.send.pktRetrans.get()
+		result.PktSndLoss = s.send.pktSndLoss.get()
+		result.PktLossList = uint(s.send.lossDepth.get())
+		result.PktRexmitMax = uint(s.send.maxRexmits.get())
+	}
+	if s.recv != nil {
+		result.ByteRcvPend = s.recv.recvPendBytes.get()
+		result.PktRcvFEC = s.recv.fecRecovered.get()
+		result.PktRcvLoss = s.recv.pktRcvLoss.get()
+		result.PktNAKSupp = s.recv.nakSuppressed.get()
+		result.PktRecvRate = uint(s.recv.recvRate.get())
+		result.EstBandwidth = uint(s.recv.recvBandwidth.get())
+	}
+	rtt, rttVar := s.getRTT()
+	result.RTT = time.Duration(rtt) * time.Microsecond
+	result.RTTVar = time.Duration(rttVar) * time.Microsecond
+	result.ClockDrift = s.drift.get()
+	result.PktUnrelDrop = s.unreliableDrop.get()
+	result.PktRecvCE = s.ecnMarks.get()
+	result.PktMemDrop = s.memDropped.get()
+	result.ByteSent = s.byteSent.get()
+	result.ByteRecv = s.byteRecv.get()
+	result.RecvWindow = uint(s.recvWindow.get())
+	result.PktDecodeErr = s.m.pktDecodeErr.get()
+	result.PktTrailingErr = s.m.pktTrailing.get()
+	result.PktWrongPeer = s.m.pktWrongPeer.get()
+	result.HandshakeDrop = s.m.hsDropped.get()
+	result.ByteMemUsed = s.m.mem.getUsed()
+	return result
+}
+
+// String describes this connection: its state, type and addresses
+func (s *udtSocket) String() string {
+	return fmt.Sprintf("%s %s %s (id=%d) -> %s (id=%d)", s.sockState.get(), s.sockType(), s.LocalAddr(), s.sockID,
+		s.RemoteAddr(), s.farSockID.get())
+}
+
+// MarshalJSON describes this connection, along with snapshots of its performance metrics and congestion control (see
+// SocketInfo)
+func (s *udtSocket) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.info())
+}
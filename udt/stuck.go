@@ -0,0 +1,52 @@
+package udt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+A transfer can stall without the connection ever timing out: the peer keeps acknowledging that it's alive, but some
+packet never gets through however often it's retransmitted (such as one too large for a path whose MTU has shrunk).
+Config.StuckRexmitLimit detects this, considering the transfer stuck once any single packet has been retransmitted
+that many times without being acknowledged.  Config.OnStuck is then called with a StuckError describing the packet;
+if there's no OnStuck the connection is closed with it instead (and the peer told CloseStuck), so that Read and
+Write return a diagnosis rather than waiting forever.  OnStuck is called on a goroutine of its own while the
+connection carries on, so it may close the connection: CloseWithError gives up on the stuck data straight away, while
+Close waits for it to be delivered as usual.
+
+Stats.PktRexmitMax reports the most times any packet has been retransmitted, to watch for this building up.
+*/
+
+// StuckError describes a packet that has been retransmitted Config.StuckRexmitLimit times without being acknowledged
+type StuckError struct {
+	Seq     uint32        // sequence number of the packet
+	Rexmits uint          // number of times it has been retransmitted
+	Waiting time.Duration // how long ago the message it belongs to was written
+}
+
+func (e *StuckError) Error() string {
+	return fmt.Sprintf("Transfer stuck: packet %d retransmitted %d times over %s without being acknowledged", e.Seq,
+		e.Rexmits, e.Waiting.String())
+}
+
+// noteRexmit is called each time a packet is retransmitted, checking whether the transfer has become stuck
+func (s *udtSocketSend) noteRexmit(dp *sendPacketEntry) {
+	if uint32(dp.rexmits) > s.maxRexmits.get() {
+		s.maxRexmits.set(uint32(dp.rexmits))
+	}
+	limit := s.socket.Config.StuckRexmitLimit
+	if limit == 0 || dp.rexmits != limit {
+		return
+	}
+	err := &StuckError{Seq: dp.pkt.Seq.Seq, Rexmits: dp.rexmits, Waiting: s.socket.clock.Now().Sub(dp.tim)}
+	if onStuck := s.socket.Config.OnStuck; onStuck != nil {
+		// on a goroutine of its own, so the callback can close the connection (which needs us to keep sending)
+		s.socket.routines.goRun(func() { onStuck(s.socket, err) })
+		return
+	}
+	s.sendPacket <- &packet.ShutdownPacket{Code: uint32(CloseStuck)}
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: err})
+}
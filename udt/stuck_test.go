@@ -0,0 +1,145 @@
+package udt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// retransmit reports a packet lost and retransmits it, returning what was sent
+func retransmit(t *testing.T, ss *udtSocketSend, sent chan packet.Packet, seq packet.PacketID) []packet.Packet {
+	t.Helper()
+	reportLost(ss, seq)
+	if !ss.processSendLoss() {
+		t.Fatal("retransmission wasn't sent")
+	}
+	var result []packet.Packet
+	for len(sent) > 0 {
+		result = append(result, <-sent)
+	}
+	return result
+}
+
+func TestStuckCallback(t *testing.T) {
+	stuck := make(chan *StuckError, 4)
+	config := DefaultConfig()
+	config.StuckRexmitLimit = 3
+	config.OnStuck = func(conn Conn, err *StuckError) { stuck <- err }
+	ss, sent := newTestSender(config)
+	ss.shutdownEvent = newShutdownLatch()
+	dp := sendTestMessage(ss, 1, 0)
+
+	// the callback is told once, and the connection carries on
+	for i := 0; i < 5; i++ {
+		retransmit(t, ss, sent, dp.Seq)
+	}
+	ss.socket.routines.close()
+	<-ss.socket.routines.done
+	if len(stuck) != 1 {
+		t.Fatalf("expected to be told once that packet %d is stuck, told %d times", dp.Seq.Seq, len(stuck))
+	}
+	if err := <-stuck; err.Seq != dp.Seq.Seq || err.Rexmits != 3 {
+		t.Errorf("expected to be told that packet %d is stuck, got %v", dp.Seq.Seq, err)
+	}
+	if ss.maxRexmits.get() != 5 {
+		t.Errorf("expected the most retransmissions to be 5, got %d", ss.maxRexmits.get())
+	}
+	if ss.shutdownEvent.latched.get() != 0 {
+		t.Error("connection shut down despite having an OnStuck callback")
+	}
+}
+
+func TestStuckClose(t *testing.T) {
+	config := DefaultConfig()
+	config.StuckRexmitLimit = 2
+	ss, sent := newTestSender(config)
+	ss.shutdownEvent = newShutdownLatch()
+	dp := sendTestMessage(ss, 1, 0)
+
+	retransmit(t, ss, sent, dp.Seq)
+	if ss.shutdownEvent.latched.get() != 0 {
+		t.Fatal("connection shut down before the transfer was stuck")
+	}
+
+	// without a callback the connection is closed, telling our peer why
+	var shutdown *packet.ShutdownPacket
+	for _, p := range retransmit(t, ss, sent, dp.Seq) {
+		if sp, ok := p.(*packet.ShutdownPacket); ok {
+			shutdown = sp
+		}
+	}
+	if shutdown == nil || CloseCode(shutdown.Code) != CloseStuck {
+		t.Errorf("expected the peer to be sent a shutdown with CloseStuck, got %v", shutdown)
+	}
+	var stuckErr *StuckError
+	if ss.shutdownEvent.latched.get() == 0 || !errors.As(ss.shutdownEvent.msg.err, &stuckErr) || stuckErr.Rexmits != 2 {
+		t.Errorf("expected the connection to be shut down with a StuckError")
+	}
+}
+
+func TestStuckCallbackClose(t *testing.T) {
+	a, b := newPipeConns()
+	conn := &blackholeConn{PacketConn: b, limit: 100, lifted: 1}
+	stuck := make(chan struct{})
+	closed := make(chan error, 1)
+	config := DefaultConfig()
+	config.StuckRexmitLimit = 3
+	config.OnStuck = func(c Conn, err *StuckError) {
+		close(stuck)
+		closed <- c.Close() // waits for the sending side to deliver what's stuck
+	}
+	servMx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(conn, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	defer server.Close()
+
+	atomic.StoreInt32(&conn.lifted, 0)
+	msg := bytes.Repeat([]byte("x"), 1000)
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	select {
+	case <-stuck:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected to be told the transfer is stuck")
+	}
+
+	// the connection keeps sending while the callback closes it, so once the data gets through Close returns
+	atomic.StoreInt32(&conn.lifted, 1)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("error closing: %s", err.Error())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected Close from OnStuck to return once the data was delivered")
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+}
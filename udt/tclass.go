@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package udt
+
+import (
+	"net"
+	"syscall"
+)
+
+// setKernelTrafficClass sets the IP TOS (IPv4) or traffic class (IPv6) byte of the packets sent from conn
+func setKernelTrafficClass(conn *net.UDPConn, isIPv6 bool, tclass byte) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		if isIPv6 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, int(tclass))
+			// a dual-stack socket may also be carrying IPv4 traffic, which has an option of its own
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, int(tclass))
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, int(tclass))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,11 @@
+package udt
+
+import (
+	"errors"
+	"net"
+)
+
+// setKernelTrafficClass sets the IP TOS (IPv4) or traffic class (IPv6) byte of the packets sent from conn
+func setKernelTrafficClass(conn *net.UDPConn, isIPv6 bool, tclass byte) error {
+	return errors.New("setting the traffic class of packets is not supported on this platform")
+}
@@ -0,0 +1,151 @@
+// msgecho exercises UDT message (SOCK_DGRAM) connections for the interop tests in interop_test.go.
+//
+//   msgecho server <port>                  accept one connection and echo every message back until it is closed
+//   msgecho client <host> <port> <count>   send <count> messages, checking that each one is echoed back intact
+//
+// Message i is (i * 7919) % 20000 + 1 bytes long, with byte j holding (i + j) & 0xff.
+//
+// Build against the UDT4 SDK with:
+//   g++ -I$UDT4/src -o msgecho msgecho.cpp -L$UDT4/src -ludt -lpthread
+
+#include <cstdlib>
+#include <cstring>
+#include <iostream>
+#include <netdb.h>
+#include <udt.h>
+
+using namespace std;
+
+static const int maxMessage = 20000;
+
+static int messageSize(int i)
+{
+   return (i * 7919) % maxMessage + 1;
+}
+
+static void fillMessage(int i, char* buf)
+{
+   int size = messageSize(i);
+   for (int j = 0; j < size; ++ j)
+      buf[j] = (char)((i + j) & 0xff);
+}
+
+static int fail(const char* what)
+{
+   cout << what << ": " << UDT::getlasterror().getErrorMessage() << endl;
+   return 1;
+}
+
+static int runServer(const char* port)
+{
+   addrinfo hints, *local;
+   memset(&hints, 0, sizeof(hints));
+   hints.ai_flags = AI_PASSIVE;
+   hints.ai_family = AF_INET;
+   hints.ai_socktype = SOCK_DGRAM;
+   if (0 != getaddrinfo(NULL, port, &hints, &local))
+   {
+      cout << "invalid port: " << port << endl;
+      return 1;
+   }
+
+   UDTSOCKET serv = UDT::socket(local->ai_family, local->ai_socktype, local->ai_protocol);
+   if (UDT::ERROR == UDT::bind(serv, local->ai_addr, local->ai_addrlen))
+      return fail("bind");
+   freeaddrinfo(local);
+   if (UDT::ERROR == UDT::listen(serv, 1))
+      return fail("listen");
+   cout << "server is ready at port: " << port << endl;
+
+   sockaddr_storage clientaddr;
+   int addrlen = sizeof(clientaddr);
+   UDTSOCKET conn = UDT::accept(serv, (sockaddr*)&clientaddr, &addrlen);
+   if (UDT::INVALID_SOCK == conn)
+      return fail("accept");
+   cout << "new connection" << endl;
+
+   char* buf = new char[maxMessage];
+   int echoed = 0;
+   while (true)
+   {
+      int rs = UDT::recvmsg(conn, buf, maxMessage);
+      if (UDT::ERROR == rs)
+      {
+         // the peer closing the connection is how the test ends
+         cout << "recvmsg: " << UDT::getlasterror().getErrorMessage() << endl;
+         break;
+      }
+      if (UDT::ERROR == UDT::sendmsg(conn, buf, rs, -1, true))
+         return fail("sendmsg");
+      ++ echoed;
+   }
+   cout << "echoed " << echoed << " messages" << endl;
+
+   delete [] buf;
+   UDT::close(conn);
+   UDT::close(serv);
+   return 0;
+}
+
+static int runClient(const char* host, const char* port, int count)
+{
+   addrinfo hints, *peer;
+   memset(&hints, 0, sizeof(hints));
+   hints.ai_family = AF_INET;
+   hints.ai_socktype = SOCK_DGRAM;
+   if (0 != getaddrinfo(host, port, &hints, &peer))
+   {
+      cout << "invalid address: " << host << ":" << port << endl;
+      return 1;
+   }
+
+   UDTSOCKET conn = UDT::socket(peer->ai_family, peer->ai_socktype, peer->ai_protocol);
+   if (UDT::ERROR == UDT::connect(conn, peer->ai_addr, peer->ai_addrlen))
+      return fail("connect");
+   freeaddrinfo(peer);
+
+   char* sent = new char[maxMessage];
+   char* recvd = new char[maxMessage];
+   for (int i = 0; i < count; ++ i)
+   {
+      fillMessage(i, sent);
+      if (UDT::ERROR == UDT::sendmsg(conn, sent, messageSize(i), -1, true))
+         return fail("sendmsg");
+      int rs = UDT::recvmsg(conn, recvd, maxMessage);
+      if (UDT::ERROR == rs)
+         return fail("recvmsg");
+      if ((rs != messageSize(i)) || (0 != memcmp(sent, recvd, rs)))
+      {
+         cout << "message " << i << " was not echoed intact (" << rs << " bytes received)" << endl;
+         return 1;
+      }
+   }
+   cout << "sent " << count << " messages" << endl;
+
+   delete [] sent;
+   delete [] recvd;
+   UDT::close(conn);
+   return 0;
+}
+
+int main(int argc, char* argv[])
+{
+   if ((argc == 3) && (0 == strcmp(argv[1], "server")))
+   {
+      UDT::startup();
+      int rc = runServer(argv[2]);
+      UDT::cleanup();
+      return rc;
+   }
+   if ((argc == 5) && (0 == strcmp(argv[1], "client")))
+   {
+      UDT::startup();
+      int rc = runClient(argv[2], argv[3], atoi(argv[4]));
+      UDT::cleanup();
+      return rc;
+   }
+
+   cout << "usage: msgecho server <port>" << endl;
+   cout << "       msgecho client <host> <port> <count>" << endl;
+   return 1;
+}
@@ -0,0 +1,55 @@
+package udt
+
+import (
+	"log"
+	"runtime"
+)
+
+/*
+Threading model
+
+Each local address (multiplexer) has a goroutine writing packets out, and one reading packets in for each of its UDP
+sockets (see Config.ReusePortSockets).  The read goroutine decodes each packet and hands it to the socket it's
+addressed to, so it never waits on a socket for long; the write goroutine takes packets from every socket's send queue
+in turn (see sendScheduler).  A listener has a goroutine of its own processing handshakes.
+
+Each connection has a goroutine managing its state and passing its packets to the multiplexer (goManageConnection), a
+goroutine for its sending side (goSendEvent, which also runs congestion control) and one for its receiving side
+(goReceiveEvent, which runs without a goroutine of its own while idle with Config.EventLoop).  Read and Write calls
+only exchange messages with these over channels.
+
+All of these are ordinary goroutines, which Go's scheduler moves between OS threads (and so CPUs) as it sees fit.  For
+latency-sensitive deployments, Config.LockThreads locks the multiplexer's read and write goroutines each to an OS
+thread of its own with runtime.LockOSThread, so they aren't held up behind other goroutines that happen to share their
+thread, and Config.ThreadCPUs further pins those threads to particular CPUs (on Linux).  Both are best-effort: they take
+effect as each goroutine next wakes, and a failure to pin is logged rather than reported.  The threads stay locked
+until the multiplexer closes, when they exit along with their goroutines (rather than being returned to the scheduler
+with a changed affinity).  GOMAXPROCS still needs to leave room for the rest of the program, as each locked thread
+takes one of its slots whenever it's running.
+*/
+
+// lockThreads has our read and write goroutines lock themselves to OS threads of their own, pinned to the specified
+// CPUs if any.  Only the first call has any effect
+func (m *multiplexer) lockThreads(cpus []int) {
+	m.lockOnce.Do(func() {
+		m.threadCPUs = append([]int(nil), cpus...)
+		m.lockedThreads.set(1)
+		select {
+		case m.sched.wake <- struct{}{}: // so goWrite doesn't wait for something to send before locking
+		default:
+		}
+	})
+}
+
+// lockThread locks the calling goroutine (the idx'th of our read and write goroutines) to its OS thread, pinning it
+// to a CPU if we've been asked to
+func (m *multiplexer) lockThread(idx int) {
+	runtime.LockOSThread()
+	if len(m.threadCPUs) == 0 {
+		return
+	}
+	cpu := m.threadCPUs[idx%len(m.threadCPUs)]
+	if err := setThreadAffinity(cpu); err != nil {
+		log.Printf("%s unable to pin thread to CPU %d: %s", m.laddr.String(), cpu, err.Error())
+	}
+}
@@ -0,0 +1,25 @@
+package udt
+
+import (
+	"testing"
+)
+
+func TestLockThreads(t *testing.T) {
+	config := DefaultConfig()
+	config.LockThreads = true
+	config.ThreadCPUs = []int{0}
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	if _, err := a.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+	if m := a.(*udtSocket).m; m.lockedThreads.get() == 0 || len(m.threadCPUs) != 1 {
+		t.Error("expected the multiplexer's goroutines to be locked to their threads")
+	}
+}
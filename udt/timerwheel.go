@@ -0,0 +1,282 @@
+package udt
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	wheelTick   = time.Millisecond // resolution of the timers kept in a timerWheel
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits // slots in each level of a timerWheel
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 4                                      // levels in a timerWheel (spanning about 4.6 hours)
+	wheelSpan   = uint64(1) << (wheelBits * wheelLevels) // number of ticks spanned by every level of a timerWheel
+)
+
+/*
+A timerWheel keeps the timers for every socket sharing a multiplexer in event-loop mode (see Config.EventLoop), all
+driven by a single goroutine.  Timers are kept in a hierarchy of wheels: the first level has a slot for each tick of the
+next 64ms, the second a slot for each 64ms of the next 4s, and so on.  Each time the first level comes back around the
+timers in the next slot of the second level are spread out among its slots (and likewise up the hierarchy), so a timer
+is only touched a few times on its way to firing no matter how many others are waiting alongside it.
+*/
+type timerWheel struct {
+	prot       sync.Mutex                           // lock must be held before referencing any other members
+	base       Clock                                // the clock driving this wheel
+	start      time.Time                            // the time of tick zero
+	now        uint64                               // the last tick processed
+	count      int                                  // number of timers waiting
+	slots      [wheelLevels][wheelSlots]*wheelTimer // timers waiting in each slot (as doubly-linked lists)
+	sleepUntil uint64                               // the tick the wheel's goroutine is waiting for
+	wake       chan struct{}                        // signaled when a timer is added that's due before sleepUntil
+}
+
+// wheelTimer is a single timer waiting in a timerWheel
+type wheelTimer struct {
+	wheel      *timerWheel
+	deadline   uint64              // the tick this timer fires on
+	period     time.Duration       // if set, this is a ticker
+	c          chan time.Time      // channel the time is sent on when this timer fires (nil for timers from AfterFunc)
+	fire       func(now time.Time) // called from the wheel's goroutine when this timer fires, must not block
+	queued     bool                // if true, this timer is waiting in slots[level][idx]
+	level, idx int
+	prev, next *wheelTimer
+}
+
+func newTimerWheel(base Clock) *timerWheel {
+	return &timerWheel{
+		base:       base,
+		start:      base.Now(),
+		sleepUntil: ^uint64(0),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// goRun drives the wheel until closed is closed
+func (w *timerWheel) goRun(closed <-chan struct{}) {
+	for {
+		now := w.base.Now()
+		wait := w.process(now)
+		var next <-chan time.Time
+		if wait > 0 {
+			next = w.base.After(wait)
+		}
+		select {
+		case <-next:
+		case <-w.wake:
+		case _, _ = <-closed:
+			return
+		}
+	}
+}
+
+// process fires every timer that's come due by now, returning how long until the wheel next needs attention (or zero
+// if nothing is waiting)
+func (w *timerWheel) process(now time.Time) time.Duration {
+	var fired []*wheelTimer
+	w.prot.Lock()
+	target := uint64(0)
+	if now.After(w.start) {
+		target = uint64(now.Sub(w.start) / wheelTick)
+	}
+	for w.now < target {
+		// nothing happens until the next tick with something to do, so skip straight there
+		next := w.nextTick()
+		if next > target {
+			w.now = target
+			break
+		}
+		w.now = next - 1
+		fired = w.step(fired)
+	}
+	var wait time.Duration
+	w.sleepUntil = ^uint64(0)
+	if w.count > 0 {
+		w.sleepUntil = w.nextTick()
+		wait = w.start.Add(time.Duration(w.sleepUntil) * wheelTick).Sub(now)
+	}
+	w.prot.Unlock()
+
+	for _, t := range fired {
+		t.fire(now)
+	}
+	return wait
+}
+
+// step advances the wheel by a single tick, appending the timers that fire to fired.  w.prot must be held
+func (w *timerWheel) step(fired []*wheelTimer) []*wheelTimer {
+	w.now++
+	for level := 1; level < wheelLevels && w.now&(uint64(1)<<(wheelBits*uint(level))-1) == 0; level++ {
+		idx := int(w.now>>(wheelBits*uint(level))) & wheelMask
+		for t := w.slots[level][idx]; t != nil; {
+			next := t.next
+			w.remove(t)
+			w.add(t)
+			t = next
+		}
+	}
+
+	idx := int(w.now) & wheelMask
+	for t := w.slots[0][idx]; t != nil; {
+		next := t.next
+		w.remove(t)
+		if t.period > 0 {
+			t.deadline = w.now + w.ticks(t.period)
+			w.add(t)
+		}
+		fired = append(fired, t)
+		t = next
+	}
+	return fired
+}
+
+// nextTick returns the next tick that has timers to fire or to cascade down from a higher level.  w.prot must be held
+func (w *timerWheel) nextTick() uint64 {
+	next := (w.now | wheelMask) + 1
+	for tick := w.now + 1; tick < next; tick++ {
+		if w.slots[0][int(tick)&wheelMask] != nil {
+			return tick
+		}
+	}
+	return next
+}
+
+// ticks returns the number of ticks a timer needs to wait to wait for at least d
+func (w *timerWheel) ticks(d time.Duration) uint64 {
+	if d <= 0 {
+		return 1
+	}
+	return uint64((d + wheelTick - 1) / wheelTick)
+}
+
+// add places a timer into the slot it's waiting in.  w.prot must be held
+func (w *timerWheel) add(t *wheelTimer) {
+	if t.deadline <= w.now {
+		t.deadline = w.now + 1
+	}
+	pos := t.deadline
+	if pos-w.now >= wheelSpan {
+		pos = w.now + wheelSpan - 1 // beyond the reach of the wheel, park it in the farthest slot until it comes around
+	}
+	level := 0
+	for level < wheelLevels-1 && pos-w.now >= uint64(1)<<(wheelBits*uint(level+1)) {
+		level++
+	}
+	t.level = level
+	t.idx = int(pos>>(wheelBits*uint(level))) & wheelMask
+	t.prev = nil
+	t.next = w.slots[level][t.idx]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.slots[level][t.idx] = t
+	t.queued = true
+	w.count++
+}
+
+// remove takes a timer out of its slot, returning false if it wasn't waiting.  w.prot must be held
+func (w *timerWheel) remove(t *wheelTimer) bool {
+	if !t.queued {
+		return false
+	}
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.level][t.idx] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev = nil
+	t.next = nil
+	t.queued = false
+	w.count--
+	return true
+}
+
+// schedule adds a timer to fire after d, waking the wheel's goroutine if it's due before it expected to wake
+func (w *timerWheel) schedule(t *wheelTimer, d time.Duration) *wheelTimer {
+	w.prot.Lock()
+	w.remove(t)
+	t.deadline = w.now + w.ticks(w.base.Now().Add(d).Sub(w.start.Add(time.Duration(w.now)*wheelTick)))
+	w.add(t)
+	wake := t.deadline < w.sleepUntil
+	w.prot.Unlock()
+
+	if wake {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return t
+}
+
+// afterFunc calls f (from the wheel's goroutine, so it must not block) after d
+func (w *timerWheel) afterFunc(d time.Duration, f func(now time.Time)) *wheelTimer {
+	return w.schedule(&wheelTimer{wheel: w, fire: f}, d)
+}
+
+// newTimer creates a timer that sends on a channel when it fires (repeatedly, if period is set)
+func (w *timerWheel) newTimer(d time.Duration, period time.Duration) *wheelTimer {
+	t := &wheelTimer{wheel: w, period: period, c: make(chan time.Time, 1)}
+	t.fire = func(now time.Time) {
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+	return w.schedule(t, d)
+}
+
+// Now returns the current time (from the clock driving this wheel)
+func (w *timerWheel) Now() time.Time {
+	return w.base.Now()
+}
+
+// After sends the current time on the returned channel after d
+func (w *timerWheel) After(d time.Duration) <-chan time.Time {
+	return w.newTimer(d, 0).c
+}
+
+// AfterFunc calls f in its own goroutine after d
+func (w *timerWheel) AfterFunc(d time.Duration, f func()) Timer {
+	return w.afterFunc(d, func(time.Time) { go f() })
+}
+
+// NewTimer sends the current time on the Timer's channel after d
+func (w *timerWheel) NewTimer(d time.Duration) Timer {
+	return w.newTimer(d, 0)
+}
+
+// NewTicker sends the current time on the Ticker's channel every d
+func (w *timerWheel) NewTicker(d time.Duration) Ticker {
+	return wheelTicker{w.newTimer(d, d)}
+}
+
+func (t *wheelTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *wheelTimer) Stop() bool {
+	t.wheel.prot.Lock()
+	defer t.wheel.prot.Unlock()
+	return t.wheel.remove(t)
+}
+
+func (t *wheelTimer) Reset(d time.Duration) bool {
+	t.wheel.prot.Lock()
+	wasActive := t.queued
+	t.wheel.prot.Unlock()
+	t.wheel.schedule(t, d)
+	return wasActive
+}
+
+type wheelTicker struct {
+	*wheelTimer
+}
+
+func (t wheelTicker) Stop() {
+	t.wheelTimer.Stop()
+}
@@ -0,0 +1,62 @@
+package udt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimerWheel(t *testing.T) {
+	clock := newManualClock()
+	w := newTimerWheel(clock)
+
+	var fired []time.Duration
+	delays := []time.Duration{2 * time.Hour, 5 * time.Second, 70 * time.Millisecond, 5 * time.Millisecond, 5 * time.Hour}
+	for _, d := range delays {
+		d := d
+		w.afterFunc(d, func(time.Time) { fired = append(fired, d) })
+	}
+	stopped := w.newTimer(time.Second, 0)
+	if !stopped.Stop() {
+		t.Error("expected Stop to find the timer waiting")
+	}
+	ticker := w.newTimer(time.Second, time.Second)
+
+	start := clock.Now()
+	for len(fired) < len(delays) {
+		if clock.Now().Sub(start) > 6*time.Hour {
+			t.Fatalf("timers didn't fire, only saw %v", fired)
+		}
+		wait := w.process(clock.Now())
+		if wait <= 0 {
+			t.Fatal("wheel has timers waiting but doesn't expect to need attention")
+		}
+		if len(fired) > 0 && clock.Now().Sub(start) < fired[len(fired)-1] {
+			t.Errorf("timer for %v fired early (after %v)", fired[len(fired)-1], clock.Now().Sub(start))
+		}
+		if wait > time.Minute {
+			wait = time.Minute // long enough to skip ahead, short enough to notice timers firing late
+		}
+		clock.advance(wait)
+	}
+	for idx, d := range []time.Duration{5 * time.Millisecond, 70 * time.Millisecond, 5 * time.Second, 2 * time.Hour, 5 * time.Hour} {
+		if fired[idx] != d {
+			t.Errorf("expected timers to fire in order, got %v", fired)
+			break
+		}
+	}
+
+	select {
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	select {
+	case <-ticker.C():
+	default:
+		t.Error("ticker never fired")
+	}
+	ticker.Stop()
+	if wait := w.process(clock.Now()); wait != 0 {
+		t.Errorf("wheel still expects to need attention (in %v) with nothing waiting", wait)
+	}
+}
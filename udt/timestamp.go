@@ -0,0 +1,65 @@
+package udt
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+const maxKernelRxAge = time.Second // kernel receive timestamps older than this (or in the future) are assumed bogus
+
+/*
+With Config.KernelTimestamps the kernel records when each datagram arrived (where supported), rather than us taking
+the time once the packet has made its way through the multiplexer's read loop and the socket's channels.  The
+measurements taken from packet arrivals (the receive rate and the packet pair estimate of link capacity) are sensitive
+to this, especially under load.
+
+Kernel timestamps are read from the wall clock, so we only ever use them to measure how long ago a packet arrived,
+which is then subtracted from the socket's own (monotonic) clock.
+*/
+
+// enableTimestamps turns on kernel receive timestamps for this multiplexer, if it hasn't been done already
+func (m *multiplexer) enableTimestamps() {
+	if m.timestamps.get() != 0 {
+		return
+	}
+	conns := m.udpReaders()
+	if len(conns) == 0 {
+		return
+	}
+	for _, uc := range conns {
+		if err := enableKernelTimestamps(uc); err != nil {
+			log.Printf("%s unable to enable kernel timestamps: %s", m.laddr.String(), err.Error())
+			return
+		}
+	}
+	m.timestamps.set(1)
+}
+
+// readFrom reads the next datagram from conn (the underlying connection or one of its readers), along with how long ago
+// it arrived (zero if kernel timestamps aren't in use), its ECN bits (ecnNotECT if ECN isn't in use), and the size of
+// the packets the kernel coalesced into it (zero if it's a single packet)
+func (m *multiplexer) readFrom(conn net.PacketConn, buf []byte, oob []byte) (n int, from net.Addr, rxAge time.Duration,
+	ecn byte, segSize int, err error) {
+	uc, ok := conn.(*net.UDPConn)
+	if !ok || (m.timestamps.get() == 0 && m.ecn.get() == 0 && m.gso.get() == 0) {
+		n, from, err = conn.ReadFrom(buf)
+		return
+	}
+
+	var oobn int
+	var addr *net.UDPAddr
+	n, oobn, _, addr, err = uc.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return
+	}
+	from = addr
+	if rxTime, ok := parseKernelTimestamp(oob[:oobn]); ok {
+		if rxAge = time.Since(rxTime); rxAge < 0 || rxAge > maxKernelRxAge {
+			rxAge = 0
+		}
+	}
+	ecn, _ = parseECN(oob[:oobn])
+	segSize, _ = parseGROSize(oob[:oobn])
+	return
+}
@@ -0,0 +1,42 @@
+package udt
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const kernelTimestampOOBSize = 64 // room for a single SCM_TIMESTAMPNS control message
+
+// enableKernelTimestamps asks the kernel to attach the time each datagram was received
+func enableKernelTimestamps(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// parseKernelTimestamp extracts the receive time from the control messages accompanying a datagram
+func parseKernelTimestamp(oob []byte) (time.Time, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == syscall.SOL_SOCKET && msg.Header.Type == syscall.SCM_TIMESTAMPNS &&
+			len(msg.Data) >= int(unsafe.Sizeof(syscall.Timespec{})) {
+			ts := (*syscall.Timespec)(unsafe.Pointer(&msg.Data[0]))
+			return time.Unix(ts.Unix()), true
+		}
+	}
+	return time.Time{}, false
+}
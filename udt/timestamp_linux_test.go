@@ -0,0 +1,39 @@
+package udt
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKernelTimestamps(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error calling ListenUDP: %s", err.Error())
+	}
+	defer conn.Close()
+	if err = enableKernelTimestamps(conn); err != nil {
+		t.Fatalf("unable to enable kernel timestamps: %s", err.Error())
+	}
+
+	m := &multiplexer{conn: conn}
+	m.timestamps.set(1)
+	before := time.Now()
+	if _, err = conn.WriteTo([]byte{1, 2, 3}, conn.LocalAddr()); err != nil {
+		t.Fatalf("error calling WriteTo: %s", err.Error())
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	buf := make([]byte, 16)
+	n, from, rxAge, _, _, err := m.readFrom(m.conn, buf, make([]byte, kernelTimestampOOBSize))
+	if err != nil {
+		t.Fatalf("error reading datagram: %s", err.Error())
+	}
+	if n != 3 || from.String() != conn.LocalAddr().String() {
+		t.Errorf("expected a 3 byte datagram from %s, got %d bytes from %s", conn.LocalAddr(), n, from)
+	}
+	// the datagram arrived before we got around to reading it (how long before depends on when the kernel stamps it)
+	if rxAge < 0 || rxAge > time.Since(before) {
+		t.Errorf("expected the datagram to have arrived in the last %v, got %v ago", time.Since(before), rxAge)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package udt
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+const kernelTimestampOOBSize = 0
+
+// enableKernelTimestamps asks the kernel to attach the time each datagram was received
+func enableKernelTimestamps(conn *net.UDPConn) error {
+	return errors.New("kernel timestamps are not supported on this platform")
+}
+
+// parseKernelTimestamp extracts the receive time from the control messages accompanying a datagram
+func parseKernelTimestamp(oob []byte) (time.Time, bool) {
+	return time.Time{}, false
+}
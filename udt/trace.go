@@ -0,0 +1,239 @@
+package udt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Config.Tracer is passed every packet sent or received on a local address, timestamped as it was handed to or arrived
+from the underlying connection (by the kernel, if Config.KernelTimestamps is set), for following a connection at the
+wire level.  TextTracer writes a line describing each packet, and PcapTracer writes a capture file that Wireshark's UDT
+dissector understands (enable its heuristic for UDP, or use Decode As on the connection's ports), so that captures
+taken at both ends of a connection can be lined up and compared.
+
+The tracer is shared by everything on the address, and is called from its reading and writing goroutines, so it must
+be safe for concurrent use and should return promptly.  As with the other settings shared by an address, the most
+recent Config to set it wins.
+*/
+
+// PacketTracer is passed every packet sent or received on a local address (see Config.Tracer)
+type PacketTracer interface {
+	TracePacket(p *TracedPacket)
+}
+
+// TracedPacket is a packet sent or received, as passed to a PacketTracer.  It's only valid for the duration of the call
+type TracedPacket struct {
+	Time   time.Time     // when the packet was handed to (or arrived from) the underlying connection
+	Sent   bool          // whether we sent the packet, rather than received it
+	Local  *net.UDPAddr  // our address
+	Remote *net.UDPAddr  // the address of our peer
+	Data   []byte        // the packet as carried in the UDP datagram
+	Packet packet.Packet // the decoded packet (nil if it couldn't be decoded)
+}
+
+// tracerRef holds a multiplexer's PacketTracer, as atomic.Value requires its values to all be of the same type
+type tracerRef struct {
+	tracer PacketTracer
+}
+
+// setTracer passes every packet sent or received from now on to the specified tracer
+func (m *multiplexer) setTracer(tracer PacketTracer) {
+	m.tracer.Store(tracerRef{tracer: tracer})
+}
+
+// trace passes a packet that was sent or received age ago to our tracer, if we have one
+func (m *multiplexer) trace(sent bool, age time.Duration, remote *net.UDPAddr, data []byte, p packet.Packet) {
+	ref, _ := m.tracer.Load().(tracerRef)
+	if ref.tracer == nil {
+		return
+	}
+	ref.tracer.TracePacket(&TracedPacket{Time: time.Now().Add(-age), Sent: sent, Local: m.laddr, Remote: remote,
+		Data: data, Packet: p})
+}
+
+// TextTracer is a PacketTracer writing a line describing each packet, such as:
+//
+//	2006-01-02T15:04:05.000000000Z 10.0.0.1:9000 > 10.0.0.2:9001 len=44 ack(dst=1234 ts=5678 ...)
+//
+// The first write that fails stops the tracer (see Err)
+type TextTracer struct {
+	prot sync.Mutex // lock must be held before writing to w or referencing err
+	w    io.Writer
+	err  error
+}
+
+// NewTextTracer returns a PacketTracer writing a line describing each packet to w
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+// TracePacket writes a line describing a packet
+func (t *TextTracer) TracePacket(p *TracedPacket) {
+	src, dst := p.Local, p.Remote
+	if !p.Sent {
+		src, dst = dst, src
+	}
+	desc := "undecodable"
+	if p.Packet != nil {
+		desc = fmt.Sprint(p.Packet)
+	}
+	line := fmt.Sprintf("%s %s > %s len=%d %s\n", p.Time.UTC().Format("2006-01-02T15:04:05.000000000Z07:00"), src, dst,
+		len(p.Data), desc)
+
+	t.prot.Lock()
+	defer t.prot.Unlock()
+	if t.err == nil {
+		_, t.err = io.WriteString(t.w, line)
+	}
+}
+
+// Err returns the error that stopped the tracer, if any
+func (t *TextTracer) Err() error {
+	t.prot.Lock()
+	defer t.prot.Unlock()
+	return t.err
+}
+
+const (
+	pcapMagicNanos = 0xa1b23c4d // pcap file with nanosecond timestamps
+	pcapLinkRaw    = 101        // LINKTYPE_RAW: each packet starts with its IPv4 or IPv6 header
+	pcapSnapLen    = 65535
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+)
+
+// PcapTracer is a PacketTracer writing packets to a pcap capture file, with an IP and UDP header made up for each
+// from the addresses it was sent between.  The first write that fails stops the tracer (see Err)
+type PcapTracer struct {
+	prot sync.Mutex // lock must be held before writing to w or referencing buf or err
+	w    io.Writer
+	buf  []byte
+	err  error
+	ipID uint16 // the IPv4 identification field of the last packet
+}
+
+// NewPcapTracer returns a PacketTracer writing packets to w as a pcap capture file, starting with the file's header
+func NewPcapTracer(w io.Writer) (*PcapTracer, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicNanos)
+	binary.LittleEndian.PutUint16(hdr[4:], 2) // version 2.4
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], pcapLinkRaw)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &PcapTracer{w: w}, nil
+}
+
+// TracePacket writes a packet to the capture file
+func (t *PcapTracer) TracePacket(p *TracedPacket) {
+	src, dst := p.Local, p.Remote
+	if !p.Sent {
+		src, dst = dst, src
+	}
+
+	t.prot.Lock()
+	defer t.prot.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.ipID++
+	t.buf = appendIPPacket(append(t.buf[:0], make([]byte, 16)...), src, dst, t.ipID, p.Data)
+	recLen := len(t.buf) - 16
+	if recLen > pcapSnapLen {
+		t.buf = t.buf[:16+pcapSnapLen]
+	}
+	binary.LittleEndian.PutUint32(t.buf[0:], uint32(p.Time.Unix()))
+	binary.LittleEndian.PutUint32(t.buf[4:], uint32(p.Time.Nanosecond()))
+	binary.LittleEndian.PutUint32(t.buf[8:], uint32(len(t.buf)-16))
+	binary.LittleEndian.PutUint32(t.buf[12:], uint32(recLen))
+	_, t.err = t.w.Write(t.buf)
+}
+
+// Err returns the error that stopped the tracer, if any
+func (t *PcapTracer) Err() error {
+	t.prot.Lock()
+	defer t.prot.Unlock()
+	return t.err
+}
+
+// appendIPPacket appends a UDP datagram carrying payload from src to dst to buf, with its IP and UDP headers.  It's an
+// IPv4 packet if dst is an IPv4 address, and otherwise IPv6
+func appendIPPacket(buf []byte, src, dst *net.UDPAddr, ipID uint16, payload []byte) []byte {
+	udpLen := udpHeaderSize + len(payload)
+	var srcIP, dstIP net.IP
+	if dst4 := dst.IP.To4(); dst4 != nil {
+		srcIP, dstIP = src.IP.To4(), dst4
+		if srcIP == nil {
+			srcIP = net.IPv4zero.To4() // an IPv6 socket talking to an IPv4 peer, without a specific local address
+		}
+		hdr := make([]byte, ipv4HeaderSize)
+		hdr[0] = 0x45 // version 4, 5 words of header
+		binary.BigEndian.PutUint16(hdr[2:], uint16(ipv4HeaderSize+udpLen))
+		binary.BigEndian.PutUint16(hdr[4:], ipID)
+		binary.BigEndian.PutUint16(hdr[6:], 0x4000) // don't fragment
+		hdr[8] = 64                                 // time to live
+		hdr[9] = 17                                 // UDP
+		copy(hdr[12:], srcIP)
+		copy(hdr[16:], dstIP)
+		binary.BigEndian.PutUint16(hdr[10:], ^onesSum(0, hdr))
+		buf = append(buf, hdr...)
+	} else {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		if srcIP == nil {
+			srcIP = net.IPv6unspecified
+		}
+		hdr := make([]byte, ipv6HeaderSize)
+		hdr[0] = 0x60 // version 6
+		binary.BigEndian.PutUint16(hdr[4:], uint16(udpLen))
+		hdr[6] = 17 // UDP
+		hdr[7] = 64 // hop limit
+		copy(hdr[8:], srcIP)
+		copy(hdr[24:], dstIP)
+		buf = append(buf, hdr...)
+	}
+
+	udp := make([]byte, udpHeaderSize)
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpLen))
+
+	// the checksum covers a pseudo-header of the addresses, protocol and length along with the datagram itself
+	sum := onesSum(0, srcIP)
+	sum = onesSum(sum, dstIP)
+	sum = onesSum(sum, []byte{0, 17, byte(udpLen >> 8), byte(udpLen)})
+	sum = onesSum(sum, udp)
+	csum := ^onesSum(sum, payload)
+	if csum == 0 {
+		csum = 0xffff // zero means no checksum was computed
+	}
+	binary.BigEndian.PutUint16(udp[6:], csum)
+	buf = append(buf, udp...)
+	return append(buf, payload...)
+}
+
+// onesSum adds data to a ones' complement sum of 16-bit words, as used by IP and UDP checksums.  As data is padded
+// with a zero byte if it's of odd length, only the last call may pass an odd length
+func onesSum(sum uint16, data []byte) uint16 {
+	acc := uint32(sum)
+	for len(data) >= 2 {
+		acc += uint32(data[0])<<8 | uint32(data[1])
+		data = data[2:]
+	}
+	if len(data) > 0 {
+		acc += uint32(data[0]) << 8
+	}
+	for acc > 0xffff {
+		acc = acc>>16 + acc&0xffff
+	}
+	return uint16(acc)
+}
@@ -0,0 +1,114 @@
+package udt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// traceBuffer collects what a tracer writes, safe to read while it's still being written to
+type traceBuffer struct {
+	prot sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *traceBuffer) Write(p []byte) (int, error) {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *traceBuffer) String() string {
+	b.prot.Lock()
+	defer b.prot.Unlock()
+	return b.buf.String()
+}
+
+func TestTextTracer(t *testing.T) {
+	var out traceBuffer
+	config := DefaultConfig()
+	config.Tracer = NewTextTracer(&out)
+	a, b := config.Pipe()
+	defer a.Close()
+	defer b.Close()
+	echoOnce(t, a, b, "hello")
+
+	var handshakes, data bool
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[2] != ">" || !strings.HasPrefix(fields[4], "len=") {
+			t.Fatalf("unexpected trace line %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Errorf("unexpected timestamp in trace line %q: %s", line, err.Error())
+		}
+		handshakes = handshakes || strings.HasPrefix(fields[5], "handshake(")
+		data = data || (strings.HasPrefix(fields[5], "data(") && strings.HasSuffix(line, "len=5)"))
+	}
+	if !handshakes || !data {
+		t.Errorf("expected the handshakes and the data to be traced:\n%s", out.String())
+	}
+}
+
+func TestPcapTracer(t *testing.T) {
+	var out bytes.Buffer
+	tracer, err := NewPcapTracer(&out)
+	if err != nil {
+		t.Fatalf("error creating tracer: %s", err.Error())
+	}
+	local := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 9000}
+	remote := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9001}
+	at := time.Unix(1500000000, 123456789)
+	payload := []byte("odd-length payload")
+	tracer.TracePacket(&TracedPacket{Time: at, Sent: false, Local: local, Remote: remote, Data: payload})
+	tracer.TracePacket(&TracedPacket{Time: at, Sent: true, Local: &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 9000},
+		Remote: &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 9001}, Data: payload})
+
+	file := out.Bytes()
+	if len(file) < 24 || binary.LittleEndian.Uint32(file) != pcapMagicNanos || binary.LittleEndian.Uint32(file[20:]) != pcapLinkRaw {
+		t.Fatalf("unexpected pcap file header % x", file[:24])
+	}
+	file = file[24:]
+
+	// a received IPv4 packet, from our peer to us
+	if binary.LittleEndian.Uint32(file) != 1500000000 || binary.LittleEndian.Uint32(file[4:]) != 123456789 {
+		t.Errorf("unexpected timestamp in record header % x", file[:16])
+	}
+	recLen := int(binary.LittleEndian.Uint32(file[8:]))
+	if recLen != ipv4HeaderSize+udpHeaderSize+len(payload) || int(binary.LittleEndian.Uint32(file[12:])) != recLen {
+		t.Fatalf("unexpected lengths in record header % x", file[:16])
+	}
+	ip := file[16 : 16+ipv4HeaderSize]
+	udp := file[16+ipv4HeaderSize : 16+recLen]
+	if !net.IP(ip[12:16]).Equal(remote.IP) || !net.IP(ip[16:20]).Equal(local.IP) || binary.BigEndian.Uint16(udp) != 9001 ||
+		binary.BigEndian.Uint16(udp[2:]) != 9000 || !bytes.Equal(udp[udpHeaderSize:], payload) {
+		t.Errorf("unexpected IPv4 packet % x", file[16:16+recLen])
+	}
+	if onesSum(0, ip) != 0xffff {
+		t.Errorf("bad IPv4 header checksum in % x", ip)
+	}
+	pseudo := append(append(append([]byte{}, ip[12:20]...), 0, 17), udp[4:6]...)
+	if onesSum(onesSum(0, pseudo), udp) != 0xffff {
+		t.Errorf("bad UDP checksum in % x", udp)
+	}
+	file = file[16+recLen:]
+
+	// a sent IPv6 packet
+	recLen = int(binary.LittleEndian.Uint32(file[8:]))
+	if recLen != ipv6HeaderSize+udpHeaderSize+len(payload) || len(file) != 16+recLen || file[16]>>4 != 6 {
+		t.Fatalf("unexpected IPv6 record % x", file)
+	}
+	ip = file[16 : 16+ipv6HeaderSize]
+	udp = file[16+ipv6HeaderSize:]
+	pseudo = append(append(append([]byte{}, ip[8:40]...), 0, 17), udp[4:6]...)
+	if onesSum(onesSum(0, pseudo), udp) != 0xffff {
+		t.Errorf("bad UDP checksum in % x", udp)
+	}
+}
@@ -0,0 +1,91 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+/*
+UDT connections normally run over a UDP socket this package opens for the local address.  NewMultiplexerWithConn runs
+them over a datagram transport supplied by the caller instead, such as a tunnel interface, a datagram channel of
+another protocol, or an in-memory pipe for tests.  The transport only needs to deliver datagrams (unreliably is fine,
+that's what UDT is for), and to identify its endpoints with *net.UDPAddr addresses, which it's free to make up.
+
+A Multiplexer isn't registered for its address, so it's only reachable through its own Listen, Dial and Rendezvous
+methods, and any number can use the same addresses.
+*/
+
+// Multiplexer carries UDT connections over a datagram transport supplied by the caller
+type Multiplexer struct {
+	m         *multiplexer
+	config    *Config
+	closeOnce sync.Once
+}
+
+// NewMultiplexerWithConn creates a Multiplexer carrying UDT connections over conn, whose addresses must be
+// *net.UDPAddr.  The settings of config (or DefaultConfig if nil) that apply to everything sharing a local address are
+// taken from it, and it's used for connections made through the Multiplexer.  From then on the Multiplexer owns conn,
+// closing it once Close has been called and every connection and listener using it has closed
+func NewMultiplexerWithConn(conn net.PacketConn, config *Config) (*Multiplexer, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	laddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("Connection has a %T address, must be a *net.UDPAddr", conn.LocalAddr())
+	}
+	m := newMultiplexer("udp", laddr, conn)
+	m.unlisted.set(1) // our reference to m is the one it was created with
+	m.configure(config)
+	return &Multiplexer{m: m, config: config}, nil
+}
+
+// Addr returns the local address of the transport
+func (mx *Multiplexer) Addr() net.Addr {
+	return mx.m.laddr
+}
+
+// Listen listens for incoming UDT connections arriving on the transport
+func (mx *Multiplexer) Listen() (net.Listener, error) {
+	if mx.m.isClosed() {
+		return nil, errors.New("Multiplexer closed")
+	}
+	return listenOn(mx.m, mx.config, "udp")
+}
+
+// Dial establishes an outbound UDT connection over the transport to raddr
+func (mx *Multiplexer) Dial(ctx context.Context, raddr net.Addr, isStream bool) (net.Conn, error) {
+	if mx.m.isClosed() {
+		return nil, &net.OpError{Op: "dial", Net: "udp", Source: nil, Addr: raddr, Err: errors.New("Multiplexer closed")}
+	}
+	udpAddr, err := udpAddrOf("udp", raddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "udp", Source: nil, Addr: raddr, Err: err}
+	}
+	return dialOn(ctx, mx.m, mx.config, "udp", udpAddr, isStream)
+}
+
+// Rendezvous establishes an outbound UDT connection over the transport with raddr, which must be doing the same
+func (mx *Multiplexer) Rendezvous(ctx context.Context, raddr net.Addr, isStream bool) (net.Conn, error) {
+	if mx.m.isClosed() {
+		return nil, &net.OpError{Op: "rendezvous", Net: "udp", Source: nil, Addr: raddr,
+			Err: errors.New("Multiplexer closed")}
+	}
+	udpAddr, err := udpAddrOf("udp", raddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "rendezvous", Net: "udp", Source: nil, Addr: raddr, Err: err}
+	}
+	return rendezvousOn(ctx, mx.m, mx.config, "udp", udpAddr, isStream)
+}
+
+// Close releases the transport once every connection and listener using it has closed (which may be immediately).
+// Connections that are still open are unaffected
+func (mx *Multiplexer) Close() error {
+	mx.closeOnce.Do(func() {
+		mx.m.release()
+	})
+	return nil
+}
@@ -0,0 +1,98 @@
+package udt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeTrackingConn is a datagram transport counting the packets sent through it, and noting when it's closed
+type closeTrackingConn struct {
+	net.PacketConn
+	sent   int64
+	closed int32
+}
+
+func (c *closeTrackingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	atomic.AddInt64(&c.sent, 1)
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func (c *closeTrackingConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return c.PacketConn.Close()
+}
+
+func newTrackingMultiplexer(t *testing.T, port int) (*Multiplexer, *closeTrackingConn) {
+	pc, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("error opening transport: %s", err.Error())
+	}
+	conn := &closeTrackingConn{PacketConn: pc}
+	config := DefaultConfig()
+	config.LingerTime = 100 * time.Millisecond
+	mx, err := NewMultiplexerWithConn(conn, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	return mx, conn
+}
+
+func TestMultiplexerWithConn(t *testing.T) {
+	servMx, servConn := newTrackingMultiplexer(t, serverPort+84)
+	clientMx, clientConn := newTrackingMultiplexer(t, serverPort+85)
+
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := clientMx.Dial(ctx, servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	l.Close()
+
+	// releasing the multiplexers doesn't affect the connections still using them
+	servMx.Close()
+	clientMx.Close()
+	if _, err := clientMx.Dial(ctx, servMx.Addr(), true); err == nil {
+		t.Error("expected an error dialing from a closed multiplexer")
+	}
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("read %q, %v", buf[:n], err)
+	}
+	if atomic.LoadInt64(&servConn.sent) == 0 || atomic.LoadInt64(&clientConn.sent) == 0 {
+		t.Error("expected packets to be sent through the supplied transports")
+	}
+	if atomic.LoadInt32(&clientConn.closed) != 0 {
+		t.Error("transport closed while a connection was still using it")
+	}
+
+	// the transports are closed once their last connection is
+	client.Close()
+	server.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&servConn.closed) == 0 || atomic.LoadInt32(&clientConn.closed) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("transports weren't closed after their connections were")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
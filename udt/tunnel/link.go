@@ -0,0 +1,231 @@
+/*
+Package tunnel forwards TCP connections over UDT, using a single UDT connection between two gateways as a
+high-throughput link over long or lossy network paths.  Each TCP connection is carried as a separate stream, with
+the streams multiplexed over the UDT connection in frames:
+
+	stream ID (4 bytes) | frame type (1 byte) | payload length (2 bytes) | payload
+
+A stream is opened by the first frame sent for it.  Either side may finish sending on a stream (which its peer reads
+as end-of-file) independently of the other, and the stream is done once both have.  A stream may also be reset,
+abandoning it in both directions.
+
+ListenAndForward is run on the gateway close to the TCP clients, and ListenAndServe on the gateway close to the TCP
+server they are connecting to.
+*/
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+type frameType uint8
+
+const (
+	frameOpen  frameType = iota // opens a new stream
+	frameData                   // carries data on a stream
+	frameFin                    // the sender won't send anything more on a stream
+	frameReset                  // the sender has abandoned a stream
+)
+
+const (
+	frameHeaderSize = 7         // size of the header preceding each frame's payload
+	maxFramePayload = 16 * 1024 // largest payload we place in a single frame
+	streamQueueSize = 64        // number of frames received for a stream before the link waits for it to be read
+	acceptQueueSize = 64        // number of newly opened streams waiting to be accepted before more are refused
+)
+
+var (
+	// ErrLinkClosed is returned from operations on streams of a link that has been closed
+	ErrLinkClosed = errors.New("tunnel link closed")
+	// ErrStreamReset is returned from operations on a stream that has been abandoned by either side
+	ErrStreamReset = errors.New("tunnel stream reset")
+)
+
+// Link multiplexes streams over a single connection (normally a UDT stream connection)
+type Link struct {
+	conn      net.Conn
+	writeProt sync.Mutex // lock must be held while writing a frame to conn (or closing it)
+
+	prot    sync.Mutex         // lock must be held before referencing streams/nextID/err
+	streams map[uint32]*Stream // open streams, by ID
+	nextID  uint32             // ID of the next stream we open
+	err     error              // if set, the reason this link was closed
+
+	accept chan *Stream  // streams opened by our peer, waiting to be accepted
+	closed chan struct{} // closed once this link has been closed
+}
+
+// NewLink starts multiplexing streams over the specified connection.  The two ends of a link must pass different
+// values of isDialer, so the streams they open have distinct IDs
+func NewLink(conn net.Conn, isDialer bool) *Link {
+	l := &Link{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		accept:  make(chan *Stream, acceptQueueSize),
+		closed:  make(chan struct{}),
+		nextID:  2,
+	}
+	if isDialer {
+		l.nextID = 1
+	}
+	go l.goReadFrames()
+	return l
+}
+
+// Open opens a new stream to our peer
+func (l *Link) Open() (*Stream, error) {
+	l.prot.Lock()
+	if l.err != nil {
+		l.prot.Unlock()
+		return nil, l.err
+	}
+	s := newStream(l, l.nextID)
+	l.nextID += 2
+	l.streams[s.id] = s
+	l.prot.Unlock()
+
+	if err := l.writeFrame(s.id, frameOpen, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept waits for our peer to open a stream, and returns it
+func (l *Link) Accept() (*Stream, error) {
+	select {
+	case s := <-l.accept:
+		return s, nil
+	case <-l.closed:
+		return nil, l.closeErr()
+	}
+}
+
+// Close closes the link along with all of its streams
+func (l *Link) Close() error {
+	l.fail(ErrLinkClosed)
+	return nil
+}
+
+// Done returns a channel that is closed once the link has been closed
+func (l *Link) Done() <-chan struct{} {
+	return l.closed
+}
+
+func (l *Link) closeErr() error {
+	l.prot.Lock()
+	defer l.prot.Unlock()
+	return l.err
+}
+
+// fail closes the link for the specified reason (if it isn't already closed)
+func (l *Link) fail(err error) {
+	l.prot.Lock()
+	if l.err != nil {
+		l.prot.Unlock()
+		return
+	}
+	l.err = err
+	l.streams = nil
+	l.prot.Unlock()
+
+	close(l.closed)
+
+	// wait for any write in progress, so nothing is written once the connection is closed
+	l.writeProt.Lock()
+	l.conn.Close()
+	l.writeProt.Unlock()
+}
+
+// writeFrame sends a single frame to our peer
+func (l *Link) writeFrame(id uint32, typ frameType, payload []byte) error {
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], id)
+	buf[4] = byte(typ)
+	binary.BigEndian.PutUint16(buf[5:7], uint16(len(payload)))
+	copy(buf[frameHeaderSize:], payload)
+
+	l.writeProt.Lock()
+	select {
+	case <-l.closed:
+		l.writeProt.Unlock()
+		return l.closeErr()
+	default:
+	}
+	_, err := l.conn.Write(buf)
+	l.writeProt.Unlock()
+	if err != nil {
+		l.fail(err)
+		return l.closeErr()
+	}
+	return nil
+}
+
+// goReadFrames reads frames from our peer and passes them along to their streams until the link is closed
+func (l *Link) goReadFrames() {
+	hdr := make([]byte, frameHeaderSize)
+	for {
+		if _, err := io.ReadFull(l.conn, hdr); err != nil {
+			l.fail(err)
+			return
+		}
+		id := binary.BigEndian.Uint32(hdr[0:4])
+		typ := frameType(hdr[4])
+		payload := make([]byte, binary.BigEndian.Uint16(hdr[5:7]))
+		if _, err := io.ReadFull(l.conn, payload); err != nil {
+			l.fail(err)
+			return
+		}
+
+		if typ == frameOpen {
+			l.opened(id)
+			continue
+		}
+		l.prot.Lock()
+		s := l.streams[id]
+		l.prot.Unlock()
+		if s == nil {
+			continue // we've already forgotten about this stream
+		}
+		switch typ {
+		case frameData:
+			if !s.deliver(payload) {
+				return
+			}
+		case frameFin:
+			s.peerFinished()
+		case frameReset:
+			s.abandon(false)
+		}
+	}
+}
+
+// opened is called when our peer opens a stream
+func (l *Link) opened(id uint32) {
+	s := newStream(l, id)
+	l.prot.Lock()
+	if l.streams == nil || l.streams[id] != nil {
+		l.prot.Unlock()
+		return
+	}
+	l.streams[id] = s
+	l.prot.Unlock()
+
+	select {
+	case l.accept <- s:
+	default:
+		s.abandon(true) // too many streams waiting to be accepted
+	}
+}
+
+// forget removes a finished stream from the link
+func (l *Link) forget(s *Stream) {
+	l.prot.Lock()
+	defer l.prot.Unlock()
+	if l.streams[s.id] == s {
+		delete(l.streams, s.id)
+	}
+}
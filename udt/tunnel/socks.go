@@ -0,0 +1,294 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+/*
+In gateway mode, the forwarding side is a SOCKS5 proxy (RFC 1928, supporting the CONNECT command without
+authentication) and the serving side connects each stream to whatever destination the SOCKS client asked for, so
+unmodified applications can have their connections carried over the UDT link.  Each stream starts with the
+destination (a length byte followed by "host:port") sent by the forwarding side, answered by a single SOCKS reply
+code from the serving side once it has connected (or failed to).
+*/
+
+const socksVersion = 5
+
+// SOCKS5 reply codes
+const (
+	socksSucceeded          = 0
+	socksGeneralFailure     = 1
+	socksHostUnreachable    = 4
+	socksConnRefused        = 5
+	socksCmdNotSupported    = 7
+	socksAddrNotSupported   = 8
+	socksNoAcceptableMethod = 0xFF
+)
+
+// ListenAndServeSOCKS runs a SOCKS5 proxy on socksAddr, carrying each connection over a single UDT connection to
+// udtTarget (where ListenAndServeGateway should be running).  It returns once either the SOCKS listener or the UDT
+// connection fails
+func ListenAndServeSOCKS(socksAddr string, udtTarget string) error {
+	raddr, err := net.ResolveUDPAddr("udp", udtTarget)
+	if err != nil {
+		return err
+	}
+	conn, err := udt.DialUDTContext(context.Background(), "udp", "", raddr, true)
+	if err != nil {
+		return err
+	}
+	link := NewLink(conn, true)
+	defer link.Close()
+
+	l, err := net.Listen("tcp", socksAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return ServeSOCKS(l, link)
+}
+
+// ListenAndServeGateway accepts UDT connections from ListenAndServeSOCKS on udtAddr, connecting each stream carried
+// over them to the destination requested by its SOCKS client.  It returns once the UDT listener fails
+func ListenAndServeGateway(udtAddr string) error {
+	l, err := udt.ListenUDT("udp", udtAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			link := NewLink(conn, false)
+			defer link.Close()
+			err := ServeGateway(link, func(addr string) (net.Conn, error) {
+				return net.Dial("tcp", addr)
+			})
+			log.Printf("gateway link from %s closed: %s", conn.RemoteAddr().String(), err.Error())
+		}()
+	}
+}
+
+// ServeSOCKS accepts SOCKS5 clients from l, carrying each requested connection over its own stream on link.  It
+// returns once either the listener or the link fails (closing the other)
+func ServeSOCKS(l net.Listener, link *Link) error {
+	go func() {
+		<-link.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			link.Close()
+			if linkErr := link.closeErr(); linkErr != ErrLinkClosed {
+				return linkErr
+			}
+			return err
+		}
+		go serveSOCKSConn(conn, link)
+	}
+}
+
+// ServeGateway accepts streams from link, connecting each of them to the destination it requests using dial.  It
+// returns once the link fails
+func ServeGateway(link *Link, dial func(addr string) (net.Conn, error)) error {
+	for {
+		s, err := link.Accept()
+		if err != nil {
+			return err
+		}
+		go serveGatewayStream(s, dial)
+	}
+}
+
+// serveSOCKSConn negotiates with a single SOCKS client, then connects it to its destination through the link
+func serveSOCKSConn(conn net.Conn, link *Link) {
+	addr, err := readSOCKSRequest(conn)
+	if err != nil {
+		log.Printf("SOCKS request from %s refused: %s", conn.RemoteAddr().String(), err.Error())
+		conn.Close()
+		return
+	}
+
+	s, err := link.Open()
+	if err != nil {
+		writeSOCKSReply(conn, socksGeneralFailure)
+		conn.Close()
+		return
+	}
+	reply := byte(socksGeneralFailure)
+	if err = writeGatewayRequest(s, addr); err == nil {
+		reply, err = readGatewayReply(s)
+	}
+	if err != nil || reply != socksSucceeded {
+		writeSOCKSReply(conn, reply)
+		conn.Close()
+		s.Close()
+		return
+	}
+	if err := writeSOCKSReply(conn, socksSucceeded); err != nil {
+		conn.Close()
+		s.Close()
+		return
+	}
+	pipe(conn, s)
+}
+
+// serveGatewayStream connects a single stream to the destination it requests
+func serveGatewayStream(s *Stream, dial func(addr string) (net.Conn, error)) {
+	addr, err := readGatewayRequest(s)
+	if err != nil {
+		s.Close()
+		return
+	}
+	conn, err := dial(addr)
+	if err != nil {
+		log.Printf("gateway unable to connect to %s: %s", addr, err.Error())
+		s.Write([]byte{dialErrorReply(err)})
+		s.CloseWrite()
+		s.Close()
+		return
+	}
+	if _, err := s.Write([]byte{socksSucceeded}); err != nil {
+		conn.Close()
+		s.Close()
+		return
+	}
+	pipe(conn, s)
+}
+
+// readSOCKSRequest negotiates the authentication method and reads the destination of a SOCKS client's CONNECT
+// request, replying with an error if it's anything we don't support
+func readSOCKSRequest(conn net.Conn) (string, error) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	noAuth := false
+	for _, method := range methods {
+		noAuth = noAuth || method == 0
+	}
+	if !noAuth {
+		conn.Write([]byte{socksVersion, socksNoAcceptableMethod})
+		return "", errors.New("client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, 0}); err != nil {
+		return "", err
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	if req[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", req[0])
+	}
+	if req[1] != 1 { // CONNECT
+		writeSOCKSReply(conn, socksCmdNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 1: // IPv4
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3: // domain name
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", err
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	case 4: // IPv6
+		ip := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	default:
+		writeSOCKSReply(conn, socksAddrNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSOCKSReply answers a SOCKS client's request.  We don't reveal the address the gateway connected from
+func writeSOCKSReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion, reply, 0, 1, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// writeGatewayRequest asks the gateway to connect a stream to the specified destination
+func writeGatewayRequest(s *Stream, addr string) error {
+	if len(addr) > 255 {
+		return errors.New("destination address too long")
+	}
+	_, err := s.Write(append([]byte{byte(len(addr))}, addr...))
+	return err
+}
+
+// readGatewayRequest reads the destination a stream wants to be connected to
+func readGatewayRequest(s *Stream) (string, error) {
+	size := make([]byte, 1)
+	if _, err := io.ReadFull(s, size); err != nil {
+		return "", err
+	}
+	addr := make([]byte, size[0])
+	if _, err := io.ReadFull(s, addr); err != nil {
+		return "", err
+	}
+	return string(addr), nil
+}
+
+// readGatewayReply reads the gateway's answer to a connection request
+func readGatewayReply(s *Stream) (byte, error) {
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(s, reply); err != nil {
+		return socksGeneralFailure, err
+	}
+	return reply[0], nil
+}
+
+// dialErrorReply returns the SOCKS reply code describing why we couldn't connect to a destination
+func dialErrorReply(err error) byte {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return socksHostUnreachable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return socksConnRefused
+	}
+	return socksGeneralFailure
+}
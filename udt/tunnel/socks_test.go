@@ -0,0 +1,94 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+// socksConnect connects to a destination through a SOCKS5 proxy, returning the reply code
+func socksConnect(t *testing.T, proxy string, host string, port uint16) (net.Conn, byte) {
+	c, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatalf("error connecting to the proxy: %s", err.Error())
+	}
+	c.Write([]byte{5, 1, 0})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(c, method); err != nil || method[1] != 0 {
+		t.Fatalf("proxy didn't accept our authentication method: %v %v", method, err)
+	}
+
+	req := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], port)
+	c.Write(req)
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatalf("error reading the proxy's reply: %s", err.Error())
+	}
+	return c, reply[1]
+}
+
+func TestSOCKSGateway(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+
+	// the gateway
+	ul, err := udt.ListenUDT("udp", "127.0.0.1:9056")
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer ul.Close()
+	go func() {
+		conn, err := ul.Accept()
+		if err != nil {
+			return
+		}
+		link := NewLink(conn, false)
+		defer link.Close()
+		ServeGateway(link, func(addr string) (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		})
+	}()
+
+	// the proxy
+	conn, err := udt.DialUDTContext(context.Background(), "udp", "127.0.0.1:9057", ul.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	link := NewLink(conn, true)
+	defer link.Close()
+	sl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening for TCP: %s", err.Error())
+	}
+	go ServeSOCKS(sl, link)
+
+	echoPort := uint16(echo.Addr().(*net.TCPAddr).Port)
+	c, reply := socksConnect(t, sl.Addr().String(), "127.0.0.1", echoPort)
+	defer c.Close()
+	if reply != socksSucceeded {
+		t.Fatalf("proxy failed to connect, reply %d", reply)
+	}
+	msg := []byte("through the gateway")
+	c.Write(msg)
+	echoed := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, echoed); err != nil || !bytes.Equal(echoed, msg) {
+		t.Errorf("expected %q back, got %q (%v)", msg, echoed, err)
+	}
+
+	// a destination the gateway can't reach is reported to the client
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadPort := uint16(dead.Addr().(*net.TCPAddr).Port)
+	dead.Close()
+	c2, reply := socksConnect(t, sl.Addr().String(), "127.0.0.1", deadPort)
+	defer c2.Close()
+	if reply != socksConnRefused {
+		t.Errorf("expected connection refused, got reply %d", reply)
+	}
+}
@@ -0,0 +1,156 @@
+package tunnel
+
+import (
+	"io"
+	"sync"
+)
+
+// Stream is a single bidirectional stream carried over a Link
+type Stream struct {
+	link *Link
+	id   uint32
+
+	in      chan []byte   // data received from our peer. Closed once our peer has finished sending
+	partial []byte        // data received but not yet read. Owned by the caller (Read)
+	reset   chan struct{} // closed once the stream has been abandoned by either side
+
+	prot    sync.Mutex // lock must be held before referencing the following members
+	finSent bool       // we've finished sending on this stream
+	finRecv bool       // our peer has finished sending on this stream
+	isReset bool       // the stream has been abandoned
+}
+
+func newStream(l *Link, id uint32) *Stream {
+	return &Stream{
+		link:  l,
+		id:    id,
+		in:    make(chan []byte, streamQueueSize),
+		reset: make(chan struct{}),
+	}
+}
+
+// Read reads data sent by our peer, returning io.EOF once it has finished sending
+func (s *Stream) Read(p []byte) (int, error) {
+	if len(s.partial) == 0 {
+		select {
+		case data, ok := <-s.in:
+			if !ok {
+				return 0, io.EOF
+			}
+			s.partial = data
+		case <-s.reset:
+			return 0, ErrStreamReset
+		case <-s.link.closed:
+			return 0, s.link.closeErr()
+		}
+	}
+	n := copy(p, s.partial)
+	s.partial = s.partial[n:]
+	return n, nil
+}
+
+// Write sends data to our peer
+func (s *Stream) Write(p []byte) (n int, err error) {
+	s.prot.Lock()
+	finSent, isReset := s.finSent, s.isReset
+	s.prot.Unlock()
+	if isReset {
+		return 0, ErrStreamReset
+	}
+	if finSent {
+		return 0, io.ErrClosedPipe
+	}
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxFramePayload {
+			chunk = chunk[:maxFramePayload]
+		}
+		if err = s.link.writeFrame(s.id, frameData, chunk); err != nil {
+			return
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return
+}
+
+// CloseWrite tells our peer we won't send anything more on this stream, while continuing to read what it sends
+func (s *Stream) CloseWrite() error {
+	s.prot.Lock()
+	if s.finSent || s.isReset {
+		s.prot.Unlock()
+		return nil
+	}
+	s.finSent = true
+	done := s.finRecv
+	s.prot.Unlock()
+
+	if done {
+		s.link.forget(s)
+	}
+	return s.link.writeFrame(s.id, frameFin, nil)
+}
+
+// Close abandons the stream in both directions, unless both sides have already finished sending on it
+func (s *Stream) Close() error {
+	s.prot.Lock()
+	done := s.finSent && s.finRecv
+	s.prot.Unlock()
+	if !done {
+		s.abandon(true)
+	}
+	return nil
+}
+
+// deliver passes data received from our peer along to Read, returning false if the link was closed while waiting.
+// Only called from goReadFrames
+func (s *Stream) deliver(data []byte) bool {
+	s.prot.Lock()
+	finRecv := s.finRecv
+	s.prot.Unlock()
+	if finRecv {
+		return true // our peer shouldn't be sending anything more, ignore it
+	}
+	select {
+	case s.in <- data:
+	case <-s.reset:
+	case <-s.link.closed:
+		return false
+	}
+	return true
+}
+
+// peerFinished is called when our peer has finished sending on this stream.  Only called from goReadFrames
+func (s *Stream) peerFinished() {
+	s.prot.Lock()
+	if s.finRecv || s.isReset {
+		s.prot.Unlock()
+		return
+	}
+	s.finRecv = true
+	done := s.finSent
+	s.prot.Unlock()
+
+	close(s.in)
+	if done {
+		s.link.forget(s)
+	}
+}
+
+// abandon resets the stream, telling our peer about it if notify is set
+func (s *Stream) abandon(notify bool) {
+	s.prot.Lock()
+	if s.isReset {
+		s.prot.Unlock()
+		return
+	}
+	s.isReset = true
+	s.prot.Unlock()
+
+	close(s.reset)
+	s.link.forget(s)
+	if notify {
+		s.link.writeFrame(s.id, frameReset, nil)
+	}
+}
@@ -0,0 +1,140 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+// ListenAndForward accepts TCP connections on tcpAddr, forwarding each of them over a single UDT connection to
+// udtTarget (where ListenAndServe should be running).  It returns once either the TCP listener or the UDT connection
+// fails
+func ListenAndForward(tcpAddr string, udtTarget string) error {
+	raddr, err := net.ResolveUDPAddr("udp", udtTarget)
+	if err != nil {
+		return err
+	}
+	conn, err := udt.DialUDTContext(context.Background(), "udp", "", raddr, true)
+	if err != nil {
+		return err
+	}
+	link := NewLink(conn, true)
+	defer link.Close()
+
+	l, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return Forward(l, link)
+}
+
+// ListenAndServe accepts UDT connections from ListenAndForward on udtAddr, connecting each stream forwarded over them
+// to tcpTarget.  It returns once the UDT listener fails
+func ListenAndServe(udtAddr string, tcpTarget string) error {
+	l, err := udt.ListenUDT("udp", udtAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			link := NewLink(conn, false)
+			defer link.Close()
+			err := Serve(link, func() (net.Conn, error) {
+				return net.Dial("tcp", tcpTarget)
+			})
+			log.Printf("tunnel link from %s closed: %s", conn.RemoteAddr().String(), err.Error())
+		}()
+	}
+}
+
+// Forward accepts connections from l, forwarding each of them over its own stream on link.  It returns once either
+// the listener or the link fails (closing the other)
+func Forward(l net.Listener, link *Link) error {
+	go func() {
+		<-link.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			link.Close()
+			if linkErr := link.closeErr(); linkErr != ErrLinkClosed {
+				return linkErr
+			}
+			return err
+		}
+		s, err := link.Open()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		go pipe(conn, s)
+	}
+}
+
+// Serve accepts streams from link, connecting each of them to a connection obtained from dial.  It returns once the
+// link fails
+func Serve(link *Link, dial func() (net.Conn, error)) error {
+	for {
+		s, err := link.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			conn, err := dial()
+			if err != nil {
+				log.Printf("tunnel unable to connect stream: %s", err.Error())
+				s.Close()
+				return
+			}
+			pipe(conn, s)
+		}()
+	}
+}
+
+// closeWriter is implemented by connections that can finish sending while continuing to receive (such as
+// *net.TCPConn)
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies data in both directions between a connection and a stream until both directions are finished, then
+// closes them both
+func pipe(conn net.Conn, s *Stream) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(s, conn); err != nil {
+			s.Close()
+			return
+		}
+		s.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(conn, s); err != nil {
+			conn.Close()
+			return
+		}
+		if cw, ok := conn.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+	wg.Wait()
+	conn.Close()
+	s.Close()
+}
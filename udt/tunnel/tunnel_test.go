@@ -0,0 +1,98 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/odysseus654/go-udt/udt"
+)
+
+// echoServer answers each TCP connection with everything it sends
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening for TCP: %s", err.Error())
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.(*net.TCPConn).CloseWrite()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestForward(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+
+	// the serving gateway
+	ul, err := udt.ListenUDT("udp", "127.0.0.1:9054")
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer ul.Close()
+	go func() {
+		conn, err := ul.Accept()
+		if err != nil {
+			return
+		}
+		link := NewLink(conn, false)
+		defer link.Close()
+		Serve(link, func() (net.Conn, error) {
+			return net.Dial("tcp", echo.Addr().String())
+		})
+	}()
+
+	// the forwarding gateway
+	conn, err := udt.DialUDTContext(context.Background(), "udp", "127.0.0.1:9055", ul.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	link := NewLink(conn, true)
+	defer link.Close()
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening for TCP: %s", err.Error())
+	}
+	go Forward(tl, link)
+
+	// several connections share the link at once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := bytes.Repeat([]byte(fmt.Sprintf("connection %d ", i)), 5000)
+			c, err := net.Dial("tcp", tl.Addr().String())
+			if err != nil {
+				t.Errorf("error connecting to the tunnel: %s", err.Error())
+				return
+			}
+			defer c.Close()
+			go func() {
+				c.Write(data)
+				c.(*net.TCPConn).CloseWrite()
+			}()
+			echoed, err := ioutil.ReadAll(c)
+			if err != nil {
+				t.Errorf("error reading from the tunnel: %s", err.Error())
+			} else if !bytes.Equal(echoed, data) {
+				t.Errorf("connection %d: sent %d bytes, got %d different ones back", i, len(data), len(echoed))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -15,23 +15,137 @@ implemented:
 import (
 	"context"
 	"crypto/rand"
+	"io"
 	"log"
 	"math"
 	"math/big"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
+// Conn is implemented by all connections returned by this package, exposing functionality beyond that of net.Conn
+type Conn interface {
+	net.Conn
+	io.ReaderFrom // streams data from a reader in packet-sized chunks (used by io.Copy)
+	io.WriterTo   // streams received data to a writer as it arrives (used by io.Copy)
+
+	// Stats returns a snapshot of the performance metrics for this connection
+	Stats() Stats
+
+	// MuxStats returns a snapshot of the metrics for everything sharing this connection's local address
+	MuxStats() MuxStats
+
+	// ReadMessage reads the next message from a datagram connection, returning the message along with
+	// information about how it was delivered
+	ReadMessage() ([]byte, MessageInfo, error)
+
+	// ReadContext reads data from the connection as Read does, also giving up if ctx is cancelled
+	ReadContext(ctx context.Context, p []byte) (int, error)
+
+	// WriteContext writes data to the connection as Write does, also giving up if ctx is cancelled
+	WriteContext(ctx context.Context, p []byte) (int, error)
+
+	// PeekMessageSize returns the length of the next message on a datagram connection without removing it, waiting
+	// for one to arrive if necessary
+	PeekMessageSize() (int, error)
+
+	// WriteMessage sends a single message on a datagram connection.  If ttl is nonzero the message will be
+	// dropped if it cannot be delivered within that timeframe.  If inOrder is set the peer will not deliver
+	// this message until all prior messages have been delivered
+	WriteMessage(p []byte, ttl time.Duration, inOrder bool) (int, error)
+
+	// WriteMessageReceipt sends a single message on a datagram connection as WriteMessage does, returning a Receipt
+	// whose Done channel is closed once the peer has acknowledged the message (or it has been given up on)
+	WriteMessageReceipt(p []byte, ttl time.Duration, inOrder bool) (*Receipt, error)
+
+	// AddPath (experimental) attaches another local/remote address pair to an established connection, after which
+	// packets are scheduled across all of the connection's paths
+	AddPath(ctx context.Context, network string, laddr string, raddr *net.UDPAddr) error
+
+	// Paths returns measurements for each of the paths used by this connection
+	Paths() []PathStats
+
+	// SendControl sends an application-defined message to the peer outside of the data stream, which is passed to
+	// the peer's Config.OnControl callback.  Control messages are not retransmitted if lost and must fit in a single
+	// packet
+	SendControl(msgType uint16, data []byte) error
+
+	// WriteUnreliable sends a datagram to the peer alongside the connection's data, without retransmission or
+	// ordering.  The datagram must fit in a single packet
+	WriteUnreliable(p []byte) (int, error)
+
+	// ReadUnreliable returns the next datagram the peer sent with WriteUnreliable
+	ReadUnreliable() ([]byte, error)
+
+	// CloseWithError closes the connection immediately, abandoning anything not yet delivered.  The code and
+	// description are passed to the peer, whose Read and Write calls return them in a CloseError
+	CloseWithError(code CloseCode, message string) error
+
+	// SetOption changes one of the settings this connection took from its Config (see Option) while it's running
+	SetOption(name Option, value interface{}) error
+
+	// Session returns what's needed to resume this connection later with Config.Resume, skipping the listener's syn
+	// cookie exchange.  The listener must have Config.ResumptionLifetime set
+	Session() (*Session, error)
+
+	// SetNoDelay controls whether a stream connection sends each write as soon as it can (true), or holds back a
+	// partly filled packet for later writes to fill (false), see Config.CorkInterval
+	SetNoDelay(noDelay bool) error
+
+	// Capabilities returns the optional features in use on this connection, and those its peer advertised in its
+	// handshake (see Capability)
+	Capabilities() (active Capability, peer Capability)
+
+	// SendQueue returns how much this connection is holding that hasn't yet been delivered to its peer (waiting to be
+	// sent or acknowledged), along with the most it's held, for applications to apply their own admission control
+	SendQueue() SendQueue
+
+	// ResetSendQueueHighWater resets the high-water marks returned by SendQueue to the current depths
+	ResetSendQueueHighWater()
+
+	// Flush sends anything a stream connection is holding back for later writes to fill right away, rather than
+	// waiting for the rest of Config.CorkInterval
+	Flush() error
+
+	// Debug returns a snapshot of the packets this connection is tracking (sent but unacknowledged, lost, and held
+	// for reordering), for diagnosing transfers that have stalled
+	Debug() (DebugInfo, error)
+}
+
+// Listener is implemented by all listeners returned by this package, exposing functionality beyond that of net.Listener
+type Listener interface {
+	net.Listener
+
+	// AcceptContext waits for the next incoming connection and returns it before completing its handshake, allowing
+	// the caller to inspect it and then accept it (optionally with its own Config) or reject it.  The listener must
+	// have been created with Config.AcceptPending set
+	AcceptContext(ctx context.Context) (*PendingConn, error)
+
+	// File returns a copy of the UDP socket this listener is using, so it can be passed to another process that takes
+	// over from this one (see ListenUDTFile)
+	File() (*os.File, error)
+
+	// MuxStats returns a snapshot of the metrics for everything sharing this listener's local address
+	MuxStats() MuxStats
+
+	// Connections returns a snapshot of each connection this listener has accepted that hasn't yet finished closing
+	Connections() []ConnInfo
+
+	// Kick forcibly closes one of this listener's connections, identified by our socket ID for it (ConnInfo.SockID)
+	Kick(sockID uint32) error
+}
+
 // DialUDT establishes an outbound UDT connection using the supplied net, laddr and raddr.
 // See function net.DialUDP for a description of net, laddr and raddr.
-func DialUDT(network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func DialUDT(network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return dialUDT(context.Background(), DefaultConfig(), network, laddr, raddr, isStream)
 }
 
 // DialUDTContext establishes an outbound UDT connection using the supplied net, laddr and raddr.
 // See function net.DialUDP for a description of net, laddr and raddr.
-func DialUDTContext(ctx context.Context, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func DialUDTContext(ctx context.Context, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return dialUDT(ctx, DefaultConfig(), network, laddr, raddr, isStream)
 }
 
@@ -49,24 +163,38 @@ func ListenUDTContext(ctx context.Context, network string, addr string) (net.Lis
 
 // RendezvousUDT establishes an outbound UDT connection using the supplied net, laddr and raddr.
 // See function net.DialUDP for a description of net, laddr and raddr.
-func RendezvousUDT(network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func RendezvousUDT(network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return rendezvousUDT(context.Background(), DefaultConfig(), network, laddr, raddr, isStream)
 }
 
 // RendezvousUDTContext establishes an outbound UDT connection using the supplied net, laddr and raddr.
 // See function net.DialUDP for a description of net, laddr and raddr.
-func RendezvousUDTContext(ctx context.Context, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+func RendezvousUDTContext(ctx context.Context, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
 	return rendezvousUDT(ctx, DefaultConfig(), network, laddr, raddr, isStream)
 }
 
-func dialUDT(ctx context.Context, config *Config, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
-	m, err := multiplexerFor(ctx, network, laddr)
+func dialUDT(ctx context.Context, config *Config, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
+	udpAddr, err := udpAddrOf(network, raddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: raddr, Err: err}
+	}
+	m, err := multiplexerFor(ctx, config, network, laddr)
 	if err != nil {
 		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: raddr, Err: err}
 	}
+	defer m.release()
+	return dialOn(ctx, m, config, network, udpAddr, isStream)
+}
 
-	s := m.newSocket(config, raddr, false, !isStream)
+// dialOn establishes an outbound UDT connection from an existing multiplexer
+func dialOn(ctx context.Context, m *multiplexer, config *Config, network string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+	s, err := m.newSocket(config, raddr, 0, false, !isStream)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: raddr, Err: err}
+	}
+	stop := s.abortOnDone(ctx)
 	err = s.startConnect()
+	stop()
 	if err != nil {
 		return nil, &net.OpError{Op: "dial", Net: network, Source: nil, Addr: raddr, Err: err}
 	}
@@ -74,14 +202,28 @@ func dialUDT(ctx context.Context, config *Config, network string, laddr string,
 	return s, err
 }
 
-func rendezvousUDT(ctx context.Context, config *Config, network string, laddr string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
-	m, err := multiplexerFor(ctx, network, laddr)
+func rendezvousUDT(ctx context.Context, config *Config, network string, laddr string, raddr net.Addr, isStream bool) (net.Conn, error) {
+	udpAddr, err := udpAddrOf(network, raddr)
 	if err != nil {
 		return nil, &net.OpError{Op: "rendezvous", Net: network, Source: nil, Addr: raddr, Err: err}
 	}
+	m, err := multiplexerFor(ctx, config, network, laddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "rendezvous", Net: network, Source: nil, Addr: raddr, Err: err}
+	}
+	defer m.release()
+	return rendezvousOn(ctx, m, config, network, udpAddr, isStream)
+}
 
-	s := m.newSocket(config, raddr, false, !isStream)
+// rendezvousOn establishes an outbound UDT connection from an existing multiplexer
+func rendezvousOn(ctx context.Context, m *multiplexer, config *Config, network string, raddr *net.UDPAddr, isStream bool) (net.Conn, error) {
+	s, err := m.newSocket(config, raddr, 0, false, !isStream)
+	if err != nil {
+		return nil, &net.OpError{Op: "rendezvous", Net: network, Source: nil, Addr: raddr, Err: err}
+	}
+	stop := s.abortOnDone(ctx)
 	err = s.startRendezvous()
+	stop()
 	if err != nil {
 		return nil, &net.OpError{Op: "rendezvous", Net: network, Source: nil, Addr: raddr, Err: err}
 	}
@@ -103,7 +245,8 @@ func init() {
 }
 
 /*
-randInt32 generates a secure random value between 0 and the max possible uint32
+randUint32 generates a random value between 0 and the max possible uint32 using crypto/rand, suitable for values our
+peer shouldn't be able to predict
 */
 func randUint32() (r uint32) {
 	if _r, err := rand.Int(rand.Reader, bigMaxUint32); err != nil {
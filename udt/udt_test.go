@@ -1,10 +1,15 @@
 package udt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
 )
 
 const (
@@ -92,3 +97,442 @@ func test1cli(t *testing.T) {
 
 	client.Close()
 }
+
+func TestMessages(t *testing.T) {
+	t.Run("server", testMsgSrv)
+	t.Run("client", testMsgCli)
+}
+
+func testMsgSrv(t *testing.T) {
+	t.Parallel()
+	t.Log("Testing datagram messages.")
+
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+2))
+	if err != nil {
+		t.Errorf("error calling ListenUDT: %s", err.Error())
+		return
+	}
+
+	newSock, err := serv.Accept()
+	if err != nil {
+		t.Errorf("error calling Accept: %s", err.Error())
+		return
+	}
+
+	var lastMsgNum uint32
+	for i := 0; i < 10; i++ {
+		msg, info, err := newSock.(Conn).ReadMessage()
+		if err != nil {
+			t.Errorf("error calling ReadMessage: %s", err.Error())
+			return
+		}
+		if len(msg) != (i+1)*100 {
+			t.Errorf("message %d: expected length %d, got %d", i, (i+1)*100, len(msg))
+		}
+		if info.InOrder != (i%2 == 0) {
+			t.Errorf("message %d: unexpected in-order flag %t", i, info.InOrder)
+		}
+		if info.Truncated {
+			t.Errorf("message %d: unexpectedly truncated", i)
+		}
+		if i > 0 && info.MsgNum != lastMsgNum+1 {
+			t.Errorf("message %d: expected message number %d, got %d", i, lastMsgNum+1, info.MsgNum)
+		}
+		lastMsgNum = info.MsgNum
+	}
+
+	newSock.Close()
+}
+
+func testMsgCli(t *testing.T) {
+	t.Parallel()
+	remoteAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+2))
+	if err != nil {
+		t.Errorf("error calling ResolveUDPAddr: %s", err.Error())
+		return
+	}
+
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+2), remoteAddr, false)
+	if err != nil {
+		t.Errorf("error calling DialUDT: %s", err.Error())
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := client.(Conn).WriteMessage(make([]byte, (i+1)*100), 0, i%2 == 0); err != nil {
+			t.Errorf("error calling WriteMessage: %s", err.Error())
+			return
+		}
+	}
+
+	client.Close()
+}
+
+func TestMultipath(t *testing.T) {
+	t.Run("server", testMultipathSrv)
+	t.Run("client", testMultipathCli)
+}
+
+func testMultipathSrv(t *testing.T) {
+	t.Parallel()
+	t.Log("Testing multipath data transfer.")
+
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+4))
+	if err != nil {
+		t.Errorf("error calling ListenUDT: %s", err.Error())
+		return
+	}
+
+	newSock, err := serv.Accept()
+	if err != nil {
+		t.Errorf("error calling Accept: %s", err.Error())
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		msg, _, err := newSock.(Conn).ReadMessage()
+		if err != nil {
+			t.Errorf("error calling ReadMessage: %s", err.Error())
+			return
+		}
+		if len(msg) != 4 || endianness.Uint32(msg) != uint32(i) {
+			t.Errorf("message %d: unexpected content %v", i, msg)
+		}
+	}
+
+	newSock.Close()
+}
+
+func testMultipathCli(t *testing.T) {
+	t.Parallel()
+	remoteAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+4))
+	if err != nil {
+		t.Errorf("error calling ResolveUDPAddr: %s", err.Error())
+		return
+	}
+
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+4), remoteAddr, false)
+	if err != nil {
+		t.Errorf("error calling DialUDT: %s", err.Error())
+		return
+	}
+
+	if err = client.(Conn).AddPath(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+5), remoteAddr); err != nil {
+		t.Errorf("error calling AddPath: %s", err.Error())
+		return
+	}
+	if paths := client.(Conn).Paths(); len(paths) != 2 {
+		t.Errorf("expected 2 paths, found %d", len(paths))
+	}
+
+	for i := 0; i < 10; i++ {
+		msg := make([]byte, 4)
+		endianness.PutUint32(msg, uint32(i))
+		if _, err := client.(Conn).WriteMessage(msg, 0, true); err != nil {
+			t.Errorf("error calling WriteMessage: %s", err.Error())
+			return
+		}
+	}
+
+	client.Close()
+
+	// everything should have been sent by the time Close returns
+	for _, path := range client.(Conn).Paths() {
+		if path.PktSent == 0 {
+			t.Errorf("no packets sent on path %s -> %s", path.LocalAddr, path.RemoteAddr)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	t.Log("Testing connection refusal.")
+
+	config := DefaultConfig()
+	config.CanAcceptDgram = false
+	config.CanAccept = func(hsPacket *packet.HandshakePacket, from *net.UDPAddr) error {
+		return Reject(RejectUser+1, "go away")
+	}
+	serv, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+6))
+	if err != nil {
+		t.Fatalf("error calling Listen: %s", err.Error())
+	}
+	defer serv.Close()
+
+	for _, tc := range []struct {
+		isStream bool
+		reason   RejectReason
+		message  string
+	}{
+		{true, RejectUser + 1, "go away"},
+		{false, RejectSockType, ""},
+	} {
+		_, err := DialUDT("udp", "127.0.0.1:0", serv.Addr(), tc.isStream)
+		var rej *RejectError
+		if !errors.As(err, &rej) {
+			t.Errorf("stream=%t: expected a RejectError, got %v", tc.isStream, err)
+			continue
+		}
+		if rej.Reason != tc.reason || rej.Message != tc.message {
+			t.Errorf("stream=%t: expected refusal (%s) %q, got (%s) %q", tc.isStream, tc.reason.String(), tc.message,
+				rej.Reason.String(), rej.Message)
+		}
+	}
+}
+
+func TestAcceptPending(t *testing.T) {
+	t.Log("Testing pending connections.")
+
+	config := DefaultConfig()
+	config.AcceptPending = true
+	serv, err := config.Listen(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", serverPort+7))
+	if err != nil {
+		t.Fatalf("error calling Listen: %s", err.Error())
+	}
+	defer serv.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		defer close(accepted)
+		for i := 0; i < 2; i++ {
+			pc, err := serv.(Listener).AcceptContext(context.Background())
+			if err != nil {
+				t.Errorf("error calling AcceptContext: %s", err.Error())
+				return
+			}
+			if pc.RemoteAddr.Port != clientPort+7+i || pc.IsStream != (i == 0) || pc.MaxPacketSize == 0 {
+				t.Errorf("unexpected pending connection from %s (stream=%t, mtu=%d)", pc.RemoteAddr.String(), pc.IsStream,
+					pc.MaxPacketSize)
+			}
+			if !pc.IsStream {
+				pc.Reject(RejectUser, "streams only")
+				continue
+			}
+			connConfig := DefaultConfig()
+			connConfig.MaxFlowWinSize = 128
+			conn, err := pc.Accept(connConfig)
+			if err != nil {
+				t.Errorf("error accepting pending connection: %s", err.Error())
+				return
+			}
+			if _, err = pc.Accept(nil); err == nil {
+				t.Error("accepted the same pending connection twice")
+			}
+			accepted <- conn
+		}
+	}()
+
+	client, err := DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+7), serv.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	if _, err = client.Write([]byte("hello")); err != nil {
+		t.Errorf("error calling Write: %s", err.Error())
+	}
+	buf := make([]byte, 16)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("unexpected Read result %q (%v)", string(buf[:n]), err)
+	}
+	client.Close()
+	server.Close()
+
+	_, err = DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", clientPort+8), serv.Addr(), false)
+	var rej *RejectError
+	if !errors.As(err, &rej) || rej.Reason != RejectUser || rej.Message != "streams only" {
+		t.Errorf("expected a refusal with the reason given to Reject, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Log("Testing malformed packet accounting.")
+
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", serverPort+18))
+	if err != nil {
+		t.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+	defer serv.Close()
+	go func() {
+		if newSock, err := serv.Accept(); err == nil {
+			defer newSock.Close()
+			newSock.Read(make([]byte, 1))
+		}
+	}()
+
+	config := DefaultConfig()
+	config.StrictDecoding = true
+	client, err := config.Dial(context.Background(), "udp", fmt.Sprintf("127.0.0.1:%d", clientPort+18),
+		serv.Addr(), true)
+	if err != nil {
+		t.Fatalf("error calling Dial: %s", err.Error())
+	}
+	defer client.Close()
+
+	raw, err := net.DialUDP("udp", nil, &client.LocalAddr().(*UDTAddr).UDPAddr)
+	if err != nil {
+		t.Fatalf("error calling DialUDP: %s", err.Error())
+	}
+	defer raw.Close()
+
+	// a runt, and a keep-alive with more than the permitted padding after it
+	raw.Write([]byte{0x80, 0x01})
+	buf := make([]byte, 64)
+	n, _ := (&packet.KeepAlivePacket{}).WriteTo(buf)
+	raw.Write(buf[:n+8])
+
+	for i := 0; i < 100; i++ {
+		stats := client.(Conn).Stats()
+		if stats.PktDecodeErr == 1 && stats.PktTrailingErr == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := client.(Conn).Stats()
+	t.Errorf("expected one decode error and one trailing data error, got %d and %d", stats.PktDecodeErr,
+		stats.PktTrailingErr)
+}
+
+// benchConnect opens a connected pair of sockets for a benchmark to use
+func TestConnInterface(t *testing.T) {
+	var _ Conn = (*udtSocket)(nil)
+	var _ Listener = (*listener)(nil)
+
+	// everything handed out as a net.Conn or net.Listener offers the rest of our functionality
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, ok := a.(Conn); !ok {
+		t.Errorf("expected Pipe to return a Conn, got %T", a)
+	}
+
+	servConn, clientConn := newPipeConns()
+	servMx, err := NewMultiplexerWithConn(servConn, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(clientConn, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	if _, ok := l.(Listener); !ok {
+		t.Errorf("expected Listen to return a Listener, got %T", l)
+	}
+	accepted := acceptOne(l)
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+	if _, ok := client.(Conn); !ok {
+		t.Errorf("expected Dial to return a Conn, got %T", client)
+	}
+	if _, ok := server.(Conn); !ok {
+		t.Errorf("expected Accept to return a Conn, got %T", server)
+	}
+}
+
+func benchConnect(b *testing.B, port int, isStream bool) (serv net.Listener, server net.Conn, client net.Conn) {
+	serv, err := ListenUDT("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		b.Fatalf("error calling ListenUDT: %s", err.Error())
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		newSock, err := serv.Accept()
+		if err != nil {
+			b.Errorf("error calling Accept: %s", err.Error())
+		}
+		accepted <- newSock
+	}()
+
+	client, err = DialUDT("udp", fmt.Sprintf("127.0.0.1:%d", port+1), serv.Addr(), isStream)
+	if err != nil {
+		b.Fatalf("error calling DialUDT: %s", err.Error())
+	}
+	server = <-accepted
+	if server == nil {
+		b.FailNow()
+	}
+	return
+}
+
+func BenchmarkStreamThroughput(b *testing.B) {
+	const writeSize = 16 << 10
+	serv, server, client := benchConnect(b, serverPort+10, true)
+	b.SetBytes(writeSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buffer := make([]byte, writeSize)
+		for remain := b.N * writeSize; remain > 0; {
+			recvd, err := server.Read(buffer)
+			if err != nil {
+				b.Errorf("error calling Read: %s", err.Error())
+				return
+			}
+			remain -= recvd
+		}
+	}()
+
+	buffer := make([]byte, writeSize)
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Write(buffer); err != nil {
+			b.Fatalf("error calling Write: %s", err.Error())
+		}
+	}
+	<-done
+	b.StopTimer()
+
+	client.Close()
+	server.Close()
+	serv.Close()
+}
+
+func BenchmarkMessageRoundtrip(b *testing.B) {
+	serv, server, client := benchConnect(b, serverPort+12, false)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			recvd, err := server.Read(buffer)
+			if err != nil {
+				return
+			}
+			if _, err = server.Write(buffer[:recvd]); err != nil {
+				return
+			}
+		}
+	}()
+
+	buffer := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Write(buffer); err != nil {
+			b.Fatalf("error calling Write: %s", err.Error())
+		}
+		if _, err := client.Read(buffer); err != nil {
+			b.Fatalf("error calling Read: %s", err.Error())
+		}
+	}
+	b.StopTimer()
+
+	client.Close()
+	server.Close()
+	serv.Close()
+}
@@ -1,7 +1,9 @@
 package udt
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"sync"
@@ -11,6 +13,12 @@ import (
 	"github.com/odysseus654/go-udt/udt/packet"
 )
 
+const (
+	udtHeaderSize  = 16 // size of the header at the start of every UDT packet
+	udp4HeaderSize = 28 // size of the IPv4 and UDP headers in front of every UDT packet
+	udp6HeaderSize = 48 // size of the IPv6 and UDP headers in front of every UDT packet
+)
+
 type sockState int
 
 const (
@@ -24,6 +32,48 @@ const (
 	sockStateTimeout                     // connection failed due to peer timeout
 )
 
+// String returns the name of this state
+func (s sockState) String() string {
+	switch s {
+	case sockStateInit:
+		return "init"
+	case sockStateRendezvous:
+		return "rendezvous"
+	case sockStateConnecting:
+		return "connecting"
+	case sockStateConnected:
+		return "connected"
+	case sockStateClosed:
+		return "closed"
+	case sockStateRefused:
+		return "refused"
+	case sockStateCorrupted:
+		return "corrupted"
+	case sockStateTimeout:
+		return "timeout"
+	default:
+		return fmt.Sprintf("state-%d", int(s))
+	}
+}
+
+// MarshalText returns the name of this state
+func (s sockState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// atomicState holds a sockState that may be read and changed from any goroutine
+type atomicState struct {
+	val atomicUint32
+}
+
+func (s *atomicState) get() sockState {
+	return sockState(s.val.get())
+}
+
+func (s *atomicState) set(v sockState) {
+	s.val.set(uint32(v))
+}
+
 type recvPktEvent struct {
 	pkt packet.Packet
 	now time.Time
@@ -33,6 +83,18 @@ type sendMessage struct {
 	content []byte
 	tim     time.Time     // time message is submitted
 	ttl     time.Duration // message dropped if it can't be sent in this timeframe
+	inOrder bool          // (datagram sockets) message must be delivered after all prior messages
+	flush   bool          // (stream sockets) carries no data, asks for anything held back to be sent now (see Flush)
+	receipt *Receipt      // (datagram sockets) settled once the message is acknowledged, see WriteMessageReceipt
+}
+
+type recvMessage struct {
+	content   []byte
+	msgID     uint32        // message number assigned by the sender
+	inOrder   bool          // message was sent with the "in order" flag set
+	sendTime  time.Duration // timestamp of the first packet in this message (relative to the sender's socket creation)
+	truncated bool          // parts of this message could not be recovered
+	none      bool          // not a message: nothing more is available (the connection has shut down, or we didn't wait)
 }
 
 type shutdownMessage struct {
@@ -41,6 +103,27 @@ type shutdownMessage struct {
 	err          error
 }
 
+// shutdownLatch holds the first request to shut a connection down until goManageConnection acts on it.  Later
+// requests are dropped (the first reason given is the one reported), so asking never blocks however often it happens
+type shutdownLatch struct {
+	latched atomicUint32
+	msg     shutdownMessage // only written by whoever latched us, before signalling ready
+	ready   chan struct{}   // receives a single signal once we're latched
+}
+
+func newShutdownLatch() *shutdownLatch {
+	return &shutdownLatch{ready: make(chan struct{}, 1)}
+}
+
+// signal requests that the connection be shut down, unless this has already been requested
+func (l *shutdownLatch) signal(msg shutdownMessage) {
+	if !l.latched.compareAndSwap(0, 1) {
+		return
+	}
+	l.msg = msg
+	l.ready <- struct{}{}
+}
+
 /*
 udtSocket encapsulates a UDT socket between a local and remote address pair, as
 defined by the UDT specification.  udtSocket implements the net.Conn interface
@@ -51,52 +134,109 @@ type udtSocket struct {
 	// this data not changed after the socket is initialized and/or handshaked
 	m           *multiplexer    // the multiplexer that handles this socket
 	raddr       *net.UDPAddr    // the remote address
+	clock       Clock           // source of the current time
 	created     time.Time       // the time that this socket was created
 	Config      *Config         // configuration parameters for this socket
 	udtVer      int             // UDT protcol version (normally 4.  Will we be supporting others?)
 	isDatagram  bool            // if true then we're sending and receiving datagrams, otherwise we're a streaming socket
 	isServer    bool            // if true then we are behaving like a server, otherwise client (or rendezvous). Only useful during handshake
 	sockID      uint32          // our sockID
-	farSockID   uint32          // the peer's sockID
+	farSockID   atomicUint32    // the peer's sockID (set by readHandshake while the dialer may be sending its own handshakes)
 	initPktSeq  packet.PacketID // initial packet sequence to start the connection with
 	connectWait *sync.WaitGroup // released when connection is complete (or failed)
 
-	sockState           sockState    // socket state - used mostly during handshakes
-	mtu                 atomicUint32 // the negotiated maximum packet size
-	maxFlowWinSize      uint         // receiver: maximum unacknowledged packet count
-	currPartialRead     []byte       // stream connections: currently reading message (for partial reads). Owned by client caller (Read)
-	readDeadline        *time.Timer  // if set, then calls to Read() will return "timeout" after this time
-	readDeadlinePassed  bool         // if set, then calls to Read() will return "timeout"
-	writeDeadline       *time.Timer  // if set, then calls to Write() will return "timeout" after this time
-	writeDeadlinePassed bool         // if set, then calls to Write() will return "timeout"
-
-	rttProt sync.RWMutex // lock must be held before referencing rtt/rttVar
-	rtt     uint         // receiver: estimated roundtrip time. (in microseconds)
-	rttVar  uint         // receiver: roundtrip variance. (in microseconds)
+	sockState       atomicState  // socket state - used mostly during handshakes
+	closeErr        atomicError  // if set, the reason this socket was shut down
+	mtu             atomicUint32 // the negotiated maximum packet size
+	maxFlowWinSize  uint         // receiver: maximum unacknowledged packet count
+	recvWindow      atomicUint32 // receiver: unacknowledged packet count we're advertising, up to maxFlowWinSize (see Config.FlowWindowAutoTune)
+	flightSize      atomicUint32 // sender: number of packets sent but not yet acknowledged
+	flowWindow      atomicUint32 // sender: number of unacknowledged packets our peer will accept
+	sendLimit       *tokenBucket // limits the rate packets are written out (see Config.MaxBandwidth, unlimited if its rate is zero)
+	currPartialRead []byte       // stream connections: currently reading message (for partial reads). Owned by client caller (Read)
+	peekedRead      *recvMessage // datagram connections: message fetched by PeekMessageSize but not yet read. Owned by client caller (Read)
+	readDeadline    *deadline    // calls to Read() will return "timeout" once this passes
+	writeDeadline   *deadline    // calls to Write() will return "timeout" once this passes
+	unreliableDrop  atomicUint64 // number of unreliable datagrams discarded for arriving faster than they were read
+	ecnMarks        atomicUint64 // number of data packets received with a congestion mark, see Config.ECN
+	memDropped      atomicUint64 // number of data packets discarded for exceeding our share of memory, see Config.MemoryLimit
+	byteSent        atomicUint64 // number of payload bytes written to this connection
+	byteRecv        atomicUint64 // number of payload bytes received on this connection (as they're queued for Read)
+
+	lastData  atomicDuration // time (since created) that we last sent or received data, see Config.IdleTimeout
+	ackPeriod atomicDuration // maximum time between periodic ACKs (from Config.ACKPeriod, see SetOption)
+	nakPeriod atomicDuration // time between repeated loss reports (from Config.NAKPeriod, see SetOption)
+	ecnEcho   atomicDuration // time (since created) that we last reported congestion marks to our peer, see Config.ECN
+	cork      atomicDuration // how long a partly filled stream packet may be held for more writes (see Config.CorkInterval)
+
+	rtt   *rttEstimator // estimated roundtrip time to our peer
+	drift *driftTracer  // relationship between our peer's packet timestamps and our clock
+
+	writeProt    sync.RWMutex  // held (for reading) by anything sending to messageOut, so Close can close it safely
+	writeClosing chan struct{} // closed when Close is called, refusing any further writes
+	closeOnce    sync.Once     // Close only closes messageOut once, however many times (or places) it's called
+	queueHigh    atomicUint32  // most writes that have been waiting in messageOut at once (see sendqueue.go)
+	unsent       atomicUint64  // number of bytes written but not yet put into a data packet (see sendqueue.go)
+	unsentHigh   atomicUint64  // most bytes that have been waiting in unsent at once
+
+	receiptProt sync.Mutex            // lock must be held before referencing receipts
+	receipts    map[*Receipt]struct{} // receipts not yet settled (nil once the connection has closed), see receipt.go
 
 	receiveRateProt sync.RWMutex // lock must be held before referencing deliveryRate/bandwidth
 	deliveryRate    uint         // delivery rate reported from peer (packets/sec)
 	bandwidth       uint         // bandwidth reported from peer (packets/sec)
 
 	// channels
-	messageIn     chan []byte          // inbound messages. Sender is goReceiveEvent->ingestData, Receiver is client caller (Read)
-	messageOut    chan sendMessage     // outbound messages. Sender is client caller (Write), Receiver is goSendEvent. Closed when socket is closed
-	recvEvent     chan recvPktEvent    // receiver: ingest the specified packet. Sender is readPacket, receiver is goReceiveEvent
-	sendEvent     chan recvPktEvent    // sender: ingest the specified packet. Sender is readPacket, receiver is goSendEvent
-	sendPacket    chan packet.Packet   // packets to send out on the wire (once goManageConnection is running)
-	shutdownEvent chan shutdownMessage // channel signals the connection to be shutdown
-	sockShutdown  chan struct{}        // closed when socket is shutdown
-	sockClosed    chan struct{}        // closed when socket is closed
+	messageIn     chan recvMessage   // inbound messages. Sender is goReceiveEvent->ingestData, Receiver is client caller (Read)
+	messageOut    chan sendMessage   // outbound messages. Sender is client caller (Write), Receiver is goSendEvent. Closed when socket is closed
+	recvEvent     chan recvPktEvent  // receiver: ingest the specified packet. Sender is readPacket, receiver is goReceiveEvent
+	sendEvent     chan recvPktEvent  // sender: ingest the specified packet. Sender is readPacket, receiver is goSendEvent
+	expTimeout    chan time.Time     // sender: EXP timer has fired. Sender is goReceiveEvent, receiver is goSendEvent
+	sendPacket    chan packet.Packet // packets to send out on the wire (once goManageConnection is running)
+	sendFeedback  chan packet.Packet // ACKs, NAKs and keep-alives to send out on the wire, ahead of anything in sendPacket
+	shutdownEvent *shutdownLatch     // signals the connection to be shutdown
+	sockShutdown  chan struct{}      // closed when socket is shutdown
+	sockClosed    chan struct{}      // closed when socket is closed
+	readClosed    chan struct{}      // closed when socket is shutdown or closed, once nothing more will arrive on messageIn
+	unreliableIn  chan []byte        // inbound unreliable datagrams. Sender is readPacket, receiver is client caller (ReadUnreliable)
+	sendDebug     chan debugRequest  // sender: fill in a DebugInfo. Sender is client caller (Debug), receiver is goSendEvent
+	recvDebug     chan debugRequest  // receiver: fill in a DebugInfo. Sender is client caller (Debug), receiver is goReceiveEvent
+	mtuEvent      chan struct{}      // sender: our packet size has been lowered. Sender is goWrite, receiver is goSendEvent
+	connectDone   chan struct{}      // our connection attempt has completed. Sender is readHandshake, receiver is goManageConnection
+	quotaHit      chan struct{}      // Config.MaxBytesPerConn has been exceeded. Sender is signalQuota, receiver is goManageConnection
 
 	// timers
 	connTimeout <-chan time.Time // connecting: fires when connection attempt times out
 	connRetry   <-chan time.Time // connecting: fires when connection attempt to be retried
 	lingerTimer <-chan time.Time // after disconnection, fires once our linger timer runs out
 
+	// multipath (experimental)
+	pathsProt      sync.RWMutex  // lock must be held before referencing paths
+	paths          []*udtPath    // if this is a multipath connection, the paths it uses (the first being the primary one)
+	pathProbeStart chan struct{} // signals goManageConnection to start probing paths
+	probeSeq       uint32        // sequence number of the last path probe we've sent. Owned by goManageConnection
+	nextPath       uint          // round-robin path scheduling. Owned by goManageConnection
+
 	send *udtSocketSend // reference to sending side of this socket
 	recv *udtSocketRecv // reference to receiving side of this socket
 	cong *udtSocketCc   // reference to contestion control
 
+	recvLoop *eventLoop // runs goReceiveEvent in event-loop mode (nil otherwise, see Config.EventLoop)
+	congLoop *eventLoop // runs goCongestionEvent in event-loop mode (nil otherwise)
+
+	routines *routineGroup // every goroutine running on behalf of this socket, all of which exit once it's closed
+
+	authNonce []byte // the dialing side's nonce when authenticating with Config.PreSharedKey (see auth.go)
+
+	resume        *Session  // dialing side: the session we're resuming, if any (see resume.go)
+	resumeToken   []byte    // the resumption token the listener issued for this connection, if any
+	resumeExpires time.Time // when resumeToken expires
+	earlyData     []byte    // data carried in the handshake, to send (dialing side) or deliver (listening side), see earlydata.go
+	earlyAccepted bool      // set if the listening side accepted earlyData
+
+	caps     atomicUint32 // the optional features in use on this connection (see capabilities.go)
+	peerCaps atomicUint32 // the optional features our peer advertised in its handshake
+
 	// performance metrics
 	//PktSent      uint64        // number of sent data packets, including retransmissions
 	//PktRecv      uint64        // number of received packets
@@ -126,28 +266,33 @@ type udtSocket struct {
  Implementation of net.Conn interface
 *******************************************************************************/
 
-// Grab the next data packet
-func (s *udtSocket) fetchReadPacket(blocking bool) ([]byte, error) {
-	var result []byte
+// Grab the next data packet.  A message marked none indicates that nothing is available (if blocking, that nothing
+// more will arrive).  If blocking, waiting ends early if ctx is cancelled
+func (s *udtSocket) fetchReadPacket(ctx context.Context, blocking bool) (recvMessage, error) {
+	var result recvMessage
+	if s.peekedRead != nil {
+		result = *s.peekedRead
+		s.peekedRead = nil
+		return result, nil
+	}
 	if blocking {
-		for {
-			if s.readDeadlinePassed {
-				return nil, syscall.ETIMEDOUT
-			}
-			var deadline <-chan time.Time
-			if s.readDeadline != nil {
-				deadline = s.readDeadline.C
-			}
-			select {
-			case result = <-s.messageIn:
-				return result, nil
-			case _, ok := <-deadline:
-				if !ok {
-					continue
-				}
-				s.readDeadlinePassed = true
-				return nil, syscall.ETIMEDOUT
-			}
+		deadline := s.readDeadline.wait()
+		select {
+		case <-deadline:
+			return result, syscall.ETIMEDOUT
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+		}
+		select {
+		case result = <-s.messageIn:
+			return result, nil
+		case <-s.readClosed:
+			// nothing more is coming, but deliver anything that arrived first
+		case <-deadline:
+			return result, syscall.ETIMEDOUT
+		case <-ctx.Done():
+			return result, ctx.Err()
 		}
 	}
 
@@ -156,13 +301,17 @@ func (s *udtSocket) fetchReadPacket(blocking bool) ([]byte, error) {
 		// ok we have a message
 	default:
 		// ok we've read some stuff and there's nothing immediately available
-		return nil, nil
+		result.none = true
 	}
 	return result, nil
 }
 
 func (s *udtSocket) connectionError() error {
-	switch s.sockState {
+	state := s.sockState.get()
+	if err := s.closeErr.get(); err != nil && !isOpenState(state) { // closeErr is set before the state changes
+		return err
+	}
+	switch state {
 	case sockStateRefused:
 		return errors.New("Connection refused by remote host")
 	case sockStateCorrupted:
@@ -175,29 +324,33 @@ func (s *udtSocket) connectionError() error {
 	return nil
 }
 
-// TODO: int sendmsg(const char* data, int len, int msttl, bool inorder)
-
 // Read reads data from the connection.
 // Read can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
 // (required for net.Conn implementation)
 func (s *udtSocket) Read(p []byte) (n int, err error) {
+	return s.ReadContext(context.Background(), p)
+}
+
+// ReadContext reads data from the connection as Read does, except that it also gives up (returning ctx.Err()) if ctx
+// is cancelled before anything arrives
+func (s *udtSocket) ReadContext(ctx context.Context, p []byte) (n int, err error) {
 	connErr := s.connectionError()
 	if s.isDatagram {
 		// for datagram sockets, block until we have a message to return and then return it
 		// if the buffer isn't big enough, return a truncated message (discarding the rest) and return an error
-		msg, rerr := s.fetchReadPacket(connErr == nil)
+		msg, rerr := s.fetchReadPacket(ctx, connErr == nil)
 		if rerr != nil {
 			err = rerr
 			return
 		}
-		if msg == nil && connErr != nil {
-			err = connErr
+		if msg.none {
+			err = s.connectionError()
 			return
 		}
-		n = copy(p, msg)
-		if n < len(msg) {
-			err = errors.New("Message truncated")
+		n = copy(p, msg.content)
+		if n < len(msg.content) {
+			err = &ErrMessageTruncated{Size: len(msg.content)}
 		}
 	} else {
 		// for streaming sockets, block until we have at least something to return, then
@@ -208,100 +361,208 @@ func (s *udtSocket) Read(p []byte) (n int, err error) {
 		for idx < l {
 			if s.currPartialRead == nil {
 				// Grab the next data packet
-				currPartialRead, rerr := s.fetchReadPacket(n == 0 && connErr == nil)
-				s.currPartialRead = currPartialRead
+				currPartialRead, rerr := s.fetchReadPacket(ctx, n == 0 && connErr == nil)
+				s.currPartialRead = currPartialRead.content
 				if rerr != nil {
 					err = rerr
 					return
 				}
-				if s.currPartialRead == nil {
-					if n != 0 {
-						return
-					}
-					if connErr != nil {
-						err = connErr
-						return
+				if currPartialRead.none {
+					if n == 0 {
+						err = s.connectionError()
 					}
+					return
 				}
 			}
 			thisN := copy(p[idx:], s.currPartialRead)
 			n = n + thisN
 			idx = idx + thisN
-			if n >= len(s.currPartialRead) {
+			if thisN >= len(s.currPartialRead) {
 				// we've exhausted the current data packet, reset to nil
 				s.currPartialRead = nil
 			} else {
-				s.currPartialRead = s.currPartialRead[n:]
+				s.currPartialRead = s.currPartialRead[thisN:]
 			}
 		}
 	}
 	return
 }
 
+// PeekMessageSize returns the length of the next message on a datagram connection, waiting for one to arrive if
+// necessary, without removing it (so it can be read with a buffer of the right size).
+// PeekMessageSize can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline.
+func (s *udtSocket) PeekMessageSize() (int, error) {
+	if !s.isDatagram {
+		return 0, errors.New("PeekMessageSize is only supported on datagram connections")
+	}
+	connErr := s.connectionError()
+	msg, err := s.fetchReadPacket(context.Background(), connErr == nil)
+	if err != nil {
+		return 0, err
+	}
+	if msg.none {
+		return 0, s.connectionError()
+	}
+	s.peekedRead = &msg
+	return len(msg.content), nil
+}
+
 // Write writes data to the connection.
 // Write can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
 // (required for net.Conn implementation)
 func (s *udtSocket) Write(p []byte) (n int, err error) {
+	return s.WriteContext(context.Background(), p)
+}
+
+// WriteContext writes data to the connection as Write does, except that it also gives up (returning ctx.Err()) if ctx
+// is cancelled before the data could be queued to be sent
+func (s *udtSocket) WriteContext(ctx context.Context, p []byte) (n int, err error) {
 	// at the moment whatever we have right now we'll shove it into a channel and return
 	// on the other side:
 	//  for datagram sockets: this is a distinct message to be broken into as few packets as possible
 	//  for streaming sockets: collect as much as can fit into a packet and send them out
-	switch s.sockState {
-	case sockStateRefused:
-		err = errors.New("Connection refused by remote host")
-		return
-	case sockStateCorrupted:
-		err = errors.New("Connection closed due to protocol error")
-		return
-	case sockStateClosed:
-		err = errors.New("Connection closed")
+	if len(p) == 0 && !s.isDatagram {
+		return 0, s.connectionError() // nothing to send (an empty datagram is still a message)
+	}
+	return s.writeMessage(ctx, sendMessage{content: p, tim: s.clock.Now()})
+}
+
+// ReadMessage reads the next message from a datagram connection, returning the message along with information
+// about how it was delivered.
+// ReadMessage can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline.
+func (s *udtSocket) ReadMessage() ([]byte, MessageInfo, error) {
+	if !s.isDatagram {
+		return nil, MessageInfo{}, errors.New("ReadMessage is only supported on datagram connections")
+	}
+	connErr := s.connectionError()
+	msg, err := s.fetchReadPacket(context.Background(), connErr == nil)
+	if err != nil {
+		return nil, MessageInfo{}, err
+	}
+	if msg.none {
+		return nil, MessageInfo{}, s.connectionError()
+	}
+	return msg.content, MessageInfo{
+		MsgNum:    msg.msgID,
+		InOrder:   msg.inOrder,
+		SendTime:  msg.sendTime,
+		Truncated: msg.truncated,
+	}, nil
+}
+
+// WriteMessage sends a single message on a datagram connection.  If ttl is nonzero, the message will be dropped if
+// it cannot be delivered within that timeframe.  If inOrder is set, the peer will not deliver this message until
+// all prior messages have been delivered, otherwise it is delivered as soon as it has been completely received.
+// WriteMessage can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetWriteDeadline.
+func (s *udtSocket) WriteMessage(p []byte, ttl time.Duration, inOrder bool) (n int, err error) {
+	if !s.isDatagram {
+		return 0, errors.New("WriteMessage is only supported on datagram connections")
+	}
+	if maxSize := s.Config.MaxMessageSize; maxSize > 0 && uint(len(p)) > maxSize {
+		return 0, fmt.Errorf("Message of %d bytes exceeds the maximum message size of %d", len(p), maxSize)
+	}
+	return s.writeMessage(context.Background(), sendMessage{content: p, tim: s.clock.Now(), ttl: ttl, inOrder: inOrder})
+}
+
+// writeMessage passes the message along to goSendEvent, giving up if ctx is cancelled first
+func (s *udtSocket) writeMessage(ctx context.Context, msg sendMessage) (n int, err error) {
+	if err = s.connectionError(); err != nil {
 		return
 	}
 
-	n = len(p)
+	s.writeProt.RLock()
+	defer s.writeProt.RUnlock()
+	select {
+	case <-s.writeClosing:
+		return 0, ErrClosed
+	default:
+	}
 
-	for {
-		if s.writeDeadlinePassed {
-			err = syscall.ETIMEDOUT
-			return
-		}
-		var deadline <-chan time.Time
-		if s.writeDeadline != nil {
-			deadline = s.writeDeadline.C
-		}
-		select {
-		case s.messageOut <- sendMessage{content: p, tim: time.Now()}:
-			// send successful
-			return
-		case _, ok := <-deadline:
-			if !ok {
-				continue
-			}
-			s.writeDeadlinePassed = true
-			err = syscall.ETIMEDOUT
-			return
+	n = len(msg.content)
+	if s.overQuota(uint64(n)) {
+		s.signalQuota()
+		return 0, ErrQuotaExceeded
+	}
+
+	deadline := s.writeDeadline.wait()
+	select {
+	case <-deadline:
+		n = 0
+		err = syscall.ETIMEDOUT
+		return
+	case <-ctx.Done():
+		n = 0
+		err = ctx.Err()
+		return
+	default:
+	}
+	s.noteUnsent(len(msg.content)) // counted before it's queued, so the sender can't take it up before it's counted
+	defer func() {
+		if err != nil {
+			s.noteUnsent(-len(msg.content))
 		}
+	}()
+	select {
+	case s.messageOut <- msg:
+		// send successful
+		s.byteSent.add(uint64(n))
+		s.queueHigh.raise(uint32(len(s.messageOut)))
+	case <-s.writeClosing:
+		n = 0
+		err = ErrClosed
+	case _, _ = <-s.sockClosed:
+		n = 0
+		err = s.connectionError()
+	case <-deadline:
+		n = 0
+		err = syscall.ETIMEDOUT
+	case <-ctx.Done():
+		n = 0
+		err = ctx.Err()
 	}
+	return
 }
 
+// ErrClosed is returned from Write (and anything else sending data) once Close has been called on the connection
+var ErrClosed = errors.New("Connection closed")
+
 // Close closes the connection.
 // Any blocked Read or Write operations will be unblocked.
 // Write operations will be permitted to send (initial packets)
 // Read operations will return an error
+// It is safe to call Close more than once, or while other goroutines are writing
 // (required for net.Conn implementation)
 func (s *udtSocket) Close() error {
 	if !s.isOpen() {
 		return nil // already closed
 	}
 
-	close(s.messageOut)
-	_, _ = <-s.shutdownEvent
+	s.closeOnce.Do(func() {
+		// blocked writers give up once writeClosing is closed, after which nobody can be sending to messageOut
+		close(s.writeClosing)
+		s.writeProt.Lock()
+		close(s.messageOut)
+		s.writeProt.Unlock()
+	})
+
+	// wait for the connection to finish sending, but leave the shutdown event itself for goManageConnection
+	select {
+	case <-s.sockShutdown:
+	case <-s.sockClosed:
+	}
 	return nil
 }
 
 func (s *udtSocket) isOpen() bool {
-	switch s.sockState {
+	return isOpenState(s.sockState.get())
+}
+
+func isOpenState(state sockState) bool {
+	switch state {
 	case sockStateClosed, sockStateRefused, sockStateCorrupted, sockStateTimeout:
 		return false
 	default:
@@ -309,16 +570,16 @@ func (s *udtSocket) isOpen() bool {
 	}
 }
 
-// LocalAddr returns the local network address.
+// LocalAddr returns the local network address, as a *UDTAddr.
 // (required for net.Conn implementation)
 func (s *udtSocket) LocalAddr() net.Addr {
-	return s.m.laddr
+	return &UDTAddr{UDPAddr: *s.m.laddr, SocketID: s.sockID}
 }
 
-// RemoteAddr returns the remote network address.
+// RemoteAddr returns the remote network address, as a *UDTAddr.
 // (required for net.Conn implementation)
 func (s *udtSocket) RemoteAddr() net.Addr {
-	return s.raddr
+	return &UDTAddr{UDPAddr: *s.raddr, SocketID: s.farSockID.get()}
 }
 
 // SetDeadline sets the read and write deadlines associated
@@ -345,40 +606,17 @@ func (s *udtSocket) RemoteAddr() net.Addr {
 // errors.Is(err, syscall.ETIMEDOUT).
 // (required for net.Conn implementation)
 func (s *udtSocket) SetDeadline(t time.Time) error {
-	s.setDeadline(t, &s.readDeadline, &s.readDeadlinePassed)
-	s.setDeadline(t, &s.writeDeadline, &s.writeDeadlinePassed)
+	s.readDeadline.set(s.clock, t)
+	s.writeDeadline.set(s.clock, t)
 	return nil
 }
 
-func (s *udtSocket) setDeadline(dl time.Time, timer **time.Timer, timerPassed *bool) {
-	if *timer == nil {
-		if !dl.IsZero() {
-			*timer = time.NewTimer(dl.Sub(time.Now()))
-		}
-	} else {
-		now := time.Now()
-		if !dl.IsZero() && dl.Before(now) {
-			*timerPassed = true
-		}
-		oldTime := *timer
-		if dl.IsZero() {
-			*timer = nil
-		}
-		oldTime.Stop()
-		_, _ = <-oldTime.C
-		if !dl.IsZero() && dl.After(now) {
-			*timerPassed = false
-			oldTime.Reset(dl.Sub(time.Now()))
-		}
-	}
-}
-
 // SetReadDeadline sets the deadline for future Read calls
 // and any currently-blocked Read call.
 // A zero value for t means Read will not time out.
 // (required for net.Conn implementation)
 func (s *udtSocket) SetReadDeadline(t time.Time) error {
-	s.setDeadline(t, &s.readDeadline, &s.readDeadlinePassed)
+	s.readDeadline.set(s.clock, t)
 	return nil
 }
 
@@ -389,7 +627,7 @@ func (s *udtSocket) SetReadDeadline(t time.Time) error {
 // A zero value for t means Write will not time out.
 // (required for net.Conn implementation)
 func (s *udtSocket) SetWriteDeadline(t time.Time) error {
-	s.setDeadline(t, &s.writeDeadline, &s.writeDeadlinePassed)
+	s.writeDeadline.set(s.clock, t)
 	return nil
 }
 
@@ -399,12 +637,16 @@ func (s *udtSocket) SetWriteDeadline(t time.Time) error {
 
 // newSocket creates a new UDT socket, which will be configured afterwards as either an incoming our outgoing socket
 func newSocket(m *multiplexer, config *Config, sockID uint32, isServer bool, isDatagram bool, raddr *net.UDPAddr) (s *udtSocket) {
-	now := time.Now()
+	clock := configClock(config)
+	now := clock.Now()
 
 	mtu := m.mtu
 	if config.MaxPacketSize > 0 && config.MaxPacketSize < mtu {
 		mtu = config.MaxPacketSize
 	}
+	if mtu < minMTU4 {
+		mtu = minMTU4
+	}
 
 	maxFlowWinSize := config.MaxFlowWinSize
 	if maxFlowWinSize == 0 {
@@ -418,35 +660,73 @@ func newSocket(m *multiplexer, config *Config, sockID uint32, isServer bool, isD
 		m:              m,
 		Config:         config,
 		raddr:          raddr,
+		clock:          clock,
 		created:        now,
-		sockState:      sockStateInit,
 		udtVer:         4,
 		isServer:       isServer,
 		mtu:            atomicUint32{val: uint32(mtu)},
 		maxFlowWinSize: maxFlowWinSize,
+		recvWindow:     atomicUint32{val: uint32(initialRecvWindow(config, maxFlowWinSize))},
+		flowWindow:     atomicUint32{val: uint32(maxFlowWinSize)},
 		isDatagram:     isDatagram,
 		sockID:         sockID,
-		initPktSeq:     packet.PacketID{Seq: randUint32()},
-		messageIn:      make(chan []byte, 256),
+		initPktSeq:     newInitialSeq(config),
+		messageIn:      make(chan recvMessage, 256),
 		messageOut:     make(chan sendMessage, 256),
+		writeClosing:   make(chan struct{}),
 		recvEvent:      make(chan recvPktEvent, 256),
 		sendEvent:      make(chan recvPktEvent, 256),
+		expTimeout:     make(chan time.Time, 1),
 		sockClosed:     make(chan struct{}, 1),
 		sockShutdown:   make(chan struct{}, 1),
+		readClosed:     make(chan struct{}),
+		unreliableIn:   make(chan []byte, unreliableQueueSize),
+		sendDebug:      make(chan debugRequest),
+		recvDebug:      make(chan debugRequest, 1),
+		mtuEvent:       make(chan struct{}, 1),
+		connectDone:    make(chan struct{}, 1),
+		quotaHit:       make(chan struct{}, 1),
+		receipts:       make(map[*Receipt]struct{}),
+		rtt:            newRTTEstimator(),
+		drift:          newDriftTracer(),
 		deliveryRate:   16,
 		bandwidth:      1,
 		sendPacket:     make(chan packet.Packet, 256),
-		shutdownEvent:  make(chan shutdownMessage, 5),
+		sendFeedback:   make(chan packet.Packet, 256),
+		shutdownEvent:  newShutdownLatch(),
+		pathProbeStart: make(chan struct{}, 1),
+		readDeadline:   newDeadline(),
+		writeDeadline:  newDeadline(),
+		routines:       newRoutineGroup(),
+	}
+	s.sendLimit = newTokenBucket(clock, config.MaxBandwidth)
+	s.ackPeriod.set(config.ACKPeriod)
+	s.nakPeriod.set(config.NAKPeriod)
+	s.cork.set(config.CorkInterval)
+	if config.EventLoop {
+		wheel := m.timers(clock)
+		s.recvLoop = newEventLoop(wheel, s.routines)
+		s.congLoop = newEventLoop(wheel, s.routines)
 	}
 	s.cong = newUdtSocketCc(s)
 
 	return
 }
 
-func (s *udtSocket) launchProcessors() {
+// launchProcessors starts the sending and receiving sides of the connection, once they've been configured from our
+// peer's handshake
+func (s *udtSocket) launchProcessors(p *packet.HandshakePacket, resetSeq bool) {
+	s.noteCapabilities(p)
 	s.send = newUdtSocketSend(s)
 	s.recv = newUdtSocketRecv(s)
 	s.cong.init(s.initPktSeq)
+	s.recv.configureHandshake(p)
+	s.send.configureHandshake(p, resetSeq)
+	s.routines.goRun(s.send.goSendEvent)
+	s.routines.goRun(s.recv.goReceiveEvent)
+	if s.Config.WatchdogTimeout > 0 {
+		s.routines.goRun(s.goWatchdog)
+	}
 }
 
 func (s *udtSocket) startConnect() error {
@@ -455,11 +735,14 @@ func (s *udtSocket) startConnect() error {
 	s.connectWait = connectWait
 	connectWait.Add(1)
 
-	s.sockState = sockStateConnecting
+	s.sockState.set(sockStateConnecting)
+	if len(s.Config.PreSharedKey) > 0 {
+		s.authNonce = newAuthNonce()
+	}
 
-	s.connTimeout = time.After(3 * time.Second)
-	s.connRetry = time.After(250 * time.Millisecond)
-	go s.goManageConnection()
+	s.connTimeout = s.clock.After(3 * time.Second)
+	s.connRetry = s.clock.After(250 * time.Millisecond)
+	s.routines.goRun(s.goManageConnection)
 
 	s.sendHandshake(0, packet.HsRequest)
 
@@ -467,84 +750,219 @@ func (s *udtSocket) startConnect() error {
 	return s.connectionError()
 }
 
+// abortOnDone shuts down a connection attempt if ctx is cancelled (or its deadline passes) before the returned function
+// is called, so that startConnect or startRendezvous returns early with ctx.Err()
+func (s *udtSocket) abortOnDone(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-done:
+				return // stopped before we got here, the context ending afterwards doesn't concern us
+			default:
+			}
+			s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: ctx.Err()})
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 func (s *udtSocket) startRendezvous() error {
+	if len(s.Config.PreSharedKey) > 0 {
+		err := errors.New("Config.PreSharedKey can't be used for rendezvous connections")
+		s.shutdown(sockStateClosed, false, err)
+		return err
+	}
+	if !s.m.startRendezvous(s) {
+		err := errors.New("A rendezvous with that peer is already in progress on this local address")
+		s.shutdown(sockStateClosed, false, err)
+		return err
+	}
+
 	connectWait := &sync.WaitGroup{}
 	s.connectWait = connectWait
 	s.connectWait.Add(1)
 
-	s.sockState = sockStateRendezvous
+	s.sockState.set(sockStateRendezvous)
 
-	s.connTimeout = time.After(30 * time.Second)
-	s.connRetry = time.After(250 * time.Millisecond)
-	go s.goManageConnection()
+	s.connTimeout = s.clock.After(30 * time.Second)
+	s.connRetry = s.clock.After(250 * time.Millisecond)
+	s.routines.goRun(s.goManageConnection)
 
-	s.m.startRendezvous(s)
 	s.sendHandshake(0, packet.HsRendezvous)
 
 	connectWait.Wait()
 	return s.connectionError()
 }
 
+// timestamp returns the timestamp to place in packets we're sending
+func (s *udtSocket) timestamp() uint32 {
+	return uint32(s.elapsed() / time.Microsecond)
+}
+
 func (s *udtSocket) goManageConnection() {
 	sockClosed := s.sockClosed
 	sockShutdown := s.sockShutdown
+	var pathProbe <-chan time.Time
+	idleTimer := s.idleTimer()
+	durationTimer := s.durationTimer()
 	for {
 		select {
 		case <-s.lingerTimer: // linger timer expired, shut everything down
+			s.closePaths()
 			s.m.closeSocket(s.sockID)
 			close(s.sockClosed)
+			s.routines.close()
+			s.abandonReceipts()
+			s.wakeLoops()
 			return
 		case _, _ = <-sockShutdown:
 			// catching this to force re-evaluation of this select (catching the linger timer)
+			sockShutdown = nil // it stays closed, don't spin on it
 		case _, _ = <-sockClosed:
 			return
+		case p := <-s.sendFeedback:
+			s.writePacket(p)
 		case p := <-s.sendPacket:
-			ts := uint32(time.Now().Sub(s.created) / time.Microsecond)
-			s.cong.onPktSent(p)
-			log.Printf("%s (id=%d) sending %s to %s (id=%d)", s.m.laddr.String(), s.sockID, packet.PacketTypeName(p.PacketType()),
-				s.raddr.String(), s.farSockID)
-			s.m.sendPacket(s.raddr, s.farSockID, ts, p)
-		case sd := <-s.shutdownEvent: // connection shut down
+			s.flushFeedback() // never make feedback wait behind data
+			s.writePacket(p)
+		case <-s.pathProbeStart:
+			if pathProbe == nil {
+				pathProbe = s.clock.After(s.pathProbePeriod())
+			}
+		case <-pathProbe:
+			s.probePaths()
+			pathProbe = s.clock.After(s.pathProbePeriod())
+		case <-s.shutdownEvent.ready: // connection shut down
+			sd := s.shutdownEvent.msg
+			s.flushSendPackets() // make sure a queued shutdown packet goes out before we stop
 			s.shutdown(sd.sockState, sd.permitLinger, sd.err)
+		case <-idleTimer: // we may not have sent or received anything for a while
+			idleTimer = s.checkIdle()
+		case <-durationTimer: // open for as long as Config.MaxDurationPerConn permits
+			durationTimer = nil
+			s.exceedQuota()
+		case <-s.quotaHit: // sent and received as much as Config.MaxBytesPerConn permits
+			s.exceedQuota()
+		case <-s.connectDone: // connection established, stop trying
+			s.connRetry = nil
+			s.connTimeout = nil
+			if s.connectWait != nil {
+				s.connectWait.Done()
+				s.connectWait = nil
+			}
 		case <-s.connTimeout: // connection timed out
 			s.shutdown(sockStateTimeout, true, nil)
 		case <-s.connRetry: // resend connection attempt
 			s.connRetry = nil
-			switch s.sockState {
+			switch s.sockState.get() {
 			case sockStateConnecting:
 				s.sendHandshake(0, packet.HsRequest)
-				s.connRetry = time.After(250 * time.Millisecond)
+				s.connRetry = s.clock.After(250 * time.Millisecond)
 			case sockStateRendezvous:
 				s.sendHandshake(0, packet.HsRendezvous)
-				s.connRetry = time.After(250 * time.Millisecond)
+				s.connRetry = s.clock.After(250 * time.Millisecond)
 			}
 		}
 	}
 }
 
-func (s *udtSocket) sendHandshake(synCookie uint32, reqType packet.HandshakeReqType) {
-	sockType := packet.TypeSTREAM
+// writePacket passes a packet to the multiplexer(s) to be sent out on the wire
+func (s *udtSocket) writePacket(p packet.Packet) {
+	ts := s.timestamp()
+	s.cong.onPktSent(p)
+	log.Printf("%s (id=%d) sending %s to %s (id=%d)", s.m.laddr.String(), s.sockID, packet.PacketTypeName(p.PacketType()),
+		s.raddr.String(), s.farSockID.get())
+	if paths := s.schedulePaths(p); paths != nil {
+		for _, path := range paths {
+			path.pktSent.add(1)
+			path.m.sendPacket(s, path.raddr, s.farSockID.get(), ts, p)
+		}
+	} else if _, ok := p.(*packet.ShutdownPacket); ok {
+		s.m.sendPacketWait(s, s.raddr, s.farSockID.get(), ts, p)
+	} else {
+		s.m.sendPacket(s, s.raddr, s.farSockID.get(), ts, p)
+	}
+}
+
+// flushSendPackets writes out any packets already queued to be sent
+func (s *udtSocket) flushSendPackets() {
+	for {
+		s.flushFeedback()
+		select {
+		case p := <-s.sendPacket:
+			s.writePacket(p)
+		default:
+			return
+		}
+	}
+}
+
+// flushFeedback writes out any ACKs, NAKs and keep-alives already queued to be sent
+func (s *udtSocket) flushFeedback() {
+	for {
+		select {
+		case p := <-s.sendFeedback:
+			s.writePacket(p)
+		default:
+			return
+		}
+	}
+}
+
+// sockType returns whether this is a stream or datagram connection
+func (s *udtSocket) sockType() packet.SocketType {
 	if s.isDatagram {
-		sockType = packet.TypeDGRAM
+		return packet.TypeDGRAM
 	}
+	return packet.TypeSTREAM
+}
+
+func (s *udtSocket) sendHandshake(synCookie uint32, reqType packet.HandshakeReqType) {
+	sockType := s.sockType()
 
 	p := &packet.HandshakePacket{
 		UdtVer:         uint32(s.udtVer),
 		SockType:       sockType,
 		InitPktSeq:     s.initPktSeq,
-		MaxPktSize:     s.mtu.get(),              // maximum packet size (including UDP/IP headers)
-		MaxFlowWinSize: uint32(s.maxFlowWinSize), // maximum flow window size
+		MaxPktSize:     s.mtu.get(),        // maximum packet size (including UDP/IP headers)
+		MaxFlowWinSize: s.recvWindow.get(), // maximum flow window size
 		ReqType:        reqType,
 		SockID:         s.sockID,
 		SynCookie:      synCookie,
 		SockAddr:       s.raddr.IP,
 	}
+	if s.Config.FECBlockSize > 0 {
+		fecBlockSize := make([]byte, 4)
+		endianness.PutUint32(fecBlockSize, uint32(s.Config.FECBlockSize))
+		p.Extensions = append(p.Extensions, packet.HandshakeExtension{Type: packet.HsExtFEC, Data: fecBlockSize})
+	}
+	if s.Config.Compression != CompressionNone {
+		p.Extensions = append(p.Extensions, packet.HandshakeExtension{Type: packet.HsExtCompression, Data: []byte{byte(s.Config.Compression)}})
+	}
+	if s.Config.ServiceName != "" {
+		p.Extensions = append(p.Extensions, packet.HandshakeExtension{Type: packet.HsExtService, Data: []byte(s.Config.ServiceName)})
+	}
+	if ext, ok := s.authExtension(synCookie, reqType); ok {
+		p.Extensions = append(p.Extensions, ext)
+	}
+	if ext, ok := s.resumeExtension(reqType); ok {
+		p.Extensions = append(p.Extensions, ext)
+	}
+	if ext, ok := s.earlyDataExtension(reqType); ok {
+		p.Extensions = append(p.Extensions, ext)
+	}
 
-	ts := uint32(time.Now().Sub(s.created) / time.Microsecond)
+	ts := s.timestamp()
 	s.cong.onPktSent(p)
 	log.Printf("%s (id=%d) sending handshake(%d) to %s (id=%d)", s.m.laddr.String(), s.sockID, int(reqType),
-		s.raddr.String(), s.farSockID)
-	s.m.sendPacket(s.raddr, s.farSockID, ts, p)
+		s.raddr.String(), s.farSockID.get())
+	s.m.sendPacket(s, s.raddr, s.farSockID.get(), ts, p)
 }
 
 // checkValidHandshake checks to see if we want to accept a new connection with this handshake.
@@ -552,6 +970,12 @@ func (s *udtSocket) checkValidHandshake(m *multiplexer, p *packet.HandshakePacke
 	if s.udtVer != 4 {
 		return false
 	}
+	// (a listener's request for us to echo its syn cookie doesn't advertise a packet size)
+	if p.ReqType != packet.HsRequest && !validPacketSize(uint(p.MaxPktSize)) {
+		log.Printf("%s (id=%d) ignoring handshake from %s advertising a packet size of %d", s.m.laddr.String(), s.sockID,
+			from.String(), p.MaxPktSize)
+		return false
+	}
 	return true
 }
 
@@ -563,30 +987,32 @@ func (s *udtSocket) readHandshake(m *multiplexer, p *packet.HandshakePacket, fro
 		return false
 	}
 
-	switch s.sockState {
+	switch s.sockState.get() {
 	case sockStateInit: // server accepting a connection from a client
 		s.initPktSeq = p.InitPktSeq
 		s.udtVer = int(p.UdtVer)
-		s.farSockID = p.SockID
+		s.farSockID.set(p.SockID)
 		s.isDatagram = p.SockType == packet.TypeDGRAM
+		if ext, ok := p.Extension(packet.HsExtAuth); ok && len(s.Config.PreSharedKey) > 0 && len(ext) >= authNonceSize {
+			s.authNonce = append([]byte{}, ext[:authNonceSize]...) // already checked by the listener
+		}
 
 		if s.mtu.get() > p.MaxPktSize {
 			s.mtu.set(p.MaxPktSize)
 		}
-		s.launchProcessors()
-		s.recv.configureHandshake(p)
-		s.send.configureHandshake(p, true)
-		s.sockState = sockStateConnected
+		s.deliverEarlyData()
+		s.launchProcessors(p, true)
+		s.sockState.set(sockStateConnected)
 		s.connTimeout = nil
 		s.connRetry = nil
-		go s.goManageConnection()
+		s.routines.goRun(s.goManageConnection)
 
 		s.sendHandshake(p.SynCookie, packet.HsResponse)
 		return true
 
 	case sockStateConnecting: // client attempting to connect to server
 		if p.ReqType == packet.HsRefused {
-			s.sockState = sockStateRefused
+			s.refused(p)
 			return true
 		}
 		if p.ReqType == packet.HsRequest {
@@ -606,29 +1032,33 @@ func (s *udtSocket) readHandshake(m *multiplexer, p *packet.HandshakePacket, fro
 			// ignore, not a valid handshake request
 			return true
 		}
-		s.farSockID = p.SockID
+		if !s.checkListenerAuth(p) {
+			log.Printf("%s (id=%d) peer %s failed to authenticate", s.m.laddr.String(), s.sockID, from.String())
+			s.shutdownEvent.signal(shutdownMessage{sockState: sockStateRefused, permitLinger: false, err: ErrAuthFailed})
+			return true
+		}
+		if s.refuseDegraded(p) {
+			return true
+		}
+		s.farSockID.set(p.SockID)
+		s.readIssuedToken(p)
+		s.readEarlyDataAck(p)
 
 		if s.mtu.get() > p.MaxPktSize {
 			s.mtu.set(p.MaxPktSize)
 		}
-		s.launchProcessors()
-		s.recv.configureHandshake(p)
-		s.send.configureHandshake(p, true)
-		s.connRetry = nil
-		s.sockState = sockStateConnected
-		s.connTimeout = nil
-		if s.connectWait != nil {
-			s.connectWait.Done()
-			s.connectWait = nil
-		}
+		s.launchProcessors(p, true)
+		s.sockState.set(sockStateConnected)
+		s.connectDone <- struct{}{}
 		return true
 
 	case sockStateRendezvous: // client attempting to rendezvous with another client
 		if p.ReqType == packet.HsRefused {
-			s.sockState = sockStateRefused
+			s.refused(p)
 			return true
 		}
-		if p.ReqType != packet.HsRendezvous || s.farSockID == 0 {
+		// either our peer's own rendezvous request, or its response to ours (if it saw ours first)
+		if p.ReqType != packet.HsRendezvous && p.ReqType != packet.HsResponse {
 			return true // not a request packet, ignore
 		}
 		if !s.checkValidHandshake(m, p, from) || !from.IP.Equal(s.raddr.IP) || from.Port != s.raddr.Port || s.isDatagram != (p.SockType == packet.TypeDGRAM) {
@@ -637,26 +1067,22 @@ func (s *udtSocket) readHandshake(m *multiplexer, p *packet.HandshakePacket, fro
 		}
 		/* not quite sure how to negotiate this, assuming split-brain for now
 		if p.InitPktSeq != s.initPktSeq {
-			s.sockState = sockStateCorrupted
+			s.sockState.set(sockStateCorrupted)
 			return true
 		}
 		*/
-		s.farSockID = p.SockID
 		s.m.endRendezvous(s)
+		if s.refuseDegraded(p) {
+			return true
+		}
+		s.farSockID.set(p.SockID)
 
 		if s.mtu.get() > p.MaxPktSize {
 			s.mtu.set(p.MaxPktSize)
 		}
-		s.launchProcessors()
-		s.recv.configureHandshake(p)
-		s.send.configureHandshake(p, false)
-		s.connRetry = nil
-		s.sockState = sockStateConnected
-		s.connTimeout = nil
-		if s.connectWait != nil {
-			s.connectWait.Done()
-			s.connectWait = nil
-		}
+		s.launchProcessors(p, false)
+		s.sockState.set(sockStateConnected)
+		s.connectDone <- struct{}{}
 
 		// send the final rendezvous packet
 		s.sendHandshake(p.SynCookie, packet.HsResponse)
@@ -676,31 +1102,43 @@ func (s *udtSocket) readHandshake(m *multiplexer, p *packet.HandshakePacket, fro
 	return false
 }
 
+// refused is called when our peer refuses our connection attempt
+func (s *udtSocket) refused(p *packet.HandshakePacket) {
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateRefused, permitLinger: false, err: readRejection(p)})
+}
+
 func (s *udtSocket) shutdown(sockState sockState, permitLinger bool, err error) {
 	if !s.isOpen() {
 		return // already closed
 	}
 	if err != nil {
-		log.Printf("socket shutdown (type=%d), due to error: %s", int(sockState), err.Error())
+		log.Printf("socket shutdown (%s), due to error: %s", sockState, err.Error())
 	} else {
-		log.Printf("socket shutdown (type=%d)", int(sockState))
+		log.Printf("socket shutdown (%s)", sockState)
 	}
-	if s.sockState == sockStateRendezvous {
+	if s.sockState.get() == sockStateRendezvous {
 		s.m.endRendezvous(s)
 	}
 	if s.connectWait != nil {
 		s.connectWait.Done()
 		s.connectWait = nil
 	}
-	s.sockState = sockState
+	if err != nil {
+		s.closeErr.set(err)
+	}
+	wasConnected := s.sockState.get() == sockStateConnected
+	s.sockState.set(sockState)
 	s.cong.close()
+	if wasConnected {
+		s.audit(AuditClosed, err)
+	}
 
 	if permitLinger {
 		linger := s.Config.LingerTime
 		if linger == 0 {
 			linger = DefaultConfig().LingerTime
 		}
-		s.lingerTimer = time.After(linger)
+		s.lingerTimer = s.clock.After(linger)
 	}
 
 	s.connTimeout = nil
@@ -708,10 +1146,34 @@ func (s *udtSocket) shutdown(sockState sockState, permitLinger bool, err error)
 	if permitLinger {
 		close(s.sockShutdown)
 	} else {
+		s.closePaths()
 		s.m.closeSocket(s.sockID)
 		close(s.sockClosed)
+		s.routines.close()
+		s.abandonReceipts()
 	}
-	s.messageIn <- nil
+	s.wakeLoops()
+	close(s.readClosed)
+}
+
+// discard releases a socket that never got as far as connecting (such as one whose handshake was rejected), so it
+// doesn't hold on to its ID or its multiplexer
+func (s *udtSocket) discard() {
+	s.m.closeSocket(s.sockID)
+	close(s.sockClosed)
+	s.routines.close()
+}
+
+// wakeLoops wakes any parked event loops (in event-loop mode) so they notice the socket has been shut down or closed
+func (s *udtSocket) wakeLoops() {
+	s.recvLoop.wake()
+	s.congLoop.wake()
+}
+
+// connFailed is called by the multiplexer when the underlying connection has failed and no further
+// packets can be sent or received
+func (s *udtSocket) connFailed(err error) {
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: err})
 }
 
 func absdiff(a uint, b uint) uint {
@@ -721,19 +1183,9 @@ func absdiff(a uint, b uint) uint {
 	return a - b
 }
 
-func (s *udtSocket) applyRTT(rtt uint) {
-	s.rttProt.Lock()
-	s.rttVar = (s.rttVar*3 + absdiff(s.rtt, rtt)) >> 2
-	s.rtt = (s.rtt*7 + rtt) >> 3
-	s.rttProt.Unlock()
-}
-
+// getRTT returns the estimated roundtrip time to our peer and its variance (in microseconds)
 func (s *udtSocket) getRTT() (rtt, rttVar uint) {
-	s.rttProt.RLock()
-	rtt = s.rtt
-	rttVar = s.rttVar
-	s.rttProt.RUnlock()
-	return
+	return s.rtt.get()
 }
 
 // Update Estimated Bandwidth and packet delivery rate
@@ -756,28 +1208,49 @@ func (s *udtSocket) getRcvSpeeds() (deliveryRate uint, bandwidth uint) {
 	return
 }
 
-// called by the multiplexer read loop when a packet is received for this socket.
-// Minimal processing is permitted but try not to stall the caller
-func (s *udtSocket) readPacket(m *multiplexer, p packet.Packet, from *net.UDPAddr) {
-	now := time.Now()
-	if s.sockState == sockStateClosed {
-		return
+// acceptsFrom returns true if a packet addressed to this socket came from our peer (on any of the paths we share with
+// it), or is a request from our peer to add a new path
+func (s *udtSocket) acceptsFrom(m *multiplexer, p packet.Packet, from *net.UDPAddr) bool {
+	if m == s.m && from.IP.Equal(s.raddr.IP) && from.Port == s.raddr.Port {
+		return true
 	}
-	if !from.IP.Equal(s.raddr.IP) || from.Port != s.raddr.Port {
-		log.Printf("Socket connected to %s received a packet from %s? Discarded", s.raddr.String(), from.String())
-		return
+	if s.findPath(m, from) != nil {
+		return true
 	}
+	// the only thing we'll accept from an unknown address is a request to add it as a new path
+	if up, ok := p.(*packet.UserDefControlPacket); ok && up.MsgType == mpJoinMsgType {
+		return true
+	}
+	log.Printf("Socket connected to %s received a packet from %s? Discarded", s.raddr.String(), from.String())
+	return false
+}
 
+// called by the multiplexer read loop when a packet is received for this socket (rxAge ago, as measured by the kernel).
+// Minimal processing is permitted but try not to stall the caller
+func (s *udtSocket) readPacket(m *multiplexer, p packet.Packet, from *net.UDPAddr, rxAge time.Duration) {
+	now := s.clock.Now().Add(-rxAge)
+	if !s.isOpen() {
+		// once shut down nothing is left reading these, and blocking here would stall every socket on the multiplexer
+		releasePacket(p)
+		return
+	}
 	s.recvEvent <- recvPktEvent{pkt: p, now: now}
+	s.recvLoop.wake()
 
 	switch sp := p.(type) {
 	case *packet.HandshakePacket: // sent by both peers
 		s.readHandshake(m, sp, from)
 	case *packet.ShutdownPacket: // sent by either peer
-		s.shutdownEvent <- shutdownMessage{sockState: sockStateClosed, permitLinger: true}
+		s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: true, err: readCloseReason(sp)})
 	case *packet.AckPacket, *packet.LightAckPacket, *packet.NakPacket: // receiver -> sender
 		s.sendEvent <- recvPktEvent{pkt: p, now: now}
 	case *packet.UserDefControlPacket:
-		s.cong.onCustomMsg(*sp)
+		if sp.MsgType == unreliableMsgType {
+			s.queueUnreliable(sp.Data)
+		} else if sp.MsgType == ecnMsgType {
+			s.readECNEcho(sp.Data)
+		} else if !s.readPathPacket(m, sp, from) && sp.MsgType != fecMsgType {
+			s.cong.onCustomMsg(*sp)
+		}
 	}
 }
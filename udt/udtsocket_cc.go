@@ -36,6 +36,9 @@ type udtSocketCc struct {
 	sendPktSeq packet.PacketID // packetID of most recently sent packet
 	congWindow uint            // size of congestion window (in packets)
 	sndPeriod  time.Duration   // delay between sending packets
+
+	notifiedPeriod time.Duration // sndPeriod as last passed to Config.OnRateChange
+	notifiedWindow uint          // congWindow as last passed to Config.OnRateChange
 }
 
 func newUdtSocketCc(s *udtSocket) *udtSocketCc {
@@ -47,16 +50,20 @@ func newUdtSocketCc(s *udtSocket) *udtSocketCc {
 	sc := &udtSocketCc{
 		socket:     s,
 		sockClosed: s.sockClosed,
-		congestion: newCongestion(s),
 		msgs:       make(chan congMsg, 100),
 	}
-	go sc.goCongestionEvent()
+	sc.congestion = newCongestion(sc)
+	if s.congLoop != nil {
+		s.congLoop.run = sc.goCongestionEvent
+	}
+	s.routines.goRun(sc.goCongestionEvent)
 	return sc
 }
 
 func (s *udtSocketCc) goCongestionEvent() {
 	msgs := s.msgs
 	sockClosed := s.sockClosed
+	idle := s.socket.congLoop.idle()
 	for {
 		select {
 		case evt, ok := <-msgs:
@@ -82,35 +89,58 @@ func (s *udtSocketCc) goCongestionEvent() {
 			case congOnPktRecv:
 				s.congestion.OnPktRecv(s, evt.arg.(packet.DataPacket))
 			case congOnCustomMsg:
-				s.congestion.OnCustomMsg(s, evt.arg.(packet.UserDefControlPacket))
+				p := evt.arg.(packet.UserDefControlPacket)
+				s.congestion.OnCustomMsg(s, p)
+				s.socket.deliverControl(p)
 			}
+			s.notifyRate()
 		case _, _ = <-sockClosed:
 			return
+		case <-idle: // event-loop mode, we may have nothing left to do
+			if !s.hasEvents() && s.socket.congLoop.park() {
+				return
+			}
 		}
 	}
 }
 
+// hasEvents returns true if goCongestionEvent has anything waiting to be processed
+func (s *udtSocketCc) hasEvents() bool {
+	select {
+	case _, _ = <-s.sockClosed:
+		return true
+	default:
+	}
+	return len(s.msgs) > 0
+}
+
+// post queues a message for goCongestionEvent
+func (s *udtSocketCc) post(msg congMsg) {
+	s.msgs <- msg
+	s.socket.congLoop.wake()
+}
+
 // Init to be called (only) at the start of a UDT connection.
 func (s *udtSocketCc) init(sendPktSeq packet.PacketID) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp:  congInit,
 		pktID: sendPktSeq,
-	}
+	})
 }
 
 // Close to be called when a UDT connection is closed.
 func (s *udtSocketCc) close() {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congClose,
-	}
+	})
 }
 
 // OnACK to be called when an ACK packet is received
 func (s *udtSocketCc) onACK(pktID packet.PacketID) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp:  congOnACK,
 		pktID: pktID,
-	}
+	})
 }
 
 // OnNAK to be called when a loss report is received
@@ -118,49 +148,54 @@ func (s *udtSocketCc) onNAK(loss []packet.PacketID) {
 	var ourLoss = make([]packet.PacketID, len(loss))
 	copy(ourLoss, loss)
 
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congOnNAK,
 		arg:  ourLoss,
-	}
+	})
 }
 
 // OnTimeout to be called when a timeout event occurs
 func (s *udtSocketCc) onTimeout() {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congOnTimeout,
-	}
+	})
 }
 
 // OnPktSent to be called when data is sent
 func (s *udtSocketCc) onDataPktSent(pktID packet.PacketID) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp:  congOnDataPktSent,
 		pktID: pktID,
-	}
+	})
 }
 
 // OnPktSent to be called when data is sent
 func (s *udtSocketCc) onPktSent(p packet.Packet) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congOnPktSent,
 		arg:  p,
-	}
+	})
 }
 
 // OnPktRecv to be called when data is received
 func (s *udtSocketCc) onPktRecv(p packet.DataPacket) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congOnPktRecv,
 		arg:  p,
-	}
+	})
 }
 
 // OnCustomMsg to process a user-defined packet
 func (s *udtSocketCc) onCustomMsg(p packet.UserDefControlPacket) {
-	s.msgs <- congMsg{
+	s.post(congMsg{
 		mtyp: congOnCustomMsg,
 		arg:  p,
-	}
+	})
+}
+
+// config returns the Config of the socket we're controlling, for NativeCongestionControl to be tuned by
+func (s *udtSocketCc) config() *Config {
+	return s.socket.Config
 }
 
 // GetSndCurrSeqNo is the most recently sent packet ID
@@ -202,15 +237,53 @@ func (s *udtSocketCc) GetReceiveRates() (uint, uint) {
 
 // GetRTT is the current calculated roundtrip time between peers
 func (s *udtSocketCc) GetRTT() time.Duration {
-	rtt, _ := s.socket.getRTT()
-	return time.Duration(rtt) * time.Microsecond
+	return s.RTT()
 }
 
 // GetMSS is the largest packet size we can currently send (in bytes)
 func (s *udtSocketCc) GetMSS() uint {
+	return s.MTU()
+}
+
+// RTT is the smoothed roundtrip time between peers
+func (s *udtSocketCc) RTT() time.Duration {
+	rtt, _ := s.socket.getRTT()
+	return time.Duration(rtt) * time.Microsecond
+}
+
+// RTTVar is the variance in the roundtrip time between peers
+func (s *udtSocketCc) RTTVar() time.Duration {
+	_, rttVar := s.socket.getRTT()
+	return time.Duration(rttVar) * time.Microsecond
+}
+
+// Bandwidth is the link capacity estimated by the peer (in packets/sec)
+func (s *udtSocketCc) Bandwidth() uint {
+	_, bandwidth := s.socket.getRcvSpeeds()
+	return bandwidth
+}
+
+// DeliveryRate is the rate the peer is receiving our packets (in packets/sec)
+func (s *udtSocketCc) DeliveryRate() uint {
+	deliveryRate, _ := s.socket.getRcvSpeeds()
+	return deliveryRate
+}
+
+// FlightSize is the number of data packets we've sent that haven't yet been acknowledged
+func (s *udtSocketCc) FlightSize() uint {
+	return uint(s.socket.flightSize.get())
+}
+
+// MTU is the largest packet we can currently send, including UDP/IP headers (in bytes)
+func (s *udtSocketCc) MTU() uint {
 	return uint(s.socket.mtu.get())
 }
 
+// FlowWindow is the number of unacknowledged packets the peer is currently willing to accept
+func (s *udtSocketCc) FlowWindow() uint {
+	return uint(s.socket.flowWindow.get())
+}
+
 // SetACKPerid sets the time between ACKs sent to the peer
 func (s *udtSocketCc) SetACKPeriod(ack time.Duration) {
 	s.socket.recv.ackPeriod.set(ack)
@@ -223,5 +296,5 @@ func (s *udtSocketCc) SetACKInterval(ack uint) {
 
 // SetRTOPeriod overrides the default EXP timeout calculations waiting for data from the peer
 func (s *udtSocketCc) SetRTOPeriod(rto time.Duration) {
-	s.socket.send.rtoPeriod.set(rto)
+	s.socket.recv.rtoPeriod.set(rto)
 }
@@ -2,10 +2,11 @@ package udt
 
 import (
 	"container/heap"
+	"fmt"
 	"log"
+	"sort"
 	"time"
 
-	"github.com/furstenheim/nth_element/FloydRivest"
 	"github.com/odysseus654/go-udt/udt/packet"
 )
 
@@ -13,37 +14,60 @@ const (
 	ackSelfClockInterval = 64
 )
 
+// partialMessage tracks a multi-packet datagram message that is being reassembled
+type partialMessage struct {
+	firstSeen time.Time // when we received the first fragment of this message
+	size      uint      // number of payload bytes received so far
+}
+
 type udtSocketRecv struct {
 	// channels
-	sockClosed   <-chan struct{}      // closed when socket is closed
-	sockShutdown <-chan struct{}      // closed when socket is shutdown
-	recvEvent    <-chan recvPktEvent  // receiver: ingest the specified packet. Sender is readPacket, receiver is goReceiveEvent
-	messageIn    chan<- []byte        // inbound messages. Sender is goReceiveEvent->ingestData, Receiver is client caller (Read)
-	sendPacket   chan<- packet.Packet // send a packet out on the wire
-	socket       *udtSocket
-
-	farNextPktSeq      packet.PacketID // the peer's next largest packet ID expected.
-	farRecdPktSeq      packet.PacketID // the peer's last "received" packet ID (before any loss events)
-	lastACK            uint32          // last ACK packet we've sent
-	largestACK         uint32          // largest ACK packet we've sent that has been acknowledged (by an ACK2).
-	recvPktPend        dataPacketHeap  // list of packets that are waiting to be processed.
-	recvLossList       receiveLossHeap // loss list.
-	ackHistory         ackHistoryHeap  // list of sent ACKs.
-	sentAck            packet.PacketID // largest packetID we've sent an ACK regarding
-	recvAck2           packet.PacketID // largest packetID we've received an ACK2 from
-	recvLastArrival    time.Time       // time of the most recent data packet arrival
-	recvLastProbe      time.Time       // time of the most recent data packet probe packet
-	ackPeriod          atomicDuration  // (set by congestion control) delay between sending ACKs
-	ackInterval        atomicUint32    // (set by congestion control) number of data packets to send before sending an ACK
-	unackPktCount      uint            // number of packets we've received that we haven't sent an ACK for
-	lightAckCount      uint            // number of "light ACK" packets we've sent since the last ACK
-	recvPktHistory     []time.Duration // list of recently received packets.
-	recvPktPairHistory []time.Duration // probing packet window.
+	sockClosed    <-chan struct{}      // closed when socket is closed
+	sockShutdown  <-chan struct{}      // closed when socket is shutdown
+	recvEvent     <-chan recvPktEvent  // receiver: ingest the specified packet. Sender is readPacket, receiver is goReceiveEvent
+	messageIn     chan<- recvMessage   // inbound messages. Sender is goReceiveEvent->ingestData, Receiver is client caller (Read)
+	debugEvent    <-chan debugRequest  // fill in a DebugInfo. Sender is client caller (Debug), receiver is goReceiveEvent
+	sendFeedback  chan<- packet.Packet // send an ACK or NAK out on the wire
+	expTimeout    chan<- time.Time     // sender: EXP timer has fired. Sender is goReceiveEvent, receiver is goSendEvent
+	shutdownEvent *shutdownLatch       // signals the connection to be shutdown
+	socket        *udtSocket
+
+	farNextPktSeq packet.PacketID            // the peer's next largest packet ID expected.
+	farRecdPktSeq packet.PacketID            // the peer's last "received" packet ID (before any loss events)
+	lastACK       uint32                     // last ACK packet we've sent
+	largestACK    uint32                     // largest ACK packet we've sent that has been acknowledged (by an ACK2).
+	recvPktPend   dataPacketHeap             // list of packets that are waiting to be processed.
+	recvPendBytes atomicUint64               // number of payload bytes held in recvPktPend
+	beats         atomicUint32               // number of times round our event loop, for the watchdog (see watchdog.go)
+	partialMsgs   map[uint32]*partialMessage // datagram messages currently being reassembled, by message number
+	droppedMsgs   map[uint32]time.Time       // datagram messages we've given up on reassembling, and when we did so
+	fec           *fecDecoder                // if set, our peer is sending us FEC parity packets
+	decompressor  *payloadDecompressor       // if set, our peer is compressing the data packets it sends
+	fecRecovered  atomicUint64               // number of lost packets we've rebuilt from FEC parity packets
+	pktRcvLoss    atomicUint64               // number of lost packets we've detected and reported to our peer
+	nakSuppressed atomicUint64               // number of loss reports held back for having been sent too recently
+	recvLossList  receiveLossHeap            // loss list.
+	ackHistory    *ackWindow                 // ACKs we've sent that are waiting for an ACK2
+	sentAck       packet.PacketID            // largest packetID we've sent an ACK regarding
+	recvAck2      packet.PacketID            // largest packetID we've received an ACK2 from
+	recvArrivals  *arrivalWindow             // intervals between recently received data packets
+	recvPktPairs  *pairWindow                // intervals between the packets of recently received probe pairs
+	recvRate      atomicUint32               // packet arrival rate (packets/sec) as of our last ACK, for Stats
+	recvBandwidth atomicUint32               // estimated link capacity (packets/sec) as of our last ACK, for Stats
+	ackPeriod     atomicDuration             // (set by congestion control) delay between sending ACKs
+	ackInterval   atomicUint32               // (set by congestion control) number of data packets to send before sending an ACK
+	unackPktCount uint                       // number of packets we've received that we haven't sent an ACK for
+	lightAckCount uint                       // number of "light ACK" packets we've sent since the last ACK
+	rtoPeriod     atomicDuration             // (set by congestion control) override of EXP timer calculations
+	expCount      uint                       // number of continuous EXP timeouts.
+	lastRecvTime  time.Time                  // the last time we've heard something from the remote system
 
 	// timers
 	ackSentEvent2 <-chan time.Time // if an ACK packet has recently sent, don't include link information in the next one
 	ackSentEvent  <-chan time.Time // if an ACK packet has recently sent, wait before resending it
 	ackTimerEvent <-chan time.Time // controls when to send an ACK to our peer
+	nakTimerEvent <-chan time.Time // controls when to resend loss reports to our peer
+	expTimerEvent <-chan time.Time // Fires when we haven't heard from the peer in a while
 }
 
 func newUdtSocketRecv(s *udtSocket) *udtSocketRecv {
@@ -53,10 +77,22 @@ func newUdtSocketRecv(s *udtSocket) *udtSocketRecv {
 		sockShutdown:  s.sockShutdown,
 		recvEvent:     s.recvEvent,
 		messageIn:     s.messageIn,
-		sendPacket:    s.sendPacket,
-		ackTimerEvent: time.After(synTime),
+		debugEvent:    s.recvDebug,
+		sendFeedback:  s.sendFeedback,
+		expTimeout:    s.expTimeout,
+		shutdownEvent: s.shutdownEvent,
+		expCount:      1,
+		lastRecvTime:  s.clock.Now(),
+		ackHistory:    newAckWindow(s.ackHistorySize()),
+		recvArrivals:  newArrivalWindow(s.arrivalWindowSize()),
+		recvPktPairs:  newPairWindow(s.pairWindowSize()),
+	}
+	sr.ackTimerEvent = sr.after(sr.ackTimerPeriod())
+	sr.nakTimerEvent = sr.after(sr.nakTimerPeriod())
+	sr.expTimerEvent = sr.after(sr.expTimerPeriod())
+	if s.recvLoop != nil {
+		s.recvLoop.run = sr.goReceiveEvent
 	}
-	go sr.goReceiveEvent()
 	return sr
 }
 
@@ -65,18 +101,36 @@ func (s *udtSocketRecv) configureHandshake(p *packet.HandshakePacket) {
 	s.farRecdPktSeq = p.InitPktSeq.Add(-1)
 	s.sentAck = p.InitPktSeq
 	s.recvAck2 = p.InitPktSeq
+	if s.socket.Config.FECBlockSize > 0 {
+		if ext, ok := p.Extension(packet.HsExtFEC); ok && len(ext) >= 4 {
+			if peerBlockSize := endianness.Uint32(ext); peerBlockSize > 0 {
+				s.fec = newFecDecoder(uint(peerBlockSize))
+			}
+		}
+	}
+	if compression := negotiateCompression(s.socket.Config, p); compression != CompressionNone {
+		s.decompressor = newPayloadDecompressor(compression)
+	}
 }
 
 func (s *udtSocketRecv) goReceiveEvent() {
 	recvEvent := s.recvEvent
 	sockClosed := s.sockClosed
 	sockShutdown := s.sockShutdown
+	idle := s.socket.recvLoop.idle()
 	for {
+		s.beats.add(1)
 		select {
 		case evt, ok := <-recvEvent:
 			if !ok {
 				return
 			}
+			s.lastRecvTime = evt.now
+			if s.expCount > 1 {
+				// we've been backing off, restart the EXP timer now that we've heard from our peer
+				s.expCount = 1
+				s.expTimerEvent = s.after(s.expTimerPeriod())
+			}
 			switch sp := evt.pkt.(type) {
 			case *packet.Ack2Packet:
 				s.ingestAck2(sp, evt.now)
@@ -86,7 +140,13 @@ func (s *udtSocketRecv) goReceiveEvent() {
 				s.ingestData(sp, evt.now)
 			case *packet.ErrPacket:
 				s.ingestError(sp)
+			case *packet.UserDefControlPacket:
+				if sp.MsgType == fecMsgType {
+					s.ingestFEC(sp, evt.now)
+				}
 			}
+			s.armTimers()
+			s.updateMemory()
 		case _, _ = <-sockShutdown: // socket is shut down, no need to receive any further data
 			return
 		case _, _ = <-sockClosed: // socket is closed, leave now
@@ -97,10 +157,39 @@ func (s *udtSocketRecv) goReceiveEvent() {
 			s.ackSentEvent2 = nil
 		case <-s.ackTimerEvent:
 			s.ackEvent()
+		case now := <-s.nakTimerEvent:
+			s.nakEvent(now)
+		case now := <-s.expTimerEvent:
+			s.expEvent(now)
+		case req := <-s.debugEvent:
+			s.debug(req.info)
+			close(req.done)
+		case <-idle: // event-loop mode, we may have nothing left to do
+			if !s.hasEvents() && s.socket.recvLoop.park() {
+				return
+			}
 		}
 	}
 }
 
+// hasEvents returns true if goReceiveEvent has anything waiting to be processed
+func (s *udtSocketRecv) hasEvents() bool {
+	select {
+	case _, _ = <-s.sockClosed:
+		return true
+	case _, _ = <-s.sockShutdown:
+		return true
+	default:
+	}
+	return len(s.recvEvent) > 0 || len(s.ackSentEvent) > 0 || len(s.ackSentEvent2) > 0 || len(s.ackTimerEvent) > 0 ||
+		len(s.nakTimerEvent) > 0 || len(s.expTimerEvent) > 0 || len(s.debugEvent) > 0
+}
+
+// after returns a channel that receives the time after d, from the timer wheel in event-loop mode
+func (s *udtSocketRecv) after(d time.Duration) <-chan time.Time {
+	return s.socket.recvLoop.after(s.socket.clock, d)
+}
+
 /*
 ACK is used to trigger an acknowledgement (ACK). Its period is set by
    the congestion control module. However, UDT will send an ACK no
@@ -123,132 +212,128 @@ ACK is used to trigger an acknowledgement (ACK). Its period is set by
 // ingestAck2 is called to process an ACK2 packet
 func (s *udtSocketRecv) ingestAck2(p *packet.Ack2Packet, now time.Time) {
 	ackSeq := p.AckSeqNo
-	if s.ackHistory == nil {
-		return // no ACKs to search
-	}
-
-	ackHistEntry, ackIdx := s.ackHistory.Find(ackSeq)
-	if ackHistEntry == nil {
-		return // this ACK not found
+	lastPacket, rtt, ok := s.ackHistory.acknowledge(ackSeq, now)
+	if !ok {
+		return // this ACK not found (or already acknowledged)
 	}
-	if s.recvAck2.BlindDiff(ackHistEntry.lastPacket) < 0 {
-		s.recvAck2 = ackHistEntry.lastPacket
+	if s.recvAck2.Cmp(lastPacket) < 0 {
+		s.recvAck2 = lastPacket
 	}
-	heap.Remove(&s.ackHistory, ackIdx)
 
 	// Update the largest ACK number ever been acknowledged.
 	if s.largestACK < ackSeq {
 		s.largestACK = ackSeq
 	}
 
-	s.socket.applyRTT(uint(now.Sub(ackHistEntry.sendTime) / time.Microsecond))
-
-	//s.rto = 4 * s.rtt + s.rttVar
+	if s.socket.rtt.applySample(rtt) {
+		s.socket.drift.sample(p.SendTime(), now.Sub(s.socket.created), rtt)
+		s.socket.notifyRTT()
+	}
 }
 
 // ingestMsgDropReq is called to process an message drop request packet
 func (s *udtSocketRecv) ingestMsgDropReq(p *packet.MsgDropReqPacket, now time.Time) {
 	stopSeq := p.LastSeq.Add(1)
 	for pktID := p.FirstSeq; pktID != stopSeq; pktID.Incr() {
-		// remove all these packets from the loss list
-		if s.recvLossList != nil {
-			if lossEntry, idx := s.recvLossList.Find(pktID); lossEntry != nil {
-				heap.Remove(&s.recvLossList, idx)
-			}
-		}
-
 		// remove all pending packets with this message
 		if s.recvPktPend != nil {
 			if lossEntry, idx := s.recvPktPend.Find(pktID); lossEntry != nil {
-				heap.Remove(&s.recvPktPend, idx)
+				s.releaseData(s.removePending(idx))
 			}
 		}
 
 	}
+	delete(s.partialMsgs, p.MsgID)
+	s.forgetLoss(p.FirstSeq, p.LastSeq)
 
-	if p.FirstSeq == s.farRecdPktSeq.Add(1) {
-		s.farRecdPktSeq = p.LastSeq
-	}
-	if s.recvLossList != nil && len(s.recvLossList) == 0 {
-		s.farRecdPktSeq = s.farNextPktSeq.Add(-1)
-		s.recvLossList = nil
+	// try to push any pending packets out, now that we have dropped any blocking packets
+	s.deliverPending()
+}
+
+// forgetLoss removes the packets from first to last (inclusive) from the loss list, as we no longer want them.  Our
+// next ACK then moves past them, so our peer stops retransmitting them
+func (s *udtSocketRecv) forgetLoss(first, last packet.PacketID) {
+	if s.recvLossList == nil {
+		return
 	}
-	if s.recvPktPend != nil && len(s.recvPktPend) == 0 {
-		s.recvPktPend = nil
+	stopSeq := last.Add(1)
+	for pktID := first; pktID != stopSeq; pktID.Incr() {
+		if lossEntry, idx := s.recvLossList.Find(pktID); lossEntry != nil {
+			heap.Remove(&s.recvLossList, idx)
+		}
 	}
 
-	// try to push any pending packets out, now that we have dropped any blocking packets
-	for s.recvPktPend != nil && stopSeq != s.farNextPktSeq {
-		nextPkt, _ := s.recvPktPend.Min(stopSeq, s.farNextPktSeq)
-		if nextPkt == nil || !s.attemptProcessPacket(nextPkt, false) {
-			break
-		}
+	if len(s.recvLossList) == 0 {
+		s.farRecdPktSeq = s.farNextPktSeq.Add(-1)
+		s.recvLossList = nil
+	} else {
+		minLoss, _ := s.recvLossList.Min(s.farRecdPktSeq, s.farNextPktSeq)
+		s.farRecdPktSeq = minLoss.Add(-1)
 	}
 }
 
 // ingestData is called to process a data packet
 func (s *udtSocketRecv) ingestData(p *packet.DataPacket, now time.Time) {
-	s.socket.cong.onPktRecv(*p)
+	s.socket.markActive(now)
+
+	// discard anything we'd have to hold on to if we've used up our share of memory (see Config.MemoryLimit)
+	if seqDiff := p.Seq.Diff(s.farNextPktSeq); (seqDiff > 0 || (seqDiff == 0 && s.recvLossList != nil)) &&
+		!s.socket.m.mem.allows(s.socket.sockID, uint64(s.socket.mtu.get())+uint64(seqDiff)*recvLossEntrySize) {
+		s.socket.memDropped.add(1)
+		s.releaseData(p)
+		return
+	}
+
+	// the payload may be recycled before congestion control gets around to looking at this packet, so don't share it
+	ccPkt := *p
+	ccPkt.Data = nil
+	s.socket.cong.onPktRecv(ccPkt)
 
 	seq := p.Seq
 
 	/* If the sequence number of the current data packet is 16n + 1,
 	where n is an integer, record the time interval between this
 	packet and the last data packet in the Packet Pair Window. */
-	if (seq.Seq-1)&0xf == 0 {
-		if !s.recvLastProbe.IsZero() {
-			if s.recvPktPairHistory == nil {
-				s.recvPktPairHistory = []time.Duration{now.Sub(s.recvLastProbe)}
-			} else {
-				s.recvPktPairHistory = append(s.recvPktPairHistory, now.Sub(s.recvLastProbe))
-				if len(s.recvPktPairHistory) > 16 {
-					s.recvPktPairHistory = s.recvPktPairHistory[len(s.recvPktPairHistory)-16:]
-				}
-			}
-		}
-		s.recvLastProbe = now
+	if (seq.Seq-1)&0xf == 0 && !s.recvArrivals.lastArrival.IsZero() {
+		s.recvPktPairs.add(now.Sub(s.recvArrivals.lastArrival))
 	}
 
 	// Record the packet arrival time in PKT History Window.
-	if !s.recvLastArrival.IsZero() {
-		if s.recvPktHistory == nil {
-			s.recvPktHistory = []time.Duration{now.Sub(s.recvLastArrival)}
-		} else {
-			s.recvPktHistory = append(s.recvPktHistory, now.Sub(s.recvLastArrival))
-			if len(s.recvPktHistory) > 16 {
-				s.recvPktHistory = s.recvPktHistory[len(s.recvPktHistory)-16:]
-			}
-		}
-	}
-	s.recvLastArrival = now
+	s.recvArrivals.arrived(now)
 
 	/* If the sequence number of the current data packet is greater
 	than LRSN + 1, put all the sequence numbers between (but
 	excluding) these two values into the receiver's loss list and
 	send them to the sender in an NAK packet. */
-	seqDiff := seq.BlindDiff(s.farNextPktSeq)
+	seqDiff := seq.Diff(s.farNextPktSeq)
 	if seqDiff > 0 {
 		newLoss := make(receiveLossHeap, 0, seqDiff)
 		for idx := s.farNextPktSeq; idx != seq; idx.Incr() {
-			newLoss = append(newLoss, recvLossEntry{packetID: seq})
+			newLoss = append(newLoss, recvLossEntry{packetID: idx, lastFeedback: now, numNAK: 1})
 		}
 
 		if s.recvLossList == nil {
-			s.recvLossList = newLoss
+			s.recvLossList = make(receiveLossHeap, len(newLoss))
+			copy(s.recvLossList, newLoss)
 			heap.Init(&s.recvLossList)
 		} else {
-			for idx := s.farNextPktSeq; idx != seq; idx.Incr() {
-				heap.Push(&s.recvLossList, recvLossEntry{packetID: seq})
+			for _, entry := range newLoss {
+				heap.Push(&s.recvLossList, entry)
 			}
-			heap.Init(&newLoss)
 		}
 
+		s.pktRcvLoss.add(uint64(len(newLoss)))
+		s.farNextPktSeq = seq.Add(1)
 		s.sendNAK(newLoss)
+	} else if seqDiff == 0 {
 		s.farNextPktSeq = seq.Add(1)
-
-	} else if seqDiff < 0 {
+		if s.recvLossList == nil {
+			s.farRecdPktSeq = seq
+		}
+	} else {
 		// If the sequence number is less than LRSN, remove it from the receiver's loss list.
 		if !s.recvLossList.Remove(seq) {
+			s.releaseData(p)
 			return // already previously received packet -- ignore
 		}
 
@@ -256,65 +341,100 @@ func (s *udtSocketRecv) ingestData(p *packet.DataPacket, now time.Time) {
 			s.farRecdPktSeq = s.farNextPktSeq.Add(-1)
 			s.recvLossList = nil
 		} else {
-			s.farRecdPktSeq, _ = s.recvLossList.Min(s.farRecdPktSeq, s.farNextPktSeq)
+			minLoss, _ := s.recvLossList.Min(s.farRecdPktSeq, s.farNextPktSeq)
+			s.farRecdPktSeq = minLoss.Add(-1)
 		}
 	}
 
-	s.attemptProcessPacket(p, true)
+	if s.fec != nil {
+		s.fec.add(p)
+	}
+
+	if s.decompressor != nil {
+		data, err := s.decompressor.decompress(p.Data, int(s.socket.m.mtu)) // our packet size may have since been lowered
+		if err != nil {
+			s.shutdownEvent.signal(shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
+				err: fmt.Errorf("FAULT: Unable to decompress packet %d: %s", seq.Seq, err.Error())})
+			return
+		}
+		plain := *p // FEC needs the packet as it was sent, so don't change it in place
+		plain.Data = data
+		p = &plain
+	}
+
+	if s.socket.isDatagram && !s.trackFragment(p, now) {
+		// this fragment belongs to a message we've given up on, but it (or giving up on its message) may have filled a
+		// hole that other messages were being held behind
+		s.releaseData(p)
+		s.deliverPending()
+		return
+	}
+
+	if s.attemptProcessPacket(p, true) && seqDiff < 0 {
+		// this packet filled a hole, which may allow us to deliver messages we've been holding
+		s.deliverPending()
+	}
+}
+
+// ingestFEC is called to process an FEC parity packet, rebuilding a lost data packet if we can
+func (s *udtSocketRecv) ingestFEC(p *packet.UserDefControlPacket, now time.Time) {
+	if s.fec == nil {
+		return
+	}
+	dp := s.fec.recover(p, func(seq packet.PacketID) bool {
+		if seq.Cmp(s.farNextPktSeq) >= 0 {
+			return true // we haven't seen this one yet
+		}
+		lossEntry, _ := s.recvLossList.Find(seq)
+		return lossEntry != nil
+	})
+	if dp != nil {
+		s.fecRecovered.add(1)
+		s.ingestData(dp, now)
+	}
 }
 
 func (s *udtSocketRecv) attemptProcessPacket(p *packet.DataPacket, isNew bool) bool {
 	seq := p.Seq
-
-	// can we process this packet?
 	boundary, mustOrder, msgID := p.GetMessageData()
-	if s.recvLossList != nil && mustOrder && s.farRecdPktSeq.Add(1) != seq {
-		// we're required to order these packets and we're missing prior packets, so push and return
-		if isNew {
-			if s.recvPktPend == nil {
-				s.recvPktPend = dataPacketHeap{p}
-				heap.Init(&s.recvPktPend)
-			} else {
-				heap.Push(&s.recvPktPend, p)
-			}
-		}
-		return false
-	}
 
 	// can we find the start of this message?
 	pieces := make([]*packet.DataPacket, 0)
 	cannotContinue := false
+	truncated := false
 	switch boundary {
 	case packet.MbLast, packet.MbMiddle:
 		// we need prior packets, let's make sure we have them
-		if s.recvPktPend != nil {
-			pieceSeq := seq.Add(-1)
-			for {
-				prevPiece, _ := s.recvPktPend.Find(pieceSeq)
-				if prevPiece == nil {
-					// we don't have the previous piece, is it missing?
-					if s.recvLossList != nil {
-						if lossEntry, _ := s.recvLossList.Find(pieceSeq); lossEntry != nil {
-							// it's missing, stop processing
-							cannotContinue = true
-						}
+		pieceSeq := seq.Add(-1)
+		for {
+			prevPiece, _ := s.recvPktPend.Find(pieceSeq)
+			if prevPiece == nil {
+				// we don't have the previous piece, is it missing?
+				if s.recvLossList != nil {
+					if lossEntry, _ := s.recvLossList.Find(pieceSeq); lossEntry != nil {
+						// it's missing, stop processing
+						cannotContinue = true
 					}
-					// in any case we can't continue with this
-					log.Printf("Message with id %d appears to be a broken fragment", msgID)
-					break
 				}
-				prevBoundary, _, prevMsg := prevPiece.GetMessageData()
-				if prevMsg != msgID {
-					// ...oops? previous piece isn't in the same message
+				if !cannotContinue {
+					// it's not coming back, deliver what we have
 					log.Printf("Message with id %d appears to be a broken fragment", msgID)
-					break
+					truncated = true
 				}
-				pieces = append([]*packet.DataPacket{prevPiece}, pieces...)
-				if prevBoundary == packet.MbFirst {
-					break
-				}
-				pieceSeq.Decr()
+				break
 			}
+			prevBoundary, _, prevMsg := prevPiece.GetMessageData()
+			if prevMsg != msgID {
+				// ...oops? previous piece isn't in the same message
+				log.Printf("Message with id %d appears to be a broken fragment", msgID)
+				truncated = true
+				break
+			}
+			pieces = append([]*packet.DataPacket{prevPiece}, pieces...)
+			if prevBoundary == packet.MbFirst {
+				break
+			}
+			pieceSeq.Decr()
 		}
 	}
 	if !cannotContinue {
@@ -323,178 +443,298 @@ func (s *udtSocketRecv) attemptProcessPacket(p *packet.DataPacket, isNew bool) b
 		switch boundary {
 		case packet.MbFirst, packet.MbMiddle:
 			// we need following packets, let's make sure we have them
-			if s.recvPktPend != nil {
-				pieceSeq := seq.Add(1)
-				for {
-					nextPiece, _ := s.recvPktPend.Find(pieceSeq)
-					if nextPiece == nil {
-						// we don't have the previous piece, is it missing?
-						if pieceSeq == s.farNextPktSeq {
-							// hasn't been received yet
+			pieceSeq := seq.Add(1)
+			for {
+				nextPiece, _ := s.recvPktPend.Find(pieceSeq)
+				if nextPiece == nil {
+					// we don't have the next piece, is it missing?
+					if pieceSeq == s.farNextPktSeq {
+						// hasn't been received yet
+						cannotContinue = true
+					} else if s.recvLossList != nil {
+						if lossEntry, _ := s.recvLossList.Find(pieceSeq); lossEntry != nil {
+							// it's missing, stop processing
 							cannotContinue = true
-						} else if s.recvLossList != nil {
-							if lossEntry, _ := s.recvLossList.Find(pieceSeq); lossEntry != nil {
-								// it's missing, stop processing
-								cannotContinue = true
-							}
-						} else {
-							log.Printf("Message with id %d appears to be a broken fragment", msgID)
 						}
-						// in any case we can't continue with this
-						break
 					}
-					nextBoundary, _, nextMsg := nextPiece.GetMessageData()
-					if nextMsg != msgID {
-						// ...oops? previous piece isn't in the same message
+					if !cannotContinue {
+						// it's not coming back, deliver what we have
 						log.Printf("Message with id %d appears to be a broken fragment", msgID)
-						break
-					}
-					pieces = append(pieces, nextPiece)
-					if nextBoundary == packet.MbLast {
-						break
+						truncated = true
 					}
+					break
 				}
+				nextBoundary, _, nextMsg := nextPiece.GetMessageData()
+				if nextMsg != msgID {
+					// ...oops? previous piece isn't in the same message
+					log.Printf("Message with id %d appears to be a broken fragment", msgID)
+					truncated = true
+					break
+				}
+				pieces = append(pieces, nextPiece)
+				if nextBoundary == packet.MbLast {
+					break
+				}
+				pieceSeq.Incr()
 			}
 		}
 	}
 
-	// we've received a data packet, do we need to send an ACK for it?
-	s.unackPktCount++
-	ackInterval := uint(s.ackInterval.get())
-	if (ackInterval > 0) && (ackInterval <= s.unackPktCount) {
-		// ACK timer expired or ACK interval is reached
-		s.ackEvent()
-	} else if ackSelfClockInterval*s.lightAckCount <= s.unackPktCount {
-		//send a "light" ACK
-		s.sendLightACK()
-		s.lightAckCount++
+	if isNew {
+		// we've received a data packet, do we need to send an ACK for it?
+		s.unackPktCount++
+		ackInterval := uint(s.ackInterval.get())
+		if (ackInterval > 0) && (ackInterval <= s.unackPktCount) {
+			// ACK timer expired or ACK interval is reached
+			s.ackEvent()
+		} else if ackSelfClockInterval*s.lightAckCount <= s.unackPktCount {
+			//send a "light" ACK
+			s.sendLightACK()
+			s.lightAckCount++
+		}
+	}
+
+	// if this message must be delivered in order, hold it until everything before it has arrived
+	if !cannotContinue && mustOrder && s.recvLossList != nil && pieces[0].Seq.Cmp(s.farRecdPktSeq.Add(1)) > 0 {
+		cannotContinue = true
 	}
 
 	if cannotContinue {
 		// we need to wait for more packets, store and return
 		if isNew {
-			if s.recvPktPend == nil {
-				s.recvPktPend = dataPacketHeap{p}
-				heap.Init(&s.recvPktPend)
-			} else {
-				heap.Push(&s.recvPktPend, p)
-			}
+			s.pushPending(p)
 		}
 		return false
 	}
 
 	// we have a message, pull it from the pending heap (if necessary), assemble it into a message, and return it
-	if s.recvPktPend != nil {
-		for _, piece := range pieces {
-			s.recvPktPend.Remove(piece.Seq)
+	for _, piece := range pieces {
+		if s.recvPktPend == nil {
+			break
 		}
-		if len(s.recvPktPend) == 0 {
-			s.recvPktPend = nil
+		if _, idx := s.recvPktPend.Find(piece.Seq); idx >= 0 {
+			s.removePending(idx)
 		}
 	}
+	if boundary != packet.MbOnly {
+		delete(s.partialMsgs, msgID)
+	}
 
-	msg := make([]byte, 0)
+	msgLen := 0
+	for _, piece := range pieces {
+		msgLen += len(piece.Data)
+	}
+	msg := make([]byte, 0, msgLen)
 	for _, piece := range pieces {
 		msg = append(msg, piece.Data...)
 	}
-	s.messageIn <- msg
+	sendTime := time.Duration(pieces[0].SendTime()) * time.Microsecond
+	for _, piece := range pieces {
+		s.releaseData(piece)
+	}
+	s.socket.byteRecv.add(uint64(len(msg)))
+	if s.socket.overQuota(0) {
+		s.socket.signalQuota()
+	}
+	s.messageIn <- recvMessage{
+		content:   msg,
+		msgID:     msgID,
+		inOrder:   mustOrder,
+		sendTime:  sendTime,
+		truncated: truncated,
+	}
 	return true
 }
 
-func (s *udtSocketRecv) sendLightACK() {
-	var ack packet.PacketID
-
-	// If there is no loss, the ACK is the current largest sequence number plus 1;
-	// Otherwise it is the smallest sequence number in the receiver loss list.
-	if s.recvLossList == nil {
-		ack = s.farNextPktSeq
+// pushPending holds onto a packet until we are able to deliver it
+func (s *udtSocketRecv) pushPending(p *packet.DataPacket) {
+	if s.recvPktPend == nil {
+		s.recvPktPend = dataPacketHeap{p}
+		heap.Init(&s.recvPktPend)
 	} else {
-		ack = s.farRecdPktSeq.Add(1)
+		heap.Push(&s.recvPktPend, p)
 	}
+	s.recvPendBytes.add(uint64(len(p.Data)))
+}
 
-	if ack != s.recvAck2 {
-		// send out a lite ACK
-		// to save time on buffer processing and bandwidth/AS measurement, a lite ACK only feeds back an ACK number
-		s.sendPacket <- &packet.LightAckPacket{PktSeqHi: ack}
+// removePending removes (and returns) the held packet at the specified heap index
+func (s *udtSocketRecv) removePending(idx int) *packet.DataPacket {
+	p := heap.Remove(&s.recvPktPend, idx).(*packet.DataPacket)
+	s.recvPendBytes.add(-uint64(len(p.Data)))
+	if len(s.recvPktPend) == 0 {
+		s.recvPktPend = nil
 	}
+	return p
 }
 
-func (s *udtSocketRecv) getRcvSpeeds() (recvSpeed, bandwidth int) {
+// releaseData returns a data packet we no longer need to the packet pool.  Packets are owned by the receiver
+// from the moment readPacket hands them over; if FEC or compression is in use they may still be referenced by
+// the FEC decoder (or share their payload with a packet that is), so in that case they are left to the garbage
+// collector instead.
+func (s *udtSocketRecv) releaseData(p *packet.DataPacket) {
+	if s.fec == nil && s.decompressor == nil {
+		p.Release()
+	}
+}
 
-	// get median value, but cannot change the original value order in the window
-	if s.recvPktHistory != nil {
-		ourPktHistory := make(sortableDurnArray, len(s.recvPktHistory))
-		copy(ourPktHistory, s.recvPktHistory)
-		n := len(ourPktHistory)
+// trackFragment keeps track of how much of a multi-packet datagram message we've received, dropping the message if
+// it becomes larger than we're willing to reassemble.  Returns false if this fragment should be discarded
+func (s *udtSocketRecv) trackFragment(p *packet.DataPacket, now time.Time) bool {
+	boundary, _, msgID := p.GetMessageData()
+	if boundary == packet.MbOnly {
+		return true
+	}
+	if _, dropped := s.droppedMsgs[msgID]; dropped {
+		return false
+	}
+
+	pm, ok := s.partialMsgs[msgID]
+	if !ok {
+		if s.partialMsgs == nil {
+			s.partialMsgs = make(map[uint32]*partialMessage)
+		}
+		pm = &partialMessage{firstSeen: now}
+		s.partialMsgs[msgID] = pm
+	}
+	pm.size += uint(len(p.Data))
 
-		cutPos := n / 2
-		FloydRivest.Buckets(ourPktHistory, cutPos)
-		median := ourPktHistory[cutPos]
+	if maxSize := s.socket.Config.MaxMessageSize; maxSize > 0 && pm.size > maxSize {
+		log.Printf("Message with id %d exceeds the maximum message size of %d, dropping", msgID, maxSize)
+		s.dropPartialMessage(msgID, now)
+		return false
+	}
+	return true
+}
 
-		upper := median << 3  // upper bounds
-		lower := median >> 3  // lower bounds
-		count := 0            // number of entries inside bounds
-		var sum time.Duration // sum of values inside bounds
+// dropPartialMessage discards everything we've received of a message we're reassembling, and ignores any
+// fragments of it that arrive later.  The fragments we're missing are removed from the loss list, so that our peer
+// stops retransmitting them: those between the first and last we have, and those either side of them that must
+// belong to the message (as what we have doesn't start or end it)
+func (s *udtSocketRecv) dropPartialMessage(msgID uint32, now time.Time) {
+	delete(s.partialMsgs, msgID)
+	if s.droppedMsgs == nil {
+		s.droppedMsgs = make(map[uint32]time.Time)
+	}
+	s.droppedMsgs[msgID] = now
 
-		// median filtering
-		idx := 0
-		for i := 0; i < n; i++ {
-			if (ourPktHistory[idx] < upper) && (ourPktHistory[idx] > lower) {
-				count++
-				sum += ourPktHistory[idx]
+	if s.recvPktPend == nil {
+		return
+	}
+	var first, last packet.PacketID
+	found := false
+	kept := s.recvPktPend[:0]
+	for _, p := range s.recvPktPend {
+		if boundary, _, pktMsgID := p.GetMessageData(); pktMsgID == msgID {
+			seq := p.Seq
+			if boundary != packet.MbFirst {
+				seq.Decr()
 			}
-			idx++
+			if !found || seq.Cmp(first) < 0 {
+				first = seq
+			}
+			seq = p.Seq
+			if boundary != packet.MbLast {
+				seq.Incr()
+			}
+			if !found || seq.Cmp(last) > 0 {
+				last = seq
+			}
+			found = true
+			s.recvPendBytes.add(-uint64(len(p.Data)))
+			s.releaseData(p)
+		} else {
+			kept = append(kept, p)
 		}
+	}
+	s.recvPktPend = kept
+	if len(s.recvPktPend) == 0 {
+		s.recvPktPend = nil
+	} else {
+		heap.Init(&s.recvPktPend)
+	}
+	if found {
+		s.forgetLoss(first, last)
+	}
+}
 
-		// do we have enough valid values to return a value?
-		// calculate speed
-		if count > (n >> 1) {
-			recvSpeed = int(time.Second * time.Duration(count) / sum)
+// expireReassembly drops any messages that have taken too long to reassemble
+func (s *udtSocketRecv) expireReassembly(now time.Time) {
+	if s.partialMsgs == nil && s.droppedMsgs == nil {
+		return
+	}
+	timeout := s.socket.Config.ReassemblyTimeout
+	if timeout <= 0 {
+		timeout = DefaultConfig().ReassemblyTimeout
+	}
+	dropped := false
+	for msgID, pm := range s.partialMsgs {
+		if now.Sub(pm.firstSeen) > timeout {
+			log.Printf("Message with id %d could not be reassembled in time, dropping", msgID)
+			s.dropPartialMessage(msgID, now)
+			dropped = true
 		}
 	}
-
-	// get median value, but cannot change the original value order in the window
-	if s.recvPktPairHistory == nil {
-		ourProbeHistory := make(sortableDurnArray, len(s.recvPktPairHistory))
-		copy(ourProbeHistory, s.recvPktPairHistory)
-		n := len(ourProbeHistory)
-
-		cutPos := n / 2
-		FloydRivest.Buckets(ourProbeHistory, cutPos)
-		median := ourProbeHistory[cutPos]
-
-		upper := median << 3 // upper bounds
-		lower := median >> 3 // lower bounds
-		count := 1           // number of entries inside bounds
-		sum := median        // sum of values inside bounds
-
-		// median filtering
-		idx := 0
-		for i := 0; i < n; i++ {
-			if (ourProbeHistory[idx] < upper) && (ourProbeHistory[idx] > lower) {
-				count++
-				sum += ourProbeHistory[idx]
-			}
-			idx++
+	for msgID, when := range s.droppedMsgs {
+		if now.Sub(when) > timeout {
+			delete(s.droppedMsgs, msgID)
 		}
+	}
+	if dropped {
+		// messages held behind those we dropped may now be deliverable, and our peer needs to hear what we gave up on
+		s.deliverPending()
+		s.armTimers()
+	}
+}
 
-		bandwidth = int(time.Second * time.Duration(count) / sum)
+// deliverPending attempts to deliver any messages we've been holding, which may have been unblocked by a
+// newly-arrived (or dropped) packet
+func (s *udtSocketRecv) deliverPending() {
+	if s.recvPktPend == nil {
+		return
 	}
+	pending := make(dataPacketHeap, len(s.recvPktPend))
+	copy(pending, s.recvPktPend)
+	sort.Sort(pending)
 
-	return
+	// delivering a message releases its packets, so work from sequence numbers rather than the packets themselves
+	seqs := make([]packet.PacketID, len(pending))
+	for idx, p := range pending {
+		seqs[idx] = p.Seq
+	}
+	for _, seq := range seqs {
+		if s.recvPktPend == nil {
+			return
+		}
+		p, _ := s.recvPktPend.Find(seq)
+		if p == nil {
+			continue
+		}
+		if boundary, _, _ := p.GetMessageData(); boundary == packet.MbFirst || boundary == packet.MbOnly {
+			s.attemptProcessPacket(p, false)
+		}
+	}
 }
 
-func (s *udtSocketRecv) sendACK() {
-	var ack packet.PacketID
-
+// ackSeq returns the sequence number to acknowledge
+func (s *udtSocketRecv) ackSeq() packet.PacketID {
 	// If there is no loss, the ACK is the current largest sequence number plus 1;
 	// Otherwise it is the smallest sequence number in the receiver loss list.
 	if s.recvLossList == nil {
-		ack = s.farNextPktSeq
-	} else {
-		ack = s.farRecdPktSeq.Add(1)
+		return s.farNextPktSeq
 	}
+	return s.farRecdPktSeq.Add(1)
+}
 
+func (s *udtSocketRecv) sendLightACK() {
+	if ack := s.ackSeq(); ack != s.recvAck2 {
+		// send out a lite ACK
+		// to save time on buffer processing and bandwidth/AS measurement, a lite ACK only feeds back an ACK number
+		s.sendFeedback <- &packet.LightAckPacket{PktSeqHi: ack}
+	}
+}
+
+func (s *udtSocketRecv) sendACK() {
+	ack := s.ackSeq()
 	if ack == s.recvAck2 {
 		return
 	}
@@ -506,22 +746,12 @@ func (s *udtSocketRecv) sendACK() {
 	s.sentAck = ack
 
 	s.lastACK++
-	ackHist := &ackHistoryEntry{
-		ackID:      s.lastACK,
-		lastPacket: ack,
-		sendTime:   time.Now(),
-	}
-	if s.ackHistory == nil {
-		s.ackHistory = ackHistoryHeap{ackHist}
-		heap.Init(&s.ackHistory)
-	} else {
-		heap.Push(&s.ackHistory, ackHist)
-	}
+	s.ackHistory.store(s.lastACK, ack, s.socket.clock.Now())
 
 	rtt, rttVar := s.socket.getRTT()
 
-	numPendPackets := int(s.farNextPktSeq.BlindDiff(s.farRecdPktSeq) - 1)
-	availWindow := int(s.socket.maxFlowWinSize) - numPendPackets
+	numPendPackets := int(s.farNextPktSeq.Diff(s.farRecdPktSeq) - 1)
+	availWindow := int(s.socket.recvWindow.get()) - numPendPackets
 	if availWindow < 2 {
 		availWindow = 2
 	}
@@ -534,22 +764,26 @@ func (s *udtSocketRecv) sendACK() {
 		BuffAvail: uint32(availWindow),
 	}
 	if s.ackSentEvent2 == nil {
-		recvSpeed, bandwidth := s.getRcvSpeeds()
+		recvSpeed, bandwidth := s.recvArrivals.rate(), s.recvPktPairs.bandwidth()
+		s.recvRate.set(uint32(recvSpeed))
+		s.recvBandwidth.set(uint32(bandwidth))
+		s.autoTuneWindow(recvSpeed)
 		p.IncludeLink = true
 		p.PktRecvRate = uint32(recvSpeed)
 		p.EstLinkCap = uint32(bandwidth)
-		s.ackSentEvent2 = time.After(synTime)
+		s.ackSentEvent2 = s.after(synTime)
 	}
-	s.sendPacket <- p
-	s.ackSentEvent = time.After(time.Duration(rtt+4*rttVar) * time.Microsecond)
+	s.sendFeedback <- p
+	s.ackSentEvent = s.after(time.Duration(rtt+4*rttVar) * time.Microsecond)
 }
 
 func (s *udtSocketRecv) sendNAK(rl receiveLossHeap) {
 	lossInfo := make([]uint32, 0)
 
 	curPkt := s.farRecdPktSeq
+	lastSeq := s.farNextPktSeq.Add(-1)
 	for curPkt != s.farNextPktSeq {
-		minPkt, idx := rl.Min(curPkt, s.farRecdPktSeq)
+		minPkt, idx := rl.Min(curPkt, lastSeq)
 		if idx < 0 {
 			break
 		}
@@ -569,9 +803,12 @@ func (s *udtSocketRecv) sendNAK(rl receiveLossHeap) {
 		} else {
 			lossInfo = append(lossInfo, minPkt.Seq|0x80000000, lastPkt.Seq&0x7FFFFFFF)
 		}
+		curPkt = lastPkt.Add(1)
 	}
 
-	s.sendPacket <- &packet.NakPacket{CmpLossInfo: lossInfo}
+	if len(lossInfo) > 0 {
+		s.sendFeedback <- &packet.NakPacket{CmpLossInfo: lossInfo}
+	}
 }
 
 // ingestData is called to process an (undocumented) OOB error packet
@@ -582,12 +819,176 @@ func (s *udtSocketRecv) ingestError(p *packet.ErrPacket) {
 // assuming some condition has occured (ACK timer expired, ACK interval), send an ACK and reset the appropriate timer
 func (s *udtSocketRecv) ackEvent() {
 	s.sendACK()
-	ackTime := synTime
-	ackPeriod := s.ackPeriod.get()
-	if ackPeriod > 0 {
-		ackTime = ackPeriod
+	s.ackTimerEvent = nil
+	if s.needACK() {
+		s.ackTimerEvent = s.after(s.ackTimerPeriod())
 	}
-	s.ackTimerEvent = time.After(ackTime)
 	s.unackPktCount = 0
 	s.lightAckCount = 1
 }
+
+// needACK returns true if we've received anything our peer hasn't confirmed it's seen our acknowledgement of, and so
+// still needs the ACK timer
+func (s *udtSocketRecv) needACK() bool {
+	return s.ackSeq() != s.recvAck2
+}
+
+// needNAK returns true if we have loss reports that may need to be resent or messages being reassembled, and so still
+// need the NAK timer
+func (s *udtSocketRecv) needNAK() bool {
+	return s.recvLossList != nil || len(s.partialMsgs) > 0 || len(s.droppedMsgs) > 0
+}
+
+// armTimers restarts the ACK and NAK timers if they were stopped for lack of anything to do, but now have work again.
+// Stopping them while idle means a quiet connection only has its EXP timer waiting
+func (s *udtSocketRecv) armTimers() {
+	if s.ackTimerEvent == nil && s.needACK() {
+		s.ackTimerEvent = s.after(s.ackTimerPeriod())
+	}
+	if s.nakTimerEvent == nil && s.needNAK() {
+		s.nakTimerEvent = s.after(s.nakTimerPeriod())
+	}
+}
+
+// ackTimerPeriod returns the time between periodic ACKs
+func (s *udtSocketRecv) ackTimerPeriod() time.Duration {
+	ackTime := s.socket.ackPeriod.get()
+	if ackTime <= 0 {
+		ackTime = synTime
+	}
+	ccPeriod := s.ackPeriod.get()
+	if ccPeriod > 0 && ccPeriod < ackTime {
+		ackTime = ccPeriod
+	}
+	return ackTime
+}
+
+// nakTimerPeriod returns the time between checks for loss reports that need to be resent
+func (s *udtSocketRecv) nakTimerPeriod() time.Duration {
+	if nakPeriod := s.socket.nakPeriod.get(); nakPeriod > 0 {
+		return nakPeriod
+	}
+	rtt, rttVar := s.socket.getRTT()
+	return time.Duration(4*rtt+rttVar)*time.Microsecond + synTime
+}
+
+// nakInterval returns how long to wait for a lost packet to arrive after reporting it before reporting it again.  This
+// is the roundtrip time (allowing for its variance), but no less than the time our peer would take to resend
+// everything in our loss list at the rate packets are arriving, so that a path losing many packets isn't flooded with
+// reports of losses that are already being resent
+func (s *udtSocketRecv) nakInterval() time.Duration {
+	rtt, rttVar := s.socket.getRTT()
+	interval := time.Duration(rtt+4*rttVar) * time.Microsecond
+	if interval < synTime {
+		interval = synTime
+	}
+	if recvRate := s.recvRate.get(); recvRate > 0 {
+		resendTime := time.Duration(len(s.recvLossList)) * time.Second / time.Duration(recvRate)
+		if resendTime > interval {
+			interval = resendTime
+		}
+	}
+	return interval
+}
+
+// nakEvent is called when the NAK timer fires, resending any loss reports that haven't been answered in a
+// reasonable time.  Each loss is resent after k * nakInterval, where k starts at 2 and increases with each report;
+// anything reported more recently than that is held back.
+func (s *udtSocketRecv) nakEvent(now time.Time) {
+	s.expireReassembly(now)
+	s.nakTimerEvent = nil
+	if s.needNAK() {
+		s.nakTimerEvent = s.after(s.nakTimerPeriod())
+	}
+	if s.recvLossList == nil {
+		return
+	}
+
+	interval := s.nakInterval()
+	var reLoss receiveLossHeap
+	var suppressed uint64
+	for idx := range s.recvLossList {
+		entry := &s.recvLossList[idx]
+		if now.Sub(entry.lastFeedback) > time.Duration(entry.numNAK+1)*interval {
+			entry.lastFeedback = now
+			entry.numNAK++
+			reLoss = append(reLoss, *entry)
+		} else {
+			suppressed++
+		}
+	}
+	s.nakSuppressed.add(suppressed)
+	if reLoss != nil {
+		heap.Init(&reLoss)
+		s.sendNAK(reLoss)
+	}
+}
+
+// expTimerPeriod returns the time to wait without hearing from our peer before triggering an EXP event.
+// The period doubles with each consecutive EXP event, up to the configured maximum.
+func (s *udtSocketRecv) expTimerPeriod() time.Duration {
+	config := s.socket.Config
+	var nextExpDurn time.Duration
+	if rtoPeriod := s.rtoPeriod.get(); rtoPeriod > 0 {
+		nextExpDurn = rtoPeriod
+	} else {
+		rtt, rttVar := s.socket.getRTT()
+		nextExpDurn = time.Duration(rtt+4*rttVar)*time.Microsecond + synTime
+		minExpTime := config.MinEXPPeriod
+		if minExpTime <= 0 {
+			minExpTime = DefaultConfig().MinEXPPeriod
+		}
+		if nextExpDurn < minExpTime {
+			nextExpDurn = minExpTime
+		}
+	}
+
+	maxExpTime := config.MaxEXPPeriod
+	if maxExpTime <= 0 {
+		maxExpTime = DefaultConfig().MaxEXPPeriod
+	}
+	for idx := uint(1); idx < s.expCount && nextExpDurn < maxExpTime; idx++ {
+		nextExpDurn *= 2
+	}
+	if nextExpDurn > maxExpTime {
+		nextExpDurn = maxExpTime
+	}
+	return nextExpDurn
+}
+
+// expEvent is called when the EXP timer fires.  If we have heard from our peer since the timer was set we just
+// reschedule it, otherwise the sender is notified (to retransmit or send a keep-alive) and the timer backs off.
+// If we haven't heard anything for long enough, the connection is considered broken
+func (s *udtSocketRecv) expEvent(now time.Time) {
+	silence := now.Sub(s.lastRecvTime)
+	if expPeriod := s.expTimerPeriod(); silence < expPeriod {
+		s.expTimerEvent = s.after(expPeriod - silence)
+		return
+	}
+
+	// Haven't receive any information from the peer, is it dead?!
+	config := s.socket.Config
+	expCountLimit := config.EXPCountLimit
+	if expCountLimit == 0 {
+		expCountLimit = DefaultConfig().EXPCountLimit
+	}
+	expTimeout := config.EXPTimeout
+	if expTimeout <= 0 {
+		expTimeout = DefaultConfig().EXPTimeout
+	}
+	if s.expCount > expCountLimit && silence > expTimeout {
+		// Connection is broken.
+		s.expTimerEvent = nil
+		s.shutdownEvent.signal(shutdownMessage{sockState: sockStateTimeout, permitLinger: true})
+		return
+	}
+
+	select {
+	case s.expTimeout <- now:
+	default:
+		// sender hasn't processed the last EXP event yet
+	}
+
+	s.expCount++
+	s.expTimerEvent = s.after(s.expTimerPeriod())
+}
@@ -0,0 +1,367 @@
+package udt
+
+import (
+	"container/heap"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// newDataReceiver creates the receiving side of a datagram socket that isn't connected to anything, as though its
+// handshake has just completed with the peer starting at initSeq.  The packets it sends are placed on the returned
+// channel
+func newDataReceiver(config *Config, initSeq uint32) (*udtSocketRecv, chan packet.Packet) {
+	sendFeedback := make(chan packet.Packet, 16)
+	s := &udtSocket{Config: config, clock: newManualClock(), rtt: newRTTEstimator(), drift: newDriftTracer(), m: &multiplexer{},
+		isDatagram: true, messageIn: make(chan recvMessage, 16), sendFeedback: sendFeedback, shutdownEvent: newShutdownLatch()}
+	s.cong = &udtSocketCc{socket: s, msgs: make(chan congMsg, 256)}
+	sr := newUdtSocketRecv(s)
+	sr.configureHandshake(&packet.HandshakePacket{InitPktSeq: packet.PacketID{Seq: initSeq}})
+	return sr, sendFeedback
+}
+
+// nextSent returns the next packet of the specified type waiting to be sent (discarding any others before it), or
+// nil if there isn't one
+func nextSent(sent chan packet.Packet, pktType packet.PacketType) packet.Packet {
+	for len(sent) > 0 {
+		if p := <-sent; p.PacketType() == pktType {
+			return p
+		}
+	}
+	return nil
+}
+
+// testMessage returns a packet carrying (part of) a datagram message
+func testMessage(seq uint32, boundary packet.MessageBoundary, inOrder bool, msgID uint32, data string) *packet.DataPacket {
+	dp := &packet.DataPacket{Seq: packet.PacketID{Seq: seq}, Data: []byte(data)}
+	dp.SetMessageData(boundary, inOrder, msgID)
+	return dp
+}
+
+// expectTimer checks that a timer fires after exactly d on the manual clock, returning the time it fired
+func expectTimer(t *testing.T, clock *manualClock, timer <-chan time.Time, d time.Duration) time.Time {
+	t.Helper()
+	clock.advance(d - time.Millisecond)
+	select {
+	case <-timer:
+		t.Fatalf("timer fired before %s", d)
+	default:
+	}
+	clock.advance(time.Millisecond)
+	select {
+	case now := <-timer:
+		return now
+	default:
+		t.Fatalf("timer didn't fire after %s", d)
+	}
+	return time.Time{}
+}
+
+func TestEXPTimerPeriod(t *testing.T) {
+	// the initial 100ms roundtrip time +4*50ms variance +10ms gives a 310ms period
+	tests := []struct {
+		name     string
+		minEXP   time.Duration
+		rto      time.Duration
+		expCount uint
+		expect   time.Duration
+	}{
+		{"first", 0, 0, 1, 310 * time.Millisecond},
+		{"second", 0, 0, 2, 620 * time.Millisecond},
+		{"sixth", 0, 0, 6, 9920 * time.Millisecond},
+		{"capped", 0, 0, 7, 10 * time.Second},
+		{"far beyond the cap", 0, 0, 40, 10 * time.Second},
+		{"minimum", time.Second, 0, 1, time.Second},
+		{"minimum backed off", time.Second, 0, 3, 4 * time.Second},
+		{"set by congestion control", time.Second, 50 * time.Millisecond, 1, 50 * time.Millisecond},
+		{"set by congestion control backed off", 0, 50 * time.Millisecond, 4, 400 * time.Millisecond},
+	}
+	for _, test := range tests {
+		config := DefaultConfig()
+		config.MinEXPPeriod = test.minEXP
+		sr, _ := newTestReceiver(config)
+		sr.rtoPeriod.set(test.rto)
+		sr.expCount = test.expCount
+		if period := sr.expTimerPeriod(); period != test.expect {
+			t.Errorf("%s: expected an EXP period of %s, got %s", test.name, test.expect, period)
+		}
+	}
+}
+
+func TestEXPBackoff(t *testing.T) {
+	sr, _ := newTestReceiver(DefaultConfig())
+	clock := sr.socket.clock.(*manualClock)
+	expTimeout := make(chan time.Time, 1)
+	sr.expTimeout = expTimeout
+	sr.shutdownEvent = newShutdownLatch()
+	sr.expCount = 1
+	sr.lastRecvTime = clock.Now()
+	sr.expTimerEvent = sr.after(sr.expTimerPeriod())
+
+	// hearing from the peer pushes the timer back by however long ago that was
+	now := expectTimer(t, clock, sr.expTimerEvent, 310*time.Millisecond)
+	sr.lastRecvTime = now.Add(-10 * time.Millisecond)
+	sr.expEvent(now)
+	if len(expTimeout) != 0 || sr.expCount != 1 {
+		t.Fatal("expected no EXP event after hearing from the peer")
+	}
+	now = expectTimer(t, clock, sr.expTimerEvent, 300*time.Millisecond)
+
+	// after which each period of silence tells the sender, and doubles the wait for the next
+	for _, wait := range []time.Duration{620 * time.Millisecond, 1240 * time.Millisecond, 2480 * time.Millisecond,
+		4960 * time.Millisecond, 9920 * time.Millisecond, 10 * time.Second, 10 * time.Second} {
+		count := sr.expCount
+		sr.expEvent(now)
+		if len(expTimeout) != 1 || sr.expCount != count+1 {
+			t.Fatalf("expected an EXP event after %d periods of silence", count)
+		}
+		<-expTimeout
+		now = expectTimer(t, clock, sr.expTimerEvent, wait)
+	}
+	if sr.shutdownEvent.latched.get() != 0 {
+		t.Error("connection shut down too soon")
+	}
+}
+
+func TestEXPExpiry(t *testing.T) {
+	// the peer is only considered lost after both 16 EXP events and 3 minutes of silence
+	tests := []struct {
+		expCount uint
+		silence  time.Duration
+		expired  bool
+	}{
+		{16, 4 * time.Minute, false},
+		{17, 2 * time.Minute, false},
+		{17, 3 * time.Minute, false},
+		{17, 3*time.Minute + time.Millisecond, true},
+		{40, time.Hour, true},
+	}
+	for _, test := range tests {
+		sr, _ := newTestReceiver(DefaultConfig())
+		sr.expTimeout = make(chan time.Time, 1)
+		sr.shutdownEvent = newShutdownLatch()
+		now := sr.socket.clock.Now()
+		sr.lastRecvTime = now.Add(-test.silence)
+		sr.expCount = test.expCount
+		sr.expEvent(now)
+
+		expired := sr.shutdownEvent.latched.get() != 0
+		if expired != test.expired {
+			t.Errorf("%d EXP events over %s: expected expired=%t, got %t", test.expCount, test.silence, test.expired,
+				expired)
+			continue
+		}
+		if expired {
+			if sr.shutdownEvent.msg.sockState != sockStateTimeout || sr.expTimerEvent != nil {
+				t.Errorf("%d EXP events over %s: expected a timeout with the EXP timer stopped", test.expCount,
+					test.silence)
+			}
+		} else if sr.expTimerEvent == nil {
+			t.Errorf("%d EXP events over %s: expected the EXP timer to be rearmed", test.expCount, test.silence)
+		}
+	}
+}
+
+func TestIdleTimers(t *testing.T) {
+	sr, sent := newDataReceiver(DefaultConfig(), 100)
+	clock := sr.socket.clock.(*manualClock)
+
+	// with nothing received the ACK and NAK timers stop the first time they fire, leaving only the EXP timer
+	sr.ackEvent()
+	sr.nakEvent(clock.Now())
+	if sr.ackTimerEvent != nil || sr.nakTimerEvent != nil || sr.expTimerEvent == nil {
+		t.Fatal("expected only the EXP timer to be armed on an idle connection")
+	}
+	if len(sent) != 0 {
+		t.Fatalf("expected nothing to be sent on an idle connection, got %v", <-sent)
+	}
+
+	// the next data restarts the ACK timer, which stops again once our peer has confirmed our ACK
+	sr.ingestData(testMessage(100, packet.MbOnly, false, 1, "hello"), clock.Now())
+	sr.armTimers()
+	if sr.ackTimerEvent == nil || sr.nakTimerEvent != nil {
+		t.Fatal("expected received data to arm only the ACK timer")
+	}
+	<-sr.socket.messageIn
+	expectTimer(t, clock, sr.ackTimerEvent, synTime)
+	sr.ackEvent()
+	ack, ok := (<-sent).(*packet.AckPacket)
+	if !ok || ack.PktSeqHi.Seq != 101 {
+		t.Fatalf("expected an ACK for packet 100, got %v", ack)
+	}
+	if sr.ackTimerEvent == nil {
+		t.Fatal("expected the ACK timer to stay armed until our ACK has been confirmed")
+	}
+	sr.ingestAck2(&packet.Ack2Packet{AckSeqNo: ack.AckSeqNo}, clock.Now())
+	expectTimer(t, clock, sr.ackTimerEvent, synTime)
+	sr.ackEvent()
+	if sr.ackTimerEvent != nil || len(sent) != 0 {
+		t.Fatal("expected the ACK timer to stop once our ACK has been confirmed")
+	}
+
+	// and a loss restarts the NAK timer, which stops again once the lost packet arrives
+	sr.ingestData(testMessage(102, packet.MbOnly, false, 3, "world"), clock.Now())
+	sr.armTimers()
+	nakPeriod := sr.nakTimerPeriod()
+	if sr.nakTimerEvent == nil {
+		t.Fatal("expected a loss to arm the NAK timer")
+	}
+	if _, ok := (<-sent).(*packet.NakPacket); !ok {
+		t.Fatal("expected the loss to be reported")
+	}
+	sr.ingestData(testMessage(101, packet.MbOnly, false, 2, "there"), clock.Now())
+	sr.nakEvent(expectTimer(t, clock, sr.nakTimerEvent, nakPeriod))
+	if sr.nakTimerEvent != nil {
+		t.Error("expected the NAK timer to stop once nothing is lost")
+	}
+}
+
+func TestInOrderDelivery(t *testing.T) {
+	// the messages sent, by offset from the first packet: 1, 3 and 4 must be delivered in order, 2 and 5 needn't be
+	sent := []struct {
+		boundary packet.MessageBoundary
+		inOrder  bool
+		msgID    uint32
+	}{
+		{packet.MbOnly, true, 1},
+		{packet.MbOnly, false, 2},
+		{packet.MbOnly, true, 3},
+		{packet.MbFirst, true, 4}, {packet.MbLast, true, 4},
+		{packet.MbFirst, false, 5}, {packet.MbLast, false, 5},
+	}
+	tests := []struct {
+		name    string
+		arrival []int32
+		expect  []uint32
+	}{
+		{"in sequence", []int32{0, 1, 2, 3, 4, 5, 6}, []uint32{1, 2, 3, 4, 5}},
+		{"in-order message behind a hole", []int32{1, 2, 0, 3, 4, 5, 6}, []uint32{2, 1, 3, 4, 5}},
+		{"out-of-order messages past a hole", []int32{6, 5, 0, 1, 2, 3, 4}, []uint32{5, 1, 2, 3, 4}},
+		{"everything reversed", []int32{6, 5, 4, 3, 2, 1, 0}, []uint32{5, 2, 1, 3, 4}},
+		{"interleaved", []int32{2, 6, 1, 5, 0, 4, 3}, []uint32{2, 5, 1, 3, 4}},
+	}
+	for _, base := range []uint32{1000, 0x7FFFFFFE} { // the second wraps back to zero partway through
+		for _, test := range tests {
+			sr, _ := newDataReceiver(DefaultConfig(), base)
+			var delivered []uint32
+			for _, off := range test.arrival {
+				msg := sent[off]
+				seq := packet.PacketID{Seq: base}.Add(off)
+				sr.ingestData(testMessage(seq.Seq, msg.boundary, msg.inOrder, msg.msgID, "x"), sr.socket.clock.Now())
+				for len(sr.socket.messageIn) > 0 {
+					delivered = append(delivered, (<-sr.socket.messageIn).msgID)
+				}
+			}
+			if len(delivered) != len(test.expect) {
+				t.Errorf("%s from %d: expected messages %v to be delivered, got %v", test.name, base, test.expect,
+					delivered)
+				continue
+			}
+			for idx := range delivered {
+				if delivered[idx] != test.expect[idx] {
+					t.Errorf("%s from %d: expected messages %v to be delivered, got %v", test.name, base, test.expect,
+						delivered)
+					break
+				}
+			}
+			if sr.recvLossList != nil || sr.recvPktPend != nil {
+				t.Errorf("%s from %d: expected nothing to be lost or held once everything arrived", test.name, base)
+			}
+		}
+	}
+}
+
+func TestReassemblyExpiry(t *testing.T) {
+	config := DefaultConfig()
+	config.ReassemblyTimeout = time.Second
+	sr, sent := newDataReceiver(config, 100)
+	clock := sr.socket.clock.(*manualClock)
+
+	// the middle of message 1 is lost, holding up message 3 (which must be delivered in order) but not message 2
+	for _, dp := range []*packet.DataPacket{
+		testMessage(100, packet.MbFirst, false, 1, "a"),
+		testMessage(102, packet.MbLast, false, 1, "c"),
+		testMessage(103, packet.MbOnly, false, 2, "d"),
+		testMessage(104, packet.MbOnly, true, 3, "e"),
+	} {
+		sr.ingestData(dp, clock.Now())
+	}
+	if msg := <-sr.socket.messageIn; msg.msgID != 2 || len(sr.socket.messageIn) != 0 {
+		t.Fatalf("expected only message 2 to be delivered, got message %d", msg.msgID)
+	}
+	if nak := nextSent(sent, packet.PtNak).(*packet.NakPacket); nak == nil || len(nak.CmpLossInfo) != 1 ||
+		nak.CmpLossInfo[0] != 101 {
+		t.Fatalf("expected packet 101 to be reported lost, got %v", nak)
+	}
+
+	// once we give up on message 1 we stop asking for it, message 3 is delivered, and our ACK moves past both
+	clock.advance(2 * time.Second)
+	sr.nakEvent(clock.Now())
+	if sr.recvLossList != nil || sr.recvPktPend != nil || len(sr.partialMsgs) != 0 {
+		t.Fatal("expected nothing to be lost or held once message 1 was dropped")
+	}
+	if msg := <-sr.socket.messageIn; msg.msgID != 3 {
+		t.Fatalf("expected message 3 to be delivered, got message %d", msg.msgID)
+	}
+	if nak := nextSent(sent, packet.PtNak); nak != nil {
+		t.Fatalf("expected the loss not to be reported again, got %v", nak)
+	}
+	if sr.ackTimerEvent == nil {
+		t.Fatal("expected the ACK timer to be armed")
+	}
+	sr.ackEvent()
+	if ack := nextSent(sent, packet.PtAck).(*packet.AckPacket); ack == nil || ack.PktSeqHi.Seq != 105 {
+		t.Fatalf("expected an ACK for everything up to packet 104, got %v", ack)
+	}
+
+	// and if the lost piece does turn up it's ignored
+	sr.ingestData(testMessage(101, packet.MbMiddle, false, 1, "b"), clock.Now())
+	if len(sr.socket.messageIn) != 0 || sr.recvPktPend != nil {
+		t.Error("expected a fragment of a dropped message to be ignored")
+	}
+}
+
+func TestReceiveGap(t *testing.T) {
+	base := uint32(0x7FFFFFFD)
+	sr, sent := newDataReceiver(DefaultConfig(), base)
+	recvSeq := func(off int32) {
+		seq := packet.PacketID{Seq: base}.Add(off)
+		sr.ingestData(testMessage(seq.Seq, packet.MbOnly, false, uint32(off)+1, "x"), sr.socket.clock.Now())
+	}
+	lost := func() []uint32 {
+		h := append(receiveLossHeap{}, sr.recvLossList...)
+		var seqs []uint32
+		for len(h) > 0 {
+			seqs = append(seqs, heap.Pop(&h).(recvLossEntry).packetID.Seq)
+		}
+		return seqs
+	}
+
+	// each packet skipped over (across the wrap) is reported lost, as a range
+	recvSeq(0)
+	recvSeq(4)
+	if got := lost(); fmt.Sprint(got) != fmt.Sprint([]uint32{0x7FFFFFFE, 0x7FFFFFFF, 0}) {
+		t.Fatalf("expected packets 0x7ffffffe to 0 to be lost, got %#x", got)
+	}
+	if nak := nextSent(sent, packet.PtNak).(*packet.NakPacket); nak == nil ||
+		fmt.Sprint(nak.CmpLossInfo) != fmt.Sprint([]uint32{0x7FFFFFFE | 0x80000000, 0}) {
+		t.Fatalf("expected packets 0x7ffffffe to 0 to be reported lost as a range, got %v", nak)
+	}
+
+	// what we can acknowledge stops just short of the earliest hole
+	recvSeq(1)
+	if got := lost(); fmt.Sprint(got) != fmt.Sprint([]uint32{0x7FFFFFFF, 0}) {
+		t.Fatalf("expected packets 0x7fffffff and 0 to still be lost, got %#x", got)
+	}
+	if sr.farRecdPktSeq.Seq != 0x7FFFFFFE {
+		t.Errorf("expected everything up to packet 0x7ffffffe to have been received, got %#x", sr.farRecdPktSeq.Seq)
+	}
+	recvSeq(3)
+	recvSeq(2)
+	if sr.recvLossList != nil || sr.farRecdPktSeq.Seq != 1 {
+		t.Errorf("expected everything up to packet 1 to have been received, got %#x with %#x lost",
+			sr.farRecdPktSeq.Seq, lost())
+	}
+}
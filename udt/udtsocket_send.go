@@ -11,64 +11,82 @@ import (
 type sendState int
 
 const (
-	sendStateIdle        sendState = iota // not waiting for anything, can send immediately
-	sendStateSending                      // recently sent something, waiting for SND before sending more
-	sendStateWaiting                      // destination is full, waiting for them to process something and come back
-	sendStateProcessDrop                  // immediately re-process any drop list requests
-	sendStateShutdown                     // connection is shutdown
-)
-
-const (
-	minEXPinterval time.Duration = 300 * time.Millisecond
+	sendStateIdle     sendState = iota // not waiting for anything, can send immediately
+	sendStateSending                   // recently sent something, waiting for SND before sending more
+	sendStateWaiting                   // destination is full, waiting for them to process something and come back
+	sendStateShutdown                  // connection is shutdown
 )
 
 type udtSocketSend struct {
+	// performance metrics
+	pktSent    atomicUint64 // number of sent data packets, including retransmissions
+	pktRetrans atomicUint64 // number of retransmitted packets
+	pktSndLoss atomicUint64 // number of lost packets reported by the peer
+	lossDepth  atomicUint32 // number of packets currently in the loss list
+	maxRexmits atomicUint32 // most times any packet has been retransmitted
+
+	// send queue depth (see sendqueue.go)
+	unacked     atomicUint64 // number of payload bytes in sendPktPend
+	unackedHigh atomicUint64 // most payload bytes that have been in sendPktPend at once
+
 	// channels
-	sockClosed    <-chan struct{}        // closed when socket is closed
-	sockShutdown  <-chan struct{}        // closed when socket is shutdown
-	sendEvent     <-chan recvPktEvent    // sender: ingest the specified packet. Sender is readPacket, receiver is goSendEvent
-	messageOut    <-chan sendMessage     // outbound messages. Sender is client caller (Write), Receiver is goSendEvent. Closed when socket is closed
-	sendPacket    chan<- packet.Packet   // send a packet out on the wire
-	shutdownEvent chan<- shutdownMessage // channel signals the connection to be shutdown
+	sockClosed    <-chan struct{}      // closed when socket is closed
+	sockShutdown  <-chan struct{}      // closed when socket is shutdown
+	sendEvent     <-chan recvPktEvent  // sender: ingest the specified packet. Sender is readPacket, receiver is goSendEvent
+	expTimeout    <-chan time.Time     // sender: EXP timer has fired. Sender is goReceiveEvent, receiver is goSendEvent
+	messageOut    <-chan sendMessage   // outbound messages. Sender is client caller (Write), Receiver is goSendEvent. Closed when socket is closed
+	debugEvent    <-chan debugRequest  // fill in a DebugInfo. Sender is client caller (Debug), receiver is goSendEvent
+	mtuEvent      <-chan struct{}      // our packet size has been lowered. Sender is goWrite, receiver is goSendEvent
+	sendPacket    chan<- packet.Packet // send a packet out on the wire
+	sendFeedback  chan<- packet.Packet // send an ACK2 or keep-alive out on the wire
+	shutdownEvent *shutdownLatch       // signals the connection to be shutdown
 	socket        *udtSocket
 
-	sendState      sendState       // current sender state
-	sendPktPend    sendPacketHeap  // list of packets that have been sent but not yet acknoledged
-	sendPktSeq     packet.PacketID // the current packet sequence number
-	msgPartialSend *sendMessage    // when a message can only partially fit in a socket, this is the remainder
-	msgSeq         uint32          // the current message sequence number
-	expCount       uint            // number of continuous EXP timeouts.
-	lastRecvTime   time.Time       // the last time we've heard something from the remote system
-	recvAckSeq     packet.PacketID // largest packetID we've received an ACK from
-	sentAck2       uint32          // largest ACK2 packet we've sent
-	sendLossList   packetIDHeap    // loss list
-	sndPeriod      atomicDuration  // (set by congestion control) delay between sending packets
-	rtoPeriod      atomicDuration  // (set by congestion control) override of EXP timer calculations
-	congestWindow  atomicUint32    // (set by congestion control) size of the current congestion window (in packets)
-	flowWindowSize uint            // negotiated maximum number of unacknowledged packets (in packets)
+	sendState      sendState          // current sender state
+	sendPktPend    sendPacketHeap     // list of packets that have been sent but not yet acknoledged
+	sendPktSeq     packet.PacketID    // the current packet sequence number
+	msgPartialSend *sendMessage       // when a message can only partially fit in a socket, this is the remainder
+	corked         bool               // msgPartialSend is a partly filled stream packet being held for more data (see cork.go)
+	flushNow       bool               // msgPartialSend was flushed and mustn't be held back (see Flush)
+	msgSeq         uint32             // the current message sequence number
+	largeAcked     uint               // number of packets too large to survive a blackhole acknowledged (see blackhole.go)
+	lastProgress   time.Time          // when the peer last acknowledged something, or when we started waiting (see sendstall.go)
+	sendStalled    bool               // Config.OnSendStall has been told sending is stalled
+	recvAckSeq     packet.PacketID    // largest packetID we've received an ACK from
+	sentAck2       uint32             // largest ACK2 packet we've sent
+	sendLossList   packetIDHeap       // loss list
+	sndPeriod      atomicDuration     // (set by congestion control) delay between sending packets
+	pacer          pacer              // when the next packet is due, according to sndPeriod
+	congestWindow  atomicUint32       // (set by congestion control) size of the current congestion window (in packets)
+	beats          atomicUint32       // number of times round our event loop, for the watchdog (see watchdog.go)
+	flowWindowSize uint               // negotiated maximum number of unacknowledged packets (in packets)
+	fec            *fecEncoder        // if set, we're sending FEC parity packets to our peer
+	compressor     *payloadCompressor // if set, we're compressing the data packets we send
 
 	// timers
 	sndEvent      <-chan time.Time // if a packet is recently sent, this timer fires when SND completes
+	corkEvent     <-chan time.Time // if a partly filled packet is being held back (see cork.go), fires when it's due
+	stallEvent    <-chan time.Time // if anything is waiting to be acknowledged, fires when sending would stall (see sendstall.go)
 	ack2SentEvent <-chan time.Time // if an ACK2 packet has recently sent, wait SYN before sending another one
-	expTimerEvent <-chan time.Time // Fires when we haven't heard from the peer in a while
 }
 
 func newUdtSocketSend(s *udtSocket) *udtSocketSend {
 	ss := &udtSocketSend{
 		socket:         s,
-		expCount:       1,
 		sendPktSeq:     s.initPktSeq,
 		sockClosed:     s.sockClosed,
 		sockShutdown:   s.sockShutdown,
 		sendEvent:      s.sendEvent,
+		expTimeout:     s.expTimeout,
 		messageOut:     s.messageOut,
+		debugEvent:     s.sendDebug,
+		mtuEvent:       s.mtuEvent,
 		congestWindow:  atomicUint32{val: 16},
 		flowWindowSize: s.maxFlowWinSize,
 		sendPacket:     s.sendPacket,
+		sendFeedback:   s.sendFeedback,
 		shutdownEvent:  s.shutdownEvent,
 	}
-	ss.resetEXP(s.created)
-	go ss.goSendEvent()
 	return ss
 }
 
@@ -78,11 +96,19 @@ func (s *udtSocketSend) configureHandshake(p *packet.HandshakePacket, resetSeq b
 		s.sendPktSeq = p.InitPktSeq
 	}
 	s.flowWindowSize = uint(p.MaxFlowWinSize)
+	if fecBlockSize := s.socket.Config.FECBlockSize; fecBlockSize > 0 {
+		if _, ok := p.Extension(packet.HsExtFEC); ok {
+			s.fec = newFecEncoder(fecBlockSize)
+		}
+	}
+	if compression := negotiateCompression(s.socket.Config, p); compression != CompressionNone {
+		s.compressor = newPayloadCompressor(compression)
+	}
 }
 
 func (s *udtSocketSend) SetPacketSendPeriod(snd time.Duration) {
 	// check to see if we have a bandwidth limit here
-	maxBandwidth := s.socket.Config.MaxBandwidth
+	maxBandwidth := s.socket.sendLimit.getRate()
 	if maxBandwidth > 0 {
 		minSP := time.Second / time.Duration(float64(maxBandwidth)/float64(s.socket.mtu.get()))
 		if snd < minSP {
@@ -97,22 +123,39 @@ func (s *udtSocketSend) goSendEvent() {
 	sendEvent := s.sendEvent
 	messageOut := s.messageOut
 	sockClosed := s.sockClosed
+	closing := false
 	for {
+		s.beats.add(1)
+		if closing && s.drained() {
+			// everything we've been asked to send has been acknowledged, we can now shut down
+			s.sendPacket <- &packet.ShutdownPacket{}
+			s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: true})
+			return
+		}
+
 		thisMsgChan := messageOut
 		sockShutdown := s.sockShutdown
 
+		s.lossDepth.set(uint32(len(s.sendLossList)))
+		s.updateMemory()
+		s.armStall()
+
+		// each packet we send (new or retransmitted) takes up a slot paced by the congestion control,
+		// with retransmissions taking priority over new data
 		switch s.sendState {
 		case sendStateIdle: // not waiting for anything, can send immediately
-			if s.msgPartialSend != nil { // we have a partial message waiting, try to send more of it now
+			if s.processSendLoss() {
+				continue
+			}
+			if s.msgPartialSend != nil && !s.corked { // we have a partial message waiting, try to send more of it now
 				s.processDataMsg(false, messageOut)
 				continue
 			}
-		case sendStateProcessDrop: // immediately re-process any drop list requests
-			s.sendState = s.reevalSendState() // try to reconstruct what our state should be if it wasn't sendStateProcessDrop
-			if !s.processSendLoss() || s.sendPktSeq.Seq%16 == 0 {
-				s.processSendExpire()
+		case sendStateWaiting: // flow window is full, but we can still retransmit anything that was lost
+			if s.processSendLoss() {
+				continue
 			}
-			continue
+			thisMsgChan = nil
 		case sendStateShutdown:
 			sockShutdown = nil
 			thisMsgChan = nil
@@ -123,12 +166,25 @@ func (s *udtSocketSend) goSendEvent() {
 		select {
 		case _, _ = <-sockShutdown:
 			s.sendState = sendStateShutdown
-			s.expTimerEvent = nil // don't process EXP events if we're shutting down
+			s.expTimeout = nil // don't process EXP events if we're shutting down
 		case msg, ok := <-thisMsgChan: // nil if we can't process outgoing messages right now
 			if !ok {
-				s.sendPacket <- &packet.ShutdownPacket{}
-				s.shutdownEvent <- shutdownMessage{sockState: sockStateClosed, permitLinger: true}
-				return
+				// don't shut down until our peer has received everything we've sent
+				messageOut = nil
+				closing = true
+				s.corked = false // nothing more is coming to fill it
+				continue
+			}
+			if msg.flush {
+				if s.corked {
+					s.corked = false
+					s.flushNow = true
+				}
+				continue
+			}
+			if s.corked { // add to the partly filled packet we're holding back
+				s.corked = false
+				msg = sendMessage{content: append(s.msgPartialSend.content, msg.content...), tim: s.msgPartialSend.tim}
 			}
 			s.msgPartialSend = &msg
 			s.processDataMsg(true, messageOut)
@@ -136,8 +192,6 @@ func (s *udtSocketSend) goSendEvent() {
 			if !ok {
 				return
 			}
-			s.expCount = 1
-			s.resetEXP(evt.now)
 			switch sp := evt.pkt.(type) {
 			case *packet.AckPacket:
 				s.ingestAck(sp, evt.now)
@@ -153,21 +207,39 @@ func (s *udtSocketSend) goSendEvent() {
 			return
 		case <-s.ack2SentEvent: // ACK2 unlocked
 			s.ack2SentEvent = nil
-		case now := <-s.expTimerEvent: // EXP event
+		case now := <-s.expTimeout: // EXP event
 			s.expEvent(now)
 		case <-s.sndEvent: // SND event
 			s.sndEvent = nil
-			if s.sendState == sendStateSending {
-				s.sendState = s.reevalSendState()
-				if !s.processSendLoss() || s.sendPktSeq.Seq%16 == 0 {
-					s.processSendExpire()
-				}
-			}
+			s.sendState = s.reevalSendState()
+		case <-s.corkEvent: // a partly filled packet held back is due
+			s.corkEvent = nil
+			s.corked = false
+		case now := <-s.stallEvent: // we may have stopped getting anything through
+			s.stallExpired(now)
+		case req := <-s.debugEvent:
+			s.debug(req.info)
+			close(req.done)
+		case <-s.mtuEvent:
+			s.socket.notifyMTU()
 		}
 	}
 }
 
+// drained returns true if we've sent everything we've been asked to and our peer has acknowledged all of it, so a
+// connection the application has closed can shut down without abandoning anything
+func (s *udtSocketSend) drained() bool {
+	return s.msgPartialSend == nil && s.sendPktPend == nil
+}
+
 func (s *udtSocketSend) reevalSendState() sendState {
+	// this is called whenever our windows change, so publish them for congestion control while we're here
+	s.socket.flightSize.set(uint32(len(s.sendPktPend)))
+	s.socket.flowWindow.set(uint32(s.flowWindowSize))
+
+	if s.sendState == sendStateShutdown {
+		return sendStateShutdown
+	}
 	if s.sndEvent != nil {
 		return sendStateSending
 	}
@@ -178,13 +250,41 @@ func (s *udtSocketSend) reevalSendState() sendState {
 		if cwnd > congestWindow {
 			cwnd = congestWindow
 		}
-		if cwnd >= uint(len(s.sendPktPend)) {
+		if uint(len(s.sendPktPend)) >= cwnd {
+			return sendStateWaiting
+		}
+		// or have we used up our share of memory? (see Config.MemoryLimit)
+		if !s.socket.m.mem.allows(s.socket.sockID, uint64(s.socket.mtu.get())) {
 			return sendStateWaiting
 		}
 	}
 	return sendStateIdle
 }
 
+// maxPayloadSize returns the largest amount of data we can fit in a single data packet
+func (s *udtSocketSend) maxPayloadSize() int {
+	// the negotiated packet size includes the IP and UDP headers
+	size := int(s.socket.mtu.get()) - udtHeaderSize - udp6HeaderSize
+	if s.socket.raddr.IP.To4() != nil {
+		size = int(s.socket.mtu.get()) - udtHeaderSize - udp4HeaderSize
+	}
+	if s.fec != nil {
+		size -= fecHeaderSize // leave room for the parity packet header
+	}
+	if s.compressor != nil {
+		size-- // leave room for the compression header
+	}
+	return size
+}
+
+// encodePayload returns the payload to send in a data packet for the specified data
+func (s *udtSocketSend) encodePayload(data []byte) []byte {
+	if s.compressor == nil {
+		return data
+	}
+	return s.compressor.compress(data)
+}
+
 // try to pack a new data packet and send it
 func (s *udtSocketSend) processDataMsg(isFirst bool, inChan <-chan sendMessage) {
 	for s.msgPartialSend != nil {
@@ -201,26 +301,22 @@ func (s *udtSocketSend) processDataMsg(isFirst bool, inChan <-chan sendMessage)
 			s.msgSeq++
 		}
 
-		mtu := int(s.socket.mtu.get())
+		// stream packets are always delivered in order, datagrams only if requested
+		inOrder := !s.socket.isDatagram || partialSend.inOrder
+
+		mtu := s.maxPayloadSize()
 		msgLen := len(partialSend.content)
-		if msgLen >= mtu {
+		if msgLen > mtu {
 			// we are full -- send what we can and leave the rest
-			var dp *packet.DataPacket
-			if msgLen == mtu {
-				dp = &packet.DataPacket{
-					Seq:  s.sendPktSeq,
-					Data: partialSend.content,
-				}
-				s.msgPartialSend = nil
-			} else {
-				dp = &packet.DataPacket{
-					Seq:  s.sendPktSeq,
-					Data: partialSend.content[0:mtu],
-				}
-				s.msgPartialSend = &sendMessage{content: partialSend.content[mtu:], tim: partialSend.tim, ttl: partialSend.ttl}
+			dp := &packet.DataPacket{
+				Seq:  s.sendPktSeq,
+				Data: s.encodePayload(partialSend.content[0:mtu]),
 			}
+			s.msgPartialSend = &sendMessage{content: partialSend.content[mtu:], tim: partialSend.tim, ttl: partialSend.ttl,
+				inOrder: partialSend.inOrder, receipt: partialSend.receipt}
+			s.socket.noteUnsent(-mtu)
 			s.sendPktSeq.Incr()
-			dp.SetMessageData(state, !s.socket.isDatagram, s.msgSeq)
+			dp.SetMessageData(state, inOrder, s.msgSeq)
 			s.sendDataPacket(sendPacketEntry{pkt: dp, tim: partialSend.tim, ttl: partialSend.ttl}, false)
 			return
 		}
@@ -232,9 +328,13 @@ func (s *udtSocketSend) processDataMsg(isFirst bool, inChan <-chan sendMessage)
 			} else {
 				state = packet.MbLast
 			}
-		} else {
+		} else if msgLen < mtu {
 			select {
 			case morePartialSend, ok := <-inChan:
+				if ok && morePartialSend.flush {
+					s.flushNow = true
+					continue
+				}
 				if ok {
 					// we have more data, concat and try again
 					s.msgPartialSend = &sendMessage{
@@ -245,26 +345,35 @@ func (s *udtSocketSend) processDataMsg(isFirst bool, inChan <-chan sendMessage)
 					continue
 				}
 			default:
-				// nothing immediately available, just send what we have
+				// nothing immediately available, just send what we have (unless we're holding it for more)
+				if s.holdPartial(inChan) {
+					return
+				}
 			}
 		}
 
 		partialSend = s.msgPartialSend
 		dp := &packet.DataPacket{
 			Seq:  s.sendPktSeq,
-			Data: partialSend.content,
+			Data: s.encodePayload(partialSend.content),
 		}
 		s.msgPartialSend = nil
+		s.socket.noteUnsent(-len(partialSend.content))
 		s.sendPktSeq.Incr()
-		dp.SetMessageData(state, !s.socket.isDatagram, s.msgSeq)
-		s.sendDataPacket(sendPacketEntry{pkt: dp, tim: partialSend.tim, ttl: partialSend.ttl}, false)
+		dp.SetMessageData(state, inOrder, s.msgSeq)
+		s.sendDataPacket(sendPacketEntry{pkt: dp, tim: partialSend.tim, ttl: partialSend.ttl, receipt: partialSend.receipt},
+			false)
 		return
 	}
 }
 
 // If the sender's loss list is not empty, retransmit the first packet in the list and remove it from the list.
 func (s *udtSocketSend) processSendLoss() bool {
-	if s.sendLossList == nil || s.sendPktPend == nil {
+	if s.sendLossList == nil {
+		return false
+	}
+	if s.sendPktPend == nil {
+		s.sendLossList = nil // nothing left that could be retransmitted
 		return false
 	}
 
@@ -287,92 +396,140 @@ func (s *udtSocketSend) processSendLoss() bool {
 			continue
 		}
 
-		if dp.ttl != 0 && time.Now().Add(dp.ttl).After(dp.tim) {
-			// this packet has expired, ignore
+		if dp.expired(s.socket.clock.Now()) || s.rexmitsExhausted(dp) {
+			// we've given up on this message, tell our peer not to wait for it
+			s.dropMessage(*dp)
 			continue
 		}
 
 		break
 	}
 
+	dp.rexmits++
+	s.noteRexmit(dp)
+	s.checkBlackhole(dp)
 	s.sendDataPacket(*dp, true)
 	return true
 }
 
+// rexmitsExhausted returns whether a datagram packet has been retransmitted as many times as Config.MaxRexmitAttempts
+// permits
+func (s *udtSocketSend) rexmitsExhausted(dp *sendPacketEntry) bool {
+	maxRexmits := s.socket.Config.MaxRexmitAttempts
+	return maxRexmits > 0 && s.socket.isDatagram && dp.rexmits >= maxRexmits
+}
+
 // evaluate our pending packet list to see if we have any expired messages
 func (s *udtSocketSend) processSendExpire() bool {
 	if s.sendPktPend == nil {
 		return false
 	}
 
-	pktPend := make([]sendPacketEntry, len(s.sendPktPend))
-	copy(pktPend, s.sendPktPend)
-	for _, p := range pktPend {
-		if p.ttl != 0 && time.Now().Add(p.ttl).After(p.tim) {
+	now := s.socket.clock.Now()
+	for idx := range s.sendPktPend {
+		if p := s.sendPktPend[idx]; p.expired(now) {
 			// this message has expired, drop it
-			_, _, msgNo := p.pkt.GetMessageData()
-			dropMsg := &packet.MsgDropReqPacket{
-				MsgID:    msgNo,
-				FirstSeq: p.pkt.Seq,
-				LastSeq:  p.pkt.Seq,
-			}
+			s.dropMessage(p)
+			return true
+		}
+	}
+	return false
+}
 
-			// find the other packets in this message
-			for _, op := range pktPend {
-				_, _, otherMsgNo := op.pkt.GetMessageData()
-				if otherMsgNo == msgNo {
-					if dropMsg.FirstSeq.BlindDiff(p.pkt.Seq) > 0 {
-						dropMsg.FirstSeq = p.pkt.Seq
-					}
-					if dropMsg.LastSeq.BlindDiff(p.pkt.Seq) < 0 {
-						dropMsg.LastSeq = p.pkt.Seq
-					}
-				}
-				if s.sendLossList != nil {
-					if _, slIdx := s.sendLossList.Find(p.pkt.Seq); slIdx >= 0 {
-						heap.Remove(&s.sendLossList, slIdx)
-					}
-				}
+// dropMessage gives up on sending the message containing the specified packet, asking our peer to stop waiting for it
+func (s *udtSocketSend) dropMessage(p sendPacketEntry) {
+	_, _, msgNo := p.pkt.GetMessageData()
+	dropMsg := &packet.MsgDropReqPacket{
+		MsgID:    msgNo,
+		FirstSeq: p.pkt.Seq,
+		LastSeq:  p.pkt.Seq,
+	}
+
+	// find the other packets in this message
+	for idx := range s.sendPktPend {
+		op := &s.sendPktPend[idx]
+		_, _, otherMsgNo := op.pkt.GetMessageData()
+		if otherMsgNo == msgNo {
+			if op.receipt != nil {
+				s.socket.settleReceipt(op.receipt, ErrMessageDropped)
+				op.receipt = nil
+			}
+			if dropMsg.FirstSeq.Cmp(op.pkt.Seq) > 0 {
+				dropMsg.FirstSeq = op.pkt.Seq
 			}
-			if s.sendLossList != nil && len(s.sendLossList) == 0 {
-				s.sendLossList = nil
+			if dropMsg.LastSeq.Cmp(op.pkt.Seq) < 0 {
+				dropMsg.LastSeq = op.pkt.Seq
 			}
+			if s.sendLossList != nil {
+				if _, slIdx := s.sendLossList.Find(op.pkt.Seq); slIdx >= 0 {
+					heap.Remove(&s.sendLossList, slIdx)
+				}
+			}
+		}
+	}
+	if s.sendLossList != nil && len(s.sendLossList) == 0 {
+		s.sendLossList = nil
+	}
 
-			s.sendPacket <- dropMsg
-			return true
+	// don't bother sending whatever is left of the message either
+	if s.msgPartialSend != nil && s.socket.isDatagram && msgNo == s.msgSeq {
+		s.socket.noteUnsent(-len(s.msgPartialSend.content))
+		if r := s.msgPartialSend.receipt; r != nil {
+			s.socket.settleReceipt(r, ErrMessageDropped)
 		}
+		s.msgPartialSend = nil
 	}
-	return false
+
+	s.sendPacket <- dropMsg
 }
 
 // we have a packed packet and a green light to send, so lets send this and mark it
 func (s *udtSocketSend) sendDataPacket(dp sendPacketEntry, isResend bool) {
-	if s.sendPktPend == nil {
-		s.sendPktPend = sendPacketHeap{dp}
-		heap.Init(&s.sendPktPend)
+	if isResend {
+		s.pktRetrans.add(1)
 	} else {
-		heap.Push(&s.sendPktPend, dp)
+		if s.sendPktPend == nil {
+			s.noteSendProgress(s.socket.clock.Now())
+			s.sendPktPend = sendPacketHeap{dp}
+			heap.Init(&s.sendPktPend)
+		} else {
+			heap.Push(&s.sendPktPend, dp)
+		}
+		s.noteUnacked(len(dp.pkt.Data))
+		s.socket.cong.onDataPktSent(dp.pkt.Seq)
+		s.socket.markActive(s.socket.clock.Now())
 	}
 
-	s.socket.cong.onDataPktSent(dp.pkt.Seq)
-	s.sendPacket <- dp.pkt
+	s.pktSent.add(1)
+	if isResend {
+		// an earlier send of this packet may still be being written out, so send a copy rather than setting its header
+		// underneath it
+		boundary, order, msg := dp.pkt.GetMessageData()
+		s.sendPacket <- packet.NewMessagePacket(0, 0, dp.pkt.Seq, boundary, order, msg, dp.pkt.Data)
+	} else {
+		s.sendPacket <- dp.pkt
+	}
 
-	// have we exceeded our recipient's window size?
-	s.sendState = s.reevalSendState()
-	if s.sendState == sendStateWaiting {
-		return
+	if !isResend && s.fec != nil {
+		if parity := s.fec.add(dp.pkt); parity != nil {
+			s.sendPacket <- parity
+		}
 	}
 
 	if !isResend && dp.pkt.Seq.Seq%16 == 0 {
 		s.processSendExpire()
-		return
 	}
 
-	snd := s.sndPeriod.get()
-	if snd > 0 {
-		s.sndEvent = time.After(snd)
-		s.sendState = sendStateSending
+	// don't send anything else (new or retransmitted) until the congestion control says we can.  The exception is
+	// packet 16n, which is immediately followed by 16n+1 so our peer can estimate the link capacity from the pair
+	if snd := s.sndPeriod.get(); snd > 0 && (isResend || dp.pkt.Seq.Seq&0xf != 0) {
+		if wait := s.pacer.delay(s.socket.clock.Now(), snd); wait > 0 {
+			s.sndEvent = s.socket.clock.After(wait)
+		}
 	}
+
+	// have we exceeded our recipient's window size?
+	s.sendState = s.reevalSendState()
 }
 
 // ingestLightAck is called to process a "light" ACK packet
@@ -380,17 +537,19 @@ func (s *udtSocketSend) ingestLightAck(p *packet.LightAckPacket, now time.Time)
 	// Update the largest acknowledged sequence number.
 
 	pktSeqHi := p.PktSeqHi
-	diff := pktSeqHi.BlindDiff(s.recvAckSeq)
+	diff := pktSeqHi.Diff(s.recvAckSeq)
 	if diff > 0 {
+		oldAckSeq := s.recvAckSeq
 		s.flowWindowSize += uint(diff)
 		s.recvAckSeq = pktSeqHi
+		s.releaseAcked(oldAckSeq, pktSeqHi)
 	}
 }
 
 func (s *udtSocketSend) assertValidSentPktID(pktType string, pktSeq packet.PacketID) bool {
-	if s.sendPktSeq.BlindDiff(pktSeq) < 0 {
-		s.shutdownEvent <- shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
-			err: fmt.Errorf("FAULT: Received an %s for packet %d, but the largest packet we've sent has been %d", pktType, pktSeq.Seq, s.sendPktSeq.Seq)}
+	if s.sendPktSeq.Cmp(pktSeq) < 0 {
+		s.shutdownEvent.signal(shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
+			err: fmt.Errorf("FAULT: Received an %s for packet %d, but the largest packet we've sent has been %d", pktType, pktSeq.Seq, s.sendPktSeq.Seq)})
 		return false
 	}
 	return true
@@ -400,19 +559,19 @@ func (s *udtSocketSend) assertValidSentPktID(pktType string, pktSeq packet.Packe
 func (s *udtSocketSend) ingestAck(p *packet.AckPacket, now time.Time) {
 	// Update the largest acknowledged sequence number.
 
-	// Send back an ACK2 with the same ACK sequence number in this ACK.
-	if s.ack2SentEvent == nil && p.AckSeqNo == s.sentAck2 {
+	// Send back an ACK2 with the same ACK sequence number in this ACK (at most once per SYN, unless this is a
+	// repeat of the last ACK we've answered)
+	if s.ack2SentEvent == nil || p.AckSeqNo == s.sentAck2 {
 		s.sentAck2 = p.AckSeqNo
-		s.sendPacket <- &packet.Ack2Packet{AckSeqNo: p.AckSeqNo}
-		s.ack2SentEvent = time.After(synTime)
+		s.sendFeedback <- &packet.Ack2Packet{AckSeqNo: p.AckSeqNo}
+		s.ack2SentEvent = s.socket.clock.After(synTime)
 	}
 
 	pktSeqHi := p.PktSeqHi
 	if !s.assertValidSentPktID("ACK", pktSeqHi) {
 		return
 	}
-	diff := pktSeqHi.BlindDiff(s.recvAckSeq)
-	if diff <= 0 {
+	if pktSeqHi.Cmp(s.recvAckSeq) <= 0 {
 		return
 	}
 
@@ -421,7 +580,9 @@ func (s *udtSocketSend) ingestAck(p *packet.AckPacket, now time.Time) {
 	s.recvAckSeq = pktSeqHi
 
 	// Update RTT and RTTVar.
-	s.socket.applyRTT(uint(p.Rtt))
+	if s.socket.rtt.applyPeer(uint(p.Rtt)) {
+		s.socket.notifyRTT()
+	}
 
 	// Update flow window size.
 	if p.IncludeLink {
@@ -433,14 +594,29 @@ func (s *udtSocketSend) ingestAck(p *packet.AckPacket, now time.Time) {
 	// Update packet arrival rate: A = (A * 7 + a) / 8, where a is the value carried in the ACK.
 	// Update estimated link capacity: B = (B * 7 + b) / 8, where b is the value carried in the ACK.
 
+	s.releaseAcked(oldAckSeq, pktSeqHi)
+}
+
+// releaseAcked forgets about any packets (sent or lost) that have now been acknowledged by our peer
+func (s *udtSocketSend) releaseAcked(oldAckSeq packet.PacketID, pktSeqHi packet.PacketID) {
 	// Update sender's buffer (by releasing the buffer that has been acknowledged).
 	if s.sendPktPend != nil {
+		released := false
 		for {
 			minLoss, minLossIdx := s.sendPktPend.Min(oldAckSeq, s.sendPktSeq)
-			if pktSeqHi.BlindDiff(minLoss.Seq) >= 0 || minLossIdx < 0 {
+			if minLossIdx < 0 || minLoss.Seq.Cmp(pktSeqHi) >= 0 {
 				break
 			}
+			s.noteLargeAcked(minLoss)
+			s.noteUnacked(-len(minLoss.Data))
+			if r := s.sendPktPend[minLossIdx].receipt; r != nil {
+				s.socket.settleReceipt(r, nil)
+			}
 			heap.Remove(&s.sendPktPend, minLossIdx)
+			released = true
+		}
+		if released {
+			s.noteSendProgress(s.socket.clock.Now())
 		}
 		if len(s.sendPktPend) == 0 {
 			s.sendPktPend = nil
@@ -451,7 +627,7 @@ func (s *udtSocketSend) ingestAck(p *packet.AckPacket, now time.Time) {
 	if s.sendLossList != nil {
 		for {
 			minLoss, minLossIdx := s.sendLossList.Min(oldAckSeq, s.sendPktSeq)
-			if pktSeqHi.BlindDiff(minLoss) >= 0 || minLossIdx < 0 {
+			if minLossIdx < 0 || minLoss.Cmp(pktSeqHi) >= 0 {
 				break
 			}
 			heap.Remove(&s.sendLossList, minLossIdx)
@@ -471,8 +647,8 @@ func (s *udtSocketSend) ingestNak(p *packet.NakPacket, now time.Time) {
 		if thisEntry&0x80000000 != 0 {
 			thisPktID := packet.PacketID{Seq: thisEntry & 0x7FFFFFFF}
 			if idx+1 == clen {
-				s.shutdownEvent <- shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
-					err: fmt.Errorf("FAULT: While unpacking a NAK, the last entry (%x) was describing a start-of-range", thisEntry)}
+				s.shutdownEvent.signal(shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
+					err: fmt.Errorf("FAULT: While unpacking a NAK, the last entry (%x) was describing a start-of-range", thisEntry)})
 				return
 			}
 			if !s.assertValidSentPktID("NAK", thisPktID) {
@@ -480,8 +656,8 @@ func (s *udtSocketSend) ingestNak(p *packet.NakPacket, now time.Time) {
 			}
 			lastEntry := p.CmpLossInfo[idx+1]
 			if lastEntry&0x80000000 != 0 {
-				s.shutdownEvent <- shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
-					err: fmt.Errorf("FAULT: While unpacking a NAK, a start-of-range (%x) was followed by another start-of-range (%x)", thisEntry, lastEntry)}
+				s.shutdownEvent.signal(shutdownMessage{sockState: sockStateCorrupted, permitLinger: false,
+					err: fmt.Errorf("FAULT: While unpacking a NAK, a start-of-range (%x) was followed by another start-of-range (%x)", thisEntry, lastEntry)})
 				return
 			}
 			lastPktID := packet.PacketID{Seq: lastEntry}
@@ -489,7 +665,7 @@ func (s *udtSocketSend) ingestNak(p *packet.NakPacket, now time.Time) {
 				return
 			}
 			idx++
-			for span := thisPktID; span != lastPktID; span.Incr() {
+			for span := thisPktID; span != lastPktID.Add(1); span.Incr() {
 				newLossList = append(newLossList, span)
 			}
 		} else {
@@ -502,6 +678,8 @@ func (s *udtSocketSend) ingestNak(p *packet.NakPacket, now time.Time) {
 	}
 
 	s.socket.cong.onNAK(newLossList)
+	s.pktSndLoss.add(uint64(len(newLossList)))
+	s.socket.notifyLoss(newLossList)
 
 	if s.sendLossList == nil {
 		s.sendLossList = newLossList
@@ -513,7 +691,7 @@ func (s *udtSocketSend) ingestNak(p *packet.NakPacket, now time.Time) {
 		}
 	}
 
-	s.sendState = sendStateProcessDrop // immediately restart transmission
+	s.sendState = s.reevalSendState() // restart transmission as soon as we're permitted to
 }
 
 // ingestCongestion is called to process a (retired?) Congestion packet
@@ -524,54 +702,23 @@ func (s *udtSocketSend) ingestCongestion(p *packet.CongestionPacket, now time.Ti
 	//m_iLastDecSeq = s.sendPktSeq
 }
 
-func (s *udtSocketSend) resetEXP(now time.Time) {
-	s.lastRecvTime = now
-
-	var nextExpDurn time.Duration
-	rtoPeriod := s.rtoPeriod.get()
-	if rtoPeriod > 0 {
-		nextExpDurn = rtoPeriod
-	} else {
-		rtt, rttVar := s.socket.getRTT()
-		nextExpDurn = (time.Duration(s.expCount*(rtt+4*rttVar))*time.Microsecond + synTime)
-		minExpTime := time.Duration(s.expCount) * minEXPinterval
-		if nextExpDurn < minExpTime {
-			nextExpDurn = minExpTime
-		}
-	}
-	s.expTimerEvent = time.After(nextExpDurn)
-}
-
-// we've just had the EXP timer expire, see what we can do to recover this
+// we've just had the EXP timer expire (we haven't heard from our peer in a while), see what we can do to recover this
 func (s *udtSocketSend) expEvent(currTime time.Time) {
-
-	// Haven't receive any information from the peer, is it dead?!
-	// timeout: at least 16 expirations and must be greater than 10 seconds
-	if (s.expCount > 16) && (currTime.Sub(s.lastRecvTime) > 5*time.Second) {
-		// Connection is broken.
-		s.shutdownEvent <- shutdownMessage{sockState: sockStateTimeout, permitLinger: true}
-		return
-	}
-
 	// sender: Insert all the packets sent after last received acknowledgement into the sender loss list.
 	// recver: Send out a keep-alive packet
 	if s.sendPktPend != nil {
 		if s.sendPktPend != nil && s.sendLossList == nil {
 			// resend all unacknowledged packets on timeout, but only if there is no packet in the loss list
 			newLossList := make([]packet.PacketID, 0)
-			for span := s.recvAckSeq.Add(1); span != s.sendPktSeq.Add(1); span.Incr() {
+			for span := s.recvAckSeq; span != s.sendPktSeq; span.Incr() {
 				newLossList = append(newLossList, span)
 			}
 			s.sendLossList = newLossList
 			heap.Init(&s.sendLossList)
 		}
 		s.socket.cong.onTimeout()
-		s.sendState = sendStateProcessDrop // immediately restart transmission
+		s.sendState = s.reevalSendState() // restart transmission as soon as we're permitted to
 	} else {
-		s.sendPacket <- &packet.KeepAlivePacket{}
+		s.sendFeedback <- &packet.KeepAlivePacket{}
 	}
-
-	s.expCount++
-	// Reset last response time since we just sent a heart-beat.
-	s.resetEXP(currTime)
 }
@@ -0,0 +1,260 @@
+package udt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestShutdownLatch(t *testing.T) {
+	l := newShutdownLatch()
+	first := errors.New("first")
+	l.signal(shutdownMessage{sockState: sockStateCorrupted, err: first})
+
+	// however many more requests come in, none of them block or replace the first
+	for i := 0; i < 100; i++ {
+		l.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: true})
+	}
+	select {
+	case <-l.ready:
+	default:
+		t.Fatal("latch wasn't signalled")
+	}
+	if l.msg.sockState != sockStateCorrupted || l.msg.err != first {
+		t.Errorf("expected the first request to be kept, got %+v", l.msg)
+	}
+	select {
+	case <-l.ready:
+		t.Error("latch was signalled more than once")
+	default:
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	go func() { // keep the data flowing
+		buf := make([]byte, 4096)
+		for {
+			if _, err := a.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 1000)
+			for {
+				if _, err := b.Write(buf); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Close(); err != nil {
+				t.Errorf("error closing: %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := b.Write([]byte("late")); err == nil {
+		t.Error("expected an error writing after Close")
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("error closing again: %s", err.Error())
+	}
+}
+
+func TestSocketDescription(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	s := a.(*udtSocket)
+
+	want := fmt.Sprintf("connected stream %s (id=%d) -> %s (id=%d)", a.LocalAddr(), s.sockID, a.RemoteAddr(), s.farSockID.get())
+	if desc := fmt.Sprint(a); desc != want {
+		t.Errorf("described connection as %q, expected %q", desc, want)
+	}
+
+	buf, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("error marshalling: %s", err.Error())
+	}
+	var got struct {
+		State      string
+		Type       string
+		RemoteAddr string
+		PeerSockID uint32
+		Stats      Stats
+	}
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("error unmarshalling %s: %s", buf, err.Error())
+	}
+	if got.State != "connected" || got.Type != "stream" || got.RemoteAddr != a.RemoteAddr().String() ||
+		got.PeerSockID != s.farSockID.get() {
+		t.Errorf("unexpected description %s", buf)
+	}
+
+	a.Close()
+	if desc := fmt.Sprint(a); !strings.HasPrefix(desc, "closed ") {
+		t.Errorf("expected a closed connection to be described as such, got %q", desc)
+	}
+}
+
+func TestStreamReadPartial(t *testing.T) {
+	s := &udtSocket{messageIn: make(chan recvMessage, 4), readClosed: make(chan struct{}), readDeadline: &deadline{}}
+	s.sockState.set(sockStateConnected)
+	s.messageIn <- recvMessage{content: []byte("abcdefgh")}
+	s.messageIn <- recvMessage{content: []byte("ijkl")}
+	close(s.readClosed) // nothing more is coming
+
+	// reads smaller than a packet, some of them spanning the end of one packet and the start of the next
+	var got []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := s.Read(buf)
+		if err != nil {
+			t.Fatalf("error reading: %s", err.Error())
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "abcdefghijkl" {
+		t.Errorf("expected to read abcdefghijkl, got %s", got)
+	}
+}
+
+func TestCloseWaitsForAck(t *testing.T) {
+	a, b := newPipeConns()
+	conn := &blackholeConn{PacketConn: b, limit: 100, lifted: 1}
+	servMx, err := NewMultiplexerWithConn(a, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(conn, nil)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	server := <-accepted
+	defer server.Close()
+
+	// while the data can't get through, Close waits for it
+	atomic.StoreInt32(&conn.lifted, 0)
+	msg := bytes.Repeat([]byte("x"), 1000)
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	closed := make(chan error, 1)
+	go func() {
+		closed <- client.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the data to be acknowledged")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// and returns once the peer has acknowledged it, with the shutdown already on the wire
+	atomic.StoreInt32(&conn.lifted, 1)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("error closing: %s", err.Error())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected Close to return once the data was acknowledged")
+	}
+	clientMx.Close() // as if the process exited straight away
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+	var netErr net.Error
+	if _, err := server.Read(buf); err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("expected the peer to be told the connection closed, got %v", err)
+	}
+}
+
+func TestCloseFailed(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	s := a.(*udtSocket)
+	if _, err := a.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+
+	// a connection that has already failed has nothing more to wait for
+	s.connFailed(errors.New("network gone"))
+	closed := make(chan error, 1)
+	go func() {
+		closed <- a.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("error closing: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close on a failed connection to return")
+	}
+	if _, err := a.Write([]byte("late")); err == nil {
+		t.Error("expected an error writing after Close")
+	}
+}
+
+func TestShutdownFlushesQueue(t *testing.T) {
+	// a shutdown packet queued just ahead of the shutdown itself is still sent, however the two are picked up
+	for i := 0; i < 8; i++ {
+		a, b := Pipe()
+		s := a.(*udtSocket)
+		s.pathsProt.Lock() // hold up the packet being written, so both are waiting when it's done
+		s.sendPacket <- &packet.KeepAlivePacket{}
+		time.Sleep(20 * time.Millisecond)
+		s.sendPacket <- &packet.ShutdownPacket{Code: uint32(CloseGoingAway), Reason: "test"}
+		s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false})
+		s.pathsProt.Unlock()
+
+		b.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var closeErr *CloseError
+		if _, err := b.Read(make([]byte, 16)); !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+			t.Fatalf("expected the peer to be told the connection closed, got %v", err)
+		}
+		b.Close()
+	}
+}
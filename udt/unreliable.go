@@ -0,0 +1,78 @@
+package udt
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+Alongside the reliable data stream, a connection can carry "best effort" datagrams for data that is worthless once
+stale (such as telemetry or media).  These are sent in user-defined control packets of a reserved message type, so
+(like messages sent with SendControl) they are never acknowledged or retransmitted, are delivered in whatever order
+they arrive, and must fit in a single packet.  Datagrams arriving faster than the application reads them are
+discarded.
+*/
+
+const (
+	unreliableMsgType   uint16 = 0x5544 // UserDefControlPacket message type used for unreliable datagrams
+	unreliableQueueSize        = 64     // number of unreliable datagrams held for ReadUnreliable before we start dropping them
+)
+
+// WriteUnreliable sends a datagram to our peer without any guarantee of delivery or ordering, returning the number
+// of bytes sent.  The datagram must fit in a single packet
+func (s *udtSocket) WriteUnreliable(p []byte) (int, error) {
+	if err := s.connectionError(); err != nil {
+		return 0, err
+	}
+	if s.sockState.get() != sockStateConnected {
+		return 0, errors.New("Connection not established")
+	}
+	if maxSize := s.maxControlSize(); len(p) > maxSize {
+		return 0, fmt.Errorf("Unreliable datagram of %d bytes exceeds the maximum of %d", len(p), maxSize)
+	}
+
+	up := &packet.UserDefControlPacket{MsgType: unreliableMsgType, Data: make([]byte, len(p))}
+	copy(up.Data, p)
+	select {
+	case s.sendPacket <- up:
+		return len(p), nil
+	case _, _ = <-s.sockClosed:
+		return 0, s.connectionError()
+	}
+}
+
+// ReadUnreliable returns the next datagram our peer sent with WriteUnreliable, blocking until one arrives.
+// ReadUnreliable can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline.
+func (s *udtSocket) ReadUnreliable() ([]byte, error) {
+	deadline := s.readDeadline.wait()
+	select {
+	case data := <-s.unreliableIn:
+		return data, nil
+	default:
+	}
+	if err := s.connectionError(); err != nil {
+		return nil, err
+	}
+	select {
+	case data := <-s.unreliableIn:
+		return data, nil
+	case <-deadline:
+		return nil, syscall.ETIMEDOUT
+	case _, _ = <-s.sockShutdown:
+	case _, _ = <-s.sockClosed:
+	}
+	return nil, s.connectionError()
+}
+
+// queueUnreliable holds a datagram received from our peer for ReadUnreliable, discarding it if too many are waiting
+func (s *udtSocket) queueUnreliable(data []byte) {
+	select {
+	case s.unreliableIn <- data:
+	default:
+		s.unreliableDrop.add(1)
+	}
+}
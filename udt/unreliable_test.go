@@ -0,0 +1,54 @@
+package udt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestUnreliable(t *testing.T) {
+	serv, client, server := connectWithClock(t, 40, defaultClock, DefaultConfig())
+	defer serv.Close()
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.WriteUnreliable(make([]byte, client.maxControlSize()+1)); err == nil {
+		t.Error("expected an oversized datagram to be refused")
+	}
+
+	// unreliable datagrams travel alongside the data stream without disturbing it
+	if _, err := client.Write([]byte("reliable")); err != nil {
+		t.Fatalf("error calling Write: %s", err.Error())
+	}
+	if _, err := client.WriteUnreliable([]byte("best effort")); err != nil {
+		t.Fatalf("error calling WriteUnreliable: %s", err.Error())
+	}
+
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := server.ReadUnreliable()
+	if err != nil {
+		t.Fatalf("error calling ReadUnreliable: %s", err.Error())
+	}
+	if !bytes.Equal(data, []byte("best effort")) {
+		t.Errorf("expected %q, got %q", "best effort", data)
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(server, buf); err != nil || !bytes.Equal(buf, []byte("reliable")) {
+		t.Errorf("expected %q on the data stream, got %q (%v)", "reliable", buf, err)
+	}
+
+	// with nothing waiting we wait out the deadline
+	server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := server.ReadUnreliable(); err == nil {
+		t.Error("expected ReadUnreliable to time out")
+	}
+
+	// datagrams that aren't read in time are discarded
+	for i := 0; i < unreliableQueueSize+1; i++ {
+		server.queueUnreliable([]byte{byte(i)})
+	}
+	if drops := server.Stats().PktUnrelDrop; drops != 1 {
+		t.Errorf("expected 1 datagram to be dropped, got %d", drops)
+	}
+}
@@ -0,0 +1,89 @@
+package udt
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+/*
+A connection whose sending or receiving goroutine stops making progress (such as one blocked forever in a callback, or
+in a bug of ours) otherwise looks alive: the connection manager still answers keep-alives, so the peer never times it
+out, yet nothing more is ever delivered.  Config.WatchdogTimeout watches for this.  Each time round its event loop, each
+side counts a heartbeat, and once per timeout the watchdog checks whether a side that had packets from the peer waiting
+for it at the last check has counted none since.  If so the connection is closed with a WedgedError describing the
+stalled side (and the peer told CloseInternalError), so that Read and Write return a diagnosis rather than waiting
+forever.  A stalled side is noticed between one and two timeouts after it stops.
+
+A receiving side held up by the application not reading what it has already delivered isn't stalled, nor is a
+receiving side in event-loop mode that has parked (see Config.EventLoop).
+*/
+
+// WedgedError describes a connection closed after its sending or receiving side stopped making progress, see
+// Config.WatchdogTimeout
+type WedgedError struct {
+	Side    string        // "send" or "receive"
+	Waiting uint          // number of packets from the peer waiting to be handled
+	Stalled time.Duration // how long the side has at least been stalled
+}
+
+func (e *WedgedError) Error() string {
+	return fmt.Sprintf("Connection wedged: %s side handled none of %d waiting packets in %s", e.Side, e.Waiting,
+		e.Stalled.String())
+}
+
+// watchdogSample is what the watchdog saw of one side of the connection at its last check
+type watchdogSample struct {
+	beats   uint32
+	waiting int
+}
+
+// stalled returns true if a side has had events waiting since the last check without handling any of them, updating
+// the sample
+func (w *watchdogSample) stalled(beats uint32, waiting int) bool {
+	result := w.waiting > 0 && waiting > 0 && beats == w.beats
+	w.beats, w.waiting = beats, waiting
+	return result
+}
+
+// goWatchdog checks that both sides of the connection are making progress every Config.WatchdogTimeout, until the
+// connection is shut down
+func (s *udtSocket) goWatchdog() {
+	timeout := s.Config.WatchdogTimeout
+	var send, recv watchdogSample
+	for {
+		select {
+		case <-s.sockShutdown:
+			return
+		case <-s.sockClosed:
+			return
+		case <-s.clock.After(timeout):
+		}
+
+		if waiting := len(s.sendEvent); send.stalled(s.send.beats.get(), waiting) {
+			s.wedged(&WedgedError{Side: "send", Waiting: uint(waiting), Stalled: timeout})
+			return
+		}
+		waiting := len(s.recvEvent)
+		if len(s.messageIn) == cap(s.messageIn) || (s.recvLoop != nil && s.recvLoop.state.get() == loopParked) {
+			waiting = 0 // waiting for the application to read, or for something new to do
+		}
+		if recv.stalled(s.recv.beats.get(), waiting) {
+			s.wedged(&WedgedError{Side: "receive", Waiting: uint(waiting), Stalled: timeout})
+			return
+		}
+	}
+}
+
+// wedged closes a connection that has stopped making progress, without relying on its sending or receiving side
+func (s *udtSocket) wedged(err *WedgedError) {
+	log.Printf("%s closing, %s", s.String(), err.Error())
+	select {
+	case s.sendPacket <- &packet.ShutdownPacket{Code: uint32(CloseInternalError), Reason: err.Side + " side wedged"}:
+	case <-s.sockClosed:
+		return
+	}
+	s.shutdownEvent.signal(shutdownMessage{sockState: sockStateClosed, permitLinger: false, err: err})
+}
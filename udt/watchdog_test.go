@@ -0,0 +1,96 @@
+package udt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestWatchdogStalled(t *testing.T) {
+	var sample watchdogSample
+	if sample.stalled(1, 5) {
+		t.Error("expected the first check not to report a stall")
+	}
+	if sample.stalled(2, 5) {
+		t.Error("expected a side that made progress not to be stalled")
+	}
+	if !sample.stalled(2, 3) {
+		t.Error("expected a side with events waiting and no progress to be stalled")
+	}
+	if sample.stalled(2, 0) {
+		t.Error("expected a side with nothing waiting not to be stalled")
+	}
+}
+
+func TestWatchdogWedged(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	config := DefaultConfig()
+	config.WatchdogTimeout = 100 * time.Millisecond
+	config.OnMTUChange = func(c Conn, mtu uint) {
+		<-unblock // wedge the sending side
+	}
+
+	a, b := newPipeConns()
+	servMx, err := NewMultiplexerWithConn(a, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer servMx.Close()
+	clientMx, err := NewMultiplexerWithConn(b, config)
+	if err != nil {
+		t.Fatalf("error calling NewMultiplexerWithConn: %s", err.Error())
+	}
+	defer clientMx.Close()
+	l, err := servMx.Listen()
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	client, err := clientMx.Dial(context.Background(), servMx.Addr(), true)
+	if err != nil {
+		t.Fatalf("error dialing: %s", err.Error())
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	// a healthy connection isn't disturbed
+	time.Sleep(3 * config.WatchdogTimeout)
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("error writing: %s", err.Error())
+	}
+	if _, err := server.Read(make([]byte, 100)); err != nil {
+		t.Fatalf("error reading: %s", err.Error())
+	}
+
+	s := client.(*udtSocket)
+	s.mtuLowered()
+	for i := 0; i < 3; i++ {
+		s.sendEvent <- recvPktEvent{pkt: &packet.LightAckPacket{PktSeqHi: s.initPktSeq}, now: time.Now()}
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.Read(make([]byte, 100))
+	var wedged *WedgedError
+	if !errors.As(err, &wedged) || wedged.Side != "send" {
+		t.Fatalf("expected a WedgedError for the send side from Read, got %v", err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = server.Read(make([]byte, 100))
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || !closeErr.Remote || closeErr.Code != CloseInternalError {
+		t.Errorf("expected the peer to be told of an internal error, got %v", err)
+	}
+}
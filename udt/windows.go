@@ -0,0 +1,198 @@
+package udt
+
+import (
+	"time"
+
+	"github.com/furstenheim/nth_element/FloydRivest"
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+// The receiver keeps three measurement windows, per section 3.4 of the UDT spec: the ACK history window (to time
+// ACK/ACK2 exchanges), the packet arrival window (to estimate the rate packets are arriving) and the packet pair window
+// (to estimate the link capacity from back-to-back probe packets).  None of these are safe for concurrent use, they
+// belong to goReceiveEvent
+
+type ackHistoryEntry struct {
+	ackID      uint32
+	lastPacket packet.PacketID
+	sendTime   time.Time
+}
+
+// ackWindow records the ACKs we've sent so that the roundtrip time can be measured when the matching ACK2 arrives.
+// Once full, the oldest entries are overwritten; they are unlikely to ever be acknowledged
+type ackWindow struct {
+	entries []ackHistoryEntry // circular buffer, in the order the ACKs were sent
+	head    int               // index of the oldest entry
+	count   int               // number of entries in use
+}
+
+func newAckWindow(size uint) *ackWindow {
+	if size < 1 {
+		size = 1
+	}
+	return &ackWindow{entries: make([]ackHistoryEntry, size)}
+}
+
+// store records an ACK we've just sent
+func (w *ackWindow) store(ackID uint32, lastPacket packet.PacketID, now time.Time) {
+	size := len(w.entries)
+	entry := ackHistoryEntry{ackID: ackID, lastPacket: lastPacket, sendTime: now}
+	if w.count < size {
+		w.entries[(w.head+w.count)%size] = entry
+		w.count++
+	} else {
+		w.entries[w.head] = entry
+		w.head = (w.head + 1) % size
+	}
+}
+
+// acknowledge finds the ACK answered by an ACK2, returning the packet ID it acknowledged and the time since it was
+// sent.  ACK2s are only sent for some of our ACKs, so this (and any ACKs preceding it) are removed from the window
+func (w *ackWindow) acknowledge(ackID uint32, now time.Time) (lastPacket packet.PacketID, rtt time.Duration, ok bool) {
+	size := len(w.entries)
+	for i := 0; i < w.count; i++ {
+		entry := &w.entries[(w.head+i)%size]
+		if entry.ackID == ackID {
+			lastPacket = entry.lastPacket
+			rtt = now.Sub(entry.sendTime)
+			ok = true
+			w.head = (w.head + i + 1) % size
+			w.count -= i + 1
+			return
+		}
+		if entry.ackID > ackID {
+			break
+		}
+	}
+	return
+}
+
+// len returns the number of ACKs waiting for an ACK2
+func (w *ackWindow) len() int {
+	return w.count
+}
+
+// intervalWindow holds the most recent of a series of time intervals
+type intervalWindow struct {
+	samples sortableDurnArray // circular buffer of intervals
+	next    int               // index the next interval will be written to
+	count   int               // number of intervals recorded (up to len(samples))
+}
+
+func newIntervalWindow(size uint) intervalWindow {
+	if size < 1 {
+		size = 1
+	}
+	return intervalWindow{samples: make(sortableDurnArray, size)}
+}
+
+func (w *intervalWindow) add(d time.Duration) {
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count++
+	}
+}
+
+// filter returns the median of the recorded intervals, along with the number and sum of those within a factor of 8 of
+// it.  The recorded intervals are left untouched
+func (w *intervalWindow) filter() (median time.Duration, count int, sum time.Duration) {
+	if w.count == 0 {
+		return
+	}
+	work := make(sortableDurnArray, w.count)
+	copy(work, w.samples[:w.count])
+	cutPos := w.count / 2
+	FloydRivest.Buckets(work, cutPos)
+	median = work[cutPos]
+
+	upper := median << 3 // upper bounds
+	lower := median >> 3 // lower bounds
+	for _, d := range work {
+		if d < upper && d > lower {
+			count++
+			sum += d
+		}
+	}
+	return
+}
+
+// arrivalWindow records the intervals between arriving data packets, to estimate the rate they are being received
+type arrivalWindow struct {
+	intervalWindow
+	lastArrival time.Time // time the most recent data packet arrived
+}
+
+func newArrivalWindow(size uint) *arrivalWindow {
+	return &arrivalWindow{intervalWindow: newIntervalWindow(size)}
+}
+
+// arrived records a data packet arriving
+func (w *arrivalWindow) arrived(now time.Time) {
+	if !w.lastArrival.IsZero() {
+		w.add(now.Sub(w.lastArrival))
+	}
+	w.lastArrival = now
+}
+
+// rate returns the median-filtered packet arrival rate in packets/sec, or zero if the arrivals have been too
+// irregular (fewer than half the intervals near the median) to give a meaningful answer
+func (w *arrivalWindow) rate() uint {
+	_, count, sum := w.filter()
+	if count <= w.count>>1 || sum <= 0 {
+		return 0
+	}
+	return uint(time.Second * time.Duration(count) / sum)
+}
+
+// pairWindow records the intervals between the two packets of each probe pair (packets 16n and 16n+1, sent
+// back-to-back), to estimate the capacity of the link
+type pairWindow struct {
+	intervalWindow
+}
+
+func newPairWindow(size uint) *pairWindow {
+	return &pairWindow{intervalWindow: newIntervalWindow(size)}
+}
+
+// bandwidth returns the median-filtered link capacity in packets/sec, or zero if no probes have been seen
+func (w *pairWindow) bandwidth() uint {
+	median, count, sum := w.filter()
+	if w.count == 0 {
+		return 0
+	}
+	// the median is weighted once more (as the reference implementation does), so a single probe is enough
+	count++
+	sum += median
+	if sum <= 0 {
+		return 0
+	}
+	return uint(time.Second * time.Duration(count) / sum)
+}
+
+// ackHistorySize returns the number of sent ACKs to remember while waiting for their ACK2
+func (s *udtSocket) ackHistorySize() uint {
+	size := s.Config.ACKHistorySize
+	if size == 0 {
+		size = DefaultConfig().ACKHistorySize
+	}
+	return size
+}
+
+// arrivalWindowSize returns the number of packet arrival intervals used to estimate the receive rate
+func (s *udtSocket) arrivalWindowSize() uint {
+	size := s.Config.ArrivalWindowSize
+	if size == 0 {
+		size = DefaultConfig().ArrivalWindowSize
+	}
+	return size
+}
+
+// pairWindowSize returns the number of probe pair intervals used to estimate the link capacity
+func (s *udtSocket) pairWindowSize() uint {
+	size := s.Config.PacketPairWindowSize
+	if size == 0 {
+		size = DefaultConfig().PacketPairWindowSize
+	}
+	return size
+}
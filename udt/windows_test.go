@@ -0,0 +1,97 @@
+package udt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odysseus654/go-udt/udt/packet"
+)
+
+func TestAckWindow(t *testing.T) {
+	start := time.Now()
+	w := newAckWindow(4)
+	for ackID := uint32(1); ackID <= 6; ackID++ {
+		w.store(ackID, packet.PacketID{Seq: ackID * 10}, start.Add(time.Duration(ackID)*time.Millisecond))
+	}
+	if w.len() != 4 {
+		t.Fatalf("expected the window to hold 4 ACKs, got %d", w.len())
+	}
+
+	// the two oldest were pushed out
+	if _, _, ok := w.acknowledge(2, start); ok {
+		t.Error("expected ACK 2 to have been pushed out of the window")
+	}
+
+	// acknowledging an ACK also drops the ones preceding it
+	lastPacket, rtt, ok := w.acknowledge(4, start.Add(10*time.Millisecond))
+	if !ok {
+		t.Fatal("expected ACK 4 to be found")
+	}
+	if lastPacket.Seq != 40 || rtt != 6*time.Millisecond {
+		t.Errorf("expected ACK 4 to cover packet 40 after 6ms, got packet %d after %v", lastPacket.Seq, rtt)
+	}
+	if w.len() != 2 {
+		t.Errorf("expected 2 ACKs left waiting, got %d", w.len())
+	}
+	if _, _, ok := w.acknowledge(3, start); ok {
+		t.Error("expected ACK 3 to have been dropped along with ACK 4")
+	}
+	if _, _, ok := w.acknowledge(4, start); ok {
+		t.Error("expected ACK 4 to only be acknowledged once")
+	}
+	if _, _, ok := w.acknowledge(6, start); !ok || w.len() != 0 {
+		t.Errorf("expected ACK 6 to empty the window, %d left", w.len())
+	}
+}
+
+func TestArrivalWindow(t *testing.T) {
+	w := newArrivalWindow(16)
+	if rate := w.rate(); rate != 0 {
+		t.Errorf("expected no rate before any packets arrive, got %d", rate)
+	}
+
+	// a packet every millisecond, with a couple of stalls that should be filtered out
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		if i == 5 || i == 12 {
+			now = now.Add(50 * time.Millisecond)
+		} else {
+			now = now.Add(time.Millisecond)
+		}
+		w.arrived(now)
+	}
+	if rate := w.rate(); rate != 1000 {
+		t.Errorf("expected 1000 packets/sec, got %d", rate)
+	}
+
+	// too irregular to say anything
+	w = newArrivalWindow(4)
+	for _, gap := range []time.Duration{time.Millisecond, 20 * time.Millisecond, 400 * time.Millisecond, 8 * time.Second} {
+		now = now.Add(gap)
+		w.arrived(now)
+	}
+	if rate := w.rate(); rate != 0 {
+		t.Errorf("expected no rate from irregular arrivals, got %d", rate)
+	}
+}
+
+func TestPairWindow(t *testing.T) {
+	w := newPairWindow(16)
+	if bw := w.bandwidth(); bw != 0 {
+		t.Errorf("expected no bandwidth before any probes, got %d", bw)
+	}
+
+	w.add(100 * time.Microsecond)
+	if bw := w.bandwidth(); bw != 10000 {
+		t.Errorf("expected a single probe to be enough, got %d", bw)
+	}
+
+	// older probes are pushed out of the window
+	for i := 0; i < 16; i++ {
+		w.add(50 * time.Microsecond)
+	}
+	w.add(10 * time.Millisecond) // a delayed probe should be filtered out
+	if bw := w.bandwidth(); bw != 20000 {
+		t.Errorf("expected 20000 packets/sec, got %d", bw)
+	}
+}